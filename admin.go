@@ -0,0 +1,56 @@
+package jelly
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AdminConfig contains options for the server admin endpoints, which allow
+// APIs to be disabled and re-enabled while the server is running with
+// RESTServer.DisableAPI and RESTServer.EnableAPI. Only logged-in users with
+// the admin role may use them.
+type AdminConfig struct {
+	// Enabled is whether to serve the admin endpoints.
+	Enabled bool
+
+	// Path is the path that the admin endpoints are served under. Unlike the
+	// paths of APIs, it is relative to the server root, not to the server's
+	// base. It will default to "/admin" if not set.
+	Path string
+
+	// Profiling is whether to serve the runtime profiles of net/http/pprof
+	// under ProfilingPath, so that CPU and heap profiles of a live server can
+	// be captured with "go tool pprof". Like the other admin endpoints, only
+	// logged-in users with the admin role may use them. Profiles are only
+	// served if Enabled is also set. It should not be set in production
+	// unless profiles are needed.
+	Profiling bool
+
+	// ProfilingPath is the path that the profiles are served under. It is
+	// relative to Path. It will default to "/debug/pprof" if not set.
+	ProfilingPath string
+}
+
+func (ac AdminConfig) FillDefaults() AdminConfig {
+	newAC := ac
+
+	if newAC.Path == "" {
+		newAC.Path = "/admin"
+	}
+	if newAC.ProfilingPath == "" {
+		newAC.ProfilingPath = "/debug/pprof"
+	}
+
+	return newAC
+}
+
+func (ac AdminConfig) Validate() error {
+	if ac.Enabled && !strings.HasPrefix(ac.Path, "/") {
+		return fmt.Errorf("path: must start with a '/'")
+	}
+	if ac.Enabled && ac.Profiling && !strings.HasPrefix(ac.ProfilingPath, "/") {
+		return fmt.Errorf("profiling_path: must start with a '/'")
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package jelly
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// archivedCtxKey is the key in a context that holds whether archived entities
+// are included.
+type archivedCtxKey struct{}
+
+// WithArchived returns a copy of ctx that has archived entities included in
+// the results of operations on repos that support archiving, such as
+// ArchivingAuthUserRepo. By default, archived entities are treated as though
+// they do not exist.
+func WithArchived(ctx context.Context) context.Context {
+	return context.WithValue(ctx, archivedCtxKey{}, true)
+}
+
+// ArchivedIncluded returns whether archived entities are to be included in
+// the results of operations that are given ctx. See WithArchived.
+func ArchivedIncluded(ctx context.Context) bool {
+	included, _ := ctx.Value(archivedCtxKey{}).(bool)
+	return included
+}
+
+// ArchivingAuthUserRepo is an interface that can optionally be implemented by
+// an AuthUserRepo to support soft-deletion of users. An archived user is kept
+// in the store but is excluded from the results of Get, GetAll, GetByUsername,
+// and Update unless the context they are given was created with WithArchived.
+// Delete always removes the user, archived or not. The username of an archived
+// user remains taken until it is deleted. The built-in authuser stores all
+// implement it.
+type ArchivingAuthUserRepo interface {
+	AuthUserRepo
+
+	// Archive archives the user with the given ID, setting its Archived time
+	// to the current time. If no unarchived user with that ID exists, an error
+	// is returned.
+	//
+	// This returns the object as it appears in the DB after archiving.
+	Archive(context.Context, uuid.UUID) (AuthUser, error)
+
+	// Restore restores the archived user with the given ID so that it is no
+	// longer archived. If no archived user with that ID exists, an error is
+	// returned.
+	//
+	// This returns the object as it appears in the DB after restoring.
+	Restore(context.Context, uuid.UUID) (AuthUser, error)
+
+	// DeleteArchivedBefore removes all users that were archived before the
+	// given time.
+	//
+	// This returns the objects as they appeared in the DB immediately before
+	// deletion.
+	DeleteArchivedBefore(context.Context, time.Time) ([]AuthUser, error)
+}
@@ -4,13 +4,29 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"mime"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/dekarrin/jelly"
+	"github.com/google/uuid"
 )
 
-var useJellyauthJWT = jelly.Override{Authenticators: []string{"jellyauth.jwt"}}
+// allowFields lets clients select the fields of user responses.
+var allowFields = jelly.Override{Fields: true}
+
+// archivePurgeInterval is how often archived users that are past their
+// retention are purged when soft-deletion is enabled.
+const archivePurgeInterval = time.Hour
+
+// maxBatchOperations is the maximum number of operations that a single batch
+// request to the users endpoint may have.
+const maxBatchOperations = 1000
+
+// maxUsersPageSize is the largest page of users that a client may get from the
+// users endpoint.
+const maxUsersPageSize = 500
 
 // loginAPI holds endpoint frontend for the login service.
 type loginAPI struct {
@@ -23,10 +39,60 @@ type loginAPI struct {
 	// requests from processing and I/O.
 	UnauthDelay time.Duration
 
-	// Secret is the secret used to sign JWT tokens.
+	// Secret is the secret used to sign JWT tokens when signing with
+	// SignHS512.
 	Secret []byte
 
-	pathPrefix string
+	// ServiceTokenLifetime is how long tokens issued to service accounts are
+	// valid for.
+	ServiceTokenLifetime time.Duration
+
+	// Attributes is the schema that user attributes are checked against.
+	Attributes AttributeSchema
+
+	// RequireAdmin2FA is whether admin users must complete two-factor
+	// authentication to log in.
+	RequireAdmin2FA bool
+
+	// TOTPIssuer is the issuer name given in TOTP provisioning URIs.
+	TOTPIssuer string
+
+	// GuestTokens is whether guest tokens can be issued to unauthenticated
+	// clients.
+	GuestTokens bool
+
+	// GuestTokenLifetime is how long guest tokens are valid for.
+	GuestTokenLifetime time.Duration
+
+	// Challenger creates and checks the challenges that clients must pass to
+	// log in once there have been too many failed attempts.
+	Challenger Challenger
+
+	// Register is whether clients can register their own users.
+	Register bool
+
+	// RegisterRole is the role given to users who register themselves.
+	RegisterRole jelly.Role
+
+	// keys holds the keys used to sign and verify JWT tokens.
+	keys keySet
+
+	// throttle counts failed logins to decide when a challenge is required.
+	throttle *throttle
+
+	// registrations counts the users registered from each IP address to
+	// limit how many can be.
+	registrations *throttle
+
+	// stopPurge stops the purging of archived users. It is nil if
+	// soft-deletion is not enabled.
+	stopPurge context.CancelFunc
+
+	// purgeDone is closed once purging of archived users has stopped.
+	purgeDone chan struct{}
+
+	// urls builds the URIs of the resources of the API.
+	urls jelly.Bundle
 
 	// the name this API is configured under, used to find the name of own
 	// auth provider
@@ -40,25 +106,95 @@ func (api *loginAPI) Init(cb jelly.Bundle) error {
 	api.log = cb.Logger()
 	api.Secret = cb.GetByteSlice(ConfigKeySecret)
 
+	alg, err := ParseSigningAlg(cb.Get(ConfigKeySignAlg))
+	if err != nil {
+		return fmt.Errorf(ConfigKeySignAlg+": %w", err)
+	}
+	if alg.Asymmetric() {
+		grace := time.Duration(cb.GetInt(ConfigKeyPrevKeyGrace)) * time.Minute
+		api.keys, err = loadKeySet(alg, cb.Get(ConfigKeySignKey), cb.GetSlice(ConfigKeyPrevSignKeys), grace)
+		if err != nil {
+			return fmt.Errorf("load signing keys: %w", err)
+		}
+		api.log.Debugf("signing tokens with %s key %s (%d previous key(s) accepted)", alg, api.keys.active.id, len(api.keys.previous))
+	} else {
+		api.keys = newSecretKeySet(api.Secret)
+	}
+
 	unauth := cb.GetInt(ConfigKeyUnauthDelay)
 	var d time.Duration
 	if unauth >= 0 {
 		d = time.Duration(unauth) * time.Millisecond
 	}
 	api.UnauthDelay = d
+	api.ServiceTokenLifetime = time.Duration(cb.GetInt(ConfigKeyServiceTokenLifetime)) * time.Minute
+
+	api.Attributes, err = ParseAttributeSchema(cb.GetSlice(ConfigKeyUserAttributes))
+	if err != nil {
+		return fmt.Errorf(ConfigKeyUserAttributes+": %w", err)
+	}
 
-	authRaw := cb.DB(0)
-	authStore, ok := authRaw.(jelly.AuthUserStore)
-	if !ok {
-		return fmt.Errorf("DB provided under 'auth' does not implement db.AuthUserStore")
+	// in a dry run that does not connect DBs there is no store to check, so
+	// only the rest of the config is
+	authStore, err := jelly.DBAs[jelly.AuthUserStore](cb, 0)
+	if err != nil {
+		return err
 	}
+	hasher, err := NewPasswordHasher(HashAlg(cb.Get(ConfigKeyPasswordHash)), cb.GetInt(ConfigKeyPasswordCost), cb.GetInt(ConfigKeyPasswordMemory))
+	if err != nil {
+		return fmt.Errorf(ConfigKeyPasswordHash+": %w", err)
+	}
+
 	api.Service = loginService{
-		Provider: authStore,
+		Provider:     authStore,
+		LoginHistory: time.Duration(cb.GetInt(ConfigKeyLoginHistory)) * 24 * time.Hour,
+
+		SoftDelete:       cb.GetBool(ConfigKeySoftDelete),
+		ArchiveRetention: time.Duration(cb.GetInt(ConfigKeyArchiveRetention)) * 24 * time.Hour,
+
+		Events:      cb.Events(),
+		EventPrefix: cb.Name(),
+
+		Hasher: hasher,
+
+		Tokens: newTokenCache(time.Duration(cb.GetInt(ConfigKeyTokenCache)) * time.Millisecond),
+	}
+	api.urls = cb
+
+	api.RequireAdmin2FA = cb.GetBool(ConfigKeyRequireAdmin2FA)
+	api.TOTPIssuer = cb.Get(ConfigKeyTOTPIssuer)
+	api.GuestTokens = cb.GetBool(ConfigKeyGuestTokens)
+	api.GuestTokenLifetime = time.Duration(cb.GetInt(ConfigKeyGuestTokenLifetime)) * time.Minute
+	if api.Challenger == nil {
+		api.Challenger = NoChallenge{}
+	}
+	api.throttle = newThrottle(cb.GetInt(ConfigKeyChallengeAfter), time.Duration(cb.GetInt(ConfigKeyChallengeWindow))*time.Minute)
+	api.Register = cb.GetBool(ConfigKeyRegister)
+	api.RegisterRole, err = jelly.ParseRole(cb.Get(ConfigKeyRegisterRole))
+	if err != nil {
+		return fmt.Errorf(ConfigKeyRegisterRole+": %w", err)
+	}
+	api.registrations = newThrottle(cb.GetInt(ConfigKeyRegisterLimit), time.Hour)
+	if api.RequireAdmin2FA && authStore != nil {
+		if _, err := api.Service.twoFactors(); err != nil {
+			return fmt.Errorf(ConfigKeyRequireAdmin2FA+": %w", err)
+		}
+	}
+	if api.Service.SoftDelete && authStore != nil {
+		if _, err := api.Service.archivingUsers(); err != nil {
+			return fmt.Errorf(ConfigKeySoftDelete+": %w", err)
+		}
 	}
-	api.pathPrefix = cb.Base()
 
 	ctx := context.Background()
 	setAdmin := cb.Get(ConfigKeySetAdmin)
+	if setAdmin != "" && cb.DryRun() {
+		// only check it; the admin is set once the server is created for real
+		if _, _, err := parseSetAdmin(setAdmin); err != nil {
+			return fmt.Errorf(ConfigKeySetAdmin+": %w", err)
+		}
+		setAdmin = ""
+	}
 	if setAdmin != "" {
 		username, pass, err := parseSetAdmin(setAdmin)
 		if err != nil {
@@ -95,26 +231,96 @@ func (api *loginAPI) Init(cb jelly.Bundle) error {
 		}
 	}
 
+	if api.Service.SoftDelete && !cb.DryRun() {
+		api.startPurge()
+	}
+
 	return nil
 }
 
+// ProvidedService returns the UserLoginService of the API, for other APIs to
+// get with Bundle.Service.
+func (api *loginAPI) ProvidedService() interface{} {
+	var svc jelly.UserLoginService = api.Service
+	return svc
+}
+
+// startPurge starts purging archived users that are past their retention in
+// the background, once immediately and then every archivePurgeInterval, until
+// Shutdown is called.
+func (api *loginAPI) startPurge() {
+	ctx, cancel := context.WithCancel(context.Background())
+	api.stopPurge = cancel
+	api.purgeDone = make(chan struct{})
+
+	go func() {
+		defer close(api.purgeDone)
+
+		ticker := time.NewTicker(archivePurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			deleted, err := api.Service.PurgeArchivedUsers(ctx)
+			if err != nil && ctx.Err() == nil {
+				api.log.Errorf("purge archived users: %v", err)
+			}
+			for _, u := range deleted {
+				api.log.Infof("purged user '%s' (%s), archived %s", u.Username, u.ID, u.Archived.Format(time.RFC3339))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
 func (api *loginAPI) Authenticators() map[string]jelly.Authenticator {
 	// this provides one and only one authenticator, the jwt one.
 
 	// we will have had Init called, ergo secret and the service db will exist
+	// unless it was a dry run that did not connect DBs
+	prov := jwtAuthProvider{
+		keys:        api.keys,
+		unauthDelay: api.UnauthDelay,
+		srv:         api.Service,
+		guests:      api.GuestTokens,
+	}
+	if api.Service.Provider != nil {
+		prov.db = api.Service.Provider.AuthUsers()
+	}
+	if accounts, err := api.Service.serviceAccounts(); err == nil {
+		prov.accounts = accounts
+	}
+	if sessions, err := api.Service.sessions(); err == nil {
+		prov.sessions = sessions
+	}
+
 	return map[string]jelly.Authenticator{
-		"jwt": jwtAuthProvider{
-			secret:      api.Secret,
-			db:          api.Service.Provider.AuthUsers(),
-			unauthDelay: api.UnauthDelay,
-			srv:         api.Service,
-		},
+		"jwt": prov,
 	}
 }
 
-// Shutdown shuts down the login API. This is added to implement jelapi.API, and
-// has no effect on the login API but to return the error of the context.
+// useJWT returns the Override that makes an endpoint authenticate with the JWT
+// authenticator of the API. The authenticator is registered under the name of
+// the API, so each instance of jellyauth authenticates its own users.
+func (api loginAPI) useJWT() jelly.Override {
+	return jelly.Override{Authenticators: []string{api.name + ".jwt"}}
+}
+
+// Shutdown shuts down the login API. This is added to implement jelly.API. It
+// stops the purging of archived users if it is running and returns the error
+// of the context.
 func (api *loginAPI) Shutdown(ctx context.Context) error {
+	if api.stopPurge != nil {
+		api.stopPurge()
+		select {
+		case <-api.purgeDone:
+		case <-ctx.Done():
+		}
+	}
 	return ctx.Err()
 }
 
@@ -136,7 +342,7 @@ func (api loginAPI) httpGetInfo(em jelly.ServiceProvider) http.HandlerFunc {
 			userStr = "user '" + user.Username + "'"
 		}
 		return em.OK(resp, "%s got API info", userStr)
-	}, useJellyauthJWT)
+	}, api.useJWT(), jelly.Override{Response: "jellyauth.Info"})
 }
 
 // httpCreateLogin returns a HandlerFunc that uses the API to log in a user with
@@ -146,7 +352,7 @@ func (api loginAPI) httpCreateLogin(em jelly.ServiceProvider) http.HandlerFunc {
 		loginData := loginRequest{}
 		err := jelly.ParseJSONRequest(req, &loginData)
 		if err != nil {
-			return em.BadRequest(err.Error(), err.Error())
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
 		}
 
 		if loginData.Username == "" {
@@ -156,28 +362,250 @@ func (api loginAPI) httpCreateLogin(em jelly.ServiceProvider) http.HandlerFunc {
 			return em.BadRequest("password: property is empty or missing from request", "empty password")
 		}
 
+		if api.throttle.exceeded(loginData.Username, time.Now()) {
+			if r, ok := api.checkChallenge(em, req, loginData); !ok {
+				return r
+			}
+		}
+
 		user, err := api.Service.Login(req.Context(), loginData.Username, loginData.Password)
 		if err != nil {
 			if errors.Is(err, jelly.ErrBadCredentials) {
+				api.recordLoginAttempt(req, loginData.Username, false)
+				api.throttle.add(loginData.Username, time.Now())
 				return em.Unauthorized(jelly.ErrBadCredentials.Error(), "user '%s': %s", loginData.Username, err.Error())
 			} else {
 				return em.InternalServerError(err.Error())
 			}
 		}
+		api.throttle.reset(loginData.Username)
 
-		// build the token
-		// password is valid, generate token for user and return it.
-		tok, err := generateToken(api.Secret, user)
+		// users with two-factor authentication must give a code before they
+		// are fully logged in
+		hasTwoFactor, err := api.Service.HasTwoFactor(req.Context(), user.ID)
 		if err != nil {
-			return em.InternalServerError("could not generate JWT: " + err.Error())
+			return em.InternalServerError("could not check two-factor authentication: " + err.Error())
 		}
+		if hasTwoFactor || (api.RequireAdmin2FA && user.Role == jelly.Admin) {
+			step := twoFactorVerify
+			if !hasTwoFactor {
+				step = twoFactorEnroll
+			}
 
-		resp := loginResponse{
-			Token:  tok,
-			UserID: user.ID.String(),
+			tok, err := generatePendingToken(api.keys, user, step)
+			if err != nil {
+				return em.InternalServerError("could not generate JWT: " + err.Error())
+			}
+
+			resp := loginResponse{
+				UserID:       user.ID.String(),
+				PendingToken: tok,
+				TwoFactor:    step,
+			}
+			return em.Accepted(resp, "user '%s' must complete two-factor authentication (%s)", user.Username, step)
+		}
+
+		resp, err := api.completeLogin(req, user, loginData.GuestToken)
+		if err != nil {
+			return em.InternalServerError(err.Error())
 		}
 		return em.Created(resp, "user '"+user.Username+"' successfully logged in")
-	}, useJellyauthJWT)
+	}, api.useJWT(), jelly.Override{Request: "jellyauth.LoginRequest", Response: "jellyauth.Login"})
+}
+
+// checkChallenge checks the response to a challenge given in a login request
+// that must pass one. If the request may go on to check the password, ok is
+// true. Otherwise, r is the response to send, which gives a new challenge if
+// one is required.
+func (api loginAPI) checkChallenge(em jelly.ServiceProvider, req *http.Request, loginData loginRequest) (r jelly.Result, ok bool) {
+	ip := clientIP(req)
+
+	if loginData.ChallengeID != "" {
+		passed, err := api.Challenger.Verify(req.Context(), loginData.Username, ip, loginData.ChallengeID, loginData.ChallengeResponse)
+		if err != nil {
+			return em.InternalServerError("could not verify login challenge: " + err.Error()), false
+		}
+		if passed {
+			return jelly.Result{}, true
+		}
+	}
+
+	ch, err := api.Challenger.Challenge(req.Context(), loginData.Username, ip)
+	if err != nil {
+		return em.InternalServerError("could not create login challenge: " + err.Error()), false
+	}
+	if ch.ID == "" {
+		return jelly.Result{}, true
+	}
+
+	msg := "too many failed login attempts; the challenge must be passed to log in"
+	if loginData.ChallengeID != "" {
+		msg = "challenge response is incorrect"
+	}
+	resp := challengeRequiredResponse{
+		ErrorResponse: jelly.ErrorResponse{Error: msg, Status: http.StatusUnauthorized},
+		Challenge:     ch,
+	}
+	r = em.Response(http.StatusUnauthorized, resp, "user '%s': login requires %s challenge: %s", loginData.Username, ch.Type, msg)
+	r.IsErr = true
+	return r, false
+}
+
+// completeLogin records a successful login by user, starts a session for it,
+// and returns the response containing their new token. If guestTok is set, the
+// guest it was issued to is upgraded to user.
+func (api loginAPI) completeLogin(req *http.Request, user jelly.AuthUser, guestTok string) (loginResponse, error) {
+	api.recordLoginAttempt(req, user.Username, true)
+
+	// start a session for the login if the store can track them
+	sess, err := api.Service.StartSession(req.Context(), user.ID, clientIP(req), req.UserAgent(), userTokenLifetime)
+	if err == nil {
+		user.SessionID = sess.ID
+	} else if !errors.Is(err, jelly.ErrNotFound) {
+		return loginResponse{}, fmt.Errorf("could not start session: %w", err)
+	}
+
+	// build the token
+	// password is valid, generate token for user and return it.
+	tok, err := generateToken(api.keys, user)
+	if err != nil {
+		return loginResponse{}, fmt.Errorf("could not generate JWT: %w", err)
+	}
+
+	if guestTok != "" {
+		api.upgradeGuest(req, guestTok, user)
+	}
+
+	return loginResponse{
+		Token:  tok,
+		UserID: user.ID.String(),
+	}, nil
+}
+
+// upgradeGuest calls the GuestUpgradeHooks for the guest that guestTok was
+// issued to now that it has logged in as user. The client has already proven
+// who it is by then, so an invalid guest token or a failing hook is only
+// logged and does not fail the login.
+func (api loginAPI) upgradeGuest(req *http.Request, guestTok string, user jelly.AuthUser) {
+	if !api.GuestTokens {
+		api.log.Warnf("user '%s' login: ignoring guest token: guest tokens are not enabled", user.Username)
+		return
+	}
+
+	guest, err := validateToken(req.Context(), guestTok, api.keys, api.Service.Provider.AuthUsers(), nil, nil, true)
+	if err == nil && !guest.Guest {
+		err = fmt.Errorf("not a guest token")
+	}
+	if err == nil && guest.TenantID != user.TenantID {
+		err = fmt.Errorf("guest belongs to a different tenant")
+	}
+	if err != nil {
+		api.log.Warnf("user '%s' login: ignoring guest token: %v", user.Username, err)
+		return
+	}
+
+	for _, err := range runGuestUpgradeHooks(req.Context(), guest.ID, user) {
+		api.log.Errorf("user '%s' login: upgrade guest %s: %v", user.Username, guest.ID, err)
+	}
+	api.log.Debugf("upgraded guest %s to user '%s'", guest.ID, user.Username)
+}
+
+// httpCreateTwoFactorLogin returns a HandlerFunc that completes the login of a
+// user who must give a second factor. The pending token from the initial login
+// is exchanged along with a TOTP code or recovery code for a full token.
+//
+// If the pending token requires the user to set up two-factor authentication,
+// they must first begin it with httpCreateTwoFactorLoginEnrollment; the code
+// given here then confirms it, and the response includes their new recovery
+// codes.
+//
+// After too many incorrect codes in a row, two-factor login for the user is
+// locked for a time, and it responds with an HTTP-429 until the lock expires.
+func (api loginAPI) httpCreateTwoFactorLogin(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		var body twoFactorLoginRequest
+		err := jelly.ParseJSONRequest(req, &body)
+		if err != nil {
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+		if body.PendingToken == "" {
+			return em.BadRequest("pending_token: property is empty or missing from request", "empty pending_token")
+		}
+		if body.Code == "" && body.RecoveryCode == "" {
+			return em.BadRequest("code: property is empty or missing from request", "empty code and recovery_code")
+		}
+
+		user, step, err := validatePendingToken(req.Context(), body.PendingToken, api.keys, api.Service.Provider.AuthUsers())
+		if err != nil {
+			return em.Unauthorized("", "two-factor login: %s", err.Error())
+		}
+
+		var recoveryCodes []string
+		if step == twoFactorEnroll {
+			if body.Code == "" {
+				return em.BadRequest("code: property is empty or missing from request", "empty code")
+			}
+			_, recoveryCodes, err = api.Service.ConfirmTwoFactor(req.Context(), user.ID, body.Code)
+		} else {
+			_, err = api.Service.VerifyTwoFactor(req.Context(), user.ID, body.Code, body.RecoveryCode)
+		}
+		if err != nil {
+			if errors.Is(err, jelly.ErrBadCredentials) {
+				api.recordLoginAttempt(req, user.Username, false)
+				return em.Unauthorized("the supplied two-factor code is incorrect", "user '%s' two-factor login: %s", user.Username, err.Error())
+			} else if errors.Is(err, jelly.ErrRateLimited) {
+				api.recordLoginAttempt(req, user.Username, false)
+				return em.TooManyRequests("Too many incorrect two-factor codes; try again later", twoFactorLockout, "user '%s' two-factor login: %s", user.Username, err.Error())
+			} else if errors.Is(err, jelly.ErrNotFound) || errors.Is(err, jelly.ErrAlreadyExists) || errors.Is(err, jelly.ErrConflict) {
+				// two-factor state changed since the pending token was issued,
+				// or a concurrent request used the same code
+				return em.Unauthorized("", "user '%s' two-factor login: %s", user.Username, err.Error())
+			}
+			return em.InternalServerError(err.Error())
+		}
+
+		resp, err := api.completeLogin(req, user, body.GuestToken)
+		if err != nil {
+			return em.InternalServerError(err.Error())
+		}
+		resp.RecoveryCodes = recoveryCodes
+
+		return em.Created(resp, "user '%s' successfully logged in with two-factor authentication", user.Username)
+	}, api.useJWT(), jelly.Override{Request: "jellyauth.TwoFactorLoginRequest", Response: "jellyauth.Login"})
+}
+
+// httpCreateTwoFactorLoginEnrollment returns a HandlerFunc that begins setting
+// up two-factor authentication for a user who is required to have it in order
+// to log in. It requires a pending token from the initial login.
+func (api loginAPI) httpCreateTwoFactorLoginEnrollment(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		var body twoFactorLoginRequest
+		err := jelly.ParseJSONRequest(req, &body)
+		if err != nil {
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+		if body.PendingToken == "" {
+			return em.BadRequest("pending_token: property is empty or missing from request", "empty pending_token")
+		}
+
+		user, step, err := validatePendingToken(req.Context(), body.PendingToken, api.keys, api.Service.Provider.AuthUsers())
+		if err != nil {
+			return em.Unauthorized("", "two-factor enrollment: %s", err.Error())
+		}
+		if step != twoFactorEnroll {
+			return em.Forbidden("user '%s' two-factor enrollment at login: already enrolled", user.Username)
+		}
+
+		tf, err := api.Service.BeginTwoFactor(req.Context(), user.ID)
+		if err != nil {
+			if errors.Is(err, jelly.ErrAlreadyExists) {
+				return em.Conflict(jelly.UserMessage(err), err.Error())
+			}
+			return em.InternalServerError(err.Error())
+		}
+
+		return em.Created(api.twoFactorEnrollModel(user, tf), "user '%s' began two-factor enrollment at login", user.Username)
+	}, api.useJWT(), jelly.Override{Request: "jellyauth.TwoFactorLoginRequest", Response: "jellyauth.TwoFactorEnrollment"})
 }
 
 // httpDeleteLogin returns a HandlerFunc that deletes active login for some
@@ -226,7 +654,7 @@ func (api loginAPI) httpDeleteLogin(em jelly.ServiceProvider) http.HandlerFunc {
 		}
 
 		return em.NoContent("user '%s' successfully logged out %s", user.Username, otherStr)
-	}, useJellyauthJWT)
+	}, api.useJWT())
 }
 
 // httpCreateToken returns a HandlerFunc that creates a new token for the user
@@ -239,7 +667,28 @@ func (api loginAPI) httpCreateToken(em jelly.ServiceProvider) http.HandlerFunc {
 	return em.Endpoint(func(req *http.Request) jelly.Result {
 		user, _ := em.GetLoggedInUser(req)
 
-		tok, err := generateToken(api.Secret, user)
+		// service accounts must exchange their secret for new tokens; allowing
+		// them here would let a scoped token be traded for an unscoped one.
+		if user.ServiceAccount {
+			return em.Forbidden("service account '%s' create token: forbidden", user.Username)
+		}
+		if user.Guest {
+			return em.Forbidden("guest %s create token: forbidden", user.ID)
+		}
+
+		// the new token belongs to the same session, which must now last as
+		// long as it does
+		if user.SessionID != uuid.Nil {
+			_, err := api.Service.ExtendSession(req.Context(), user.SessionID, userTokenLifetime)
+			if err != nil {
+				if errors.Is(err, jelly.ErrNotFound) {
+					return em.Unauthorized("", "user '%s' create token: session was revoked", user.Username)
+				}
+				return em.InternalServerError("could not extend session: " + err.Error())
+			}
+		}
+
+		tok, err := generateToken(api.keys, user)
 		if err != nil {
 			return em.InternalServerError("could not generate JWT: " + err.Error())
 		}
@@ -249,11 +698,52 @@ func (api loginAPI) httpCreateToken(em jelly.ServiceProvider) http.HandlerFunc {
 			UserID: user.ID.String(),
 		}
 		return em.Created(resp, "user '"+user.Username+"' successfully created new token")
-	}, useJellyauthJWT)
+	}, api.useJWT(), jelly.Override{Response: "jellyauth.Login"})
+}
+
+// httpCreateGuestToken returns a HandlerFunc that issues a guest token to an
+// unauthenticated client. If the client already holds a valid guest token, it
+// is renewed for the same guest instead so that any state the guest has is
+// kept. Clients logged in as a user cannot get a guest token.
+func (api loginAPI) httpCreateGuestToken(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		user, loggedIn := em.GetLoggedInUser(req)
+
+		var guest jelly.AuthUser
+		if loggedIn {
+			if !user.Guest {
+				return em.Forbidden("user '%s' create guest token: already logged in", user.Username)
+			}
+			guest = user
+		} else {
+			tenantID, _ := jelly.TenantFromContext(req.Context())
+			guest = guestPrincipal(uuid.New(), tenantID, time.Now())
+		}
+
+		tok, err := generateGuestToken(api.keys, guest, api.GuestTokenLifetime)
+		if err != nil {
+			return em.InternalServerError("could not generate JWT: " + err.Error())
+		}
+
+		resp := guestTokenResponse{
+			Token:     tok,
+			GuestID:   guest.ID.String(),
+			ExpiresIn: int(api.GuestTokenLifetime.Seconds()),
+		}
+		if loggedIn {
+			return em.Created(resp, "guest %s successfully renewed guest token", guest.ID)
+		}
+		return em.Created(resp, "new guest %s successfully created guest token", guest.ID)
+	}, api.useJWT(), jelly.Override{Response: "jellyauth.GuestToken"})
 }
 
 // httpGetAllUsers returns a HandlerFunc that retrieves all existing users. Only
-// an admin user can call this endpoint.
+// an admin user can call this endpoint. The fields of the users in the response
+// can be selected with the fields query parameter. If the auth store supports
+// it, the Last-Modified header is set and requests with an If-Modified-Since
+// header are answered with an HTTP-304 if no user has changed since then. If
+// the client gives the page or page_size query parameters, only that page of
+// users is given, with a Link header linking to the other pages.
 //
 // The handler has requirements for the request context it receives, and if the
 // requirements are not met it may return an HTTP-500. The context must contain
@@ -266,16 +756,42 @@ func (api loginAPI) httpGetAllUsers(em jelly.ServiceProvider) http.HandlerFunc {
 			return em.Forbidden("user '%s' (role %s): forbidden", user.Username, user.Role)
 		}
 
-		users, err := api.Service.GetAllUsers(req.Context())
+		var query struct {
+			Archived bool `query:"archived"`
+		}
+		if err := jelly.BindQuery(req, &query); err != nil {
+			return em.BadRequest(jelly.UserMessage(err), "query: %s", err.Error())
+		}
+		page, err := jelly.ParsePage(req, 0, maxUsersPageSize)
+		if err != nil {
+			return em.BadRequest(jelly.UserMessage(err), "query: %s", err.Error())
+		}
+
+		ctx := req.Context()
+		if query.Archived {
+			ctx = jelly.WithArchived(ctx)
+		}
+
+		lastModified, _, err := api.Service.UsersLastModified(ctx)
 		if err != nil {
 			return em.InternalServerError(err.Error())
 		}
+		if jelly.NotModifiedSince(req, lastModified) {
+			return em.NotModified("user '%s' got all users: not modified", user.Username).
+				WithLastModified(lastModified)
+		}
+
+		users, err := api.Service.GetAllUsers(ctx)
+		if err != nil {
+			return em.InternalServerError(err.Error())
+		}
+		users, page = jelly.Paginate(users, page)
 
 		resp := make([]userModel, len(users))
 
 		for i := range users {
 			resp[i] = userModel{
-				URI:            api.pathPrefix + "/users/" + users[i].ID.String(),
+				URI:            api.urls.URLFor("users", users[i].ID),
 				ID:             users[i].ID.String(),
 				Username:       users[i].Username,
 				Role:           users[i].Role.String(),
@@ -284,11 +800,19 @@ func (api loginAPI) httpGetAllUsers(em jelly.ServiceProvider) http.HandlerFunc {
 				LastLogoutTime: users[i].LastLogout.Format(time.RFC3339),
 				LastLoginTime:  users[i].LastLogin.Format(time.RFC3339),
 				Email:          users[i].Email,
+				TenantID:       users[i].TenantID,
+				Attributes:     users[i].Attributes,
+				Version:        users[i].Version,
+			}
+			if !users[i].Archived.IsZero() {
+				resp[i].Archived = users[i].Archived.Format(time.RFC3339)
 			}
 		}
 
-		return em.OK(resp, "user '%s' got all users", user.Username)
-	}, useJellyauthJWT)
+		return em.OK(resp, "user '%s' got all users", user.Username).
+			WithLastModified(lastModified).
+			WithPage(api.urls.Absolute(req, req.URL.RequestURI()), page)
+	}, api.useJWT(), jelly.Override{Response: "[]jellyauth.User"}, allowFields)
 }
 
 // httpCreateUser returns a HandlerFunc that creates a new user entity. Only an
@@ -308,7 +832,7 @@ func (api loginAPI) httpCreateUser(em jelly.ServiceProvider) http.HandlerFunc {
 		var createUser userModel
 		err := jelly.ParseJSONRequest(req, &createUser)
 		if err != nil {
-			return em.BadRequest(err.Error(), err.Error())
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
 		}
 		if createUser.Username == "" {
 			return em.BadRequest("username: property is empty or missing from request", "empty username")
@@ -325,19 +849,35 @@ func (api loginAPI) httpCreateUser(em jelly.ServiceProvider) http.HandlerFunc {
 			}
 		}
 
-		newUser, err := api.Service.CreateUser(req.Context(), createUser.Username, createUser.Password, createUser.Email, role)
+		attrs, err := api.Attributes.Normalize(createUser.Attributes)
+		if err != nil {
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+
+		ctx, err := userTenantContext(req, createUser)
+		if err != nil {
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+
+		newUser, err := api.Service.CreateUser(ctx, createUser.Username, createUser.Password, createUser.Email, role)
 		if err != nil {
 			if errors.Is(err, jelly.ErrAlreadyExists) {
 				return em.Conflict("User with that username already exists", "user '%s' already exists", createUser.Username)
 			} else if errors.Is(err, jelly.ErrBadArgument) {
-				return em.BadRequest(err.Error(), err.Error())
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
 			} else {
 				return em.InternalServerError(err.Error())
 			}
 		}
+		if attrs != nil {
+			newUser, err = api.Service.UpdateAttributes(ctx, newUser.ID.String(), attrs)
+			if err != nil {
+				return em.InternalServerError(err.Error())
+			}
+		}
 
 		resp := userModel{
-			URI:            api.pathPrefix + "/users/" + newUser.ID.String(),
+			URI:            api.urls.URLFor("users", newUser.ID),
 			ID:             newUser.ID.String(),
 			Username:       newUser.Username,
 			Role:           newUser.Role.String(),
@@ -346,15 +886,73 @@ func (api loginAPI) httpCreateUser(em jelly.ServiceProvider) http.HandlerFunc {
 			LastLogoutTime: newUser.LastLogout.Format(time.RFC3339),
 			LastLoginTime:  newUser.LastLogin.Format(time.RFC3339),
 			Email:          newUser.Email,
+			TenantID:       newUser.TenantID,
+			Attributes:     newUser.Attributes,
+			Version:        newUser.Version,
 		}
 
 		return em.Created(resp, "user '%s' (%s) created", resp.Username, resp.ID)
-	}, useJellyauthJWT)
+	}, api.useJWT(), jelly.Override{Request: "jellyauth.User", Response: "jellyauth.User"})
+}
+
+// httpRegister returns a HandlerFunc that creates a new user for a client that
+// is not logged in. The user is given the configured RegisterRole, and the
+// number of users that can be registered from one IP address is limited.
+func (api loginAPI) httpRegister(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		var reg registerRequest
+		err := jelly.ParseJSONRequest(req, &reg)
+		if err != nil {
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+		if reg.Username == "" {
+			return em.BadRequest("username: property is empty or missing from request", "empty username")
+		}
+		if reg.Password == "" {
+			return em.BadRequest("password: property is empty or missing from request", "empty password")
+		}
+
+		ip := clientIP(req)
+		if api.registrations.exceeded(ip, time.Now()) {
+			return em.TooManyRequests("Too many users have been registered; try again later", time.Hour, "client %s is over the registration limit", ip)
+		}
+
+		newUser, err := api.Service.RegisterUser(req.Context(), reg.Username, reg.Password, reg.Email, api.RegisterRole)
+		if err != nil {
+			if errors.Is(err, jelly.ErrAlreadyExists) {
+				return em.Conflict("User with that username already exists", "user '%s' already exists", reg.Username)
+			} else if errors.Is(err, jelly.ErrBadArgument) {
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
+			} else {
+				return em.InternalServerError(err.Error())
+			}
+		}
+		api.registrations.add(ip, time.Now())
+
+		resp := api.userModel(newUser)
+		return em.Created(resp, "user '%s' (%s) registered from %s", newUser.Username, newUser.ID, ip)
+	}, api.useJWT(), jelly.Override{Request: "jellyauth.RegisterRequest", Response: "jellyauth.User"})
+}
+
+// userTenantContext returns the context that a user given in a request body
+// should be created in. If the body specifies a tenant, the user is created in
+// that tenant; it must match the tenant of the request, if there is one.
+func userTenantContext(req *http.Request, body userModel) (context.Context, error) {
+	ctx := req.Context()
+	if body.TenantID == "" {
+		return ctx, nil
+	}
+
+	if tenantID, ok := jelly.TenantFromContext(ctx); ok && tenantID != body.TenantID {
+		return nil, fmt.Errorf("tenant_id: must be same as the tenant of the request")
+	}
+	return jelly.WithTenant(ctx, body.TenantID), nil
 }
 
 // httpGetUser returns a HandlerFunc that gets an existing user. All users may
 // retrieve themselves, but only an admin user can retrieve details on other
-// users.
+// users. The fields of the response can be selected with the fields query
+// parameter.
 //
 // The handler has requirements for the request context it receives, and if the
 // requirements are not met it may return an HTTP-500. The context must contain
@@ -383,7 +981,7 @@ func (api loginAPI) httpGetUser(em jelly.ServiceProvider) http.HandlerFunc {
 		userInfo, err := api.Service.GetUser(req.Context(), id.String())
 		if err != nil {
 			if errors.Is(err, jelly.ErrBadArgument) {
-				return em.BadRequest(err.Error(), err.Error())
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
 			} else if errors.Is(err, jelly.ErrNotFound) {
 				return em.NotFound()
 			}
@@ -392,7 +990,7 @@ func (api loginAPI) httpGetUser(em jelly.ServiceProvider) http.HandlerFunc {
 
 		// put it into a model to return
 		resp := userModel{
-			URI:            api.pathPrefix + "/users/" + userInfo.ID.String(),
+			URI:            api.urls.URLFor("users", userInfo.ID),
 			ID:             userInfo.ID.String(),
 			Username:       userInfo.Username,
 			Role:           userInfo.Role.String(),
@@ -401,6 +999,9 @@ func (api loginAPI) httpGetUser(em jelly.ServiceProvider) http.HandlerFunc {
 			LastLogoutTime: userInfo.LastLogout.Format(time.RFC3339),
 			LastLoginTime:  userInfo.LastLogin.Format(time.RFC3339),
 			Email:          userInfo.Email,
+			TenantID:       userInfo.TenantID,
+			Attributes:     userInfo.Attributes,
+			Version:        userInfo.Version,
 		}
 
 		var otherStr string
@@ -414,8 +1015,9 @@ func (api loginAPI) httpGetUser(em jelly.ServiceProvider) http.HandlerFunc {
 			otherStr = "self"
 		}
 
-		return em.OK(resp, "user '%s' successfully got %s", user.Username, otherStr)
-	}, useJellyauthJWT)
+		return em.OK(resp, "user '%s' successfully got %s", user.Username, otherStr).
+			WithHeader("ETag", jelly.VersionETag(userInfo.Version))
+	}, api.useJWT(), jelly.Override{Response: "jellyauth.User"}, allowFields)
 }
 
 // httpUpdateUser returns a HandlerFunc that updates an existing user. Only
@@ -423,6 +1025,13 @@ func (api loginAPI) httpGetUser(em jelly.ServiceProvider) http.HandlerFunc {
 // to update the created time will have no effect). All users may update
 // themselves, but only the admin user may update other users.
 //
+// Updates to attributes are merged with the user's existing attributes rather
+// than replacing them; an attribute given with a null value is removed.
+//
+// If the request has an If-Match header, the update is only made if it matches
+// the ETag of the user, and an HTTP-412 is returned otherwise. An update that
+// races with another modification of the user fails with an HTTP-409.
+//
 // The handler has requirements for the request context it receives, and if the
 // requirements are not met it may return an HTTP-500. The context must contain
 // the ID of the user being operated on and the logged-in user of the client
@@ -457,7 +1066,7 @@ func (api loginAPI) httpUpdateUser(em jelly.ServiceProvider) http.HandlerFunc {
 				}
 			}
 
-			return em.BadRequest(err.Error(), err.Error())
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
 		}
 
 		// pre-parse updateRole if needed so we return bad request before hitting
@@ -466,17 +1075,46 @@ func (api loginAPI) httpUpdateUser(em jelly.ServiceProvider) http.HandlerFunc {
 		if updateReq.Role.Update {
 			updateRole, err = jelly.ParseRole(updateReq.Role.Value)
 			if err != nil {
-				return em.BadRequest(err.Error(), err.Error())
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
+			}
+		}
+
+		// attributes given as null are removed; the rest must match the schema
+		var setAttrs map[string]interface{}
+		var removeAttrs []string
+		if updateReq.Attributes.Update {
+			given := map[string]interface{}{}
+			for name, v := range updateReq.Attributes.Value {
+				if v == nil {
+					removeAttrs = append(removeAttrs, name)
+				} else {
+					given[name] = v
+				}
+			}
+			setAttrs, err = api.Attributes.Normalize(given)
+			if err != nil {
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
 			}
 		}
 
+		ifMatch, hasIfMatch, err := jelly.IfMatchVersion(req)
+		if err != nil {
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+
 		existing, err := api.Service.GetUser(req.Context(), id.String())
 		if err != nil {
 			if errors.Is(err, jelly.ErrNotFound) {
+				if hasIfMatch {
+					return em.PreconditionFailed("user does not exist", "If-Match given for nonexistent user %s", id)
+				}
 				return em.NotFound()
 			}
 			return em.InternalServerError(err.Error())
 		}
+		if hasIfMatch && existing.Version != ifMatch {
+			return em.PreconditionFailed("user has been modified", "If-Match version %d does not match current version %d", ifMatch, existing.Version)
+		}
 
 		var newEmail string
 		if existing.Email != "" {
@@ -500,25 +1138,55 @@ func (api loginAPI) httpUpdateUser(em jelly.ServiceProvider) http.HandlerFunc {
 
 		// TODO: this is sequential modification. we need to update this when we get
 		// transactions on jeldb.
-		updated, err := api.Service.UpdateUser(req.Context(), id.String(), newID, newUsername, newEmail, newRole)
+		updated, err := api.Service.UpdateUserVersioned(req.Context(), id.String(), newID, newUsername, newEmail, newRole, existing.Version)
 		if err != nil {
 			if errors.Is(err, jelly.ErrAlreadyExists) {
-				return em.Conflict(err.Error(), err.Error())
+				return em.Conflict(jelly.UserMessage(err), err.Error())
 			} else if errors.Is(err, jelly.ErrNotFound) {
 				return em.NotFound()
+			} else if errors.Is(err, jelly.ErrConflict) {
+				if hasIfMatch {
+					return em.PreconditionFailed("user has been modified", err.Error())
+				}
+				return em.Conflict("user was modified by another request; retry with the current user", err.Error())
 			}
 			return em.InternalServerError(err.Error())
 		}
+		if updateReq.Attributes.Update {
+			newAttrs := map[string]interface{}{}
+			for name, v := range updated.Attributes {
+				newAttrs[name] = v
+			}
+			for _, name := range removeAttrs {
+				delete(newAttrs, name)
+			}
+			for name, v := range setAttrs {
+				newAttrs[name] = v
+			}
+			updated, err = api.Service.UpdateAttributes(req.Context(), updated.ID.String(), newAttrs)
+			if err != nil {
+				if errors.Is(err, jelly.ErrNotFound) {
+					return em.NotFound()
+				} else if errors.Is(err, jelly.ErrConflict) {
+					return em.Conflict("user was modified by another request; retry with the current user", err.Error())
+				}
+				return em.InternalServerError(err.Error())
+			}
+		}
 		if updateReq.Password.Update {
 			updated, err = api.Service.UpdatePassword(req.Context(), updated.ID.String(), updateReq.Password.Value)
-			if errors.Is(err, jelly.ErrNotFound) {
-				return em.NotFound()
+			if err != nil {
+				if errors.Is(err, jelly.ErrNotFound) {
+					return em.NotFound()
+				} else if errors.Is(err, jelly.ErrConflict) {
+					return em.Conflict("user was modified by another request; retry with the current user", err.Error())
+				}
+				return em.InternalServerError(err.Error())
 			}
-			return em.InternalServerError(err.Error())
 		}
 
 		resp := userModel{
-			URI:            api.pathPrefix + "/users/" + updated.ID.String(),
+			URI:            api.urls.URLFor("users", updated.ID),
 			ID:             updated.ID.String(),
 			Username:       updated.Username,
 			Role:           updated.Role.String(),
@@ -527,10 +1195,14 @@ func (api loginAPI) httpUpdateUser(em jelly.ServiceProvider) http.HandlerFunc {
 			LastLogoutTime: updated.LastLogout.Format(time.RFC3339),
 			LastLoginTime:  updated.LastLogin.Format(time.RFC3339),
 			Email:          updated.Email,
+			TenantID:       updated.TenantID,
+			Attributes:     updated.Attributes,
+			Version:        updated.Version,
 		}
 
-		return em.Created(resp, "user '%s' (%s) updated", resp.Username, resp.ID)
-	}, useJellyauthJWT)
+		return em.Created(resp, "user '%s' (%s) updated", resp.Username, resp.ID).
+			WithHeader("ETag", jelly.VersionETag(updated.Version))
+	}, api.useJWT(), jelly.Override{Request: "jellyauth.UserUpdate", Response: "jellyauth.User"})
 }
 
 // httpReplaceUser returns a HandlerFunc that replaces a user entity with a
@@ -553,7 +1225,7 @@ func (api loginAPI) httpReplaceUser(em jelly.ServiceProvider) http.HandlerFunc {
 		var createUser userModel
 		err := jelly.ParseJSONRequest(req, &createUser)
 		if err != nil {
-			return em.BadRequest(err.Error(), err.Error())
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
 		}
 		if createUser.Username == "" {
 			return em.BadRequest("username: property is empty or missing from request", "empty username")
@@ -576,29 +1248,45 @@ func (api loginAPI) httpReplaceUser(em jelly.ServiceProvider) http.HandlerFunc {
 			}
 		}
 
-		newUser, err := api.Service.CreateUser(req.Context(), createUser.Username, createUser.Password, createUser.Email, role)
+		attrs, err := api.Attributes.Normalize(createUser.Attributes)
 		if err != nil {
-			if errors.Is(err, jelly.ErrAlreadyExists) {
-				return em.Conflict("User with that username already exists", "user '%s' already exists", createUser.Username)
-			} else if errors.Is(err, jelly.ErrBadArgument) {
-				return em.BadRequest(err.Error(), err.Error())
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+
+		ctx, err := userTenantContext(req, createUser)
+		if err != nil {
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+
+		newUser, err := api.Service.CreateUser(ctx, createUser.Username, createUser.Password, createUser.Email, role)
+		if err != nil {
+			if errors.Is(err, jelly.ErrAlreadyExists) {
+				return em.Conflict("User with that username already exists", "user '%s' already exists", createUser.Username)
+			} else if errors.Is(err, jelly.ErrBadArgument) {
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
 			}
 			return em.InternalServerError(err.Error())
 		}
 
 		// but also update it immediately to set its user ID
-		newUser, err = api.Service.UpdateUser(req.Context(), newUser.ID.String(), createUser.ID, newUser.Username, newUser.Email, newUser.Role)
+		newUser, err = api.Service.UpdateUserVersioned(ctx, newUser.ID.String(), createUser.ID, newUser.Username, newUser.Email, newUser.Role, newUser.Version)
 		if err != nil {
 			if errors.Is(err, jelly.ErrAlreadyExists) {
 				return em.Conflict("User with that username already exists", "user '%s' already exists", createUser.Username)
 			} else if errors.Is(err, jelly.ErrBadArgument) {
-				return em.BadRequest(err.Error(), err.Error())
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
 			}
 			return em.InternalServerError(err.Error())
 		}
+		if attrs != nil {
+			newUser, err = api.Service.UpdateAttributes(ctx, newUser.ID.String(), attrs)
+			if err != nil {
+				return em.InternalServerError(err.Error())
+			}
+		}
 
 		resp := userModel{
-			URI:            api.pathPrefix + "/users/" + newUser.ID.String(),
+			URI:            api.urls.URLFor("users", newUser.ID),
 			ID:             newUser.ID.String(),
 			Username:       newUser.Username,
 			Role:           newUser.Role.String(),
@@ -607,10 +1295,13 @@ func (api loginAPI) httpReplaceUser(em jelly.ServiceProvider) http.HandlerFunc {
 			LastLogoutTime: newUser.LastLogout.Format(time.RFC3339),
 			LastLoginTime:  newUser.LastLogin.Format(time.RFC3339),
 			Email:          newUser.Email,
+			TenantID:       newUser.TenantID,
+			Attributes:     newUser.Attributes,
+			Version:        newUser.Version,
 		}
 
 		return em.Created(resp, "user '%s' (%s) created", resp.Username, resp.ID)
-	}, useJellyauthJWT)
+	}, api.useJWT(), jelly.Override{Request: "jellyauth.User", Response: "jellyauth.User"})
 }
 
 // httpDeleteUser returns a HandlerFunc that deletes a user entity. All users
@@ -642,7 +1333,7 @@ func (api loginAPI) httpDeleteUser(em jelly.ServiceProvider) http.HandlerFunc {
 		deletedUser, err := api.Service.DeleteUser(req.Context(), id.String())
 		if err != nil && !errors.Is(err, jelly.ErrNotFound) {
 			if errors.Is(err, jelly.ErrBadArgument) {
-				return em.BadRequest(err.Error(), err.Error())
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
 			}
 			return em.InternalServerError("could not delete user: " + err.Error())
 		}
@@ -658,6 +1349,1176 @@ func (api loginAPI) httpDeleteUser(em jelly.ServiceProvider) http.HandlerFunc {
 			otherStr = "self"
 		}
 
-		return em.NoContent("user '%s' successfully deleted %s", user.Username, otherStr)
-	}, useJellyauthJWT)
+		verb := "deleted"
+		if api.Service.SoftDelete {
+			verb = "archived"
+		}
+
+		return em.NoContent("user '%s' successfully %s %s", user.Username, verb, otherStr)
+	}, api.useJWT())
+}
+
+// httpRestoreUser returns a HandlerFunc that restores a user that was archived
+// by soft-deletion. Only an admin user may restore users.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the ID of the user being restored and the logged-in user of the client
+// making the request.
+func (api loginAPI) httpRestoreUser(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := em.GetLoggedInUser(req)
+
+		if user.Role != jelly.Admin {
+			return em.Forbidden("user '%s' (role %s) restore user %s: forbidden", user.Username, user.Role, id)
+		}
+
+		restored, err := api.Service.RestoreUser(req.Context(), id.String())
+		if err != nil {
+			if errors.Is(err, jelly.ErrBadArgument) {
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
+			} else if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not restore user: " + err.Error())
+		}
+
+		resp := userModel{
+			URI:            api.urls.URLFor("users", restored.ID),
+			ID:             restored.ID.String(),
+			Username:       restored.Username,
+			Role:           restored.Role.String(),
+			Created:        restored.Created.Format(time.RFC3339),
+			Modified:       restored.Modified.Format(time.RFC3339),
+			LastLogoutTime: restored.LastLogout.Format(time.RFC3339),
+			LastLoginTime:  restored.LastLogin.Format(time.RFC3339),
+			Email:          restored.Email,
+			TenantID:       restored.TenantID,
+			Attributes:     restored.Attributes,
+			Version:        restored.Version,
+		}
+
+		return em.OK(resp, "user '%s' restored user '%s'", user.Username, restored.Username).
+			WithHeader("ETag", jelly.VersionETag(restored.Version))
+	}, api.useJWT(), jelly.Override{Response: "jellyauth.User"})
+}
+
+// httpBatchUsers returns a HandlerFunc that runs a batch of create, update,
+// and delete operations on users, so that many users can be provisioned
+// without a request for each. Only the admin user may run batches.
+//
+// The operations are run in the order given, with each run of consecutive
+// operations of the same kind processed together. Each operation succeeds or
+// fails on its own; the response is an HTTP-200 with the result of every
+// operation as long as the batch itself was valid. See userBatchRequest and
+// userBatchResponse for the format of the request and response.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the logged-in user of the client making the request.
+func (api loginAPI) httpBatchUsers(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := em.GetLoggedInUser(req)
+
+		if user.Role != jelly.Admin {
+			return em.Forbidden("user '%s' (role %s) batch operation on users: forbidden", user.Username, user.Role)
+		}
+
+		var batchReq userBatchRequest
+		err := jelly.ParseJSONRequest(req, &batchReq)
+		if err != nil {
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+		ops := batchReq.Operations
+		if len(ops) == 0 {
+			return em.BadRequest("operations: property is empty or missing from request", "empty operations")
+		}
+		if len(ops) > maxBatchOperations {
+			msg := fmt.Sprintf("operations: a batch may have at most %d operations", maxBatchOperations)
+			return em.BadRequest(msg, "%d operations given", len(ops))
+		}
+
+		ctx := req.Context()
+		results := make([]userBatchResult, len(ops))
+
+		// run each run of consecutive operations of the same kind together
+		for start := 0; start < len(ops); {
+			end := start + 1
+			for end < len(ops) && ops[end].Op == ops[start].Op {
+				end++
+			}
+
+			run := ops[start:end]
+			switch ops[start].Op {
+			case "create":
+				api.batchCreateUsers(ctx, run, results[start:end])
+			case "update":
+				api.batchUpdateUsers(ctx, run, results[start:end])
+			case "delete":
+				api.batchDeleteUsers(ctx, run, results[start:end])
+			default:
+				for i := range run {
+					results[start+i] = userBatchResult{
+						Status: http.StatusBadRequest,
+						Error:  fmt.Sprintf("op: must be one of \"create\", \"update\", or \"delete\" but got %q", run[i].Op),
+					}
+				}
+			}
+
+			start = end
+		}
+
+		var failed int
+		for i := range results {
+			if results[i].Status >= 400 {
+				failed++
+			}
+		}
+
+		resp := userBatchResponse{Results: results}
+		return em.OK(resp, "user '%s' ran batch of %d user operations (%d failed)", user.Username, len(ops), failed)
+	}, api.useJWT(), jelly.Override{Request: "jellyauth.UserBatchRequest", Response: "jellyauth.UserBatchResponse"})
+}
+
+// batchCreateUsers runs the create operations in ops and puts the result of
+// each in results.
+func (api loginAPI) batchCreateUsers(ctx context.Context, ops []userBatchOperation, results []userBatchResult) {
+	var users []jelly.AuthUser
+	var indexes []int
+	for i, op := range ops {
+		fail := func(msg string) {
+			results[i] = userBatchResult{Status: http.StatusBadRequest, Error: msg}
+		}
+
+		u, msg := api.newUser(ctx, op.User.Username, op.User.Email, op.User.Role, op.User.TenantID, op.User.Attributes)
+		if msg != "" {
+			fail("user." + msg)
+			continue
+		}
+		if op.User.Password == "" {
+			fail("user.password: property is empty or missing from request")
+			continue
+		}
+		u.Password = op.User.Password
+
+		users = append(users, u)
+		indexes = append(indexes, i)
+	}
+	if len(users) == 0 {
+		return
+	}
+
+	created, err := api.Service.CreateUsers(ctx, users)
+	itemErrs, err := batchItemErrors(err, len(users))
+	for j, i := range indexes {
+		if err != nil {
+			results[i] = api.batchErrorResult(err)
+		} else if itemErrs[j] != nil {
+			results[i] = api.batchErrorResult(itemErrs[j])
+		} else {
+			model := api.userModel(created[j])
+			results[i] = userBatchResult{Status: http.StatusCreated, User: &model}
+		}
+	}
+}
+
+// newUser checks the properties of a user that is to be created by a request
+// and returns the user with them. If any are invalid, a message saying why,
+// suitable for giving to the client, is returned instead.
+func (api loginAPI) newUser(ctx context.Context, username, email, role, tenantID string, attrs map[string]interface{}) (jelly.AuthUser, string) {
+	if username == "" {
+		return jelly.AuthUser{}, "username: property is empty or missing from request"
+	}
+
+	parsedRole := jelly.Unverified
+	if role != "" {
+		var err error
+		parsedRole, err = jelly.ParseRole(role)
+		if err != nil {
+			return jelly.AuthUser{}, "role: " + err.Error()
+		}
+	}
+
+	attrs, err := api.Attributes.Normalize(attrs)
+	if err != nil {
+		return jelly.AuthUser{}, err.Error()
+	}
+
+	if ctxTenant, ok := jelly.TenantFromContext(ctx); ok && tenantID != "" && tenantID != ctxTenant {
+		return jelly.AuthUser{}, "tenant_id: must be same as the tenant of the request"
+	}
+
+	return jelly.AuthUser{
+		Username:   username,
+		Email:      email,
+		Role:       parsedRole,
+		TenantID:   tenantID,
+		Attributes: attrs,
+	}, ""
+}
+
+// batchUpdateUsers runs the update operations in ops and puts the result of
+// each in results.
+func (api loginAPI) batchUpdateUsers(ctx context.Context, ops []userBatchOperation, results []userBatchResult) {
+	var changes []userChanges
+	var indexes []int
+	for i, op := range ops {
+		fail := func(msg string) {
+			results[i] = userBatchResult{Status: http.StatusBadRequest, Error: msg}
+		}
+
+		id, err := uuid.Parse(op.ID)
+		if err != nil {
+			fail("id: not a valid user ID")
+			continue
+		}
+
+		upd := op.Update
+		ch := userChanges{ID: id, Version: op.Version}
+		if upd.ID.Update {
+			fail("update.id: the ID of a user cannot be changed in a batch")
+			continue
+		}
+		if upd.Username.Update {
+			ch.Username = &upd.Username.Value
+		}
+		if upd.Email.Update {
+			ch.Email = &upd.Email.Value
+		}
+		if upd.Password.Update {
+			ch.Password = &upd.Password.Value
+		}
+		if upd.Role.Update {
+			role, err := jelly.ParseRole(upd.Role.Value)
+			if err != nil {
+				fail("update.role: " + err.Error())
+				continue
+			}
+			ch.Role = &role
+		}
+		if upd.Attributes.Update {
+			// attributes given as null are removed; the rest must match the
+			// schema
+			given := map[string]interface{}{}
+			for name, v := range upd.Attributes.Value {
+				if v == nil {
+					ch.RemoveAttributes = append(ch.RemoveAttributes, name)
+				} else {
+					given[name] = v
+				}
+			}
+			ch.SetAttributes, err = api.Attributes.Normalize(given)
+			if err != nil {
+				fail("update." + err.Error())
+				continue
+			}
+		}
+
+		changes = append(changes, ch)
+		indexes = append(indexes, i)
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	updated, err := api.Service.UpdateUsers(ctx, changes)
+	itemErrs, err := batchItemErrors(err, len(changes))
+	for j, i := range indexes {
+		if err != nil {
+			results[i] = api.batchErrorResult(err)
+		} else if itemErrs[j] != nil {
+			results[i] = api.batchErrorResult(itemErrs[j])
+			if errors.Is(itemErrs[j], jelly.ErrConflict) && ops[i].Version != 0 {
+				results[i].Status = http.StatusPreconditionFailed
+			}
+		} else {
+			model := api.userModel(updated[j])
+			results[i] = userBatchResult{Status: http.StatusOK, User: &model}
+		}
+	}
+}
+
+// batchDeleteUsers runs the delete operations in ops and puts the result of
+// each in results.
+func (api loginAPI) batchDeleteUsers(ctx context.Context, ops []userBatchOperation, results []userBatchResult) {
+	var ids []uuid.UUID
+	var indexes []int
+	for i, op := range ops {
+		id, err := uuid.Parse(op.ID)
+		if err != nil {
+			results[i] = userBatchResult{Status: http.StatusBadRequest, Error: "id: not a valid user ID"}
+			continue
+		}
+		ids = append(ids, id)
+		indexes = append(indexes, i)
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	_, err := api.Service.DeleteUsers(ctx, ids)
+	itemErrs, err := batchItemErrors(err, len(ids))
+	for j, i := range indexes {
+		if err != nil {
+			results[i] = api.batchErrorResult(err)
+		} else if itemErrs[j] != nil {
+			results[i] = api.batchErrorResult(itemErrs[j])
+		} else {
+			results[i] = userBatchResult{Status: http.StatusNoContent}
+		}
+	}
+}
+
+// httpExportUsers returns a HandlerFunc that gives every user, as JSON or as
+// CSV, so that they can be moved to another system. Password hashes are only
+// included if the include_hashes query parameter is set.
+func (api loginAPI) httpExportUsers(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := em.GetLoggedInUser(req)
+
+		if user.Role != jelly.Admin {
+			return em.Forbidden("user '%s' (role %s) export users: forbidden", user.Username, user.Role)
+		}
+
+		var query struct {
+			Format        string `query:"format"`
+			IncludeHashes bool   `query:"include_hashes"`
+		}
+		if err := jelly.BindQuery(req, &query); err != nil {
+			return em.BadRequest(jelly.UserMessage(err), "query: %s", err.Error())
+		}
+		if query.Format != "" && query.Format != "json" && query.Format != "csv" {
+			return em.BadRequest("format: must be one of \"json\" or \"csv\"", "bad format %q", query.Format)
+		}
+
+		users, err := api.Service.GetAllUsers(req.Context())
+		if err != nil {
+			return em.InternalServerError(err.Error())
+		}
+
+		records := make([]userRecord, len(users))
+		for i := range users {
+			records[i] = userRecordOf(users[i], query.IncludeHashes)
+		}
+
+		var hashesMsg string
+		if query.IncludeHashes {
+			hashesMsg = " with password hashes"
+		}
+
+		if query.Format == "csv" {
+			data, err := encodeUserCSV(records, query.IncludeHashes)
+			if err != nil {
+				return em.InternalServerError("encode CSV: %s", err.Error())
+			}
+			r := jelly.Result{
+				Status:      http.StatusOK,
+				Resp:        string(data),
+				InternalMsg: fmt.Sprintf("user '%s' exported %d users as CSV%s", user.Username, len(records), hashesMsg),
+			}
+			return r.
+				WithHeader("Content-Type", "text/csv; charset=utf-8").
+				WithHeader("Content-Disposition", `attachment; filename="users.csv"`)
+		}
+
+		resp := userExportResponse{Users: records}
+		return em.OK(resp, "user '%s' exported %d users%s", user.Username, len(records), hashesMsg)
+	}, api.useJWT(), jelly.Override{Response: "jellyauth.UserExport"})
+}
+
+// httpImportUsers returns a HandlerFunc that creates many users at once from
+// a JSON or CSV body, such as one given by httpExportUsers. Each user is
+// created independently of the others, and the response has the result of
+// each one in the same order that they were given.
+func (api loginAPI) httpImportUsers(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := em.GetLoggedInUser(req)
+
+		if user.Role != jelly.Admin {
+			return em.Forbidden("user '%s' (role %s) import users: forbidden", user.Username, user.Role)
+		}
+
+		var records []userRecord
+		var results []userBatchResult
+
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if mediaType == "text/csv" {
+			var err error
+			records, results, err = decodeUserCSV(req.Body)
+			if err != nil {
+				return em.BadRequest(err.Error(), "decode CSV: %s", err.Error())
+			}
+		} else {
+			var importReq userImportRequest
+			err := jelly.ParseJSONRequest(req, &importReq)
+			if err != nil {
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
+			}
+			records = importReq.Users
+			results = make([]userBatchResult, len(records))
+		}
+
+		if len(records) == 0 {
+			return em.BadRequest("users: no users given in request", "empty import")
+		}
+		if len(records) > maxBatchOperations {
+			msg := fmt.Sprintf("users: an import may have at most %d users", maxBatchOperations)
+			return em.BadRequest(msg, "%d users given", len(records))
+		}
+
+		ctx := req.Context()
+
+		var users []importedUser
+		var indexes []int
+		for i, rec := range records {
+			if results[i].Status != 0 {
+				// already failed while decoding
+				continue
+			}
+			fail := func(msg string) {
+				results[i] = userBatchResult{Status: http.StatusBadRequest, Error: msg}
+			}
+
+			u, msg := api.newUser(ctx, rec.Username, rec.Email, rec.Role, rec.TenantID, rec.Attributes)
+			if msg != "" {
+				fail(msg)
+				continue
+			}
+			if rec.Password == "" && rec.PasswordHash == "" {
+				fail("password: one of password or password_hash must be given")
+				continue
+			}
+			if rec.Password != "" && rec.PasswordHash != "" {
+				fail("password: only one of password or password_hash may be given")
+				continue
+			}
+			u.Password = rec.Password
+
+			users = append(users, importedUser{AuthUser: u, PasswordHash: rec.PasswordHash})
+			indexes = append(indexes, i)
+		}
+
+		if len(users) > 0 {
+			created, err := api.Service.ImportUsers(ctx, users)
+			itemErrs, err := batchItemErrors(err, len(users))
+			for j, i := range indexes {
+				if err != nil {
+					results[i] = api.batchErrorResult(err)
+				} else if itemErrs[j] != nil {
+					results[i] = api.batchErrorResult(itemErrs[j])
+				} else {
+					model := api.userModel(created[j])
+					results[i] = userBatchResult{Status: http.StatusCreated, User: &model}
+				}
+			}
+		}
+
+		var failed int
+		for i := range results {
+			if results[i].Status >= 400 {
+				failed++
+			}
+		}
+
+		resp := userBatchResponse{Results: results}
+		return em.OK(resp, "user '%s' imported %d users (%d failed)", user.Username, len(records), failed)
+	}, api.useJWT(), jelly.Override{Request: "jellyauth.UserImportRequest", Response: "jellyauth.UserBatchResponse"})
+}
+
+// batchErrorResult gives the result of a batch operation that failed with err.
+// The status is the one that a request for the operation on its own would
+// have gotten. Unexpected errors are logged, as they are not given in the
+// result.
+func (api loginAPI) batchErrorResult(err error) userBatchResult {
+	switch {
+	case errors.Is(err, jelly.ErrBadArgument):
+		return userBatchResult{Status: http.StatusBadRequest, Error: err.Error()}
+	case errors.Is(err, jelly.ErrNotFound):
+		return userBatchResult{Status: http.StatusNotFound, Error: "The requested resource was not found"}
+	case errors.Is(err, jelly.ErrAlreadyExists), errors.Is(err, jelly.ErrConflict):
+		return userBatchResult{Status: http.StatusConflict, Error: err.Error()}
+	default:
+		api.log.Errorf("batch operation on user: %v", err)
+		return userBatchResult{Status: http.StatusInternalServerError, Error: "An internal server error occurred"}
+	}
+}
+
+// userModel gives the model of u that is returned in responses.
+func (api loginAPI) userModel(u jelly.AuthUser) userModel {
+	var archived string
+	if !u.Archived.IsZero() {
+		archived = u.Archived.Format(time.RFC3339)
+	}
+
+	return userModel{
+		URI:            api.urls.URLFor("users", u.ID),
+		ID:             u.ID.String(),
+		Username:       u.Username,
+		Role:           u.Role.String(),
+		Created:        u.Created.Format(time.RFC3339),
+		Modified:       u.Modified.Format(time.RFC3339),
+		LastLogoutTime: u.LastLogout.Format(time.RFC3339),
+		LastLoginTime:  u.LastLogin.Format(time.RFC3339),
+		Email:          u.Email,
+		TenantID:       u.TenantID,
+		Archived:       archived,
+		Attributes:     u.Attributes,
+		Version:        u.Version,
+	}
+}
+
+// httpCreateServiceToken returns a HandlerFunc that exchanges the ID and
+// secret of a service account for a short-lived token limited to the
+// requested scopes.
+func (api loginAPI) httpCreateServiceToken(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		var exchange serviceTokenRequest
+		err := jelly.ParseJSONRequest(req, &exchange)
+		if err != nil {
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+
+		if exchange.ID == "" {
+			return em.BadRequest("id: property is empty or missing from request", "empty id")
+		}
+		if exchange.Secret == "" {
+			return em.BadRequest("secret: property is empty or missing from request", "empty secret")
+		}
+
+		sa, scopes, err := api.Service.ExchangeServiceAccountSecret(req.Context(), exchange.ID, exchange.Secret, exchange.Scopes)
+		if err != nil {
+			if errors.Is(err, jelly.ErrBadCredentials) {
+				return em.Unauthorized(jelly.ErrBadCredentials.Error(), "service account %s: %s", exchange.ID, err.Error())
+			} else if errors.Is(err, jelly.ErrPermissions) {
+				return em.Forbidden("service account %s: %s", exchange.ID, err.Error())
+			} else if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError(err.Error())
+		}
+
+		tok, err := generateServiceAccountToken(api.keys, sa, scopes, api.ServiceTokenLifetime)
+		if err != nil {
+			return em.InternalServerError("could not generate JWT: " + err.Error())
+		}
+
+		resp := serviceTokenResponse{
+			Token:     tok,
+			AccountID: sa.ID.String(),
+			Scopes:    scopes,
+			ExpiresIn: int(api.ServiceTokenLifetime.Seconds()),
+		}
+		return em.Created(resp, "service account '%s' successfully created new token with scopes %q", sa.Name, scopes)
+	}, api.useJWT(), jelly.Override{Request: "jellyauth.ServiceTokenRequest", Response: "jellyauth.ServiceToken"})
+}
+
+func (api loginAPI) serviceAccountModel(sa jelly.ServiceAccount) serviceAccountModel {
+	return serviceAccountModel{
+		URI:          api.urls.URLFor("service-accounts", sa.ID),
+		ID:           sa.ID.String(),
+		Name:         sa.Name,
+		Description:  sa.Description,
+		Scopes:       sa.Scopes,
+		Created:      sa.Created.Format(time.RFC3339),
+		Modified:     sa.Modified.Format(time.RFC3339),
+		LastUsedTime: sa.LastUsed.Format(time.RFC3339),
+	}
+}
+
+// httpGetAllServiceAccounts returns a HandlerFunc that retrieves all existing
+// service accounts. Only an admin user can call this endpoint.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the logged-in user of the client making the request.
+func (api loginAPI) httpGetAllServiceAccounts(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := em.GetLoggedInUser(req)
+
+		if user.Role != jelly.Admin {
+			return em.Forbidden("user '%s' (role %s) get all service accounts: forbidden", user.Username, user.Role)
+		}
+
+		accounts, err := api.Service.GetAllServiceAccounts(req.Context())
+		if err != nil {
+			return em.InternalServerError(err.Error())
+		}
+
+		resp := make([]serviceAccountModel, len(accounts))
+		for i := range accounts {
+			resp[i] = api.serviceAccountModel(accounts[i])
+		}
+
+		return em.OK(resp, "user '%s' got all service accounts", user.Username)
+	}, api.useJWT(), jelly.Override{Response: "[]jellyauth.ServiceAccount"})
+}
+
+// httpCreateServiceAccount returns a HandlerFunc that creates a new service
+// account. The response contains the secret of the new service account; it
+// cannot be retrieved again later. Only an admin user can create service
+// accounts.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the logged-in user of the client making the request.
+func (api loginAPI) httpCreateServiceAccount(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := em.GetLoggedInUser(req)
+
+		if user.Role != jelly.Admin {
+			return em.Forbidden("user '%s' (role %s) creation of new service account: forbidden", user.Username, user.Role)
+		}
+
+		var createSA serviceAccountModel
+		err := jelly.ParseJSONRequest(req, &createSA)
+		if err != nil {
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+		if createSA.Name == "" {
+			return em.BadRequest("name: property is empty or missing from request", "empty name")
+		}
+
+		newSA, secret, err := api.Service.CreateServiceAccount(req.Context(), createSA.Name, createSA.Description, createSA.Scopes)
+		if err != nil {
+			if errors.Is(err, jelly.ErrAlreadyExists) {
+				return em.Conflict("Service account with that name already exists", "service account '%s' already exists", createSA.Name)
+			} else if errors.Is(err, jelly.ErrBadArgument) {
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
+			} else if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError(err.Error())
+		}
+
+		resp := api.serviceAccountModel(newSA)
+		resp.Secret = secret
+
+		return em.Created(resp, "service account '%s' (%s) created", resp.Name, resp.ID)
+	}, api.useJWT(), jelly.Override{Request: "jellyauth.ServiceAccount", Response: "jellyauth.ServiceAccount"})
+}
+
+// httpGetServiceAccount returns a HandlerFunc that gets an existing service
+// account. Only an admin user can call this endpoint.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the ID of the service account being operated on and the logged-in user of
+// the client making the request.
+func (api loginAPI) httpGetServiceAccount(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := em.GetLoggedInUser(req)
+
+		if user.Role != jelly.Admin {
+			return em.Forbidden("user '%s' (role %s) get service account %s: forbidden", user.Username, user.Role, id)
+		}
+
+		sa, err := api.Service.GetServiceAccount(req.Context(), id.String())
+		if err != nil {
+			if errors.Is(err, jelly.ErrBadArgument) {
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
+			} else if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not get service account: " + err.Error())
+		}
+
+		return em.OK(api.serviceAccountModel(sa), "user '%s' successfully got service account '%s'", user.Username, sa.Name)
+	}, api.useJWT(), jelly.Override{Response: "jellyauth.ServiceAccount"})
+}
+
+// httpRotateServiceAccountSecret returns a HandlerFunc that replaces the
+// secret of a service account with a new one and returns it. All tokens
+// previously issued to the service account become invalid. Only an admin user
+// can call this endpoint.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the ID of the service account being operated on and the logged-in user of
+// the client making the request.
+func (api loginAPI) httpRotateServiceAccountSecret(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := em.GetLoggedInUser(req)
+
+		if user.Role != jelly.Admin {
+			return em.Forbidden("user '%s' (role %s) rotate secret of service account %s: forbidden", user.Username, user.Role, id)
+		}
+
+		sa, secret, err := api.Service.RotateServiceAccountSecret(req.Context(), id.String())
+		if err != nil {
+			if errors.Is(err, jelly.ErrBadArgument) {
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
+			} else if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not rotate service account secret: " + err.Error())
+		}
+
+		resp := api.serviceAccountModel(sa)
+		resp.Secret = secret
+
+		return em.Created(resp, "user '%s' rotated secret of service account '%s'", user.Username, sa.Name)
+	}, api.useJWT(), jelly.Override{Response: "jellyauth.ServiceAccount"})
+}
+
+// httpDeleteServiceAccount returns a HandlerFunc that deletes a service
+// account. Only an admin user can call this endpoint.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the ID of the service account being deleted and the logged-in user of the
+// client making the request.
+func (api loginAPI) httpDeleteServiceAccount(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := em.GetLoggedInUser(req)
+
+		if user.Role != jelly.Admin {
+			return em.Forbidden("user '%s' (role %s) delete service account %s: forbidden", user.Username, user.Role, id)
+		}
+
+		deleted, err := api.Service.DeleteServiceAccount(req.Context(), id.String())
+		if err != nil && !errors.Is(err, jelly.ErrNotFound) {
+			if errors.Is(err, jelly.ErrBadArgument) {
+				return em.BadRequest(jelly.UserMessage(err), err.Error())
+			}
+			return em.InternalServerError("could not delete service account: " + err.Error())
+		}
+
+		deletedStr := "service account " + id.String() + " (no-op)"
+		if deleted.Name != "" {
+			deletedStr = "service account '" + deleted.Name + "'"
+		}
+
+		return em.NoContent("user '%s' successfully deleted %s", user.Username, deletedStr)
+	}, api.useJWT())
+}
+
+// clientIP returns the IP address of the client that made req.
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// recordLoginAttempt records an attempt to log in as username made by req.
+// Failure to record it is logged but does not otherwise affect the login.
+func (api loginAPI) recordLoginAttempt(req *http.Request, username string, success bool) {
+	_, err := api.Service.RecordLoginAttempt(req.Context(), username, clientIP(req), req.UserAgent(), success)
+	if err != nil && !errors.Is(err, jelly.ErrNotFound) {
+		api.log.Warnf("could not record login attempt for %q: %s", username, err.Error())
+	}
+}
+
+func (api loginAPI) sessionModel(sess jelly.Session, current jelly.AuthUser) sessionModel {
+	return sessionModel{
+		URI:       api.urls.URLFor("users", sess.UserID, "sessions", sess.ID),
+		ID:        sess.ID.String(),
+		UserID:    sess.UserID.String(),
+		IP:        sess.IP,
+		UserAgent: sess.UserAgent,
+		Created:   sess.Created.Format(time.RFC3339),
+		Expires:   sess.Expires.Format(time.RFC3339),
+		Current:   sess.ID == current.SessionID,
+	}
+}
+
+func loginAttemptModels(attempts []jelly.LoginAttempt) []loginAttemptModel {
+	resp := make([]loginAttemptModel, len(attempts))
+	for i := range attempts {
+		resp[i] = loginAttemptModel{
+			ID:        attempts[i].ID.String(),
+			Username:  attempts[i].Username,
+			IP:        attempts[i].IP,
+			UserAgent: attempts[i].UserAgent,
+			Success:   attempts[i].Success,
+			Time:      attempts[i].Time.Format(time.RFC3339),
+		}
+		if attempts[i].UserID != uuid.Nil {
+			resp[i].UserID = attempts[i].UserID.String()
+		}
+	}
+	return resp
+}
+
+// httpGetSessions returns a HandlerFunc that lists the active sessions of a
+// user. All users may list their own sessions, but only an admin user can list
+// the sessions of other users.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the ID of the user whose sessions are being listed and the logged-in user of
+// the client making the request.
+func (api loginAPI) httpGetSessions(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := em.GetLoggedInUser(req)
+
+		if id != user.ID && user.Role != jelly.Admin {
+			var otherUserStr string
+			otherUser, err := api.Service.GetUser(req.Context(), id.String())
+			// if there was another user, find out now
+			if err != nil {
+				otherUserStr = id.String()
+			} else {
+				otherUserStr = "'" + otherUser.Username + "'"
+			}
+
+			return em.Forbidden("user '%s' (role %s) get sessions of user %s: forbidden", user.Username, user.Role, otherUserStr)
+		}
+
+		// make sure the user exists and is visible to the client
+		if _, err := api.Service.GetUser(req.Context(), id.String()); err != nil {
+			if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not get user: " + err.Error())
+		}
+
+		sessions, err := api.Service.GetSessions(req.Context(), id)
+		if err != nil {
+			if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not get sessions: " + err.Error())
+		}
+
+		resp := make([]sessionModel, len(sessions))
+		for i := range sessions {
+			resp[i] = api.sessionModel(sessions[i], user)
+		}
+
+		return em.OK(resp, "user '%s' got sessions of user %s", user.Username, id)
+	}, api.useJWT(), jelly.Override{Response: "[]jellyauth.Session"})
+}
+
+// httpDeleteSession returns a HandlerFunc that revokes a session of a user,
+// invalidating all tokens issued for it. All users may revoke their own
+// sessions, but only an admin user can revoke the sessions of other users.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the ID of the user whose session is being revoked, the ID of the session,
+// and the logged-in user of the client making the request.
+func (api loginAPI) httpDeleteSession(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := em.GetLoggedInUser(req)
+
+		sessionID, err := jelly.GetURLParam(req, "session", uuid.Parse)
+		if err != nil {
+			return em.BadRequest("session: not a valid ID", "session: %s", err.Error())
+		}
+
+		if id != user.ID && user.Role != jelly.Admin {
+			var otherUserStr string
+			otherUser, err := api.Service.GetUser(req.Context(), id.String())
+			// if there was another user, find out now
+			if err != nil {
+				otherUserStr = id.String()
+			} else {
+				otherUserStr = "'" + otherUser.Username + "'"
+			}
+
+			return em.Forbidden("user '%s' (role %s) revoke session of user %s: forbidden", user.Username, user.Role, otherUserStr)
+		}
+
+		// make sure the user exists and is visible to the client
+		if _, err := api.Service.GetUser(req.Context(), id.String()); err != nil {
+			if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not get user: " + err.Error())
+		}
+
+		_, err = api.Service.RevokeSession(req.Context(), id, sessionID)
+		if err != nil {
+			if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not revoke session: " + err.Error())
+		}
+
+		return em.NoContent("user '%s' revoked session %s of user %s", user.Username, sessionID, id)
+	}, api.useJWT())
+}
+
+// httpGetLoginAttempts returns a HandlerFunc that lists the recent attempts to
+// log in as a user. All users may list their own login attempts, but only an
+// admin user can list those of other users.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the ID of the user whose login attempts are being listed and the logged-in
+// user of the client making the request.
+func (api loginAPI) httpGetLoginAttempts(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := em.GetLoggedInUser(req)
+
+		if id != user.ID && user.Role != jelly.Admin {
+			var otherUserStr string
+			otherUser, err := api.Service.GetUser(req.Context(), id.String())
+			// if there was another user, find out now
+			if err != nil {
+				otherUserStr = id.String()
+			} else {
+				otherUserStr = "'" + otherUser.Username + "'"
+			}
+
+			return em.Forbidden("user '%s' (role %s) get login attempts of user %s: forbidden", user.Username, user.Role, otherUserStr)
+		}
+
+		// make sure the user exists and is visible to the client
+		if _, err := api.Service.GetUser(req.Context(), id.String()); err != nil {
+			if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not get user: " + err.Error())
+		}
+
+		attempts, err := api.Service.GetLoginAttempts(req.Context(), id)
+		if err != nil {
+			if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not get login attempts: " + err.Error())
+		}
+
+		return em.OK(loginAttemptModels(attempts), "user '%s' got login attempts of user %s", user.Username, id)
+	}, api.useJWT(), jelly.Override{Response: "[]jellyauth.LoginAttempt"})
+}
+
+// httpGetAllLoginAttempts returns a HandlerFunc that lists all recent attempts
+// to log in, including those with usernames that do not exist. Only an admin
+// user can call this endpoint.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the logged-in user of the client making the request.
+func (api loginAPI) httpGetAllLoginAttempts(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := em.GetLoggedInUser(req)
+
+		if user.Role != jelly.Admin {
+			return em.Forbidden("user '%s' (role %s) get all login attempts: forbidden", user.Username, user.Role)
+		}
+
+		attempts, err := api.Service.GetAllLoginAttempts(req.Context())
+		if err != nil {
+			if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not get login attempts: " + err.Error())
+		}
+
+		return em.OK(loginAttemptModels(attempts), "user '%s' got all login attempts", user.Username)
+	}, api.useJWT(), jelly.Override{Response: "[]jellyauth.LoginAttempt"})
+}
+
+func (api loginAPI) twoFactorEnrollModel(user jelly.AuthUser, tf jelly.TwoFactor) twoFactorEnrollModel {
+	return twoFactorEnrollModel{
+		Secret: tf.Secret,
+		URI:    totpURI(api.TOTPIssuer, user.Username, tf.Secret),
+	}
+}
+
+// httpGetTwoFactor returns a HandlerFunc that gets the status of a user's
+// two-factor authentication. All users may get their own, but only an admin
+// user can get that of other users.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the ID of the user and the logged-in user of the client making the request.
+func (api loginAPI) httpGetTwoFactor(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := em.GetLoggedInUser(req)
+
+		if id != user.ID && user.Role != jelly.Admin {
+			var otherUserStr string
+			otherUser, err := api.Service.GetUser(req.Context(), id.String())
+			// if there was another user, find out now
+			if err != nil {
+				otherUserStr = id.String()
+			} else {
+				otherUserStr = "'" + otherUser.Username + "'"
+			}
+
+			return em.Forbidden("user '%s' (role %s) get two-factor of user %s: forbidden", user.Username, user.Role, otherUserStr)
+		}
+
+		// make sure the user exists and is visible to the client
+		if _, err := api.Service.GetUser(req.Context(), id.String()); err != nil {
+			if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not get user: " + err.Error())
+		}
+		if _, err := api.Service.twoFactors(); err != nil {
+			return em.NotFound()
+		}
+
+		var resp twoFactorModel
+		tf, err := api.Service.GetTwoFactor(req.Context(), id)
+		if err == nil {
+			resp.Enabled = tf.Confirmed
+			resp.Pending = !tf.Confirmed
+			resp.RecoveryCodesRemaining = len(tf.RecoveryCodes)
+		} else if !errors.Is(err, jelly.ErrNotFound) {
+			return em.InternalServerError("could not get two-factor: " + err.Error())
+		}
+
+		return em.OK(resp, "user '%s' got two-factor of user %s", user.Username, id)
+	}, api.useJWT(), jelly.Override{Response: "jellyauth.TwoFactor"})
+}
+
+// httpCreateTwoFactor returns a HandlerFunc that begins setting up two-factor
+// authentication for a user, returning the TOTP secret and provisioning URI
+// that they should add to their authenticator app. It is not enforced until
+// confirmed with httpConfirmTwoFactor. Users may only set up their own.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the ID of the user and the logged-in user of the client making the request.
+func (api loginAPI) httpCreateTwoFactor(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := em.GetLoggedInUser(req)
+
+		if id != user.ID {
+			return em.Forbidden("user '%s' (role %s) set up two-factor of user %s: forbidden", user.Username, user.Role, id)
+		}
+
+		tf, err := api.Service.BeginTwoFactor(req.Context(), id)
+		if err != nil {
+			if errors.Is(err, jelly.ErrAlreadyExists) {
+				return em.Conflict(jelly.UserMessage(err), err.Error())
+			} else if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError(err.Error())
+		}
+
+		return em.Created(api.twoFactorEnrollModel(user, tf), "user '%s' began two-factor enrollment", user.Username)
+	}, api.useJWT(), jelly.Override{Response: "jellyauth.TwoFactorEnrollment"})
+}
+
+// httpConfirmTwoFactor returns a HandlerFunc that confirms the two-factor
+// authentication a user has begun setting up with a TOTP code, after which it
+// is enforced at login. The response contains the user's recovery codes. Users
+// may only confirm their own.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the ID of the user and the logged-in user of the client making the request.
+func (api loginAPI) httpConfirmTwoFactor(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := em.GetLoggedInUser(req)
+
+		if id != user.ID {
+			return em.Forbidden("user '%s' (role %s) confirm two-factor of user %s: forbidden", user.Username, user.Role, id)
+		}
+
+		var body twoFactorLoginRequest
+		err := jelly.ParseJSONRequest(req, &body)
+		if err != nil {
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+		if body.Code == "" {
+			return em.BadRequest("code: property is empty or missing from request", "empty code")
+		}
+
+		_, codes, err := api.Service.ConfirmTwoFactor(req.Context(), id, body.Code)
+		if err != nil {
+			if errors.Is(err, jelly.ErrBadCredentials) {
+				return em.BadRequest("code: the supplied two-factor code is incorrect", err.Error())
+			} else if errors.Is(err, jelly.ErrAlreadyExists) {
+				return em.Conflict(jelly.UserMessage(err), err.Error())
+			} else if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError(err.Error())
+		}
+
+		return em.OK(recoveryCodesModel{RecoveryCodes: codes}, "user '%s' confirmed two-factor", user.Username)
+	}, api.useJWT(), jelly.Override{Request: "jellyauth.TwoFactorLoginRequest", Response: "jellyauth.RecoveryCodes"})
+}
+
+// httpCreateRecoveryCodes returns a HandlerFunc that replaces a user's
+// two-factor recovery codes with a new set. Users may only replace their own.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the ID of the user and the logged-in user of the client making the request.
+func (api loginAPI) httpCreateRecoveryCodes(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := em.GetLoggedInUser(req)
+
+		if id != user.ID {
+			return em.Forbidden("user '%s' (role %s) regenerate recovery codes of user %s: forbidden", user.Username, user.Role, id)
+		}
+
+		_, codes, err := api.Service.RegenerateRecoveryCodes(req.Context(), id)
+		if err != nil {
+			if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError(err.Error())
+		}
+
+		return em.Created(recoveryCodesModel{RecoveryCodes: codes}, "user '%s' regenerated recovery codes", user.Username)
+	}, api.useJWT(), jelly.Override{Response: "jellyauth.RecoveryCodes"})
+}
+
+// httpDeleteTwoFactor returns a HandlerFunc that removes a user's two-factor
+// authentication. All users may remove their own, but only an admin user can
+// remove that of other users, such as when they have lost their device and
+// their recovery codes.
+//
+// The handler has requirements for the request context it receives, and if the
+// requirements are not met it may return an HTTP-500. The context must contain
+// the ID of the user and the logged-in user of the client making the request.
+func (api loginAPI) httpDeleteTwoFactor(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := em.GetLoggedInUser(req)
+
+		if id != user.ID && user.Role != jelly.Admin {
+			var otherUserStr string
+			otherUser, err := api.Service.GetUser(req.Context(), id.String())
+			// if there was another user, find out now
+			if err != nil {
+				otherUserStr = id.String()
+			} else {
+				otherUserStr = "'" + otherUser.Username + "'"
+			}
+
+			return em.Forbidden("user '%s' (role %s) remove two-factor of user %s: forbidden", user.Username, user.Role, otherUserStr)
+		}
+
+		// make sure the user exists and is visible to the client
+		if _, err := api.Service.GetUser(req.Context(), id.String()); err != nil {
+			if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not get user: " + err.Error())
+		}
+
+		_, err := api.Service.DisableTwoFactor(req.Context(), id)
+		if err != nil {
+			if errors.Is(err, jelly.ErrNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError(err.Error())
+		}
+
+		return em.NoContent("user '%s' removed two-factor of user %s", user.Username, id)
+	}, api.useJWT())
 }
@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_httpRegister(t *testing.T) {
+	type registration struct {
+		body         string
+		expectStatus int
+		expectRole   string
+	}
+
+	testCases := []struct {
+		name          string
+		config        string
+		registrations []registration
+	}{
+		{
+			name:   "disabled by default",
+			config: "",
+			registrations: []registration{
+				{body: `{"username":"doc","password":"1.21gigawatts"}`, expectStatus: http.StatusNotFound},
+			},
+		},
+		{
+			name:   "registered as unverified",
+			config: "register: true",
+			registrations: []registration{
+				{body: `{"username":"doc","password":"1.21gigawatts","email":"doc@example.com"}`, expectStatus: http.StatusCreated, expectRole: "unverified"},
+			},
+		},
+		{
+			name:   "configured role",
+			config: "register: true\n  register_role: normal",
+			registrations: []registration{
+				{body: `{"username":"doc","password":"1.21gigawatts"}`, expectStatus: http.StatusCreated, expectRole: "normal"},
+			},
+		},
+		{
+			name:   "bad requests",
+			config: "register: true",
+			registrations: []registration{
+				{body: `{"username":"doc"}`, expectStatus: http.StatusBadRequest},
+				{body: `{"password":"1.21gigawatts"}`, expectStatus: http.StatusBadRequest},
+				{body: `{"username":"doc","password":"1.21gigawatts","email":"not an email"}`, expectStatus: http.StatusBadRequest},
+				{body: `{"username":"marty","password":"1.21gigawatts"}`, expectStatus: http.StatusConflict},
+			},
+		},
+		{
+			name:   "limited per client",
+			config: "register: true\n  register_limit: 2",
+			registrations: []registration{
+				{body: `{"username":"doc","password":"1.21gigawatts"}`, expectStatus: http.StatusCreated, expectRole: "unverified"},
+				{body: `{"username":"marty","password":"1.21gigawatts"}`, expectStatus: http.StatusConflict},
+				{body: `{"username":"biff","password":"1.21gigawatts"}`, expectStatus: http.StatusCreated, expectRole: "unverified"},
+				{body: `{"username":"jennifer","password":"1.21gigawatts"}`, expectStatus: http.StatusTooManyRequests},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			confFile := filepath.Join(t.TempDir(), "jelly.yml")
+			require.NoError(t, os.WriteFile(confFile, []byte(fmt.Sprintf(`
+listen: localhost:8080
+jellyauth:
+  enabled: true
+  base: /auth
+  secret: "register-test-secret-that-is-long-enough"
+  set_admin: marty:hunter2
+  unauth_delay: -1
+  password_cost: 4
+  %s
+`, tc.config)), 0600))
+
+			env := &server.Environment{}
+			env.UseComponent(ComponentInfo{})
+			cfg, err := env.LoadConfig(confFile)
+			require.NoError(t, err)
+			srv, err := env.NewServer(&cfg)
+			require.NoError(t, err)
+			h := srv.Handler()
+
+			for i, reg := range tc.registrations {
+				w := serve(h, http.MethodPost, "/auth/register", "", "application/json", reg.body)
+				if !assert.Equal(reg.expectStatus, w.Code, "registration #%d: %s", i+1, w.Body.String()) {
+					continue
+				}
+				if reg.expectStatus != http.StatusCreated {
+					continue
+				}
+
+				var user userModel
+				assert.NoError(json.Unmarshal(w.Body.Bytes(), &user), "registration #%d", i+1)
+				assert.Equal(reg.expectRole, user.Role, "registration #%d", i+1)
+
+				// the new user can log in
+				var req registerRequest
+				require.NoError(t, json.Unmarshal([]byte(reg.body), &req))
+				w = serve(h, http.MethodPost, "/auth/login", "", "application/json", fmt.Sprintf(`{"username":%q,"password":%q}`, req.Username, req.Password))
+				assert.Equal(http.StatusCreated, w.Code, "registration #%d: login: %s", i+1, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_loginAPI_dryRun(t *testing.T) {
+	testCases := []struct {
+		name      string
+		setAdmin  string
+		connect   bool
+		expectErr string
+	}{
+		{
+			name:     "DB not connected",
+			setAdmin: "marty:hunter2",
+		},
+		{
+			name:     "DB connected",
+			setAdmin: "marty:hunter2",
+			connect:  true,
+		},
+		{
+			name:      "set_admin is still checked",
+			setAdmin:  "marty",
+			expectErr: "set_admin",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			confFile := filepath.Join(t.TempDir(), "jelly.yml")
+			require.NoError(t, os.WriteFile(confFile, []byte(fmt.Sprintf(`
+listen: localhost:8080
+jellyauth:
+  enabled: true
+  base: /auth
+  secret: "dry-run-test-secret-that-is-long-enough"
+  set_admin: %s
+  soft_delete: true
+`, tc.setAdmin)), 0600))
+
+			env := &server.Environment{}
+			env.UseComponent(ComponentInfo{})
+			cfg, err := env.LoadConfig(confFile)
+			require.NoError(t, err)
+
+			srv, err := env.NewDryRunServer(&cfg, jelly.DryRunOptions{ConnectDBs: tc.connect})
+			if tc.expectErr != "" {
+				assert.ErrorContains(err, tc.expectErr)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+
+			plan, err := srv.Plan()
+			assert.NoError(err)
+			paths := map[string]bool{}
+			for _, r := range plan.Routes {
+				paths[r.Method+" "+r.Path] = true
+			}
+			assert.True(paths["POST /auth/login/"], "login route is not in plan")
+		})
+	}
+}
+
+func Test_loginAPI_reenabled(t *testing.T) {
+	assert := assert.New(t)
+
+	confFile := filepath.Join(t.TempDir(), "jelly.yml")
+	require.NoError(t, os.WriteFile(confFile, []byte(`
+listen: localhost:8080
+jellyauth:
+  enabled: true
+  base: /auth
+  secret: "reenable-test-secret-that-is-long-enough"
+  set_admin: marty:hunter2
+  unauth_delay: -1
+  password_cost: 4
+  register: true
+  register_role: normal
+  token_cache: 60000
+`), 0600))
+
+	env := &server.Environment{}
+	env.UseComponent(ComponentInfo{})
+	cfg, err := env.LoadConfig(confFile)
+	require.NoError(t, err)
+	srv, err := env.NewServer(&cfg)
+	require.NoError(t, err)
+	h := srv.Handler()
+
+	// set_admin resets the admin's password when the API is initialized again,
+	// which logs them out, so another user is used
+	w := serve(h, http.MethodPost, "/auth/register", "", "application/json", `{"username":"doc","password":"1.21gigawatts"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = serve(h, http.MethodPost, "/auth/login", "", "application/json", `{"username":"doc","password":"1.21gigawatts"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var login loginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+
+	w = serve(h, http.MethodGet, "/auth/users/"+login.UserID, login.Token, "", "")
+	assert.Equal(http.StatusOK, w.Code, "before disable: %s", w.Body.String())
+
+	require.NoError(t, srv.DisableAPI(context.Background(), "jellyauth"))
+	require.NoError(t, srv.EnableAPI("jellyauth"))
+
+	w = serve(h, http.MethodGet, "/auth/users/"+login.UserID, login.Token, "", "")
+	assert.Equal(http.StatusOK, w.Code, "before logout: %s", w.Body.String())
+
+	w = serve(h, http.MethodDelete, "/auth/login/"+login.UserID, login.Token, "", "")
+	assert.Equal(http.StatusNoContent, w.Code, "logout: %s", w.Body.String())
+
+	w = serve(h, http.MethodGet, "/auth/users/"+login.UserID, login.Token, "", "")
+	assert.Equal(http.StatusUnauthorized, w.Code, "after logout: %s", w.Body.String())
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// AttributeType is the type of value that a user attribute holds.
+type AttributeType string
+
+const (
+	AttrString AttributeType = "string"
+	AttrInt    AttributeType = "int"
+	AttrFloat  AttributeType = "float"
+	AttrBool   AttributeType = "bool"
+)
+
+func (at AttributeType) String() string {
+	return string(at)
+}
+
+// ParseAttributeType parses a string into an AttributeType. Matching is not
+// case-sensitive.
+func ParseAttributeType(s string) (AttributeType, error) {
+	switch AttributeType(strings.ToLower(s)) {
+	case AttrString:
+		return AttrString, nil
+	case AttrInt:
+		return AttrInt, nil
+	case AttrFloat:
+		return AttrFloat, nil
+	case AttrBool:
+		return AttrBool, nil
+	default:
+		return "", fmt.Errorf("must be one of %q, %q, %q, or %q", AttrString, AttrInt, AttrFloat, AttrBool)
+	}
+}
+
+// AttributeSchema gives the names and types of the attributes that users may
+// have. It maps each attribute name to its type.
+type AttributeSchema map[string]AttributeType
+
+// ParseAttributeSchema parses a list of attribute definitions into an
+// AttributeSchema. Each definition must be in NAME:TYPE format, where TYPE is
+// one of the AttributeTypes.
+func ParseAttributeSchema(defs []string) (AttributeSchema, error) {
+	schema := AttributeSchema{}
+	for _, d := range defs {
+		parts := strings.SplitN(d, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q: not in NAME:TYPE format", d)
+		}
+		name := strings.TrimSpace(parts[0])
+		if name == "" {
+			return nil, fmt.Errorf("%q: name cannot be blank", d)
+		}
+		if strings.ContainsAny(name, " \t\r\n") {
+			return nil, fmt.Errorf("%q: name cannot contain whitespace", d)
+		}
+		if _, ok := schema[name]; ok {
+			return nil, fmt.Errorf("%q: attribute %q is defined more than once", d, name)
+		}
+		at, err := ParseAttributeType(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%q: type %w", d, err)
+		}
+		schema[name] = at
+	}
+	return schema, nil
+}
+
+// Strings returns the definitions of the attributes in the schema in NAME:TYPE
+// format, sorted by name. It is the inverse of ParseAttributeSchema.
+func (s AttributeSchema) Strings() []string {
+	defs := make([]string, 0, len(s))
+	for name, at := range s {
+		defs = append(defs, name+":"+at.String())
+	}
+	sort.Strings(defs)
+	return defs
+}
+
+// Normalize checks that every attribute in attrs is defined in the schema and
+// has a value of the correct type, and returns a copy of attrs with all values
+// converted to their canonical Go type: string, int64, float64, or bool.
+// Numbers decoded from JSON are accepted for int attributes as long as they
+// have no fractional part.
+func (s AttributeSchema) Normalize(attrs map[string]interface{}) (map[string]interface{}, error) {
+	if len(attrs) == 0 {
+		return nil, nil
+	}
+
+	norm := make(map[string]interface{}, len(attrs))
+	for name, v := range attrs {
+		at, ok := s[name]
+		if !ok {
+			return nil, fmt.Errorf("attributes: %q is not a defined attribute", name)
+		}
+
+		nv, ok := convertAttribute(at, v)
+		if !ok {
+			return nil, fmt.Errorf("attributes: %q must be of type %s", name, at)
+		}
+		norm[name] = nv
+	}
+
+	return norm, nil
+}
+
+func convertAttribute(at AttributeType, v interface{}) (interface{}, bool) {
+	switch at {
+	case AttrString:
+		s, ok := v.(string)
+		return s, ok
+	case AttrBool:
+		b, ok := v.(bool)
+		return b, ok
+	case AttrInt:
+		switch n := v.(type) {
+		case int:
+			return int64(n), true
+		case int64:
+			return n, true
+		case float64:
+			if n != math.Trunc(n) || math.IsInf(n, 0) || n > math.MaxInt64 || n < math.MinInt64 {
+				return nil, false
+			}
+			return int64(n), true
+		}
+	case AttrFloat:
+		switch n := v.(type) {
+		case float64:
+			return n, true
+		case int:
+			return float64(n), true
+		case int64:
+			return float64(n), true
+		}
+	}
+	return nil, false
+}
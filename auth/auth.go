@@ -7,6 +7,11 @@
 // system simply by being enabled, albeit with an unpersisted, in-memory
 // database.
 //
+// More than one jellyauth can be run at once, such as to keep separate realms
+// of users, by adding other sections with "component: jellyauth". Each one
+// registers its JWT authenticator under its own section name, as
+// "SECTION.jwt", and authenticates against its own users.
+//
 // TODO: carry over config instructions from the example.
 package auth
 
@@ -18,20 +23,67 @@ const (
 	Version = "0.0.1"
 )
 
-type ComponentInfo struct{}
+// ComponentInfo is the jelly.Component of jellyauth. Its zero value is ready to
+// use; set its fields to customize jellyauth, and pass it to jelly.Use in
+// place of Component.
+type ComponentInfo struct {
+	// Challenger creates and checks the challenges that clients must pass to
+	// log in after too many failed attempts; see the challenge_after config
+	// key. If nil, NoChallenge is used and no challenge is ever required.
+	Challenger Challenger
+}
 
 func (ci ComponentInfo) Name() string {
 	return "jellyauth"
 }
 
+func (ci ComponentInfo) Version() string {
+	return Version
+}
+
 func (ci ComponentInfo) API() jelly.API {
-	return &loginAPI{}
+	return &loginAPI{Challenger: ci.Challenger}
 }
 
 func (ci ComponentInfo) Config() jelly.APIConfig {
 	return &Config{}
 }
 
+// FixtureDecoders returns the decoders of the kinds of entities that jellyauth
+// loads from fixtures files. Only "users" is supported.
+func (ci ComponentInfo) FixtureDecoders() map[string]jelly.FixtureDecoder {
+	return map[string]jelly.FixtureDecoder{
+		"users": decodeUserFixture,
+	}
+}
+
+// Schemas returns the models that jellyauth gives in request and response
+// bodies, keyed by the names of their schemas.
+func (ci ComponentInfo) Schemas() map[string]interface{} {
+	return map[string]interface{}{
+		"jellyauth.GuestToken":            guestTokenResponse{},
+		"jellyauth.Info":                  infoModel{},
+		"jellyauth.Login":                 loginResponse{},
+		"jellyauth.LoginAttempt":          loginAttemptModel{},
+		"jellyauth.LoginRequest":          loginRequest{},
+		"jellyauth.RecoveryCodes":         recoveryCodesModel{},
+		"jellyauth.RegisterRequest":       registerRequest{},
+		"jellyauth.ServiceAccount":        serviceAccountModel{},
+		"jellyauth.ServiceToken":          serviceTokenResponse{},
+		"jellyauth.ServiceTokenRequest":   serviceTokenRequest{},
+		"jellyauth.Session":               sessionModel{},
+		"jellyauth.TwoFactor":             twoFactorModel{},
+		"jellyauth.TwoFactorEnrollment":   twoFactorEnrollModel{},
+		"jellyauth.TwoFactorLoginRequest": twoFactorLoginRequest{},
+		"jellyauth.User":                  userModel{},
+		"jellyauth.UserBatchRequest":      userBatchRequest{},
+		"jellyauth.UserBatchResponse":     userBatchResponse{},
+		"jellyauth.UserExport":            userExportResponse{},
+		"jellyauth.UserImportRequest":     userImportRequest{},
+		"jellyauth.UserUpdate":            userUpdateRequest{},
+	}
+}
+
 var (
 	// Component holds the component information for jellyauth. This is passed
 	// to jelly.Use to enable the use of jellyauth in a server.
@@ -39,13 +91,32 @@ var (
 )
 
 type loginResponse struct {
-	Token  string `json:"token"`
-	UserID string `json:"user_id"`
+	Token         string   `json:"token,omitempty"`
+	UserID        string   `json:"user_id"`
+	PendingToken  string   `json:"pending_token,omitempty"`
+	TwoFactor     string   `json:"two_factor,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
 }
 
 type loginRequest struct {
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	GuestToken        string `json:"guest_token,omitempty"`
+	ChallengeID       string `json:"challenge_id,omitempty"`
+	ChallengeResponse string `json:"challenge_response,omitempty"`
+}
+
+type registerRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Email    string `json:"email,omitempty"`
+}
+
+// challengeRequiredResponse is the response to a login attempt that must
+// first pass a challenge.
+type challengeRequiredResponse struct {
+	jelly.ErrorResponse
+	Challenge Challenge `json:"challenge"`
 }
 
 type userModel struct {
@@ -59,6 +130,11 @@ type userModel struct {
 	Modified       string `json:"modified,omitempty"`
 	LastLogoutTime string `json:"last_logout,omitempty"`
 	LastLoginTime  string `json:"last_login,omitempty"`
+	TenantID       string `json:"tenant_id,omitempty"`
+	Archived       string `json:"archived,omitempty"`
+	Version        int64  `json:"version,omitempty"`
+
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
 }
 
 type userUpdateRequest struct {
@@ -82,6 +158,148 @@ type userUpdateRequest struct {
 		Update bool   `json:"u,omitempty"`
 		Value  string `json:"v,omitempty"`
 	} `json:"role,omitempty"`
+	Attributes struct {
+		Update bool                   `json:"u,omitempty"`
+		Value  map[string]interface{} `json:"v,omitempty"`
+	} `json:"attributes,omitempty"`
+}
+
+// userBatchRequest is the envelope of a request to run a batch of operations
+// on users. Each operation has an Op of "create", "update", or "delete".
+// Creates give the new user in User, in the same format as a request to create
+// a single user. Updates give the ID of the user and the changes in Update, in
+// the same format as a request to update a single user, and may give the
+// Version that the user must be at. Deletes give only the ID of the user.
+type userBatchRequest struct {
+	Operations []userBatchOperation `json:"operations"`
+}
+
+type userBatchOperation struct {
+	Op      string            `json:"op"`
+	ID      string            `json:"id,omitempty"`
+	Version int64             `json:"version,omitempty"`
+	User    userModel         `json:"user,omitempty"`
+	Update  userUpdateRequest `json:"update,omitempty"`
+}
+
+// userBatchResponse is the envelope of the response to a userBatchRequest. It
+// has one result for each operation, in the same order. Each result has the
+// HTTP status code that the operation would have had if it had been made on
+// its own, along with the affected user if it succeeded or the reason that it
+// failed if it did not.
+type userBatchResponse struct {
+	Results []userBatchResult `json:"results"`
+}
+
+type userBatchResult struct {
+	Status int        `json:"status"`
+	User   *userModel `json:"user,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// userRecord is a user as it is exported from and imported into jellyauth,
+// either as JSON or as a row of CSV. PasswordHash is only given in an export
+// if hashes were asked for. On import, only Username, Email, Role, TenantID,
+// Attributes, and either Password or PasswordHash are used; the rest are
+// ignored so that an export can be imported as-is.
+type userRecord struct {
+	ID             string `json:"id,omitempty"`
+	Username       string `json:"username"`
+	Email          string `json:"email,omitempty"`
+	Role           string `json:"role,omitempty"`
+	TenantID       string `json:"tenant_id,omitempty"`
+	Created        string `json:"created,omitempty"`
+	Modified       string `json:"modified,omitempty"`
+	LastLoginTime  string `json:"last_login,omitempty"`
+	LastLogoutTime string `json:"last_logout,omitempty"`
+	Password       string `json:"password,omitempty"`
+	PasswordHash   string `json:"password_hash,omitempty"`
+
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type userExportResponse struct {
+	Users []userRecord `json:"users"`
+}
+
+// userImportRequest is the body of a JSON import of users. The response to it
+// is a userBatchResponse with one result for each user, in the same order.
+type userImportRequest struct {
+	Users []userRecord `json:"users"`
+}
+
+type serviceTokenRequest struct {
+	ID     string   `json:"id"`
+	Secret string   `json:"secret"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+type serviceTokenResponse struct {
+	Token     string   `json:"token"`
+	AccountID string   `json:"account_id"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
+type guestTokenResponse struct {
+	Token     string `json:"token"`
+	GuestID   string `json:"guest_id"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+type serviceAccountModel struct {
+	URI          string   `json:"uri"`
+	ID           string   `json:"id,omitempty"`
+	Name         string   `json:"name,omitempty"`
+	Description  string   `json:"description"`
+	Secret       string   `json:"secret,omitempty"`
+	Scopes       []string `json:"scopes"`
+	Created      string   `json:"created,omitempty"`
+	Modified     string   `json:"modified,omitempty"`
+	LastUsedTime string   `json:"last_used,omitempty"`
+}
+
+type sessionModel struct {
+	URI       string `json:"uri"`
+	ID        string `json:"id"`
+	UserID    string `json:"user_id"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Created   string `json:"created"`
+	Expires   string `json:"expires"`
+	Current   bool   `json:"current"`
+}
+
+type loginAttemptModel struct {
+	ID        string `json:"id"`
+	UserID    string `json:"user_id,omitempty"`
+	Username  string `json:"username"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Success   bool   `json:"success"`
+	Time      string `json:"time"`
+}
+
+type twoFactorLoginRequest struct {
+	PendingToken string `json:"pending_token,omitempty"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+	GuestToken   string `json:"guest_token,omitempty"`
+}
+
+type twoFactorModel struct {
+	Enabled                bool `json:"enabled"`
+	Pending                bool `json:"pending"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+type twoFactorEnrollModel struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type recoveryCodesModel struct {
+	RecoveryCodes []string `json:"recovery_codes"`
 }
 
 type infoModel struct {
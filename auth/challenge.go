@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+)
+
+// Challenge is an out-of-band check, such as a CAPTCHA or a code sent by
+// email, that a client must pass in order to log in after too many failed
+// attempts. It is given to the client in the response to a login attempt; the
+// client then retries the login with the ID of the challenge and its response
+// to it.
+type Challenge struct {
+	// ID identifies the challenge. The client gives it back along with its
+	// response. An empty ID means that no challenge is required.
+	ID string `json:"id"`
+
+	// Type is the kind of challenge, such as "captcha" or "email", so that
+	// clients know how to present it.
+	Type string `json:"type"`
+
+	// Data is any further information that the client needs to present the
+	// challenge, such as the site key of a CAPTCHA provider.
+	Data map[string]string `json:"data,omitempty"`
+}
+
+// Challenger creates and checks the challenges that clients must pass to log
+// in to a user after too many failed attempts, so that CAPTCHAs or email codes
+// can be used to slow down password guessing without changing jellyauth. Set
+// one with the Challenger field of ComponentInfo.
+type Challenger interface {
+	// Challenge creates a new challenge for a client at the given IP address
+	// that is trying to log in as username. If it returns a Challenge with an
+	// empty ID, the login is allowed to proceed without one.
+	Challenge(ctx context.Context, username, ip string) (Challenge, error)
+
+	// Verify returns whether response is a correct response to the challenge
+	// with the given ID for a login as username from the given IP address.
+	// An error is returned only if the response could not be checked.
+	Verify(ctx context.Context, username, ip, challengeID, response string) (bool, error)
+}
+
+// NoChallenge is a Challenger that never requires a challenge. It is used if
+// no other Challenger is set.
+type NoChallenge struct{}
+
+func (NoChallenge) Challenge(ctx context.Context, username, ip string) (Challenge, error) {
+	return Challenge{}, nil
+}
+
+func (NoChallenge) Verify(ctx context.Context, username, ip, challengeID, response string) (bool, error) {
+	return true, nil
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dekarrin/jelly/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captchaChallenger is a Challenger whose challenges are passed by responding
+// with "solved".
+type captchaChallenger struct{}
+
+func (captchaChallenger) Challenge(ctx context.Context, username, ip string) (Challenge, error) {
+	return Challenge{ID: "c-" + username, Type: "captcha", Data: map[string]string{"site_key": "test"}}, nil
+}
+
+func (captchaChallenger) Verify(ctx context.Context, username, ip, challengeID, response string) (bool, error) {
+	return challengeID == "c-"+username && response == "solved", nil
+}
+
+func Test_httpCreateLogin_challenge(t *testing.T) {
+	type attempt struct {
+		password        string
+		challengeID     string
+		response        string
+		expectStatus    int
+		expectChallenge bool
+	}
+
+	testCases := []struct {
+		name       string
+		challenger Challenger
+		attempts   []attempt
+	}{
+		{
+			name:       "challenge required after failures",
+			challenger: captchaChallenger{},
+			attempts: []attempt{
+				{password: "wrong", expectStatus: http.StatusUnauthorized},
+				{password: "wrong", expectStatus: http.StatusUnauthorized},
+				{password: "hunter2", expectStatus: http.StatusUnauthorized, expectChallenge: true},
+				{password: "hunter2", challengeID: "c-marty", response: "wrong", expectStatus: http.StatusUnauthorized, expectChallenge: true},
+				{password: "hunter2", challengeID: "c-marty", response: "solved", expectStatus: http.StatusCreated},
+				{password: "hunter2", expectStatus: http.StatusCreated},
+			},
+		},
+		{
+			name:       "passing challenge does not bypass password",
+			challenger: captchaChallenger{},
+			attempts: []attempt{
+				{password: "wrong", expectStatus: http.StatusUnauthorized},
+				{password: "wrong", expectStatus: http.StatusUnauthorized},
+				{password: "wrong", challengeID: "c-marty", response: "solved", expectStatus: http.StatusUnauthorized},
+				{password: "hunter2", expectStatus: http.StatusUnauthorized, expectChallenge: true},
+			},
+		},
+		{
+			name:       "no challenger",
+			challenger: nil,
+			attempts: []attempt{
+				{password: "wrong", expectStatus: http.StatusUnauthorized},
+				{password: "wrong", expectStatus: http.StatusUnauthorized},
+				{password: "hunter2", expectStatus: http.StatusCreated},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			confFile := filepath.Join(t.TempDir(), "jelly.yml")
+			require.NoError(t, os.WriteFile(confFile, []byte(`
+listen: localhost:8080
+jellyauth:
+  enabled: true
+  base: /auth
+  secret: "challenge-test-secret-that-is-long-enough"
+  set_admin: marty:hunter2
+  unauth_delay: -1
+  password_cost: 4
+  challenge_after: 2
+`), 0600))
+
+			env := &server.Environment{}
+			env.UseComponent(ComponentInfo{Challenger: tc.challenger})
+			cfg, err := env.LoadConfig(confFile)
+			require.NoError(t, err)
+			srv, err := env.NewServer(&cfg)
+			require.NoError(t, err)
+			h := srv.Handler()
+
+			for i, a := range tc.attempts {
+				body, _ := json.Marshal(loginRequest{Username: "marty", Password: a.password, ChallengeID: a.challengeID, ChallengeResponse: a.response})
+				req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(string(body)))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+
+				assert.Equal(a.expectStatus, w.Code, "attempt #%d: %s", i+1, w.Body.String())
+
+				var resp challengeRequiredResponse
+				_ = json.Unmarshal(w.Body.Bytes(), &resp)
+				if a.expectChallenge {
+					assert.Equal(Challenge{ID: "c-marty", Type: "captcha", Data: map[string]string{"site_key": "test"}}, resp.Challenge, "attempt #%d", i+1)
+				} else {
+					assert.Empty(resp.Challenge.ID, "attempt #%d", i+1)
+				}
+			}
+		})
+	}
+}
@@ -6,14 +6,54 @@ import (
 	"strings"
 
 	"github.com/dekarrin/jelly"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
 	ConfigKeySecret      = "secret"
 	ConfigKeySetAdmin    = "set_admin"
 	ConfigKeyUnauthDelay = "unauth_delay"
+
+	ConfigKeySignAlg      = "sign_alg"
+	ConfigKeySignKey      = "sign_key"
+	ConfigKeyPrevSignKeys = "prev_sign_keys"
+	ConfigKeyPrevKeyGrace = "prev_key_grace"
+
+	ConfigKeyServiceTokenLifetime = "service_token_lifetime"
+
+	ConfigKeyUserAttributes = "user_attributes"
+
+	ConfigKeyLoginHistory = "login_history"
+
+	ConfigKeyRequireAdmin2FA = "require_admin_2fa"
+	ConfigKeyTOTPIssuer      = "totp_issuer"
+
+	ConfigKeyGuestTokens        = "guest_tokens"
+	ConfigKeyGuestTokenLifetime = "guest_token_lifetime"
+
+	ConfigKeySoftDelete       = "soft_delete"
+	ConfigKeyArchiveRetention = "archive_retention"
+
+	ConfigKeyChallengeAfter  = "challenge_after"
+	ConfigKeyChallengeWindow = "challenge_window"
+
+	ConfigKeyPasswordHash   = "password_hash"
+	ConfigKeyPasswordCost   = "password_cost"
+	ConfigKeyPasswordMemory = "password_memory"
+
+	ConfigKeyRegister      = "register"
+	ConfigKeyRegisterRole  = "register_role"
+	ConfigKeyRegisterLimit = "register_limit"
+
+	ConfigKeyTokenCache = "token_cache"
 )
 
+func init() {
+	// the signing keys and the admin credentials are not caught by the terms
+	// that are always sensitive.
+	jelly.RegisterSensitive(ConfigKeySignKey, ConfigKeyPrevSignKeys, ConfigKeySetAdmin)
+}
+
 const (
 	MaxSecretSize = 64
 	MinSecretSize = 32
@@ -39,6 +79,132 @@ type Config struct {
 	// non-parallel connections. If not set it will default to 1 second
 	// (1000ms). Set this to any negative number to disable the delay.
 	UnauthDelayMillis int
+
+	// SignAlg is the algorithm used to sign tokens. If not set, it defaults to
+	// SignHS512, which signs with Secret.
+	SignAlg SigningAlg
+
+	// SignKey is a reference to the PEM-encoded private key that new tokens
+	// are signed with. It is required when SignAlg is asymmetric and ignored
+	// otherwise. It can be "env:NAME" to read the key from an environment
+	// variable, or a path to a file optionally prefixed with "file:".
+	SignKey string
+
+	// PrevSignKeys are references to keys that were previously used to sign
+	// tokens, in the same format as SignKey. Each may be either a private or a
+	// public key. Tokens signed with them are still accepted until
+	// PrevKeyGraceMins has elapsed since startup, which allows the signing key
+	// to be rotated without immediately logging out all users.
+	PrevSignKeys []string
+
+	// PrevKeyGraceMins is the number of minutes after startup that tokens
+	// signed with a key in PrevSignKeys are still accepted. If not set it will
+	// default to 60 minutes, which is the lifetime of issued tokens.
+	PrevKeyGraceMins int
+
+	// ServiceTokenLifetimeMins is the number of minutes that a token issued to
+	// a service account in exchange for its secret is valid for. If not set it
+	// will default to 15 minutes.
+	ServiceTokenLifetimeMins int
+
+	// UserAttributes is the schema of the additional attributes that users may
+	// have, such as display names or preferences. Attributes not in the schema
+	// are rejected by the user endpoints. In config, it is given as a list of
+	// attribute definitions in NAME:TYPE format; see ParseAttributeSchema. If
+	// not set, users cannot have any attributes.
+	UserAttributes AttributeSchema
+
+	// LoginHistoryDays is the number of days that records of login attempts
+	// are kept for. If not set it will default to 30 days.
+	LoginHistoryDays int
+
+	// RequireAdmin2FA is whether users with the admin role must use two-factor
+	// authentication. Admins who have not set it up must do so as part of
+	// logging in.
+	RequireAdmin2FA bool
+
+	// TOTPIssuer is the name of the service shown in authenticator apps for
+	// accounts that are set up for two-factor authentication. If not set it
+	// will default to "jelly".
+	TOTPIssuer string
+
+	// GuestTokens is whether unauthenticated clients may request guest tokens.
+	// A guest token identifies an anonymous client with the Guest role so that
+	// APIs can keep per-client state for it before it signs up. Guests are
+	// not stored in the DB.
+	GuestTokens bool
+
+	// GuestTokenLifetimeMins is the number of minutes that a guest token is
+	// valid for. If not set it will default to 1440 minutes (1 day).
+	GuestTokenLifetimeMins int
+
+	// SoftDelete is whether deleting a user archives it instead of removing
+	// it from the DB. Archived users cannot log in and are hidden from the
+	// user endpoints, but can be restored by an admin until they are purged
+	// once ArchiveRetentionDays has passed. The auth DB must support archiving
+	// users; the built-in authuser stores all do.
+	SoftDelete bool
+
+	// ArchiveRetentionDays is the number of days that archived users are kept
+	// for before they are permanently deleted. It has no effect if SoftDelete
+	// is not set. If not set it will default to 30 days.
+	ArchiveRetentionDays int
+
+	// ChallengeAfter is the number of failed logins to a user within
+	// ChallengeWindowMins after which clients must pass a challenge to log in
+	// to that user. Challenges are made by the Challenger set in
+	// ComponentInfo; if none is set, no challenge is required. If not set it
+	// will default to 5. Set this to any negative number to never require a
+	// challenge.
+	ChallengeAfter int
+
+	// ChallengeWindowMins is the number of minutes that a failed login counts
+	// towards ChallengeAfter. If not set it will default to 15 minutes.
+	ChallengeWindowMins int
+
+	// PasswordHash is the algorithm used to hash passwords and service account
+	// secrets. Existing hashes made with another algorithm, or with a
+	// different PasswordCost or PasswordMemory, are still accepted and are
+	// replaced with a new hash the next time the user logs in. If not set, it
+	// defaults to HashBcrypt.
+	PasswordHash HashAlg
+
+	// PasswordCost is the cost of hashing. For HashBcrypt, it is the bcrypt
+	// cost and will default to DefaultBcryptCost if not set; for
+	// HashArgon2id, it is the number of passes and will default to
+	// DefaultArgon2idTime if not set.
+	PasswordCost int
+
+	// PasswordMemory is the amount of memory (in KiB) that hashing uses when
+	// PasswordHash is HashArgon2id. It will default to DefaultArgon2idMemory
+	// if not set. It is not used by HashBcrypt.
+	PasswordMemory int
+
+	// Register is whether clients may create their own users without being
+	// logged in, by POSTing to the register endpoint. If not set, only admins
+	// can create users.
+	Register bool
+
+	// RegisterRole is the role given to users who register themselves. It
+	// must be jelly.Unverified or jelly.Normal. If not set it will default to
+	// jelly.Unverified, so that the program can promote users once it has
+	// verified them, such as by sending a link to their email address when it
+	// receives the EventUserRegistered event.
+	RegisterRole jelly.Role
+
+	// RegisterLimit is the number of users that may be registered from a
+	// single IP address in an hour. If not set it will default to 5. Set this
+	// to any negative number for no limit.
+	RegisterLimit int
+
+	// TokenCacheMillis is how long (in milliseconds) the principal that a
+	// token was issued to is remembered for after the token is validated, so
+	// that a burst of requests with the same token does not verify it and look
+	// up its principal in the DB each time. Cached tokens are forgotten when
+	// their principal logs out or is changed, but a principal changed by
+	// another server sharing the DB is not seen until the TTL passes. If not
+	// set, tokens are not cached.
+	TokenCacheMillis int
 }
 
 // FillDefaults returns a new *Config identical to cfg but with unset values set
@@ -65,6 +231,53 @@ func (cfg *Config) FillDefaults() jelly.APIConfig {
 	if newCFG.UnauthDelayMillis == 0 {
 		newCFG.UnauthDelayMillis = 1000
 	}
+	if newCFG.SignAlg == "" {
+		newCFG.SignAlg = SignHS512
+	}
+	if newCFG.PrevKeyGraceMins == 0 {
+		newCFG.PrevKeyGraceMins = 60
+	}
+	if newCFG.ServiceTokenLifetimeMins == 0 {
+		newCFG.ServiceTokenLifetimeMins = 15
+	}
+	if newCFG.LoginHistoryDays == 0 {
+		newCFG.LoginHistoryDays = 30
+	}
+	if newCFG.TOTPIssuer == "" {
+		newCFG.TOTPIssuer = Issuer
+	}
+	if newCFG.GuestTokenLifetimeMins == 0 {
+		newCFG.GuestTokenLifetimeMins = 1440
+	}
+	if newCFG.ArchiveRetentionDays == 0 {
+		newCFG.ArchiveRetentionDays = 30
+	}
+	if newCFG.ChallengeAfter == 0 {
+		newCFG.ChallengeAfter = 5
+	}
+	if newCFG.ChallengeWindowMins == 0 {
+		newCFG.ChallengeWindowMins = 15
+	}
+	if newCFG.PasswordHash == "" {
+		newCFG.PasswordHash = HashBcrypt
+	}
+	if newCFG.PasswordCost == 0 {
+		switch newCFG.PasswordHash {
+		case HashBcrypt:
+			newCFG.PasswordCost = DefaultBcryptCost
+		case HashArgon2id:
+			newCFG.PasswordCost = DefaultArgon2idTime
+		}
+	}
+	if newCFG.PasswordMemory == 0 && newCFG.PasswordHash == HashArgon2id {
+		newCFG.PasswordMemory = DefaultArgon2idMemory
+	}
+	if newCFG.RegisterRole == jelly.Guest {
+		newCFG.RegisterRole = jelly.Unverified
+	}
+	if newCFG.RegisterLimit == 0 {
+		newCFG.RegisterLimit = 5
+	}
 
 	return newCFG
 }
@@ -81,11 +294,80 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("use of at least one database must be declared")
 	}
 
-	if len(cfg.Secret) < MinSecretSize {
-		return fmt.Errorf(ConfigKeySecret+": must be at least %d bytes, but is %d", MinSecretSize, len(cfg.Secret))
+	if _, err := ParseSigningAlg(cfg.SignAlg.String()); err != nil {
+		return fmt.Errorf(ConfigKeySignAlg+": %w", err)
+	}
+
+	if cfg.TokenCacheMillis < 0 {
+		return fmt.Errorf(ConfigKeyTokenCache + ": must not be negative")
+	}
+
+	if cfg.ServiceTokenLifetimeMins < 1 {
+		return fmt.Errorf(ConfigKeyServiceTokenLifetime + ": must be at least 1")
+	}
+
+	if cfg.LoginHistoryDays < 1 {
+		return fmt.Errorf(ConfigKeyLoginHistory + ": must be at least 1")
+	}
+
+	if cfg.TOTPIssuer == "" {
+		return fmt.Errorf(ConfigKeyTOTPIssuer + ": must not be empty")
+	}
+
+	if cfg.GuestTokenLifetimeMins < 1 {
+		return fmt.Errorf(ConfigKeyGuestTokenLifetime + ": must be at least 1")
+	}
+
+	if cfg.ArchiveRetentionDays < 1 {
+		return fmt.Errorf(ConfigKeyArchiveRetention + ": must be at least 1")
+	}
+
+	if cfg.ChallengeWindowMins < 1 {
+		return fmt.Errorf(ConfigKeyChallengeWindow + ": must be at least 1")
+	}
+
+	if cfg.RegisterRole != jelly.Unverified && cfg.RegisterRole != jelly.Normal {
+		return fmt.Errorf(ConfigKeyRegisterRole+": must be %q or %q", jelly.Unverified, jelly.Normal)
+	}
+
+	hashAlg, err := ParseHashAlg(cfg.PasswordHash.String())
+	if err != nil {
+		return fmt.Errorf(ConfigKeyPasswordHash+": %w", err)
+	}
+	switch hashAlg {
+	case HashBcrypt:
+		if cfg.PasswordCost < bcrypt.MinCost || cfg.PasswordCost > bcrypt.MaxCost {
+			return fmt.Errorf(ConfigKeyPasswordCost+": must be between %d and %d for bcrypt", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case HashArgon2id:
+		if cfg.PasswordCost < 1 {
+			return fmt.Errorf(ConfigKeyPasswordCost + ": must be at least 1")
+		}
+		if cfg.PasswordMemory < 8*argon2idThreads {
+			return fmt.Errorf(ConfigKeyPasswordMemory+": must be at least %d", 8*argon2idThreads)
+		}
+	}
+
+	for name, at := range cfg.UserAttributes {
+		if _, err := ParseAttributeType(at.String()); err != nil {
+			return fmt.Errorf(ConfigKeyUserAttributes+": %q: type %w", name, err)
+		}
 	}
-	if len(cfg.Secret) > MaxSecretSize {
-		return fmt.Errorf(ConfigKeySecret+": must be no more than %d bytes, but is %d", MaxSecretSize, len(cfg.Secret))
+
+	if cfg.SignAlg.Asymmetric() {
+		if cfg.SignKey == "" {
+			return fmt.Errorf(ConfigKeySignKey+": must be set when "+ConfigKeySignAlg+" is %s", cfg.SignAlg)
+		}
+		if cfg.PrevKeyGraceMins < 0 {
+			return fmt.Errorf(ConfigKeyPrevKeyGrace + ": must not be negative")
+		}
+	} else {
+		if len(cfg.Secret) < MinSecretSize {
+			return fmt.Errorf(ConfigKeySecret+": must be at least %d bytes, but is %d", MinSecretSize, len(cfg.Secret))
+		}
+		if len(cfg.Secret) > MaxSecretSize {
+			return fmt.Errorf(ConfigKeySecret+": must be no more than %d bytes, but is %d", MaxSecretSize, len(cfg.Secret))
+		}
 	}
 
 	if cfg.SetAdmin != "" {
@@ -119,7 +401,7 @@ func (cfg *Config) Common() jelly.CommonConfig {
 
 func (cfg *Config) Keys() []string {
 	keys := cfg.CommonConf.Keys()
-	keys = append(keys, ConfigKeySecret, ConfigKeySetAdmin, ConfigKeyUnauthDelay)
+	keys = append(keys, ConfigKeySecret, ConfigKeySetAdmin, ConfigKeyUnauthDelay, ConfigKeySignAlg, ConfigKeySignKey, ConfigKeyPrevSignKeys, ConfigKeyPrevKeyGrace, ConfigKeyServiceTokenLifetime, ConfigKeyUserAttributes, ConfigKeyLoginHistory, ConfigKeyRequireAdmin2FA, ConfigKeyTOTPIssuer, ConfigKeyGuestTokens, ConfigKeyGuestTokenLifetime, ConfigKeySoftDelete, ConfigKeyArchiveRetention, ConfigKeyChallengeAfter, ConfigKeyChallengeWindow, ConfigKeyPasswordHash, ConfigKeyPasswordCost, ConfigKeyPasswordMemory, ConfigKeyRegister, ConfigKeyRegisterRole, ConfigKeyRegisterLimit, ConfigKeyTokenCache)
 	return keys
 }
 
@@ -131,6 +413,50 @@ func (cfg *Config) Get(key string) interface{} {
 		return cfg.SetAdmin
 	case ConfigKeyUnauthDelay:
 		return cfg.UnauthDelayMillis
+	case ConfigKeySignAlg:
+		return cfg.SignAlg.String()
+	case ConfigKeySignKey:
+		return cfg.SignKey
+	case ConfigKeyPrevSignKeys:
+		return cfg.PrevSignKeys
+	case ConfigKeyPrevKeyGrace:
+		return cfg.PrevKeyGraceMins
+	case ConfigKeyServiceTokenLifetime:
+		return cfg.ServiceTokenLifetimeMins
+	case ConfigKeyUserAttributes:
+		return cfg.UserAttributes.Strings()
+	case ConfigKeyLoginHistory:
+		return cfg.LoginHistoryDays
+	case ConfigKeyRequireAdmin2FA:
+		return cfg.RequireAdmin2FA
+	case ConfigKeyTOTPIssuer:
+		return cfg.TOTPIssuer
+	case ConfigKeyGuestTokens:
+		return cfg.GuestTokens
+	case ConfigKeyGuestTokenLifetime:
+		return cfg.GuestTokenLifetimeMins
+	case ConfigKeySoftDelete:
+		return cfg.SoftDelete
+	case ConfigKeyArchiveRetention:
+		return cfg.ArchiveRetentionDays
+	case ConfigKeyChallengeAfter:
+		return cfg.ChallengeAfter
+	case ConfigKeyChallengeWindow:
+		return cfg.ChallengeWindowMins
+	case ConfigKeyPasswordHash:
+		return cfg.PasswordHash.String()
+	case ConfigKeyPasswordCost:
+		return cfg.PasswordCost
+	case ConfigKeyPasswordMemory:
+		return cfg.PasswordMemory
+	case ConfigKeyRegister:
+		return cfg.Register
+	case ConfigKeyRegisterRole:
+		return cfg.RegisterRole.String()
+	case ConfigKeyRegisterLimit:
+		return cfg.RegisterLimit
+	case ConfigKeyTokenCache:
+		return cfg.TokenCacheMillis
 	default:
 		return cfg.CommonConf.Get(key)
 	}
@@ -152,6 +478,188 @@ func (cfg *Config) Set(key string, value interface{}) error {
 		} else {
 			return fmt.Errorf("key '"+ConfigKeySetAdmin+"' requires a string but got a %T", value)
 		}
+	case ConfigKeySignAlg:
+		if valueStr, ok := value.(string); ok {
+			alg, err := ParseSigningAlg(valueStr)
+			if err != nil {
+				return fmt.Errorf("key '"+ConfigKeySignAlg+"': %w", err)
+			}
+			cfg.SignAlg = alg
+			return nil
+		} else if valueAlg, ok := value.(SigningAlg); ok {
+			cfg.SignAlg = valueAlg
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeySignAlg+"' requires a string but got a %T", value)
+		}
+	case ConfigKeySignKey:
+		if valueStr, ok := value.(string); ok {
+			cfg.SignKey = valueStr
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeySignKey+"' requires a string but got a %T", value)
+		}
+	case ConfigKeyPrevSignKeys:
+		valueSlice, err := jelly.TypedSlice[string](ConfigKeyPrevSignKeys, value)
+		if err == nil {
+			cfg.PrevSignKeys = valueSlice
+		}
+		return err
+	case ConfigKeyPrevKeyGrace:
+		if valueInt, ok := value.(int); ok {
+			cfg.PrevKeyGraceMins = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyPrevKeyGrace+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyServiceTokenLifetime:
+		if valueInt, ok := value.(int); ok {
+			cfg.ServiceTokenLifetimeMins = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyServiceTokenLifetime+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyLoginHistory:
+		if valueInt, ok := value.(int); ok {
+			cfg.LoginHistoryDays = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyLoginHistory+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyRequireAdmin2FA:
+		if valueBool, ok := value.(bool); ok {
+			cfg.RequireAdmin2FA = valueBool
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyRequireAdmin2FA+"' requires a bool but got a %T", value)
+		}
+	case ConfigKeyTOTPIssuer:
+		if valueStr, ok := value.(string); ok {
+			cfg.TOTPIssuer = valueStr
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyTOTPIssuer+"' requires a string but got a %T", value)
+		}
+	case ConfigKeyGuestTokens:
+		if valueBool, ok := value.(bool); ok {
+			cfg.GuestTokens = valueBool
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyGuestTokens+"' requires a bool but got a %T", value)
+		}
+	case ConfigKeyGuestTokenLifetime:
+		if valueInt, ok := value.(int); ok {
+			cfg.GuestTokenLifetimeMins = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyGuestTokenLifetime+"' requires an int but got a %T", value)
+		}
+	case ConfigKeySoftDelete:
+		if valueBool, ok := value.(bool); ok {
+			cfg.SoftDelete = valueBool
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeySoftDelete+"' requires a bool but got a %T", value)
+		}
+	case ConfigKeyArchiveRetention:
+		if valueInt, ok := value.(int); ok {
+			cfg.ArchiveRetentionDays = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyArchiveRetention+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyPasswordHash:
+		if valueStr, ok := value.(string); ok {
+			alg, err := ParseHashAlg(valueStr)
+			if err != nil {
+				return fmt.Errorf("key '"+ConfigKeyPasswordHash+"': %w", err)
+			}
+			cfg.PasswordHash = alg
+			return nil
+		} else if valueAlg, ok := value.(HashAlg); ok {
+			cfg.PasswordHash = valueAlg
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyPasswordHash+"' requires a string but got a %T", value)
+		}
+	case ConfigKeyChallengeAfter:
+		if valueInt, ok := value.(int); ok {
+			cfg.ChallengeAfter = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyChallengeAfter+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyChallengeWindow:
+		if valueInt, ok := value.(int); ok {
+			cfg.ChallengeWindowMins = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyChallengeWindow+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyPasswordCost:
+		if valueInt, ok := value.(int); ok {
+			cfg.PasswordCost = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyPasswordCost+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyPasswordMemory:
+		if valueInt, ok := value.(int); ok {
+			cfg.PasswordMemory = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyPasswordMemory+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyRegister:
+		if valueBool, ok := value.(bool); ok {
+			cfg.Register = valueBool
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyRegister+"' requires a bool but got a %T", value)
+		}
+	case ConfigKeyRegisterRole:
+		if valueStr, ok := value.(string); ok {
+			role, err := jelly.ParseRole(valueStr)
+			if err != nil {
+				return fmt.Errorf("key '"+ConfigKeyRegisterRole+"': %w", err)
+			}
+			cfg.RegisterRole = role
+			return nil
+		} else if valueRole, ok := value.(jelly.Role); ok {
+			cfg.RegisterRole = valueRole
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyRegisterRole+"' requires a string but got a %T", value)
+		}
+	case ConfigKeyRegisterLimit:
+		if valueInt, ok := value.(int); ok {
+			cfg.RegisterLimit = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyRegisterLimit+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyTokenCache:
+		if valueInt, ok := value.(int); ok {
+			cfg.TokenCacheMillis = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyTokenCache+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyUserAttributes:
+		if valueSchema, ok := value.(AttributeSchema); ok {
+			cfg.UserAttributes = valueSchema
+			return nil
+		}
+		valueSlice, err := jelly.TypedSlice[string](ConfigKeyUserAttributes, value)
+		if err != nil {
+			return err
+		}
+		schema, err := ParseAttributeSchema(valueSlice)
+		if err != nil {
+			return fmt.Errorf("key '"+ConfigKeyUserAttributes+"': %w", err)
+		}
+		cfg.UserAttributes = schema
+		return nil
 	case ConfigKeySecret:
 		if valueSlice, ok := value.([]byte); ok {
 			cfg.Secret = valueSlice
@@ -169,14 +677,25 @@ func (cfg *Config) Set(key string, value interface{}) error {
 
 func (cfg *Config) SetFromString(key string, value string) error {
 	switch strings.ToLower(key) {
-	case ConfigKeySecret, ConfigKeySetAdmin:
+	case ConfigKeySecret, ConfigKeySetAdmin, ConfigKeySignAlg, ConfigKeySignKey, ConfigKeyTOTPIssuer, ConfigKeyPasswordHash, ConfigKeyRegisterRole:
 		return cfg.Set(key, value)
-	case ConfigKeyUnauthDelay:
+	case ConfigKeyRequireAdmin2FA, ConfigKeyGuestTokens, ConfigKeySoftDelete, ConfigKeyRegister:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("key '%s': %w", strings.ToLower(key), err)
+		}
+		return cfg.Set(key, b)
+	case ConfigKeyUnauthDelay, ConfigKeyPrevKeyGrace, ConfigKeyServiceTokenLifetime, ConfigKeyLoginHistory, ConfigKeyGuestTokenLifetime, ConfigKeyArchiveRetention, ConfigKeyChallengeAfter, ConfigKeyChallengeWindow, ConfigKeyPasswordCost, ConfigKeyPasswordMemory, ConfigKeyRegisterLimit, ConfigKeyTokenCache:
 		val, err := strconv.Atoi(value)
 		if err != nil {
-			return fmt.Errorf("key '"+ConfigKeyUnauthDelay+"': %w", err)
+			return fmt.Errorf("key '%s': %w", strings.ToLower(key), err)
 		}
 		return cfg.Set(key, val)
+	case ConfigKeyPrevSignKeys, ConfigKeyUserAttributes:
+		if value == "" {
+			return cfg.Set(key, []string{})
+		}
+		return cfg.Set(key, strings.Split(value, ","))
 	default:
 		return cfg.CommonConf.SetFromString(key, value)
 	}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/dekarrin/jelly"
+)
+
+// Types of the events that jellyauth publishes on the server's EventBus about
+// the lifecycle of users. The full type of each event is the name of the API
+// followed by a dot and one of these, such as "jellyauth.user.created". The
+// data of each is a UserEvent.
+const (
+	EventUserCreated         = "user.created"
+	EventUserRegistered      = "user.registered"
+	EventUserUpdated         = "user.updated"
+	EventUserPasswordChanged = "user.password_changed"
+	EventUserArchived        = "user.archived"
+	EventUserRestored        = "user.restored"
+	EventUserDeleted         = "user.deleted"
+)
+
+// UserEvent is the data of the events that jellyauth publishes about users. It
+// never includes the password of the user.
+type UserEvent struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+	Role     string `json:"role"`
+	TenantID string `json:"tenant_id,omitempty"`
+	Archived string `json:"archived,omitempty"`
+	Version  int64  `json:"version,omitempty"`
+}
+
+func newUserEvent(u jelly.AuthUser) UserEvent {
+	ev := UserEvent{
+		ID:       u.ID.String(),
+		Username: u.Username,
+		Email:    u.Email,
+		Role:     u.Role.String(),
+		TenantID: u.TenantID,
+		Version:  u.Version,
+	}
+	if !u.Archived.IsZero() {
+		ev.Archived = u.Archived.Format(time.RFC3339)
+	}
+	return ev
+}
+
+// publishUserEvent publishes an event of the given type about user. It does
+// nothing if the service has no EventBus. As every change to a user is
+// published, it also drops any cached tokens of the user.
+func (svc loginService) publishUserEvent(ctx context.Context, eventType string, user jelly.AuthUser) {
+	svc.Tokens.invalidate(user.ID)
+	svc.Events.Publish(ctx, svc.EventPrefix+"."+eventType, newUserEvent(user))
+}
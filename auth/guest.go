@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/dekarrin/jelly"
+	"github.com/google/uuid"
+)
+
+// GuestUpgradeHook is called when a client that holds a guest token logs in
+// as a user. guestID is the ID of the guest the client was, and user is the
+// user it logged in as. It is typically used to transfer ownership of data
+// that was created while the client was a guest, such as a shopping cart or
+// draft, to the user.
+type GuestUpgradeHook func(ctx context.Context, guestID uuid.UUID, user jelly.AuthUser) error
+
+var (
+	guestHooksMu sync.RWMutex
+	guestHooks   []GuestUpgradeHook
+)
+
+// OnGuestUpgrade registers hook to be called whenever a client gives a valid
+// guest token along with its login request. Hooks are called in the order they
+// were registered after the login succeeds; an error returned by one is logged
+// but does not stop the login or the remaining hooks.
+//
+// OnGuestUpgrade is typically called by an API's Init method. It is safe to
+// call concurrently.
+func OnGuestUpgrade(hook GuestUpgradeHook) {
+	if hook == nil {
+		return
+	}
+
+	guestHooksMu.Lock()
+	defer guestHooksMu.Unlock()
+	guestHooks = append(guestHooks, hook)
+}
+
+// runGuestUpgradeHooks calls every registered GuestUpgradeHook for the upgrade
+// of the given guest to user and returns the errors of any that failed.
+func runGuestUpgradeHooks(ctx context.Context, guestID uuid.UUID, user jelly.AuthUser) []error {
+	guestHooksMu.RLock()
+	hooks := make([]GuestUpgradeHook, len(guestHooks))
+	copy(hooks, guestHooks)
+	guestHooksMu.RUnlock()
+
+	var errs []error
+	for i, h := range hooks {
+		if err := h(ctx, guestID, user); err != nil {
+			errs = append(errs, fmt.Errorf("guest upgrade hook #%d: %w", i+1, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashAlg is an algorithm that jellyauth can use to hash passwords and service
+// account secrets.
+type HashAlg string
+
+const (
+	// HashBcrypt hashes with bcrypt. It is the default.
+	HashBcrypt HashAlg = "bcrypt"
+
+	// HashArgon2id hashes with Argon2id.
+	HashArgon2id HashAlg = "argon2id"
+)
+
+func (alg HashAlg) String() string {
+	return string(alg)
+}
+
+// ParseHashAlg parses a string into a HashAlg. The empty string is parsed as
+// HashBcrypt. Matching is not case-sensitive.
+func ParseHashAlg(s string) (HashAlg, error) {
+	switch strings.ToLower(s) {
+	case HashBcrypt.String(), "":
+		return HashBcrypt, nil
+	case HashArgon2id.String():
+		return HashArgon2id, nil
+	default:
+		return HashBcrypt, fmt.Errorf("must be one of %q or %q", HashBcrypt, HashArgon2id)
+	}
+}
+
+const (
+	// DefaultBcryptCost is the bcrypt cost used if none is configured.
+	DefaultBcryptCost = 14
+
+	// DefaultArgon2idTime is the number of Argon2id passes used if none is
+	// configured.
+	DefaultArgon2idTime = 3
+
+	// DefaultArgon2idMemory is the memory (in KiB) that Argon2id uses if none
+	// is configured.
+	DefaultArgon2idMemory = 64 * 1024
+
+	// argon2idThreads is the parallelism of Argon2id hashes.
+	argon2idThreads = 2
+
+	argon2idSaltLen = 16
+	argon2idKeyLen  = 32
+)
+
+// PasswordHasher hashes passwords for storage and checks passwords against
+// stored hashes. Hashes are tagged with the algorithm and parameters they were
+// made with, so that hashes made by one PasswordHasher can be checked by
+// another and replaced when the algorithm or its cost is changed.
+type PasswordHasher interface {
+	// Hash returns the hash of password to be stored.
+	Hash(password string) (string, error)
+
+	// Verify returns whether password matches hash. It must accept hashes
+	// made by any PasswordHasher that was previously used for the same
+	// store; for hashes made by the built-in ones, it can call
+	// VerifyPassword. An error is returned only if hash cannot be checked.
+	Verify(hash, password string) (bool, error)
+
+	// NeedsRehash returns whether hash was made with a different algorithm or
+	// parameters than this PasswordHasher uses, and so should be replaced
+	// with a new hash the next time the password is known.
+	NeedsRehash(hash string) bool
+}
+
+// NewPasswordHasher returns the built-in PasswordHasher for alg. For
+// HashBcrypt, cost is the bcrypt cost and memory is ignored; for HashArgon2id,
+// cost is the number of passes and memory is the memory used in KiB. Values
+// of 0 are replaced with the defaults.
+func NewPasswordHasher(alg HashAlg, cost, memory int) (PasswordHasher, error) {
+	switch alg {
+	case HashBcrypt, "":
+		if cost == 0 {
+			cost = DefaultBcryptCost
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return bcryptHasher{cost: cost}, nil
+	case HashArgon2id:
+		if cost == 0 {
+			cost = DefaultArgon2idTime
+		}
+		if memory == 0 {
+			memory = DefaultArgon2idMemory
+		}
+		if cost < 1 {
+			return nil, fmt.Errorf("argon2id cost must be at least 1")
+		}
+		if memory < 8*argon2idThreads {
+			return nil, fmt.Errorf("argon2id memory must be at least %d KiB", 8*argon2idThreads)
+		}
+		return argon2idHasher{time: uint32(cost), memory: uint32(memory)}, nil
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", alg)
+	}
+}
+
+// defaultHasher is the PasswordHasher used by a loginService that has none
+// set.
+var defaultHasher PasswordHasher = bcryptHasher{cost: DefaultBcryptCost}
+
+// VerifyPassword returns whether password matches hash, which must have been
+// made by one of the built-in PasswordHashers or by a version of jellyauth
+// from before hashes were tagged, which used base64-encoded bcrypt. An error
+// is returned if hash is not in one of those formats.
+func VerifyPassword(hash, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return verifyBcrypt([]byte(hash), password)
+	case strings.HasPrefix(hash, "$argon2id$"):
+		p, err := parseArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+		return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+	default:
+		// untagged hashes are base64-encoded bcrypt
+		legacy, err := base64.StdEncoding.DecodeString(hash)
+		if err != nil {
+			return false, fmt.Errorf("hash is not in a known format")
+		}
+		return verifyBcrypt(legacy, password)
+	}
+}
+
+// checkHashFormat returns an error if hash is not in one of the formats that
+// VerifyPassword accepts. Unlike VerifyPassword, it does not hash anything, so
+// it is fast even for hashes with a high cost.
+func checkHashFormat(hash string) error {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		_, err := bcrypt.Cost([]byte(hash))
+		return err
+	case strings.HasPrefix(hash, "$argon2id$"):
+		_, err := parseArgon2id(hash)
+		return err
+	default:
+		legacy, err := base64.StdEncoding.DecodeString(hash)
+		if err != nil {
+			return fmt.Errorf("hash is not in a known format")
+		}
+		_, err = bcrypt.Cost(legacy)
+		return err
+	}
+}
+
+func verifyBcrypt(hash []byte, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// bcryptHasher hashes with bcrypt. Its hashes are in the modular crypt format
+// that bcrypt itself produces, such as "$2a$14$...".
+type bcryptHasher struct {
+	cost int
+}
+
+func (h bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return "", jelly.NewError("password is too long", err, jelly.ErrBadArgument)
+		}
+		return "", jelly.NewError("password could not be encrypted", err)
+	}
+	return string(hash), nil
+}
+
+func (h bcryptHasher) Verify(hash, password string) (bool, error) {
+	return VerifyPassword(hash, password)
+}
+
+func (h bcryptHasher) NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, "$2") {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
+
+// argon2idHasher hashes with Argon2id. Its hashes are in the PHC string format
+// "$argon2id$v=19$m=MEMORY,t=TIME,p=THREADS$SALT$KEY".
+type argon2idHasher struct {
+	time   uint32
+	memory uint32
+}
+
+func (h argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2idSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", jelly.NewError("password could not be encrypted", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.time, h.memory, argon2idThreads, argon2idKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.memory, h.time, argon2idThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h argon2idHasher) Verify(hash, password string) (bool, error) {
+	return VerifyPassword(hash, password)
+}
+
+func (h argon2idHasher) NeedsRehash(hash string) bool {
+	p, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return p.time != h.time || p.memory != h.memory || p.threads != argon2idThreads || len(p.key) != argon2idKeyLen
+}
+
+type argon2idParams struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2id parses a hash made by argon2idHasher.
+func parseArgon2id(hash string) (argon2idParams, error) {
+	var p argon2idParams
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, fmt.Errorf("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, fmt.Errorf("argon2id hash version: %w", err)
+	}
+	if version != argon2.Version {
+		return p, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, fmt.Errorf("argon2id hash parameters: %w", err)
+	}
+
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, fmt.Errorf("argon2id hash salt: %w", err)
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, fmt.Errorf("argon2id hash key: %w", err)
+	}
+	if len(p.key) == 0 {
+		return p, fmt.Errorf("argon2id hash key is empty")
+	}
+
+	return p, nil
+}
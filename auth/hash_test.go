@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/authuserdao/inmem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// legacyHash returns password hashed the way that jellyauth did before hashes
+// were tagged.
+func legacyHash(t *testing.T, password string, cost int) string {
+	t.Helper()
+
+	h, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(h)
+}
+
+func Test_PasswordHasher(t *testing.T) {
+	bcrypt4, err := NewPasswordHasher(HashBcrypt, bcrypt.MinCost, 0)
+	require.NoError(t, err)
+	bcrypt5, err := NewPasswordHasher(HashBcrypt, bcrypt.MinCost+1, 0)
+	require.NoError(t, err)
+	argon1, err := NewPasswordHasher(HashArgon2id, 1, 64)
+	require.NoError(t, err)
+	argon2, err := NewPasswordHasher(HashArgon2id, 2, 64)
+	require.NoError(t, err)
+
+	hashes := map[string]string{}
+	for name, h := range map[string]PasswordHasher{"bcrypt4": bcrypt4, "bcrypt5": bcrypt5, "argon1": argon1, "argon2": argon2} {
+		hashes[name], err = h.Hash("hunter2")
+		require.NoError(t, err)
+	}
+	hashes["legacy"] = legacyHash(t, "hunter2", bcrypt.MinCost)
+
+	testCases := []struct {
+		name          string
+		hasher        PasswordHasher
+		hash          string
+		expectPrefix  string
+		expectRehash  bool
+		expectBadHash bool
+	}{
+		{name: "bcrypt, same cost", hasher: bcrypt4, hash: hashes["bcrypt4"], expectPrefix: "$2a$04$"},
+		{name: "bcrypt, other cost", hasher: bcrypt4, hash: hashes["bcrypt5"], expectPrefix: "$2a$05$", expectRehash: true},
+		{name: "bcrypt, from argon2id", hasher: bcrypt4, hash: hashes["argon1"], expectRehash: true},
+		{name: "bcrypt, from legacy", hasher: bcrypt4, hash: hashes["legacy"], expectRehash: true},
+		{name: "argon2id, same params", hasher: argon1, hash: hashes["argon1"], expectPrefix: "$argon2id$v=19$m=64,t=1,p=2$"},
+		{name: "argon2id, other params", hasher: argon1, hash: hashes["argon2"], expectPrefix: "$argon2id$v=19$m=64,t=2,p=2$", expectRehash: true},
+		{name: "argon2id, from bcrypt", hasher: argon1, hash: hashes["bcrypt4"], expectRehash: true},
+		{name: "argon2id, from legacy", hasher: argon1, hash: hashes["legacy"], expectRehash: true},
+		{name: "unknown format", hasher: bcrypt4, hash: "not a hash!", expectRehash: true, expectBadHash: true},
+		{name: "malformed argon2id", hasher: argon1, hash: "$argon2id$v=19$m=64$abc", expectRehash: true, expectBadHash: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			assert.True(strings.HasPrefix(tc.hash, tc.expectPrefix), "hash %q does not start with %q", tc.hash, tc.expectPrefix)
+			assert.Equal(tc.expectRehash, tc.hasher.NeedsRehash(tc.hash))
+
+			ok, err := tc.hasher.Verify(tc.hash, "hunter2")
+			if tc.expectBadHash {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.True(ok, "correct password not accepted")
+
+			ok, err = tc.hasher.Verify(tc.hash, "hunter3")
+			assert.NoError(err)
+			assert.False(ok, "wrong password accepted")
+		})
+	}
+}
+
+func Test_NewPasswordHasher(t *testing.T) {
+	testCases := []struct {
+		name      string
+		alg       HashAlg
+		cost      int
+		memory    int
+		expect    PasswordHasher
+		expectErr bool
+	}{
+		{name: "bcrypt defaults", alg: HashBcrypt, expect: bcryptHasher{cost: DefaultBcryptCost}},
+		{name: "empty alg is bcrypt", alg: "", cost: 10, expect: bcryptHasher{cost: 10}},
+		{name: "bcrypt cost too low", alg: HashBcrypt, cost: 3, expectErr: true},
+		{name: "bcrypt cost too high", alg: HashBcrypt, cost: 32, expectErr: true},
+		{name: "argon2id defaults", alg: HashArgon2id, expect: argon2idHasher{time: DefaultArgon2idTime, memory: DefaultArgon2idMemory}},
+		{name: "argon2id", alg: HashArgon2id, cost: 4, memory: 1024, expect: argon2idHasher{time: 4, memory: 1024}},
+		{name: "argon2id negative cost", alg: HashArgon2id, cost: -1, expectErr: true},
+		{name: "argon2id memory too low", alg: HashArgon2id, memory: 8, expectErr: true},
+		{name: "unknown alg", alg: "md5", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := NewPasswordHasher(tc.alg, tc.cost, tc.memory)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, actual)
+		})
+	}
+}
+
+func Test_loginService_Login_rehash(t *testing.T) {
+	bcryptH, err := NewPasswordHasher(HashBcrypt, bcrypt.MinCost, 0)
+	require.NoError(t, err)
+	argonH, err := NewPasswordHasher(HashArgon2id, 1, 64)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		stored       func(t *testing.T) string
+		hasher       PasswordHasher
+		password     string
+		expectErr    error
+		expectChange bool
+	}{
+		{
+			name:     "current hash is kept",
+			stored:   func(t *testing.T) string { h, _ := bcryptH.Hash("hunter2"); return h },
+			hasher:   bcryptH,
+			password: "hunter2",
+		},
+		{
+			name:         "legacy hash is upgraded",
+			stored:       func(t *testing.T) string { return legacyHash(t, "hunter2", bcrypt.MinCost) },
+			hasher:       bcryptH,
+			password:     "hunter2",
+			expectChange: true,
+		},
+		{
+			name:         "bcrypt hash is migrated to argon2id",
+			stored:       func(t *testing.T) string { h, _ := bcryptH.Hash("hunter2"); return h },
+			hasher:       argonH,
+			password:     "hunter2",
+			expectChange: true,
+		},
+		{
+			name:      "not migrated on failed login",
+			stored:    func(t *testing.T) string { return legacyHash(t, "hunter2", bcrypt.MinCost) },
+			hasher:    argonH,
+			password:  "hunter3",
+			expectErr: jelly.ErrBadCredentials,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			ctx := context.Background()
+			st := inmem.NewAuthUserStore()
+			svc := loginService{Provider: st, Hasher: tc.hasher}
+
+			stored := tc.stored(t)
+			user, err := st.AuthUsers().Create(ctx, jelly.AuthUser{Username: "marty", Password: stored})
+			require.NoError(t, err)
+
+			_, err = svc.Login(ctx, "marty", tc.password)
+			if tc.expectErr != nil {
+				assert.ErrorIs(err, tc.expectErr)
+			} else {
+				assert.NoError(err)
+			}
+
+			after, err := st.AuthUsers().Get(ctx, user.ID)
+			require.NoError(t, err)
+			if !tc.expectChange {
+				assert.Equal(stored, after.Password)
+				return
+			}
+			assert.NotEqual(stored, after.Password)
+			assert.False(tc.hasher.NeedsRehash(after.Password), "new hash %q needs rehash", after.Password)
+
+			// the user can still log in with the new hash
+			_, err = svc.Login(ctx, "marty", tc.password)
+			assert.NoError(err)
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningAlg is an algorithm that jellyauth can use to sign the JWTs it
+// issues.
+type SigningAlg string
+
+const (
+	// SignHS512 signs tokens with HMAC-SHA512 using the configured secret
+	// combined with per-user data. It is the default.
+	SignHS512 SigningAlg = "HS512"
+
+	// SignRS256 signs tokens with an RSA private key using RSASSA-PKCS1-v1_5
+	// with SHA-256.
+	SignRS256 SigningAlg = "RS256"
+
+	// SignEdDSA signs tokens with an Ed25519 private key.
+	SignEdDSA SigningAlg = "EdDSA"
+)
+
+func (alg SigningAlg) String() string {
+	return string(alg)
+}
+
+// Asymmetric returns whether the algorithm uses a public/private key pair
+// rather than a shared secret.
+func (alg SigningAlg) Asymmetric() bool {
+	return alg == SignRS256 || alg == SignEdDSA
+}
+
+func (alg SigningAlg) method() jwt.SigningMethod {
+	switch alg {
+	case SignRS256:
+		return jwt.SigningMethodRS256
+	case SignEdDSA:
+		return jwt.SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodHS512
+	}
+}
+
+// ParseSigningAlg parses a string into a SigningAlg. The empty string is
+// parsed as SignHS512. Matching is not case-sensitive.
+func ParseSigningAlg(s string) (SigningAlg, error) {
+	switch strings.ToUpper(s) {
+	case strings.ToUpper(SignHS512.String()), "":
+		return SignHS512, nil
+	case strings.ToUpper(SignRS256.String()):
+		return SignRS256, nil
+	case strings.ToUpper(SignEdDSA.String()):
+		return SignEdDSA, nil
+	default:
+		return SignHS512, fmt.Errorf("must be one of %q, %q, or %q", SignHS512, SignRS256, SignEdDSA)
+	}
+}
+
+// signingKey is a single key in a keySet. Keys that are only used for
+// verification have a nil priv.
+type signingKey struct {
+	id   string
+	priv crypto.PrivateKey
+	pub  crypto.PublicKey
+
+	// notAfter is the time after which the key is no longer accepted for
+	// verification. The zero value means it does not expire.
+	notAfter time.Time
+}
+
+// keySet is the complete set of keys used for signing and verifying tokens.
+// For SignHS512, only secret is used; for asymmetric algorithms, the active
+// key signs all new tokens and both it and any previous keys that are still
+// within their grace window are used to verify them.
+type keySet struct {
+	alg      SigningAlg
+	secret   []byte
+	active   signingKey
+	previous []signingKey
+}
+
+// newSecretKeySet creates a keySet that signs with HS512 using secret.
+func newSecretKeySet(secret []byte) keySet {
+	return keySet{alg: SignHS512, secret: secret}
+}
+
+// loadKeySet loads the active key and any previous keys from the given key
+// references. Previous keys are accepted for verification until grace has
+// elapsed from now. See readKeyRef for the format of a key reference.
+func loadKeySet(alg SigningAlg, activeRef string, prevRefs []string, grace time.Duration) (keySet, error) {
+	ks := keySet{alg: alg}
+
+	pemData, err := readKeyRef(activeRef)
+	if err != nil {
+		return ks, fmt.Errorf("active key: %w", err)
+	}
+	ks.active, err = parseKey(alg, pemData, true)
+	if err != nil {
+		return ks, fmt.Errorf("active key: %w", err)
+	}
+
+	notAfter := time.Now().Add(grace)
+	for i, ref := range prevRefs {
+		pemData, err := readKeyRef(ref)
+		if err != nil {
+			return ks, fmt.Errorf("previous key #%d: %w", i+1, err)
+		}
+		k, err := parseKey(alg, pemData, false)
+		if err != nil {
+			return ks, fmt.Errorf("previous key #%d: %w", i+1, err)
+		}
+		k.notAfter = notAfter
+		ks.previous = append(ks.previous, k)
+	}
+
+	return ks, nil
+}
+
+// readKeyRef reads the PEM data referred to by ref. A reference is either
+// "env:NAME" to read it from the environment variable NAME, "file:PATH" to
+// read it from the file at PATH, or simply a path to a file.
+func readKeyRef(ref string) ([]byte, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("key reference is empty")
+	}
+
+	if strings.HasPrefix(ref, "env:") {
+		name := ref[len("env:"):]
+		val, ok := os.LookupEnv(name)
+		if !ok || val == "" {
+			return nil, fmt.Errorf("environment variable %q is not set", name)
+		}
+		return []byte(val), nil
+	}
+
+	path := strings.TrimPrefix(ref, "file:")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// parseKey parses PEM data into a signingKey. If requirePrivate is false, the
+// PEM data may be either a private key or a public key.
+func parseKey(alg SigningAlg, pemData []byte, requirePrivate bool) (signingKey, error) {
+	var k signingKey
+	var err error
+
+	switch alg {
+	case SignRS256:
+		var priv *rsa.PrivateKey
+		priv, err = jwt.ParseRSAPrivateKeyFromPEM(pemData)
+		if err == nil {
+			k.priv = priv
+			k.pub = &priv.PublicKey
+		} else if !requirePrivate {
+			k.pub, err = jwt.ParseRSAPublicKeyFromPEM(pemData)
+		}
+	case SignEdDSA:
+		var priv crypto.PrivateKey
+		priv, err = jwt.ParseEdPrivateKeyFromPEM(pemData)
+		if err == nil {
+			k.priv = priv
+			k.pub = priv.(ed25519.PrivateKey).Public()
+		} else if !requirePrivate {
+			k.pub, err = jwt.ParseEdPublicKeyFromPEM(pemData)
+		}
+	default:
+		return k, fmt.Errorf("%s does not use keys", alg)
+	}
+
+	if err != nil {
+		return k, fmt.Errorf("parse %s key: %w", alg, err)
+	}
+
+	k.id, err = keyID(k.pub)
+	if err != nil {
+		return k, err
+	}
+
+	return k, nil
+}
+
+// keyID returns the ID of a public key. It is the first 16 hex characters of
+// the SHA-256 hash of the PKIX encoding of the key.
+func keyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("encode public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+// verificationKey returns the public key with the given ID if it is accepted
+// for verification at the current time.
+func (ks keySet) verificationKey(kid string) (crypto.PublicKey, error) {
+	if ks.active.id == kid {
+		return ks.active.pub, nil
+	}
+
+	for _, k := range ks.previous {
+		if k.id != kid {
+			continue
+		}
+		if !k.notAfter.IsZero() && time.Now().After(k.notAfter) {
+			return nil, fmt.Errorf("key %q is no longer accepted", kid)
+		}
+		return k.pub, nil
+	}
+
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
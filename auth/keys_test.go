@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/authuserdao/inmem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeyPEM generates a new key pair for alg and returns the PEM encoding of
+// its private key and of its public key.
+func testKeyPEM(t *testing.T, alg SigningAlg) (priv, pub []byte) {
+	t.Helper()
+
+	var privKey, pubKey interface{}
+	switch alg {
+	case SignRS256:
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		privKey, pubKey = k, &k.PublicKey
+	case SignEdDSA:
+		p, k, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		privKey, pubKey = k, p
+	default:
+		t.Fatalf("no keys for %s", alg)
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(privKey)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pubKey)
+	require.NoError(t, err)
+
+	priv = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER})
+	pub = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	return priv, pub
+}
+
+// writeTestFile writes data to a new file in a temp dir and returns its path.
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func Test_ParseSigningAlg(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		expect    SigningAlg
+		expectErr bool
+	}{
+		{name: "empty", input: "", expect: SignHS512},
+		{name: "HS512", input: "HS512", expect: SignHS512},
+		{name: "RS256", input: "RS256", expect: SignRS256},
+		{name: "EdDSA", input: "EdDSA", expect: SignEdDSA},
+		{name: "lowercase", input: "eddsa", expect: SignEdDSA},
+		{name: "unknown", input: "ES256", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := ParseSigningAlg(tc.input)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, actual)
+		})
+	}
+}
+
+func Test_loadKeySet(t *testing.T) {
+	rsaPriv, rsaPub := testKeyPEM(t, SignRS256)
+	rsaOldPriv, rsaOldPub := testKeyPEM(t, SignRS256)
+	edPriv, edPub := testKeyPEM(t, SignEdDSA)
+
+	rsaPrivFile := writeTestFile(t, "rsa.pem", rsaPriv)
+	rsaPubFile := writeTestFile(t, "rsa.pub.pem", rsaPub)
+	rsaOldPrivFile := writeTestFile(t, "rsa-old.pem", rsaOldPriv)
+	rsaOldPubFile := writeTestFile(t, "rsa-old.pub.pem", rsaOldPub)
+	edPrivFile := writeTestFile(t, "ed.pem", edPriv)
+	t.Setenv("JELLY_TEST_ED_KEY", string(edPriv))
+	t.Setenv("JELLY_TEST_ED_PUB", string(edPub))
+
+	testCases := []struct {
+		name          string
+		alg           SigningAlg
+		active        string
+		previous      []string
+		expectErr     bool
+		expectPrivate []bool // whether each previous key has a private key
+	}{
+		{name: "RS256 from path", alg: SignRS256, active: rsaPrivFile},
+		{name: "RS256 from file ref", alg: SignRS256, active: "file:" + rsaPrivFile},
+		{name: "EdDSA from file", alg: SignEdDSA, active: edPrivFile},
+		{name: "EdDSA from env", alg: SignEdDSA, active: "env:JELLY_TEST_ED_KEY"},
+		{
+			name:          "previous keys may be public or private",
+			alg:           SignRS256,
+			active:        rsaPrivFile,
+			previous:      []string{rsaOldPubFile, "file:" + rsaOldPrivFile},
+			expectPrivate: []bool{false, true},
+		},
+		{name: "active key must be private", alg: SignRS256, active: rsaPubFile, expectErr: true},
+		{name: "active key must be private (env)", alg: SignEdDSA, active: "env:JELLY_TEST_ED_PUB", expectErr: true},
+		{name: "unset env var", alg: SignEdDSA, active: "env:JELLY_TEST_NOT_SET", expectErr: true},
+		{name: "empty ref", alg: SignEdDSA, active: "", expectErr: true},
+		{name: "missing file", alg: SignRS256, active: filepath.Join(t.TempDir(), "nope.pem"), expectErr: true},
+		{name: "key for another alg", alg: SignRS256, active: edPrivFile, expectErr: true},
+		{name: "bad previous key", alg: SignRS256, active: rsaPrivFile, previous: []string{edPrivFile}, expectErr: true},
+		{name: "HS512 does not use keys", alg: SignHS512, active: rsaPrivFile, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ks, err := loadKeySet(tc.alg, tc.active, tc.previous, time.Hour)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, tc.alg, ks.alg)
+			assert.NotNil(t, ks.active.priv)
+			assert.NotNil(t, ks.active.pub)
+			assert.Len(t, ks.active.id, 16)
+
+			if !assert.Len(t, ks.previous, len(tc.expectPrivate)) {
+				return
+			}
+			for i, k := range ks.previous {
+				assert.Equal(t, tc.expectPrivate[i], k.priv != nil, "previous key #%d has private key", i+1)
+				assert.False(t, k.notAfter.IsZero(), "previous key #%d has no grace window", i+1)
+			}
+		})
+	}
+}
+
+func Test_keyID(t *testing.T) {
+	priv, pub := testKeyPEM(t, SignEdDSA)
+
+	fromPriv, err := parseKey(SignEdDSA, priv, true)
+	require.NoError(t, err)
+	fromPub, err := parseKey(SignEdDSA, pub, false)
+	require.NoError(t, err)
+
+	// the ID is taken from the public key so that it is the same either way
+	assert.Equal(t, fromPriv.id, fromPub.id)
+}
+
+func Test_keySet_rotation(t *testing.T) {
+	for _, alg := range []SigningAlg{SignRS256, SignEdDSA} {
+		t.Run(alg.String(), func(t *testing.T) {
+			oldPriv, oldPub := testKeyPEM(t, alg)
+			newPriv, _ := testKeyPEM(t, alg)
+			otherPriv, _ := testKeyPEM(t, alg)
+			oldPrivFile := writeTestFile(t, "old.pem", oldPriv)
+			oldPubFile := writeTestFile(t, "old.pub.pem", oldPub)
+			newPrivFile := writeTestFile(t, "new.pem", newPriv)
+			otherPrivFile := writeTestFile(t, "other.pem", otherPriv)
+
+			users := inmem.NewAuthUserStore().AuthUsers()
+			user, err := users.Create(context.Background(), jelly.AuthUser{Username: "marty", Password: "hash"})
+			require.NoError(t, err)
+
+			oldKeys, err := loadKeySet(alg, oldPrivFile, nil, 0)
+			require.NoError(t, err)
+			otherKeys, err := loadKeySet(alg, otherPrivFile, nil, 0)
+			require.NoError(t, err)
+
+			testCases := []struct {
+				name      string
+				signKeys  keySet
+				active    string
+				previous  []string
+				grace     time.Duration
+				expectErr bool
+			}{
+				{name: "signed by active key", signKeys: oldKeys, active: oldPrivFile},
+				{name: "signed by previous key within grace", signKeys: oldKeys, active: newPrivFile, previous: []string{oldPubFile}, grace: time.Hour},
+				{name: "signed by previous key after grace", signKeys: oldKeys, active: newPrivFile, previous: []string{oldPubFile}, grace: -time.Second, expectErr: true},
+				{name: "previous key not given", signKeys: oldKeys, active: newPrivFile, expectErr: true},
+				{name: "unknown key", signKeys: otherKeys, active: newPrivFile, previous: []string{oldPubFile}, grace: time.Hour, expectErr: true},
+			}
+
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					verifyKeys, err := loadKeySet(alg, tc.active, tc.previous, tc.grace)
+					require.NoError(t, err)
+
+					tok, err := generateToken(tc.signKeys, user)
+					require.NoError(t, err)
+
+					actual, err := validateToken(context.Background(), tok, verifyKeys, users, nil, nil, false)
+					if tc.expectErr {
+						assert.Error(t, err)
+						return
+					}
+					if assert.NoError(t, err) {
+						assert.Equal(t, user.ID, actual.ID)
+					}
+				})
+			}
+		})
+	}
+}
@@ -9,7 +9,10 @@ import (
 
 type jwtAuthProvider struct {
 	db          jelly.AuthUserRepo
-	secret      []byte
+	accounts    jelly.ServiceAccountRepo
+	sessions    jelly.SessionRepo
+	guests      bool
+	keys        keySet
 	unauthDelay time.Duration
 	srv         loginService
 }
@@ -22,11 +25,16 @@ func (ap jwtAuthProvider) Authenticate(req *http.Request) (jelly.AuthUser, bool,
 		return jelly.AuthUser{}, false, nil
 	}
 
+	if cached, ok := ap.srv.Tokens.get(tok); ok {
+		return cached, true, nil
+	}
+
 	// validate the token
-	lookupUser, err := validateToken(req.Context(), tok, ap.secret, ap.db)
+	lookupUser, err := validateToken(req.Context(), tok, ap.keys, ap.db, ap.accounts, ap.sessions, ap.guests)
 	if err != nil {
 		return jelly.AuthUser{}, false, err
 	}
+	ap.srv.Tokens.put(tok, lookupUser)
 
 	return lookupUser, true, nil
 }
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dekarrin/jelly"
+)
+
+// userCSVColumns are the columns of an export of users as CSV, in order. The
+// password_hash column is added after them if hashes are included.
+var userCSVColumns = []string{
+	"id", "username", "email", "role", "tenant_id", "created", "modified",
+	"last_login", "last_logout", "attributes",
+}
+
+// userRecordOf gives the record of u that is exported. Its password hash is
+// only included if withHash is true.
+func userRecordOf(u jelly.AuthUser, withHash bool) userRecord {
+	rec := userRecord{
+		ID:             u.ID.String(),
+		Username:       u.Username,
+		Email:          u.Email,
+		Role:           u.Role.String(),
+		TenantID:       u.TenantID,
+		Created:        u.Created.Format(time.RFC3339),
+		Modified:       u.Modified.Format(time.RFC3339),
+		LastLoginTime:  u.LastLogin.Format(time.RFC3339),
+		LastLogoutTime: u.LastLogout.Format(time.RFC3339),
+		Attributes:     u.Attributes,
+	}
+	if withHash {
+		rec.PasswordHash = u.Password
+	}
+	return rec
+}
+
+// encodeUserCSV encodes records as CSV with a header row. Attributes are
+// given as a JSON object.
+func encodeUserCSV(records []userRecord, withHash bool) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	header := userCSVColumns
+	if withHash {
+		header = append(append([]string{}, header...), "password_hash")
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	for _, rec := range records {
+		var attrs string
+		if len(rec.Attributes) > 0 {
+			data, err := json.Marshal(rec.Attributes)
+			if err != nil {
+				return nil, fmt.Errorf("user %s: attributes: %w", rec.ID, err)
+			}
+			attrs = string(data)
+		}
+
+		row := []string{
+			rec.ID, rec.Username, rec.Email, rec.Role, rec.TenantID, rec.Created,
+			rec.Modified, rec.LastLoginTime, rec.LastLogoutTime, attrs,
+		}
+		if withHash {
+			row = append(row, rec.PasswordHash)
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// decodeUserCSV decodes the records of users to import from CSV. The first row
+// must be a header that names the column of each field; it must have a
+// username column, and columns that are not used on import are ignored. At
+// most maxBatchOperations+1 records are read.
+//
+// A row whose attributes are not a JSON object does not stop decoding; the
+// returned results have a failed result at the index of each such row and a
+// zero value for the others. An error is returned if the CSV itself is
+// malformed.
+func decodeUserCSV(r io.Reader) ([]userRecord, []userBatchResult, error) {
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("malformed CSV: %w", err)
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := cols["username"]; !ok {
+		return nil, nil, fmt.Errorf("CSV header does not have a username column")
+	}
+
+	var records []userRecord
+	var results []userBatchResult
+	for len(records) <= maxBatchOperations {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("malformed CSV: %w", err)
+		}
+
+		field := func(name string) string {
+			if i, ok := cols[name]; ok {
+				return row[i]
+			}
+			return ""
+		}
+
+		rec := userRecord{
+			Username:     field("username"),
+			Email:        field("email"),
+			Role:         field("role"),
+			TenantID:     field("tenant_id"),
+			Password:     field("password"),
+			PasswordHash: field("password_hash"),
+		}
+
+		var result userBatchResult
+		if attrs := field("attributes"); attrs != "" {
+			if err := json.Unmarshal([]byte(attrs), &rec.Attributes); err != nil {
+				result = userBatchResult{Status: http.StatusBadRequest, Error: "attributes: must be a JSON object"}
+			}
+		}
+
+		records = append(records, rec)
+		results = append(results, result)
+	}
+
+	return records, results, nil
+}
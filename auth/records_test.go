@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/authuserdao/inmem"
+	"github.com/dekarrin/jelly/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func Test_decodeUserCSV(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expect        []userRecord
+		expectResults []userBatchResult
+		expectErr     bool
+	}{
+		{
+			name:   "empty",
+			input:  "",
+			expect: nil,
+		},
+		{
+			name:  "columns in any order",
+			input: "password,Username,role\nhunter2,marty,admin\n",
+			expect: []userRecord{
+				{Username: "marty", Role: "admin", Password: "hunter2"},
+			},
+			expectResults: []userBatchResult{{}},
+		},
+		{
+			name: "export columns are ignored",
+			input: "id,username,email,role,tenant_id,created,modified,last_login,last_logout,attributes,password_hash\n" +
+				`1234,marty,marty@example.com,normal,t1,2020-01-01T00:00:00Z,,,,"{""team"":""red""}",$2a$04$abc` + "\n",
+			expect: []userRecord{
+				{
+					Username:     "marty",
+					Email:        "marty@example.com",
+					Role:         "normal",
+					TenantID:     "t1",
+					PasswordHash: "$2a$04$abc",
+					Attributes:   map[string]interface{}{"team": "red"},
+				},
+			},
+			expectResults: []userBatchResult{{}},
+		},
+		{
+			name:  "bad attributes fail only their row",
+			input: "username,password,attributes\nmarty,hunter2,not json\ndoc,hunter3,\n",
+			expect: []userRecord{
+				{Username: "marty", Password: "hunter2"},
+				{Username: "doc", Password: "hunter3"},
+			},
+			expectResults: []userBatchResult{
+				{Status: http.StatusBadRequest, Error: "attributes: must be a JSON object"},
+				{},
+			},
+		},
+		{
+			name:      "no username column",
+			input:     "email,password\nmarty@example.com,hunter2\n",
+			expectErr: true,
+		},
+		{
+			name:      "wrong number of fields",
+			input:     "username,password\nmarty\n",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			actual, results, err := decodeUserCSV(strings.NewReader(tc.input))
+			if tc.expectErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expect, actual)
+			assert.Equal(tc.expectResults, results)
+		})
+	}
+}
+
+func Test_encodeUserCSV(t *testing.T) {
+	records := []userRecord{
+		{ID: "1", Username: "marty", Email: "marty@example.com", Role: "admin", PasswordHash: "$2a$04$abc", Attributes: map[string]interface{}{"team": "red"}},
+		{ID: "2", Username: "doc, the scientist", Role: "normal", PasswordHash: "$2a$04$def"},
+	}
+
+	testCases := []struct {
+		name       string
+		withHash   bool
+		expectHash []string
+	}{
+		{name: "without hashes", withHash: false, expectHash: []string{"", ""}},
+		{name: "with hashes", withHash: true, expectHash: []string{"$2a$04$abc", "$2a$04$def"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			data, err := encodeUserCSV(records, tc.withHash)
+			require.NoError(t, err)
+			assert.Equal(tc.withHash, strings.Contains(strings.SplitN(string(data), "\n", 2)[0], "password_hash"))
+
+			// an export can be imported as-is
+			decoded, _, err := decodeUserCSV(strings.NewReader(string(data)))
+			require.NoError(t, err)
+			if !assert.Len(decoded, len(records)) {
+				return
+			}
+			for i := range records {
+				assert.Equal(records[i].Username, decoded[i].Username, "user #%d", i+1)
+				assert.Equal(records[i].Email, decoded[i].Email, "user #%d", i+1)
+				assert.Equal(records[i].Role, decoded[i].Role, "user #%d", i+1)
+				assert.Equal(records[i].Attributes, decoded[i].Attributes, "user #%d", i+1)
+				assert.Equal(tc.expectHash[i], decoded[i].PasswordHash, "user #%d", i+1)
+			}
+		})
+	}
+}
+
+func Test_loginService_ImportUsers(t *testing.T) {
+	hasher, err := NewPasswordHasher(HashBcrypt, bcrypt.MinCost, 0)
+	require.NoError(t, err)
+	argonHash, err := NewPasswordHasher(HashArgon2id, 1, 64)
+	require.NoError(t, err)
+	argonHashed, err := argonHash.Hash("hunter2")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		user      importedUser
+		expectErr error
+	}{
+		{
+			name: "plaintext password",
+			user: importedUser{AuthUser: jelly.AuthUser{Username: "marty", Password: "hunter2"}},
+		},
+		{
+			name: "hash in current format",
+			user: importedUser{AuthUser: jelly.AuthUser{Username: "marty"}, PasswordHash: func() string { h, _ := hasher.Hash("hunter2"); return h }()},
+		},
+		{
+			name: "hash in other format",
+			user: importedUser{AuthUser: jelly.AuthUser{Username: "marty"}, PasswordHash: argonHashed},
+		},
+		{
+			name: "legacy hash",
+			user: importedUser{AuthUser: jelly.AuthUser{Username: "marty"}, PasswordHash: legacyHash(t, "hunter2", bcrypt.MinCost)},
+		},
+		{
+			name:      "malformed hash",
+			user:      importedUser{AuthUser: jelly.AuthUser{Username: "marty"}, PasswordHash: "$2a$04$tooshort"},
+			expectErr: jelly.ErrBadArgument,
+		},
+		{
+			name:      "no password",
+			user:      importedUser{AuthUser: jelly.AuthUser{Username: "marty"}},
+			expectErr: jelly.ErrBadArgument,
+		},
+		{
+			name:      "username taken",
+			user:      importedUser{AuthUser: jelly.AuthUser{Username: "doc", Password: "hunter2"}},
+			expectErr: jelly.ErrAlreadyExists,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			ctx := context.Background()
+			svc := loginService{Provider: inmem.NewAuthUserStore(), Hasher: hasher}
+
+			_, err := svc.CreateUser(ctx, "doc", "1.21gigawatts", "", jelly.Normal)
+			require.NoError(t, err)
+
+			created, err := svc.ImportUsers(ctx, []importedUser{tc.user})
+			if tc.expectErr != nil {
+				var batchErr jelly.BatchError
+				if assert.ErrorAs(err, &batchErr) {
+					assert.ErrorIs(batchErr.Errors[0], tc.expectErr)
+				}
+				return
+			}
+			assert.NoError(err)
+
+			if tc.user.PasswordHash != "" {
+				assert.Equal(tc.user.PasswordHash, created[0].Password, "hash was not kept as-is")
+			}
+
+			_, err = svc.Login(ctx, tc.user.Username, "hunter2")
+			assert.NoError(err)
+		})
+	}
+}
+
+func Test_httpExportUsers_httpImportUsers(t *testing.T) {
+	// newServer starts a server whose only user is the admin marty and
+	// returns its handler and a token for marty.
+	newServer := func(t *testing.T) (http.Handler, string) {
+		confFile := filepath.Join(t.TempDir(), "jelly.yml")
+		require.NoError(t, os.WriteFile(confFile, []byte(`
+listen: localhost:8080
+jellyauth:
+  enabled: true
+  base: /auth
+  secret: "export-test-secret-that-is-long-enough"
+  set_admin: marty:hunter2
+  unauth_delay: -1
+  password_cost: 4
+`), 0600))
+
+		env := &server.Environment{}
+		env.UseComponent(ComponentInfo{})
+		cfg, err := env.LoadConfig(confFile)
+		require.NoError(t, err)
+		srv, err := env.NewServer(&cfg)
+		require.NoError(t, err)
+		h := srv.Handler()
+
+		w := serve(h, http.MethodPost, "/auth/login", "", "application/json", `{"username":"marty","password":"hunter2"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var login loginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+		return h, login.Token
+	}
+
+	testCases := []struct {
+		name        string
+		format      string
+		contentType string
+	}{
+		{name: "json", format: "json", contentType: "application/json"},
+		{name: "csv", format: "csv", contentType: "text/csv"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			from, fromToken := newServer(t)
+			w := serve(from, http.MethodPost, "/auth/users", fromToken, "application/json", `{"username":"doc","password":"1.21gigawatts","role":"normal"}`)
+			require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+			w = serve(from, http.MethodGet, "/auth/users:export?include_hashes=true&format="+tc.format, fromToken, "", "")
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			exported := w.Body.String()
+			assert.Contains(exported, "$2a$04$")
+
+			to, toToken := newServer(t)
+			w = serve(to, http.MethodPost, "/auth/users:import", toToken, tc.contentType, exported)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+			var resp userBatchResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			var statuses []int
+			for _, r := range resp.Results {
+				statuses = append(statuses, r.Status)
+			}
+			// marty already exists on the new server
+			assert.ElementsMatch([]int{http.StatusConflict, http.StatusCreated}, statuses)
+
+			// doc can log in with the imported hash
+			w = serve(to, http.MethodPost, "/auth/login", "", "application/json", `{"username":"doc","password":"1.21gigawatts"}`)
+			assert.Equal(http.StatusCreated, w.Code, w.Body.String())
+		})
+	}
+}
+
+// serve makes a request to h and returns the recorded response. If token is
+// not empty, it is given as a bearer token.
+func serve(h http.Handler, method, target, token, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
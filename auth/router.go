@@ -19,11 +19,21 @@ func (api *loginAPI) Routes(em jelly.ServiceProvider) (router chi.Router, subpat
 	tokens := api.routesForToken(em)
 	users := api.routesForAuthUser(em)
 	info := api.routesForInfo(em)
+	serviceAccounts := api.routesForServiceAccount(em)
+	loginAttempts := api.routesForLoginAttempt(em)
 
 	r.Mount("/login", login)
 	r.Mount("/tokens", tokens)
 	r.Mount("/users", users)
 	r.Mount("/info", info)
+	r.Mount("/service-accounts", serviceAccounts)
+	r.Mount("/login-attempts", loginAttempts)
+	if api.Register {
+		r.Post("/register", api.httpRegister(em))
+	}
+	r.With(em.RequiredAuth(api.name+".jwt"), api.forbidGuests(em)).Post("/users:batch", api.httpBatchUsers(em))
+	r.With(em.RequiredAuth(api.name+".jwt"), api.forbidGuests(em)).Get("/users:export", api.httpExportUsers(em))
+	r.With(em.RequiredAuth(api.name+".jwt"), api.forbidGuests(em)).Post("/users:import", api.httpImportUsers(em))
 	r.HandleFunc("/info/", jelly.RedirectNoTrailingSlash(em)) // TODO: this doesn't appear to do anyfin
 
 	// TODO: make this library properly use jelly.RedirectNoTrailingSlash
@@ -50,7 +60,9 @@ func (api loginAPI) routesForLogin(em jelly.ServiceProvider) chi.Router {
 	r := chi.NewRouter()
 
 	r.Post("/", api.httpCreateLogin(em))
-	r.With(reqAuth).Delete("/"+p("id:uuid"), api.httpDeleteLogin(em))
+	r.Post("/2fa", api.httpCreateTwoFactorLogin(em))
+	r.Post("/2fa/enroll", api.httpCreateTwoFactorLoginEnrollment(em))
+	r.With(reqAuth, api.forbidGuests(em)).Delete("/"+p("id:uuid"), api.httpDeleteLogin(em))
 	r.HandleFunc("/"+p("id:uuid")+"/", jelly.RedirectNoTrailingSlash(em))
 
 	return r
@@ -58,10 +70,15 @@ func (api loginAPI) routesForLogin(em jelly.ServiceProvider) chi.Router {
 
 func (api loginAPI) routesForToken(em jelly.ServiceProvider) chi.Router {
 	reqAuth := em.RequiredAuth(api.name + ".jwt")
+	optAuth := em.OptionalAuth(api.name + ".jwt")
 
 	r := chi.NewRouter()
 
 	r.With(reqAuth).Post("/", api.httpCreateToken(em))
+	r.Post("/service", api.httpCreateServiceToken(em))
+	if api.GuestTokens {
+		r.With(optAuth).Post("/guest", api.httpCreateGuestToken(em))
+	}
 
 	return r
 }
@@ -71,7 +88,7 @@ func (api loginAPI) routesForAuthUser(em jelly.ServiceProvider) chi.Router {
 
 	r := chi.NewRouter()
 
-	r.Use(reqAuth)
+	r.Use(reqAuth, api.forbidGuests(em))
 
 	r.Get("/", api.httpGetAllUsers(em))
 	r.Post("/", api.httpCreateUser(em))
@@ -81,11 +98,51 @@ func (api loginAPI) routesForAuthUser(em jelly.ServiceProvider) chi.Router {
 		r.Put("/", api.httpReplaceUser(em))
 		r.Patch("/", api.httpUpdateUser(em))
 		r.Delete("/", api.httpDeleteUser(em))
+		if api.Service.SoftDelete {
+			r.Post("/restore", api.httpRestoreUser(em))
+		}
+		r.Get("/sessions", api.httpGetSessions(em))
+		r.Delete("/sessions/"+p("session:uuid"), api.httpDeleteSession(em))
+		r.Get("/login-attempts", api.httpGetLoginAttempts(em))
+		r.Get("/2fa", api.httpGetTwoFactor(em))
+		r.Post("/2fa", api.httpCreateTwoFactor(em))
+		r.Delete("/2fa", api.httpDeleteTwoFactor(em))
+		r.Post("/2fa/confirm", api.httpConfirmTwoFactor(em))
+		r.Post("/2fa/recovery-codes", api.httpCreateRecoveryCodes(em))
 	})
 
 	return r
 }
 
+func (api loginAPI) routesForServiceAccount(em jelly.ServiceProvider) chi.Router {
+	reqAuth := em.RequiredAuth(api.name + ".jwt")
+
+	r := chi.NewRouter()
+
+	r.Use(reqAuth, api.forbidGuests(em))
+
+	r.Get("/", api.httpGetAllServiceAccounts(em))
+	r.Post("/", api.httpCreateServiceAccount(em))
+
+	r.Route("/"+p("id:uuid"), func(r chi.Router) {
+		r.Get("/", api.httpGetServiceAccount(em))
+		r.Delete("/", api.httpDeleteServiceAccount(em))
+		r.Post("/secret", api.httpRotateServiceAccountSecret(em))
+	})
+
+	return r
+}
+
+func (api loginAPI) routesForLoginAttempt(em jelly.ServiceProvider) chi.Router {
+	reqAuth := em.RequiredAuth(api.name + ".jwt")
+
+	r := chi.NewRouter()
+
+	r.With(reqAuth).Get("/", api.httpGetAllLoginAttempts(em))
+
+	return r
+}
+
 func (api loginAPI) routesForInfo(em jelly.ServiceProvider) chi.Router {
 	optAuth := em.OptionalAuth(api.name + ".jwt")
 
@@ -95,3 +152,23 @@ func (api loginAPI) routesForInfo(em jelly.ServiceProvider) chi.Router {
 
 	return r
 }
+
+// forbidGuests returns middleware that responds with an HTTP-403 to clients
+// that are logged in with a guest token. Guests have no user record, so none
+// of the endpoints that act on users apply to them. It must come after the
+// auth middleware.
+func (api loginAPI) forbidGuests(em jelly.ServiceProvider) jelly.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			user, _ := em.GetLoggedInUser(req)
+			if user.Guest {
+				time.Sleep(api.UnauthDelay)
+				res := em.Forbidden("guest %s: forbidden", user.ID)
+				res.WriteResponse(w)
+				em.LogResponse(req, res)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
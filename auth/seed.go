@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dekarrin/jelly"
+)
+
+// SeedUser returns a seed function for the jellyauth API that creates a user
+// with the given username, password, and role if no user with that username
+// exists yet. An existing user is left as it is. It is typically registered
+// with the Environment of the server under the name of the jellyauth API, for
+// profiles such as "dev" where a well-known user is wanted.
+func SeedUser(username, password string, role jelly.Role) jelly.SeedFunc {
+	return func(ctx context.Context, b jelly.Bundle) error {
+		return seedUser(ctx, b, jelly.AuthUser{Username: username, Password: password, Role: role})
+	}
+}
+
+// userFixture is a user as it is given under "users" in fixtures files.
+type userFixture struct {
+	Username   string                 `yaml:"username"`
+	Password   string                 `yaml:"password"`
+	Email      string                 `yaml:"email"`
+	Role       string                 `yaml:"role"`
+	TenantID   string                 `yaml:"tenant_id"`
+	Attributes map[string]interface{} `yaml:"attributes"`
+}
+
+func decodeUserFixture(ctx context.Context, b jelly.Bundle, decode func(v interface{}) error) error {
+	var fix userFixture
+	if err := decode(&fix); err != nil {
+		return err
+	}
+
+	if fix.Username == "" {
+		return fmt.Errorf("username: must be given")
+	}
+	if fix.Password == "" {
+		return fmt.Errorf("password: must be given")
+	}
+
+	role := jelly.Unverified
+	if fix.Role != "" {
+		var err error
+		role, err = jelly.ParseRole(fix.Role)
+		if err != nil {
+			return fmt.Errorf("role: %w", err)
+		}
+	}
+
+	schema, err := ParseAttributeSchema(b.GetSlice(ConfigKeyUserAttributes))
+	if err != nil {
+		return fmt.Errorf(ConfigKeyUserAttributes+": %w", err)
+	}
+	attrs, err := schema.Normalize(fix.Attributes)
+	if err != nil {
+		return err
+	}
+
+	return seedUser(ctx, b, jelly.AuthUser{
+		Username:   fix.Username,
+		Password:   fix.Password,
+		Email:      fix.Email,
+		Role:       role,
+		TenantID:   fix.TenantID,
+		Attributes: attrs,
+	})
+}
+
+// seedUser creates u in the auth store of the jellyauth API with bundle b if
+// no user with its username exists in its tenant. The Password of u is the
+// plaintext password.
+func seedUser(ctx context.Context, b jelly.Bundle, u jelly.AuthUser) error {
+	authStore, err := jelly.DBAs[jelly.AuthUserStore](b, 0)
+	if err != nil {
+		return err
+	}
+	svc := loginService{Provider: authStore, Events: b.Events(), EventPrefix: b.Name()}
+
+	if u.TenantID != "" {
+		ctx = jelly.WithTenant(ctx, u.TenantID)
+	}
+
+	_, err = svc.GetUserByUsername(ctx, u.Username)
+	if err == nil {
+		return nil
+	} else if !errors.Is(err, jelly.ErrNotFound) {
+		return fmt.Errorf("get user %q: %w", u.Username, err)
+	}
+
+	user, err := svc.CreateUser(ctx, u.Username, u.Password, u.Email, u.Role)
+	if err != nil {
+		return fmt.Errorf("create user %q: %w", u.Username, err)
+	}
+	if u.Attributes != nil {
+		user, err = svc.UpdateAttributes(ctx, user.ID.String(), u.Attributes)
+		if err != nil {
+			return fmt.Errorf("set attributes of user %q: %w", u.Username, err)
+		}
+	}
+	b.Logger().Infof("seeded user '%s' (%s) with role %s", user.Username, user.ID, user.Role)
+
+	return nil
+}
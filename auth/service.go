@@ -2,14 +2,18 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"net/mail"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dekarrin/jelly"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // loginService is a pre-rolled login and authentication backend service. It is
@@ -19,6 +23,45 @@ import (
 // set.
 type loginService struct {
 	Provider jelly.AuthUserStore
+
+	// LoginHistory is how long records of login attempts are kept for. If it
+	// is zero, they are kept forever.
+	LoginHistory time.Duration
+
+	// SoftDelete is whether deleting a user archives it instead of removing
+	// it. Provider's AuthUserRepo must implement jelly.ArchivingAuthUserRepo
+	// if it is set.
+	SoftDelete bool
+
+	// ArchiveRetention is how long archived users are kept for before they
+	// are removed by PurgeArchivedUsers.
+	ArchiveRetention time.Duration
+
+	// Events is the EventBus that events about the lifecycle of users are
+	// published to. If nil, no events are published.
+	Events *jelly.EventBus
+
+	// EventPrefix is the start of the type of every event that is published,
+	// which is the name of the API.
+	EventPrefix string
+
+	// Hasher hashes passwords and service account secrets. Stored hashes
+	// that it reports as needing a rehash are replaced when users log in. If
+	// nil, bcrypt with DefaultBcryptCost is used.
+	Hasher PasswordHasher
+
+	// Tokens caches the principals that recently validated tokens were issued
+	// to. Tokens of a principal are removed from it when the principal logs
+	// out or is changed. If nil, tokens are not cached.
+	Tokens *tokenCache
+}
+
+// hasher returns the PasswordHasher that svc uses.
+func (svc loginService) hasher() PasswordHasher {
+	if svc.Hasher == nil {
+		return defaultHasher
+	}
+	return svc.Hasher
 }
 
 // Login verifies the provided username and password against the existing user
@@ -40,22 +83,33 @@ func (svc loginService) Login(ctx context.Context, username string, password str
 	}
 
 	// verify password
-	bcryptHash, err := base64.StdEncoding.DecodeString(user.Password)
+	ok, err := svc.hasher().Verify(user.Password, password)
 	if err != nil {
-		return jelly.AuthUser{}, err
+		return jelly.AuthUser{}, jelly.WrapDBError(err)
+	}
+	if !ok {
+		return jelly.AuthUser{}, jelly.ErrBadCredentials
 	}
 
-	err = bcrypt.CompareHashAndPassword(bcryptHash, []byte(password))
-	if err != nil {
-		if err == bcrypt.ErrMismatchedHashAndPassword {
-			return jelly.AuthUser{}, jelly.ErrBadCredentials
+	// the password is only known now, so this is the time to move it to the
+	// current hash algorithm if it is not already using it
+	var rehashed string
+	if svc.hasher().NeedsRehash(user.Password) {
+		rehashed, err = svc.hasher().Hash(password)
+		if err != nil {
+			return jelly.AuthUser{}, err
 		}
-		return jelly.AuthUser{}, jelly.WrapDBError(err)
 	}
 
 	// successful login; update the DB
-	user.LastLogin = time.Now()
-	user, err = svc.Provider.AuthUsers().Update(ctx, user.ID, user)
+	now := time.Now()
+	oldHash := user.Password
+	user, err = svc.modifyUser(ctx, user.ID, func(u *jelly.AuthUser) {
+		u.LastLogin = now
+		if rehashed != "" && u.Password == oldHash {
+			u.Password = rehashed
+		}
+	})
 	if err != nil {
 		return jelly.AuthUser{}, jelly.WrapDBError(err, "cannot update user login time")
 	}
@@ -71,24 +125,57 @@ func (svc loginService) Login(ctx context.Context, username string, password str
 // will match jelly.ErrNotFound. If the error occured due to an unexpected
 // problem with the DB, it will match jelly.ErrDB.
 func (svc loginService) Logout(ctx context.Context, who uuid.UUID) (jelly.AuthUser, error) {
-	existing, err := svc.Provider.AuthUsers().Get(ctx, who)
+	now := time.Now()
+	updated, err := svc.modifyUser(ctx, who, func(u *jelly.AuthUser) {
+		u.LastLogout = now
+	})
 	if err != nil {
 		if errors.Is(err, jelly.ErrDBNotFound) {
 			return jelly.AuthUser{}, jelly.ErrNotFound
 		}
-		return jelly.AuthUser{}, jelly.WrapDBError(err, "could not retrieve user")
+		return jelly.AuthUser{}, jelly.WrapDBError(err, "could not update user")
 	}
+	svc.Tokens.invalidate(who)
 
-	existing.LastLogout = time.Now()
-
-	updated, err := svc.Provider.AuthUsers().Update(ctx, existing.ID, existing)
-	if err != nil {
-		return jelly.AuthUser{}, jelly.WrapDBError(err, "could not update user")
+	// tokens are already invalidated by the logout time, but the sessions
+	// they belonged to should no longer be listed
+	if sessions, err := svc.sessions(); err == nil {
+		if _, err := sessions.DeleteAllByUser(ctx, updated.ID); err != nil {
+			return jelly.AuthUser{}, jelly.WrapDBError(err, "could not delete sessions")
+		}
 	}
 
 	return updated, nil
 }
 
+// conflictRetry is the policy for retrying updates that the service makes to a
+// user on its own behalf when they conflict with a concurrent update.
+var conflictRetry = jelly.RetryPolicy{
+	InitialDelay: 10 * time.Millisecond,
+	Retryable: func(err error) bool {
+		return errors.Is(err, jelly.ErrDBConflict)
+	},
+}
+
+// modifyUser gets the user with the given ID, applies modify to it, and saves
+// it. If the user is updated by something else in between, it starts over with
+// the newer user. Returned errors are from the repo and are not wrapped.
+func (svc loginService) modifyUser(ctx context.Context, id uuid.UUID, modify func(u *jelly.AuthUser)) (jelly.AuthUser, error) {
+	repo := svc.Provider.AuthUsers()
+
+	var updated jelly.AuthUser
+	err := jelly.Retry(ctx, conflictRetry, func(ctx context.Context) error {
+		user, err := repo.Get(ctx, id)
+		if err != nil {
+			return jelly.Permanent(err)
+		}
+		modify(&user)
+		updated, err = repo.Update(ctx, id, user)
+		return err
+	})
+	return updated, err
+}
+
 // GetAllUsers returns all auth users currently in persistence.
 func (svc loginService) GetAllUsers(ctx context.Context) ([]jelly.AuthUser, error) {
 	users, err := svc.Provider.AuthUsers().GetAll(ctx)
@@ -99,6 +186,22 @@ func (svc loginService) GetAllUsers(ctx context.Context) ([]jelly.AuthUser, erro
 	return users, nil
 }
 
+// UsersLastModified returns the latest time that any user that GetAllUsers
+// would give for ctx was created, modified, or removed. ok is false if the
+// auth store does not support it; see jelly.LastModifiedRepo.
+func (svc loginService) UsersLastModified(ctx context.Context) (t time.Time, ok bool, err error) {
+	repo, ok := svc.Provider.AuthUsers().(jelly.LastModifiedRepo)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	t, err = repo.MaxModified(ctx, nil)
+	if err != nil {
+		return time.Time{}, false, jelly.WrapDBError(err)
+	}
+	return t, true, nil
+}
+
 // GetUser returns the user with the given ID.
 //
 // The returned error, if non-nil, will return true for various calls to
@@ -142,19 +245,6 @@ func (svc loginService) GetUserByUsername(ctx context.Context, username string)
 	return user, nil
 }
 
-func hashUserPass(password string) (string, error) {
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	if err != nil {
-		if err == bcrypt.ErrPasswordTooLong {
-			return "", jelly.NewError("password is too long", err, jelly.ErrBadArgument)
-		} else {
-			return "", jelly.NewError("password could not be encrypted", err)
-		}
-	}
-
-	return base64.StdEncoding.EncodeToString(passHash), nil
-}
-
 // CreateUser creates a new user with the given username, password, and email
 // combo. Returns the newly-created user as it exists after creation.
 //
@@ -186,7 +276,7 @@ func (svc loginService) CreateUser(ctx context.Context, username, password, emai
 		return jelly.AuthUser{}, jelly.WrapDBError(err)
 	}
 
-	storedPass, err := hashUserPass(password)
+	storedPass, err := svc.hasher().Hash(password)
 	if err != nil {
 		return jelly.AuthUser{}, err
 	}
@@ -206,12 +296,27 @@ func (svc loginService) CreateUser(ctx context.Context, username, password, emai
 		return jelly.AuthUser{}, jelly.WrapDBError(err, "could not create user")
 	}
 
+	svc.publishUserEvent(ctx, EventUserCreated, user)
+	return user, nil
+}
+
+// RegisterUser creates a new user for a client that is registering itself. It
+// is the same as CreateUser, except that it also publishes an
+// EventUserRegistered event about the new user.
+func (svc loginService) RegisterUser(ctx context.Context, username, password, email string, role jelly.Role) (jelly.AuthUser, error) {
+	user, err := svc.CreateUser(ctx, username, password, email, role)
+	if err != nil {
+		return jelly.AuthUser{}, err
+	}
+
+	svc.publishUserEvent(ctx, EventUserRegistered, user)
 	return user, nil
 }
 
 // UpdateUser sets the properties of the user with the given ID to the
 // properties in the given user. All the given properties of the user will
-// overwrite the existing ones. Returns the updated user.
+// overwrite the existing ones. Returns the updated user. The update fails if
+// the user is modified by another request while it is being made.
 //
 // This function cannot be used to update the password. Use UpdatePassword for
 // that.
@@ -220,10 +325,18 @@ func (svc loginService) CreateUser(ctx context.Context, username, password, emai
 // errors.Is depending on what caused the error. If a user with that username or
 // ID (if they are changing) is already present, it will match
 // jelly.ErrAlreadyExists. If no user with the given ID exists, it will match
-// jelly.ErrNotFound. If the error occured due to an unexpected problem with the
-// DB, it will match jelly.ErrDB. Finally, if one of the arguments is invalid, it
-// will match jelly.ErrBadArgument.
+// jelly.ErrNotFound. If the user was modified concurrently, it will match
+// jelly.ErrConflict. If the error occured due to an unexpected problem with the
+// DB, it will match jelly.ErrDB. Finally, if one of the arguments is invalid,
+// it will match jelly.ErrBadArgument.
 func (svc loginService) UpdateUser(ctx context.Context, curID, newID, username, email string, role jelly.Role) (jelly.AuthUser, error) {
+	return svc.UpdateUserVersioned(ctx, curID, newID, username, email, role, 0)
+}
+
+// UpdateUserVersioned is the same as UpdateUser, except that if version is
+// non-zero, the user is only updated if it is currently at that version. If it
+// is not, the returned error will match jelly.ErrConflict.
+func (svc loginService) UpdateUserVersioned(ctx context.Context, curID, newID, username, email string, role jelly.Role, version int64) (jelly.AuthUser, error) {
 	var err error
 
 	if username == "" {
@@ -252,6 +365,9 @@ func (svc loginService) UpdateUser(ctx context.Context, curID, newID, username,
 			return jelly.AuthUser{}, jelly.NewError("user not found", jelly.ErrNotFound)
 		}
 	}
+	if version != 0 && daoUser.Version != version {
+		return jelly.AuthUser{}, jelly.NewError("user is not at the expected version", jelly.ErrConflict)
+	}
 
 	if curID != newID {
 		_, err := svc.Provider.AuthUsers().Get(ctx, uuidNewID)
@@ -281,10 +397,25 @@ func (svc loginService) UpdateUser(ctx context.Context, curID, newID, username,
 			return jelly.AuthUser{}, jelly.NewError("a user with that ID/username already exists", jelly.ErrAlreadyExists)
 		} else if errors.Is(err, jelly.ErrDBNotFound) {
 			return jelly.AuthUser{}, jelly.NewError("user not found", jelly.ErrNotFound)
+		} else if errors.Is(err, jelly.ErrDBConflict) {
+			return jelly.AuthUser{}, jelly.NewError("user was modified by another request", jelly.ErrConflict)
 		}
 		return jelly.AuthUser{}, jelly.WrapDBError(err)
 	}
 
+	// tokens name the user by ID, so ones for the old ID must not be accepted
+	// from the cache
+	svc.Tokens.invalidate(uuidCurID)
+
+	// two-factor authentication is keyed by user ID, so it must follow the
+	// user to their new one
+	if curID != newID {
+		if err := svc.moveTwoFactor(ctx, uuidCurID, uuidNewID); err != nil {
+			return jelly.AuthUser{}, err
+		}
+	}
+
+	svc.publishUserEvent(ctx, EventUserUpdated, updatedUser)
 	return updatedUser, nil
 }
 
@@ -293,9 +424,11 @@ func (svc loginService) UpdateUser(ctx context.Context, curID, newID, username,
 //
 // The returned error, if non-nil, will return true for various calls to
 // errors.Is depending on what caused the error. If no user with the given ID
-// exists, it will match jelly.ErrNotFound. If the error occured due to an
-// unexpected problem with the DB, it will match jelly.ErrDB. Finally, if one of
-// the arguments is invalid, it will match jelly.ErrBadArgument.
+// exists, it will match jelly.ErrNotFound. If the user was modified by another
+// request while it was being updated, it will match jelly.ErrConflict. If the
+// error occured due to an unexpected problem with the DB, it will match
+// jelly.ErrDB. Finally, if one of the arguments is invalid, it will match
+// jelly.ErrBadArgument.
 func (svc loginService) UpdatePassword(ctx context.Context, id, password string) (jelly.AuthUser, error) {
 	if password == "" {
 		return jelly.AuthUser{}, jelly.NewError("password cannot be empty", jelly.ErrBadArgument)
@@ -313,32 +446,72 @@ func (svc loginService) UpdatePassword(ctx context.Context, id, password string)
 		return jelly.AuthUser{}, jelly.WrapDBError(err)
 	}
 
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	storedPass, err := svc.hasher().Hash(password)
+	if err != nil {
+		return jelly.AuthUser{}, err
+	}
+
+	existing.Password = storedPass
+
+	updated, err := svc.Provider.AuthUsers().Update(ctx, uuidID, existing)
 	if err != nil {
-		if err == bcrypt.ErrPasswordTooLong {
-			return jelly.AuthUser{}, jelly.NewError("password is too long", err, jelly.ErrBadArgument)
-		} else {
-			return jelly.AuthUser{}, jelly.NewError("password could not be encrypted", err)
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.AuthUser{}, jelly.NewError("no user with that ID exists", jelly.ErrNotFound)
+		} else if errors.Is(err, jelly.ErrDBConflict) {
+			return jelly.AuthUser{}, jelly.NewError("user was modified by another request", jelly.ErrConflict)
 		}
+		return jelly.AuthUser{}, jelly.WrapDBError(err, "could not update user")
 	}
 
-	storedPass := base64.StdEncoding.EncodeToString(passHash)
+	svc.publishUserEvent(ctx, EventUserPasswordChanged, updated)
+	return updated, nil
+}
 
-	existing.Password = storedPass
+// UpdateAttributes sets the attributes of the user with the given ID to attrs,
+// replacing all existing attributes. The attributes are stored as given; it is
+// up to the caller to check them against the schema. Returns the updated user.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If no user with the given ID
+// exists, it will match jelly.ErrNotFound. If the user was modified by another
+// request while it was being updated, it will match jelly.ErrConflict. If the
+// error occured due to an unexpected problem with the DB, it will match
+// jelly.ErrDB. Finally, if one of the arguments is invalid, it will match
+// jelly.ErrBadArgument.
+func (svc loginService) UpdateAttributes(ctx context.Context, id string, attrs map[string]interface{}) (jelly.AuthUser, error) {
+	uuidID, err := uuid.Parse(id)
+	if err != nil {
+		return jelly.AuthUser{}, jelly.NewError("ID is not valid", jelly.ErrBadArgument)
+	}
+
+	existing, err := svc.Provider.AuthUsers().Get(ctx, uuidID)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.AuthUser{}, jelly.NewError("no user with that ID exists", jelly.ErrNotFound)
+		}
+		return jelly.AuthUser{}, jelly.WrapDBError(err)
+	}
+
+	existing.Attributes = attrs
 
 	updated, err := svc.Provider.AuthUsers().Update(ctx, uuidID, existing)
 	if err != nil {
 		if errors.Is(err, jelly.ErrDBNotFound) {
 			return jelly.AuthUser{}, jelly.NewError("no user with that ID exists", jelly.ErrNotFound)
+		} else if errors.Is(err, jelly.ErrDBConflict) {
+			return jelly.AuthUser{}, jelly.NewError("user was modified by another request", jelly.ErrConflict)
 		}
 		return jelly.AuthUser{}, jelly.WrapDBError(err, "could not update user")
 	}
 
+	svc.publishUserEvent(ctx, EventUserUpdated, updated)
 	return updated, nil
 }
 
 // DeleteUser deletes the user with the given ID. It returns the deleted user
-// just after they were deleted.
+// just after they were deleted. If soft-deletion is enabled, the user is
+// archived instead and their sessions are ended, but their other data is kept
+// so that they can be restored with RestoreUser.
 //
 // The returned error, if non-nil, will return true for various calls to
 // errors.Is depending on what caused the error. If no user with that username
@@ -351,6 +524,10 @@ func (svc loginService) DeleteUser(ctx context.Context, id string) (jelly.AuthUs
 		return jelly.AuthUser{}, jelly.NewError("ID is not valid", jelly.ErrBadArgument)
 	}
 
+	if svc.SoftDelete {
+		return svc.archiveUser(ctx, uuidID)
+	}
+
 	user, err := svc.Provider.AuthUsers().Delete(ctx, uuidID)
 	if err != nil {
 		if errors.Is(err, jelly.ErrDBNotFound) {
@@ -359,5 +536,1374 @@ func (svc loginService) DeleteUser(ctx context.Context, id string) (jelly.AuthUs
 		return jelly.AuthUser{}, jelly.WrapDBError(err, "could not delete user")
 	}
 
+	if err := svc.deleteUserData(ctx, user.ID); err != nil {
+		return jelly.AuthUser{}, err
+	}
+
+	svc.publishUserEvent(ctx, EventUserDeleted, user)
+	return user, nil
+}
+
+// deleteUserData removes the sessions and two-factor authentication of the
+// user with the given ID.
+func (svc loginService) deleteUserData(ctx context.Context, userID uuid.UUID) error {
+	if sessions, err := svc.sessions(); err == nil {
+		if _, err := sessions.DeleteAllByUser(ctx, userID); err != nil {
+			return jelly.WrapDBError(err, "could not delete sessions")
+		}
+	}
+	if twoFactors, err := svc.twoFactors(); err == nil {
+		if _, err := twoFactors.Delete(ctx, userID); err != nil && !errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.WrapDBError(err, "could not delete two-factor authentication")
+		}
+	}
+
+	return nil
+}
+
+// userChanges is the changes to make to a single user in a call to
+// UpdateUsers. Properties that are nil are left as they are.
+type userChanges struct {
+	ID uuid.UUID
+
+	// Version is the version that the user must be at for the changes to be
+	// made. If zero, the user may be at any version.
+	Version int64
+
+	Username *string
+	Email    *string
+	Role     *jelly.Role
+	Password *string
+
+	// SetAttributes are attributes to set on the user. They are stored as
+	// given; it is up to the caller to check them against the schema.
+	SetAttributes map[string]interface{}
+
+	// RemoveAttributes are the names of attributes to remove from the user.
+	RemoveAttributes []string
+}
+
+// CreateUsers creates many users at once. The Username, Password, Email, Role,
+// TenantID, and Attributes of each given user are used, with Password being the
+// plaintext password. Users with no TenantID are created in the tenant of ctx,
+// if there is one. Returns the newly-created users as they exist after
+// creation, in the same order they were given in.
+//
+// Each user is created independently of the others. If any of them could not
+// be created, the returned error is a jelly.BatchError that has the error of
+// each one that failed, and the returned user for each of those is the zero
+// value. Each error matches the same errors as one returned by CreateUser
+// would.
+func (svc loginService) CreateUsers(ctx context.Context, users []jelly.AuthUser) ([]jelly.AuthUser, error) {
+	errs := make([]error, len(users))
+
+	passwords := make([]string, len(users))
+	for i := range users {
+		passwords[i] = users[i].Password
+	}
+	hashes, hashErrs := hashUserPasses(svc.hasher(), passwords)
+
+	for i := range users {
+		if users[i].Password == "" {
+			errs[i] = jelly.NewError("password cannot be blank", jelly.ErrBadArgument)
+		} else if hashErrs[i] != nil {
+			errs[i] = hashErrs[i]
+		}
+	}
+
+	return svc.createUsers(ctx, users, hashes, errs)
+}
+
+// importedUser is a user to be created by ImportUsers.
+type importedUser struct {
+	jelly.AuthUser
+
+	// PasswordHash is the already-hashed password of the user. If set, it is
+	// stored as-is and Password is ignored.
+	PasswordHash string
+}
+
+// ImportUsers creates many users at once from the records of another system,
+// such as those given by an export of users from jellyauth. It is the same as
+// CreateUsers, except that each user that has a PasswordHash is created with
+// that hash instead of a hash of their Password, so that users can be moved
+// between systems without knowing their passwords.
+//
+// A given hash must either be in the current format of the PasswordHasher of
+// svc or be in a format that VerifyPassword accepts. Hashes that are not in
+// the current format are replaced the next time that the user logs in.
+func (svc loginService) ImportUsers(ctx context.Context, users []importedUser) ([]jelly.AuthUser, error) {
+	errs := make([]error, len(users))
+	hasher := svc.hasher()
+
+	toCreate := make([]jelly.AuthUser, len(users))
+	passwords := make([]string, len(users))
+	for i := range users {
+		toCreate[i] = users[i].AuthUser
+		if users[i].PasswordHash == "" {
+			passwords[i] = users[i].Password
+		}
+	}
+	hashes, hashErrs := hashUserPasses(hasher, passwords)
+
+	for i, u := range users {
+		if u.PasswordHash != "" {
+			if hasher.NeedsRehash(u.PasswordHash) {
+				if err := checkHashFormat(u.PasswordHash); err != nil {
+					errs[i] = jelly.NewError("password hash is not valid", err, jelly.ErrBadArgument)
+					continue
+				}
+			}
+			hashes[i] = u.PasswordHash
+		} else if u.Password == "" {
+			errs[i] = jelly.NewError("password cannot be blank", jelly.ErrBadArgument)
+		} else if hashErrs[i] != nil {
+			errs[i] = hashErrs[i]
+		}
+	}
+
+	return svc.createUsers(ctx, toCreate, hashes, errs)
+}
+
+// createUsers creates each of the given users that does not already have an
+// error in errs, with the password hash at the same index in hashes. The
+// Password of each user is ignored. Errors are added to errs for users that
+// could not be created, and the returned error is a jelly.BatchError of all of
+// them.
+func (svc loginService) createUsers(ctx context.Context, users []jelly.AuthUser, hashes []string, errs []error) ([]jelly.AuthUser, error) {
+	created := make([]jelly.AuthUser, len(users))
+
+	var toCreate []jelly.AuthUser
+	var indexes []int
+	for i, u := range users {
+		if u.Username == "" {
+			errs[i] = jelly.NewError("username cannot be blank", jelly.ErrBadArgument)
+			continue
+		}
+		if errs[i] != nil {
+			continue
+		}
+		if u.Email != "" {
+			if _, err := mail.ParseAddress(u.Email); err != nil {
+				errs[i] = jelly.NewError("email is not valid", err, jelly.ErrBadArgument)
+				continue
+			}
+		}
+
+		toCreate = append(toCreate, jelly.AuthUser{
+			Username:   u.Username,
+			Password:   hashes[i],
+			Email:      u.Email,
+			Role:       u.Role,
+			TenantID:   u.TenantID,
+			Attributes: u.Attributes,
+		})
+		indexes = append(indexes, i)
+	}
+
+	if len(toCreate) > 0 {
+		results, err := svc.batchUsers().CreateMany(ctx, toCreate)
+		itemErrs, err := batchItemErrors(err, len(toCreate))
+		if err != nil {
+			return nil, jelly.WrapDBError(err, "could not create users")
+		}
+		for j, i := range indexes {
+			if itemErrs[j] != nil {
+				if errors.Is(itemErrs[j], jelly.ErrDBConstraintViolation) {
+					errs[i] = jelly.NewError("a user with that username already exists", jelly.ErrAlreadyExists)
+				} else {
+					errs[i] = jelly.WrapDBError(itemErrs[j], "could not create user")
+				}
+				continue
+			}
+			created[i] = results[j]
+			svc.publishUserEvent(ctx, EventUserCreated, created[i])
+		}
+	}
+
+	return created, jelly.NewBatchError(errs)
+}
+
+// UpdateUsers makes changes to many users at once. Returns the updated users,
+// in the same order that the changes were given in. The IDs of users cannot
+// be changed by UpdateUsers.
+//
+// Each user is updated independently of the others. If any of them could not
+// be updated, the returned error is a jelly.BatchError that has the error of
+// each one that failed, and the returned user for each of those is the zero
+// value. Each error matches the same errors as one returned by UpdateUser
+// would.
+func (svc loginService) UpdateUsers(ctx context.Context, changes []userChanges) ([]jelly.AuthUser, error) {
+	updated := make([]jelly.AuthUser, len(changes))
+	errs := make([]error, len(changes))
+
+	passwords := make([]string, len(changes))
+	for i := range changes {
+		if changes[i].Password != nil {
+			if *changes[i].Password == "" {
+				errs[i] = jelly.NewError("password cannot be empty", jelly.ErrBadArgument)
+				continue
+			}
+			passwords[i] = *changes[i].Password
+		}
+	}
+	hashes, hashErrs := hashUserPasses(svc.hasher(), passwords)
+
+	var toUpdate []jelly.AuthUser
+	var indexes []int
+	for i, ch := range changes {
+		if errs[i] != nil {
+			continue
+		}
+
+		u, err := svc.Provider.AuthUsers().Get(ctx, ch.ID)
+		if err != nil {
+			if errors.Is(err, jelly.ErrDBNotFound) {
+				errs[i] = jelly.NewError("user not found", jelly.ErrNotFound)
+			} else {
+				errs[i] = jelly.WrapDBError(err)
+			}
+			continue
+		}
+		if ch.Version != 0 && u.Version != ch.Version {
+			errs[i] = jelly.NewError("user is not at the expected version", jelly.ErrConflict)
+			continue
+		}
+
+		if ch.Username != nil {
+			if *ch.Username == "" {
+				errs[i] = jelly.NewError("username cannot be blank", jelly.ErrBadArgument)
+				continue
+			}
+			u.Username = *ch.Username
+		}
+		if ch.Email != nil {
+			if *ch.Email != "" {
+				if _, err := mail.ParseAddress(*ch.Email); err != nil {
+					errs[i] = jelly.NewError("email is not valid", err, jelly.ErrBadArgument)
+					continue
+				}
+			}
+			u.Email = *ch.Email
+		}
+		if ch.Role != nil {
+			u.Role = *ch.Role
+		}
+		if ch.Password != nil {
+			if hashErrs[i] != nil {
+				errs[i] = hashErrs[i]
+				continue
+			}
+			u.Password = hashes[i]
+		}
+		if ch.SetAttributes != nil || ch.RemoveAttributes != nil {
+			attrs := map[string]interface{}{}
+			for name, v := range u.Attributes {
+				attrs[name] = v
+			}
+			for _, name := range ch.RemoveAttributes {
+				delete(attrs, name)
+			}
+			for name, v := range ch.SetAttributes {
+				attrs[name] = v
+			}
+			u.Attributes = attrs
+		}
+
+		toUpdate = append(toUpdate, u)
+		indexes = append(indexes, i)
+	}
+
+	if len(toUpdate) > 0 {
+		results, err := svc.batchUsers().UpdateMany(ctx, toUpdate)
+		itemErrs, err := batchItemErrors(err, len(toUpdate))
+		if err != nil {
+			return nil, jelly.WrapDBError(err, "could not update users")
+		}
+		for j, i := range indexes {
+			if itemErrs[j] != nil {
+				if errors.Is(itemErrs[j], jelly.ErrDBConstraintViolation) {
+					errs[i] = jelly.NewError("a user with that username already exists", jelly.ErrAlreadyExists)
+				} else if errors.Is(itemErrs[j], jelly.ErrDBNotFound) {
+					errs[i] = jelly.NewError("user not found", jelly.ErrNotFound)
+				} else if errors.Is(itemErrs[j], jelly.ErrDBConflict) {
+					errs[i] = jelly.NewError("user was modified by another request", jelly.ErrConflict)
+				} else {
+					errs[i] = jelly.WrapDBError(itemErrs[j], "could not update user")
+				}
+				continue
+			}
+			updated[i] = results[j]
+			svc.publishUserEvent(ctx, EventUserUpdated, updated[i])
+		}
+	}
+
+	return updated, jelly.NewBatchError(errs)
+}
+
+// DeleteUsers deletes many users at once, as with DeleteUser. It returns the
+// deleted users just after they were deleted, in the same order that their IDs
+// were given in.
+//
+// Each user is deleted independently of the others. If any of them could not
+// be deleted, the returned error is a jelly.BatchError that has the error of
+// each one that failed, and the returned user for each of those is the zero
+// value. Each error matches the same errors as one returned by DeleteUser
+// would.
+func (svc loginService) DeleteUsers(ctx context.Context, ids []uuid.UUID) ([]jelly.AuthUser, error) {
+	deleted := make([]jelly.AuthUser, len(ids))
+	errs := make([]error, len(ids))
+
+	if svc.SoftDelete {
+		// archiving is not batched, but is cheap compared to the rest of
+		// deletion
+		for i := range ids {
+			deleted[i], errs[i] = svc.archiveUser(ctx, ids[i])
+		}
+		return deleted, jelly.NewBatchError(errs)
+	}
+
+	results, err := svc.batchUsers().DeleteMany(ctx, ids)
+	itemErrs, err := batchItemErrors(err, len(ids))
+	if err != nil {
+		return nil, jelly.WrapDBError(err, "could not delete users")
+	}
+	for i := range ids {
+		if itemErrs[i] != nil {
+			if errors.Is(itemErrs[i], jelly.ErrDBNotFound) {
+				errs[i] = jelly.ErrNotFound
+			} else {
+				errs[i] = jelly.WrapDBError(itemErrs[i], "could not delete user")
+			}
+			continue
+		}
+		if err := svc.deleteUserData(ctx, results[i].ID); err != nil {
+			errs[i] = err
+			continue
+		}
+		deleted[i] = results[i]
+		svc.publishUserEvent(ctx, EventUserDeleted, deleted[i])
+	}
+
+	return deleted, jelly.NewBatchError(errs)
+}
+
+// batchUsers returns the repo of users from the provider as a
+// jelly.BatchAuthUserRepo. If the repo does not support batches, the returned
+// repo processes each item of a batch one at a time.
+func (svc loginService) batchUsers() jelly.BatchAuthUserRepo {
+	repo := svc.Provider.AuthUsers()
+	if batchRepo, ok := repo.(jelly.BatchAuthUserRepo); ok {
+		return batchRepo
+	}
+	return unbatchedUsers{repo}
+}
+
+// batchItemErrors gives the error of each of the count items of a batch that
+// resulted in err. If err is not a jelly.BatchError, the batch as a whole
+// failed and err is returned.
+func batchItemErrors(err error, count int) ([]error, error) {
+	if err == nil {
+		return make([]error, count), nil
+	}
+	var batchErr jelly.BatchError
+	if errors.As(err, &batchErr) && len(batchErr.Errors) == count {
+		return batchErr.Errors, nil
+	}
+	return nil, err
+}
+
+// hashUserPasses hashes each of the given passwords with hasher, in parallel
+// as hashing is slow. Empty passwords are not hashed and are given as empty
+// hashes.
+func hashUserPasses(hasher PasswordHasher, passwords []string) ([]string, []error) {
+	hashes := make([]string, len(passwords))
+	errs := make([]error, len(passwords))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				hashes[i], errs[i] = hasher.Hash(passwords[i])
+			}
+		}()
+	}
+	for i := range passwords {
+		if passwords[i] != "" {
+			next <- i
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	return hashes, errs
+}
+
+// unbatchedUsers is a jelly.BatchAuthUserRepo that processes each item of a
+// batch one at a time with a repo that does not support batches.
+type unbatchedUsers struct {
+	jelly.AuthUserRepo
+}
+
+func (repo unbatchedUsers) CreateMany(ctx context.Context, users []jelly.AuthUser) ([]jelly.AuthUser, error) {
+	created := make([]jelly.AuthUser, len(users))
+	errs := make([]error, len(users))
+	for i := range users {
+		created[i], errs[i] = repo.Create(ctx, users[i])
+	}
+	return created, jelly.NewBatchError(errs)
+}
+
+func (repo unbatchedUsers) UpdateMany(ctx context.Context, users []jelly.AuthUser) ([]jelly.AuthUser, error) {
+	updated := make([]jelly.AuthUser, len(users))
+	errs := make([]error, len(users))
+	for i := range users {
+		updated[i], errs[i] = repo.Update(ctx, users[i].ID, users[i])
+	}
+	return updated, jelly.NewBatchError(errs)
+}
+
+func (repo unbatchedUsers) DeleteMany(ctx context.Context, ids []uuid.UUID) ([]jelly.AuthUser, error) {
+	deleted := make([]jelly.AuthUser, len(ids))
+	errs := make([]error, len(ids))
+	for i := range ids {
+		deleted[i], errs[i] = repo.Delete(ctx, ids[i])
+	}
+	return deleted, jelly.NewBatchError(errs)
+}
+
+// archivingUsers returns the repo of users from the provider if it supports
+// archiving. If it does not, an error matching jelly.ErrNotFound is returned.
+func (svc loginService) archivingUsers() (jelly.ArchivingAuthUserRepo, error) {
+	repo, ok := svc.Provider.AuthUsers().(jelly.ArchivingAuthUserRepo)
+	if !ok {
+		return nil, jelly.NewError("archiving users is not supported by the auth store", jelly.ErrNotFound)
+	}
+	return repo, nil
+}
+
+// archiveUser archives the user with the given ID and ends all of its
+// sessions.
+func (svc loginService) archiveUser(ctx context.Context, id uuid.UUID) (jelly.AuthUser, error) {
+	repo, err := svc.archivingUsers()
+	if err != nil {
+		return jelly.AuthUser{}, err
+	}
+
+	user, err := repo.Archive(ctx, id)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.AuthUser{}, jelly.ErrNotFound
+		}
+		return jelly.AuthUser{}, jelly.WrapDBError(err, "could not archive user")
+	}
+
+	if sessions, err := svc.sessions(); err == nil {
+		if _, err := sessions.DeleteAllByUser(ctx, user.ID); err != nil {
+			return jelly.AuthUser{}, jelly.WrapDBError(err, "could not delete sessions")
+		}
+	}
+
+	svc.publishUserEvent(ctx, EventUserArchived, user)
+	return user, nil
+}
+
+// RestoreUser restores the archived user with the given ID so that it can be
+// used again.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If no archived user with that
+// ID exists or archiving is not supported by the auth store, it will match
+// jelly.ErrNotFound. If the error occured due to an unexpected problem with
+// the DB, it will match jelly.ErrDB. Finally, if there is an issue with one of
+// the arguments, it will match jelly.ErrBadArgument.
+func (svc loginService) RestoreUser(ctx context.Context, id string) (jelly.AuthUser, error) {
+	uuidID, err := uuid.Parse(id)
+	if err != nil {
+		return jelly.AuthUser{}, jelly.NewError("ID is not valid", jelly.ErrBadArgument)
+	}
+
+	repo, err := svc.archivingUsers()
+	if err != nil {
+		return jelly.AuthUser{}, err
+	}
+
+	user, err := repo.Restore(ctx, uuidID)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.AuthUser{}, jelly.ErrNotFound
+		}
+		return jelly.AuthUser{}, jelly.WrapDBError(err, "could not restore user")
+	}
+
+	svc.publishUserEvent(ctx, EventUserRestored, user)
 	return user, nil
 }
+
+// PurgeArchivedUsers permanently deletes all users that were archived longer
+// ago than the archive retention, along with their remaining data. It returns
+// the users that were deleted.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If archiving is not supported
+// by the auth store, it will match jelly.ErrNotFound. If the error occured due
+// to an unexpected problem with the DB, it will match jelly.ErrDB.
+func (svc loginService) PurgeArchivedUsers(ctx context.Context) ([]jelly.AuthUser, error) {
+	repo, err := svc.archivingUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := repo.DeleteArchivedBefore(ctx, time.Now().Add(-svc.ArchiveRetention))
+	if err != nil {
+		return deleted, jelly.WrapDBError(err, "could not delete archived users")
+	}
+
+	for _, user := range deleted {
+		if err := svc.deleteUserData(ctx, user.ID); err != nil {
+			return deleted, err
+		}
+		svc.publishUserEvent(ctx, EventUserDeleted, user)
+	}
+
+	return deleted, nil
+}
+
+// serviceAccounts returns the repo of service accounts from the provider. If
+// the provider does not support them, an error matching jelly.ErrNotFound is
+// returned.
+func (svc loginService) serviceAccounts() (jelly.ServiceAccountRepo, error) {
+	saStore, ok := svc.Provider.(jelly.ServiceAccountStore)
+	if !ok {
+		return nil, jelly.NewError("service accounts are not supported by the auth store", jelly.ErrNotFound)
+	}
+	return saStore.ServiceAccounts(), nil
+}
+
+// generateServiceAccountSecret generates a new random secret for a service
+// account.
+func generateServiceAccountSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", jelly.NewError("could not generate secret", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// validateScopes checks that all given scopes are valid. A scope must not be
+// empty and must not contain whitespace.
+func validateScopes(scopes []string) error {
+	for _, sc := range scopes {
+		if sc == "" {
+			return jelly.NewError("scope cannot be blank", jelly.ErrBadArgument)
+		}
+		if strings.ContainsAny(sc, " \t\r\n") {
+			return jelly.NewError("scope '"+sc+"' cannot contain whitespace", jelly.ErrBadArgument)
+		}
+	}
+	return nil
+}
+
+// GetAllServiceAccounts returns all service accounts currently in persistence.
+func (svc loginService) GetAllServiceAccounts(ctx context.Context) ([]jelly.ServiceAccount, error) {
+	repo, err := svc.serviceAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := repo.GetAll(ctx)
+	if err != nil {
+		return nil, jelly.WrapDBError(err)
+	}
+
+	return accounts, nil
+}
+
+// GetServiceAccount returns the service account with the given ID.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If no service account with
+// that ID exists, it will match jelly.ErrNotFound. If the error occured due to
+// an unexpected problem with the DB, it will match jelly.ErrDB. Finally, if
+// there is an issue with one of the arguments, it will match
+// jelly.ErrBadArgument.
+func (svc loginService) GetServiceAccount(ctx context.Context, id string) (jelly.ServiceAccount, error) {
+	uuidID, err := uuid.Parse(id)
+	if err != nil {
+		return jelly.ServiceAccount{}, jelly.NewError("ID is not valid", jelly.ErrBadArgument)
+	}
+
+	repo, err := svc.serviceAccounts()
+	if err != nil {
+		return jelly.ServiceAccount{}, err
+	}
+
+	sa, err := repo.Get(ctx, uuidID)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.ServiceAccount{}, jelly.ErrNotFound
+		}
+		return jelly.ServiceAccount{}, jelly.WrapDBError(err, "could not get service account")
+	}
+
+	return sa, nil
+}
+
+// CreateServiceAccount creates a new service account with the given name,
+// description, and scopes. Returns the newly-created service account as it
+// exists after creation along with its secret. The secret is not stored in
+// plaintext, so it is not possible to retrieve it again later.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If a service account with
+// that name is already present, it will match jelly.ErrAlreadyExists. If the
+// error occured due to an unexpected problem with the DB, it will match
+// jelly.ErrDB. Finally, if one of the arguments is invalid, it will match
+// jelly.ErrBadArgument.
+func (svc loginService) CreateServiceAccount(ctx context.Context, name, description string, scopes []string) (jelly.ServiceAccount, string, error) {
+	if name == "" {
+		return jelly.ServiceAccount{}, "", jelly.NewError("name cannot be blank", jelly.ErrBadArgument)
+	}
+	if err := validateScopes(scopes); err != nil {
+		return jelly.ServiceAccount{}, "", err
+	}
+
+	repo, err := svc.serviceAccounts()
+	if err != nil {
+		return jelly.ServiceAccount{}, "", err
+	}
+
+	_, err = repo.GetByName(ctx, name)
+	if err == nil {
+		return jelly.ServiceAccount{}, "", jelly.NewError("a service account with that name already exists", jelly.ErrAlreadyExists)
+	} else if !errors.Is(err, jelly.ErrDBNotFound) {
+		return jelly.ServiceAccount{}, "", jelly.WrapDBError(err)
+	}
+
+	secret, err := generateServiceAccountSecret()
+	if err != nil {
+		return jelly.ServiceAccount{}, "", err
+	}
+	storedSecret, err := svc.hasher().Hash(secret)
+	if err != nil {
+		return jelly.ServiceAccount{}, "", err
+	}
+
+	newSA := jelly.ServiceAccount{
+		Name:        name,
+		Description: description,
+		Secret:      storedSecret,
+		Scopes:      scopes,
+	}
+
+	sa, err := repo.Create(ctx, newSA)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBConstraintViolation) {
+			return jelly.ServiceAccount{}, "", jelly.ErrAlreadyExists
+		}
+		return jelly.ServiceAccount{}, "", jelly.WrapDBError(err, "could not create service account")
+	}
+
+	return sa, secret, nil
+}
+
+// RotateServiceAccountSecret replaces the secret of the service account with
+// the given ID with a newly-generated one. All tokens issued to the service
+// account before the rotation become invalid. Returns the updated service
+// account and its new secret.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If no service account with
+// the given ID exists, it will match jelly.ErrNotFound. If the error occured
+// due to an unexpected problem with the DB, it will match jelly.ErrDB.
+// Finally, if one of the arguments is invalid, it will match
+// jelly.ErrBadArgument.
+func (svc loginService) RotateServiceAccountSecret(ctx context.Context, id string) (jelly.ServiceAccount, string, error) {
+	existing, err := svc.GetServiceAccount(ctx, id)
+	if err != nil {
+		return jelly.ServiceAccount{}, "", err
+	}
+
+	repo, err := svc.serviceAccounts()
+	if err != nil {
+		return jelly.ServiceAccount{}, "", err
+	}
+
+	secret, err := generateServiceAccountSecret()
+	if err != nil {
+		return jelly.ServiceAccount{}, "", err
+	}
+	existing.Secret, err = svc.hasher().Hash(secret)
+	if err != nil {
+		return jelly.ServiceAccount{}, "", err
+	}
+
+	updated, err := repo.Update(ctx, existing.ID, existing)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.ServiceAccount{}, "", jelly.NewError("no service account with that ID exists", jelly.ErrNotFound)
+		}
+		return jelly.ServiceAccount{}, "", jelly.WrapDBError(err, "could not update service account")
+	}
+	svc.Tokens.invalidate(updated.ID)
+
+	return updated, secret, nil
+}
+
+// DeleteServiceAccount deletes the service account with the given ID. It
+// returns the deleted service account just after it was deleted.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If no service account with
+// that ID exists, it will match jelly.ErrNotFound. If the error occured due to
+// an unexpected problem with the DB, it will match jelly.ErrDB. Finally, if
+// there is an issue with one of the arguments, it will match
+// jelly.ErrBadArgument.
+func (svc loginService) DeleteServiceAccount(ctx context.Context, id string) (jelly.ServiceAccount, error) {
+	uuidID, err := uuid.Parse(id)
+	if err != nil {
+		return jelly.ServiceAccount{}, jelly.NewError("ID is not valid", jelly.ErrBadArgument)
+	}
+
+	repo, err := svc.serviceAccounts()
+	if err != nil {
+		return jelly.ServiceAccount{}, err
+	}
+
+	sa, err := repo.Delete(ctx, uuidID)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.ServiceAccount{}, jelly.ErrNotFound
+		}
+		return jelly.ServiceAccount{}, jelly.WrapDBError(err, "could not delete service account")
+	}
+	svc.Tokens.invalidate(uuidID)
+
+	return sa, nil
+}
+
+// ExchangeServiceAccountSecret verifies the provided secret against the
+// service account with the given ID and returns that service account along
+// with the scopes that a token issued to it should be limited to. If scopes
+// is empty, all scopes of the service account are granted; otherwise, each
+// requested scope must be one the service account has.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If the ID does not match a
+// service account or if the secret is incorrect, it will match
+// jelly.ErrBadCredentials. If a requested scope is not granted to the
+// service account, it will match jelly.ErrPermissions. If the error occured
+// due to an unexpected problem with the DB, it will match jelly.ErrDB.
+func (svc loginService) ExchangeServiceAccountSecret(ctx context.Context, id, secret string, scopes []string) (jelly.ServiceAccount, []string, error) {
+	uuidID, err := uuid.Parse(id)
+	if err != nil {
+		return jelly.ServiceAccount{}, nil, jelly.ErrBadCredentials
+	}
+
+	repo, err := svc.serviceAccounts()
+	if err != nil {
+		return jelly.ServiceAccount{}, nil, err
+	}
+
+	sa, err := repo.Get(ctx, uuidID)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.ServiceAccount{}, nil, jelly.ErrBadCredentials
+		}
+		return jelly.ServiceAccount{}, nil, jelly.WrapDBError(err)
+	}
+
+	ok, err := svc.hasher().Verify(sa.Secret, secret)
+	if err != nil {
+		return jelly.ServiceAccount{}, nil, jelly.WrapDBError(err)
+	}
+	if !ok {
+		return jelly.ServiceAccount{}, nil, jelly.ErrBadCredentials
+	}
+
+	granted := sa.Scopes
+	if len(scopes) > 0 {
+		// Scopes must be non-nil or HasScopes treats it as unscoped
+		saPrincipal := jelly.AuthUser{Scopes: append([]string{}, sa.Scopes...)}
+		for _, sc := range scopes {
+			if !saPrincipal.HasScopes(sc) {
+				return jelly.ServiceAccount{}, nil, jelly.NewError("service account does not have scope '"+sc+"'", jelly.ErrPermissions)
+			}
+		}
+		granted = scopes
+	}
+
+	sa.LastUsed = time.Now()
+	sa, err = repo.Update(ctx, sa.ID, sa)
+	if err != nil {
+		return jelly.ServiceAccount{}, nil, jelly.WrapDBError(err, "cannot update service account last use time")
+	}
+
+	return sa, granted, nil
+}
+
+// sessionStore returns the SessionStore of the provider. If the provider does
+// not support sessions, an error matching jelly.ErrNotFound is returned.
+func (svc loginService) sessionStore() (jelly.SessionStore, error) {
+	st, ok := svc.Provider.(jelly.SessionStore)
+	if !ok {
+		return nil, jelly.NewError("sessions are not supported by the auth store", jelly.ErrNotFound)
+	}
+	return st, nil
+}
+
+// sessions returns the repo of sessions from the provider. If the provider
+// does not support them, an error matching jelly.ErrNotFound is returned.
+func (svc loginService) sessions() (jelly.SessionRepo, error) {
+	st, err := svc.sessionStore()
+	if err != nil {
+		return nil, err
+	}
+	return st.Sessions(), nil
+}
+
+// StartSession starts a new session for the user with the given ID that
+// expires after lifetime. The IP address and user agent of the client that
+// logged in are recorded with it.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If sessions are not supported
+// by the auth store, it will match jelly.ErrNotFound. If the error occured due
+// to an unexpected problem with the DB, it will match jelly.ErrDB.
+func (svc loginService) StartSession(ctx context.Context, userID uuid.UUID, ip, userAgent string, lifetime time.Duration) (jelly.Session, error) {
+	sessions, err := svc.sessions()
+	if err != nil {
+		return jelly.Session{}, err
+	}
+
+	sess := jelly.Session{
+		UserID:    userID,
+		IP:        ip,
+		UserAgent: userAgent,
+		Expires:   time.Now().Add(lifetime),
+	}
+
+	sess, err = sessions.Create(ctx, sess)
+	if err != nil {
+		return jelly.Session{}, jelly.WrapDBError(err, "could not create session")
+	}
+
+	return sess, nil
+}
+
+// ExtendSession sets the session with the given ID to expire after lifetime
+// from now. Returns the updated session.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If the session does not exist
+// or sessions are not supported by the auth store, it will match
+// jelly.ErrNotFound. If the error occured due to an unexpected problem with
+// the DB, it will match jelly.ErrDB.
+func (svc loginService) ExtendSession(ctx context.Context, id uuid.UUID, lifetime time.Duration) (jelly.Session, error) {
+	sessions, err := svc.sessions()
+	if err != nil {
+		return jelly.Session{}, err
+	}
+
+	sess, err := sessions.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.Session{}, jelly.NewError("no session with that ID exists", jelly.ErrNotFound)
+		}
+		return jelly.Session{}, jelly.WrapDBError(err)
+	}
+
+	sess.Expires = time.Now().Add(lifetime)
+
+	sess, err = sessions.Update(ctx, id, sess)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.Session{}, jelly.NewError("no session with that ID exists", jelly.ErrNotFound)
+		}
+		return jelly.Session{}, jelly.WrapDBError(err, "could not update session")
+	}
+
+	return sess, nil
+}
+
+// GetSessions returns all active sessions of the user with the given ID,
+// newest first. Any of the user's sessions that have expired are removed.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If sessions are not supported
+// by the auth store, it will match jelly.ErrNotFound. If the error occured due
+// to an unexpected problem with the DB, it will match jelly.ErrDB.
+func (svc loginService) GetSessions(ctx context.Context, userID uuid.UUID) ([]jelly.Session, error) {
+	sessions, err := svc.sessions()
+	if err != nil {
+		return nil, err
+	}
+
+	all, err := sessions.GetAllByUser(ctx, userID)
+	if err != nil {
+		return nil, jelly.WrapDBError(err)
+	}
+
+	now := time.Now()
+	active := []jelly.Session{}
+	for _, sess := range all {
+		if !sess.Expired(now) {
+			active = append(active, sess)
+			continue
+		}
+		if _, err := sessions.Delete(ctx, sess.ID); err != nil && !errors.Is(err, jelly.ErrDBNotFound) {
+			return nil, jelly.WrapDBError(err, "could not delete expired session")
+		}
+	}
+
+	return active, nil
+}
+
+// RevokeSession deletes the session with the given ID that belongs to the user
+// with the given ID, invalidating all tokens issued for it. Returns the
+// session that was revoked.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If the session does not exist,
+// does not belong to the user, or sessions are not supported by the auth
+// store, it will match jelly.ErrNotFound. If the error occured due to an
+// unexpected problem with the DB, it will match jelly.ErrDB.
+func (svc loginService) RevokeSession(ctx context.Context, userID, id uuid.UUID) (jelly.Session, error) {
+	sessions, err := svc.sessions()
+	if err != nil {
+		return jelly.Session{}, err
+	}
+
+	sess, err := sessions.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.Session{}, jelly.NewError("no session with that ID exists", jelly.ErrNotFound)
+		}
+		return jelly.Session{}, jelly.WrapDBError(err)
+	}
+	if sess.UserID != userID {
+		return jelly.Session{}, jelly.NewError("no session with that ID exists", jelly.ErrNotFound)
+	}
+
+	sess, err = sessions.Delete(ctx, id)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.Session{}, jelly.NewError("no session with that ID exists", jelly.ErrNotFound)
+		}
+		return jelly.Session{}, jelly.WrapDBError(err, "could not delete session")
+	}
+
+	// the cache does not know which session a token belongs to, so all of the
+	// user's tokens are validated again
+	svc.Tokens.invalidate(userID)
+
+	return sess, nil
+}
+
+// RecordLoginAttempt records an attempt to log in as the user with the given
+// username from a client with the given IP address and user agent. Records
+// older than the login history of the service are removed.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If login attempts are not
+// supported by the auth store, it will match jelly.ErrNotFound. If the error
+// occured due to an unexpected problem with the DB, it will match jelly.ErrDB.
+func (svc loginService) RecordLoginAttempt(ctx context.Context, username, ip, userAgent string, success bool) (jelly.LoginAttempt, error) {
+	st, err := svc.sessionStore()
+	if err != nil {
+		return jelly.LoginAttempt{}, err
+	}
+	attempts := st.LoginAttempts()
+
+	attempt := jelly.LoginAttempt{
+		Username:  username,
+		IP:        ip,
+		UserAgent: userAgent,
+		Success:   success,
+		Time:      time.Now(),
+	}
+
+	user, err := svc.Provider.AuthUsers().GetByUsername(ctx, username)
+	if err == nil {
+		attempt.UserID = user.ID
+	} else if !errors.Is(err, jelly.ErrDBNotFound) {
+		return jelly.LoginAttempt{}, jelly.WrapDBError(err)
+	}
+
+	attempt, err = attempts.Create(ctx, attempt)
+	if err != nil {
+		return jelly.LoginAttempt{}, jelly.WrapDBError(err, "could not record login attempt")
+	}
+
+	if svc.LoginHistory > 0 {
+		if err := attempts.DeleteBefore(ctx, time.Now().Add(-svc.LoginHistory)); err != nil {
+			return attempt, jelly.WrapDBError(err, "could not remove old login attempts")
+		}
+	}
+
+	return attempt, nil
+}
+
+// GetLoginAttempts returns the recorded login attempts for the user with the
+// given ID, newest first.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If login attempts are not
+// supported by the auth store, it will match jelly.ErrNotFound. If the error
+// occured due to an unexpected problem with the DB, it will match jelly.ErrDB.
+func (svc loginService) GetLoginAttempts(ctx context.Context, userID uuid.UUID) ([]jelly.LoginAttempt, error) {
+	st, err := svc.sessionStore()
+	if err != nil {
+		return nil, err
+	}
+
+	attempts, err := st.LoginAttempts().GetAllByUser(ctx, userID)
+	if err != nil {
+		return nil, jelly.WrapDBError(err)
+	}
+	return attempts, nil
+}
+
+// GetAllLoginAttempts returns all recorded login attempts, including those
+// for usernames that do not belong to any user, newest first.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If login attempts are not
+// supported by the auth store, it will match jelly.ErrNotFound. If the error
+// occured due to an unexpected problem with the DB, it will match jelly.ErrDB.
+func (svc loginService) GetAllLoginAttempts(ctx context.Context) ([]jelly.LoginAttempt, error) {
+	st, err := svc.sessionStore()
+	if err != nil {
+		return nil, err
+	}
+
+	attempts, err := st.LoginAttempts().GetAll(ctx)
+	if err != nil {
+		return nil, jelly.WrapDBError(err)
+	}
+	return attempts, nil
+}
+
+// twoFactors returns the repo of two-factor authentication from the provider.
+// If the provider does not support it, an error matching jelly.ErrNotFound is
+// returned.
+func (svc loginService) twoFactors() (jelly.TwoFactorRepo, error) {
+	st, ok := svc.Provider.(jelly.TwoFactorStore)
+	if !ok {
+		return nil, jelly.NewError("two-factor authentication is not supported by the auth store", jelly.ErrNotFound)
+	}
+	return st.TwoFactors(), nil
+}
+
+// moveTwoFactor moves the two-factor authentication of the user with ID
+// oldID, if any, to newID.
+func (svc loginService) moveTwoFactor(ctx context.Context, oldID, newID uuid.UUID) error {
+	twoFactors, err := svc.twoFactors()
+	if err != nil {
+		return nil
+	}
+
+	tf, err := twoFactors.Delete(ctx, oldID)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return nil
+		}
+		return jelly.WrapDBError(err, "could not move two-factor authentication")
+	}
+
+	tf.UserID = newID
+	if _, err := twoFactors.Create(ctx, tf); err != nil {
+		return jelly.WrapDBError(err, "could not move two-factor authentication")
+	}
+	return nil
+}
+
+// GetTwoFactor returns the two-factor authentication of the user with the
+// given ID.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If the user has not set up
+// two-factor authentication or it is not supported by the auth store, it will
+// match jelly.ErrNotFound. If the error occured due to an unexpected problem
+// with the DB, it will match jelly.ErrDB.
+func (svc loginService) GetTwoFactor(ctx context.Context, userID uuid.UUID) (jelly.TwoFactor, error) {
+	twoFactors, err := svc.twoFactors()
+	if err != nil {
+		return jelly.TwoFactor{}, err
+	}
+
+	tf, err := twoFactors.Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.TwoFactor{}, jelly.NewError("two-factor authentication is not set up", jelly.ErrNotFound)
+		}
+		return jelly.TwoFactor{}, jelly.WrapDBError(err)
+	}
+
+	return tf, nil
+}
+
+// HasTwoFactor returns whether the user with the given ID has confirmed
+// two-factor authentication. It is always false if the auth store does not
+// support it.
+func (svc loginService) HasTwoFactor(ctx context.Context, userID uuid.UUID) (bool, error) {
+	tf, err := svc.GetTwoFactor(ctx, userID)
+	if err != nil {
+		if errors.Is(err, jelly.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return tf.Confirmed, nil
+}
+
+// BeginTwoFactor starts setting up two-factor authentication for the user with
+// the given ID by generating a new TOTP secret for them. It is not enforced
+// until it is confirmed with ConfirmTwoFactor. If the user had already begun
+// but not confirmed it, the old secret is replaced.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If the user already has
+// confirmed two-factor authentication, it will match jelly.ErrAlreadyExists.
+// If it is not supported by the auth store, it will match jelly.ErrNotFound.
+// If the error occured due to an unexpected problem with the DB, it will match
+// jelly.ErrDB.
+func (svc loginService) BeginTwoFactor(ctx context.Context, userID uuid.UUID) (jelly.TwoFactor, error) {
+	twoFactors, err := svc.twoFactors()
+	if err != nil {
+		return jelly.TwoFactor{}, err
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return jelly.TwoFactor{}, err
+	}
+
+	existing, err := twoFactors.Get(ctx, userID)
+	if err == nil {
+		if existing.Confirmed {
+			return jelly.TwoFactor{}, jelly.NewError("two-factor authentication is already set up", jelly.ErrAlreadyExists)
+		}
+		existing.Secret = secret
+		existing.LastStep = 0
+		tf, err := twoFactors.Update(ctx, userID, existing)
+		if err != nil {
+			return jelly.TwoFactor{}, jelly.WrapDBError(err, "could not update two-factor authentication")
+		}
+		return tf, nil
+	} else if !errors.Is(err, jelly.ErrDBNotFound) {
+		return jelly.TwoFactor{}, jelly.WrapDBError(err)
+	}
+
+	tf, err := twoFactors.Create(ctx, jelly.TwoFactor{UserID: userID, Secret: secret})
+	if err != nil {
+		return jelly.TwoFactor{}, jelly.WrapDBError(err, "could not create two-factor authentication")
+	}
+	return tf, nil
+}
+
+// ConfirmTwoFactor confirms the two-factor authentication that the user with
+// the given ID has begun setting up by checking that code is a valid TOTP code
+// for it. Once confirmed, it is enforced at login. Returns the confirmed
+// TwoFactor and a new set of recovery codes, which are not stored in plain
+// text and so cannot be retrieved again.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If the code is not valid, it
+// will match jelly.ErrBadCredentials. If the user has not begun setting up
+// two-factor authentication, it will match jelly.ErrNotFound, and if it is
+// already confirmed, it will match jelly.ErrAlreadyExists. If the error
+// occured due to an unexpected problem with the DB, it will match jelly.ErrDB.
+func (svc loginService) ConfirmTwoFactor(ctx context.Context, userID uuid.UUID, code string) (jelly.TwoFactor, []string, error) {
+	tf, err := svc.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return jelly.TwoFactor{}, nil, err
+	}
+	if tf.Confirmed {
+		return jelly.TwoFactor{}, nil, jelly.NewError("two-factor authentication is already set up", jelly.ErrAlreadyExists)
+	}
+
+	step, ok := verifyTOTP(tf.Secret, code, time.Now(), tf.LastStep)
+	if !ok {
+		return jelly.TwoFactor{}, nil, jelly.NewError("code is not valid", jelly.ErrBadCredentials)
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return jelly.TwoFactor{}, nil, err
+	}
+
+	tf.Confirmed = true
+	tf.LastStep = step
+	tf.RecoveryCodes = hashes
+
+	twoFactors, _ := svc.twoFactors()
+	tf, err = twoFactors.Update(ctx, userID, tf)
+	if err != nil {
+		return jelly.TwoFactor{}, nil, jelly.WrapDBError(err, "could not update two-factor authentication")
+	}
+
+	return tf, codes, nil
+}
+
+// VerifyTwoFactor checks a second factor given by the user with the given ID
+// during login. Exactly one of code and recoveryCode should be given; if code
+// is given, it must be a TOTP code that has not been used before, and if
+// recoveryCode is given, it must be one of the user's recovery codes, which is
+// then used up. Returns the user's updated TwoFactor.
+//
+// Each attempt is counted before the code is checked, and after
+// maxTwoFactorFailures incorrect codes in a row, all codes are rejected until
+// twoFactorLockout has passed since the last one. The TwoFactor is only updated
+// if no other request has updated it since it was read, so a code cannot be
+// accepted twice by concurrent requests.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If the code or recovery code
+// is not valid, it will match jelly.ErrBadCredentials. If too many incorrect
+// codes have been given, it will match jelly.ErrRateLimited. If the
+// TwoFactor was modified by a concurrent request, it will match
+// jelly.ErrConflict. If the user does not have confirmed two-factor
+// authentication, it will match jelly.ErrNotFound. If the error occured due to
+// an unexpected problem with the DB, it will match jelly.ErrDB.
+func (svc loginService) VerifyTwoFactor(ctx context.Context, userID uuid.UUID, code, recoveryCode string) (jelly.TwoFactor, error) {
+	tf, err := svc.countTwoFactorAttempt(ctx, userID, time.Now())
+	if err != nil {
+		return jelly.TwoFactor{}, err
+	}
+
+	if code != "" {
+		step, ok := verifyTOTP(tf.Secret, code, time.Now(), tf.LastStep)
+		if !ok {
+			return jelly.TwoFactor{}, jelly.NewError("code is not valid", jelly.ErrBadCredentials)
+		}
+		tf.LastStep = step
+	} else {
+		hash := hashRecoveryCode(recoveryCode)
+		idx := -1
+		for i := range tf.RecoveryCodes {
+			if subtle.ConstantTimeCompare([]byte(tf.RecoveryCodes[i]), []byte(hash)) == 1 {
+				idx = i
+			}
+		}
+		if recoveryCode == "" || idx < 0 {
+			return jelly.TwoFactor{}, jelly.NewError("recovery code is not valid", jelly.ErrBadCredentials)
+		}
+		tf.RecoveryCodes = append(tf.RecoveryCodes[:idx], tf.RecoveryCodes[idx+1:]...)
+	}
+	tf.FailedAttempts = 0
+
+	twoFactors, _ := svc.twoFactors()
+	tf, err = twoFactors.Update(ctx, userID, tf)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBConflict) {
+			return jelly.TwoFactor{}, jelly.NewError("two-factor authentication was modified by another request", jelly.ErrConflict)
+		}
+		return jelly.TwoFactor{}, jelly.WrapDBError(err, "could not update two-factor authentication")
+	}
+
+	return tf, nil
+}
+
+// countTwoFactorAttempt records an attempt to give a code for the confirmed
+// two-factor authentication of the user with the given ID, made at time now,
+// and returns the updated TwoFactor. The attempt is counted as failed until
+// the TwoFactor is updated again with FailedAttempts reset. If the user has
+// given too many incorrect codes, the attempt is not counted and an error
+// matching jelly.ErrRateLimited is returned.
+func (svc loginService) countTwoFactorAttempt(ctx context.Context, userID uuid.UUID, now time.Time) (jelly.TwoFactor, error) {
+	twoFactors, err := svc.twoFactors()
+	if err != nil {
+		return jelly.TwoFactor{}, err
+	}
+
+	// retry if a concurrent attempt is counted first so that running
+	// attempts in parallel cannot get around the limit
+	const maxTries = 5
+	for try := 0; ; try++ {
+		tf, err := svc.GetTwoFactor(ctx, userID)
+		if err != nil {
+			return jelly.TwoFactor{}, err
+		}
+		if !tf.Confirmed {
+			return jelly.TwoFactor{}, jelly.NewError("two-factor authentication is not set up", jelly.ErrNotFound)
+		}
+
+		if tf.FailedAttempts >= maxTwoFactorFailures {
+			if until := tf.Modified.Add(twoFactorLockout); now.Before(until) {
+				return jelly.TwoFactor{}, jelly.NewError("too many incorrect codes; locked until "+until.Format(time.RFC3339), jelly.ErrRateLimited)
+			}
+			tf.FailedAttempts = 0
+		}
+		tf.FailedAttempts++
+
+		tf, err = twoFactors.Update(ctx, userID, tf)
+		if err == nil {
+			return tf, nil
+		} else if !errors.Is(err, jelly.ErrDBConflict) {
+			return jelly.TwoFactor{}, jelly.WrapDBError(err, "could not update two-factor authentication")
+		} else if try+1 >= maxTries {
+			return jelly.TwoFactor{}, jelly.NewError("two-factor authentication was modified by another request", jelly.ErrConflict)
+		}
+	}
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user with the
+// given ID with a new set. Returns the updated TwoFactor and the new codes.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If the user does not have
+// confirmed two-factor authentication, it will match jelly.ErrNotFound. If the
+// error occured due to an unexpected problem with the DB, it will match
+// jelly.ErrDB.
+func (svc loginService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID) (jelly.TwoFactor, []string, error) {
+	tf, err := svc.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return jelly.TwoFactor{}, nil, err
+	}
+	if !tf.Confirmed {
+		return jelly.TwoFactor{}, nil, jelly.NewError("two-factor authentication is not set up", jelly.ErrNotFound)
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return jelly.TwoFactor{}, nil, err
+	}
+	tf.RecoveryCodes = hashes
+
+	twoFactors, _ := svc.twoFactors()
+	tf, err = twoFactors.Update(ctx, userID, tf)
+	if err != nil {
+		return jelly.TwoFactor{}, nil, jelly.WrapDBError(err, "could not update two-factor authentication")
+	}
+
+	return tf, codes, nil
+}
+
+// DisableTwoFactor removes the two-factor authentication of the user with the
+// given ID, whether or not it was confirmed. Returns the removed TwoFactor.
+//
+// The returned error, if non-nil, will return true for various calls to
+// errors.Is depending on what caused the error. If the user has not set up
+// two-factor authentication or it is not supported by the auth store, it will
+// match jelly.ErrNotFound. If the error occured due to an unexpected problem
+// with the DB, it will match jelly.ErrDB.
+func (svc loginService) DisableTwoFactor(ctx context.Context, userID uuid.UUID) (jelly.TwoFactor, error) {
+	twoFactors, err := svc.twoFactors()
+	if err != nil {
+		return jelly.TwoFactor{}, err
+	}
+
+	tf, err := twoFactors.Delete(ctx, userID)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return jelly.TwoFactor{}, jelly.NewError("two-factor authentication is not set up", jelly.ErrNotFound)
+		}
+		return jelly.TwoFactor{}, jelly.WrapDBError(err, "could not delete two-factor authentication")
+	}
+
+	return tf, nil
+}
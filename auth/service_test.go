@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/authuserdao/inmem"
+	"github.com/dekarrin/jelly/jellytest/fakestore"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// twoFactorTestStore is an in-memory AuthUserStore whose TwoFactorRepo calls
+// beforeUpdate, if set, at the start of each Update.
+type twoFactorTestStore struct {
+	*inmem.AuthUserStore
+	twoFactors *hookedTwoFactorRepo
+}
+
+func (st twoFactorTestStore) TwoFactors() jelly.TwoFactorRepo {
+	return st.twoFactors
+}
+
+type hookedTwoFactorRepo struct {
+	jelly.TwoFactorRepo
+	beforeUpdate func()
+}
+
+func (r *hookedTwoFactorRepo) Update(ctx context.Context, userID uuid.UUID, tf jelly.TwoFactor) (jelly.TwoFactor, error) {
+	if hook := r.beforeUpdate; hook != nil {
+		r.beforeUpdate = nil
+		hook()
+	}
+	return r.TwoFactorRepo.Update(ctx, userID, tf)
+}
+
+// newTwoFactorTestService returns a loginService with a user who has confirmed
+// two-factor authentication, and the key that their codes are generated from.
+func newTwoFactorTestService(t *testing.T) (loginService, *hookedTwoFactorRepo, uuid.UUID, []byte) {
+	st := inmem.NewAuthUserStore()
+	repo := &hookedTwoFactorRepo{TwoFactorRepo: st.TwoFactors()}
+	svc := loginService{Provider: twoFactorTestStore{AuthUserStore: st, twoFactors: repo}}
+
+	key := []byte("12345678901234567890")
+	userID := uuid.New()
+	_, err := repo.Create(context.Background(), jelly.TwoFactor{
+		UserID:    userID,
+		Secret:    totpEncoding.EncodeToString(key),
+		Confirmed: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return svc, repo, userID, key
+}
+
+func currentTOTPCode(key []byte) string {
+	return totpCode(key, time.Now().Unix()/totpPeriod)
+}
+
+func Test_loginService_VerifyTwoFactor(t *testing.T) {
+	testCases := []struct {
+		name          string
+		failuresFirst int
+		code          func(key []byte) string
+		expectErr     error
+		expectFailed  int
+	}{
+		{name: "valid code", code: currentTOTPCode, expectFailed: 0},
+		{name: "valid code resets failures", failuresFirst: maxTwoFactorFailures - 1, code: currentTOTPCode, expectFailed: 0},
+		{name: "invalid code", code: func([]byte) string { return "abcdef" }, expectErr: jelly.ErrBadCredentials, expectFailed: 1},
+		{name: "locked after too many failures", failuresFirst: maxTwoFactorFailures, code: currentTOTPCode, expectErr: jelly.ErrRateLimited, expectFailed: maxTwoFactorFailures},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			ctx := context.Background()
+			svc, repo, userID, key := newTwoFactorTestService(t)
+
+			for i := 0; i < tc.failuresFirst; i++ {
+				_, err := svc.VerifyTwoFactor(ctx, userID, "abcdef", "")
+				assert.ErrorIs(err, jelly.ErrBadCredentials)
+			}
+
+			_, err := svc.VerifyTwoFactor(ctx, userID, tc.code(key), "")
+			if tc.expectErr != nil {
+				assert.ErrorIs(err, tc.expectErr)
+			} else {
+				assert.NoError(err)
+			}
+
+			tf, err := repo.Get(ctx, userID)
+			assert.NoError(err)
+			assert.Equal(tc.expectFailed, tf.FailedAttempts)
+		})
+	}
+}
+
+func Test_loginService_VerifyTwoFactor_lockExpires(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	svc, _, userID, _ := newTwoFactorTestService(t)
+
+	for i := 0; i < maxTwoFactorFailures; i++ {
+		_, err := svc.VerifyTwoFactor(ctx, userID, "abcdef", "")
+		assert.ErrorIs(err, jelly.ErrBadCredentials)
+	}
+
+	_, err := svc.countTwoFactorAttempt(ctx, userID, time.Now())
+	assert.ErrorIs(err, jelly.ErrRateLimited)
+
+	tf, err := svc.countTwoFactorAttempt(ctx, userID, time.Now().Add(twoFactorLockout+time.Second))
+	assert.NoError(err)
+	assert.Equal(1, tf.FailedAttempts)
+}
+
+func Test_loginService_VerifyTwoFactor_concurrentUse(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	svc, repo, userID, key := newTwoFactorTestService(t)
+	code := currentTOTPCode(key)
+
+	// the code is accepted by another request between when the first one
+	// counts its attempt and when it records the code as used
+	var otherErr error
+	repo.beforeUpdate = func() {
+		repo.beforeUpdate = func() {
+			_, otherErr = svc.VerifyTwoFactor(ctx, userID, code, "")
+		}
+	}
+
+	_, err := svc.VerifyTwoFactor(ctx, userID, code, "")
+	assert.NoError(otherErr)
+	assert.ErrorIs(err, jelly.ErrConflict)
+
+	// and it cannot then be used again
+	_, err = svc.VerifyTwoFactor(ctx, userID, code, "")
+	assert.ErrorIs(err, jelly.ErrBadCredentials)
+}
+
+func Test_loginService_Login(t *testing.T) {
+	hasher, err := NewPasswordHasher(HashBcrypt, bcrypt.MinCost, 0)
+	require.NoError(t, err)
+	hash, err := hasher.Hash("hunter2")
+	require.NoError(t, err)
+	marty := jelly.AuthUser{ID: uuid.New(), Username: "marty", Password: hash, Role: jelly.Admin}
+
+	testCases := []struct {
+		name          string
+		users         *fakestore.AuthUserRepo
+		expectErr     error
+		expectUpdates int
+	}{
+		{
+			name:          "update succeeds",
+			users:         fakestore.AuthUsers().WithUser(marty),
+			expectUpdates: 1,
+		},
+		{
+			name:          "conflicting update is retried",
+			users:         fakestore.AuthUsers().WithUser(marty).FailingOnCall("Update", 1, jelly.ErrDBConflict),
+			expectUpdates: 2,
+		},
+		{
+			name:          "update fails",
+			users:         fakestore.AuthUsers().WithUser(marty).FailingOn("Update", jelly.ErrDBConstraintViolation),
+			expectErr:     jelly.ErrDB,
+			expectUpdates: 1,
+		},
+		{
+			name:          "lookup fails",
+			users:         fakestore.AuthUsers().WithUser(marty).FailingOn("GetByUsername", jelly.ErrDBNotFound),
+			expectErr:     jelly.ErrBadCredentials,
+			expectUpdates: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			svc := loginService{Provider: fakestore.New().WithAuthUsers(tc.users), Hasher: hasher}
+
+			user, err := svc.Login(context.Background(), "marty", "hunter2")
+			if tc.expectErr != nil {
+				assert.ErrorIs(err, tc.expectErr)
+			} else if assert.NoError(err) {
+				assert.Equal(marty.ID, user.ID)
+				assert.False(user.LastLogin.IsZero())
+			}
+			assert.Equal(tc.expectUpdates, tc.users.Calls("Update"))
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// throttleSweep is the number of keys that a throttle tracks before it
+// discards those whose events are all outside of its window.
+const throttleSweep = 1024
+
+// throttle counts the recent events of each key in memory, such as the failed
+// logins of each username, so that a limit can be applied once there have
+// been too many. Keys are not case-sensitive.
+type throttle struct {
+	after  int
+	window time.Duration
+
+	mtx    sync.Mutex
+	events map[string][]time.Time
+}
+
+// newThrottle returns a throttle that is exceeded once a key has had after
+// events within window. If after is less than 1, it is never exceeded.
+func newThrottle(after int, window time.Duration) *throttle {
+	return &throttle{
+		after:  after,
+		window: window,
+		events: map[string][]time.Time{},
+	}
+}
+
+// exceeded returns whether key has had too many events as of now. It is safe
+// to call on a nil *throttle, which is never exceeded.
+func (th *throttle) exceeded(key string, now time.Time) bool {
+	if th == nil || th.after < 1 {
+		return false
+	}
+
+	th.mtx.Lock()
+	defer th.mtx.Unlock()
+
+	return len(th.recent(strings.ToLower(key), now)) >= th.after
+}
+
+// add records an event for key.
+func (th *throttle) add(key string, now time.Time) {
+	if th == nil || th.after < 1 {
+		return
+	}
+
+	th.mtx.Lock()
+	defer th.mtx.Unlock()
+
+	if len(th.events) >= throttleSweep {
+		for k := range th.events {
+			th.recent(k, now)
+		}
+	}
+
+	k := strings.ToLower(key)
+	th.events[k] = append(th.recent(k, now), now)
+}
+
+// reset clears the events of key.
+func (th *throttle) reset(key string) {
+	if th == nil {
+		return
+	}
+
+	th.mtx.Lock()
+	defer th.mtx.Unlock()
+
+	delete(th.events, strings.ToLower(key))
+}
+
+// recent discards the events of key that are outside of the window as of now
+// and returns the rest. th.mtx must be held by the caller.
+func (th *throttle) recent(key string, now time.Time) []time.Time {
+	times := th.events[key]
+	start := 0
+	for start < len(times) && now.Sub(times[start]) >= th.window {
+		start++
+	}
+	if start == len(times) {
+		delete(th.events, key)
+		return nil
+	}
+	if start > 0 {
+		times = append([]time.Time{}, times[start:]...)
+		th.events[key] = times
+	}
+	return times
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_throttle(t *testing.T) {
+	start := time.Now()
+	at := func(mins int) time.Time { return start.Add(time.Duration(mins) * time.Minute) }
+
+	// each step is "add" or "reset" at the given minute, followed by
+	// whether the throttle is exceeded after it.
+	type step struct {
+		action string
+		min    int
+		expect bool
+	}
+
+	testCases := []struct {
+		name  string
+		after int
+		steps []step
+	}{
+		{
+			name:  "exceeded after threshold",
+			after: 2,
+			steps: []step{{"add", 0, false}, {"add", 1, true}, {"add", 2, true}},
+		},
+		{
+			name:  "reset clears events",
+			after: 2,
+			steps: []step{{"add", 0, false}, {"add", 1, true}, {"reset", 2, false}, {"add", 3, false}},
+		},
+		{
+			name:  "events outside window are forgotten",
+			after: 2,
+			steps: []step{{"add", 0, false}, {"add", 9, true}, {"check", 10, false}, {"add", 11, true}},
+		},
+		{
+			name:  "disabled",
+			after: -1,
+			steps: []step{{"add", 0, false}, {"add", 1, false}, {"add", 2, false}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			th := newThrottle(tc.after, 10*time.Minute)
+
+			for i, s := range tc.steps {
+				switch s.action {
+				case "add":
+					th.add("Marty", at(s.min))
+				case "reset":
+					th.reset("marty")
+				}
+				assert.Equal(t, s.expect, th.exceeded("MARTY", at(s.min)), "step #%d", i+1)
+				assert.False(t, th.exceeded("doc", at(s.min)), "step #%d: other user", i+1)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
@@ -17,10 +19,99 @@ var (
 	Issuer = "jelly"
 )
 
-func validateToken(ctx context.Context, tok string, secret []byte, userDB jelly.AuthUserRepo) (jelly.AuthUser, error) {
+const (
+	// userStateClaim is the claim that holds a digest of user state in tokens
+	// signed with an asymmetric algorithm. Changing the password or logging
+	// out changes the state, invalidating any tokens issued before then.
+	userStateClaim = "ust"
+
+	// serviceAccountClaim is the claim that marks a token whose subject is a
+	// service account rather than a user.
+	serviceAccountClaim = "svc"
+
+	// guestClaim is the claim that marks a token whose subject is an
+	// anonymous guest rather than a user.
+	guestClaim = "gst"
+
+	// scopeClaim is the claim that holds the space-separated scopes a scoped
+	// token is limited to.
+	scopeClaim = "scope"
+
+	// tenantClaim is the claim that holds the ID of the tenant that the
+	// subject of a token belongs to. It is omitted if they do not belong to
+	// one.
+	tenantClaim = "tid"
+
+	// sessionClaim is the claim that holds the ID of the session that a user
+	// token belongs to. It is omitted if sessions are not tracked.
+	sessionClaim = "sid"
+
+	// twoFactorClaim is the claim that marks a token issued to a user who has
+	// given their password but has not yet completed two-factor
+	// authentication. Its value is the step they must complete, one of
+	// twoFactorVerify or twoFactorEnroll. Such tokens can only be exchanged
+	// for a full token at the two-factor login endpoint.
+	twoFactorClaim = "2fa"
+
+	// twoFactorVerify is the twoFactorClaim value for a user who must give a
+	// code from their existing two-factor authentication.
+	twoFactorVerify = "verify"
+
+	// twoFactorEnroll is the twoFactorClaim value for a user who is required
+	// to set up two-factor authentication before they can log in.
+	twoFactorEnroll = "enroll"
+
+	// userTokenLifetime is how long tokens issued to users are valid for.
+	userTokenLifetime = time.Hour
+
+	// pendingTokenLifetime is how long tokens pending two-factor
+	// authentication are valid for.
+	pendingTokenLifetime = 5 * time.Minute
+)
+
+// validateToken validates tok and returns the principal it was issued to. If
+// the token was issued to a service account, saDB is used to look it up; it
+// may be nil if service accounts are not supported. If the token belongs to a
+// session, sessDB is used to check that the session has not been revoked; it
+// may be nil if sessions are not supported. Guest tokens are only accepted if
+// guests is true.
+func validateToken(ctx context.Context, tok string, keys keySet, userDB jelly.AuthUserRepo, saDB jelly.ServiceAccountRepo, sessDB jelly.SessionRepo, guests bool) (jelly.AuthUser, error) {
+	user, claims, err := parseToken(ctx, tok, keys, userDB, saDB, sessDB, guests)
+	if err != nil {
+		return jelly.AuthUser{}, err
+	}
+
+	if _, pending := claims[twoFactorClaim]; pending {
+		return jelly.AuthUser{}, fmt.Errorf("two-factor authentication has not been completed")
+	}
+
+	return user, nil
+}
+
+// validatePendingToken validates a token issued to a user who has not yet
+// completed two-factor authentication and returns the user along with the
+// step they must complete. Tokens that are not pending are rejected.
+func validatePendingToken(ctx context.Context, tok string, keys keySet, userDB jelly.AuthUserRepo) (jelly.AuthUser, string, error) {
+	user, claims, err := parseToken(ctx, tok, keys, userDB, nil, nil, false)
+	if err != nil {
+		return jelly.AuthUser{}, "", err
+	}
+
+	step, _ := claims[twoFactorClaim].(string)
+	if step != twoFactorVerify && step != twoFactorEnroll {
+		return jelly.AuthUser{}, "", fmt.Errorf("token is not pending two-factor authentication")
+	}
+
+	return user, step, nil
+}
+
+// parseToken parses and verifies tok and returns the principal it was issued
+// to along with its claims. It does not check whether two-factor
+// authentication was completed.
+func parseToken(ctx context.Context, tok string, keys keySet, userDB jelly.AuthUserRepo, saDB jelly.ServiceAccountRepo, sessDB jelly.SessionRepo, guests bool) (jelly.AuthUser, jwt.MapClaims, error) {
 	var user jelly.AuthUser
 
-	_, err := jwt.Parse(tok, func(t *jwt.Token) (interface{}, error) {
+	parsed, err := jwt.Parse(tok, func(t *jwt.Token) (interface{}, error) {
 		// who is the user? we need this for further verification
 		subj, err := t.Claims.GetSubject()
 		if err != nil {
@@ -32,7 +123,28 @@ func validateToken(ctx context.Context, tok string, secret []byte, userDB jelly.
 			return nil, fmt.Errorf("cannot parse subject UUID: %w", err)
 		}
 
-		user, err = userDB.Get(ctx, id)
+		if isGuestToken(t) {
+			// guests are not stored; the token itself is all there is
+			if !guests {
+				return nil, fmt.Errorf("guest tokens are not enabled")
+			}
+			claims := t.Claims.(jwt.MapClaims)
+			tenantID, _ := claims[tenantClaim].(string)
+			var created time.Time
+			if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+				created = iat.Time
+			}
+			user = guestPrincipal(id, tenantID, created)
+		} else if isServiceAccountToken(t) {
+			if saDB == nil {
+				return nil, fmt.Errorf("service accounts are not supported")
+			}
+			var sa jelly.ServiceAccount
+			sa, err = saDB.Get(ctx, id)
+			user = serviceAccountPrincipal(sa)
+		} else {
+			user, err = userDB.Get(ctx, id)
+		}
 		if err != nil {
 			if errors.Is(err, jelly.ErrDBNotFound) {
 				return nil, fmt.Errorf("subject does not exist")
@@ -41,18 +153,138 @@ func validateToken(ctx context.Context, tok string, secret []byte, userDB jelly.
 			}
 		}
 
-		var signKey []byte
-		signKey = append(signKey, secret...)
-		signKey = append(signKey, []byte(user.Password)...)
-		signKey = append(signKey, []byte(fmt.Sprintf("%d", user.LastLogout.Unix()))...)
-		return signKey, nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}), jwt.WithIssuer(Issuer), jwt.WithLeeway(time.Minute))
+		if !keys.alg.Asymmetric() {
+			return userSigningSecret(keys.secret, user), nil
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		return keys.verificationKey(kid)
+	}, jwt.WithValidMethods([]string{keys.alg.method().Alg()}), jwt.WithIssuer(Issuer), jwt.WithLeeway(time.Minute))
 
 	if err != nil {
-		return jelly.AuthUser{}, err
+		return jelly.AuthUser{}, nil, err
 	}
 
-	return user, nil
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok {
+		return jelly.AuthUser{}, nil, fmt.Errorf("unexpected claims type")
+	}
+
+	if keys.alg.Asymmetric() {
+		state, _ := claims[userStateClaim].(string)
+		if state != userState(user) {
+			return jelly.AuthUser{}, nil, fmt.Errorf("token is no longer valid for subject")
+		}
+	}
+
+	if tenantID, _ := claims[tenantClaim].(string); tenantID != user.TenantID {
+		return jelly.AuthUser{}, nil, fmt.Errorf("token tenant does not match subject")
+	}
+
+	if sidStr, ok := claims[sessionClaim].(string); ok {
+		sid, err := uuid.Parse(sidStr)
+		if err != nil {
+			return jelly.AuthUser{}, nil, fmt.Errorf("cannot parse session UUID: %w", err)
+		}
+		if sessDB == nil {
+			return jelly.AuthUser{}, nil, fmt.Errorf("sessions are not supported")
+		}
+		sess, err := sessDB.Get(ctx, sid)
+		if err != nil {
+			if errors.Is(err, jelly.ErrDBNotFound) {
+				return jelly.AuthUser{}, nil, fmt.Errorf("session has been revoked")
+			}
+			return jelly.AuthUser{}, nil, fmt.Errorf("session could not be validated")
+		}
+		if sess.UserID != user.ID || sess.Expired(time.Now()) {
+			return jelly.AuthUser{}, nil, fmt.Errorf("session is no longer valid")
+		}
+		user.SessionID = sid
+	}
+
+	if scopeStr, ok := claims[scopeClaim].(string); ok || user.ServiceAccount {
+		// only grant the scopes in the token that the subject still has; the
+		// service account may have been changed since the token was issued.
+		granted := []string{}
+		for _, sc := range strings.Fields(scopeStr) {
+			if user.HasScopes(sc) {
+				granted = append(granted, sc)
+			}
+		}
+		user.Scopes = granted
+	}
+
+	return user, claims, nil
+}
+
+// isServiceAccountToken returns whether t was issued to a service account.
+func isServiceAccountToken(t *jwt.Token) bool {
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	isSvc, _ := claims[serviceAccountClaim].(bool)
+	return isSvc
+}
+
+// isGuestToken returns whether t was issued to a guest.
+func isGuestToken(t *jwt.Token) bool {
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	isGuest, _ := claims[guestClaim].(bool)
+	return isGuest
+}
+
+// guestPrincipal returns the AuthUser that represents the guest with the given
+// ID. Guests have no password and never log out, so their tokens are only
+// invalidated by expiring.
+func guestPrincipal(id uuid.UUID, tenantID string, created time.Time) jelly.AuthUser {
+	return jelly.AuthUser{
+		ID:       id,
+		Role:     jelly.Guest,
+		Created:  created,
+		TenantID: tenantID,
+		Guest:    true,
+	}
+}
+
+// serviceAccountPrincipal returns the AuthUser that represents sa when it is
+// logged in. The service account's hashed secret takes the place of the
+// password, so rotating the secret invalidates existing tokens in the same
+// way that changing a user's password does.
+func serviceAccountPrincipal(sa jelly.ServiceAccount) jelly.AuthUser {
+	return jelly.AuthUser{
+		ID:             sa.ID,
+		Username:       sa.Name,
+		Password:       sa.Secret,
+		Role:           jelly.Guest,
+		Created:        sa.Created,
+		Modified:       sa.Modified,
+		LastLogin:      sa.LastUsed,
+		ServiceAccount: true,
+		Scopes:         append([]string{}, sa.Scopes...),
+	}
+}
+
+// userSigningSecret returns the HMAC key used to sign tokens for the given
+// user. It includes user state so that changing the password or logging out
+// invalidates existing tokens.
+func userSigningSecret(secret []byte, u jelly.AuthUser) []byte {
+	var signKey []byte
+	signKey = append(signKey, secret...)
+	signKey = append(signKey, []byte(u.Password)...)
+	signKey = append(signKey, []byte(fmt.Sprintf("%d", u.LastLogout.Unix()))...)
+	return signKey
+}
+
+// userState returns a digest of the parts of the user that, when changed,
+// should invalidate existing tokens. It serves the same purpose for
+// asymmetric algorithms that userSigningSecret does for HS512.
+func userState(u jelly.AuthUser) string {
+	sum := sha256.Sum256(userSigningSecret(nil, u))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
 }
 
 // Get gets the token from the Authorization header as a bearer token.
@@ -78,21 +310,88 @@ func getToken(req *http.Request) (string, error) {
 	return token, nil
 }
 
-func generateToken(secret []byte, u jelly.AuthUser) (string, error) {
-	claims := &jwt.MapClaims{
+// generateToken creates a token for u. If u.SessionID is set, the token
+// belongs to that session.
+func generateToken(keys keySet, u jelly.AuthUser) (string, error) {
+	claims := jwt.MapClaims{
 		"iss":        Issuer,
-		"exp":        time.Now().Add(time.Hour).Unix(),
+		"exp":        time.Now().Add(userTokenLifetime).Unix(),
 		"sub":        u.ID.String(),
 		"authorized": true,
 	}
-	tok := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	if u.TenantID != "" {
+		claims[tenantClaim] = u.TenantID
+	}
+	if u.SessionID != uuid.Nil {
+		claims[sessionClaim] = u.SessionID.String()
+	}
 
-	var signKey []byte
-	signKey = append(signKey, secret...)
-	signKey = append(signKey, []byte(u.Password)...)
-	signKey = append(signKey, []byte(fmt.Sprintf("%d", u.LastLogout.Unix()))...)
+	return signToken(keys, u, claims)
+}
+
+// generatePendingToken creates a short-lived token for u, who has given their
+// password but must still complete the given step of two-factor
+// authentication before they are logged in.
+func generatePendingToken(keys keySet, u jelly.AuthUser, step string) (string, error) {
+	claims := jwt.MapClaims{
+		"iss":          Issuer,
+		"exp":          time.Now().Add(pendingTokenLifetime).Unix(),
+		"sub":          u.ID.String(),
+		"authorized":   false,
+		twoFactorClaim: step,
+	}
+	if u.TenantID != "" {
+		claims[tenantClaim] = u.TenantID
+	}
+
+	return signToken(keys, u, claims)
+}
+
+// generateServiceAccountToken creates a token for sa that is limited to the
+// given scopes and expires after lifetime.
+func generateServiceAccountToken(keys keySet, sa jelly.ServiceAccount, scopes []string, lifetime time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"iss":               Issuer,
+		"exp":               time.Now().Add(lifetime).Unix(),
+		"sub":               sa.ID.String(),
+		"authorized":        true,
+		serviceAccountClaim: true,
+		scopeClaim:          strings.Join(scopes, " "),
+	}
+
+	return signToken(keys, serviceAccountPrincipal(sa), claims)
+}
+
+// generateGuestToken creates a token for guest that expires after lifetime.
+// The guest's original creation time is kept as the issue time so that it
+// survives renewal.
+func generateGuestToken(keys keySet, guest jelly.AuthUser, lifetime time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"iss":        Issuer,
+		"iat":        guest.Created.Unix(),
+		"exp":        time.Now().Add(lifetime).Unix(),
+		"sub":        guest.ID.String(),
+		"authorized": true,
+		guestClaim:   true,
+	}
+	if guest.TenantID != "" {
+		claims[tenantClaim] = guest.TenantID
+	}
+
+	return signToken(keys, guest, claims)
+}
+
+func signToken(keys keySet, u jelly.AuthUser, claims jwt.MapClaims) (string, error) {
+	if !keys.alg.Asymmetric() {
+		tok := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+		return tok.SignedString(userSigningSecret(keys.secret, u))
+	}
+
+	claims[userStateClaim] = userState(u)
+	tok := jwt.NewWithClaims(keys.alg.method(), claims)
+	tok.Header["kid"] = keys.active.id
 
-	tokStr, err := tok.SignedString(signKey)
+	tokStr, err := tok.SignedString(keys.active.priv)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/authuserdao/inmem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeySets returns a keySet for each supported SigningAlg.
+func testKeySets(t *testing.T) map[SigningAlg]keySet {
+	t.Helper()
+
+	sets := map[SigningAlg]keySet{
+		SignHS512: newSecretKeySet([]byte("test-secret")),
+	}
+	for _, alg := range []SigningAlg{SignRS256, SignEdDSA} {
+		priv, _ := testKeyPEM(t, alg)
+		ks, err := loadKeySet(alg, writeTestFile(t, "key.pem", priv), nil, 0)
+		require.NoError(t, err)
+		sets[alg] = ks
+	}
+	return sets
+}
+
+func Test_validateToken_scopes(t *testing.T) {
+	testCases := []struct {
+		name         string
+		accountHas   []string
+		tokenScopes  []string
+		nowHas       []string
+		expectScopes []string
+	}{
+		{
+			name:         "all token scopes still held",
+			accountHas:   []string{"read", "write"},
+			tokenScopes:  []string{"read", "write"},
+			nowHas:       []string{"read", "write"},
+			expectScopes: []string{"read", "write"},
+		},
+		{
+			name:         "token limited to fewer scopes",
+			accountHas:   []string{"read", "write"},
+			tokenScopes:  []string{"read"},
+			nowHas:       []string{"read", "write"},
+			expectScopes: []string{"read"},
+		},
+		{
+			name:         "scope removed from account after issue",
+			accountHas:   []string{"read", "write"},
+			tokenScopes:  []string{"read", "write"},
+			nowHas:       []string{"write"},
+			expectScopes: []string{"write"},
+		},
+		{
+			name:         "scope added to account after issue",
+			accountHas:   []string{"read"},
+			tokenScopes:  []string{"read"},
+			nowHas:       []string{"read", "write"},
+			expectScopes: []string{"read"},
+		},
+		{
+			name:         "no scopes in token",
+			accountHas:   []string{"read"},
+			tokenScopes:  nil,
+			nowHas:       []string{"read"},
+			expectScopes: []string{},
+		},
+	}
+
+	for alg, keys := range testKeySets(t) {
+		keys := keys
+		t.Run(alg.String(), func(t *testing.T) {
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					ctx := context.Background()
+					st := inmem.NewAuthUserStore()
+					sas := st.ServiceAccounts()
+
+					sa, err := sas.Create(ctx, jelly.ServiceAccount{Name: "bot", Secret: "hash", Scopes: tc.accountHas})
+					require.NoError(t, err)
+
+					tok, err := generateServiceAccountToken(keys, sa, tc.tokenScopes, time.Hour)
+					require.NoError(t, err)
+
+					sa.Scopes = tc.nowHas
+					_, err = sas.Update(ctx, sa.ID, sa)
+					require.NoError(t, err)
+
+					actual, err := validateToken(ctx, tok, keys, st.AuthUsers(), sas, nil, false)
+					if !assert.NoError(t, err) {
+						return
+					}
+					assert.True(t, actual.ServiceAccount)
+					assert.Equal(t, tc.expectScopes, actual.Scopes)
+				})
+			}
+		})
+	}
+}
+
+func Test_validateToken_userState(t *testing.T) {
+	testCases := []struct {
+		name      string
+		change    func(u *jelly.AuthUser)
+		expectErr bool
+	}{
+		{name: "unchanged", change: func(u *jelly.AuthUser) {}},
+		{name: "unrelated change", change: func(u *jelly.AuthUser) { u.Email = "marty@example.com" }},
+		{name: "password changed", change: func(u *jelly.AuthUser) { u.Password = "new-hash" }, expectErr: true},
+		{name: "logged out", change: func(u *jelly.AuthUser) { u.LastLogout = time.Now().Add(time.Second) }, expectErr: true},
+	}
+
+	for alg, keys := range testKeySets(t) {
+		keys := keys
+		t.Run(alg.String(), func(t *testing.T) {
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					ctx := context.Background()
+					users := inmem.NewAuthUserStore().AuthUsers()
+
+					user, err := users.Create(ctx, jelly.AuthUser{Username: "marty", Password: "hash"})
+					require.NoError(t, err)
+
+					tok, err := generateToken(keys, user)
+					require.NoError(t, err)
+
+					tc.change(&user)
+					_, err = users.Update(ctx, user.ID, user)
+					require.NoError(t, err)
+
+					_, err = validateToken(ctx, tok, keys, users, nil, nil, false)
+					if tc.expectErr {
+						assert.Error(t, err)
+					} else {
+						assert.NoError(t, err)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// maxTokenCacheEntries is the most tokens that a tokenCache holds at once.
+// Once it is full, tokens are not cached until some expire.
+const maxTokenCacheEntries = 10000
+
+// tokenCache holds the principals that recently validated tokens were issued
+// to, so that a burst of requests with the same token only verifies its
+// signature and looks up its principal in the DB once. Tokens are kept by
+// their hash so that the cache does not hold usable credentials. It is safe for
+// concurrent use.
+//
+// A nil *tokenCache caches nothing.
+type tokenCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mtx     sync.Mutex
+	entries map[[sha256.Size]byte]tokenCacheEntry
+}
+
+type tokenCacheEntry struct {
+	user    jelly.AuthUser
+	expires time.Time
+}
+
+// newTokenCache returns a tokenCache that keeps each token for ttl, or nil if
+// ttl is not positive.
+func newTokenCache(ttl time.Duration) *tokenCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &tokenCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[[sha256.Size]byte]tokenCacheEntry{},
+	}
+}
+
+// get returns the principal that tok was issued to if it was validated within
+// the TTL of the cache and has not been invalidated since.
+func (tc *tokenCache) get(tok string) (jelly.AuthUser, bool) {
+	if tc == nil {
+		return jelly.AuthUser{}, false
+	}
+	key := sha256.Sum256([]byte(tok))
+
+	tc.mtx.Lock()
+	defer tc.mtx.Unlock()
+
+	entry, ok := tc.entries[key]
+	if !ok {
+		return jelly.AuthUser{}, false
+	}
+	if !tc.now().Before(entry.expires) {
+		delete(tc.entries, key)
+		return jelly.AuthUser{}, false
+	}
+	return copyPrincipal(entry.user), true
+}
+
+// put caches user as the principal that the validated token tok was issued
+// to. It is kept for the TTL of the cache, or until the token expires if that
+// is sooner.
+func (tc *tokenCache) put(tok string, user jelly.AuthUser) {
+	if tc == nil {
+		return
+	}
+	now := tc.now()
+	expires := now.Add(tc.ttl)
+
+	// the signature was already verified, so the claims can be trusted
+	var claims jwt.MapClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(tok, &claims); err == nil {
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil && exp.Before(expires) {
+			expires = exp.Time
+		}
+	}
+	if !now.Before(expires) {
+		return
+	}
+
+	tc.mtx.Lock()
+	defer tc.mtx.Unlock()
+
+	if len(tc.entries) >= maxTokenCacheEntries {
+		tc.purgeExpiredUnsafe(now)
+		if len(tc.entries) >= maxTokenCacheEntries {
+			return
+		}
+	}
+	tc.entries[sha256.Sum256([]byte(tok))] = tokenCacheEntry{user: copyPrincipal(user), expires: expires}
+}
+
+// invalidate removes every token issued to the principal with the given ID,
+// such as when they log out or are changed, so that the next request with one
+// of them is validated in full.
+func (tc *tokenCache) invalidate(id uuid.UUID) {
+	if tc == nil {
+		return
+	}
+	tc.mtx.Lock()
+	defer tc.mtx.Unlock()
+
+	for key, entry := range tc.entries {
+		if entry.user.ID == id {
+			delete(tc.entries, key)
+		}
+	}
+}
+
+func (tc *tokenCache) purgeExpiredUnsafe(now time.Time) {
+	for key, entry := range tc.entries {
+		if !now.Before(entry.expires) {
+			delete(tc.entries, key)
+		}
+	}
+}
+
+// copyPrincipal returns a copy of u that shares no slices or maps with it, so
+// that the requests that a cached principal is given to cannot change it for
+// each other.
+func copyPrincipal(u jelly.AuthUser) jelly.AuthUser {
+	if u.Scopes != nil {
+		u.Scopes = append([]string{}, u.Scopes...)
+	}
+	if u.Attributes != nil {
+		attrs := make(map[string]interface{}, len(u.Attributes))
+		for k, v := range u.Attributes {
+			attrs[k] = v
+		}
+		u.Attributes = attrs
+	}
+	return u
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/authuserdao/inmem"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_tokenCache(t *testing.T) {
+	user := jelly.AuthUser{ID: uuid.New(), Username: "marty", Scopes: []string{"read"}}
+	guest := guestPrincipal(uuid.New(), "", time.Now())
+	keys := newSecretKeySet([]byte("test-secret"))
+
+	guestTok, err := generateGuestToken(keys, guest, 30*time.Second)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name      string
+		tok       string
+		user      jelly.AuthUser
+		after     time.Duration
+		invalid   uuid.UUID
+		expectHit bool
+	}{
+		{name: "within TTL", tok: "tok", user: user, after: 59 * time.Second, expectHit: true},
+		{name: "TTL passed", tok: "tok", user: user, after: time.Minute},
+		{name: "within token expiry", tok: guestTok, user: guest, after: 29 * time.Second, expectHit: true},
+		{name: "token expired before TTL", tok: guestTok, user: guest, after: 31 * time.Second},
+		{name: "other principal invalidated", tok: "tok", user: user, invalid: uuid.New(), expectHit: true},
+		{name: "principal invalidated", tok: "tok", user: user, invalid: user.ID},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			now := time.Now()
+			cache := newTokenCache(time.Minute)
+			cache.now = func() time.Time { return now }
+
+			cache.put(tc.tok, tc.user)
+			if tc.invalid != uuid.Nil {
+				cache.invalidate(tc.invalid)
+			}
+			now = now.Add(tc.after)
+
+			actual, ok := cache.get(tc.tok)
+			assert.Equal(tc.expectHit, ok)
+			if tc.expectHit {
+				assert.Equal(tc.user, actual)
+			}
+		})
+	}
+
+	t.Run("cached principal is a copy", func(t *testing.T) {
+		assert := assert.New(t)
+		cache := newTokenCache(time.Minute)
+
+		cache.put("tok", user)
+		first, _ := cache.get("tok")
+		first.Scopes[0] = "write"
+
+		second, ok := cache.get("tok")
+		assert.True(ok)
+		assert.Equal([]string{"read"}, second.Scopes)
+	})
+
+	t.Run("nil cache", func(t *testing.T) {
+		assert := assert.New(t)
+		cache := newTokenCache(0)
+
+		assert.Nil(cache)
+		cache.put("tok", user)
+		cache.invalidate(user.ID)
+		_, ok := cache.get("tok")
+		assert.False(ok)
+	})
+}
+
+func Test_jwtAuthProvider_Authenticate_tokenCache(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	store := inmem.NewAuthUserStore()
+	keys := newSecretKeySet([]byte("test-secret"))
+
+	user, err := store.AuthUsers().Create(ctx, jelly.AuthUser{Username: "marty", Password: "hash"})
+	require.NoError(t, err)
+	tok, err := generateToken(keys, user)
+	require.NoError(t, err)
+
+	svc := loginService{Provider: store, Tokens: newTokenCache(time.Minute)}
+	prov := jwtAuthProvider{db: store.AuthUsers(), keys: keys, srv: svc}
+	authenticate := func() bool {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		_, ok, _ := prov.Authenticate(req)
+		return ok
+	}
+
+	assert.True(authenticate())
+
+	// changed behind the back of the service, so the cache is not told
+	user.Password = "new-hash"
+	_, err = store.AuthUsers().Update(ctx, user.ID, user)
+	require.NoError(t, err)
+	assert.True(authenticate(), "token not served from cache")
+
+	_, err = svc.Logout(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(authenticate(), "token still cached after logout")
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// totpDigits is the number of digits in a TOTP code.
+	totpDigits = 6
+
+	// totpPeriod is the number of seconds that each TOTP code is valid for.
+	totpPeriod = 30
+
+	// totpSkew is the number of time steps before and after the current one
+	// whose codes are also accepted, to allow for clock drift.
+	totpSkew = 1
+
+	// totpSecretSize is the size in bytes of generated TOTP secrets.
+	totpSecretSize = 20
+
+	// recoveryCodeCount is the number of recovery codes generated at once.
+	recoveryCodeCount = 10
+
+	// maxTwoFactorFailures is the number of incorrect codes in a row after
+	// which two-factor login for a user is locked.
+	maxTwoFactorFailures = 5
+
+	// twoFactorLockout is how long two-factor login stays locked after the
+	// last incorrect code once maxTwoFactorFailures is reached.
+	twoFactorLockout = 15 * time.Minute
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret generates a new random base32-encoded TOTP secret.
+func generateTOTPSecret() (string, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("generate TOTP secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// totpCode returns the TOTP code for the given time step, as given in RFC 6238
+// using HMAC-SHA1.
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, bin%mod)
+}
+
+// verifyTOTP checks code against the codes generated from secret for the time
+// steps around t. Codes for steps at or before lastStep are rejected so that a
+// code cannot be used twice. If the code is valid, the step it was for is
+// returned.
+func verifyTOTP(secret, code string, t time.Time, lastStep int64) (step int64, ok bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	now := t.Unix() / totpPeriod
+	for s := now - totpSkew; s <= now+totpSkew; s++ {
+		if s <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, s)), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI returns the otpauth:// URI that authenticator apps use to set up
+// TOTP for the given account. It is typically shown to the user as a QR code.
+func totpURI(issuer, account, secret string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprintf("%d", totpDigits))
+	q.Set("period", fmt.Sprintf("%d", totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// generateRecoveryCodes generates a new set of recovery codes. The codes are
+// returned along with their hashes, which are what should be stored.
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, fmt.Errorf("generate recovery code: %w", err)
+		}
+		for j := range raw {
+			raw[j] = alphabet[int(raw[j])%len(alphabet)]
+		}
+		code := string(raw[:5]) + "-" + string(raw[5:])
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode returns the hash of a recovery code. Codes are compared
+// without regard to case or separators. Recovery codes are long and random, so
+// unlike passwords they do not need a slow hash.
+func hashRecoveryCode(code string) string {
+	norm := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(norm))
+	return hex.EncodeToString(sum[:])
+}
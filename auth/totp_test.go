@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_totpCode(t *testing.T) {
+	// the SHA1 test vectors from RFC 6238, Appendix B. The RFC gives 8-digit
+	// codes, of which ours are the last 6 digits.
+	key := []byte("12345678901234567890")
+
+	testCases := []struct {
+		name   string
+		time   int64
+		expect string
+	}{
+		{name: "59", time: 59, expect: "287082"},
+		{name: "1111111109", time: 1111111109, expect: "081804"},
+		{name: "1111111111", time: 1111111111, expect: "050471"},
+		{name: "1234567890", time: 1234567890, expect: "005924"},
+		{name: "2000000000", time: 2000000000, expect: "279037"},
+		{name: "20000000000", time: 20000000000, expect: "353130"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, totpCode(key, tc.time/totpPeriod))
+		})
+	}
+}
+
+func Test_verifyTOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := totpEncoding.EncodeToString(key)
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+
+	testCases := []struct {
+		name       string
+		code       string
+		lastStep   int64
+		expectStep int64
+		expectOK   bool
+	}{
+		{name: "current step", code: totpCode(key, step), expectStep: step, expectOK: true},
+		{name: "previous step within skew", code: totpCode(key, step-1), expectStep: step - 1, expectOK: true},
+		{name: "next step within skew", code: totpCode(key, step+1), expectStep: step + 1, expectOK: true},
+		{name: "outside of skew", code: totpCode(key, step-2)},
+		{name: "already used", code: totpCode(key, step), lastStep: step},
+		{name: "earlier than last used", code: totpCode(key, step-1), lastStep: step},
+		{name: "surrounding space", code: " " + totpCode(key, step) + " ", expectStep: step, expectOK: true},
+		{name: "wrong length", code: "12345"},
+		{name: "wrong code", code: "000000"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			actualStep, actualOK := verifyTOTP(secret, tc.code, now, tc.lastStep)
+			assert.Equal(tc.expectOK, actualOK)
+			assert.Equal(tc.expectStep, actualStep)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package jelly
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// BatchError is returned by batch operations when one or more of the items in
+// the batch could not be processed. Items in a batch are processed
+// independently, so the failure of one does not stop the others from being
+// processed.
+type BatchError struct {
+	// Errors holds the error for each item of the batch, in the same order
+	// that the items were given in. It is nil for each item that succeeded.
+	Errors []error
+}
+
+// NewBatchError returns a BatchError with the given per-item errors, or nil if
+// all of them are nil.
+func NewBatchError(errs []error) error {
+	for i := range errs {
+		if errs[i] != nil {
+			return BatchError{Errors: errs}
+		}
+	}
+	return nil
+}
+
+// Failed returns the number of items that failed.
+func (e BatchError) Failed() int {
+	var count int
+	for i := range e.Errors {
+		if e.Errors[i] != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Error returns a message giving the number of items that failed along with
+// the error of the first one.
+func (e BatchError) Error() string {
+	for i := range e.Errors {
+		if e.Errors[i] != nil {
+			return fmt.Sprintf("%d of %d batch items failed; item %d: %v", e.Failed(), len(e.Errors), i, e.Errors[i])
+		}
+	}
+	return "batch failed"
+}
+
+// BatchAuthUserRepo is an interface that can optionally be implemented by an
+// AuthUserRepo to support creating, updating, and deleting many users in a
+// single call, which may be much faster than doing so one at a time. The
+// built-in SQLite authuser store implements it.
+//
+// Each batch method returns a slice with one element per given item, in the
+// same order. If any item fails, the returned error is a BatchError giving the
+// error of each item, and the returned element of each failed item is the
+// zero value. Any other error means that the batch as a whole could not be
+// processed.
+type BatchAuthUserRepo interface {
+	AuthUserRepo
+
+	// CreateMany creates each of the given models in the DB as with Create.
+	//
+	// This returns the objects as they appear in the DB after creation.
+	CreateMany(context.Context, []AuthUser) ([]AuthUser, error)
+
+	// UpdateMany updates each of the entities in the store whose ID matches
+	// one of the given models to match it, as with Update. The IDs of entities
+	// cannot be changed by UpdateMany.
+	//
+	// This returns the objects as they appear in the DB after updating.
+	UpdateMany(context.Context, []AuthUser) ([]AuthUser, error)
+
+	// DeleteMany removes each of the entities with the given IDs from the
+	// store, as with Delete.
+	//
+	// This returns the objects as they appeared in the DB immediately before
+	// deletion.
+	DeleteMany(context.Context, []uuid.UUID) ([]AuthUser, error)
+}
@@ -0,0 +1,295 @@
+package jelly
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen is returned by Breaker.Do when the call was not made because
+// the breaker is open.
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a Breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed is the state of a Breaker that allows all calls.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen is the state of a Breaker that rejects all calls because
+	// too many have recently failed.
+	BreakerOpen
+
+	// BreakerHalfOpen is the state of a Breaker that allows a limited number
+	// of probe calls in order to check whether the dependency has recovered.
+	BreakerHalfOpen
+)
+
+func (bs BreakerState) String() string {
+	switch bs {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(bs))
+	}
+}
+
+// BreakerConfig contains options for the circuit breakers that APIs get from
+// Bundle.Breaker.
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed calls that cause a
+	// breaker to open. It will default to 5 if not set.
+	FailureThreshold int
+
+	// ResetTimeoutMillis is the amount of time (in milliseconds) that a
+	// breaker stays open before it becomes half-open and allows probe calls.
+	// It will default to 30000 (30 seconds) if not set.
+	ResetTimeoutMillis int
+
+	// HalfOpenProbes is the number of probe calls that a half-open breaker
+	// allows at once. If all of them succeed, the breaker closes; if any
+	// fails, it opens again. It will default to 1 if not set.
+	HalfOpenProbes int
+}
+
+func (bc BreakerConfig) FillDefaults() BreakerConfig {
+	newBC := bc
+
+	if newBC.FailureThreshold == 0 {
+		newBC.FailureThreshold = 5
+	}
+	if newBC.ResetTimeoutMillis == 0 {
+		newBC.ResetTimeoutMillis = 30000
+	}
+	if newBC.HalfOpenProbes == 0 {
+		newBC.HalfOpenProbes = 1
+	}
+
+	return newBC
+}
+
+func (bc BreakerConfig) Validate() error {
+	if bc.FailureThreshold < 1 {
+		return fmt.Errorf("failure_threshold: must be at least 1")
+	}
+	if bc.ResetTimeoutMillis < 1 {
+		return fmt.Errorf("reset_timeout: must be at least 1")
+	}
+	if bc.HalfOpenProbes < 1 {
+		return fmt.Errorf("half_open_probes: must be at least 1")
+	}
+
+	return nil
+}
+
+// BreakerStats are the counts of calls that a Breaker has handled since it was
+// created, for use with metrics systems.
+type BreakerStats struct {
+	// State is the current state of the breaker.
+	State BreakerState
+
+	// Successes is the number of calls that succeeded.
+	Successes int64
+
+	// Failures is the number of calls that failed.
+	Failures int64
+
+	// Rejections is the number of calls that were not made because the
+	// breaker was open.
+	Rejections int64
+
+	// Opens is the number of times that the breaker has opened.
+	Opens int64
+}
+
+// BreakerListener is called whenever a Breaker changes state.
+type BreakerListener func(b *Breaker, from, to BreakerState)
+
+// Breaker is a circuit breaker for calls to a dependency such as a database or
+// an upstream HTTP service. While the dependency is healthy, the breaker is
+// closed and calls are made as normal. Once FailureThreshold calls in a row
+// fail, the breaker opens and rejects calls without making them, which gives
+// the dependency time to recover and lets callers fail fast. After the reset
+// timeout, it becomes half-open and lets a limited number of probe calls
+// through to check if the dependency has recovered.
+//
+// Breaker is safe for concurrent use. APIs typically get one from
+// Bundle.Breaker rather than by calling NewBreaker.
+type Breaker struct {
+	name string
+	cfg  BreakerConfig
+
+	mtx         sync.Mutex
+	state       BreakerState
+	consecutive int
+	openedAt    time.Time
+	probes      int
+	probeOKs    int
+	stats       BreakerStats
+	listeners   []BreakerListener
+}
+
+// NewBreaker creates a new Breaker in the closed state. Any unset values in
+// cfg are set to their defaults.
+func NewBreaker(name string, cfg BreakerConfig) *Breaker {
+	return &Breaker{name: name, cfg: cfg.FillDefaults()}
+}
+
+// Name returns the name that the Breaker was created with.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state of the Breaker.
+func (b *Breaker) State() BreakerState {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.checkReset()
+	return b.state
+}
+
+// Stats returns the current counts of the calls the Breaker has handled.
+func (b *Breaker) Stats() BreakerStats {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.checkReset()
+	s := b.stats
+	s.State = b.state
+	return s
+}
+
+// OnStateChange registers listener to be called whenever the Breaker changes
+// state. Listeners are called synchronously in the order they were registered
+// and must not call methods of the Breaker.
+func (b *Breaker) OnStateChange(listener BreakerListener) {
+	if listener == nil {
+		return
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.listeners = append(b.listeners, listener)
+}
+
+// Do calls fn if the Breaker allows it and records whether it failed. A call
+// fails if fn returns a non-nil error, in which case that error is returned. If
+// the Breaker does not allow the call, fn is not called and ErrBreakerOpen is
+// returned.
+//
+// Errors that do not indicate a problem with the dependency, such as a
+// not-found result from a DB, should not be returned by fn, as they would
+// count towards opening the breaker.
+func (b *Breaker) Do(fn func() error) error {
+	probe, err := b.allow()
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	b.record(probe, err == nil)
+	return err
+}
+
+// allow returns whether a call may be made, and whether it is a probe call.
+func (b *Breaker) allow() (probe bool, err error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.checkReset()
+
+	switch b.state {
+	case BreakerOpen:
+		b.stats.Rejections++
+		return false, ErrBreakerOpen
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenProbes {
+			b.stats.Rejections++
+			return false, ErrBreakerOpen
+		}
+		b.probes++
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// record updates the Breaker with the result of a call.
+func (b *Breaker) record(probe bool, ok bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if ok {
+		b.stats.Successes++
+		b.consecutive = 0
+	} else {
+		b.stats.Failures++
+		b.consecutive++
+	}
+
+	// a call that started before the breaker changed state does not affect
+	// the new state, with the exception of failures while closed
+	switch b.state {
+	case BreakerClosed:
+		if b.consecutive >= b.cfg.FailureThreshold {
+			b.setState(BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		if !probe {
+			return
+		}
+		if !ok {
+			b.setState(BreakerOpen)
+			return
+		}
+		b.probeOKs++
+		if b.probeOKs >= b.cfg.HalfOpenProbes {
+			b.setState(BreakerClosed)
+		}
+	}
+}
+
+// checkReset moves an open Breaker to half-open if the reset timeout has
+// passed. b.mtx must be held by the caller.
+func (b *Breaker) checkReset() {
+	timeout := time.Duration(b.cfg.ResetTimeoutMillis) * time.Millisecond
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= timeout {
+		b.setState(BreakerHalfOpen)
+	}
+}
+
+// setState changes the state of the Breaker and notifies listeners. b.mtx must
+// be held by the caller.
+func (b *Breaker) setState(to BreakerState) {
+	from := b.state
+	if from == to {
+		return
+	}
+
+	b.state = to
+	b.consecutive = 0
+	b.probes = 0
+	b.probeOKs = 0
+	if to == BreakerOpen {
+		b.openedAt = time.Now()
+		b.stats.Opens++
+	}
+
+	for _, l := range b.listeners {
+		l(b, from, to)
+	}
+}
+
+// breakerRegistry holds the Breakers created for an API so that every caller
+// that asks for the same name gets the same Breaker.
+type breakerRegistry struct {
+	mtx      sync.Mutex
+	breakers map[string]*Breaker
+}
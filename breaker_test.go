@@ -0,0 +1,151 @@
+package jelly
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Breaker_transitions(t *testing.T) {
+	cfg := BreakerConfig{FailureThreshold: 3, ResetTimeoutMillis: 1000, HalfOpenProbes: 2}
+
+	// each call is "ok" or "fail" to make a call that succeeds or fails, or
+	// "timeout" to let the reset timeout pass.
+	testCases := []struct {
+		name              string
+		calls             []string
+		expectState       BreakerState
+		expectTransitions []string
+		expectStats       BreakerStats
+	}{
+		{
+			name:        "failures below threshold",
+			calls:       []string{"fail", "fail"},
+			expectState: BreakerClosed,
+			expectStats: BreakerStats{Failures: 2},
+		},
+		{
+			name:        "success resets consecutive failures",
+			calls:       []string{"fail", "fail", "ok", "fail", "fail"},
+			expectState: BreakerClosed,
+			expectStats: BreakerStats{Successes: 1, Failures: 4},
+		},
+		{
+			name:              "opens at threshold",
+			calls:             []string{"fail", "fail", "fail"},
+			expectState:       BreakerOpen,
+			expectTransitions: []string{"closed->open"},
+			expectStats:       BreakerStats{Failures: 3, Opens: 1},
+		},
+		{
+			name:              "rejects calls while open",
+			calls:             []string{"fail", "fail", "fail", "ok", "fail"},
+			expectState:       BreakerOpen,
+			expectTransitions: []string{"closed->open"},
+			expectStats:       BreakerStats{Failures: 3, Rejections: 2, Opens: 1},
+		},
+		{
+			name:              "half-open after reset timeout",
+			calls:             []string{"fail", "fail", "fail", "timeout"},
+			expectState:       BreakerHalfOpen,
+			expectTransitions: []string{"closed->open", "open->half-open"},
+			expectStats:       BreakerStats{Failures: 3, Opens: 1},
+		},
+		{
+			name:              "stays half-open until all probes succeed",
+			calls:             []string{"fail", "fail", "fail", "timeout", "ok"},
+			expectState:       BreakerHalfOpen,
+			expectTransitions: []string{"closed->open", "open->half-open"},
+			expectStats:       BreakerStats{Successes: 1, Failures: 3, Opens: 1},
+		},
+		{
+			name:              "closes after all probes succeed",
+			calls:             []string{"fail", "fail", "fail", "timeout", "ok", "ok"},
+			expectState:       BreakerClosed,
+			expectTransitions: []string{"closed->open", "open->half-open", "half-open->closed"},
+			expectStats:       BreakerStats{Successes: 2, Failures: 3, Opens: 1},
+		},
+		{
+			name:              "reopens when a probe fails",
+			calls:             []string{"fail", "fail", "fail", "timeout", "ok", "fail"},
+			expectState:       BreakerOpen,
+			expectTransitions: []string{"closed->open", "open->half-open", "half-open->open"},
+			expectStats:       BreakerStats{Successes: 1, Failures: 4, Opens: 2},
+		},
+		{
+			name:              "needs full threshold again after closing",
+			calls:             []string{"fail", "fail", "fail", "timeout", "ok", "ok", "fail", "fail"},
+			expectState:       BreakerClosed,
+			expectTransitions: []string{"closed->open", "open->half-open", "half-open->closed"},
+			expectStats:       BreakerStats{Successes: 2, Failures: 5, Opens: 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewBreaker("test", cfg)
+			var transitions []string
+			b.OnStateChange(func(_ *Breaker, from, to BreakerState) {
+				transitions = append(transitions, from.String()+"->"+to.String())
+			})
+
+			for i, c := range tc.calls {
+				if c == "timeout" {
+					b.mtx.Lock()
+					b.openedAt = b.openedAt.Add(-time.Duration(cfg.ResetTimeoutMillis) * time.Millisecond)
+					b.mtx.Unlock()
+					continue
+				}
+
+				wasOpen := b.State() == BreakerOpen
+				var callErr error
+				if c == "fail" {
+					callErr = errors.New("call failed")
+				}
+				called := false
+
+				err := b.Do(func() error {
+					called = true
+					return callErr
+				})
+
+				if wasOpen {
+					assert.ErrorIs(t, err, ErrBreakerOpen, "call #%d", i+1)
+					assert.False(t, called, "call #%d was made while open", i+1)
+				} else {
+					assert.Equal(t, callErr, err, "call #%d", i+1)
+					assert.True(t, called, "call #%d was not made", i+1)
+				}
+			}
+
+			assert.Equal(t, tc.expectState, b.State())
+			assert.Equal(t, tc.expectTransitions, transitions)
+
+			expectStats := tc.expectStats
+			expectStats.State = tc.expectState
+			assert.Equal(t, expectStats, b.Stats())
+		})
+	}
+}
+
+func Test_Breaker_halfOpenProbeLimit(t *testing.T) {
+	b := NewBreaker("test", BreakerConfig{FailureThreshold: 1, ResetTimeoutMillis: 1, HalfOpenProbes: 2})
+	_ = b.Do(func() error { return errors.New("call failed") })
+	time.Sleep(2 * time.Millisecond)
+
+	// probes still in progress count towards the limit
+	var errs []error
+	_ = b.Do(func() error {
+		errs = append(errs, b.Do(func() error {
+			errs = append(errs, b.Do(func() error { return nil }))
+			return nil
+		}))
+		return nil
+	})
+
+	assert.Equal(t, []error{ErrBreakerOpen, nil}, errs)
+	assert.Equal(t, BreakerClosed, b.State())
+	assert.Equal(t, int64(1), b.Stats().Rejections)
+}
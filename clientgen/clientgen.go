@@ -0,0 +1,503 @@
+// Package clientgen generates Go client packages for the routes served by a
+// jelly server. The generated code depends only on the standard library, so
+// consumers of a jelly service can use it without pulling in jelly itself.
+//
+// Routes are typically obtained from a running server by calling
+// [jelly.RESTServer.Routes] after all APIs have been added to it.
+package clientgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/dekarrin/jelly"
+)
+
+var (
+	paramPat = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+	// initialisms are words that are fully upper-cased when converted to part
+	// of a Go identifier.
+	initialisms = map[string]struct{}{
+		"api": {}, "id": {}, "uri": {}, "url": {}, "uuid": {}, "http": {},
+		"json": {}, "jwt": {}, "ip": {},
+	}
+
+	goKeywords = map[string]struct{}{
+		"break": {}, "case": {}, "chan": {}, "const": {}, "continue": {},
+		"default": {}, "defer": {}, "else": {}, "fallthrough": {}, "for": {},
+		"func": {}, "go": {}, "goto": {}, "if": {}, "import": {},
+		"interface": {}, "map": {}, "package": {}, "range": {}, "return": {},
+		"select": {}, "struct": {}, "switch": {}, "type": {}, "var": {},
+
+		// not keywords, but would shadow identifiers the generated code uses.
+		"ctx": {}, "body": {}, "out": {}, "err": {}, "c": {},
+	}
+)
+
+// Options controls code generation.
+type Options struct {
+	// Package is the name of the generated package. If not set, "client" is
+	// used.
+	Package string
+
+	// APIs limits generation to only those routes that belong to an API with
+	// one of the given names. If empty, routes for all APIs are generated.
+	APIs []string
+
+	// TrimPrefix is removed from the start of every route path before the name
+	// of its client method is derived. It does not affect the path that the
+	// client requests.
+	TrimPrefix string
+
+	// Schemas is used to look up the models that routes give request and
+	// response bodies in with jelly.Override.Request, Schema, and Response.
+	// Each model is generated as a Go type in the client, and the methods for
+	// those routes take and return them. If nil, or for routes that do not
+	// give their models, methods take a request body of any type and a value
+	// to decode the response into instead.
+	Schemas *jelly.SchemaRegistry
+}
+
+type genParam struct {
+	Name string
+	Arg  string
+}
+
+type genMethod struct {
+	Name     string
+	HTTP     string
+	Route    string
+	PathExpr string
+	Params   []genParam
+	HasBody  bool
+
+	// BodyType is the Go type of the request body if HasBody is set.
+	BodyType string
+
+	// RespType is the Go type of the response body, or empty if it is not
+	// known, in which case the method decodes it into a value of the
+	// caller's.
+	RespType string
+
+	// Summary is the summary of the method's route as given in its Override,
+	// or empty if it has none.
+	Summary string
+
+	// Deprecated is the text of the method's deprecation notice, or empty if
+	// its route is not deprecated.
+	Deprecated string
+}
+
+type genFile struct {
+	Package   string
+	NeedsURL  bool
+	NeedsTime bool
+	Types     []genType
+	Methods   []genMethod
+	APINames  string
+}
+
+// Generate returns formatted Go source code for a client package that has one
+// method for every route in routes. Each method takes a context, one string
+// argument for every path parameter in the route, and a request body for those
+// methods that accept one.
+//
+// Routes whose request or response models are given in their Override and
+// registered in opts.Schemas have typed methods: the request body is of the
+// type generated for its model, and the decoded response body is returned.
+// Other methods take a request body of any type and a value to decode the JSON
+// response into.
+//
+// Wildcard routes and routes that respond to every HTTP method (such as
+// redirects registered with chi's HandleFunc) are skipped.
+func Generate(routes []jelly.RouteInfo, opts Options) ([]byte, error) {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "client"
+	}
+	if !isIdentifier(pkg) {
+		return nil, fmt.Errorf("package name %q is not a valid identifier", pkg)
+	}
+
+	wantAPI := map[string]struct{}{}
+	for _, name := range opts.APIs {
+		wantAPI[strings.ToLower(name)] = struct{}{}
+	}
+
+	// routes that were registered for every method at once (such as the
+	// trailing-slash redirects) are not real endpoints; chi reports them with
+	// the CONNECT and TRACE methods, which jelly APIs never route directly.
+	anyMethod := map[string]struct{}{}
+	for _, r := range routes {
+		if strings.EqualFold(r.Method, http.MethodConnect) || strings.EqualFold(r.Method, http.MethodTrace) {
+			anyMethod[r.Path] = struct{}{}
+		}
+	}
+
+	f := genFile{Package: pkg}
+	types := newTypeGen(opts.Schemas)
+	usedNames := map[string]int{}
+	seenAPIs := map[string]struct{}{}
+
+	for _, r := range routes {
+		if len(wantAPI) > 0 {
+			if _, ok := wantAPI[strings.ToLower(r.API)]; !ok {
+				continue
+			}
+		}
+
+		// wildcard routes cannot be meaningfully called by a client
+		if strings.Contains(r.Path, "*") {
+			continue
+		}
+		if _, ok := anyMethod[r.Path]; ok {
+			continue
+		}
+
+		m, err := buildMethod(r, opts.TrimPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", r.Method, r.Path, err)
+		}
+		if opts.Schemas != nil {
+			if err := typeMethod(&m, r, types); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", r.Method, r.Path, err)
+			}
+		}
+
+		usedNames[m.Name]++
+		if n := usedNames[m.Name]; n > 1 {
+			m.Name = fmt.Sprintf("%s%d", m.Name, n)
+		}
+		if len(m.Params) > 0 {
+			f.NeedsURL = true
+		}
+
+		seenAPIs[r.API] = struct{}{}
+		f.Methods = append(f.Methods, m)
+	}
+
+	var apiNames []string
+	for name := range seenAPIs {
+		apiNames = append(apiNames, name)
+	}
+	sort.Strings(apiNames)
+	f.APINames = strings.Join(apiNames, ", ")
+	f.Types = types.declared()
+	f.NeedsTime = types.needsTime
+
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, f); err != nil {
+		return nil, fmt.Errorf("execute template: %w", err)
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+
+	return src, nil
+}
+
+// deprecationNotice returns the text of the deprecation notice of a method
+// whose route is deprecated as given by dep.
+func deprecationNotice(dep jelly.Deprecation) string {
+	notice := "The endpoint is deprecated."
+	if !dep.Sunset.IsZero() {
+		notice = fmt.Sprintf("The endpoint is deprecated and will be removed on %s.", dep.Sunset.UTC().Format("2006-01-02"))
+	}
+	if dep.Replacement != "" {
+		notice += fmt.Sprintf(" Use %s instead.", dep.Replacement)
+	}
+	return notice
+}
+
+func buildMethod(r jelly.RouteInfo, trimPrefix string) (genMethod, error) {
+	m := genMethod{
+		HTTP:  strings.ToUpper(r.Method),
+		Route: r.Path,
+	}
+
+	switch m.HTTP {
+	case "POST", "PUT", "PATCH":
+		m.HasBody = true
+		m.BodyType = "interface{}"
+	}
+
+	if r.Override != nil {
+		// the summary must stay on one line of the doc comment
+		m.Summary = strings.Join(strings.Fields(r.Override.Summary), " ")
+		if r.Override.Deprecated != nil {
+			m.Deprecated = deprecationNotice(*r.Override.Deprecated)
+		}
+	}
+
+	// build the name from the method and all path segments
+	var name strings.Builder
+	name.WriteString(toIdentifier(strings.ToLower(m.HTTP), true))
+
+	namePath := strings.TrimPrefix(r.Path, trimPrefix)
+	for _, seg := range strings.Split(namePath, "/") {
+		if seg == "" {
+			continue
+		}
+
+		matches := paramPat.FindAllStringSubmatch(seg, -1)
+		for _, pm := range matches {
+			name.WriteString("By")
+			name.WriteString(toIdentifier(pm[1], true))
+		}
+		literal := paramPat.ReplaceAllString(seg, " ")
+		name.WriteString(toIdentifier(literal, true))
+	}
+	m.Name = name.String()
+
+	// build the expression that creates the request path
+	usedArgs := map[string]int{}
+	var expr []string
+	last := 0
+	for _, loc := range paramPat.FindAllStringSubmatchIndex(r.Path, -1) {
+		if loc[0] > last {
+			expr = append(expr, fmt.Sprintf("%q", r.Path[last:loc[0]]))
+		}
+
+		pName := r.Path[loc[2]:loc[3]]
+		arg := toIdentifier(pName, false)
+		if arg == "" {
+			return m, fmt.Errorf("path parameter %q cannot be converted to an identifier", pName)
+		}
+		if _, ok := goKeywords[arg]; ok {
+			arg += "Param"
+		}
+		usedArgs[arg]++
+		if n := usedArgs[arg]; n > 1 {
+			arg = fmt.Sprintf("%s%d", arg, n)
+		}
+
+		m.Params = append(m.Params, genParam{Name: pName, Arg: arg})
+		expr = append(expr, "url.PathEscape("+arg+")")
+		last = loc[1]
+	}
+	if last < len(r.Path) || len(expr) == 0 {
+		expr = append(expr, fmt.Sprintf("%q", r.Path[last:]))
+	}
+	m.PathExpr = strings.Join(expr, " + ")
+
+	return m, nil
+}
+
+// typeMethod sets the types of the request and response bodies of m to those
+// of the models given for route r, generating them with types.
+func typeMethod(m *genMethod, r jelly.RouteInfo, types *typeGen) error {
+	if r.Override == nil {
+		return nil
+	}
+
+	reqSchema := r.Override.Request
+	if reqSchema == "" {
+		reqSchema = r.Override.Schema
+	}
+	if reqSchema != "" {
+		bodyType, err := types.ref(reqSchema)
+		if err != nil {
+			return fmt.Errorf("request: %w", err)
+		}
+		m.HasBody = true
+		m.BodyType = bodyType
+	}
+
+	if r.Override.Response != "" {
+		respType, err := types.ref(r.Override.Response)
+		if err != nil {
+			return fmt.Errorf("response: %w", err)
+		}
+		m.RespType = respType
+	}
+
+	return nil
+}
+
+// toIdentifier converts s to a CamelCase Go identifier, splitting words on any
+// character that is not a letter or digit. If exported is false, the first
+// word is lower-cased.
+func toIdentifier(s string, exported bool) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var sb strings.Builder
+	for i, w := range words {
+		lw := strings.ToLower(w)
+		if i == 0 && !exported {
+			sb.WriteString(lw)
+			continue
+		}
+		if _, ok := initialisms[lw]; ok {
+			sb.WriteString(strings.ToUpper(lw))
+			continue
+		}
+		sb.WriteString(strings.ToUpper(lw[:1]) + lw[1:])
+	}
+
+	id := sb.String()
+	if id != "" && unicode.IsDigit([]rune(id)[0]) {
+		id = "_" + id
+	}
+	return id
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	_, isKeyword := goKeywords[s]
+	return !isKeyword
+}
+
+var fileTemplate = template.Must(template.New("client").Parse(`// Code generated by jelly clientgen. DO NOT EDIT.
+
+// Package {{.Package}} is a client for a jelly server{{if .APINames}} providing
+// the {{.APINames}} API(s){{end}}.
+package {{.Package}}
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+{{- if .NeedsURL}}
+	"net/url"
+{{- end}}
+	"strings"
+{{- if .NeedsTime}}
+	"time"
+{{- end}}
+)
+
+// Client makes requests to a jelly server. Its zero-value is not ready for use;
+// call New to create one.
+type Client struct {
+	// BaseURL is the scheme and host of the server, e.g.
+	// "http://localhost:8080".
+	BaseURL string
+
+	// HTTPClient is used to make requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// Token, if set, is sent as a bearer token in the Authorization header of
+	// every request.
+	Token string
+}
+
+// New creates a new Client that makes requests to the server at baseURL.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// Error is returned by Client methods when the server responds with a non-2xx
+// status code.
+type Error struct {
+	Status  int    ` + "`json:\"status\"`" + `
+	Message string ` + "`json:\"error\"`" + `
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("HTTP-%d: %s", e.Status, e.Message)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request body: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.BaseURL, "/")+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response body: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{Status: resp.StatusCode}
+		if jsonErr := json.Unmarshal(respData, apiErr); jsonErr != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(respData))
+		}
+		apiErr.Status = resp.StatusCode
+		return apiErr
+	}
+
+	if out != nil && len(respData) > 0 {
+		if err := json.Unmarshal(respData, out); err != nil {
+			return fmt.Errorf("decode response body: %w", err)
+		}
+	}
+
+	return nil
+}
+{{range .Types}}
+// {{.Name}} is the model of the "{{.Schema}}" schema.
+type {{.Name}} {{.Decl}}
+{{end}}
+{{- range .Methods}}
+// {{.Name}} calls {{.HTTP}} {{.Route}}.
+{{- if .Summary}} {{.Summary}}{{end}}
+{{- if .RespType}}
+// It returns the decoded JSON response body.
+{{- else}}
+// If out is not nil, the JSON response body is decoded into it.
+{{- end}}
+{{- if .Deprecated}}
+//
+// Deprecated: {{.Deprecated}}
+{{- end}}
+{{- if .RespType}}
+func (c *Client) {{.Name}}(ctx context.Context{{range .Params}}, {{.Arg}} string{{end}}{{if .HasBody}}, body {{.BodyType}}{{end}}) ({{.RespType}}, error) {
+	var out {{.RespType}}
+	err := c.do(ctx, "{{.HTTP}}", {{.PathExpr}}, {{if .HasBody}}body{{else}}nil{{end}}, &out)
+	return out, err
+}
+{{- else}}
+func (c *Client) {{.Name}}(ctx context.Context{{range .Params}}, {{.Arg}} string{{end}}{{if .HasBody}}, body {{.BodyType}}{{end}}, out interface{}) error {
+	return c.do(ctx, "{{.HTTP}}", {{.PathExpr}}, {{if .HasBody}}body{{else}}nil{{end}}, out)
+}
+{{- end}}
+{{end}}`))
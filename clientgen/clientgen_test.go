@@ -0,0 +1,220 @@
+package clientgen
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Generate(t *testing.T) {
+	authRoutes := []jelly.RouteInfo{
+		{API: "jellyauth", Method: "GET", Path: "/auth/info/"},
+		{API: "jellyauth", Method: "POST", Path: "/auth/login/"},
+		{API: "jellyauth", Method: "DELETE", Path: "/auth/login/{id:uuid}"},
+		{API: "jellyauth", Method: "POST", Path: "/auth/tokens/"},
+		{API: "jellyauth", Method: "GET", Path: "/auth/users/"},
+		{API: "jellyauth", Method: "GET", Path: "/auth/users/{id:uuid}/"},
+		{API: "jellyauth", Method: "PATCH", Path: "/auth/users/{id:uuid}/"},
+		{API: "echo", Method: "GET", Path: "/"},
+	}
+
+	testCases := []struct {
+		name          string
+		routes        []jelly.RouteInfo
+		opts          Options
+		expectMethods []string
+		expectMissing []string
+		expectErr     bool
+	}{
+		{
+			name:          "jellyauth routes only",
+			routes:        authRoutes,
+			opts:          Options{Package: "authclient", APIs: []string{"jellyauth"}, TrimPrefix: "/auth"},
+			expectMethods: []string{"GetInfo", "PostLogin", "DeleteLoginByID", "PostTokens", "GetUsers", "GetUsersByID", "PatchUsersByID"},
+			expectMissing: []string{"Get"},
+		},
+		{
+			name:          "all APIs",
+			routes:        authRoutes,
+			expectMethods: []string{"Get", "GetAuthInfo", "DeleteAuthLoginByID"},
+		},
+		{
+			name:          "duplicate names are numbered",
+			routes:        []jelly.RouteInfo{{Method: "GET", Path: "/a-b"}, {Method: "GET", Path: "/a/b"}},
+			expectMethods: []string{"GetAB", "GetAB2"},
+		},
+		{
+			name:      "bad package name",
+			opts:      Options{Package: "func"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			src, err := Generate(tc.routes, tc.opts)
+			if tc.expectErr {
+				assert.Error(err)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+
+			f, err := parser.ParseFile(token.NewFileSet(), "client.go", src, 0)
+			if !assert.NoError(err) {
+				return
+			}
+
+			methods := map[string]bool{}
+			for _, decl := range f.Decls {
+				if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv != nil {
+					methods[fd.Name.Name] = true
+				}
+			}
+
+			for _, m := range tc.expectMethods {
+				assert.Truef(methods[m], "expected method %q to be generated", m)
+			}
+			for _, m := range tc.expectMissing {
+				assert.Falsef(methods[m], "expected method %q to not be generated", m)
+			}
+		})
+	}
+}
+
+func Test_Generate_deprecated(t *testing.T) {
+	assert := assert.New(t)
+
+	routes := []jelly.RouteInfo{
+		{Method: "GET", Path: "/old", Override: &jelly.Override{Deprecated: &jelly.Deprecation{
+			Sunset:      time.Date(2030, time.January, 2, 0, 0, 0, 0, time.UTC),
+			Replacement: "/new",
+		}}},
+		{Method: "GET", Path: "/new", Override: &jelly.Override{Summary: "Gets the\nnew thing."}},
+	}
+
+	src, err := Generate(routes, Options{})
+	if !assert.NoError(err) {
+		return
+	}
+
+	f, err := parser.ParseFile(token.NewFileSet(), "client.go", src, parser.ParseComments)
+	if !assert.NoError(err) {
+		return
+	}
+
+	docs := map[string]string{}
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv != nil {
+			docs[fd.Name.Name] = fd.Doc.Text()
+		}
+	}
+	assert.Contains(docs["GetOld"], "\nDeprecated: The endpoint is deprecated and will be removed on 2030-01-02. Use /new instead.")
+	assert.NotContains(docs["GetNew"], "Deprecated")
+	assert.Contains(docs["GetNew"], "GetNew calls GET /new. Gets the new thing.\n")
+}
+
+type testItem struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Parent  *testItem `json:"parent,omitempty"`
+	secret  string
+}
+
+type testItemList struct {
+	Items []testItem `json:"items"`
+	Total int        `json:"total"`
+}
+
+func Test_Generate_typed(t *testing.T) {
+	schemas := jelly.NewSchemaRegistry()
+	if err := schemas.Register("test.Item", testItem{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := schemas.Register("test.ItemList", testItemList{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name      string
+		routes    []jelly.RouteInfo
+		expect    []string
+		expectErr bool
+	}{
+		{
+			name: "request and response",
+			routes: []jelly.RouteInfo{
+				{Method: "POST", Path: "/items", Override: &jelly.Override{Request: "test.Item", Response: "test.Item"}},
+			},
+			expect: []string{
+				"func (c *Client) PostItems(ctx context.Context, body Item) (Item, error) {",
+				"\tParent  *Item     `json:\"parent,omitempty\"`\n",
+				"\t\"time\"\n",
+			},
+		},
+		{
+			name: "validated schema is the request",
+			routes: []jelly.RouteInfo{
+				{Method: "PUT", Path: "/items/{id}", Override: &jelly.Override{Schema: "test.Item"}},
+			},
+			expect: []string{
+				"func (c *Client) PutItemsByID(ctx context.Context, id string, body Item, out interface{}) error {",
+			},
+		},
+		{
+			name: "list response refers to other model",
+			routes: []jelly.RouteInfo{
+				{Method: "GET", Path: "/items", Override: &jelly.Override{Response: "[]test.ItemList"}},
+			},
+			expect: []string{
+				"func (c *Client) GetItems(ctx context.Context) ([]ItemList, error) {",
+				"type ItemList struct {\n\tItems []Item `json:\"items\"`\n",
+				"type Item struct {",
+			},
+		},
+		{
+			name: "untyped route",
+			routes: []jelly.RouteInfo{
+				{Method: "POST", Path: "/other"},
+			},
+			expect: []string{
+				"func (c *Client) PostOther(ctx context.Context, body interface{}, out interface{}) error {",
+			},
+		},
+		{
+			name: "unregistered schema",
+			routes: []jelly.RouteInfo{
+				{Method: "GET", Path: "/items", Override: &jelly.Override{Response: "test.Nope"}},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			src, err := Generate(tc.routes, Options{Schemas: schemas})
+			if tc.expectErr {
+				assert.Error(err)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+
+			for _, e := range tc.expect {
+				assert.Contains(string(src), e)
+			}
+			assert.NotContains(string(src), "secret")
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package clientgen
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dekarrin/jelly/auth"
+	"github.com/dekarrin/jelly/server"
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+// Test_Generate_jellyauth checks the client generated for the jellyauth API, as
+// served by a real server, against the reference output in testdata. Run with
+// -update to regenerate it after an intended change.
+func Test_Generate_jellyauth(t *testing.T) {
+	assert := assert.New(t)
+
+	confFile := filepath.Join(t.TempDir(), "jelly.yml")
+	err := os.WriteFile(confFile, []byte(`
+listen: localhost:8080
+jellyauth:
+  enabled: true
+  base: /auth
+  secret: "golden-test-secret-that-is-long-enough"
+`), 0600)
+	if !assert.NoError(err) {
+		return
+	}
+
+	env := &server.Environment{}
+	env.UseComponent(auth.Component)
+	cfg, err := env.LoadConfig(confFile)
+	if !assert.NoError(err) {
+		return
+	}
+	srv, err := env.NewServer(&cfg)
+	if !assert.NoError(err) {
+		return
+	}
+
+	src, err := Generate(srv.Routes(), Options{
+		Package:    "authclient",
+		APIs:       []string{"jellyauth"},
+		TrimPrefix: "/auth",
+		Schemas:    env.Schemas(),
+	})
+	if !assert.NoError(err) {
+		return
+	}
+
+	golden := filepath.Join("testdata", "jellyauth.go.golden")
+	if *updateGolden {
+		if err := os.WriteFile(golden, src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect, err := os.ReadFile(golden)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(string(expect), string(src))
+}
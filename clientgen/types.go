@@ -0,0 +1,210 @@
+package clientgen
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dekarrin/jelly"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+	// reservedTypeNames are the names of the types and functions that every
+	// generated package declares, which models cannot be given.
+	reservedTypeNames = map[string]struct{}{
+		"Client": {}, "Error": {}, "New": {},
+	}
+)
+
+type genType struct {
+	Name   string
+	Schema string
+	Decl   string
+}
+
+// typeGen generates the Go types of the models in a SchemaRegistry. Each
+// model that is used is declared once as a named type, and other registered
+// models that it refers to are declared as well and referred to by name.
+type typeGen struct {
+	schemas *jelly.SchemaRegistry
+
+	names     map[string]string // Go type name of each schema used so far
+	usedNames map[string]bool
+	types     []genType
+	needsTime bool
+}
+
+func newTypeGen(schemas *jelly.SchemaRegistry) *typeGen {
+	return &typeGen{
+		schemas:   schemas,
+		names:     map[string]string{},
+		usedNames: map[string]bool{},
+	}
+}
+
+// ref returns the Go type that the body of a request or response is
+// generated as, given the name of its schema as in jelly.Override.Response.
+// If the name starts with "[]", the body is a list of the model.
+func (g *typeGen) ref(schemaName string) (string, error) {
+	name := strings.TrimPrefix(schemaName, "[]")
+	prefix := schemaName[:len(schemaName)-len(name)]
+
+	s, ok := g.schemas.Get(name)
+	if !ok {
+		return "", fmt.Errorf("schema %q is not registered", name)
+	}
+	return prefix + g.model(s), nil
+}
+
+// model returns the name of the Go type of the model described by s,
+// declaring it if it has not yet been.
+func (g *typeGen) model(s jelly.Schema) string {
+	if name, ok := g.names[s.Name]; ok {
+		return name
+	}
+
+	// schema names are typically prefixed with their component, which is left
+	// out of the type name.
+	base := s.Name
+	if idx := strings.LastIndex(base, "."); idx >= 0 {
+		base = base[idx+1:]
+	}
+	if isIdentifier(base) {
+		// keep the case of names that are already CamelCase
+		base = strings.ToUpper(base[:1]) + base[1:]
+	} else {
+		base = toIdentifier(base, true)
+	}
+	if base == "" {
+		base = "Model"
+	}
+	name := base
+	for n := 2; ; n++ {
+		_, reserved := reservedTypeNames[name]
+		if !reserved && !g.usedNames[name] {
+			break
+		}
+		name = fmt.Sprintf("%s%d", base, n)
+	}
+	g.names[s.Name] = name
+	g.usedNames[name] = true
+
+	// the type is named before its declaration is generated so that
+	// recursive references to it use the name.
+	decl := g.typeExpr(s.Type, true, map[reflect.Type]bool{})
+	g.types = append(g.types, genType{Name: name, Schema: s.Name, Decl: decl})
+	return name
+}
+
+// declared returns every type that has been declared, sorted by name.
+func (g *typeGen) declared() []genType {
+	types := make([]genType, len(g.types))
+	copy(types, g.types)
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Name < types[j].Name
+	})
+	return types
+}
+
+// typeExpr returns the Go type expression of values of type t as they are
+// marshaled by encoding/json. Registered models are referred to by name
+// unless t is the model being declared, as given by top.
+func (g *typeGen) typeExpr(t reflect.Type, top bool, seen map[reflect.Type]bool) string {
+	if t.Kind() == reflect.Pointer {
+		return "*" + g.typeExpr(t.Elem(), false, seen)
+	}
+
+	if !top && t.Kind() != reflect.Interface {
+		if s, ok := g.schemas.ForType(reflect.New(t).Interface()); ok {
+			return g.model(s)
+		}
+	}
+
+	switch {
+	case t == timeType:
+		g.needsTime = true
+		return "time.Time"
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// marshals itself; could be anything
+		return "json.RawMessage"
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return t.Kind().String()
+	case reflect.Slice:
+		return "[]" + g.typeExpr(t.Elem(), false, seen)
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), g.typeExpr(t.Elem(), false, seen))
+	case reflect.Map:
+		key := "string"
+		switch t.Key().Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			key = t.Key().Kind().String()
+		}
+		return "map[" + key + "]" + g.typeExpr(t.Elem(), false, seen)
+	case reflect.Struct:
+		if seen[t] {
+			// recursive type that is not registered; cannot be named
+			return "json.RawMessage"
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		var fields strings.Builder
+		g.writeStructFields(&fields, t, seen)
+		return "struct {\n" + fields.String() + "}"
+	default:
+		return "interface{}"
+	}
+}
+
+// writeStructFields writes the declaration of each field of struct type t
+// that is marshaled by encoding/json to sb, including those of embedded
+// structs.
+func (g *typeGen) writeStructFields(sb *strings.Builder, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.writeStructFields(sb, ft, seen)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		sb.WriteString(f.Name)
+		sb.WriteRune(' ')
+		sb.WriteString(g.typeExpr(f.Type, false, seen))
+		if hasTag {
+			fmt.Fprintf(sb, " `json:%q`", tag)
+		}
+		sb.WriteRune('\n')
+	}
+}
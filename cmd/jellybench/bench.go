@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dekarrin/jelly"
+)
+
+// sample is the outcome of a single request.
+type sample struct {
+	route   int
+	latency time.Duration
+
+	// status is the HTTP status code of the response, or 0 if no response was
+	// received.
+	status int
+
+	// failure describes why the request failed, or is empty if it did not.
+	// Failures with the same cause have the same description, so that they
+	// can be counted together.
+	failure string
+}
+
+// bench makes the requests of a Plan.
+type bench struct {
+	plan   Plan
+	client *http.Client
+	token  string
+
+	// bodies are the encoded bodies of the routes of plan, or nil for those
+	// that have none.
+	bodies [][]byte
+
+	totalWeight int
+}
+
+// newBench returns a bench for p, which must have been filled with defaults
+// and validated.
+func newBench(p Plan) *bench {
+	b := &bench{
+		plan:   p,
+		client: &http.Client{Timeout: p.Timeout},
+		token:  p.Token,
+		bodies: make([][]byte, len(p.Routes)),
+	}
+	b.client.Transport = &http.Transport{
+		MaxIdleConnsPerHost: p.Concurrency,
+	}
+
+	for i, rt := range p.Routes {
+		if rt.Body != nil {
+			// already checked by Plan.Validate
+			b.bodies[i], _ = json.Marshal(rt.Body)
+		}
+		b.totalWeight += rt.Weight
+	}
+
+	return b
+}
+
+// login logs in with the Login of the plan, if it has one, and keeps the token
+// so that it is given with every later request.
+func (b *bench) login(ctx context.Context) error {
+	if b.plan.Login == nil {
+		return nil
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"username": b.plan.Login.Username,
+		"password": b.plan.Login.Password,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.plan.Base+b.plan.Login.Path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP-%d %s", resp.StatusCode, errorMessage(respBody))
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(respBody, &login); err != nil || login.Token == "" {
+		return fmt.Errorf("response does not have a token")
+	}
+
+	b.token = login.Token
+	return nil
+}
+
+// run makes requests until the duration of the plan has passed, the number of
+// requests in the plan have been made, or ctx is done. It returns the outcome
+// of every request.
+func (b *bench) run(ctx context.Context) []sample {
+	if b.plan.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.plan.Duration)
+		defer cancel()
+	}
+
+	// starts gives permission to start each request when the rate is limited
+	var starts <-chan time.Time
+	if b.plan.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / b.plan.Rate))
+		defer ticker.Stop()
+		starts = ticker.C
+	}
+
+	var made int64
+	var wg sync.WaitGroup
+	results := make([][]sample, b.plan.Concurrency)
+
+	for w := 0; w < b.plan.Concurrency; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(w)))
+
+			for {
+				if starts != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-starts:
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+
+				if b.plan.Requests > 0 && atomic.AddInt64(&made, 1) > int64(b.plan.Requests) {
+					return
+				}
+
+				s := b.do(ctx, b.pick(rng))
+				if s.failure != "" && ctx.Err() != nil && s.status == 0 {
+					// cut off by the end of the run; not the server's fault
+					return
+				}
+				results[w] = append(results[w], s)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var all []sample
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	return all
+}
+
+// pick chooses the index of the route to make a request to.
+func (b *bench) pick(rng *rand.Rand) int {
+	n := rng.Intn(b.totalWeight)
+	for i, rt := range b.plan.Routes {
+		if n < rt.Weight {
+			return i
+		}
+		n -= rt.Weight
+	}
+	return len(b.plan.Routes) - 1
+}
+
+// do makes a single request to the route at index i.
+func (b *bench) do(ctx context.Context, i int) sample {
+	rt := b.plan.Routes[i]
+	s := sample{route: i}
+
+	var body io.Reader
+	if b.bodies[i] != nil {
+		body = bytes.NewReader(b.bodies[i])
+	}
+	req, err := http.NewRequestWithContext(ctx, rt.Method, b.plan.Base+rt.Path, body)
+	if err != nil {
+		s.failure = "request: " + err.Error()
+		return s
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if b.token != "" && !rt.Anonymous {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+	for k, v := range rt.Headers {
+		req.Header.Set(k, v)
+	}
+
+	start := time.Now()
+	resp, err := b.client.Do(req)
+	if err != nil {
+		s.latency = time.Since(start)
+		s.failure = "transport: " + transportError(err)
+		return s
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	s.latency = time.Since(start)
+	s.status = resp.StatusCode
+
+	if err != nil {
+		s.failure = "transport: " + transportError(err)
+	} else if resp.StatusCode >= 400 {
+		s.failure = fmt.Sprintf("HTTP-%d %s", resp.StatusCode, errorMessage(respBody))
+	}
+	return s
+}
+
+// errorMessage gives the message of the jelly.ErrorResponse in body. If body
+// is not one, a generic message is given instead.
+func errorMessage(body []byte) string {
+	var errResp jelly.ErrorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
+		return errResp.Error
+	}
+	return "(response is not a jelly ErrorResponse)"
+}
+
+// transportError gives a description of err that does not include the parts
+// that differ between requests, such as the URL.
+func transportError(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timed out"
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return err.Error()
+}
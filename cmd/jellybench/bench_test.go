@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bench(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/auth/login":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"token": "tok"})
+		case "/things":
+			if req.Header.Get("Authorization") != "Bearer tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(jelly.ErrorResponse{Error: "You are not authorized to do that", Status: http.StatusUnauthorized})
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("not found"))
+		}
+	}))
+	defer srv.Close()
+
+	p := Plan{
+		Base:        srv.URL,
+		Login:       &Login{Username: "admin", Password: "admin"},
+		Concurrency: 3,
+		Requests:    30,
+		Routes: []Route{
+			{Path: "/things"},
+			{Path: "/things", Name: "anon", Anonymous: true},
+			{Path: "/missing"},
+		},
+	}.FillDefaults()
+	if !assert.NoError(p.Validate()) {
+		return
+	}
+
+	b := newBench(p)
+	if !assert.NoError(b.login(context.Background())) {
+		return
+	}
+	samples := b.run(context.Background())
+	rep := newReport(p, samples, time.Second)
+
+	assert.Equal(30, rep.Requests)
+	assert.Equal(30, rep.Routes[0].Requests+rep.Routes[1].Requests+rep.Routes[2].Requests)
+	assert.Equal(0, rep.Routes[0].Failed)
+	assert.Equal(rep.Routes[1].Requests, rep.Routes[1].Failed)
+	assert.Equal(rep.Routes[2].Requests, rep.Routes[2].Failed)
+	assert.Equal(rep.Routes[1].Failed+rep.Routes[2].Failed, rep.Failed)
+
+	causes := map[string]int{}
+	for _, f := range rep.Failures {
+		causes[f.Cause] = f.Count
+	}
+	assert.Equal(rep.Routes[1].Failed, causes["HTTP-401 You are not authorized to do that"])
+	assert.Equal(rep.Routes[2].Failed, causes["HTTP-404 (response is not a jelly ErrorResponse)"])
+}
+
+func Test_percentile(t *testing.T) {
+	testCases := []struct {
+		name   string
+		n      int
+		p      int
+		expect time.Duration
+	}{
+		{name: "p50 of 100", n: 100, p: 50, expect: 50},
+		{name: "p99 of 100", n: 100, p: 99, expect: 99},
+		{name: "p50 of 1", n: 1, p: 50, expect: 1},
+		{name: "p90 of 4", n: 4, p: 90, expect: 4},
+		{name: "p0 gives min", n: 10, p: 0, expect: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sorted := make([]time.Duration, tc.n)
+			for i := range sorted {
+				sorted[i] = time.Duration(i + 1)
+			}
+
+			assert.Equal(t, tc.expect, percentile(sorted, tc.p))
+		})
+	}
+}
+
+func Test_Plan_Validate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		plan      Plan
+		expectErr bool
+	}{
+		{name: "defaults with a route", plan: Plan{Routes: []Route{{Path: "/"}}}},
+		{name: "no routes", plan: Plan{}, expectErr: true},
+		{name: "relative path", plan: Plan{Routes: []Route{{Path: "things"}}}, expectErr: true},
+		{name: "login and token", plan: Plan{Token: "t", Login: &Login{Username: "u"}, Routes: []Route{{Path: "/"}}}, expectErr: true},
+		{name: "login without username", plan: Plan{Login: &Login{}, Routes: []Route{{Path: "/"}}}, expectErr: true},
+		{name: "bad base", plan: Plan{Base: "localhost:8080", Routes: []Route{{Path: "/"}}}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.plan.FillDefaults().Validate()
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Jellybench makes requests to a running jelly server and reports how quickly and
+how successfully they were served, so that the performance of jelly services
+can be measured the same way every time.
+
+Usage:
+
+	jellybench [flags]
+
+The requests to make are given by a plan file, by flags, or both; flags that
+are given override the values in the plan file. A plan file is YAML or JSON:
+
+	base: http://localhost:8080
+	login:
+	  username: admin
+	  password: admin
+	concurrency: 20
+	rate: 500
+	duration: 30s
+	routes:
+	  - path: /notes
+	    weight: 4
+	  - method: POST
+	    path: /notes
+	    body: {title: "bench", body: "made by jellybench"}
+	  - path: /auth/info
+	    anonymous: true
+
+If login is given, jellybench logs in once with the jellyauth login endpoint
+before the run starts and gives the token it gets back with every request that
+is not anonymous. Each request goes to one of the routes chosen at random in
+proportion to their weights.
+
+Once the run is over, the number of requests made, the throughput, and the
+latency percentiles overall and for each route are shown. Every request that
+got a response with an error status or no response at all is counted as
+failed, and failures are broken down by their cause; for error responses, that
+is the status and the message of the jelly ErrorResponse in the body.
+
+The flags are:
+
+	-f, --plan FILE
+		Load the plan from the given YAML or JSON file.
+
+	-b, --base URL
+		Make requests to the server at URL. The default is
+		'http://localhost:8080'.
+
+	-R, --route 'METHOD PATH'
+		Make requests to the given route, such as 'GET /notes'. Can be given
+		multiple times. If given, the routes of the plan file are replaced.
+
+	-u, --user USERNAME
+		Log in as USERNAME before the run starts.
+
+	-P, --password PASSWORD
+		Log in with PASSWORD. Only used with --user.
+
+	-t, --token TOKEN
+		Give TOKEN with requests instead of logging in.
+
+	-c, --concurrency N
+		Have N requests in flight at once. The default is 10.
+
+	-r, --rate N
+		Start at most N requests each second. The default is no limit.
+
+	-d, --duration DURATION
+		Make requests for DURATION, such as '30s'. The default is 10s unless
+		--requests is given.
+
+	-n, --requests N
+		Make N requests in total.
+
+	--timeout DURATION
+		Count requests that take longer than DURATION as failed. The default is
+		30s.
+
+	--json
+		Show the report as JSON instead of as tables.
+
+The exit status is non-zero if the run could not be made, such as when the plan
+is invalid or logging in fails. It is zero otherwise, even if requests failed.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/spf13/pflag"
+)
+
+const (
+	exitError = jelly.ExitError
+)
+
+var (
+	flagPlan        = pflag.StringP("plan", "f", "", "Path to the plan file")
+	flagBase        = pflag.StringP("base", "b", "", "URL of the server to make requests to")
+	flagRoutes      = pflag.StringArrayP("route", "R", nil, "Route to make requests to, as 'METHOD PATH'")
+	flagUser        = pflag.StringP("user", "u", "", "Username to log in as")
+	flagPassword    = pflag.StringP("password", "P", "", "Password to log in with")
+	flagToken       = pflag.StringP("token", "t", "", "Token to give instead of logging in")
+	flagConcurrency = pflag.IntP("concurrency", "c", 0, "Number of requests in flight at once (default 10)")
+	flagRate        = pflag.Float64P("rate", "r", 0, "Maximum requests started per second")
+	flagDuration    = pflag.DurationP("duration", "d", 0, "How long to make requests for (default 10s)")
+	flagRequests    = pflag.IntP("requests", "n", 0, "Total number of requests to make")
+	flagTimeout     = pflag.Duration("timeout", 0, "How long to wait for each response (default 30s)")
+	flagJSON        = pflag.Bool("json", false, "Show the report as JSON")
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	pflag.Parse()
+
+	var p Plan
+	if *flagPlan != "" {
+		var err error
+		p, err = loadPlan(*flagPlan)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+			return exitError
+		}
+	}
+
+	p, err := applyFlags(p)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+		return exitError
+	}
+	p = p.FillDefaults()
+	if err := p.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: plan: %s\n", err.Error())
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	b := newBench(p)
+	if err := b.login(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: log in: %s\n", err.Error())
+		return exitError
+	}
+
+	start := time.Now()
+	samples := b.run(ctx)
+	rep := newReport(p, samples, time.Since(start))
+
+	if *flagJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(rep)
+	} else {
+		err = rep.write(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: write report: %s\n", err.Error())
+		return exitError
+	}
+
+	return 0
+}
+
+// applyFlags returns p with the values of the flags that were given set in it.
+func applyFlags(p Plan) (Plan, error) {
+	if pflag.CommandLine.Changed("base") {
+		p.Base = *flagBase
+	}
+	if pflag.CommandLine.Changed("route") {
+		p.Routes = nil
+		for _, s := range *flagRoutes {
+			rt, err := parseRoute(s)
+			if err != nil {
+				return p, fmt.Errorf("--route: %w", err)
+			}
+			p.Routes = append(p.Routes, rt)
+		}
+	}
+	if pflag.CommandLine.Changed("user") {
+		login := Login{Username: *flagUser, Password: *flagPassword}
+		if p.Login != nil {
+			login.Path = p.Login.Path
+		}
+		p.Login = &login
+		p.Token = ""
+	} else if pflag.CommandLine.Changed("password") && p.Login != nil {
+		login := *p.Login
+		login.Password = *flagPassword
+		p.Login = &login
+	}
+	if pflag.CommandLine.Changed("token") {
+		p.Token = *flagToken
+		p.Login = nil
+	}
+	if pflag.CommandLine.Changed("concurrency") {
+		p.Concurrency = *flagConcurrency
+	}
+	if pflag.CommandLine.Changed("rate") {
+		p.Rate = *flagRate
+	}
+	if pflag.CommandLine.Changed("duration") {
+		p.Duration = *flagDuration
+	}
+	if pflag.CommandLine.Changed("requests") {
+		p.Requests = *flagRequests
+	}
+	if pflag.CommandLine.Changed("timeout") {
+		p.Timeout = *flagTimeout
+	}
+
+	return p, nil
+}
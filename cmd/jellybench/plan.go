@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Plan is what a run of jellybench does. It is loaded from a YAML or JSON file
+// and then overridden by any flags that are given.
+type Plan struct {
+	// Base is the URL that the paths of Routes and Login are relative to, such
+	// as "http://localhost:8080".
+	Base string `yaml:"base"`
+
+	// Login is how to get the token that is given with requests. If nil and
+	// Token is not set, requests are made without one.
+	Login *Login `yaml:"login"`
+
+	// Token is a token to give with requests instead of logging in.
+	Token string `yaml:"token"`
+
+	// Concurrency is the number of requests that are in flight at once.
+	Concurrency int `yaml:"concurrency"`
+
+	// Rate is the maximum number of requests that are started each second,
+	// across all workers. If 0, requests are made as fast as the server
+	// responds to them.
+	Rate float64 `yaml:"rate"`
+
+	// Duration is how long to make requests for. The run stops at the end of
+	// it or once Requests requests have been made, whichever is first.
+	Duration time.Duration `yaml:"duration"`
+
+	// Requests is the total number of requests to make. If 0, requests are
+	// made until Duration has passed.
+	Requests int `yaml:"requests"`
+
+	// Timeout is how long to wait for each response before counting the
+	// request as failed.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Routes are the routes to make requests to. Each request goes to one of
+	// them chosen at random, in proportion to their weights.
+	Routes []Route `yaml:"routes"`
+}
+
+// Login is how jellybench logs in to get a token. It logs in once at the start
+// of the run and gives the token with every request that is not anonymous.
+type Login struct {
+	// Path is the path of the login endpoint. The default is "/auth/login",
+	// where the jellyauth component serves it by default.
+	Path string `yaml:"path"`
+
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Route is a route that requests are made to.
+type Route struct {
+	// Name identifies the route in the report. The default is its method and
+	// path.
+	Name string `yaml:"name"`
+
+	Method string `yaml:"method"`
+	Path   string `yaml:"path"`
+
+	// Body is sent as the JSON body of each request, if set.
+	Body interface{} `yaml:"body"`
+
+	// Headers are additional headers to give with each request.
+	Headers map[string]string `yaml:"headers"`
+
+	// Weight is how often the route is chosen relative to the others. The
+	// default is 1.
+	Weight int `yaml:"weight"`
+
+	// Anonymous is whether requests to the route are made without the token.
+	Anonymous bool `yaml:"anonymous"`
+}
+
+// loadPlan reads the Plan in the given YAML or JSON file.
+func loadPlan(file string) (Plan, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	var p Plan
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return Plan{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return p, nil
+}
+
+// parseRoute parses a route given on the command line as "METHOD PATH", such
+// as "GET /notes".
+func parseRoute(s string) (Route, error) {
+	parts := strings.Fields(s)
+	if len(parts) != 2 {
+		return Route{}, fmt.Errorf("%q is not of the form \"METHOD PATH\"", s)
+	}
+	return Route{Method: parts[0], Path: parts[1]}, nil
+}
+
+// FillDefaults returns a new Plan identical to p but with unset values set to
+// their defaults and values normalized.
+func (p Plan) FillDefaults() Plan {
+	newP := p
+
+	if newP.Base == "" {
+		newP.Base = "http://localhost:8080"
+	}
+	newP.Base = strings.TrimRight(newP.Base, "/")
+	if newP.Login != nil {
+		login := *newP.Login
+		if login.Path == "" {
+			login.Path = "/auth/login"
+		}
+		newP.Login = &login
+	}
+	if newP.Concurrency == 0 {
+		newP.Concurrency = 10
+	}
+	if newP.Duration == 0 && newP.Requests == 0 {
+		newP.Duration = 10 * time.Second
+	}
+	if newP.Timeout == 0 {
+		newP.Timeout = 30 * time.Second
+	}
+
+	newP.Routes = make([]Route, len(p.Routes))
+	for i, rt := range p.Routes {
+		rt.Method = strings.ToUpper(rt.Method)
+		if rt.Method == "" {
+			rt.Method = http.MethodGet
+		}
+		if rt.Name == "" {
+			rt.Name = rt.Method + " " + rt.Path
+		}
+		if rt.Weight == 0 {
+			rt.Weight = 1
+		}
+		newP.Routes[i] = rt
+	}
+
+	return newP
+}
+
+// Validate returns an error if the Plan cannot be run. Call it on the return
+// value of FillDefaults.
+func (p Plan) Validate() error {
+	if !strings.HasPrefix(p.Base, "http://") && !strings.HasPrefix(p.Base, "https://") {
+		return fmt.Errorf("base: must be an http or https URL")
+	}
+	if p.Login != nil && p.Token != "" {
+		return fmt.Errorf("login and token cannot both be given")
+	}
+	if p.Login != nil && p.Login.Username == "" {
+		return fmt.Errorf("login: username: must not be empty")
+	}
+	if p.Concurrency < 1 {
+		return fmt.Errorf("concurrency: must be greater than 0")
+	}
+	if p.Rate < 0 {
+		return fmt.Errorf("rate: must not be negative")
+	}
+	if p.Duration < 0 {
+		return fmt.Errorf("duration: must not be negative")
+	}
+	if p.Requests < 0 {
+		return fmt.Errorf("requests: must not be negative")
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("timeout: must not be negative")
+	}
+	if len(p.Routes) < 1 {
+		return fmt.Errorf("routes: must exist and have at least one entry")
+	}
+
+	for i, rt := range p.Routes {
+		if !strings.HasPrefix(rt.Path, "/") {
+			return fmt.Errorf("routes: item #%d: path: must start with a '/'", i+1)
+		}
+		if rt.Weight < 0 {
+			return fmt.Errorf("routes: item #%d: weight: must not be negative", i+1)
+		}
+		if rt.Body != nil {
+			if _, err := json.Marshal(rt.Body); err != nil {
+				return fmt.Errorf("routes: item #%d: body: %w", i+1, err)
+			}
+		}
+	}
+
+	return nil
+}
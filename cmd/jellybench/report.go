@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Report is the summary of a run.
+type Report struct {
+	// Elapsed is how long the run took.
+	Elapsed time.Duration `json:"-"`
+
+	ElapsedSeconds float64        `json:"elapsed_seconds"`
+	Requests       int            `json:"requests"`
+	Failed         int            `json:"failed"`
+	Throughput     float64        `json:"requests_per_second"`
+	Latency        Latency        `json:"latency"`
+	Routes         []RouteReport  `json:"routes"`
+	Failures       []FailureCount `json:"failures"`
+}
+
+// RouteReport is the summary of the requests made to a single route.
+type RouteReport struct {
+	Name     string  `json:"name"`
+	Requests int     `json:"requests"`
+	Failed   int     `json:"failed"`
+	Latency  Latency `json:"latency"`
+}
+
+// Latency gives the distribution of the latencies of a set of requests, in
+// milliseconds.
+type Latency struct {
+	Min  float64 `json:"min_ms"`
+	Mean float64 `json:"mean_ms"`
+	P50  float64 `json:"p50_ms"`
+	P90  float64 `json:"p90_ms"`
+	P95  float64 `json:"p95_ms"`
+	P99  float64 `json:"p99_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+// FailureCount is the number of requests that failed for a single cause. For
+// responses with an error status, the cause is the status and the message of
+// the jelly ErrorResponse that was given.
+type FailureCount struct {
+	Cause string `json:"cause"`
+	Count int    `json:"count"`
+}
+
+// newReport summarizes the samples of a run of p that took elapsed.
+func newReport(p Plan, samples []sample, elapsed time.Duration) Report {
+	rep := Report{
+		Elapsed:        elapsed,
+		ElapsedSeconds: elapsed.Seconds(),
+		Requests:       len(samples),
+		Routes:         make([]RouteReport, len(p.Routes)),
+		Failures:       []FailureCount{},
+	}
+	if elapsed > 0 {
+		rep.Throughput = float64(len(samples)) / elapsed.Seconds()
+	}
+
+	all := make([]time.Duration, 0, len(samples))
+	byRoute := make([][]time.Duration, len(p.Routes))
+	failures := map[string]int{}
+
+	for _, s := range samples {
+		all = append(all, s.latency)
+		byRoute[s.route] = append(byRoute[s.route], s.latency)
+		if s.failure != "" {
+			rep.Failed++
+			rep.Routes[s.route].Failed++
+			failures[s.failure]++
+		}
+	}
+
+	rep.Latency = latencyOf(all)
+	for i, rt := range p.Routes {
+		rep.Routes[i].Name = rt.Name
+		rep.Routes[i].Requests = len(byRoute[i])
+		rep.Routes[i].Latency = latencyOf(byRoute[i])
+	}
+
+	for cause, count := range failures {
+		rep.Failures = append(rep.Failures, FailureCount{Cause: cause, Count: count})
+	}
+	sort.Slice(rep.Failures, func(i, j int) bool {
+		if rep.Failures[i].Count == rep.Failures[j].Count {
+			return rep.Failures[i].Cause < rep.Failures[j].Cause
+		}
+		return rep.Failures[i].Count > rep.Failures[j].Count
+	})
+
+	return rep
+}
+
+// latencyOf gives the distribution of the given latencies. The order of
+// latencies is changed.
+func latencyOf(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+
+	return Latency{
+		Min:  ms(latencies[0]),
+		Mean: ms(total / time.Duration(len(latencies))),
+		P50:  ms(percentile(latencies, 50)),
+		P90:  ms(percentile(latencies, 90)),
+		P95:  ms(percentile(latencies, 95)),
+		P99:  ms(percentile(latencies, 99)),
+		Max:  ms(latencies[len(latencies)-1]),
+	}
+}
+
+// percentile gives the pth percentile of sorted by the nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// write writes rep as a human-readable table to w.
+func (rep Report) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Requests:\t%d in %s (%.1f/s)\n", rep.Requests, rep.Elapsed.Round(time.Millisecond), rep.Throughput)
+	fmt.Fprintf(tw, "Failed:\t%d", rep.Failed)
+	if rep.Requests > 0 {
+		fmt.Fprintf(tw, " (%.2f%%)", 100*float64(rep.Failed)/float64(rep.Requests))
+	}
+	fmt.Fprintf(tw, "\n\n")
+
+	fmt.Fprintf(tw, "ROUTE\tREQUESTS\tFAILED\tMIN\tMEAN\tP50\tP90\tP95\tP99\tMAX\n")
+	for _, rt := range rep.Routes {
+		writeLatencyRow(tw, rt.Name, rt.Requests, rt.Failed, rt.Latency)
+	}
+	writeLatencyRow(tw, "(all)", rep.Requests, rep.Failed, rep.Latency)
+
+	if len(rep.Failures) > 0 {
+		fmt.Fprintf(tw, "\nCOUNT\tFAILURE\n")
+		for _, f := range rep.Failures {
+			fmt.Fprintf(tw, "%d\t%s\n", f.Count, strings.ReplaceAll(f.Cause, "\n", " "))
+		}
+	}
+
+	return tw.Flush()
+}
+
+func writeLatencyRow(w io.Writer, name string, requests, failed int, l Latency) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%.1fms\n",
+		name, requests, failed, l.Min, l.Mean, l.P50, l.P90, l.P95, l.P99, l.Max)
+}
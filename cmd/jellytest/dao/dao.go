@@ -2,7 +2,10 @@
 // functions for the jellytest test server.
 package dao
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+)
 
 type Datastore struct {
 	DB *sql.DB
@@ -14,10 +17,20 @@ type Datastore struct {
 }
 
 func (ds Datastore) Close() error {
+	return ds.CloseContext(context.Background())
+}
+
+// CloseContext closes the DB and every repo. The SQLite DB is first optimized
+// for later connections, which stops once ctx is done.
+func (ds Datastore) CloseContext(ctx context.Context) error {
 	var closeErr error
 
 	if ds.DB != nil {
+		ds.DB.ExecContext(ctx, "PRAGMA optimize;")
 		closeErr = ds.DB.Close()
+		if closeErr == nil {
+			closeErr = ctx.Err()
+		}
 	}
 
 	if closeErr != nil {
@@ -108,15 +108,23 @@ type EchoAPI struct {
 }
 
 func (echo *EchoAPI) Init(cb jelly.Bundle) error {
-	jellyStore := cb.DB(0) // will exist, enforced by config.Validate
-	store, ok := jellyStore.(dao.Datastore)
-	if !ok {
-		return fmt.Errorf("received unexpected store type %T", jellyStore)
-	}
-
-	echo.store = store
 	echo.log = cb.Logger()
 	echo.uriBase = cb.Base()
+
+	if cb.DB(0) == nil && cb.DryRun() {
+		// DB is not connected for the dry run; nothing else to check
+		return nil
+	}
+	store, err := jelly.DBAs[dao.Datastore](cb, 0) // will exist, enforced by config.Validate
+	if err != nil {
+		return err
+	}
+	echo.store = store
+
+	if cb.DryRun() {
+		// do not write the templates
+		return nil
+	}
 	ctx := context.Background()
 
 	msgs := cb.GetSlice(ConfigKeyMessages)
@@ -168,7 +176,7 @@ func (api EchoAPI) httpGetEcho(em jelly.ServiceProvider) http.HandlerFunc {
 
 		err := jelly.ParseJSONRequest(req, &echoData)
 		if err != nil {
-			return em.BadRequest(err.Error(), err.Error())
+			return em.BadRequest(jelly.UserMessage(err), err.Error())
 		}
 
 		t, err := api.store.EchoTemplates.GetRandom(req.Context())
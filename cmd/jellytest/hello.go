@@ -185,18 +185,26 @@ type HelloAPI struct {
 func (api *HelloAPI) Init(cb jelly.Bundle) error {
 	api.log = cb.Logger()
 
-	jellyStore := cb.DB(0) // will exist, enforced by Validate
-	store, ok := jellyStore.(dao.Datastore)
-	if !ok {
-		return fmt.Errorf("received unexpected store type %T", jellyStore)
+	api.rudeChance = cb.GetFloat(ConfigKeyRudeness)
+	api.uriBase = cb.Base()
+
+	if cb.DB(0) == nil && cb.DryRun() {
+		// DB is not connected for the dry run; nothing else to check
+		return nil
+	}
+	store, err := jelly.DBAs[dao.Datastore](cb, 0) // will exist, enforced by Validate
+	if err != nil {
+		return err
 	}
 
-	api.rudeChance = cb.GetFloat(ConfigKeyRudeness)
 	api.nices = store.NiceTemplates
 	api.rudes = store.RudeTemplates
 	api.secrets = store.SecretTemplates
-	api.uriBase = cb.Base()
 
+	if cb.DryRun() {
+		// do not write the templates
+		return nil
+	}
 	ctx := context.Background()
 	var zeroUUID uuid.UUID
 
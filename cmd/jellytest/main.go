@@ -18,49 +18,105 @@ configured. The main endpoints of interest are:
 Additionally, the jelly auth API is started with its endpoints under /auth under
 the base URI for the server, if one is configured.
 
-An authorized admin user is created by default with username and password both
-set to 'admin'. This can be used to create further users.
+When the server is seeded with the --seed flag and the configured profile is
+'dev', an authorized admin user is created with username and password both set
+to 'admin' if it does not already exist. This can be used to create further
+users.
 
 The flags are:
 
 	-c, --conf PATH
 		Use the given file for the configuration instead of './jelly.yml'. The
 		file must be in JSON or YAML format.
+
+	--dry-run
+		Instead of starting the server, set it up without connecting to its DBs
+		and show what it would serve: its DBs and the APIs that use them, its
+		global middleware, and each route with the middleware applied to it.
+		APIs are initialized in check-only mode, so nothing is written to the
+		DBs. The exit status is non-zero if the server could not be set up,
+		which makes it suitable for checking a deployment's config in CI.
+
+	--dry-run-connect
+		Like --dry-run, but also connect to each DB and ping it if possible.
+
+	-E, --effective-conf
+		Show the loaded configuration after defaults have been applied. The
+		values of secrets and other sensitive keys are redacted.
+
+	--effective-conf-section NAME
+		With -E, show only the section at the dotted path NAME, such as
+		'jellyauth' or 'webhooks.subscriptions'.
+
+	--effective-conf-sources
+		With -E, annotate each value with where it came from: the config file,
+		an environment variable, a default, or the program itself. The
+		configuration is always shown as YAML.
+
+	--gen-client FILE
+		Instead of starting the server, generate a Go client package for its
+		routes and write it to FILE. The package is named after the directory
+		FILE is in.
+
+	--gen-client-api NAME
+		Limit client generation to the routes of the API called NAME, such as
+		'jellyauth'. Can be given multiple times.
+
+	--seed
+		Run the seed functions registered for the configured profile and load
+		the configured fixtures files before starting the server. Seeding is
+		idempotent, so it is safe to give this on every start. Besides the
+		jellyauth users, fixtures files may give message templates under
+		"templates" for the echo API and under "nice", "rude", and "secret" for
+		the hello API.
 */
 package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"net/http"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"runtime/debug"
 	"strings"
-	"time"
 
 	"github.com/dekarrin/jellog"
 	"github.com/dekarrin/jelly"
 	jellyauth "github.com/dekarrin/jelly/auth"
+	"github.com/dekarrin/jelly/clientgen"
+	"github.com/dekarrin/jelly/cmd/jellytest/dao"
 	"github.com/dekarrin/jelly/cmd/jellytest/dao/sqlite"
+	jellydebug "github.com/dekarrin/jelly/debug"
+	jellymock "github.com/dekarrin/jelly/mock"
 	"github.com/dekarrin/jelly/server"
 	"github.com/spf13/pflag"
 )
 
 const (
-	exitSuccess   = 0
-	exitError     = 1
-	exitPanic     = 2
-	exitInterrupt = 3
+	exitError = jelly.ExitError
+	exitPanic = 2
 )
 
 var exitCode int
 
+// set at build time with -ldflags "-X main.version=..." etc.
+var (
+	version string
+	commit  string
+	date    string
+)
+
 var (
 	flagConf          = pflag.StringP("config", "c", "jelly.yml", "Path to configuration file")
+	flagProfile       = pflag.StringP("profile", "p", "", "Profile of the configuration to load (default $JELLY_PROFILE)")
 	flagEffectiveConf = pflag.BoolP("effective-conf", "E", false, "Show loaded configuration")
+	flagConfSection   = pflag.String("effective-conf-section", "", "With -E, show only the given section of the configuration")
+	flagConfSources   = pflag.Bool("effective-conf-sources", false, "With -E, annotate where each value of the configuration came from")
+	flagGenClient     = pflag.String("gen-client", "", "Generate a Go client for the server's routes to the given file and exit")
+	flagGenClientAPIs = pflag.StringArray("gen-client-api", nil, "Limit client generation to the named API")
+	flagSeed          = pflag.Bool("seed", false, "Seed initial data for the configured profile before starting")
+	flagDryRun        = pflag.Bool("dry-run", false, "Show what the server would serve without connecting DBs or starting it")
+	flagDryRunConnect = pflag.Bool("dry-run-connect", false, "Like --dry-run, but connect to and ping the DBs")
 )
 
 // messageResponseBody is the body returned by the message-request endpoints.
@@ -112,29 +168,38 @@ func stacktraceSkip(stack []byte, skipLevels int) string {
 	return preContent.String() + s[start:]
 }
 
-func main() {
-	// context for signal handling. might be overkill, taking this from example
-	// located at https://pace.dev/blog/2020/02/17/repond-to-ctrl-c-interrupt-signals-gracefully-with-context-in-golang-by-mat-ryer.html
-	ctx := context.Background()
-	ctx, cancelMainContext := context.WithCancel(ctx)
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt)
-	defer func() {
-		signal.Stop(signalChan)
-		cancelMainContext()
-	}()
-	// listen for signals
-	go func() {
-		select {
-		case <-signalChan: // first signal, cancel context
-			cancelMainContext()
-		case <-ctx.Done():
+// genClient writes a generated Go client package for the routes of server to
+// file, with types for the models registered with schemas. If exactly one API
+// is given, its base path is left out of the names of the generated methods.
+func genClient(server jelly.RESTServer, conf jelly.Config, schemas *jelly.SchemaRegistry, file string, apis []string) error {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+
+	opts := clientgen.Options{
+		Package: filepath.Base(filepath.Dir(absFile)),
+		APIs:    apis,
+		Schemas: schemas,
+	}
+	if len(apis) == 1 {
+		if apiConf, ok := conf.APIs[strings.ToLower(apis[0])]; ok {
+			opts.TrimPrefix = strings.TrimRight(conf.Globals.URIBase, "/") + apiConf.Common().Base
 		}
+	}
 
-		<-signalChan // second signal, hard exit
-		os.Exit(exitInterrupt)
-	}()
+	src, err := clientgen.Generate(server.Routes(), opts)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(absFile), 0770); err != nil {
+		return err
+	}
+	return os.WriteFile(absFile, src, 0660)
+}
 
+func main() {
 	var logger jellog.Logger[string]
 	loggerSetup := false
 
@@ -152,6 +217,7 @@ func main() {
 	}()
 
 	pflag.Parse()
+	jelly.SetBuildInfo(version, commit, date)
 
 	stdErrOutput := jellog.NewStderrHandler(nil)
 	logger = jellog.New(jellog.Defaults[string]().
@@ -164,16 +230,33 @@ func main() {
 	// register our db connector
 	env.RegisterConnector(jelly.DatabaseSQLite, "messages", sqlite.New)
 
-	// mark jellyauth as in-use before loading config
+	// mark the pre-rolled components as in-use before loading config
 	env.UseComponent(jellyauth.Component)
+	env.UseComponent(jellymock.Component)
+	env.UseComponent(jellydebug.Component)
 
 	// tell jelly's config module about our config structs
 	env.RegisterConfigSection("echo", func() jelly.APIConfig { return &EchoConfig{} })
 	env.RegisterConfigSection("hello", func() jelly.APIConfig { return &HelloConfig{} })
 
+	// default admin for development
+	env.RegisterSeed("jellyauth", "dev", jellyauth.SeedUser("admin", "admin", jelly.Admin))
+
+	// allow message templates to be given in fixtures files
+	env.RegisterFixtureDecoder("echo", "templates", templateFixtureDecoder(func(ds dao.Datastore) dao.Templates { return ds.EchoTemplates }))
+	env.RegisterFixtureDecoder("hello", "nice", templateFixtureDecoder(func(ds dao.Datastore) dao.Templates { return ds.NiceTemplates }))
+	env.RegisterFixtureDecoder("hello", "rude", templateFixtureDecoder(func(ds dao.Datastore) dao.Templates { return ds.RudeTemplates }))
+	env.RegisterFixtureDecoder("hello", "secret", templateFixtureDecoder(func(ds dao.Datastore) dao.Templates { return ds.SecretTemplates }))
+
 	confPath := filepath.Clean(*flagConf)
 	logger.Infof("Loading config file %s...", confPath)
-	conf, err := env.LoadConfig(confPath)
+	var conf jelly.Config
+	var err error
+	if *flagProfile != "" {
+		conf, err = env.LoadConfigProfile(confPath, *flagProfile)
+	} else {
+		conf, err = env.LoadConfig(confPath)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
 		exitCode = exitError
@@ -184,10 +267,24 @@ func main() {
 		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
 	}
 	if *flagEffectiveConf {
-		logger.Debugf("Effective config:\n%s", string(env.DumpConfig(conf)))
+		dumpOpts := jelly.DumpOptions{Redact: true, Section: *flagConfSection, Annotate: *flagConfSources}
+		dumped, err := env.DumpConfigWith(conf, dumpOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+			exitCode = exitError
+			return
+		}
+		logger.Debugf("Effective config:\n%s", string(dumped))
 	}
 
-	server, err := env.NewServer(&conf)
+	dryRun := *flagDryRun || *flagDryRunConnect
+
+	var server jelly.RESTServer
+	if dryRun {
+		server, err = env.NewDryRunServer(&conf, jelly.DryRunOptions{ConnectDBs: *flagDryRunConnect})
+	} else {
+		server, err = env.NewServer(&conf)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
 		exitCode = exitError
@@ -206,16 +303,34 @@ func main() {
 		return
 	}
 
-	logger.Info("Starting server...")
+	if dryRun {
+		plan, err := server.Plan()
+		fmt.Println(plan.String())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+			exitCode = exitError
+		}
+		return
+	}
 
-	go func() {
-		err := server.ServeForever()
-		if errors.Is(err, http.ErrServerClosed) {
-			logger.Info("Server shutdown by request")
-		} else {
-			logger.Errorf("Server encountered a problem: %v", err)
+	if *flagGenClient != "" {
+		if err := genClient(server, conf, env.Schemas(), *flagGenClient, *flagGenClientAPIs); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: generate client: %s\n", err.Error())
+			exitCode = exitError
+			return
 		}
-	}()
+		logger.Infof("Wrote client to %s", *flagGenClient)
+		return
+	}
+
+	if *flagSeed {
+		if err := server.Seed(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: seed: %s\n", err.Error())
+			exitCode = exitError
+			return
+		}
+		logger.Infof("Seeded data for profile %q", conf.Globals.Profile)
+	}
 
 	routes := server.RoutesIndex()
 	if routes == "" {
@@ -224,32 +339,5 @@ func main() {
 	logger.Debugf("Configured routes:\n%s", routes)
 	logger.InsertBreak(jellog.LvDebug)
 
-	logger.Infof("Jelly test server listening on %s:%d; Ctrl-C (SIGINT) to stop", conf.Globals.Address, conf.Globals.Port)
-
-	// wait forever, checking for interrupt and doing clean shutdown if we get
-	// it
-	for {
-		select {
-		case <-ctx.Done():
-			// cleanup
-
-			// ctrl-C likes to write "^C" or similar in some console output, so
-			// insert a break right after that. This is not cross-platform; if
-			// an indication of ctrl C is not written, there may be an awkward
-			// break in stderr, but at least we tried.
-			logger.InsertBreak(jellog.LvAll)
-
-			logger.Info("SIGINT received; cleaning up server...")
-			err := server.Shutdown(context.Background())
-			if err != nil {
-				logger.Warn(err.Error())
-			}
-			logger.Info("Server shutdown complete")
-			return
-		default:
-			// just spinlock for a sec
-			time.Sleep(100 * time.Millisecond)
-		}
-	}
-
+	exitCode = server.Run(context.Background())
 }
@@ -33,6 +33,33 @@ func initDBWithTemplates(ctx context.Context, log jelly.Logger, repo dao.Templat
 	return nil
 }
 
+// templateFixture is a message template as it is given in fixtures files.
+type templateFixture struct {
+	Content string `yaml:"content"`
+}
+
+// templateFixtureDecoder returns a jelly.FixtureDecoder that loads message
+// templates into the repo that getRepo selects from the store of the API.
+func templateFixtureDecoder(getRepo func(dao.Datastore) dao.Templates) jelly.FixtureDecoder {
+	return func(ctx context.Context, b jelly.Bundle, decode func(v interface{}) error) error {
+		var fix templateFixture
+		if err := decode(&fix); err != nil {
+			return err
+		}
+		if fix.Content == "" {
+			return fmt.Errorf("content: must be given")
+		}
+
+		store, err := jelly.DBAs[dao.Datastore](b, 0)
+		if err != nil {
+			return err
+		}
+
+		var zeroUUID uuid.UUID
+		return initDBWithTemplates(ctx, b.Logger(), getRepo(store), zeroUUID, []string{fix.Content})
+	}
+}
+
 // Template is the representation of a message template resource.
 type Template struct {
 	ID      string `json:"id,omitempty"`
@@ -181,16 +208,16 @@ func (ep templateEndpoints) httpCreateTemplate() http.HandlerFunc {
 
 		err := jelly.ParseJSONRequest(req, &data)
 		if err != nil {
-			return ep.em.BadRequest(err.Error(), err.Error())
+			return ep.em.BadRequest(jelly.UserMessage(err), err.Error())
 		}
 
 		if err := data.Validate(ep.requireFormatVerb); err != nil {
-			return ep.em.BadRequest(err.Error(), err.Error())
+			return ep.em.BadRequest(jelly.UserMessage(err), err.Error())
 		}
 
 		newMsg, err := data.DAO()
 		if err != nil {
-			return ep.em.BadRequest(err.Error(), err.Error())
+			return ep.em.BadRequest(jelly.UserMessage(err), err.Error())
 		}
 		newMsg.Creator = user.ID
 
@@ -275,11 +302,11 @@ func (ep templateEndpoints) httpUpdateTemplate() http.HandlerFunc {
 
 		err := jelly.ParseJSONRequest(req, &submitted)
 		if err != nil {
-			return ep.em.BadRequest(err.Error(), err.Error())
+			return ep.em.BadRequest(jelly.UserMessage(err), err.Error())
 		}
 
 		if err := submitted.Validate(ep.requireFormatVerb); err != nil {
-			return ep.em.BadRequest(err.Error(), err.Error())
+			return ep.em.BadRequest(jelly.UserMessage(err), err.Error())
 		}
 
 		updateCreator := true
@@ -289,7 +316,7 @@ func (ep templateEndpoints) httpUpdateTemplate() http.HandlerFunc {
 
 		daoSubmitted, err := submitted.DAO()
 		if err != nil {
-			return ep.em.BadRequest(err.Error(), err.Error())
+			return ep.em.BadRequest(jelly.UserMessage(err), err.Error())
 		}
 		daoSubmitted.ID = id
 
@@ -0,0 +1,52 @@
+package jelly
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// LastModifiedRepo is an interface that can optionally be implemented by a
+// repo to give the time that a collection of its entities was last changed
+// without reading the entities themselves. It lets endpoints that list a
+// collection set the Last-Modified header and answer conditional requests with
+// an HTTP-304 without serializing the whole collection; see NotModifiedSince.
+// The built-in authuser stores implement it for their AuthUserRepo.
+type LastModifiedRepo interface {
+	// MaxModified returns the latest time that any entity matching filter was
+	// created, modified, or removed from the repo. The type of filter is
+	// specific to the repo; nil matches every entity that GetAll would return
+	// given ctx, including its tenant and whether archived entities are
+	// included. The built-in authuser stores only accept a nil filter.
+	//
+	// Removals must be accounted for so that the returned time changes when an
+	// entity leaves the collection. The returned time may be later than the
+	// actual last change, but it must never be earlier. If no matching entity
+	// has ever been created, the zero time is returned.
+	MaxModified(ctx context.Context, filter interface{}) (time.Time, error)
+}
+
+// NotModifiedSince returns whether req is a conditional GET or HEAD request
+// whose If-Modified-Since header gives a time at or after modified, in which
+// case the endpoint can respond with ResponseGenerator.NotModified instead of
+// the resource. Because HTTP dates only hold whole seconds, modified is
+// truncated to the second before it is compared.
+//
+// As required by RFC 9110, If-Modified-Since is ignored if req also has an
+// If-None-Match header, is not a GET or HEAD, or gives a time that cannot be
+// parsed. NotModifiedSince always returns false if modified is the zero time.
+func NotModifiedSince(req *http.Request, modified time.Time) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if modified.IsZero() || req.Header.Get("If-None-Match") != "" {
+		return false
+	}
+
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	return !modified.Truncate(time.Second).After(since)
+}
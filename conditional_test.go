@@ -0,0 +1,104 @@
+package jelly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NotModifiedSince(t *testing.T) {
+	modified := time.Date(2023, time.April, 13, 4, 13, 0, 500000000, time.UTC)
+	at := modified.Format(http.TimeFormat)
+	before := modified.Add(-time.Second).Format(http.TimeFormat)
+
+	testCases := []struct {
+		name     string
+		method   string
+		modified time.Time
+		headers  map[string]string
+		expect   bool
+	}{
+		{
+			name:     "no header",
+			method:   http.MethodGet,
+			modified: modified,
+			expect:   false,
+		},
+		{
+			name:     "same second is not modified",
+			method:   http.MethodGet,
+			modified: modified,
+			headers:  map[string]string{"If-Modified-Since": at},
+			expect:   true,
+		},
+		{
+			name:     "modified after header",
+			method:   http.MethodGet,
+			modified: modified,
+			headers:  map[string]string{"If-Modified-Since": before},
+			expect:   false,
+		},
+		{
+			name:     "HEAD is conditional",
+			method:   http.MethodHead,
+			modified: modified,
+			headers:  map[string]string{"If-Modified-Since": at},
+			expect:   true,
+		},
+		{
+			name:     "POST ignores header",
+			method:   http.MethodPost,
+			modified: modified,
+			headers:  map[string]string{"If-Modified-Since": at},
+			expect:   false,
+		},
+		{
+			name:     "If-None-Match takes precedence",
+			method:   http.MethodGet,
+			modified: modified,
+			headers:  map[string]string{"If-Modified-Since": at, "If-None-Match": `"1"`},
+			expect:   false,
+		},
+		{
+			name:     "unparsable header",
+			method:   http.MethodGet,
+			modified: modified,
+			headers:  map[string]string{"If-Modified-Since": "yesterday"},
+			expect:   false,
+		},
+		{
+			name:    "zero modified time",
+			method:  http.MethodGet,
+			headers: map[string]string{"If-Modified-Since": at},
+			expect:  false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/users", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			assert.Equal(t, tc.expect, NotModifiedSince(req, tc.modified))
+		})
+	}
+}
+
+func Test_Result_WithLastModified_notModified(t *testing.T) {
+	assert := assert.New(t)
+	modified := time.Date(2023, time.April, 13, 4, 13, 0, 0, time.FixedZone("EDT", -4*60*60))
+
+	r := Result{Status: http.StatusNotModified, IsJSON: true}.WithLastModified(modified)
+
+	w := httptest.NewRecorder()
+	r.WriteResponse(w)
+
+	assert.Equal(http.StatusNotModified, w.Code)
+	assert.Equal("Thu, 13 Apr 2023 08:13:00 GMT", w.Header().Get("Last-Modified"))
+	assert.Empty(w.Body.String())
+}
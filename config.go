@@ -2,16 +2,31 @@ package jelly
 
 import (
 	"fmt"
+	"net"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 const (
-	ConfigKeyAPIName    = "name"
-	ConfigKeyAPIBase    = "base"
-	ConfigKeyAPIEnabled = "enabled"
-	ConfigKeyAPIUsesDBs = "uses"
+	ConfigKeyAPIName      = "name"
+	ConfigKeyAPIComponent = "component"
+	ConfigKeyAPIBase      = "base"
+	ConfigKeyAPIEnabled   = "enabled"
+	ConfigKeyAPIUsesDBs   = "uses"
+
+	ConfigKeyAPICapture       = "capture"
+	ConfigKeyAPICaptureBuffer = "capture_buffer"
+	ConfigKeyAPICaptureRedact = "capture_redact"
+	ConfigKeyAPIMaxInFlight   = "max_in_flight"
+	ConfigKeyAPIEnvelope      = "envelope"
+
+	ConfigKeyAPICORS            = "cors"
+	ConfigKeyAPIRateLimit       = "ratelimit"
+	ConfigKeyAPITimeout         = "timeout"
+	ConfigKeyAPISecurityHeaders = "security_headers"
 )
 
 const (
@@ -172,6 +187,12 @@ type CommonConfig struct {
 	// Name is the name of the API. Must be unique.
 	Name string
 
+	// Component is the name of the component that the API is an instance of.
+	// This allows the same component to be used for more than one API, each
+	// in its own config section and with its own state. If not set, the API is
+	// an instance of the component with the same name as it, if there is one.
+	Component string
+
 	// Enabled is whether the API is to be enabled. By default, this is false in
 	// all cases.
 	Enabled bool
@@ -188,7 +209,63 @@ type CommonConfig struct {
 	// the root DBs listing in the Config this API is a part of. The
 	// Authenticators slice should contain only authenticators that are provided
 	// by other APIs; see their documentation for which they provide.
+	//
+	// Instead of a name, an entry may be "tag:NAME" to use every DB with the
+	// tag NAME, or a pattern such as "analytics_*" to use every DB whose name
+	// matches it, in the syntax of path.Match. See ResolveUsesDBs for how they
+	// are resolved to the names of DBs.
 	UsesDBs []string
+
+	// Capture is whether to log the bodies of every request to the API and
+	// of its responses at Trace level, for debugging. Values of fields that
+	// look like secrets are redacted first; see CaptureRedact.
+	Capture bool
+
+	// CaptureBuffer is the number of the most recent requests to the API that
+	// are kept in memory along with their responses when Capture is enabled.
+	// They can be retrieved with RESTServer.Captures. If not set, requests are
+	// only logged.
+	CaptureBuffer int
+
+	// CaptureRedact is a list of additional terms that mark a field as secret
+	// when Capture is enabled. The value of any field in a JSON or form body
+	// whose name contains one of the terms, ignoring case, is redacted. Fields
+	// containing "password", "secret", "token", or "recovery_code" are always
+	// redacted, as are fields registered with RegisterSensitive.
+	CaptureRedact []string
+
+	// MaxInFlight is the maximum number of requests to the API that may be
+	// handled at once. Requests that arrive while the maximum are being
+	// handled are rejected with an HTTP-503 instead of waiting, which keeps
+	// slow stores from being overloaded. If 0, there is no limit.
+	MaxInFlight int
+
+	// Envelope is the convention for the shape of the response bodies of
+	// resources that the API returns with ResponseGenerator.Resource. By
+	// default, resources are given with no envelope.
+	Envelope Envelope
+
+	// CORS is the CORS config of the routes of the API. If nil, it is set to
+	// the one in Globals.Defaults when the Config is filled with defaults.
+	CORS *CORSConfig
+
+	// RateLimit is the limit on the rate of requests from each client to the
+	// API, counted separately from other APIs. If nil, it is set to the one in
+	// Globals.Defaults when the Config is filled with defaults.
+	RateLimit *RateLimitConfig
+
+	// TimeoutMillis is how long, in milliseconds, each request to the API may
+	// take. The context of the request is canceled when it passes, which makes
+	// stores and other services that are given it stop with an error that
+	// ServiceProvider.FromError turns into an HTTP-504. If 0, it is set to the
+	// one in Globals.Defaults when the Config is filled with defaults. If
+	// negative, there is no timeout even if there is a default one.
+	TimeoutMillis int
+
+	// SecurityHeaders are the security headers set on every response of the
+	// API. If nil, they are set to those in Globals.Defaults when the Config
+	// is filled with defaults.
+	SecurityHeaders *SecurityHeadersConfig
 }
 
 // FillDefaults returns a new *Common identical to cc but with unset values set
@@ -224,6 +301,30 @@ func (cc *CommonConfig) Validate() error {
 	if err := validateBaseURI(cc.Base); err != nil {
 		return fmt.Errorf(ConfigKeyAPIBase+": %w", err)
 	}
+	if cc.CaptureBuffer < 0 {
+		return fmt.Errorf(ConfigKeyAPICaptureBuffer + ": must not be negative")
+	}
+	if cc.MaxInFlight < 0 {
+		return fmt.Errorf(ConfigKeyAPIMaxInFlight + ": must not be negative")
+	}
+	if _, err := ParseEnvelope(string(cc.Envelope)); err != nil {
+		return fmt.Errorf(ConfigKeyAPIEnvelope+": %w", err)
+	}
+	if cc.CORS != nil {
+		if err := cc.CORS.Validate(); err != nil {
+			return fmt.Errorf(ConfigKeyAPICORS+": %w", err)
+		}
+	}
+	if cc.RateLimit != nil {
+		if err := cc.RateLimit.Validate(); err != nil {
+			return fmt.Errorf(ConfigKeyAPIRateLimit+": %w", err)
+		}
+	}
+	if cc.SecurityHeaders != nil {
+		if err := cc.SecurityHeaders.Validate(); err != nil {
+			return fmt.Errorf(ConfigKeyAPISecurityHeaders+": %w", err)
+		}
+	}
 
 	return nil
 }
@@ -233,19 +334,39 @@ func (cc *CommonConfig) Common() CommonConfig {
 }
 
 func (cc *CommonConfig) Keys() []string {
-	return []string{ConfigKeyAPIName, ConfigKeyAPIEnabled, ConfigKeyAPIBase, ConfigKeyAPIUsesDBs}
+	return []string{ConfigKeyAPIName, ConfigKeyAPIComponent, ConfigKeyAPIEnabled, ConfigKeyAPIBase, ConfigKeyAPIUsesDBs, ConfigKeyAPICapture, ConfigKeyAPICaptureBuffer, ConfigKeyAPICaptureRedact, ConfigKeyAPIMaxInFlight, ConfigKeyAPIEnvelope, ConfigKeyAPICORS, ConfigKeyAPIRateLimit, ConfigKeyAPITimeout, ConfigKeyAPISecurityHeaders}
 }
 
 func (cc *CommonConfig) Get(key string) interface{} {
 	switch strings.ToLower(key) {
 	case ConfigKeyAPIName:
 		return cc.Name
+	case ConfigKeyAPIComponent:
+		return cc.Component
 	case ConfigKeyAPIEnabled:
 		return cc.Enabled
 	case ConfigKeyAPIBase:
 		return cc.Base
 	case ConfigKeyAPIUsesDBs:
 		return cc.UsesDBs
+	case ConfigKeyAPICapture:
+		return cc.Capture
+	case ConfigKeyAPICaptureBuffer:
+		return cc.CaptureBuffer
+	case ConfigKeyAPICaptureRedact:
+		return cc.CaptureRedact
+	case ConfigKeyAPIMaxInFlight:
+		return cc.MaxInFlight
+	case ConfigKeyAPIEnvelope:
+		return cc.Envelope
+	case ConfigKeyAPICORS:
+		return cc.CORS
+	case ConfigKeyAPIRateLimit:
+		return cc.RateLimit
+	case ConfigKeyAPITimeout:
+		return cc.TimeoutMillis
+	case ConfigKeyAPISecurityHeaders:
+		return cc.SecurityHeaders
 	default:
 		return nil
 	}
@@ -260,6 +381,13 @@ func (cc *CommonConfig) Set(key string, value interface{}) error {
 		} else {
 			return fmt.Errorf("key '"+ConfigKeyAPIName+"' requires a string but got a %T", value)
 		}
+	case ConfigKeyAPIComponent:
+		if valueStr, ok := value.(string); ok {
+			cc.Component = strings.ToLower(valueStr)
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyAPIComponent+"' requires a string but got a %T", value)
+		}
 	case ConfigKeyAPIEnabled:
 		if valueBool, ok := value.(bool); ok {
 			cc.Enabled = valueBool
@@ -281,6 +409,88 @@ func (cc *CommonConfig) Set(key string, value interface{}) error {
 		} else {
 			return fmt.Errorf("key '"+ConfigKeyAPIUsesDBs+"' requires a []string but got a %T", value)
 		}
+	case ConfigKeyAPICapture:
+		if valueBool, ok := value.(bool); ok {
+			cc.Capture = valueBool
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyAPICapture+"' requires a bool but got a %T", value)
+		}
+	case ConfigKeyAPICaptureBuffer:
+		if valueInt, ok := value.(int); ok {
+			cc.CaptureBuffer = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyAPICaptureBuffer+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyAPICaptureRedact:
+		valueSlice, err := TypedSlice[string](ConfigKeyAPICaptureRedact, value)
+		if err == nil {
+			cc.CaptureRedact = valueSlice
+		}
+		return err
+	case ConfigKeyAPIMaxInFlight:
+		if valueInt, ok := value.(int); ok {
+			cc.MaxInFlight = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyAPIMaxInFlight+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyAPIEnvelope:
+		switch v := value.(type) {
+		case Envelope:
+			cc.Envelope = v
+			return nil
+		case string:
+			env, err := ParseEnvelope(v)
+			if err != nil {
+				return err
+			}
+			cc.Envelope = env
+			return nil
+		default:
+			return fmt.Errorf("key '"+ConfigKeyAPIEnvelope+"' requires a string but got a %T", value)
+		}
+	case ConfigKeyAPICORS:
+		switch v := value.(type) {
+		case *CORSConfig:
+			cc.CORS = v
+			return nil
+		case CORSConfig:
+			cc.CORS = &v
+			return nil
+		default:
+			return fmt.Errorf("key '"+ConfigKeyAPICORS+"' requires a *CORSConfig but got a %T", value)
+		}
+	case ConfigKeyAPIRateLimit:
+		switch v := value.(type) {
+		case *RateLimitConfig:
+			cc.RateLimit = v
+			return nil
+		case RateLimitConfig:
+			cc.RateLimit = &v
+			return nil
+		default:
+			return fmt.Errorf("key '"+ConfigKeyAPIRateLimit+"' requires a *RateLimitConfig but got a %T", value)
+		}
+	case ConfigKeyAPITimeout:
+		if valueInt, ok := value.(int); ok {
+			cc.TimeoutMillis = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyAPITimeout+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyAPISecurityHeaders:
+		switch v := value.(type) {
+		case *SecurityHeadersConfig:
+			cc.SecurityHeaders = v
+			return nil
+		case SecurityHeadersConfig:
+			cc.SecurityHeaders = &v
+			return nil
+		default:
+			return fmt.Errorf("key '"+ConfigKeyAPISecurityHeaders+"' requires a *SecurityHeadersConfig but got a %T", value)
+		}
 	default:
 		return fmt.Errorf("not a valid key: %q", key)
 	}
@@ -288,25 +498,89 @@ func (cc *CommonConfig) Set(key string, value interface{}) error {
 
 func (cc *CommonConfig) SetFromString(key string, value string) error {
 	switch strings.ToLower(key) {
-	case ConfigKeyAPIName, ConfigKeyAPIBase:
+	case ConfigKeyAPIName, ConfigKeyAPIComponent, ConfigKeyAPIBase, ConfigKeyAPIEnvelope:
 		return cc.Set(key, value)
-	case ConfigKeyAPIEnabled:
+	case ConfigKeyAPIEnabled, ConfigKeyAPICapture:
 		b, err := strconv.ParseBool(value)
 		if err != nil {
 			return err
 		}
 		return cc.Set(key, b)
-	case ConfigKeyAPIUsesDBs:
+	case ConfigKeyAPICaptureBuffer, ConfigKeyAPIMaxInFlight, ConfigKeyAPITimeout:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		return cc.Set(key, n)
+	case ConfigKeyAPIUsesDBs, ConfigKeyAPICaptureRedact:
 		if value == "" {
 			return cc.Set(key, []string{})
 		}
 		dbsStrSlice := strings.Split(value, ",")
 		return cc.Set(key, dbsStrSlice)
+	case ConfigKeyAPICORS, ConfigKeyAPIRateLimit, ConfigKeyAPISecurityHeaders:
+		return fmt.Errorf("key %q cannot be set from a string", key)
 	default:
 		return fmt.Errorf("not a valid key: %q", key)
 	}
 }
 
+// ListenAddress returns the address that the server listens on, in
+// "ADDRESS:PORT" form with IPv6 addresses in brackets. It does not include
+// ExtraListen.
+func (g Globals) ListenAddress() string {
+	return net.JoinHostPort(g.Address, strconv.Itoa(g.Port))
+}
+
+// ParseListenAddress parses a listen address in "ADDRESS:PORT" or ":PORT" form
+// into its address and port. IPv6 addresses must be given in brackets, as in
+// "[::1]:8080", and are returned without them. Brackets may not be used for
+// anything other than an IPv6 address.
+func ParseListenAddress(s string) (address string, port int, err error) {
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return "", 0, fmt.Errorf("%q has an unclosed \"[\"", s)
+		}
+		address = s[1:end]
+
+		// a zone, as in "fe80::1%eth0", is not part of the IP
+		ip, _, _ := strings.Cut(address, "%")
+		if parsed := net.ParseIP(ip); parsed == nil || parsed.To4() != nil {
+			return "", 0, fmt.Errorf("%q is not an IPv6 address; only IPv6 addresses are put in brackets", address)
+		}
+
+		rest := s[end+1:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", 0, fmt.Errorf("not in \"[ADDRESS]:PORT\" format")
+		}
+		port, err = parsePort(rest[1:])
+		return address, port, err
+	}
+
+	colon := strings.LastIndex(s, ":")
+	if colon < 0 {
+		return "", 0, fmt.Errorf("not in \"ADDRESS:PORT\" or \":PORT\" format")
+	}
+	address = s[:colon]
+	if strings.Contains(address, ":") {
+		return "", 0, fmt.Errorf("IPv6 address must be in brackets, as in \"[%s]:%s\"", address, s[colon+1:])
+	}
+	if strings.ContainsAny(address, "[]") {
+		return "", 0, fmt.Errorf("%q has an unopened \"]\"", s)
+	}
+	port, err = parsePort(s[colon+1:])
+	return address, port, err
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, fmt.Errorf("%q is not a valid port number", s)
+	}
+	return port, nil
+}
+
 // LogConfig contains logging options. Loggers are provided to APIs in the form of
 // sub-components of the primary logger. If logging is enabled, the Jelly server
 // will configure the logger of the chosen provider and use it for messages
@@ -349,14 +623,25 @@ func (g LogConfig) Validate() error {
 // config. These values are shared with every API.
 type Globals struct {
 
-	// Port is the port that the server will listen on. It will default to 8080
-	// if none is given.
+	// Port is the port that the server will listen on. If 0, an ephemeral port
+	// is chosen by the OS when the server starts serving; the port that was
+	// chosen can be gotten with RESTServer.Addr. This allows several servers,
+	// such as those started by integration tests run in parallel, to run at
+	// once without picking ports ahead of time.
 	Port int
 
 	// Address is the internet address that the server will listen on. It will
-	// default to "localhost" if none is given.
+	// default to "localhost" if none is given. IPv6 addresses are given
+	// without brackets, as in "::1".
 	Address string
 
+	// ExtraListen is other addresses that the server listens on along with
+	// Address and Port, each in "ADDRESS:PORT" form with IPv6 addresses in
+	// brackets, as in "[::1]:8080". This allows the server to listen on both
+	// IPv4 and IPv6 addresses, or on more than one interface. It cannot be
+	// used with HotRestart. By default, there are none.
+	ExtraListen []string
+
 	// URIBase is the base path that all APIs are rooted on. It will default to
 	// "/", which is equivalent to being directly on root.
 	URIBase string
@@ -364,34 +649,369 @@ type Globals struct {
 	// The main auth provider to use for the project. Must be the
 	// fully-qualified name of it, e.g. COMPONENT.PROVIDER format.
 	MainAuthProvider string
+
+	// Tenancy is the configuration for resolving the tenant of requests. By
+	// default, tenancy is disabled.
+	Tenancy TenancyConfig
+
+	// Mirror is the configuration for mirroring requests to a secondary
+	// upstream. By default, mirroring is disabled.
+	Mirror MirrorConfig
+
+	// Breaker is the configuration of the circuit breakers that APIs get from
+	// Bundle.Breaker.
+	Breaker BreakerConfig
+
+	// Quota is the configuration of the quotas that APIs get from
+	// Bundle.Quotas. By default, no quotas are defined.
+	Quota QuotaConfig
+
+	// Flags is the configuration of the feature flags that APIs get from
+	// Bundle.Flags. It is not used if the server's Environment was given a
+	// FlagProvider. By default, no flags are defined.
+	Flags FlagConfig
+
+	// Webhooks is the configuration for delivering the events that APIs
+	// publish on the server's EventBus to webhooks. By default, there are no
+	// webhook subscriptions.
+	Webhooks WebhookConfig
+
+	// GRPC is the configuration for serving gRPC services alongside the HTTP
+	// APIs. By default, gRPC is disabled.
+	GRPC GRPCConfig
+
+	// TLS is the configuration for serving HTTPS. By default, TLS is disabled
+	// and the server serves plain HTTP.
+	TLS TLSConfig
+
+	// IDs is the configuration for generating the IDs of new entities, which
+	// APIs get from Bundle.IDs and which is given to every DB whose store
+	// implements IDGeneratorStore. By default, IDs are version 4 UUIDs.
+	IDs IDConfig
+
+	// Encryption is the configuration of the keys that sensitive fields of
+	// models are encrypted with where they are stored, which are given to every
+	// DB whose store implements FieldCipherStore. By default, there are no
+	// keys and fields are not encrypted.
+	Encryption EncryptionConfig
+
+	// I18n is the configuration for localizing the messages of error
+	// responses. By default, messages are only localized with catalogs that
+	// are registered with the Environment, and "en" is the fallback locale.
+	I18n I18nConfig
+
+	// Info is the configuration for the server info endpoint. By default, it
+	// is disabled.
+	Info InfoConfig
+
+	// Admin is the configuration for the admin endpoints that disable and
+	// re-enable APIs at runtime and give runtime profiles. By default, they
+	// are disabled.
+	Admin AdminConfig
+
+	// CORS is the configuration of the "cors" built-in middleware. By
+	// default, no cross-origin requests are allowed.
+	CORS CORSConfig
+
+	// RateLimit is the configuration of the "ratelimit" built-in middleware.
+	// By default, there is no limit.
+	RateLimit RateLimitConfig
+
+	// Defaults are the CORS, rate limit, timeout, and security headers of
+	// every API that does not set its own in its section. By default, none
+	// are set.
+	Defaults APIDefaults
+
+	// ShutdownTimeoutMillis is the maximum amount of time (in milliseconds)
+	// that RESTServer.Run waits for the server to shut down gracefully. It will
+	// default to 30000 (30 seconds) if not set.
+	ShutdownTimeoutMillis int
+
+	// HotRestart is whether RESTServer.Run upgrades the server in place when
+	// the process receives SIGUSR2. The program is exec'd again as a new
+	// process that inherits the listening socket, and once the new process is
+	// ready to serve, the old one shuts down gracefully; no connections are
+	// refused during the upgrade. It is not supported on Windows.
+	HotRestart bool
+
+	// ReloadConfig is whether RESTServer.Run reloads the config when the file
+	// or directory that it was loaded from changes, such as when a mounted
+	// Kubernetes ConfigMap is updated. The reload is done with a hot restart,
+	// so HotRestart must also be enabled; if the new process fails to load the
+	// changed config, the old one continues serving with the config that it
+	// has. It has no effect if the Config was not created by a call to Load.
+	ReloadConfig bool
+
+	// RouteStats is whether the server keeps statistics on the requests made
+	// to each route since it started, giving the number of requests, the
+	// fraction of them that failed, their latencies, and the size of their
+	// responses. If enabled, the stats are included in RESTServer.Routes and
+	// RESTServer.RoutesIndex.
+	RouteStats bool
+
+	// UnauthLog is the path to a file that every request rejected with an
+	// HTTP-401 is logged to, with one line per request giving the address of
+	// the client, the method and path of the request, and the type of the
+	// credentials it gave. It is separate from the server log so that tools
+	// such as fail2ban can watch it for clients that repeatedly fail to log in.
+	// The rejections are counted in RESTServer.UnauthStats whether or not this
+	// is set. If empty, they are not logged.
+	UnauthLog string
+
+	// RequireContentType is whether endpoints that do not declare the media
+	// types they accept with Override.Accepts only accept request bodies of
+	// "application/json". Requests to them that have a body of another type
+	// are responded to with an HTTP-415 without the endpoint being called.
+	// Endpoints that set Override.Accepts are checked whether or not this is
+	// set.
+	RequireContentType bool
+
+	// MaxInFlight is the maximum number of requests that the server handles
+	// at once, across all APIs. Requests that arrive while the maximum are
+	// being handled are rejected with an HTTP-503 instead of waiting. It is
+	// separate from the limit that each API may have. If 0, there is no
+	// limit.
+	MaxInFlight int
+
+	// Profile is the name of the environment profile that the server runs
+	// as, such as "dev" or "test". It selects which of the seed functions
+	// registered with the server's Environment are run when the server is
+	// seeded; seed functions registered for no profile are run in every
+	// profile. It defaults to "", which runs only those. It is set to the
+	// profile that was selected when the config was loaded, if any.
+	Profile string
+
+	// Fixtures is the paths to fixtures files, in YAML or JSON format, whose
+	// entities are inserted into the stores of the APIs when the server is
+	// seeded, after the seed functions have run. Files are loaded in the
+	// order given. By default, no fixtures are loaded.
+	Fixtures []string
+
+	// Middleware is the names of the built-in middleware that the server
+	// applies to every request before passing it to an API, in the order that
+	// they are applied. Each must be one of the Middleware* constants and may
+	// only be given once. If nil, it will default to "recover", "tenant",
+	// "cors", "ratelimit", "mirror", and "quota", in that order. Additional
+	// middleware can be inserted into the chain with RESTServer.UseBefore and
+	// RESTServer.UseAfter.
+	Middleware []string
+}
+
+// Names of the built-in middleware that can be given in Globals.Middleware.
+const (
+	// MiddlewareRecover recovers from panics that occur while handling a
+	// request and responds with an HTTP-500.
+	MiddlewareRecover = "recover"
+
+	// MiddlewareTenant resolves the tenant of each request as configured in
+	// Globals.Tenancy. It has no effect if tenancy is not enabled.
+	MiddlewareTenant = "tenant"
+
+	// MiddlewareRequestID gives each request an ID, which is taken from the
+	// X-Request-Id header if the client gave one.
+	MiddlewareRequestID = "request_id"
+
+	// MiddlewareRealIP sets the remote address of each request to the client
+	// address given in the X-Real-IP or X-Forwarded-For header, if present. It
+	// must only be used when the server is behind a proxy that sets those
+	// headers, as otherwise clients can give any address they wish. When it is
+	// used, Bundle.Absolute also trusts the X-Forwarded-Proto and
+	// X-Forwarded-Host headers.
+	MiddlewareRealIP = "real_ip"
+
+	// MiddlewareMirror sends a copy of requests to the upstream configured in
+	// Globals.Mirror. It has no effect if mirroring is not enabled.
+	MiddlewareMirror = "mirror"
+
+	// MiddlewareQuota uses one of each quota in Globals.Quota that is per
+	// request for every request made by a logged-in user, and responds with
+	// an HTTP-429 if any of them have been exceeded. It has no effect if no
+	// quotas are per request.
+	MiddlewareQuota = "quota"
+
+	// MiddlewareAccessLog logs each request made to the server at info level,
+	// along with the status and size of its response and how long it took.
+	// For responses written by a Result, the size before compression and the
+	// time taken by the endpoint and by marshaling are logged as well; see
+	// ResponseMetrics. If MiddlewareRequestID comes before it, the ID of the
+	// request is logged too.
+	MiddlewareAccessLog = "access_log"
+
+	// MiddlewareCORS allows cross-origin requests as configured in
+	// Globals.CORS. It has no effect if no origins are allowed.
+	MiddlewareCORS = "cors"
+
+	// MiddlewareRateLimit limits the rate of requests from each client as
+	// configured in Globals.RateLimit, and responds with an HTTP-429 to those
+	// over the limit. It has no effect if there is no limit.
+	MiddlewareRateLimit = "ratelimit"
+)
+
+// builtinMiddleware is the set of names of all built-in middleware.
+var builtinMiddleware = map[string]struct{}{
+	MiddlewareRecover:   {},
+	MiddlewareTenant:    {},
+	MiddlewareRequestID: {},
+	MiddlewareRealIP:    {},
+	MiddlewareMirror:    {},
+	MiddlewareQuota:     {},
+	MiddlewareAccessLog: {},
+	MiddlewareCORS:      {},
+	MiddlewareRateLimit: {},
 }
 
 func (g Globals) FillDefaults() Globals {
 	newG := g
 
-	if newG.Port == 0 {
-		newG.Port = 8080
-	}
+	newG.Tenancy = newG.Tenancy.FillDefaults()
+	newG.Mirror = newG.Mirror.FillDefaults()
+	newG.Breaker = newG.Breaker.FillDefaults()
+	newG.Quota = newG.Quota.FillDefaults()
+	newG.Flags = newG.Flags.FillDefaults()
+	newG.Webhooks = newG.Webhooks.FillDefaults()
+	newG.GRPC = newG.GRPC.FillDefaults()
+	newG.TLS = newG.TLS.FillDefaults()
+	newG.IDs = newG.IDs.FillDefaults()
+	newG.Encryption = newG.Encryption.FillDefaults()
+	newG.I18n = newG.I18n.FillDefaults()
+	newG.Info = newG.Info.FillDefaults()
+	newG.Admin = newG.Admin.FillDefaults()
+	newG.CORS = newG.CORS.FillDefaults()
+	newG.RateLimit = newG.RateLimit.FillDefaults()
+	newG.Defaults = newG.Defaults.FillDefaults()
+
 	if newG.Address == "" {
 		newG.Address = "localhost"
 	}
 	if newG.URIBase == "" {
 		newG.URIBase = "/"
 	}
+	if newG.GRPC.Port != 0 && newG.GRPC.Address == "" {
+		newG.GRPC.Address = newG.Address
+	}
+	if newG.ShutdownTimeoutMillis == 0 {
+		newG.ShutdownTimeoutMillis = 30000
+	}
+	if newG.Middleware == nil {
+		newG.Middleware = []string{MiddlewareRecover, MiddlewareTenant, MiddlewareCORS, MiddlewareRateLimit, MiddlewareMirror, MiddlewareQuota}
+	}
 
 	return newG
 }
 
 func (g Globals) Validate() error {
-	if g.Port < 1 {
-		return fmt.Errorf("port: must be greater than 0")
+	if g.Port < 0 {
+		return fmt.Errorf("port: must not be negative")
 	}
 	if g.Address == "" {
 		return fmt.Errorf("address: must not be empty")
 	}
+	if len(g.ExtraListen) > 0 {
+		if g.HotRestart {
+			return fmt.Errorf("listen: more than one address cannot be used with hot_restart")
+		}
+
+		seen := map[string]bool{g.ListenAddress(): true}
+		for i, extra := range g.ExtraListen {
+			addr, port, err := ParseListenAddress(extra)
+			if err != nil {
+				return fmt.Errorf("listen[%d]: %w", i+1, err)
+			}
+			norm := net.JoinHostPort(addr, strconv.Itoa(port))
+			if port != 0 && seen[norm] {
+				return fmt.Errorf("listen[%d]: %s is given more than once", i+1, norm)
+			}
+			seen[norm] = true
+		}
+	}
 	if err := validateBaseURI(g.URIBase); err != nil {
 		return fmt.Errorf("base: %w", err)
 	}
+	if err := g.Tenancy.Validate(); err != nil {
+		return fmt.Errorf("tenancy: %w", err)
+	}
+	if err := g.Mirror.Validate(); err != nil {
+		return fmt.Errorf("mirror: %w", err)
+	}
+	if err := g.Breaker.Validate(); err != nil {
+		return fmt.Errorf("breaker: %w", err)
+	}
+	if err := g.Quota.Validate(); err != nil {
+		return fmt.Errorf("quota: %w", err)
+	}
+	if err := g.Flags.Validate(); err != nil {
+		return fmt.Errorf("flags: %w", err)
+	}
+	if err := g.Webhooks.Validate(); err != nil {
+		return fmt.Errorf("webhooks: %w", err)
+	}
+	if err := g.GRPC.Validate(); err != nil {
+		return fmt.Errorf("grpc: %w", err)
+	}
+	if g.GRPC.Enabled && g.GRPC.Port != 0 {
+		if g.GRPC.Port == g.Port && g.GRPC.Address == g.Address {
+			return fmt.Errorf("grpc: listen: must not be the same as the server's; leave it unset to share the listener")
+		}
+		if g.HotRestart {
+			return fmt.Errorf("grpc: listen: a separate listener cannot be used with hot_restart")
+		}
+	}
+	if g.ReloadConfig && !g.HotRestart {
+		return fmt.Errorf("reload_config: requires hot_restart to be enabled")
+	}
+	if err := g.TLS.Validate(); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	if err := g.IDs.Validate(); err != nil {
+		return fmt.Errorf("ids: %w", err)
+	}
+	if err := g.Encryption.Validate(); err != nil {
+		return fmt.Errorf("encryption: %w", err)
+	}
+	if err := g.I18n.Validate(); err != nil {
+		return fmt.Errorf("i18n: %w", err)
+	}
+	if err := g.Info.Validate(); err != nil {
+		return fmt.Errorf("info: %w", err)
+	}
+	if err := g.Admin.Validate(); err != nil {
+		return fmt.Errorf("admin: %w", err)
+	}
+	if err := g.CORS.Validate(); err != nil {
+		return fmt.Errorf("cors: %w", err)
+	}
+	if err := g.RateLimit.Validate(); err != nil {
+		return fmt.Errorf("ratelimit: %w", err)
+	}
+	if err := g.Defaults.Validate(); err != nil {
+		return fmt.Errorf("defaults: %w", err)
+	}
+	if g.ShutdownTimeoutMillis < 1 {
+		return fmt.Errorf("shutdown_timeout: must be at least 1")
+	}
+	if g.MaxInFlight < 0 {
+		return fmt.Errorf("max_in_flight: must not be negative")
+	}
+
+	seenMW := map[string]bool{}
+	for i, name := range g.Middleware {
+		if _, ok := builtinMiddleware[name]; !ok {
+			return fmt.Errorf("middleware: item #%d: unknown middleware %q", i+1, name)
+		}
+		if seenMW[name] {
+			return fmt.Errorf("middleware: item #%d: %q is given more than once", i+1, name)
+		}
+		seenMW[name] = true
+	}
+	if g.Mirror.Enabled && g.Middleware != nil && !seenMW[MiddlewareMirror] {
+		return fmt.Errorf("mirror: enabled but %q is not in middleware", MiddlewareMirror)
+	}
+	if len(g.CORS.AllowedOrigins) > 0 && g.Middleware != nil && !seenMW[MiddlewareCORS] {
+		return fmt.Errorf("cors: origins are allowed but %q is not in middleware", MiddlewareCORS)
+	}
+	if g.RateLimit.Requests > 0 && g.Middleware != nil && !seenMW[MiddlewareRateLimit] {
+		return fmt.Errorf("ratelimit: requests are limited but %q is not in middleware", MiddlewareRateLimit)
+	}
 
 	return nil
 }
@@ -416,6 +1036,64 @@ type DatabaseConfig struct {
 	// persistence store. By default, it is "db.owv". This is only applicable
 	// for certain DB types: OWDB.
 	DataFile string
+
+	// Connect is when the DB is connected to. By default, it is ConnectEager,
+	// and the DB is connected to when the server is created.
+	Connect ConnectPolicy
+
+	// ConnectTimeoutMillis is how long a use of the DB waits for it to be
+	// connected to before failing with an ErrUnavailable error, in
+	// milliseconds. It only applies to DBs whose Connect policy is ConnectLazy
+	// or ConnectOnFirstUse. If not set, uses wait until their context is done.
+	ConnectTimeoutMillis int
+
+	// Replicas are the read replicas of the DB. Each is connected to with the
+	// DB's type and connector, and a ReplicatedStore is made of the DB and its
+	// replicas; see Bundle.ReplicatedDB.
+	Replicas []ReplicaConfig
+
+	// Failover is whether writes go to the first healthy replica while the DB
+	// itself is unhealthy. It should only be set for backends whose replicas
+	// are promoted to accept writes when the primary fails. It has no effect
+	// unless HealthCheckMillis is set.
+	Failover bool
+
+	// HealthCheckMillis is how often the DB and its replicas are pinged to
+	// check whether they are healthy, in milliseconds. Unhealthy replicas are
+	// not read from until they are healthy again. Only Stores that implement
+	// PingingStore are checked; others are always considered healthy. If not
+	// set, health is not checked.
+	HealthCheckMillis int
+
+	// Tags are labels for the DB, such as "analytics", that APIs can use to
+	// refer to every DB with a tag at once by giving "tag:NAME" in UsesDBs.
+	// Tags are not case-sensitive.
+	Tags []string
+}
+
+// ReplicaConfig is a read replica of a DB. It is connected to with the type
+// and connector of the DB it is a replica of.
+type ReplicaConfig struct {
+	// DataDir is the path on disk to the directory of the replica's data. It
+	// has the same meaning as in DatabaseConfig.
+	DataDir string
+
+	// DataFile is the name of the replica's DB file. It has the same meaning
+	// as in DatabaseConfig.
+	DataFile string
+}
+
+// Replica returns the config that the Nth replica of db is connected to with,
+// which is db with the DataDir and DataFile of the replica and without any
+// replicas of its own.
+func (db DatabaseConfig) Replica(n int) DatabaseConfig {
+	replica := db
+	replica.DataDir = db.Replicas[n].DataDir
+	replica.DataFile = db.Replicas[n].DataFile
+	replica.Replicas = nil
+	replica.Failover = false
+	replica.HealthCheckMillis = 0
+	return replica
 }
 
 // FillDefaults returns a new Database identical to db but with unset values
@@ -433,6 +1111,24 @@ func (db DatabaseConfig) FillDefaults() DatabaseConfig {
 	if newDB.Connector == "" {
 		newDB.Connector = "*"
 	}
+	if newDB.Connect == "" {
+		newDB.Connect = ConnectEager
+	}
+	if len(newDB.Tags) > 0 {
+		newDB.Tags = make([]string, len(db.Tags))
+		for i := range db.Tags {
+			newDB.Tags[i] = strings.ToLower(db.Tags[i])
+		}
+	}
+	if len(newDB.Replicas) > 0 {
+		newDB.Replicas = make([]ReplicaConfig, len(db.Replicas))
+		copy(newDB.Replicas, db.Replicas)
+		for i := range newDB.Replicas {
+			if newDB.Type == DatabaseOWDB && newDB.Replicas[i].DataFile == "" {
+				newDB.Replicas[i].DataFile = "db.owv"
+			}
+		}
+	}
 
 	return newDB
 }
@@ -441,6 +1137,29 @@ func (db DatabaseConfig) FillDefaults() DatabaseConfig {
 // set. Its type will be checked to ensure that it is a valid type to use and
 // any fields necessary for connecting to that type of DB are also checked.
 func (db DatabaseConfig) Validate() error {
+	if _, err := ParseConnectPolicy(db.Connect.String()); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	if db.ConnectTimeoutMillis < 0 {
+		return fmt.Errorf("connect timeout: must not be negative")
+	}
+	if db.HealthCheckMillis < 0 {
+		return fmt.Errorf("health check: must not be negative")
+	}
+	for i, tag := range db.Tags {
+		if tag == "" {
+			return fmt.Errorf("tags[%d]: must not be empty", i)
+		}
+		if strings.ContainsAny(tag, ":*?[]") {
+			return fmt.Errorf("tags[%d]: must not contain any of ':', '*', '?', '[', or ']'", i)
+		}
+	}
+	for i := range db.Replicas {
+		if err := db.Replica(i).Validate(); err != nil {
+			return fmt.Errorf("replicas[%d]: %w", i, err)
+		}
+	}
+
 	switch db.Type {
 	case DatabaseInMemory:
 		// nothing else to check
@@ -632,9 +1351,76 @@ type Config struct {
 	// Format is the format of config, used in Dump. It will only be
 	// automatically set if the Config was created via a call to Load.
 	Format Format
+
+	// Sources gives where each value of the Config came from when it was
+	// loaded, keyed by lowercase dotted paths such as "jellyauth.secret". It is
+	// used to annotate dumps made with DumpOptions.Annotate. It will only be
+	// automatically set if the Config was created via a call to Load.
+	Sources map[string]ValueSource
+
+	// Path is the file or directory that the Config was loaded from, used to
+	// watch for changes when Globals.ReloadConfig is enabled. It will only be
+	// automatically set if the Config was created via a call to Load.
+	Path string
+}
+
+const (
+	// SourceFile annotates a value that was given in the config file.
+	SourceFile = "file"
+
+	// SourceEnv annotates a value that was given in the config file as a
+	// reference to pod metadata, such as "${pod.name}", and so was read from
+	// an environment variable.
+	SourceEnv = "env"
+
+	// SourceDefault annotates a value that was not given in the config file
+	// and so has its default value.
+	SourceDefault = "default"
+
+	// SourceCode annotates a value that was set by the program instead of
+	// being loaded, such as one changed after the config was loaded.
+	SourceCode = "code"
+)
+
+// ValueSource is where a value of a Config came from when it was loaded.
+type ValueSource struct {
+	// Source is where the value came from: SourceFile, SourceEnv, or
+	// SourceDefault.
+	Source string
+
+	// Value is the value as it was loaded with defaults filled, encoded as
+	// YAML. A value that no longer matches it has been changed by code.
+	Value string
+}
+
+// DumpOptions are options for dumping a Config for display.
+type DumpOptions struct {
+	// Redact is whether to replace the values of sensitive keys, as determined
+	// by IsSensitive, with RedactedValue. Only string values are redacted, so
+	// that keys that merely mention a sensitive term, such as a token
+	// lifetime, are kept.
+	Redact bool
+
+	// Section is the dotted path of the only section to dump, such as
+	// "jellyauth" for the config of the jellyauth API or "webhooks" for the
+	// webhooks config. If empty, the whole config is dumped.
+	Section string
+
+	// Annotate is whether to annotate each value with where it came from:
+	// SourceFile if it was given in the config file, SourceEnv if it was read
+	// from an environment variable, SourceDefault if it was not given, or
+	// SourceCode if the program set it. Annotations are given as YAML
+	// comments, so annotated dumps are always in YAML format. Values of a
+	// Config that was not loaded from a file are annotated with SourceDefault
+	// if they are the same as in an empty Config with defaults filled, and
+	// with SourceCode otherwise.
+	Annotate bool
 }
 
 func apiHas(api APIConfig, key string) bool {
+	if api == nil {
+		return false
+	}
 	needle := strings.ToLower(key)
 
 	for _, k := range api.Keys() {
@@ -677,6 +1463,9 @@ func (cfg Config) FillDefaults() Config {
 				panic(fmt.Sprintf("setting a config global failed; should never happen: %v", err))
 			}
 		}
+		if err := newCFG.Globals.Defaults.inherit(api); err != nil {
+			panic(fmt.Sprintf("setting an API default failed; should never happen: %v", err))
+		}
 		api = api.FillDefaults()
 		newCFG.APIs[name] = api
 	}
@@ -687,7 +1476,7 @@ func (cfg Config) FillDefaults() Config {
 		// make shore the first DB exists
 		if configGet[bool](authConf, ConfigKeyAPIEnabled) {
 			dbs := configGet[[]string](authConf, ConfigKeyAPIUsesDBs)
-			if len(dbs) > 0 {
+			if len(dbs) > 0 && !isDBPattern(dbs[0]) {
 				// make shore this DB exists
 				if _, ok := newCFG.DBs[dbs[0]]; !ok {
 					newCFG.DBs[dbs[0]] = DatabaseConfig{Type: DatabaseInMemory, Connector: "authuser"}.FillDefaults()
@@ -717,6 +1506,11 @@ func (cfg Config) Validate() error {
 			return fmt.Errorf("dbs: %s: %w", name, err)
 		}
 	}
+	if quotaDB := cfg.Globals.Quota.DB; quotaDB != "" {
+		if _, ok := cfg.DBs[strings.ToLower(quotaDB)]; !ok {
+			return fmt.Errorf("quota: db: no DB named %q is configured", quotaDB)
+		}
+	}
 	for name, api := range cfg.APIs {
 		com := cfg.APIs[name].Common()
 
@@ -726,9 +1520,86 @@ func (cfg Config) Validate() error {
 		if err := api.Validate(); err != nil {
 			return fmt.Errorf("%s: %w", name, err)
 		}
+		if com.Enabled {
+			if _, err := ResolveUsesDBs(com.UsesDBs, cfg.DBs); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
 	}
 
 	// all possible values for UnauthDelayMS are valid, so no need to check it
 
 	return nil
 }
+
+// usesTagPrefix begins entries of CommonConfig.UsesDBs that refer to DBs by
+// tag.
+const usesTagPrefix = "tag:"
+
+// isDBPattern returns whether the entry of CommonConfig.UsesDBs refers to DBs
+// by tag or by pattern instead of by name.
+func isDBPattern(entry string) bool {
+	return strings.HasPrefix(strings.ToLower(entry), usesTagPrefix) || strings.ContainsAny(entry, "*?[")
+}
+
+// ResolveUsesDBs returns the names of the DBs in dbs that the entries of uses,
+// such as those of CommonConfig.UsesDBs, refer to. An entry that is a name is
+// given as-is in lowercase, even if there is no DB with that name. An entry of
+// "tag:NAME" gives every DB with the tag NAME, and an entry that contains any
+// of '*', '?', or '[' gives every DB whose name matches it as a pattern in the
+// syntax of path.Match; DBs matched by one entry are given in order of their
+// names. Each DB is only given once, where it is first referred to. It is an
+// error if an entry of a tag or pattern does not match any DB.
+func ResolveUsesDBs(uses []string, dbs map[string]DatabaseConfig) ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for i, entry := range uses {
+		entry = strings.ToLower(entry)
+		if !isDBPattern(entry) {
+			add(entry)
+			continue
+		}
+
+		var matched []string
+		if tag := strings.TrimPrefix(entry, usesTagPrefix); tag != entry {
+			for name, db := range dbs {
+				for _, t := range db.Tags {
+					if strings.ToLower(t) == tag {
+						matched = append(matched, strings.ToLower(name))
+						break
+					}
+				}
+			}
+			if len(matched) == 0 {
+				return nil, fmt.Errorf("uses[%d]: no DB has tag %q", i, tag)
+			}
+		} else {
+			for name := range dbs {
+				ok, err := path.Match(entry, strings.ToLower(name))
+				if err != nil {
+					return nil, fmt.Errorf("uses[%d]: %w", i, err)
+				}
+				if ok {
+					matched = append(matched, strings.ToLower(name))
+				}
+			}
+			if len(matched) == 0 {
+				return nil, fmt.Errorf("uses[%d]: no DB matches %q", i, entry)
+			}
+		}
+
+		sort.Strings(matched)
+		for _, name := range matched {
+			add(name)
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,250 @@
+package jelly
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseListenAddress(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       string
+		expectAddr  string
+		expectPort  int
+		expectError bool
+	}{
+		{name: "hostname", input: "localhost:8080", expectAddr: "localhost", expectPort: 8080},
+		{name: "port only", input: ":8080", expectAddr: "", expectPort: 8080},
+		{name: "IPv4", input: "127.0.0.1:80", expectAddr: "127.0.0.1", expectPort: 80},
+		{name: "IPv6", input: "[::1]:8080", expectAddr: "::1", expectPort: 8080},
+		{name: "IPv6 any", input: "[::]:443", expectAddr: "::", expectPort: 443},
+		{name: "IPv6 with zone", input: "[fe80::1%eth0]:80", expectAddr: "fe80::1%eth0", expectPort: 80},
+		{name: "IPv6 without brackets", input: "::1:8080", expectError: true},
+		{name: "IPv4 in brackets", input: "[127.0.0.1]:80", expectError: true},
+		{name: "hostname in brackets", input: "[localhost]:80", expectError: true},
+		{name: "brackets without port", input: "[::1]", expectError: true},
+		{name: "unclosed bracket", input: "[::1:80", expectError: true},
+		{name: "unopened bracket", input: "::1]:80", expectError: true},
+		{name: "no port", input: "localhost", expectError: true},
+		{name: "bad port", input: "localhost:http", expectError: true},
+		{name: "port out of range", input: "localhost:65536", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			addr, port, err := ParseListenAddress(tc.input)
+			if tc.expectError {
+				assert.Error(err)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+			assert.Equal(tc.expectAddr, addr)
+			assert.Equal(tc.expectPort, port)
+		})
+	}
+}
+
+func Test_Globals_ListenAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("localhost:8080", Globals{Address: "localhost", Port: 8080}.ListenAddress())
+	assert.Equal("[::1]:8080", Globals{Address: "::1", Port: 8080}.ListenAddress())
+}
+
+func Test_Globals_Validate_extraListen(t *testing.T) {
+	testCases := []struct {
+		name        string
+		extra       []string
+		hotRestart  bool
+		expectError bool
+	}{
+		{name: "dual-stack", extra: []string{"[::1]:8080"}},
+		{name: "different port", extra: []string{"localhost:8081", "[::]:8082"}},
+		{name: "same as first", extra: []string{"localhost:8080"}, expectError: true},
+		{name: "given twice", extra: []string{"[::1]:8080", "[::1]:8080"}, expectError: true},
+		{name: "invalid", extra: []string{"::1:8080"}, expectError: true},
+		{name: "with hot_restart", extra: []string{"[::1]:8080"}, hotRestart: true, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := Globals{Address: "localhost", Port: 8080, ExtraListen: tc.extra, HotRestart: tc.hotRestart}.FillDefaults()
+
+			err := g.Validate()
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_Globals_Validate_port(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(Globals{Port: 0}.FillDefaults().Validate(), "ephemeral")
+	assert.NoError(Globals{Port: 0, ExtraListen: []string{":0", ":0"}}.FillDefaults().Validate(), "several ephemeral")
+	assert.Error(Globals{Port: -1}.FillDefaults().Validate())
+}
+
+func Test_Config_FillDefaults_apiDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	ownCORS := &CORSConfig{AllowedOrigins: []string{"https://admin.example.com"}}
+	cfg := Config{
+		Globals: Globals{
+			Defaults: APIDefaults{
+				CORS:            CORSConfig{AllowedOrigins: []string{"https://example.com"}},
+				RateLimit:       RateLimitConfig{Requests: 10},
+				TimeoutMillis:   5000,
+				SecurityHeaders: SecurityHeadersConfig{NoSniff: true, FrameOptions: "deny"},
+			},
+		},
+		DBs: map[string]DatabaseConfig{},
+		APIs: map[string]APIConfig{
+			"inherits":  &CommonConfig{},
+			"overrides": &CommonConfig{CORS: ownCORS, TimeoutMillis: -1},
+		},
+	}
+
+	filled := cfg.FillDefaults()
+	if !assert.NoError(filled.Validate()) {
+		return
+	}
+
+	inherits := filled.APIs["inherits"].Common()
+	if assert.NotNil(inherits.CORS) {
+		assert.Equal([]string{"https://example.com"}, inherits.CORS.AllowedOrigins)
+	}
+	if assert.NotNil(inherits.RateLimit) {
+		assert.Equal(10, inherits.RateLimit.Requests)
+	}
+	assert.Equal(5000, inherits.TimeoutMillis)
+	if assert.NotNil(inherits.SecurityHeaders) {
+		assert.True(inherits.SecurityHeaders.NoSniff)
+	}
+
+	overrides := filled.APIs["overrides"].Common()
+	assert.Same(ownCORS, overrides.CORS)
+	assert.Equal(-1, overrides.TimeoutMillis)
+	if assert.NotNil(overrides.RateLimit) {
+		assert.Equal(10, overrides.RateLimit.Requests)
+	}
+
+	// each API gets its own copy of the defaults
+	inherits.CORS.AllowedOrigins[0] = "https://changed.example.com"
+	assert.Equal("https://example.com", filled.Globals.Defaults.CORS.AllowedOrigins[0])
+}
+
+func Test_APIDefaults_Validate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		defaults  APIDefaults
+		expectErr string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:      "negative timeout",
+			defaults:  APIDefaults{TimeoutMillis: -1},
+			expectErr: "timeout: must not be negative",
+		},
+		{
+			name:      "bad frame options",
+			defaults:  APIDefaults{SecurityHeaders: SecurityHeadersConfig{FrameOptions: "ALLOW-FROM https://example.com"}},
+			expectErr: `security_headers: frame_options: must be one of "DENY" or "SAMEORIGIN"`,
+		},
+		{
+			name:      "bad rate limit",
+			defaults:  APIDefaults{RateLimit: RateLimitConfig{Requests: -1}},
+			expectErr: "ratelimit: requests: must not be negative",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			err := tc.defaults.Validate()
+			if tc.expectErr == "" {
+				assert.NoError(err)
+			} else {
+				assert.EqualError(err, tc.expectErr)
+			}
+		})
+	}
+}
+
+func Test_ResolveUsesDBs(t *testing.T) {
+	dbs := map[string]DatabaseConfig{
+		"main":       {},
+		"clicks":     {Tags: []string{"analytics"}},
+		"Views":      {Tags: []string{"ANALYTICS", "web"}},
+		"events_old": {Tags: []string{"archive"}},
+		"events_new": {},
+	}
+
+	testCases := []struct {
+		name      string
+		uses      []string
+		expect    []string
+		expectErr string
+	}{
+		{
+			name:   "names are given as-is",
+			uses:   []string{"Main", "missing"},
+			expect: []string{"main", "missing"},
+		},
+		{
+			name:   "tag",
+			uses:   []string{"tag:Analytics"},
+			expect: []string{"clicks", "views"},
+		},
+		{
+			name:   "pattern",
+			uses:   []string{"events_*"},
+			expect: []string{"events_new", "events_old"},
+		},
+		{
+			name:   "each DB is given once where first used",
+			uses:   []string{"views", "tag:analytics", "*"},
+			expect: []string{"views", "clicks", "events_new", "events_old", "main"},
+		},
+		{
+			name:      "unknown tag",
+			uses:      []string{"main", "tag:billing"},
+			expectErr: `uses[1]: no DB has tag "billing"`,
+		},
+		{
+			name:      "pattern matches nothing",
+			uses:      []string{"reports_*"},
+			expectErr: `uses[0]: no DB matches "reports_*"`,
+		},
+		{
+			name:      "bad pattern",
+			uses:      []string{"events_[a"},
+			expectErr: "uses[0]: syntax error in pattern",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			actual, err := ResolveUsesDBs(tc.uses, dbs)
+			if tc.expectErr != "" {
+				assert.EqualError(err, tc.expectErr)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expect, actual)
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package jelly
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// loggedInCtxKey is the key in a context that holds the logged-in user of a
+// request.
+type loggedInCtxKey struct{}
+
+// startTimeCtxKey is the key in a context that holds the time that the server
+// started handling a request.
+type startTimeCtxKey struct{}
+
+// loggedInValue is the value stored under loggedInCtxKey.
+type loggedInValue struct {
+	user     AuthUser
+	loggedIn bool
+}
+
+// Context gives the values that the server and its middleware set in the
+// context of a request. Use it instead of reading context keys directly; the
+// keys are not part of the public API and may change. Get one for a request
+// with ContextOf.
+//
+// The zero value gives no values.
+type Context struct {
+	ctx context.Context
+}
+
+// ContextOf returns the Context of the values in ctx, which is typically the
+// context of a request given by req.Context().
+func ContextOf(ctx context.Context) Context {
+	return Context{ctx: ctx}
+}
+
+// LoggedInUser returns the user that is logged in for the request. It is set
+// by the OptionalAuth and RequiredAuth middleware of a ServiceProvider, or by
+// the server's auth interceptor for gRPC calls. If no user is logged in, or if
+// no auth middleware was run for the request, it returns an empty AuthUser and
+// false.
+func (c Context) LoggedInUser() (user AuthUser, loggedIn bool) {
+	if c.ctx == nil {
+		return AuthUser{}, false
+	}
+	if li, ok := c.ctx.Value(loggedInCtxKey{}).(loggedInValue); ok {
+		if !li.loggedIn {
+			return AuthUser{}, false
+		}
+		return li.user, true
+	}
+	return GRPCUserFromContext(c.ctx)
+}
+
+// RequestID returns the ID of the request that was given by the request_id
+// middleware. If the middleware is not enabled, it returns "".
+func (c Context) RequestID() string {
+	if c.ctx == nil {
+		return ""
+	}
+	return chimw.GetReqID(c.ctx)
+}
+
+// Tenant returns the tenant that the request is made on behalf of. It is the
+// same as calling TenantFromContext.
+func (c Context) Tenant() (tenantID string, ok bool) {
+	if c.ctx == nil {
+		return "", false
+	}
+	return TenantFromContext(c.ctx)
+}
+
+// MatchedRoute returns the pattern of the route that the request was routed
+// to, such as "/api/v1/users/{id}", including the URI base and the base of the
+// API. It is only complete once the request has reached the endpoint that
+// handles it; middleware that runs before routing is finished gives only the
+// part of the pattern that has been matched so far. If the request was not
+// routed by the server, it returns "".
+func (c Context) MatchedRoute() string {
+	if c.ctx == nil {
+		return ""
+	}
+	if rctx := chi.RouteContext(c.ctx); rctx != nil {
+		return rctx.RoutePattern()
+	}
+	return ""
+}
+
+// StartTime returns the time that the server started handling the request,
+// before any middleware was run. If it was not set, it returns the zero time.
+func (c Context) StartTime() time.Time {
+	if c.ctx == nil {
+		return time.Time{}
+	}
+	t, _ := c.ctx.Value(startTimeCtxKey{}).(time.Time)
+	return t
+}
+
+// WithLoggedInUser returns a copy of ctx that has user set as the logged-in
+// user of the request. If loggedIn is false, the request has no logged-in user
+// and user is ignored. It is called by auth middleware, and generally does not
+// need to be called directly.
+func WithLoggedInUser(ctx context.Context, user AuthUser, loggedIn bool) context.Context {
+	return context.WithValue(ctx, loggedInCtxKey{}, loggedInValue{user: user, loggedIn: loggedIn})
+}
+
+// WithStartTime returns a copy of ctx that has t set as the time the server
+// started handling the request. It is called by the server, and generally does
+// not need to be called directly.
+func WithStartTime(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, startTimeCtxKey{}, t)
+}
+
+// TestValues are the values that WithTestValues sets in a context. Only the
+// values that are not empty are set.
+type TestValues struct {
+	// User is the logged-in user. If nil, no user is logged in.
+	User *AuthUser
+
+	// RequestID is the ID of the request.
+	RequestID string
+
+	// Tenant is the tenant that the request is made on behalf of.
+	Tenant string
+
+	// MatchedRoute is the pattern of the route that the request was routed
+	// to.
+	MatchedRoute string
+
+	// StartTime is the time that the server started handling the request.
+	StartTime time.Time
+}
+
+// WithTestValues returns a copy of ctx that has the given values set as they
+// would be by the server, so that endpoints can be tested by calling them
+// directly with a request made with httptest.NewRequest:
+//
+//	req := httptest.NewRequest(http.MethodGet, "/users", nil)
+//	req = req.WithContext(jelly.WithTestValues(req.Context(), jelly.TestValues{
+//		User:   &jelly.AuthUser{Username: "admin", Role: jelly.Admin},
+//		Tenant: "acme",
+//	}))
+//
+// The values can then be read with ContextOf. If MatchedRoute is set, the URL
+// parameters of any routing context already in ctx are kept.
+func WithTestValues(ctx context.Context, vals TestValues) context.Context {
+	if vals.User != nil {
+		ctx = WithLoggedInUser(ctx, *vals.User, true)
+	}
+	if vals.RequestID != "" {
+		ctx = context.WithValue(ctx, chimw.RequestIDKey, vals.RequestID)
+	}
+	if vals.Tenant != "" {
+		ctx = WithTenant(ctx, vals.Tenant)
+	}
+	if vals.MatchedRoute != "" {
+		rctx := chi.NewRouteContext()
+		if existing := chi.RouteContext(ctx); existing != nil {
+			rctx.URLParams = existing.URLParams
+		}
+		rctx.RoutePatterns = []string{vals.MatchedRoute}
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+	}
+	if !vals.StartTime.IsZero() {
+		ctx = WithStartTime(ctx, vals.StartTime)
+	}
+	return ctx
+}
@@ -0,0 +1,81 @@
+package jelly
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithTestValues(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2023, time.April, 13, 4, 13, 0, 0, time.UTC)
+
+	ctx := WithTestValues(context.Background(), TestValues{
+		User:         &AuthUser{Username: "ghostlyTrickster"},
+		RequestID:    "req-413",
+		Tenant:       "derse",
+		MatchedRoute: "/users/{id}",
+		StartTime:    start,
+	})
+	c := ContextOf(ctx)
+
+	user, loggedIn := c.LoggedInUser()
+	assert.True(loggedIn)
+	assert.Equal("ghostlyTrickster", user.Username)
+	assert.Equal("req-413", c.RequestID())
+	tenant, ok := c.Tenant()
+	assert.True(ok)
+	assert.Equal("derse", tenant)
+	assert.Equal("/users/{id}", c.MatchedRoute())
+	assert.Equal(start, c.StartTime())
+}
+
+func Test_Context_empty(t *testing.T) {
+	for name, c := range map[string]Context{
+		"zero value":         {},
+		"background context": ContextOf(context.Background()),
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, loggedIn := c.LoggedInUser()
+			assert.False(loggedIn)
+			assert.Empty(c.RequestID())
+			_, ok := c.Tenant()
+			assert.False(ok)
+			assert.Empty(c.MatchedRoute())
+			assert.True(c.StartTime().IsZero())
+		})
+	}
+}
+
+func Test_Context_MatchedRoute(t *testing.T) {
+	assert := assert.New(t)
+
+	var actual string
+	r := chi.NewRouter()
+	r.Route("/users", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, req *http.Request) {
+			actual = ContextOf(req.Context()).MatchedRoute()
+		})
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/413", nil))
+
+	assert.Equal("/users/{id}", actual)
+}
+
+func Test_Context_LoggedInUser_notLoggedIn(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := WithLoggedInUser(context.Background(), AuthUser{Username: "ghostlyTrickster"}, false)
+	user, loggedIn := ContextOf(ctx).LoggedInUser()
+
+	assert.False(loggedIn)
+	assert.Equal(AuthUser{}, user)
+}
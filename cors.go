@@ -0,0 +1,68 @@
+package jelly
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CORSConfig contains options for the "cors" built-in middleware, which lets
+// browsers make cross-origin requests to the server from the allowed origins.
+// It answers CORS preflight requests itself and adds the CORS headers to the
+// responses of all other requests from an allowed origin.
+type CORSConfig struct {
+	// AllowedOrigins is the origins that may make cross-origin requests, such
+	// as "https://example.com". "*" allows every origin. If empty, no
+	// cross-origin requests are allowed and the middleware has no effect.
+	AllowedOrigins []string
+
+	// AllowedMethods is the HTTP methods that cross-origin requests may use.
+	// It will default to GET, HEAD, POST, PUT, PATCH, and DELETE if not set.
+	AllowedMethods []string
+
+	// AllowedHeaders is the request headers that cross-origin requests may
+	// set. It will default to Authorization and Content-Type if not set.
+	AllowedHeaders []string
+
+	// AllowCredentials is whether cross-origin requests may include
+	// credentials such as cookies. It cannot be set if AllowedOrigins
+	// contains "*".
+	AllowCredentials bool
+
+	// MaxAgeSecs is how long, in seconds, browsers may cache the result of a
+	// preflight request. If 0, the header is not sent and the browser's
+	// default is used.
+	MaxAgeSecs int
+}
+
+func (cc CORSConfig) FillDefaults() CORSConfig {
+	newCC := cc
+
+	if len(newCC.AllowedMethods) == 0 {
+		newCC.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	if len(newCC.AllowedHeaders) == 0 {
+		newCC.AllowedHeaders = []string{"Authorization", "Content-Type"}
+	}
+
+	return newCC
+}
+
+func (cc CORSConfig) Validate() error {
+	for i, origin := range cc.AllowedOrigins {
+		if origin == "" {
+			return fmt.Errorf("allowed_origins: item #%d: must not be empty", i+1)
+		}
+		if origin == "*" && cc.AllowCredentials {
+			return fmt.Errorf("allow_credentials: cannot be set when allowed_origins contains \"*\"")
+		}
+		if origin != "*" && !strings.Contains(origin, "://") {
+			return fmt.Errorf("allowed_origins: item #%d: must be \"*\" or include a scheme, such as \"https://\"", i+1)
+		}
+	}
+	if cc.MaxAgeSecs < 0 {
+		return fmt.Errorf("max_age: must not be negative")
+	}
+
+	return nil
+}
@@ -10,6 +10,7 @@ package db
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"net/mail"
 	"time"
@@ -82,3 +83,53 @@ func (em *Email) Scan(value interface{}) error {
 	em.V = email
 	return nil
 }
+
+// JSONMap is a map of string keys to arbitrary values that stores itself in the
+// DB as a JSON object. A nil JSONMap is stored as an empty object.
+type JSONMap map[string]interface{}
+
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(map[string]interface{}(m))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (m *JSONMap) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	case nil:
+		*m = nil
+		return nil
+	default:
+		return jelly.NewError(fmt.Sprintf("not a text value: %v", value), jelly.ErrDBDecodingFailure)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return jelly.NewError("", err, jelly.ErrDBDecodingFailure)
+	}
+
+	*m = decoded
+	return nil
+}
+
+// Copy returns a shallow copy of m. If m is empty, nil is returned.
+func (m JSONMap) Copy() map[string]interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	cp := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
@@ -418,6 +418,75 @@ func IsNullString() Criterion[string] {
 	}
 }
 
+// EqualsInt returns a Criterion that checks that the int property of interest
+// exactly equals the given value.
+func EqualsInt(i int) Criterion[int] {
+	return Criterion[int]{
+		Meets: func(v int) bool {
+			return v == i
+		},
+		Format:    "%s" + fmt.Sprintf(" == %d", i),
+		NotFormat: "%s" + fmt.Sprintf(" != %d", i),
+		EstLimits: Limits[int]{Min: &i, Max: &i},
+	}
+}
+
+// IsGreaterThanInt returns a Criterion that checks that the int property of
+// interest is greater than the given value.
+func IsGreaterThanInt(i int) Criterion[int] {
+	return Criterion[int]{
+		Meets: func(v int) bool {
+			return v > i
+		},
+		Format:    "%s" + fmt.Sprintf(" > %d", i),
+		NotFormat: "%s" + fmt.Sprintf(" <= %d", i),
+		EstLimits: Limits[int]{Min: &i},
+	}
+}
+
+// IsLessThanInt returns a Criterion that checks that the int property of
+// interest is less than the given value.
+func IsLessThanInt(i int) Criterion[int] {
+	return Criterion[int]{
+		Meets: func(v int) bool {
+			return v < i
+		},
+		Format:    "%s" + fmt.Sprintf(" < %d", i),
+		NotFormat: "%s" + fmt.Sprintf(" >= %d", i),
+		EstLimits: Limits[int]{Max: &i},
+	}
+}
+
+// IsBetweenInts returns a Criterion that checks that the int property of
+// interest is between the given values, inclusive.
+func IsBetweenInts(start, end int) Criterion[int] {
+	return Criterion[int]{
+		Meets: func(v int) bool {
+			return start <= v && v <= end
+		},
+		Format:    fmt.Sprintf("%d <= ", start) + "%s" + fmt.Sprintf(" <= %d", end),
+		NotFormat: "!(" + fmt.Sprintf("%d <= ", start) + "%s" + fmt.Sprintf(" <= %d", end) + ")",
+		EstLimits: Limits[int]{Min: &start, Max: &end},
+	}
+}
+
+// IsStatusClass returns a Criterion that checks that the HTTP status code
+// property of interest is in the given class, given as its first digit; for
+// instance, IsStatusClass(4) matches all client error codes 400-499.
+func IsStatusClass(class int) Criterion[int] {
+	start := class * 100
+	end := start + 99
+
+	return Criterion[int]{
+		Meets: func(v int) bool {
+			return start <= v && v <= end
+		},
+		Format:    "%s" + fmt.Sprintf(" IN %dxx", class),
+		NotFormat: "%s" + fmt.Sprintf(" NOT IN %dxx", class),
+		EstLimits: Limits[int]{Min: &start, Max: &end},
+	}
+}
+
 // EqualsTime returns a Criterion that the time-based property of interest be
 // exactly the given value.
 func EqualsTime(val time.Time) Criterion[time.Time] {
@@ -474,7 +543,7 @@ func IsBefore(t time.Time) Criterion[time.Time] {
 		},
 		Format:    "%s < " + t.Format(time.RFC3339),
 		NotFormat: "%s >= " + t.Format(time.RFC3339),
-		EstLimits: Limits[time.Time]{Min: &t},
+		EstLimits: Limits[time.Time]{Max: &t},
 	}
 }
 
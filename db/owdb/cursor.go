@@ -0,0 +1,202 @@
+package owdb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// defaultCursorBatchSize is the number of hits that a Cursor reads from its
+// Store at a time if no batch size is given.
+const defaultCursorBatchSize = 256
+
+// CursorOptions are options for a [Cursor] created with [Store.SelectCursor].
+type CursorOptions struct {
+	// Offset is the number of matching hits to skip before the first one that
+	// the Cursor yields.
+	Offset int
+
+	// Limit is the maximum number of hits that the Cursor yields. If 0, there
+	// is no limit.
+	Limit int
+
+	// BatchSize is the maximum number of hits that are scanned each time the
+	// read lock on the Store is acquired, whether or not they match. Larger
+	// batches finish sooner, and smaller ones block writers for less time. If
+	// 0, a default is used.
+	BatchSize int
+}
+
+// Cursor iterates over the hits in a Store that match a Filter, in order of
+// their Time. It is created with [Store.SelectCursor]. The Store is read in
+// batches, each under a short-lived read lock, so that iterating over a large
+// result neither holds all of it in memory nor blocks writers until it is
+// done.
+//
+// Because the lock is released between batches, the Cursor sees changes made
+// to the Store while it is being iterated over. Hits inserted or deleted after
+// the last one yielded may or may not be yielded, and a change to hits with
+// the exact same Time as the last one yielded can cause one of them to be
+// skipped or yielded twice.
+//
+// Use it like this:
+//
+//	cur := store.SelectCursor(filter)
+//	for cur.Next() {
+//		hit := cur.Hit()
+//		...
+//	}
+//	if err := cur.Err(); err != nil {
+//		...
+//	}
+type Cursor struct {
+	s      *Store
+	f      Filter
+	bounds Limits[time.Time]
+	opts   CursorOptions
+
+	started    bool
+	lastTime   time.Time // time of the last hit scanned
+	seenAtLast int       // number of hits with lastTime that were scanned
+	skipped    int       // matching hits skipped for the offset
+	taken      int       // matching hits put in buf so far
+
+	buf  []Hit
+	cur  Hit
+	done bool
+	err  error
+}
+
+// SelectCursor returns a Cursor over all hits that match the given Filter. If
+// f is nil, all hits match. If more than one CursorOptions is given, each
+// non-zero field of a later one replaces that of the earlier ones.
+//
+// Unlike [Store.Select], the matching hits are not all read at once; see
+// [Cursor] for how this affects iterating over a Store that is being changed.
+func (s *Store) SelectCursor(f Filter, opts ...CursorOptions) *Cursor {
+	if f == nil {
+		f = Where{}
+	}
+
+	var o CursorOptions
+	for _, opt := range opts {
+		if opt.Offset != 0 {
+			o.Offset = opt.Offset
+		}
+		if opt.Limit != 0 {
+			o.Limit = opt.Limit
+		}
+		if opt.BatchSize != 0 {
+			o.BatchSize = opt.BatchSize
+		}
+	}
+	if o.BatchSize < 1 {
+		o.BatchSize = defaultCursorBatchSize
+	}
+
+	bounds := f.TimeIndexLimits()
+	if bounds.IsImpossible(time.Time.After) {
+		// same as in applyFilter; search unbounded
+		bounds = Limits[time.Time]{}
+	}
+
+	return &Cursor{s: s, f: f, bounds: bounds, opts: o}
+}
+
+// Next advances the Cursor to the next matching hit, which is then returned by
+// Hit. It returns false when there are no more hits or an error occurs, which
+// can be told apart by checking Err.
+func (c *Cursor) Next() bool {
+	// a batch may have no matches in it, so keep reading until one does or
+	// there are no more
+	for len(c.buf) == 0 {
+		if c.done || c.err != nil {
+			return false
+		}
+		c.fill()
+	}
+
+	c.cur = c.buf[0]
+	c.buf = c.buf[1:]
+	return true
+}
+
+// Hit returns the hit that the Cursor is at. It is only valid after a call to
+// Next that returned true.
+func (c *Cursor) Hit() Hit {
+	return c.cur
+}
+
+// Err returns the error that ended iteration early, if any.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Close ends iteration early. Calling Next after Close returns false. It is not
+// required to call Close on a Cursor that has been iterated to the end.
+func (c *Cursor) Close() {
+	c.done = true
+	c.buf = nil
+}
+
+// fill scans the next batch of hits and puts those that match into c.buf.
+func (c *Cursor) fill() {
+	c.s.mtx.RLock()
+	defer c.s.mtx.RUnlock()
+	if c.s.closed {
+		c.err = fmt.Errorf("operation called on closed *Store")
+		return
+	}
+
+	hits := c.s.hits
+
+	var i int
+	if !c.started {
+		c.started = true
+		if c.bounds.Min != nil {
+			min := *c.bounds.Min
+			i = sort.Search(len(hits), func(i int) bool { return !hits[i].Time.Before(min) })
+		}
+	} else {
+		i = sort.Search(len(hits), func(i int) bool { return !hits[i].Time.Before(c.lastTime) })
+		i += c.seenAtLast
+	}
+
+	for scanned := 0; i < len(hits); i++ {
+		if scanned >= c.opts.BatchSize {
+			// resumed from lastTime and seenAtLast by the next fill
+			return
+		}
+		scanned++
+
+		h := hits[i]
+		if c.bounds.Max != nil && h.Time.After(*c.bounds.Max) {
+			c.done = true
+			return
+		}
+
+		if h.Time.Equal(c.lastTime) {
+			c.seenAtLast++
+		} else {
+			c.lastTime = h.Time
+			c.seenAtLast = 1
+		}
+
+		if !c.f.Matches(h) {
+			continue
+		}
+		if c.skipped < c.opts.Offset {
+			c.skipped++
+			continue
+		}
+
+		c.buf = append(c.buf, h)
+		c.taken++
+		if c.opts.Limit > 0 && c.taken >= c.opts.Limit {
+			c.done = true
+			return
+		}
+	}
+
+	c.done = true
+}
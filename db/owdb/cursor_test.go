@@ -0,0 +1,119 @@
+package owdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Store_SelectCursor(t *testing.T) {
+	hits := []Hit{
+		{Time: april09(13, 0, 0, 0), Resource: "/aradia.html", Host: "server1"},
+		{Time: april09(13, 1, 0, 0), Resource: "/vriska.html", Host: "server2"},
+		{Time: april09(13, 1, 0, 0), Resource: "/tavros.html", Host: "server1"},
+		{Time: april09(13, 2, 0, 0), Resource: "/sollux.html", Host: "server1"},
+		{Time: april09(13, 3, 0, 0), Resource: "/karkat.html", Host: "server1"},
+	}
+
+	testCases := []struct {
+		name   string
+		filter Filter
+		opts   []CursorOptions
+		expect []string
+	}{
+		{
+			name:   "all, in one batch",
+			expect: []string{"/aradia.html", "/vriska.html", "/tavros.html", "/sollux.html", "/karkat.html"},
+		},
+		{
+			name:   "all, in batches of 1",
+			opts:   []CursorOptions{{BatchSize: 1}},
+			expect: []string{"/aradia.html", "/vriska.html", "/tavros.html", "/sollux.html", "/karkat.html"},
+		},
+		{
+			name:   "filtered",
+			filter: Where{Host: EqualsString("server1")},
+			opts:   []CursorOptions{{BatchSize: 2}},
+			expect: []string{"/aradia.html", "/tavros.html", "/sollux.html", "/karkat.html"},
+		},
+		{
+			name:   "by time",
+			filter: Where{Time: IsAfterOrEquals(april09(13, 1, 0, 0))}.And(Where{Time: IsBefore(april09(13, 3, 0, 0))}),
+			opts:   []CursorOptions{{BatchSize: 1}},
+			expect: []string{"/vriska.html", "/tavros.html", "/sollux.html"},
+		},
+		{
+			name:   "offset and limit",
+			filter: Where{Host: EqualsString("server1")},
+			opts:   []CursorOptions{{Offset: 1, Limit: 2, BatchSize: 1}},
+			expect: []string{"/tavros.html", "/sollux.html"},
+		},
+		{
+			name:   "offset past end",
+			opts:   []CursorOptions{{Offset: 10}},
+			expect: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			store := &Store{hits: hits}
+
+			cur := store.SelectCursor(tc.filter, tc.opts...)
+			var actual []string
+			for cur.Next() {
+				actual = append(actual, cur.Hit().Resource)
+			}
+
+			assert.NoError(cur.Err())
+			assert.Equal(tc.expect, actual)
+		})
+	}
+}
+
+func Test_Cursor_writesBetweenBatches(t *testing.T) {
+	assert := assert.New(t)
+	store := &Store{}
+	for i := 0; i < 4; i++ {
+		assert.NoError(store.Insert(Hit{Time: april09(13, i, 0, 0)}))
+	}
+
+	cur := store.SelectCursor(nil, CursorOptions{BatchSize: 2})
+	assert.True(cur.Next())
+	assert.True(cur.Next())
+
+	// the lock is not held between batches
+	assert.NoError(store.Insert(Hit{Time: april09(13, 5, 0, 0)}))
+
+	count := 2
+	for cur.Next() {
+		count++
+	}
+	assert.Equal(5, count)
+}
+
+func Test_Cursor_selectiveFilterReadsInBatches(t *testing.T) {
+	assert := assert.New(t)
+	store := &Store{}
+	for i := 0; i < 10; i++ {
+		host := "server1"
+		if i == 9 {
+			host = "server2"
+		}
+		assert.NoError(store.Insert(Hit{Time: april09(13, i, 0, 0), Host: host}))
+	}
+
+	cur := store.SelectCursor(Where{Host: EqualsString("server2")}, CursorOptions{BatchSize: 3})
+
+	// no batch scans more than BatchSize hits, even when none of them match
+	cur.fill()
+	assert.Empty(cur.buf)
+	assert.False(cur.done)
+	assert.Equal(april09(13, 2, 0, 0), cur.lastTime)
+
+	assert.True(cur.Next())
+	assert.Equal("server2", cur.Hit().Host)
+	assert.False(cur.Next())
+	assert.NoError(cur.Err())
+}
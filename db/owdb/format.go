@@ -0,0 +1,116 @@
+package owdb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/dekarrin/rezi/v2"
+)
+
+// format.go handles the versioned envelope that exported Store data is
+// wrapped in, and the migration of data written in older formats.
+
+// FormatVersion is the version of the data format that [Store.Export] and
+// [Store.Persist] write. Data in any older format is migrated to it when it is
+// loaded.
+//
+// Version 0 is the original format, which has no envelope. Version 1 adds
+// the envelope; its Hit data is the same as version 0 except that hits may
+// carry the fields added to Hit in its own versioned encoding.
+const FormatVersion = 1
+
+// formatMagic starts data that is in a versioned envelope. Its first byte
+// cannot start the data of version 0, which always begins with a rezi count
+// header, for which 0xff is never valid.
+var formatMagic = []byte{0xff, 'O', 'W', 'V'}
+
+// migrations holds the function that migrates the payload of each format
+// version to the next; migrations[i] converts version i to version i+1.
+var migrations = []func(payload []byte) ([]byte, error){
+	// 0 -> 1: only the envelope was added.
+	func(payload []byte) ([]byte, error) { return payload, nil },
+}
+
+// wrapFormat wraps payload, which is encoded Store data, in the envelope for
+// the current format version.
+func wrapFormat(payload []byte) []byte {
+	var enc []byte
+	enc = append(enc, formatMagic...)
+	enc = append(enc, rezi.MustEnc(FormatVersion)...)
+	enc = append(enc, payload...)
+	return enc
+}
+
+// unwrapFormat returns the format version of data and the encoded Store data
+// within its envelope. Data without an envelope is version 0 and is returned
+// as-is.
+func unwrapFormat(data []byte) (version int, payload []byte, err error) {
+	if !bytes.HasPrefix(data, formatMagic) {
+		return 0, data, nil
+	}
+	data = data[len(formatMagic):]
+
+	n, err := rezi.Dec(data, &version)
+	if err != nil {
+		return 0, nil, fmt.Errorf("format version: %w", err)
+	}
+	if version < 1 || version > FormatVersion {
+		return version, nil, fmt.Errorf("unsupported format version %d; max supported is %d", version, FormatVersion)
+	}
+
+	return version, data[n:], nil
+}
+
+// migrate converts payload from the given format version to the current one.
+func migrate(version int, payload []byte) ([]byte, error) {
+	var err error
+	for v := version; v < FormatVersion; v++ {
+		payload, err = migrations[v](payload)
+		if err != nil {
+			return nil, fmt.Errorf("migrate from version %d to %d: %w", v, v+1, err)
+		}
+	}
+	return payload, nil
+}
+
+// DataVersion returns the format version of data that was created by
+// [Store.Export] or read from a data file. Data in a version older than
+// [FormatVersion] can still be loaded, and is upgraded the next time the Store
+// it is loaded into is persisted.
+func DataVersion(data []byte) (int, error) {
+	version, _, err := unwrapFormat(data)
+	return version, err
+}
+
+// UpgradeFile migrates the data file at the given path to the current format
+// version in place. It returns the version that the file was in before. If the
+// file is already in the current version, it is not modified. As with
+// [Store.Persist], the original is backed up to the same path with ".bak"
+// appended to it until the upgraded file has been written.
+func UpgradeFile(file string) (int, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, fmt.Errorf("read file: %w", err)
+	}
+
+	version, err := DataVersion(data)
+	if err != nil {
+		return version, err
+	}
+	if version == FormatVersion {
+		return version, nil
+	}
+
+	s, err := Import(data)
+	if err != nil {
+		return version, fmt.Errorf("load data: %w", err)
+	}
+
+	s.DataFile = file
+	if err := s.Close(); err != nil {
+		return version, err
+	}
+
+	return version, nil
+}
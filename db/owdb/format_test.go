@@ -0,0 +1,119 @@
+package owdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dekarrin/rezi/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Import_versions(t *testing.T) {
+	hits := []Hit{
+		{Time: april09(13, 0, 0, 0), Resource: "/aradia.html"},
+		{Time: april09(13, 1, 0, 0), Resource: "/vriska.html", Method: "GET", StatusCode: 200},
+	}
+
+	t.Run("current version", func(t *testing.T) {
+		assert := assert.New(t)
+
+		data, err := (&Store{hits: hits}).Export()
+		if !assert.NoError(err) {
+			return
+		}
+		version, err := DataVersion(data)
+		assert.NoError(err)
+		assert.Equal(FormatVersion, version)
+
+		s, err := Import(data)
+		assert.NoError(err)
+		assert.Equal(hits, s.hits)
+	})
+
+	t.Run("version 0", func(t *testing.T) {
+		assert := assert.New(t)
+
+		// version 0 is the Store encoded with no envelope
+		data := rezi.MustEnc(&Store{hits: hits})
+		version, err := DataVersion(data)
+		assert.NoError(err)
+		assert.Equal(0, version)
+
+		s, err := Import(data)
+		assert.NoError(err)
+		assert.Equal(hits, s.hits)
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		assert := assert.New(t)
+
+		data := append(append([]byte{}, formatMagic...), rezi.MustEnc(FormatVersion+1)...)
+		_, err := Import(data)
+		assert.Error(err)
+	})
+}
+
+func Test_UpgradeFile(t *testing.T) {
+	assert := assert.New(t)
+
+	file := filepath.Join(t.TempDir(), "hits.owv")
+	hits := []Hit{{Time: april09(13, 0, 0, 0), Resource: "/aradia.html"}}
+	if !assert.NoError(os.WriteFile(file, rezi.MustEnc(&Store{hits: hits}), 0644)) {
+		return
+	}
+
+	from, err := UpgradeFile(file)
+	assert.NoError(err)
+	assert.Equal(0, from)
+
+	data, err := os.ReadFile(file)
+	if !assert.NoError(err) {
+		return
+	}
+	version, err := DataVersion(data)
+	assert.NoError(err)
+	assert.Equal(FormatVersion, version)
+
+	s, err := Open(file)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(hits, s.hits)
+
+	// already upgraded
+	from, err = UpgradeFile(file)
+	assert.NoError(err)
+	assert.Equal(FormatVersion, from)
+}
+
+func Test_Open_upgradesOnClose(t *testing.T) {
+	assert := assert.New(t)
+
+	file := filepath.Join(t.TempDir(), "hits.owv")
+	hits := []Hit{{Time: april09(13, 0, 0, 0), Resource: "/aradia.html"}}
+	if !assert.NoError(os.WriteFile(file, rezi.MustEnc(&Store{hits: hits}), 0644)) {
+		return
+	}
+
+	s, err := Open(file)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(file, s.DataFile)
+	assert.NoError(s.Close())
+
+	data, err := os.ReadFile(file)
+	if !assert.NoError(err) {
+		return
+	}
+	version, err := DataVersion(data)
+	assert.NoError(err)
+	assert.Equal(FormatVersion, version)
+
+	s, err = Open(file)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(hits, s.hits)
+}
@@ -42,6 +42,9 @@ func createFileBackup(file string) (string, error) {
 	if err != nil {
 		return buPath, fmt.Errorf("copy data to backup: %w", err)
 	}
+	if err := w.Flush(); err != nil {
+		return buPath, fmt.Errorf("copy data to backup: %w", err)
+	}
 
 	return buPath, nil
 }
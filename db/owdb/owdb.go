@@ -19,6 +19,8 @@ package owdb
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -130,6 +132,13 @@ func (r Requester) String() string {
 	return fmt.Sprintf("<%s>", r.Address)
 }
 
+// hitVersion is the version of the binary encoding of Hit that MarshalBinary
+// produces. Version 0 is the original encoding, which has no version number
+// and ends after Client; every later version appends the version number and
+// then the fields that were added in each version up to it, so that data files
+// written before the fields existed can still be loaded.
+const hitVersion = 2
+
 // Hit is a single hit on a website from a particular IP address, which may or
 // may not be unique.
 type Hit struct {
@@ -147,6 +156,26 @@ type Hit struct {
 
 	// Client is information on the HTTP client who made the request.
 	Client Requester
+
+	// UserAgent is the User-Agent header that the client sent with the
+	// request. Use [ParseUserAgent] to get the browser and OS from it.
+	UserAgent string
+
+	// Referrer is the Referer header that the client sent with the request,
+	// giving the page that linked to the resource.
+	Referrer string
+
+	// Method is the HTTP method of the request, such as "GET".
+	Method string
+
+	// StatusCode is the HTTP status code of the response to the request. It
+	// is 0 if not known.
+	StatusCode int
+
+	// RequestID is the ID that the server gave the request, such as by the
+	// "request_id" middleware of jelly, so that the Hit can be matched with
+	// the log lines and traces of the request. It is empty if not known.
+	RequestID string
 }
 
 func (h Hit) MarshalBinary() ([]byte, error) {
@@ -157,39 +186,75 @@ func (h Hit) MarshalBinary() ([]byte, error) {
 	enc = append(enc, rezi.MustEnc(h.Resource)...)
 	enc = append(enc, rezi.MustEnc(h.Client)...)
 
+	// fields added in version 1
+	enc = append(enc, rezi.MustEnc(hitVersion)...)
+	enc = append(enc, rezi.MustEnc(h.UserAgent)...)
+	enc = append(enc, rezi.MustEnc(h.Referrer)...)
+	enc = append(enc, rezi.MustEnc(h.Method)...)
+	enc = append(enc, rezi.MustEnc(h.StatusCode)...)
+
+	// fields added in version 2
+	enc = append(enc, rezi.MustEnc(h.RequestID)...)
+
 	return enc, nil
 }
 
 func (h *Hit) UnmarshalBinary(data []byte) error {
-	rr, err := rezi.NewReader(bytes.NewBuffer(data), nil)
-	if err != nil {
-		return err
-	}
-
 	var decoded Hit
+	var offset int
 
-	// decode time
-	err = rr.Dec(&decoded.Time)
-	if err != nil {
-		return rezi.Wrapf(0, "time: %s", err)
+	// decode each field in turn, keeping track of how far into data we are so
+	// that the end of version 0 data can be detected.
+	dec := func(name string, v interface{}) error {
+		n, err := rezi.Dec(data[offset:], v)
+		if err != nil {
+			return rezi.Wrapf(offset, name+": %s", err)
+		}
+		offset += n
+		return nil
 	}
 
-	// decode host
-	err = rr.Dec(&decoded.Host)
-	if err != nil {
-		return rezi.Wrapf(0, "host: %s", err)
+	if err := dec("time", &decoded.Time); err != nil {
+		return err
 	}
-
-	// decode resource
-	err = rr.Dec(&decoded.Resource)
-	if err != nil {
-		return rezi.Wrapf(0, "resource: %s", err)
+	if err := dec("host", &decoded.Host); err != nil {
+		return err
+	}
+	if err := dec("resource", &decoded.Resource); err != nil {
+		return err
+	}
+	if err := dec("client", &decoded.Client); err != nil {
+		return err
 	}
 
-	// decode client
-	err = rr.Dec(&decoded.Client)
-	if err != nil {
-		return rezi.Wrapf(0, "client: %s", err)
+	// version 0 data ends here
+	if offset < len(data) {
+		var version int
+		if err := dec("version", &version); err != nil {
+			return err
+		}
+		if version > hitVersion {
+			return fmt.Errorf("hit encoded with unsupported version %d; max supported is %d", version, hitVersion)
+		}
+
+		if err := dec("user agent", &decoded.UserAgent); err != nil {
+			return err
+		}
+		if err := dec("referrer", &decoded.Referrer); err != nil {
+			return err
+		}
+		if err := dec("method", &decoded.Method); err != nil {
+			return err
+		}
+		if err := dec("status code", &decoded.StatusCode); err != nil {
+			return err
+		}
+
+		if version >= 2 {
+			if err := dec("request ID", &decoded.RequestID); err != nil {
+				return err
+			}
+		}
 	}
 
 	decoded.normalizeForDB()
@@ -232,12 +297,30 @@ func (hit Hit) Equal(other interface{}) bool {
 	if !hit.Client.Equal(oHit.Client) {
 		return false
 	}
+	if hit.UserAgent != oHit.UserAgent {
+		return false
+	}
+	if hit.Referrer != oHit.Referrer {
+		return false
+	}
+	if hit.Method != oHit.Method {
+		return false
+	}
+	if hit.StatusCode != oHit.StatusCode {
+		return false
+	}
+	if hit.RequestID != oHit.RequestID {
+		return false
+	}
 
 	return true
 }
 
 func (hit Hit) String() string {
-	return fmt.Sprintf("[%s %s %s %s]", hit.Time.Format(time.RFC3339), hit.Host, hit.Resource, hit.Client)
+	if hit.Method == "" && hit.StatusCode == 0 {
+		return fmt.Sprintf("[%s %s %s %s]", hit.Time.Format(time.RFC3339), hit.Host, hit.Resource, hit.Client)
+	}
+	return fmt.Sprintf("[%s %s %s %s %d %s]", hit.Time.Format(time.RFC3339), hit.Method, hit.Host, hit.Resource, hit.StatusCode, hit.Client)
 }
 
 // Store holds analytics data and provides access to both storage (OLTP) and
@@ -263,6 +346,11 @@ type Store struct {
 	mtx    sync.RWMutex
 	closed bool
 
+	// persistMtx serializes writes to DataFile. It is held without mtx while
+	// a snapshot of the data is written so that the Store can be used during
+	// persistence.
+	persistMtx sync.Mutex
+
 	// hits is the source of truth of the Store. Indexes will refer to Hits by
 	// indexes into this slice.
 	//
@@ -274,6 +362,10 @@ type Store struct {
 // the file already exists, its entire contents are loaded into a new *Store
 // which is then returned. If the file does not exist, it will be created.
 //
+// A file written in an older format version is migrated as it is loaded, and
+// is written in the current version the next time the Store is persisted. Use
+// [UpgradeFile] to upgrade a file without otherwise using it.
+//
 // The returned Store will have its DataFile member set to the given file. This
 // does not make it so the returned Store will automatically save its contents
 // to disk, rather [Store.Persist] or [Store.Close] must be called manually to
@@ -311,6 +403,7 @@ func Open(file string) (*Store, error) {
 		}
 	}
 
+	s.DataFile = file
 	return s, nil
 }
 
@@ -384,9 +477,17 @@ func (s *Store) exportUnsafe() ([]byte, error) {
 		return nil, fmt.Errorf("operation called on closed *Store")
 	}
 
-	return rezi.Enc(s)
+	payload, err := rezi.Enc(s)
+	if err != nil {
+		return nil, err
+	}
+	return wrapFormat(payload), nil
 }
 
+// beforePersistWrite, if set, is called while a snapshot is being persisted,
+// before its data is marshaled. It is only set by tests.
+var beforePersistWrite func()
+
 // Persist waits for any pending data updates in the Store to be applied and
 // then saves the data, generally to disk. Persistance to disk will occur if
 // Store.DataFile is set to a non-empty string. If Store.DataFile is the empty
@@ -401,37 +502,63 @@ func (s *Store) exportUnsafe() ([]byte, error) {
 // disk, regardless of whether any changes occurred to the data since it was
 // last persisted or loaded. This has performance implications, especially as
 // the amount of data grows large.
+//
+// The data is copied to a snapshot under a brief read lock, and it is the
+// snapshot that is marshaled and written, so reads and writes of the Store can
+// proceed while it is being persisted. Changes made after the snapshot is taken
+// are saved by the next call to Persist.
 func (s *Store) Persist() error {
-	s.mtx.Lock()
-	defer s.mtx.Unlock()
-
-	return s.persistUnsafe()
-}
+	s.persistMtx.Lock()
+	defer s.persistMtx.Unlock()
 
-// persistUnsafe does actual work of Persist. It assumes the caller has aqcuired
-// a write lock on the data mutex.
-func (s *Store) persistUnsafe() error {
+	s.mtx.RLock()
 	if s.closed {
+		s.mtx.RUnlock()
 		return fmt.Errorf("operation called on closed *Store")
 	}
+	snap := s.snapshotUnsafe()
+	s.mtx.RUnlock()
 
-	// we don't currently have a concept of "pending operations" besides just
-	// the write lock to be sure we are the most recent writer and any pending
-	// readers wait for us, and the caller should have already aquired a write
-	// lock so should be fine.
-	//
-	// however, when/if we do get pending operations, waiting for them to close
-	// would go here.
+	return snap.persistSnapshot(context.Background())
+}
 
-	if s.DataFile == "" {
+// snapshotUnsafe returns a new Store with a copy of the data in s. It assumes
+// the caller has acquired at least a read lock on the data mutex.
+//
+// Only the slice of hits is copied; the data that Hits refer to, such as
+// client addresses, is shared, as the Store never modifies it in place.
+func (s *Store) snapshotUnsafe() *Store {
+	snap := &Store{DataFile: s.DataFile}
+	snap.hits = make([]Hit, len(s.hits))
+	copy(snap.hits, s.hits)
+	return snap
+}
+
+// persistChunkSize is the number of bytes written to the data file between
+// checks of whether persisting has been canceled.
+const persistChunkSize = 64 * 1024
+
+// persistSnapshot does actual work of Persist on a snapshot of a Store created
+// with snapshotUnsafe, which is not shared and so needs no locking. The caller
+// must hold the persist mutex of the Store that the snapshot is of.
+//
+// If ctx is done before the data is written, persisting stops and the data file
+// is restored from its backup, so that it holds the data of the last persist
+// that finished instead of a partial write. The returned error then matches
+// ctx.Err().
+func (snap *Store) persistSnapshot(ctx context.Context) error {
+	if snap.DataFile == "" {
 		// nowhere to persist to. done.
 		return nil
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	// first, copy the old file so we have a backup in case somefin goes wrong
-	buFile, err := createFileBackup(s.DataFile)
+	buFile, err := createFileBackup(snap.DataFile)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, os.ErrNotExist) {
 			// that's fine actually, but set buFile to empty so we know we don't
 			// have one to delete later
 			buFile = ""
@@ -440,24 +567,59 @@ func (s *Store) persistUnsafe() error {
 		}
 	}
 
+	if err := ctx.Err(); err != nil {
+		if buFile != "" {
+			os.Remove(buFile)
+		}
+		return err
+	}
+
 	// open the data file
-	wf, err := os.Create(s.DataFile)
+	wf, err := os.Create(snap.DataFile)
 	if err != nil {
 		return fmt.Errorf("create data file: %w", err)
 	}
 	defer wf.Close()
 	w := bufio.NewWriter(wf)
 
+	// on cancel, put back the file as it was before this persist began
+	canceled := func(err error) error {
+		wf.Close()
+		if buFile == "" {
+			os.Remove(snap.DataFile)
+			return err
+		}
+		if rErr := os.Rename(buFile, snap.DataFile); rErr != nil {
+			return fmt.Errorf("%w; additionally, restore backup: %v", err, rErr)
+		}
+		return err
+	}
+
 	// now that we have an open data file, get the data and write it all to it.
 	// TODO: could probably do this in parallel with backup creation and data
 	// file open.
-	dataBytes, err := s.exportUnsafe()
+	if beforePersistWrite != nil {
+		beforePersistWrite()
+	}
+	dataBytes, err := snap.exportUnsafe()
 	if err != nil {
 		return fmt.Errorf("get data bytes: %w", err)
 	}
 
-	_, err = w.Write(dataBytes)
-	if err != nil {
+	for len(dataBytes) > 0 {
+		if err := ctx.Err(); err != nil {
+			return canceled(err)
+		}
+		chunk := dataBytes
+		if len(chunk) > persistChunkSize {
+			chunk = chunk[:persistChunkSize]
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return fmt.Errorf("write data file: %w", err)
+		}
+		dataBytes = dataBytes[len(chunk):]
+	}
+	if err := w.Flush(); err != nil {
 		return fmt.Errorf("write data file: %w", err)
 	}
 
@@ -479,17 +641,31 @@ func (s *Store) persistUnsafe() error {
 // If the Store has already been closed, calling this method will have no effect
 // and the returned error will be nil.
 func (s *Store) Close() error {
+	return s.CloseContext(context.Background())
+}
+
+// CloseContext is like Close, but stops persisting the unflushed changes once
+// ctx is done, in which case the data file is left as it was after the last
+// persist that finished and the returned error matches ctx.Err(). The Store is
+// closed regardless.
+func (s *Store) CloseContext(ctx context.Context) error {
+	s.persistMtx.Lock()
+	defer s.persistMtx.Unlock()
+
 	s.mtx.Lock()
-	defer s.mtx.Unlock()
 	if s.closed {
+		s.mtx.Unlock()
 		return nil
 	}
 
-	err := s.persistUnsafe()
-
-	// close the connection even if err is not nil; we don't want the Store to
-	// be usable after return.
+	// close the connection even if persisting fails; we don't want the Store
+	// to be usable after return. Taking the snapshot under the write lock
+	// ensures nothing is changed after it.
+	snap := s.snapshotUnsafe()
 	s.closed = true
+	s.mtx.Unlock()
+
+	err := snap.persistSnapshot(ctx)
 
 	if err != nil {
 		return fmt.Errorf("persist data to disk: %w", err)
@@ -498,7 +674,8 @@ func (s *Store) Close() error {
 }
 
 // Import loads the given data bytes into a new in-memory Store. The data bytes
-// must have been created by a prior call to [Store.Export].
+// must have been created by a prior call to [Store.Export]. Data exported in an
+// older format version is migrated to the current one.
 //
 // The returned Store will be in-memory only by default, and will not persist to
 // disk when [Store.Persist] is called. To change this, set DataFile on the
@@ -506,7 +683,16 @@ func (s *Store) Close() error {
 func Import(data []byte) (*Store, error) {
 	s := &Store{}
 
-	_, err := rezi.Dec(data, s)
+	version, payload, err := unwrapFormat(data)
+	if err != nil {
+		return s, err
+	}
+	payload, err = migrate(version, payload)
+	if err != nil {
+		return s, err
+	}
+
+	_, err = rezi.Dec(payload, s)
 	return s, err
 }
 
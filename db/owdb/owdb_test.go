@@ -1,10 +1,14 @@
 package owdb
 
 import (
+	"context"
+	"errors"
 	"net"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/dekarrin/rezi/v2"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -62,6 +66,19 @@ func Test_Store_Select(t *testing.T) {
 				{Time: april09(13, 2, 0, 0), Resource: "/tavros.html"},
 			},
 		},
+		{
+			name: "select by indexed property Time with upper bound",
+			store: &Store{hits: []Hit{
+				{Time: april09(13, 0, 0, 0), Resource: "/aradia.html"},
+				{Time: april09(13, 1, 0, 0), Resource: "/vriska.html"},
+				{Time: april09(13, 2, 0, 0), Resource: "/tavros.html"},
+			}},
+			filter: Where{Time: IsBefore(april09(13, 1, 30, 0))},
+			expect: []Hit{
+				{Time: april09(13, 0, 0, 0), Resource: "/aradia.html"},
+				{Time: april09(13, 1, 0, 0), Resource: "/vriska.html"},
+			},
+		},
 		{
 			name: "select by non-indexed prop Host",
 			store: &Store{hits: []Hit{
@@ -677,3 +694,181 @@ func Test_Store_applyFilter(t *testing.T) {
 		})
 	}
 }
+
+func Test_Hit_MarshalBinary(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		assert := assert.New(t)
+
+		hit := Hit{
+			Time:       april09(13, 0, 0, 0),
+			Host:       "server1",
+			Resource:   "/aradia.html",
+			Client:     Requester{Address: net.ParseIP("10.0.0.1"), Country: "US"},
+			UserAgent:  "curl/8.1.2",
+			Referrer:   "https://example.com/",
+			Method:     "GET",
+			StatusCode: 200,
+			RequestID:  "host/abc-000413",
+		}
+
+		data, err := hit.MarshalBinary()
+		if !assert.NoError(err) {
+			return
+		}
+
+		var actual Hit
+		assert.NoError(actual.UnmarshalBinary(data))
+		assert.True(hit.Equal(actual), "expected %s, got %s", hit, actual)
+	})
+
+	t.Run("version 0 data", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var data []byte
+		data = append(data, rezi.MustEnc(april09(13, 0, 0, 0))...)
+		data = append(data, rezi.MustEnc("server1")...)
+		data = append(data, rezi.MustEnc("/aradia.html")...)
+		data = append(data, rezi.MustEnc(Requester{})...)
+
+		var actual Hit
+		assert.NoError(actual.UnmarshalBinary(data))
+		assert.Equal(Hit{Time: april09(13, 0, 0, 0), Host: "server1", Resource: "/aradia.html"}, actual)
+	})
+
+	t.Run("version 1 data", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var data []byte
+		data = append(data, rezi.MustEnc(april09(13, 0, 0, 0))...)
+		data = append(data, rezi.MustEnc("server1")...)
+		data = append(data, rezi.MustEnc("/aradia.html")...)
+		data = append(data, rezi.MustEnc(Requester{})...)
+		data = append(data, rezi.MustEnc(1)...)
+		data = append(data, rezi.MustEnc("curl/8.1.2")...)
+		data = append(data, rezi.MustEnc("")...)
+		data = append(data, rezi.MustEnc("GET")...)
+		data = append(data, rezi.MustEnc(200)...)
+
+		var actual Hit
+		assert.NoError(actual.UnmarshalBinary(data))
+		assert.Equal(Hit{Time: april09(13, 0, 0, 0), Host: "server1", Resource: "/aradia.html", UserAgent: "curl/8.1.2", Method: "GET", StatusCode: 200}, actual)
+	})
+}
+
+func Test_Store_Persist(t *testing.T) {
+	assert := assert.New(t)
+
+	file := filepath.Join(t.TempDir(), "hits.owv")
+	store := &Store{DataFile: file}
+	assert.NoError(store.Insert(Hit{Time: april09(13, 0, 0, 0), Resource: "/aradia.html"}))
+	assert.NoError(store.Persist())
+
+	loaded, err := ImportFile(file)
+	if !assert.NoError(err) {
+		return
+	}
+	hits, err := loaded.Select(nil)
+	assert.NoError(err)
+	assert.Equal([]Hit{{Time: april09(13, 0, 0, 0), Resource: "/aradia.html"}}, hits)
+}
+
+func Test_Store_Persist_concurrentAccess(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := Open(filepath.Join(t.TempDir(), "hits.owv"))
+	if !assert.NoError(err) {
+		return
+	}
+	for i := 0; i < 10; i++ {
+		assert.NoError(store.Insert(Hit{Time: april09(13, i, 0, 0)}))
+	}
+
+	// hold the persist in the middle of writing until the reads and writes
+	// below are done
+	writing := make(chan struct{})
+	release := make(chan struct{})
+	beforePersistWrite = func() {
+		close(writing)
+		<-release
+	}
+	defer func() { beforePersistWrite = nil }()
+
+	persistDone := make(chan error)
+	go func() {
+		persistDone <- store.Persist()
+	}()
+	<-writing
+
+	accessDone := make(chan struct{})
+	go func() {
+		defer close(accessDone)
+		hits, err := store.Select(nil)
+		assert.NoError(err)
+		assert.Len(hits, 10)
+		assert.NoError(store.Insert(Hit{Time: april09(13, 11, 0, 0)}))
+	}()
+
+	select {
+	case <-accessDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reads and writes were blocked by Persist")
+	}
+
+	close(release)
+	assert.NoError(<-persistDone)
+
+	// the persisted data is the snapshot from before the insert
+	beforePersistWrite = nil
+	loaded, err := Open(store.DataFile)
+	if !assert.NoError(err) {
+		return
+	}
+	hits, err := loaded.Select(nil)
+	assert.NoError(err)
+	assert.Len(hits, 10)
+
+	assert.NoError(store.Close())
+	loaded, err = Open(store.DataFile)
+	if !assert.NoError(err) {
+		return
+	}
+	hits, err = loaded.Select(nil)
+	assert.NoError(err)
+	assert.Len(hits, 11)
+}
+
+func Test_Store_CloseContext_canceled(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := Open(filepath.Join(t.TempDir(), "hits.owv"))
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NoError(store.Insert(Hit{Time: april09(13, 0, 0, 0)}))
+	if !assert.NoError(store.Persist()) {
+		return
+	}
+	assert.NoError(store.Insert(Hit{Time: april09(13, 1, 0, 0)}))
+
+	// the deadline passes in the middle of the final persist
+	ctx, cancel := context.WithCancel(context.Background())
+	beforePersistWrite = cancel
+	defer func() { beforePersistWrite = nil }()
+
+	err = store.CloseContext(ctx)
+	assert.True(errors.Is(err, context.Canceled), "unexpected error: %v", err)
+
+	// the Store is closed anyways
+	_, err = store.Select(nil)
+	assert.Error(err)
+
+	// and the file has the data of the last persist that finished
+	beforePersistWrite = nil
+	loaded, err := Open(store.DataFile)
+	if !assert.NoError(err) {
+		return
+	}
+	hits, err := loaded.Select(nil)
+	assert.NoError(err)
+	assert.Len(hits, 1)
+}
@@ -0,0 +1,194 @@
+package owdb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UserAgent is the information about a client that is parsed from the
+// User-Agent header it sent. Fields that cannot be determined are left empty.
+type UserAgent struct {
+	// Browser is the name of the browser or other client program, such as
+	// "Firefox" or "curl".
+	Browser string
+
+	// Version is the major version of the browser, such as "118".
+	Version string
+
+	// OS is the name of the operating system the client runs on, such as
+	// "Windows" or "iOS".
+	OS string
+
+	// Mobile is whether the client is on a mobile device.
+	Mobile bool
+
+	// Bot is whether the client identifies itself as an automated crawler.
+	Bot bool
+}
+
+func (ua UserAgent) String() string {
+	browser := ua.Browser
+	if browser == "" {
+		browser = "Unknown"
+	}
+	if ua.Version != "" {
+		browser += " " + ua.Version
+	}
+	if ua.OS != "" {
+		browser += " on " + ua.OS
+	}
+	return browser
+}
+
+// uaBrowserTokens are the product tokens that identify a browser in a
+// User-Agent, in the order they are checked. Many browsers include the tokens
+// of the ones they are based on, so more specific tokens come first.
+var uaBrowserTokens = []struct {
+	token string
+	name  string
+}{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Version/", "Safari"}, // Safari gives its version in Version/, not Safari/
+	{"MSIE ", "Internet Explorer"},
+	{"Trident/", "Internet Explorer"},
+	{"curl/", "curl"},
+	{"Wget/", "Wget"},
+}
+
+// uaOSTokens are the substrings that identify an OS in a User-Agent, in the
+// order they are checked.
+var uaOSTokens = []struct {
+	token string
+	name  string
+}{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"iPod", "iOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// uaBotTokens are lowercase substrings that identify an automated client.
+var uaBotTokens = []string{"bot", "crawl", "spider", "slurp"}
+
+// ParseUserAgent parses the given User-Agent header. It recognizes the common
+// browsers and operating systems only; it is intended for giving a breakdown
+// of the clients that hit a site, not for detecting client capabilities.
+func ParseUserAgent(s string) UserAgent {
+	var ua UserAgent
+
+	lower := strings.ToLower(s)
+	for _, tok := range uaBotTokens {
+		if strings.Contains(lower, tok) {
+			ua.Bot = true
+			break
+		}
+	}
+
+	for _, b := range uaBrowserTokens {
+		idx := strings.Index(s, b.token)
+		if idx < 0 {
+			continue
+		}
+		if b.name == "Safari" && !strings.Contains(s, "Safari/") {
+			continue
+		}
+		if b.token == "Trident/" {
+			// Trident/7.0 is IE 11; its rv: gives the version
+			if rv := strings.Index(s, "rv:"); rv >= 0 {
+				ua.Version = majorVersion(s[rv+len("rv:"):])
+			}
+		} else {
+			ua.Version = majorVersion(s[idx+len(b.token):])
+		}
+		ua.Browser = b.name
+		break
+	}
+
+	for _, o := range uaOSTokens {
+		if strings.Contains(s, o.token) {
+			ua.OS = o.name
+			break
+		}
+	}
+
+	ua.Mobile = strings.Contains(s, "Mobi") || ua.OS == "iOS" && !strings.Contains(s, "iPad")
+
+	return ua
+}
+
+// majorVersion returns the leading digits of s.
+func majorVersion(s string) string {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	return s[:end]
+}
+
+// IsBrowser returns a Criterion that checks that the User-Agent property of
+// interest is from the named browser, as given by ParseUserAgent. The name is
+// not case-sensitive.
+func IsBrowser(name string) Criterion[string] {
+	return Criterion[string]{
+		Meets: func(v string) bool {
+			return strings.EqualFold(ParseUserAgent(v).Browser, name)
+		},
+		Format:    "BROWSER(%s)" + fmt.Sprintf(" == %q", name),
+		NotFormat: "BROWSER(%s)" + fmt.Sprintf(" != %q", name),
+	}
+}
+
+// IsOS returns a Criterion that checks that the User-Agent property of
+// interest is from a client on the named operating system, as given by
+// ParseUserAgent. The name is not case-sensitive.
+func IsOS(name string) Criterion[string] {
+	return Criterion[string]{
+		Meets: func(v string) bool {
+			return strings.EqualFold(ParseUserAgent(v).OS, name)
+		},
+		Format:    "OS(%s)" + fmt.Sprintf(" == %q", name),
+		NotFormat: "OS(%s)" + fmt.Sprintf(" != %q", name),
+	}
+}
+
+// IsBot returns a Criterion that checks that the User-Agent property of
+// interest is from an automated crawler, as given by ParseUserAgent.
+func IsBot() Criterion[string] {
+	return Criterion[string]{
+		Meets: func(v string) bool {
+			return ParseUserAgent(v).Bot
+		},
+		Format:    "BOT(%s)",
+		NotFormat: "!BOT(%s)",
+	}
+}
+
+// CountBy counts the hits for each key that the key function gives. It can be
+// used with the results of [Store.Select] to give a breakdown of hits, such as
+// by browser:
+//
+//	hits, err := store.Select(Where{Time: IsAfter(since)})
+//	...
+//	byBrowser := CountBy(hits, func(h Hit) string {
+//		return ParseUserAgent(h.UserAgent).Browser
+//	})
+func CountBy(hits []Hit, key func(h Hit) string) map[string]int {
+	counts := map[string]int{}
+	for _, h := range hits {
+		counts[key(h)]++
+	}
+	return counts
+}
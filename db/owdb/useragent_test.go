@@ -0,0 +1,98 @@
+package owdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseUserAgent(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		expect UserAgent
+	}{
+		{
+			name:   "empty",
+			input:  "",
+			expect: UserAgent{},
+		},
+		{
+			name:   "firefox on windows",
+			input:  "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:118.0) Gecko/20100101 Firefox/118.0",
+			expect: UserAgent{Browser: "Firefox", Version: "118", OS: "Windows"},
+		},
+		{
+			name:   "chrome on linux",
+			input:  "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/117.0.0.0 Safari/537.36",
+			expect: UserAgent{Browser: "Chrome", Version: "117", OS: "Linux"},
+		},
+		{
+			name:   "edge on windows",
+			input:  "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/117.0.0.0 Safari/537.36 Edg/117.0.2045.43",
+			expect: UserAgent{Browser: "Edge", Version: "117", OS: "Windows"},
+		},
+		{
+			name:   "safari on iphone",
+			input:  "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+			expect: UserAgent{Browser: "Safari", Version: "17", OS: "iOS", Mobile: true},
+		},
+		{
+			name:   "chrome on android",
+			input:  "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/117.0.0.0 Mobile Safari/537.36",
+			expect: UserAgent{Browser: "Chrome", Version: "117", OS: "Android", Mobile: true},
+		},
+		{
+			name:   "internet explorer 11",
+			input:  "Mozilla/5.0 (Windows NT 6.1; Trident/7.0; rv:11.0) like Gecko",
+			expect: UserAgent{Browser: "Internet Explorer", Version: "11", OS: "Windows"},
+		},
+		{
+			name:   "crawler",
+			input:  "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			expect: UserAgent{Bot: true},
+		},
+		{
+			name:   "curl",
+			input:  "curl/8.1.2",
+			expect: UserAgent{Browser: "curl", Version: "8"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			actual := ParseUserAgent(tc.input)
+
+			assert.Equal(tc.expect, actual)
+		})
+	}
+}
+
+func Test_CountBy(t *testing.T) {
+	assert := assert.New(t)
+
+	store := &Store{hits: []Hit{
+		{Time: april09(13, 0, 0, 0), UserAgent: "Mozilla/5.0 (Windows NT 10.0; rv:118.0) Gecko/20100101 Firefox/118.0", StatusCode: 200},
+		{Time: april09(13, 1, 0, 0), UserAgent: "Mozilla/5.0 (X11; Linux x86_64) Chrome/117.0.0.0 Safari/537.36", StatusCode: 404},
+		{Time: april09(13, 2, 0, 0), UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:118.0) Gecko/20100101 Firefox/118.0", StatusCode: 200},
+	}}
+
+	hits, err := store.Select(Where{StatusCode: IsStatusClass(2)})
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Equal(map[string]int{"Firefox": 2}, CountBy(hits, func(h Hit) string {
+		return ParseUserAgent(h.UserAgent).Browser
+	}))
+
+	hits, err = store.Select(Where{UserAgent: IsOS("linux")})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(map[string]int{"Chrome": 1, "Firefox": 1}, CountBy(hits, func(h Hit) string {
+		return ParseUserAgent(h.UserAgent).Browser
+	}))
+}
@@ -458,6 +458,11 @@ type Where struct {
 	ClientAddress Criterion[net.IP]
 	ClientCountry Criterion[string]
 	ClientCity    Criterion[string]
+	UserAgent     Criterion[string]
+	Referrer      Criterion[string]
+	Method        Criterion[string]
+	StatusCode    Criterion[int]
+	RequestID     Criterion[string]
 }
 
 // Matches returns whether the criteria defined by this Where match the
@@ -499,6 +504,36 @@ func (w Where) Matches(h Hit) bool {
 		}
 	}
 
+	if w.UserAgent.Meets != nil {
+		if !w.UserAgent.Meets(h.UserAgent) {
+			return false
+		}
+	}
+
+	if w.Referrer.Meets != nil {
+		if !w.Referrer.Meets(h.Referrer) {
+			return false
+		}
+	}
+
+	if w.Method.Meets != nil {
+		if !w.Method.Meets(h.Method) {
+			return false
+		}
+	}
+
+	if w.StatusCode.Meets != nil {
+		if !w.StatusCode.Meets(h.StatusCode) {
+			return false
+		}
+	}
+
+	if w.RequestID.Meets != nil {
+		if !w.RequestID.Meets(h.RequestID) {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -48,6 +48,18 @@ func Test_Where_Matches(t *testing.T) {
 			input:  Hit{Time: time.Now()},
 			expect: false,
 		},
+		{
+			name:   "request ID criterion matches same ID",
+			where:  Where{RequestID: EqualsString("host/abc-000413")},
+			input:  Hit{RequestID: "host/abc-000413"},
+			expect: true,
+		},
+		{
+			name:   "request ID criterion does not match other ID",
+			where:  Where{RequestID: EqualsString("host/abc-000413")},
+			input:  Hit{RequestID: "host/abc-000612"},
+			expect: false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,261 @@
+package jelly
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConnectPolicy is when a DB in the config is connected to.
+type ConnectPolicy string
+
+const (
+	// ConnectEager connects to the DB when the server is created, which fails
+	// if it cannot be connected to. It is the default.
+	ConnectEager ConnectPolicy = "eager"
+
+	// ConnectLazy starts connecting to the DB in the background when the
+	// server is created, without waiting for it. Uses of the DB before it is
+	// connected wait for it.
+	ConnectLazy ConnectPolicy = "lazy"
+
+	// ConnectOnFirstUse connects to the DB the first time that it is used,
+	// such as by an API calling LazyStore.Get. DBs that are rarely used do not
+	// slow startup or hold a connection until they are needed.
+	ConnectOnFirstUse ConnectPolicy = "first-use"
+)
+
+func (cp ConnectPolicy) String() string {
+	return string(cp)
+}
+
+// ParseConnectPolicy parses the name of a ConnectPolicy. It is not
+// case-sensitive.
+func ParseConnectPolicy(s string) (ConnectPolicy, error) {
+	policy := ConnectPolicy(strings.ToLower(s))
+	switch policy {
+	case ConnectEager, ConnectLazy, ConnectOnFirstUse:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("must be one of %q, %q, or %q", ConnectEager, ConnectLazy, ConnectOnFirstUse)
+	}
+}
+
+// DBStats is the statistics on the connection to a DB. It is returned by
+// RESTServer.DBStats and LazyStore.Stats, and can be exported to metrics
+// systems.
+type DBStats struct {
+	// Policy is when the DB is connected to.
+	Policy ConnectPolicy `json:"policy"`
+
+	// Connected is whether the DB is currently connected to.
+	Connected bool `json:"connected"`
+
+	// Opens is the number of times that the DB was connected to.
+	Opens int64 `json:"opens"`
+
+	// Failures is the number of times that connecting to the DB failed.
+	Failures int64 `json:"failures"`
+
+	// Closes is the number of times that the connection to the DB was closed.
+	Closes int64 `json:"closes"`
+
+	// LastOpened is when the DB was last connected to. It is the zero time if
+	// it never has been.
+	LastOpened time.Time `json:"last_opened"`
+
+	// LastClosed is when the connection to the DB was last closed. It is the
+	// zero time if it never has been.
+	LastClosed time.Time `json:"last_closed"`
+}
+
+// LazyStore is a Store for a DB that is connected to when it is first needed
+// instead of when the server is created. Bundle.LazyDB gives the LazyStore of
+// a DB that an API uses, which the API calls Get on each time it needs the
+// Store. It is safe for concurrent use.
+//
+// If connecting fails, the next call to Get tries again. If a call to Get
+// stops waiting for a connection because of its context or the LazyStore's
+// timeout, the connection continues in the background and is used by later
+// calls once it is made.
+type LazyStore struct {
+	name    string
+	policy  ConnectPolicy
+	timeout time.Duration
+	connect func() (Store, error)
+
+	mtx        sync.Mutex
+	store      Store
+	connecting chan struct{} // closed when the connection in progress is done
+	lastErr    error         // why the last connection failed
+	closed     bool
+	stats      DBStats
+}
+
+// NewLazyStore returns a LazyStore for the DB with the given name that is
+// connected to with connect. It is not connected to until Get or Connect is
+// called. If timeout is greater than 0, calls to Get wait at most that long for
+// the DB to be connected to.
+func NewLazyStore(name string, policy ConnectPolicy, timeout time.Duration, connect func() (Store, error)) *LazyStore {
+	return &LazyStore{
+		name:    name,
+		policy:  policy,
+		timeout: timeout,
+		connect: connect,
+		stats:   DBStats{Policy: policy},
+	}
+}
+
+// connectedLazyStore returns a LazyStore that is already connected to store.
+func connectedLazyStore(name string, store Store) *LazyStore {
+	return &LazyStore{
+		name:   name,
+		policy: ConnectEager,
+		store:  store,
+		stats:  DBStats{Policy: ConnectEager, Connected: true, Opens: 1, LastOpened: time.Now()},
+	}
+}
+
+// Name returns the name of the DB in the config.
+func (ls *LazyStore) Name() string {
+	return ls.name
+}
+
+// Connected returns whether the DB is currently connected to.
+func (ls *LazyStore) Connected() bool {
+	ls.mtx.Lock()
+	defer ls.mtx.Unlock()
+	return ls.store != nil
+}
+
+// Stats returns the statistics on the connection to the DB.
+func (ls *LazyStore) Stats() DBStats {
+	ls.mtx.Lock()
+	defer ls.mtx.Unlock()
+	return ls.stats
+}
+
+// Connect starts connecting to the DB in the background if it is not already
+// connected or being connected to, and returns without waiting for it.
+func (ls *LazyStore) Connect() {
+	ls.mtx.Lock()
+	defer ls.mtx.Unlock()
+	ls.startConnect()
+}
+
+// startConnect starts connecting to the DB in the background if it is not
+// already connected or being connected to, and returns the channel that is
+// closed once the connection is done. ls.mtx must be held by the caller.
+func (ls *LazyStore) startConnect() chan struct{} {
+	if ls.store != nil || ls.closed {
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	if ls.connecting != nil {
+		return ls.connecting
+	}
+
+	done := make(chan struct{})
+	ls.connecting = done
+	go func() {
+		store, err := ls.connect()
+
+		ls.mtx.Lock()
+		defer ls.mtx.Unlock()
+		defer close(done)
+		ls.connecting = nil
+
+		if err != nil {
+			ls.lastErr = err
+			ls.stats.Failures++
+			return
+		}
+		if ls.closed {
+			// closed while connecting; nobody will use it
+			store.Close()
+			return
+		}
+		ls.store = store
+		ls.lastErr = nil
+		ls.stats.Connected = true
+		ls.stats.Opens++
+		ls.stats.LastOpened = time.Now()
+	}()
+	return done
+}
+
+// Get returns the Store of the DB, connecting to it first if it is not yet
+// connected. It waits for the connection until ctx is done or the timeout of
+// the LazyStore passes, whichever is first. If the DB cannot be connected to
+// in time, the returned error matches ErrUnavailable, and also ErrTimeout if
+// the timeout of the LazyStore passed.
+func (ls *LazyStore) Get(ctx context.Context) (Store, error) {
+	ls.mtx.Lock()
+	if ls.store != nil {
+		defer ls.mtx.Unlock()
+		return ls.store, nil
+	}
+	if ls.closed {
+		ls.mtx.Unlock()
+		return nil, NewError(fmt.Sprintf("DB %q is closed", ls.name), ErrUnavailable)
+	}
+	done := ls.startConnect()
+	ls.mtx.Unlock()
+
+	var timeout <-chan time.Time
+	if ls.timeout > 0 {
+		timer := time.NewTimer(ls.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-done:
+	case <-timeout:
+		return nil, NewError(fmt.Sprintf("connect DB %q", ls.name), ErrTimeout, ErrUnavailable)
+	case <-ctx.Done():
+		return nil, NewError(fmt.Sprintf("connect DB %q", ls.name), ctx.Err(), ErrUnavailable)
+	}
+
+	ls.mtx.Lock()
+	defer ls.mtx.Unlock()
+	if ls.store == nil {
+		if ls.closed {
+			return nil, NewError(fmt.Sprintf("DB %q is closed", ls.name), ErrUnavailable)
+		}
+		return nil, NewError(fmt.Sprintf("connect DB %q", ls.name), ls.lastErr, ErrUnavailable)
+	}
+	return ls.store, nil
+}
+
+// Close closes the connection to the DB if there is one. A connection that is
+// in progress is closed once it is made. Calls to Get after Close return an
+// error.
+func (ls *LazyStore) Close() error {
+	return ls.CloseContext(context.Background())
+}
+
+// CloseContext is like Close but closes the Store of the DB with CloseStore,
+// giving up once ctx is done. The LazyStore is closed even if it gives up.
+func (ls *LazyStore) CloseContext(ctx context.Context) error {
+	ls.mtx.Lock()
+	defer ls.mtx.Unlock()
+
+	if ls.closed {
+		return nil
+	}
+	ls.closed = true
+	if ls.store == nil {
+		return nil
+	}
+
+	err := CloseStore(ctx, ls.store)
+	ls.store = nil
+	ls.stats.Connected = false
+	ls.stats.Closes++
+	ls.stats.LastClosed = time.Now()
+	return err
+}
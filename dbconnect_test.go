@@ -0,0 +1,184 @@
+package jelly
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type closeCountStore struct {
+	closes *int
+}
+
+func (s closeCountStore) Close() error {
+	*s.closes++
+	return nil
+}
+
+func Test_ParseConnectPolicy(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		expect    ConnectPolicy
+		expectErr bool
+	}{
+		{name: "eager", input: "eager", expect: ConnectEager},
+		{name: "lazy", input: "LAZY", expect: ConnectLazy},
+		{name: "first-use", input: "First-Use", expect: ConnectOnFirstUse},
+		{name: "empty", input: "", expectErr: true},
+		{name: "unknown", input: "sometimes", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			actual, err := ParseConnectPolicy(tc.input)
+			if tc.expectErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expect, actual)
+		})
+	}
+}
+
+func Test_LazyStore_Get(t *testing.T) {
+	assert := assert.New(t)
+
+	closes := 0
+	attempts := 0
+	ls := NewLazyStore("reports", ConnectOnFirstUse, 0, func() (Store, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errors.New("connection refused")
+		}
+		return closeCountStore{closes: &closes}, nil
+	})
+	assert.False(ls.Connected())
+	assert.Equal(0, attempts, "connected before first use")
+
+	_, err := ls.Get(context.Background())
+	assert.EqualError(err, `connect DB "reports": connection refused`)
+	assert.ErrorIs(err, ErrUnavailable)
+	assert.False(ls.Connected())
+
+	store, err := ls.Get(context.Background())
+	if !assert.NoError(err) {
+		return
+	}
+	assert.IsType(closeCountStore{}, store)
+	assert.True(ls.Connected())
+
+	// connected stores are not connected to again
+	_, err = ls.Get(context.Background())
+	assert.NoError(err)
+	assert.Equal(2, attempts)
+
+	assert.NoError(ls.Close())
+	assert.Equal(1, closes)
+	assert.False(ls.Connected())
+	_, err = ls.Get(context.Background())
+	assert.ErrorIs(err, ErrUnavailable)
+
+	stats := ls.Stats()
+	assert.Equal(ConnectOnFirstUse, stats.Policy)
+	assert.False(stats.Connected)
+	assert.Equal(int64(1), stats.Opens)
+	assert.Equal(int64(1), stats.Failures)
+	assert.Equal(int64(1), stats.Closes)
+	assert.False(stats.LastOpened.IsZero())
+	assert.False(stats.LastClosed.IsZero())
+}
+
+func Test_LazyStore_Get_timeout(t *testing.T) {
+	assert := assert.New(t)
+
+	release := make(chan struct{})
+	closes := 0
+	ls := NewLazyStore("reports", ConnectLazy, 10*time.Millisecond, func() (Store, error) {
+		<-release
+		return closeCountStore{closes: &closes}, nil
+	})
+
+	_, err := ls.Get(context.Background())
+	assert.EqualError(err, `connect DB "reports": the operation timed out`)
+	assert.ErrorIs(err, ErrTimeout)
+	assert.ErrorIs(err, ErrUnavailable)
+
+	// connecting continues after the timeout and is used by the next Get
+	close(release)
+	ls.timeout = 0
+	_, err = ls.Get(context.Background())
+	assert.NoError(err)
+	assert.Equal(int64(1), ls.Stats().Opens)
+}
+
+func Test_LazyStore_Close_whileConnecting(t *testing.T) {
+	assert := assert.New(t)
+
+	release := make(chan struct{})
+	closes := 0
+	ls := NewLazyStore("reports", ConnectLazy, 0, func() (Store, error) {
+		<-release
+		return closeCountStore{closes: &closes}, nil
+	})
+	ls.Connect()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ls.Get(ctx)
+	assert.ErrorIs(err, context.Canceled)
+
+	assert.NoError(ls.Close())
+	close(release)
+
+	_, err = ls.Get(context.Background())
+	assert.EqualError(err, `DB "reports" is closed: a required service is unavailable`)
+
+	// wait for the connection to finish so that it is closed
+	assert.Eventually(func() bool {
+		ls.mtx.Lock()
+		defer ls.mtx.Unlock()
+		return ls.connecting == nil
+	}, time.Second, time.Millisecond)
+	assert.Equal(1, closes)
+	assert.False(ls.Connected())
+}
+
+func Test_Bundle_LazyDB(t *testing.T) {
+	assert := assert.New(t)
+
+	closes := 0
+	connects := 0
+	lazy := NewLazyStore("reports", ConnectOnFirstUse, 0, func() (Store, error) {
+		connects++
+		return closeCountStore{closes: &closes}, nil
+	})
+	eager := closeCountStore{closes: &closes}
+
+	bndl := NewBundle((&CommonConfig{Name: "api", UsesDBs: []string{"main", "reports"}}).FillDefaults(), Globals{}, nil, map[string]Store{
+		"main":    eager,
+		"reports": lazy,
+	})
+
+	assert.Same(lazy, bndl.LazyDB(1))
+	assert.Equal(0, connects, "LazyDB connected to the DB")
+
+	mainLazy := bndl.LazyDB(0)
+	if assert.NotNil(mainLazy) {
+		assert.True(mainLazy.Connected())
+		store, err := mainLazy.Get(context.Background())
+		assert.NoError(err)
+		assert.Equal(eager, store)
+	}
+
+	assert.IsType(closeCountStore{}, bndl.DBNamed("REPORTS"))
+	assert.Equal(1, connects)
+
+	assert.Nil(bndl.LazyDBNamed("missing"))
+}
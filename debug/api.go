@@ -0,0 +1,151 @@
+package debug
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+)
+
+// debugAPI echoes back the details of requests made to it.
+type debugAPI struct {
+	maxBody int
+	redact  map[string]bool
+	log     jelly.Logger
+}
+
+func (api *debugAPI) Init(cb jelly.Bundle) error {
+	api.log = cb.Logger()
+	api.maxBody = cb.GetInt(ConfigKeyMaxBody)
+	api.redact = map[string]bool{}
+	for _, h := range cb.GetSlice(ConfigKeyRedactHeaders) {
+		api.redact[http.CanonicalHeaderKey(h)] = true
+	}
+
+	api.log.Warnf("jellydebug is enabled; request details are echoed to any client at %s", cb.Base())
+
+	return nil
+}
+
+func (api *debugAPI) Authenticators() map[string]jelly.Authenticator {
+	return nil
+}
+
+// Shutdown shuts down the debug API. This is added to implement jelly.API, and
+// has no effect on the API but to return the error of the context.
+func (api *debugAPI) Shutdown(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (api *debugAPI) Routes(em jelly.ServiceProvider) (router chi.Router, subpaths bool) {
+	optAuth := em.OptionalAuth()
+
+	r := chi.NewRouter()
+
+	r.With(optAuth).HandleFunc("/", api.httpEcho(em))
+	r.With(optAuth).HandleFunc("/*", api.httpEcho(em))
+
+	return r, true
+}
+
+type echoUser struct {
+	ID             string   `json:"id"`
+	Username       string   `json:"username"`
+	Role           string   `json:"role"`
+	TenantID       string   `json:"tenant_id,omitempty"`
+	ServiceAccount bool     `json:"service_account,omitempty"`
+	Guest          bool     `json:"guest,omitempty"`
+	Scopes         []string `json:"scopes,omitempty"`
+}
+
+type echoResponse struct {
+	Method        string              `json:"method"`
+	URI           string              `json:"uri"`
+	Route         string              `json:"route"`
+	URLParams     map[string]string   `json:"url_params,omitempty"`
+	Proto         string              `json:"proto"`
+	Host          string              `json:"host"`
+	RemoteAddr    string              `json:"remote_addr"`
+	RequestID     string              `json:"request_id,omitempty"`
+	Tenant        string              `json:"tenant,omitempty"`
+	Headers       map[string][]string `json:"headers"`
+	Body          string              `json:"body"`
+	BodyTruncated bool                `json:"body_truncated,omitempty"`
+	User          *echoUser           `json:"user"`
+}
+
+// httpEcho returns a HandlerFunc that responds with the details of the request.
+func (api *debugAPI) httpEcho(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		resp := echoResponse{
+			Method:     req.Method,
+			URI:        req.URL.RequestURI(),
+			Proto:      req.Proto,
+			Host:       req.Host,
+			RemoteAddr: req.RemoteAddr,
+			RequestID:  jelly.ContextOf(req.Context()).RequestID(),
+			Headers:    map[string][]string{},
+		}
+
+		resp.Route = jelly.ContextOf(req.Context()).MatchedRoute()
+		if rctx := chi.RouteContext(req.Context()); rctx != nil {
+			for i, k := range rctx.URLParams.Keys {
+				if resp.URLParams == nil {
+					resp.URLParams = map[string]string{}
+				}
+				resp.URLParams[k] = rctx.URLParams.Values[i]
+			}
+		}
+
+		if tenant, ok := jelly.ContextOf(req.Context()).Tenant(); ok {
+			resp.Tenant = tenant
+		}
+
+		for name, vals := range req.Header {
+			if api.redact[name] {
+				resp.Headers[name] = []string{jelly.RedactedValue}
+			} else {
+				resp.Headers[name] = vals
+			}
+		}
+
+		if api.maxBody > 0 {
+			body, err := io.ReadAll(io.LimitReader(req.Body, int64(api.maxBody)+1))
+			if err != nil {
+				return em.BadRequest("could not read request body", "read body: %v", err)
+			}
+			if len(body) > api.maxBody {
+				body = body[:api.maxBody]
+				resp.BodyTruncated = true
+			}
+			redacted, ok := jelly.RedactBody(body, req.Header.Get("Content-Type"))
+			if !ok {
+				// it cannot be redacted, so it must not be shown
+				resp.Body = "(JSON that could not be parsed for redaction)"
+			} else if utf8.Valid(redacted) {
+				resp.Body = string(redacted)
+			} else {
+				resp.Body = "(binary data)"
+			}
+		}
+
+		userStr := "unauthed client"
+		if user, loggedIn := em.GetLoggedInUser(req); loggedIn {
+			resp.User = &echoUser{
+				ID:             user.ID.String(),
+				Username:       user.Username,
+				Role:           user.Role.String(),
+				TenantID:       user.TenantID,
+				ServiceAccount: user.ServiceAccount,
+				Guest:          user.Guest,
+				Scopes:         user.Scopes,
+			}
+			userStr = "user '" + user.Username + "'"
+		}
+
+		return em.OK(resp, "%s requested debug echo of %s %s", userStr, req.Method, resp.URI)
+	})
+}
@@ -0,0 +1,137 @@
+package debug
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+)
+
+const (
+	ConfigKeyMaxBody       = "max_body"
+	ConfigKeyRedactHeaders = "redact_headers"
+)
+
+type Config struct {
+	CommonConf jelly.CommonConfig
+
+	// MaxBody is the maximum number of bytes of a request body that is echoed
+	// back. Anything beyond it is truncated. The values of sensitive fields in
+	// JSON and form bodies are redacted; see jelly.RegisterSensitive. If not
+	// set it will default to 65536 (64KiB). Set this to any negative number to
+	// not echo bodies at all.
+	MaxBody int
+
+	// RedactHeaders are the names of request headers whose values are not
+	// echoed back. If not set it will default to Authorization and Cookie.
+	// Set this to an empty list to echo every header.
+	RedactHeaders []string
+}
+
+// FillDefaults returns a new *Config identical to cfg but with unset values set
+// to their defaults and values normalized.
+func (cfg *Config) FillDefaults() jelly.APIConfig {
+	newCFG := new(Config)
+	*newCFG = *cfg
+
+	if newCFG.CommonConf.Enabled && newCFG.CommonConf.Base == "" {
+		newCFG.Set(jelly.ConfigKeyAPIBase, "/debug")
+	}
+
+	newCFG.CommonConf = newCFG.CommonConf.FillDefaults().Common()
+
+	if newCFG.MaxBody == 0 {
+		newCFG.MaxBody = 64 * 1024
+	}
+	if newCFG.RedactHeaders == nil {
+		newCFG.RedactHeaders = []string{"Authorization", "Cookie"}
+	} else {
+		newCFG.RedactHeaders = make([]string, len(cfg.RedactHeaders))
+		for i := range cfg.RedactHeaders {
+			newCFG.RedactHeaders[i] = http.CanonicalHeaderKey(strings.TrimSpace(cfg.RedactHeaders[i]))
+		}
+	}
+
+	return newCFG
+}
+
+// Validate returns an error if the Config has invalid field values set. Empty
+// and unset values are considered invalid; if defaults are intended to be used,
+// call Validate on the return value of FillDefaults.
+func (cfg *Config) Validate() error {
+	if err := cfg.CommonConf.Validate(); err != nil {
+		return err
+	}
+
+	for i := range cfg.RedactHeaders {
+		if strings.TrimSpace(cfg.RedactHeaders[i]) == "" {
+			return fmt.Errorf(ConfigKeyRedactHeaders+": item #%d: must not be empty", i+1)
+		}
+	}
+
+	return nil
+}
+
+func (cfg *Config) Common() jelly.CommonConfig {
+	return cfg.CommonConf
+}
+
+func (cfg *Config) Keys() []string {
+	keys := cfg.CommonConf.Keys()
+	keys = append(keys, ConfigKeyMaxBody, ConfigKeyRedactHeaders)
+	return keys
+}
+
+func (cfg *Config) Get(key string) interface{} {
+	switch strings.ToLower(key) {
+	case ConfigKeyMaxBody:
+		return cfg.MaxBody
+	case ConfigKeyRedactHeaders:
+		return cfg.RedactHeaders
+	default:
+		return cfg.CommonConf.Get(key)
+	}
+}
+
+func (cfg *Config) Set(key string, value interface{}) error {
+	switch strings.ToLower(key) {
+	case ConfigKeyMaxBody:
+		if valueInt, ok := value.(int); ok {
+			cfg.MaxBody = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyMaxBody+"' requires an int but got a %T", value)
+		}
+	case ConfigKeyRedactHeaders:
+		valueSlice, err := jelly.TypedSlice[string](ConfigKeyRedactHeaders, value)
+		if err == nil {
+			cfg.RedactHeaders = valueSlice
+		}
+		return err
+	default:
+		return cfg.CommonConf.Set(key, value)
+	}
+}
+
+func (cfg *Config) SetFromString(key string, value string) error {
+	switch strings.ToLower(key) {
+	case ConfigKeyMaxBody:
+		if value == "" {
+			return cfg.Set(key, 0)
+		}
+		iVal, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		return cfg.Set(key, iVal)
+	case ConfigKeyRedactHeaders:
+		if value == "" {
+			return cfg.Set(key, []string{})
+		}
+		return cfg.Set(key, strings.Split(value, ","))
+	default:
+		return cfg.CommonConf.SetFromString(key, value)
+	}
+}
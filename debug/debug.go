@@ -0,0 +1,46 @@
+// Package debug provides an API that echoes back the details of every request
+// made to it. It supplies the "jellydebug" component.
+//
+// To use the jellydebug component, add a "jellydebug" section to your config
+// and call jelly.Use(debug.Component) before loading config. Every request to
+// the API's base or any path below it gets a JSON response giving the request's
+// method, headers, body, the user it is logged in as (if any), and the route
+// that matched it. This makes it useful for smoke tests of a deployment and for
+// verifying what middleware does to requests, such as the headers that a proxy
+// adds or the tenant that is resolved.
+//
+// The responses of jellydebug may reveal information about the deployment, so
+// it should not be enabled on servers open to untrusted clients.
+package debug
+
+import (
+	"github.com/dekarrin/jelly"
+)
+
+const (
+	Version = "0.0.1"
+)
+
+type ComponentInfo struct{}
+
+func (ci ComponentInfo) Name() string {
+	return "jellydebug"
+}
+
+func (ci ComponentInfo) Version() string {
+	return Version
+}
+
+func (ci ComponentInfo) API() jelly.API {
+	return &debugAPI{}
+}
+
+func (ci ComponentInfo) Config() jelly.APIConfig {
+	return &Config{}
+}
+
+var (
+	// Component holds the component information for jellydebug. This is passed
+	// to jelly.Use to enable the use of jellydebug in a server.
+	Component jelly.Component = ComponentInfo{}
+)
@@ -0,0 +1,160 @@
+package jelly
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// APIDefaults are values of the config of every API that are given once in
+// the top-level config instead of in the section of each API. Config.FillDefaults
+// gives each API the values it does not set itself; a value that an API sets
+// in its own section replaces the default entirely.
+type APIDefaults struct {
+	// CORS is the CORS config of APIs that do not set their own. It is applied
+	// only to the routes of each API, after the "cors" middleware in
+	// Globals.Middleware. By default, no cross-origin requests are allowed.
+	CORS CORSConfig
+
+	// RateLimit is the rate limit of APIs that do not set their own. Each API
+	// counts the requests made to it separately from other APIs and from the
+	// "ratelimit" middleware in Globals.Middleware. By default, there is no
+	// limit.
+	RateLimit RateLimitConfig
+
+	// TimeoutMillis is the timeout of APIs that do not set their own. See
+	// CommonConfig.TimeoutMillis. By default, there is no timeout.
+	TimeoutMillis int
+
+	// SecurityHeaders are the security headers of APIs that do not set their
+	// own. By default, none are set.
+	SecurityHeaders SecurityHeadersConfig
+}
+
+// FillDefaults returns a new APIDefaults identical to ad but with unset values
+// set to their defaults. Nothing is defaulted, as the defaults are filled in
+// each API that inherits them.
+func (ad APIDefaults) FillDefaults() APIDefaults {
+	return ad
+}
+
+// Validate returns an error if the APIDefaults are not valid.
+func (ad APIDefaults) Validate() error {
+	if err := ad.CORS.Validate(); err != nil {
+		return fmt.Errorf(ConfigKeyAPICORS+": %w", err)
+	}
+	if err := ad.RateLimit.Validate(); err != nil {
+		return fmt.Errorf(ConfigKeyAPIRateLimit+": %w", err)
+	}
+	if ad.TimeoutMillis < 0 {
+		return fmt.Errorf(ConfigKeyAPITimeout + ": must not be negative")
+	}
+	if err := ad.SecurityHeaders.Validate(); err != nil {
+		return fmt.Errorf(ConfigKeyAPISecurityHeaders+": %w", err)
+	}
+	return nil
+}
+
+// inherit sets each of the keys of api that are not set to the value in ad.
+// Keys that api does not have are skipped.
+func (ad APIDefaults) inherit(api APIConfig) error {
+	if apiHas(api, ConfigKeyAPICORS) && api.Get(ConfigKeyAPICORS) == (*CORSConfig)(nil) {
+		cors := ad.CORS
+		cors.AllowedOrigins = append([]string(nil), ad.CORS.AllowedOrigins...)
+		cors.AllowedMethods = append([]string(nil), ad.CORS.AllowedMethods...)
+		cors.AllowedHeaders = append([]string(nil), ad.CORS.AllowedHeaders...)
+		if err := api.Set(ConfigKeyAPICORS, &cors); err != nil {
+			return err
+		}
+	}
+	if apiHas(api, ConfigKeyAPIRateLimit) && api.Get(ConfigKeyAPIRateLimit) == (*RateLimitConfig)(nil) {
+		rateLimit := ad.RateLimit
+		if err := api.Set(ConfigKeyAPIRateLimit, &rateLimit); err != nil {
+			return err
+		}
+	}
+	if apiHas(api, ConfigKeyAPITimeout) && api.Get(ConfigKeyAPITimeout) == 0 {
+		if err := api.Set(ConfigKeyAPITimeout, ad.TimeoutMillis); err != nil {
+			return err
+		}
+	}
+	if apiHas(api, ConfigKeyAPISecurityHeaders) && api.Get(ConfigKeyAPISecurityHeaders) == (*SecurityHeadersConfig)(nil) {
+		headers := ad.SecurityHeaders
+		if err := api.Set(ConfigKeyAPISecurityHeaders, &headers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SecurityHeadersConfig is the configuration of the security headers that are
+// set on every response of an API.
+type SecurityHeadersConfig struct {
+	// NoSniff is whether to set "X-Content-Type-Options: nosniff", which stops
+	// browsers from guessing the type of responses.
+	NoSniff bool
+
+	// FrameOptions is the value of the X-Frame-Options header, which must be
+	// "DENY" or "SAMEORIGIN". If empty, the header is not set.
+	FrameOptions string
+
+	// ReferrerPolicy is the value of the Referrer-Policy header, such as
+	// "no-referrer". If empty, the header is not set.
+	ReferrerPolicy string
+
+	// ContentSecurityPolicy is the value of the Content-Security-Policy header.
+	// If empty, the header is not set.
+	ContentSecurityPolicy string
+
+	// HSTSMaxAgeSecs is the max-age, in seconds, of the Strict-Transport-Security
+	// header, which browsers only honor on responses given over HTTPS. If 0,
+	// the header is not set.
+	HSTSMaxAgeSecs int
+}
+
+// FillDefaults returns a new SecurityHeadersConfig identical to sc but with
+// unset values set to their defaults and values normalized.
+func (sc SecurityHeadersConfig) FillDefaults() SecurityHeadersConfig {
+	newSC := sc
+
+	newSC.FrameOptions = strings.ToUpper(newSC.FrameOptions)
+
+	return newSC
+}
+
+// Validate returns an error if the SecurityHeadersConfig is not valid.
+func (sc SecurityHeadersConfig) Validate() error {
+	switch strings.ToUpper(sc.FrameOptions) {
+	case "", "DENY", "SAMEORIGIN":
+	default:
+		return fmt.Errorf("frame_options: must be one of \"DENY\" or \"SAMEORIGIN\"")
+	}
+	if sc.HSTSMaxAgeSecs < 0 {
+		return fmt.Errorf("hsts_max_age: must not be negative")
+	}
+	return nil
+}
+
+// Headers returns the headers that are set on each response, keyed by their
+// canonical names. It is empty if no security headers are configured.
+func (sc SecurityHeadersConfig) Headers() map[string]string {
+	sc = sc.FillDefaults()
+
+	headers := map[string]string{}
+	if sc.NoSniff {
+		headers["X-Content-Type-Options"] = "nosniff"
+	}
+	if sc.FrameOptions != "" {
+		headers["X-Frame-Options"] = sc.FrameOptions
+	}
+	if sc.ReferrerPolicy != "" {
+		headers["Referrer-Policy"] = sc.ReferrerPolicy
+	}
+	if sc.ContentSecurityPolicy != "" {
+		headers["Content-Security-Policy"] = sc.ContentSecurityPolicy
+	}
+	if sc.HSTSMaxAgeSecs > 0 {
+		headers["Strict-Transport-Security"] = "max-age=" + strconv.Itoa(sc.HSTSMaxAgeSecs)
+	}
+	return headers
+}
@@ -0,0 +1,65 @@
+// Package devtools generates large amounts of realistic synthetic data and
+// inserts it directly into stores, for benchmarking queries and pagination
+// against stores of a realistic size without writing a script to fill them
+// each time:
+//
+//	hits := &owdb.Store{}
+//	err := devtools.InsertHits(hits, devtools.HitOptions{Count: 1000000})
+//
+// Generation is deterministic; the same options always give the same data, so
+// benchmarks that use it can be compared between runs. Give a different Seed to
+// get different data.
+//
+// The data is not real and must not be used in a production store.
+package devtools
+
+import (
+	"math/rand"
+	"time"
+)
+
+// defaultPeriod is how far back from the end of the time range that generated
+// data starts if the start is not given.
+const defaultPeriod = 30 * 24 * time.Hour
+
+// newRand returns the source of randomness for generating data with the given
+// seed.
+func newRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
+
+// timeRange returns the time range given by start and end with their defaults
+// applied. If end is the zero time, it is the current time, and if start is the
+// zero time, it is defaultPeriod before end.
+func timeRange(start, end time.Time) (time.Time, time.Time) {
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if start.IsZero() {
+		start = end.Add(-defaultPeriod)
+	}
+	return start, end
+}
+
+// weighted is a choice that is picked with a probability proportional to its
+// weight.
+type weighted[E any] struct {
+	value  E
+	weight int
+}
+
+// pick returns the value of one of choices, picked at random by weight.
+func pick[E any](r *rand.Rand, choices []weighted[E]) E {
+	var total int
+	for i := range choices {
+		total += choices[i].weight
+	}
+	n := r.Intn(total)
+	for i := range choices {
+		if n < choices[i].weight {
+			return choices[i].value
+		}
+		n -= choices[i].weight
+	}
+	return choices[len(choices)-1].value
+}
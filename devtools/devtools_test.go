@@ -0,0 +1,81 @@
+package devtools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/db/owdb"
+	"github.com/dekarrin/jelly/jellytest/fakestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Hits(t *testing.T) {
+	start := time.Date(2023, time.April, 13, 0, 0, 0, 0, time.UTC)
+	end := start.Add(7 * 24 * time.Hour)
+
+	testCases := []struct {
+		name string
+		opts HitOptions
+	}{
+		{name: "defaults", opts: HitOptions{Count: 500, Start: start, End: end}},
+		{name: "one resource and client", opts: HitOptions{Count: 50, Start: start, End: end, Resources: []string{"/"}, Clients: 1}},
+		{name: "several hosts", opts: HitOptions{Count: 200, Start: start, End: end, Hosts: []string{"a.example", "b.example"}, Seed: 413}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			hits := Hits(tc.opts)
+
+			assert.Len(hits, tc.opts.Count)
+			assert.Equal(hits, Hits(tc.opts), "generation is not deterministic")
+			for i, h := range hits {
+				assert.False(h.Time.Before(start) || !h.Time.Before(end), "hit %d time %s out of range", i, h.Time)
+				if i > 0 {
+					assert.False(h.Time.Before(hits[i-1].Time), "hit %d out of order", i)
+				}
+				assert.NotEmpty(h.Resource)
+				assert.NotEmpty(h.Host)
+				assert.NotNil(h.Client.Address)
+			}
+		})
+	}
+}
+
+func Test_InsertHits(t *testing.T) {
+	assert := assert.New(t)
+	s := &owdb.Store{}
+
+	require.NoError(t, InsertHits(s, HitOptions{Count: 1000}))
+
+	all, err := s.Select(nil)
+	assert.NoError(err)
+	assert.Len(all, 1000)
+}
+
+func Test_InsertUsers(t *testing.T) {
+	assert := assert.New(t)
+	repo := fakestore.AuthUsers()
+
+	created, err := InsertUsers(context.Background(), repo, UserOptions{Count: 120, Tenants: []string{"alpha", "beta"}})
+	require.NoError(t, err)
+	assert.Len(created, 120)
+
+	all, err := repo.GetAll(context.Background())
+	assert.NoError(err)
+	assert.Len(all, 120)
+
+	names := map[string]bool{}
+	tenants := map[string]int{}
+	for _, u := range all {
+		assert.False(names[u.Username], "duplicate username %q", u.Username)
+		names[u.Username] = true
+		tenants[u.TenantID]++
+		assert.Contains([]jelly.Role{jelly.Normal, jelly.Unverified, jelly.Admin}, u.Role)
+	}
+	assert.Equal(map[string]int{"alpha": 60, "beta": 60}, tenants)
+}
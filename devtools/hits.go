@@ -0,0 +1,208 @@
+package devtools
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/dekarrin/jelly/db/owdb"
+)
+
+// HitOptions are the options for generating Hits. The zero value generates no
+// Hits; all other fields have defaults.
+type HitOptions struct {
+	// Count is the number of Hits to generate.
+	Count int
+
+	// Start and End give the range of times that Hits are recorded in. Hits
+	// are more likely to be in the daytime than at night, by UTC. If End is
+	// not set, it is the current time; if Start is not set, it is 30 days
+	// before End.
+	Start, End time.Time
+
+	// Hosts are the hosts that Hits are made to, each equally likely. If
+	// empty, all Hits are to "example.com".
+	Hosts []string
+
+	// Resources are the resources that Hits are made to. Those earlier in the
+	// list are hit more often than later ones, as the pages of a real site
+	// are. If empty, 200 paths of a typical blog are used.
+	Resources []string
+
+	// Clients is the number of distinct clients that Hits come from. As with
+	// Resources, some clients make many more Hits than others. If not set, it
+	// is one tenth of Count.
+	Clients int
+
+	// Seed is the seed of the random generation of the Hits.
+	Seed int64
+}
+
+// Hits returns Hits generated as given by opts, in order of their Time.
+func Hits(opts HitOptions) []owdb.Hit {
+	if opts.Count < 1 {
+		return nil
+	}
+	r := newRand(opts.Seed)
+	start, end := timeRange(opts.Start, opts.End)
+
+	hosts := opts.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{"example.com"}
+	}
+	resources := opts.Resources
+	if len(resources) == 0 {
+		resources = blogResources(200)
+	}
+	numClients := opts.Clients
+	if numClients < 1 {
+		numClients = opts.Count/10 + 1
+	}
+	clients := make([]owdb.Requester, numClients)
+	for i := range clients {
+		clients[i] = randomRequester(r)
+	}
+
+	resourceDist := rand.NewZipf(r, 1.2, 1, uint64(len(resources)-1))
+	clientDist := rand.NewZipf(r, 1.1, 1, uint64(numClients-1))
+
+	hits := make([]owdb.Hit, opts.Count)
+	for i := range hits {
+		host := hosts[r.Intn(len(hosts))]
+		hit := owdb.Hit{
+			Time:       randomTime(r, start, end),
+			Host:       host,
+			Resource:   resources[resourceDist.Uint64()],
+			Client:     clients[clientDist.Uint64()],
+			UserAgent:  pick(r, userAgents),
+			Method:     pick(r, methods),
+			StatusCode: pick(r, statuses),
+		}
+		if r.Intn(10) < 4 {
+			// a link from elsewhere on the site or from a search engine
+			if r.Intn(2) == 0 {
+				hit.Referrer = "https://" + host + resources[resourceDist.Uint64()]
+			} else {
+				hit.Referrer = pick(r, referrers)
+			}
+		}
+		hits[i] = hit
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Time.Before(hits[j].Time)
+	})
+	return hits
+}
+
+// InsertHits generates Hits as given by opts and inserts them into s. They are
+// inserted in order of time, so inserting them does not slow down as s grows
+// as long as s holds no Hits that are later than opts.Start.
+func InsertHits(s *owdb.Store, opts HitOptions) error {
+	for i, h := range Hits(opts) {
+		if err := s.Insert(h); err != nil {
+			return fmt.Errorf("insert hit %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// hourWeights is how likely a Hit is to be made in each hour of the day
+// relative to the others, peaking in the afternoon.
+var hourWeights = [24]int{3, 2, 2, 1, 1, 2, 3, 5, 7, 8, 9, 10, 10, 10, 10, 9, 9, 8, 8, 7, 6, 5, 4, 3}
+
+// randomTime returns a time in [start, end) that is more likely to be in the
+// busy hours of hourWeights.
+func randomTime(r *rand.Rand, start, end time.Time) time.Time {
+	span := end.Sub(start)
+	if span <= 0 {
+		return start
+	}
+	for {
+		t := start.Add(time.Duration(r.Int63n(int64(span))))
+		if r.Intn(10) < hourWeights[t.UTC().Hour()] {
+			return t
+		}
+	}
+}
+
+// blogResources returns n paths of a typical blog, with the most-visited
+// first.
+func blogResources(n int) []string {
+	paths := []string{"/", "/blog", "/about", "/feed.xml", "/favicon.ico", "/contact", "/search"}
+	for i := 1; len(paths) < n; i++ {
+		paths = append(paths, fmt.Sprintf("/blog/posts/%d", i))
+	}
+	return paths[:n]
+}
+
+type location struct {
+	country string
+	city    string
+}
+
+var locations = []weighted[location]{
+	{location{"United States", "New York"}, 12},
+	{location{"United States", "Seattle"}, 6},
+	{location{"Canada", "Toronto"}, 4},
+	{location{"United Kingdom", "London"}, 6},
+	{location{"Germany", "Berlin"}, 5},
+	{location{"France", "Paris"}, 4},
+	{location{"Brazil", "São Paulo"}, 3},
+	{location{"India", "Bengaluru"}, 5},
+	{location{"Japan", "Tokyo"}, 4},
+	{location{"Australia", "Sydney"}, 2},
+	{location{"", ""}, 3},
+}
+
+// randomRequester returns a client with a random public address, one in ten
+// of which are IPv6.
+func randomRequester(r *rand.Rand) owdb.Requester {
+	var addr net.IP
+	if r.Intn(10) == 0 {
+		addr = make(net.IP, net.IPv6len)
+		r.Read(addr)
+		addr[0], addr[1] = 0x20, 0x01 // global unicast
+	} else {
+		for addr == nil || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+			addr = net.IPv4(byte(1+r.Intn(223)), byte(r.Intn(256)), byte(r.Intn(256)), byte(1+r.Intn(254))).To4()
+		}
+	}
+
+	loc := pick(r, locations)
+	return owdb.Requester{Address: addr, Country: loc.country, City: loc.city}
+}
+
+var userAgents = []weighted[string]{
+	{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", 40},
+	{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15", 15},
+	{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1", 15},
+	{"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", 12},
+	{"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", 8},
+	{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", 7},
+	{"curl/8.4.0", 2},
+	{"", 1},
+}
+
+var referrers = []weighted[string]{
+	{"https://www.google.com/", 10},
+	{"https://duckduckgo.com/", 2},
+	{"https://www.bing.com/", 2},
+	{"https://news.ycombinator.com/", 1},
+}
+
+var methods = []weighted[string]{
+	{"GET", 95},
+	{"HEAD", 3},
+	{"POST", 2},
+}
+
+var statuses = []weighted[int]{
+	{200, 85},
+	{304, 7},
+	{404, 5},
+	{301, 2},
+	{500, 1},
+}
@@ -0,0 +1,146 @@
+package devtools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultPassword is the password of generated users if UserOptions.Password
+// is not set.
+const DefaultPassword = "password"
+
+// batchSize is the number of users that are created in each call to CreateMany
+// by InsertUsers.
+const batchSize = 500
+
+// UserOptions are the options for generating AuthUsers. The zero value
+// generates no users; all other fields have defaults.
+type UserOptions struct {
+	// Count is the number of users to generate.
+	Count int
+
+	// Password is the password of every generated user. It is hashed once,
+	// with the lowest bcrypt cost, and the hash is used for all of them so
+	// that generating many users is fast. If not set, DefaultPassword is
+	// used.
+	Password string
+
+	// Start and End give the range of times that users are created in. Each
+	// user was last modified and last logged in at some time after they were
+	// created and before End. If End is not set, it is the current time; if
+	// Start is not set, it is 30 days before End.
+	Start, End time.Time
+
+	// Tenants are the IDs of the tenants that users are spread across evenly.
+	// If empty, users do not belong to a tenant.
+	Tenants []string
+
+	// Seed is the seed of the random generation of the users.
+	Seed int64
+}
+
+// Users returns users generated as given by opts. Most are normal users; about
+// one in ten is unverified and one in a hundred is an admin. Every user has a
+// distinct ID, username, and email. An error is returned only if the password
+// cannot be hashed.
+func Users(opts UserOptions) ([]jelly.AuthUser, error) {
+	if opts.Count < 1 {
+		return nil, nil
+	}
+	r := newRand(opts.Seed)
+	start, end := timeRange(opts.Start, opts.End)
+
+	password := opts.Password
+	if password == "" {
+		password = DefaultPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return nil, fmt.Errorf("hash password: %w", err)
+	}
+
+	users := make([]jelly.AuthUser, opts.Count)
+	for i := range users {
+		id, err := uuid.NewRandomFromReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("generate ID: %w", err)
+		}
+		username := fmt.Sprintf("%s%s%d", adjectives[r.Intn(len(adjectives))], nouns[r.Intn(len(nouns))], i+1)
+		created := randomTime(r, start, end)
+
+		user := jelly.AuthUser{
+			ID:         id,
+			Username:   username,
+			Password:   string(hash),
+			Email:      username + "@example.com",
+			Role:       pick(r, roles),
+			Created:    created,
+			Modified:   randomTime(r, created, end),
+			LastLogin:  randomTime(r, created, end),
+			LastLogout: created,
+			Version:    1,
+		}
+		if len(opts.Tenants) > 0 {
+			user.TenantID = opts.Tenants[i%len(opts.Tenants)]
+		}
+		users[i] = user
+	}
+	return users, nil
+}
+
+// InsertUsers generates users as given by opts and creates them in repo. If
+// repo is a jelly.BatchAuthUserRepo, they are created in batches. The users
+// are returned as they were created in repo, which may have given them
+// different IDs and times than were generated.
+func InsertUsers(ctx context.Context, repo jelly.AuthUserRepo, opts UserOptions) ([]jelly.AuthUser, error) {
+	users, err := Users(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	created := make([]jelly.AuthUser, 0, len(users))
+	if batchRepo, ok := repo.(jelly.BatchAuthUserRepo); ok {
+		for i := 0; i < len(users); i += batchSize {
+			batch := users[i:]
+			if len(batch) > batchSize {
+				batch = batch[:batchSize]
+			}
+			results, err := batchRepo.CreateMany(ctx, batch)
+			if err != nil {
+				return created, fmt.Errorf("create users %d-%d: %w", i, i+len(batch)-1, err)
+			}
+			created = append(created, results...)
+		}
+		return created, nil
+	}
+
+	for i := range users {
+		u, err := repo.Create(ctx, users[i])
+		if err != nil {
+			return created, fmt.Errorf("create user %q: %w", users[i].Username, err)
+		}
+		created = append(created, u)
+	}
+	return created, nil
+}
+
+var roles = []weighted[jelly.Role]{
+	{jelly.Normal, 89},
+	{jelly.Unverified, 10},
+	{jelly.Admin, 1},
+}
+
+var adjectives = []string{
+	"amber", "brave", "calm", "clever", "crimson", "eager", "gentle", "golden",
+	"jade", "lucky", "mellow", "quiet", "rapid", "silver", "sunny", "witty",
+}
+
+var nouns = []string{
+	"badger", "comet", "falcon", "fern", "harbor", "lantern", "maple", "otter",
+	"pebble", "quill", "river", "sparrow", "thistle", "willow", "wren", "zephyr",
+}
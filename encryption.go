@@ -0,0 +1,326 @@
+package jelly
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// EncryptTag is the option of the jelly struct tag that marks a string field of
+// a model as encrypted at rest, as in `jelly:"sensitive,encrypt"`. Stores
+// encrypt the fields tagged with it with FieldCipher.EncryptFields before they
+// are persisted and decrypt them with FieldCipher.DecryptFields when read.
+const EncryptTag = "encrypt"
+
+// encryptedPrefix begins every value encrypted by a FieldCipher. It is followed
+// by the ID of the key, a colon, and the base64 of the nonce and ciphertext.
+const encryptedPrefix = "jelly:enc:"
+
+// EncryptionConfig is the configuration of the keys that fields of models are
+// encrypted with at rest. It is used to create the FieldCipher that is given
+// to every DB whose store implements FieldCipherStore and that APIs get from
+// Bundle.FieldCipher.
+type EncryptionConfig struct {
+	// Keys are the keys that values are encrypted with. The first key is used
+	// to encrypt new values, and every key is used to decrypt values that were
+	// encrypted with it. To rotate keys, add the new key to the front of the
+	// list and keep the old ones until every value encrypted with them has
+	// been written again. If there are no keys, fields are not encrypted.
+	Keys []EncryptionKeyConfig
+}
+
+// EncryptionKeyConfig is a single key in an EncryptionConfig.
+type EncryptionKeyConfig struct {
+	// ID is the unique ID of the key, which is stored with every value that
+	// is encrypted with it. It must not contain a colon.
+	ID string
+
+	// Secret is the base64 encoding of the 16, 24, or 32 bytes of the AES key.
+	// Exactly one of Secret and SecretFile must be set.
+	Secret string
+
+	// SecretFile is the path to a file that contains the base64 encoding of
+	// the AES key, such as one mounted from a secret manager.
+	SecretFile string
+}
+
+// FillDefaults returns a new EncryptionConfig identical to ec but with unset
+// values set to their defaults. Nothing is defaulted.
+func (ec EncryptionConfig) FillDefaults() EncryptionConfig {
+	return ec
+}
+
+// Validate returns an error if the EncryptionConfig is not valid. Keys that
+// are given in files are not read.
+func (ec EncryptionConfig) Validate() error {
+	seen := map[string]bool{}
+	for i, k := range ec.Keys {
+		if k.ID == "" {
+			return fmt.Errorf("keys[%d]: id: must not be empty", i)
+		}
+		if strings.Contains(k.ID, ":") {
+			return fmt.Errorf("keys[%d]: id: must not contain ':'", i)
+		}
+		if seen[k.ID] {
+			return fmt.Errorf("keys[%d]: id: %q is given more than once", i, k.ID)
+		}
+		seen[k.ID] = true
+
+		if (k.Secret == "") == (k.SecretFile == "") {
+			return fmt.Errorf("keys[%d]: exactly one of secret and secret_file must be set", i)
+		}
+		if k.Secret != "" {
+			if _, err := decodeEncryptionKey(k.Secret); err != nil {
+				return fmt.Errorf("keys[%d]: secret: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Cipher returns the FieldCipher of the configured keys, reading any that are
+// given in files. It returns nil if there are no keys.
+func (ec EncryptionConfig) Cipher() (*FieldCipher, error) {
+	if len(ec.Keys) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]EncryptionKey, len(ec.Keys))
+	for i, k := range ec.Keys {
+		secret := k.Secret
+		if k.SecretFile != "" {
+			data, err := os.ReadFile(k.SecretFile)
+			if err != nil {
+				return nil, fmt.Errorf("keys[%d]: secret_file: %w", i, err)
+			}
+			secret = strings.TrimSpace(string(data))
+		}
+		key, err := decodeEncryptionKey(secret)
+		if err != nil {
+			return nil, fmt.Errorf("keys[%d]: %w", i, err)
+		}
+		keys[i] = EncryptionKey{ID: k.ID, Key: key}
+	}
+	return NewFieldCipher(keys...)
+}
+
+// decodeEncryptionKey decodes the base64 of an AES key and checks that it is a
+// valid size.
+func decodeEncryptionKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("not valid base64: %w", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("must be 16, 24, or 32 bytes but is %d", len(key))
+	}
+}
+
+// EncryptionKey is an AES key that a FieldCipher encrypts values with.
+type EncryptionKey struct {
+	// ID is the unique ID of the key. It must not contain a colon.
+	ID string
+
+	// Key is the 16, 24, or 32 bytes of the AES key.
+	Key []byte
+}
+
+// FieldCipherStore is a Store whose repos encrypt fields of their models with
+// a FieldCipher that is given to it. The server gives every connected
+// FieldCipherStore the FieldCipher of the keys in Globals.Encryption, if any
+// are configured.
+type FieldCipherStore interface {
+	Store
+
+	// UseFieldCipher sets the FieldCipher that the Store encrypts fields with.
+	UseFieldCipher(fc *FieldCipher)
+}
+
+// FieldCipher encrypts and decrypts the values of fields of models with
+// AES-GCM so that sensitive data such as email addresses is protected where it
+// is stored. Each encrypted value records the ID of the key it was encrypted
+// with, so that values encrypted with older keys can still be decrypted after
+// a new key is added. It is safe for concurrent use.
+//
+// A nil *FieldCipher does not encrypt; its methods return values as-is. Repos
+// can call it without checking whether encryption is configured.
+type FieldCipher struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewFieldCipher returns a FieldCipher that encrypts new values with the first
+// of keys and decrypts values that were encrypted with any of them.
+func NewFieldCipher(keys ...EncryptionKey) (*FieldCipher, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one key must be given")
+	}
+
+	fc := &FieldCipher{current: keys[0].ID, aeads: map[string]cipher.AEAD{}}
+	for i, k := range keys {
+		if k.ID == "" || strings.Contains(k.ID, ":") {
+			return nil, fmt.Errorf("keys[%d]: ID must be non-empty and not contain ':'", i)
+		}
+		if _, ok := fc.aeads[k.ID]; ok {
+			return nil, fmt.Errorf("keys[%d]: ID %q is given more than once", i, k.ID)
+		}
+		block, err := aes.NewCipher(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("keys[%d]: %w", i, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("keys[%d]: %w", i, err)
+		}
+		fc.aeads[k.ID] = aead
+	}
+	return fc, nil
+}
+
+// KeyID returns the ID of the key that new values are encrypted with. It is
+// the empty string for a nil FieldCipher.
+func (fc *FieldCipher) KeyID() string {
+	if fc == nil {
+		return ""
+	}
+	return fc.current
+}
+
+// EncryptString encrypts s with the current key. The empty string is not
+// encrypted, so that empty values stay empty in the DB.
+func (fc *FieldCipher) EncryptString(s string) (string, error) {
+	if fc == nil || s == "" {
+		return s, nil
+	}
+
+	aead := fc.aeads[fc.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(s), nil)
+
+	return encryptedPrefix + fc.current + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString decrypts s, which was encrypted by EncryptString with any of
+// the keys of the FieldCipher. Values that are not encrypted, such as those
+// written before encryption was configured, are returned as-is. The returned
+// error matches ErrDBDecodingFailure if s cannot be decrypted.
+func (fc *FieldCipher) DecryptString(s string) (string, error) {
+	if fc == nil || !strings.HasPrefix(s, encryptedPrefix) {
+		return s, nil
+	}
+
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(s, encryptedPrefix), ":")
+	if !ok {
+		return "", NewError("encrypted value is malformed", ErrDBDecodingFailure)
+	}
+	aead, ok := fc.aeads[keyID]
+	if !ok {
+		return "", NewError(fmt.Sprintf("value is encrypted with unknown key %q", keyID), ErrDBDecodingFailure)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", NewError("encrypted value is malformed", ErrDBDecodingFailure)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", NewError("decrypt value", err, ErrDBDecodingFailure)
+	}
+	return string(plain), nil
+}
+
+// NeedsRotation returns whether s should be encrypted again with the current
+// key, because it was encrypted with an older key or is not encrypted at all.
+// It is always false for the empty string and for a nil FieldCipher.
+func (fc *FieldCipher) NeedsRotation(s string) bool {
+	if fc == nil || s == "" {
+		return false
+	}
+	return !strings.HasPrefix(s, encryptedPrefix+fc.current+":")
+}
+
+// Reencrypt decrypts s and encrypts it again with the current key. It is used
+// to rotate the values encrypted with older keys so that those keys can be
+// removed.
+func (fc *FieldCipher) Reencrypt(s string) (string, error) {
+	plain, err := fc.DecryptString(s)
+	if err != nil {
+		return "", err
+	}
+	return fc.EncryptString(plain)
+}
+
+// EncryptFields encrypts in place each string field of the struct that v
+// points to that is tagged with `jelly:"encrypt"`, along with those of any
+// structs that it contains.
+func (fc *FieldCipher) EncryptFields(v interface{}) error {
+	return fc.transformFields(v, fc.EncryptString)
+}
+
+// DecryptFields decrypts in place each string field of the struct that v
+// points to that is tagged with `jelly:"encrypt"`, along with those of any
+// structs that it contains.
+func (fc *FieldCipher) DecryptFields(v interface{}) error {
+	return fc.transformFields(v, fc.DecryptString)
+}
+
+func (fc *FieldCipher) transformFields(v interface{}, fn func(string) (string, error)) error {
+	if fc == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("must be a non-nil pointer to a struct but was a %T", v)
+	}
+	return transformStructFields(rv.Elem(), fn)
+}
+
+func transformStructFields(rv reflect.Value, fn func(string) (string, error)) error {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := rv.Field(i)
+
+		if hasTagOption(sf.Tag.Get("jelly"), EncryptTag) {
+			if fv.Kind() != reflect.String {
+				return fmt.Errorf("%s: only string fields can be encrypted", sf.Name)
+			}
+			out, err := fn(fv.String())
+			if err != nil {
+				return fmt.Errorf("%s: %w", sf.Name, err)
+			}
+			fv.SetString(out)
+			continue
+		}
+
+		if fv.Kind() == reflect.Struct {
+			if err := transformStructFields(fv, fn); err != nil {
+				return fmt.Errorf("%s.%w", sf.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// hasTagOption returns whether the comma-separated tag has the given option.
+func hasTagOption(tag, opt string) bool {
+	for _, o := range strings.Split(tag, ",") {
+		if strings.TrimSpace(o) == opt {
+			return true
+		}
+	}
+	return false
+}
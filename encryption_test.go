@@ -0,0 +1,238 @@
+package jelly
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKey(id string, b byte) EncryptionKey {
+	return EncryptionKey{ID: id, Key: bytes.Repeat([]byte{b}, 32)}
+}
+
+func Test_FieldCipher_EncryptString(t *testing.T) {
+	assert := assert.New(t)
+
+	fc, err := NewFieldCipher(testKey("k1", 1))
+	if !assert.NoError(err) {
+		return
+	}
+
+	enc, err := fc.EncryptString("ada@example.com")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.True(strings.HasPrefix(enc, "jelly:enc:k1:"), "encrypted value %q does not record its key", enc)
+	assert.NotContains(enc, "ada@example.com")
+
+	again, _ := fc.EncryptString("ada@example.com")
+	assert.NotEqual(enc, again, "encrypting twice gave the same value")
+
+	dec, err := fc.DecryptString(enc)
+	assert.NoError(err)
+	assert.Equal("ada@example.com", dec)
+
+	// empty and unencrypted values are given as-is
+	enc, err = fc.EncryptString("")
+	assert.NoError(err)
+	assert.Equal("", enc)
+	dec, err = fc.DecryptString("plain@example.com")
+	assert.NoError(err)
+	assert.Equal("plain@example.com", dec)
+}
+
+func Test_FieldCipher_DecryptString_errors(t *testing.T) {
+	fc, _ := NewFieldCipher(testKey("k1", 1))
+	other, _ := NewFieldCipher(testKey("k1", 2))
+	fromOther, _ := other.EncryptString("ada@example.com")
+
+	testCases := []struct {
+		name      string
+		input     string
+		expectErr string
+	}{
+		{
+			name:      "unknown key",
+			input:     "jelly:enc:k9:AAAA",
+			expectErr: `value is encrypted with unknown key "k9": field could not be decoded from DB storage format to model format`,
+		},
+		{
+			name:      "no key ID",
+			input:     "jelly:enc:AAAA",
+			expectErr: "encrypted value is malformed: field could not be decoded from DB storage format to model format",
+		},
+		{
+			name:      "bad base64",
+			input:     "jelly:enc:k1:!!!",
+			expectErr: "encrypted value is malformed: field could not be decoded from DB storage format to model format",
+		},
+		{
+			name:      "wrong key material",
+			input:     fromOther,
+			expectErr: "decrypt value: cipher: message authentication failed",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, err := fc.DecryptString(tc.input)
+			assert.EqualError(err, tc.expectErr)
+			assert.ErrorIs(err, ErrDBDecodingFailure)
+		})
+	}
+}
+
+func Test_FieldCipher_rotation(t *testing.T) {
+	assert := assert.New(t)
+
+	old, _ := NewFieldCipher(testKey("k1", 1))
+	enc, _ := old.EncryptString("ada@example.com")
+
+	rotated, err := NewFieldCipher(testKey("k2", 2), testKey("k1", 1))
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("k2", rotated.KeyID())
+	assert.True(rotated.NeedsRotation(enc))
+	assert.True(rotated.NeedsRotation("plain@example.com"))
+	assert.False(rotated.NeedsRotation(""))
+
+	dec, err := rotated.DecryptString(enc)
+	assert.NoError(err)
+	assert.Equal("ada@example.com", dec)
+
+	reenc, err := rotated.Reencrypt(enc)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.False(rotated.NeedsRotation(reenc))
+	assert.True(strings.HasPrefix(reenc, "jelly:enc:k2:"))
+
+	_, err = old.DecryptString(reenc)
+	assert.Error(err, "old cipher decrypted value encrypted with new key")
+}
+
+func Test_FieldCipher_nil(t *testing.T) {
+	assert := assert.New(t)
+
+	var fc *FieldCipher
+	enc, err := fc.EncryptString("ada@example.com")
+	assert.NoError(err)
+	assert.Equal("ada@example.com", enc)
+	assert.False(fc.NeedsRotation("ada@example.com"))
+
+	user := AuthUser{Email: "ada@example.com"}
+	assert.NoError(fc.EncryptFields(&user))
+	assert.Equal("ada@example.com", user.Email)
+}
+
+func Test_FieldCipher_EncryptFields(t *testing.T) {
+	type contact struct {
+		Phone string `jelly:"encrypt"`
+		Label string
+	}
+	type person struct {
+		Name    string
+		SSN     string `jelly:"sensitive,encrypt"`
+		Contact contact
+	}
+
+	assert := assert.New(t)
+
+	fc, _ := NewFieldCipher(testKey("k1", 1))
+	p := person{Name: "Ada", SSN: "123-45-6789", Contact: contact{Phone: "555-0100", Label: "home"}}
+
+	if !assert.NoError(fc.EncryptFields(&p)) {
+		return
+	}
+	assert.Equal("Ada", p.Name)
+	assert.Equal("home", p.Contact.Label)
+	assert.True(strings.HasPrefix(p.SSN, "jelly:enc:"))
+	assert.True(strings.HasPrefix(p.Contact.Phone, "jelly:enc:"))
+
+	if !assert.NoError(fc.DecryptFields(&p)) {
+		return
+	}
+	assert.Equal(person{Name: "Ada", SSN: "123-45-6789", Contact: contact{Phone: "555-0100", Label: "home"}}, p)
+
+	assert.Error(fc.EncryptFields(p), "non-pointer was accepted")
+}
+
+func Test_EncryptionConfig(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	secretFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(secretFile, []byte(secret+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name      string
+		cfg       EncryptionConfig
+		expectErr string
+		expectKey string
+	}{
+		{
+			name: "no keys",
+		},
+		{
+			name:      "inline and file keys",
+			cfg:       EncryptionConfig{Keys: []EncryptionKeyConfig{{ID: "new", SecretFile: secretFile}, {ID: "old", Secret: secret}}},
+			expectKey: "new",
+		},
+		{
+			name:      "key too short",
+			cfg:       EncryptionConfig{Keys: []EncryptionKeyConfig{{ID: "k1", Secret: base64.StdEncoding.EncodeToString([]byte("short"))}}},
+			expectErr: "keys[0]: secret: must be 16, 24, or 32 bytes but is 5",
+		},
+		{
+			name:      "both secret and file",
+			cfg:       EncryptionConfig{Keys: []EncryptionKeyConfig{{ID: "k1", Secret: secret, SecretFile: secretFile}}},
+			expectErr: "keys[0]: exactly one of secret and secret_file must be set",
+		},
+		{
+			name:      "duplicate ID",
+			cfg:       EncryptionConfig{Keys: []EncryptionKeyConfig{{ID: "k1", Secret: secret}, {ID: "k1", Secret: secret}}},
+			expectErr: `keys[1]: id: "k1" is given more than once`,
+		},
+		{
+			name:      "ID with colon",
+			cfg:       EncryptionConfig{Keys: []EncryptionKeyConfig{{ID: "k:1", Secret: secret}}},
+			expectErr: "keys[0]: id: must not contain ':'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			err := tc.cfg.Validate()
+			if tc.expectErr != "" {
+				assert.EqualError(err, tc.expectErr)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+
+			fc, err := tc.cfg.Cipher()
+			if !assert.NoError(err) {
+				return
+			}
+			assert.Equal(tc.expectKey, fc.KeyID())
+		})
+	}
+}
+
+func Test_EncryptionConfig_Cipher_missingFile(t *testing.T) {
+	cfg := EncryptionConfig{Keys: []EncryptionKeyConfig{{ID: "k1", SecretFile: filepath.Join(t.TempDir(), "missing")}}}
+	_, err := cfg.Cipher()
+	assert.True(t, errors.Is(err, os.ErrNotExist), "unexpected error: %v", err)
+}
@@ -0,0 +1,82 @@
+package jelly
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Envelope is a convention for the shape of the response bodies of resources
+// that an API returns with ResponseGenerator.Resource.
+type Envelope string
+
+const (
+	// EnvelopeNone gives the resource as it marshals to JSON, with no
+	// envelope.
+	EnvelopeNone Envelope = ""
+
+	// EnvelopeJSONAPI gives each resource as a JSON:API resource object with
+	// the type, id, attributes, and links of the resource, as the primary
+	// data of a JSON:API document. See https://jsonapi.org.
+	EnvelopeJSONAPI Envelope = "jsonapi"
+
+	// EnvelopeHAL gives each resource as a HAL resource with its links in
+	// "_links", and collections of resources in "_embedded" under the type
+	// of the resource. See https://datatracker.ietf.org/doc/html/draft-kelly-json-hal.
+	EnvelopeHAL Envelope = "hal"
+)
+
+// ParseEnvelope parses a string containing the name of an Envelope. The name
+// is not case-sensitive.
+func ParseEnvelope(s string) (Envelope, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return EnvelopeNone, nil
+	case string(EnvelopeJSONAPI):
+		return EnvelopeJSONAPI, nil
+	case string(EnvelopeHAL):
+		return EnvelopeHAL, nil
+	default:
+		return EnvelopeNone, fmt.Errorf("not a valid envelope: %q", s)
+	}
+}
+
+// ContentType returns the media type of response bodies that use the
+// envelope.
+func (e Envelope) ContentType() string {
+	switch e {
+	case EnvelopeJSONAPI:
+		return "application/vnd.api+json"
+	case EnvelopeHAL:
+		return "application/hal+json"
+	default:
+		return "application/json"
+	}
+}
+
+// ModelMeta is metadata on a type of model that is used to build the envelope
+// of resources of that type. It is registered for the Go type of the model
+// with the RegisterModel method of the server's Environment.
+type ModelMeta struct {
+	// Type is the type of the resource given in envelopes, such as "users".
+	// It must be set.
+	Type string
+
+	// ID returns the ID of the given model. The model is always a value of the
+	// type that the ModelMeta is registered for. It must be set.
+	ID func(model interface{}) string
+
+	// Links returns the links of the given model, mapped by their relation
+	// such as "self". It may be nil, in which case resources have no links.
+	Links func(model interface{}) map[string]string
+}
+
+func (mm ModelMeta) Validate() error {
+	if mm.Type == "" {
+		return fmt.Errorf("type: must not be empty")
+	}
+	if mm.ID == nil {
+		return fmt.Errorf("ID: must not be nil")
+	}
+
+	return nil
+}
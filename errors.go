@@ -1,26 +1,43 @@
 package jelly
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
 
 	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 var (
-	ErrBadCredentials = errors.New("the supplied username/password combination is incorrect")
-	ErrPermissions    = errors.New("you don't have permission to do that")
-	ErrNotFound       = errors.New("the requested entity could not be found")
-	ErrAlreadyExists  = errors.New("resource with same identifying information already exists")
-	ErrDB             = errors.New("an error occured with the DB")
-	ErrBadArgument    = errors.New("one or more of the arguments is invalid")
-	ErrBodyUnmarshal  = errors.New("malformed data in request")
+	ErrBadCredentials       = errors.New("the supplied username/password combination is incorrect")
+	ErrPermissions          = errors.New("you don't have permission to do that")
+	ErrNotFound             = errors.New("the requested entity could not be found")
+	ErrAlreadyExists        = errors.New("resource with same identifying information already exists")
+	ErrDB                   = errors.New("an error occured with the DB")
+	ErrBadArgument          = errors.New("one or more of the arguments is invalid")
+	ErrBodyUnmarshal        = errors.New("malformed data in request")
+	ErrConflict             = errors.New("the resource was modified by another request")
+	ErrQuotaExceeded        = errors.New("the quota has been exceeded")
+	ErrRateLimited          = errors.New("too many requests have been made")
+	ErrTimeout              = errors.New("the operation timed out")
+	ErrUnavailable          = errors.New("a required service is unavailable")
+	ErrUnsupportedMediaType = errors.New("the request body is not of a supported media type")
+
+	// ErrValidation is matched by a ValidationError, which gives the fields
+	// that were invalid. It also matches ErrBadArgument.
+	ErrValidation = errors.New("one or more fields are invalid")
 
 	// TODO: merge the two types of errors.
 	ErrDBConstraintViolation = errors.New("a uniqueness constraint was violated")
 	ErrDBNotFound            = errors.New("the requested resource was not found")
 	ErrDBDecodingFailure     = errors.New("field could not be decoded from DB storage format to model format")
+	ErrDBConflict            = errors.New("the entity's version does not match the expected version")
 )
 
 // Error is a typed error returned by certain functions in the TunaScript server
@@ -35,10 +52,19 @@ var (
 // will be its primary message with the result of calling Error() on its first
 // cause appended to it.
 //
+// An Error may also carry a message that is safe to show to clients separately
+// from the one returned by Error.Error(), which can then contain internal
+// details that should only be logged; see NewUserError and UserMessage. It may
+// also carry fields that give context for logging; see Error.WithField.
+//
 // Error should not be used directly; call New to create one.
 type Error struct {
-	msg   string
-	cause []error
+	msg     string
+	userMsg string
+	cause   []error
+
+	// fields is a pointer so that Error stays comparable.
+	fields *map[string]interface{}
 }
 
 // Error returns the message defined for the Error. If a message was defined for
@@ -117,40 +143,105 @@ func (e Error) Is(target error) bool {
 	return false
 }
 
-func convertDBError(err error) error {
-	sqliteErr := &sqlite.Error{}
-	if errors.As(err, &sqliteErr) {
-		primaryCode := sqliteErr.Code() & 0xff
-		if primaryCode == 19 {
-			// preserve the error message for constraints violations
-			return NewError(ErrDBConstraintViolation.Error(), err, ErrDBConstraintViolation)
-		} else if primaryCode == 1 {
-			// 1 is a generic error and thus the string is not descriptive, so
-			// do not use the error code string
-			return err
-		}
+// DBErrorTranslator converts an error returned by the driver of a DB engine
+// into an Error that matches the canonical errors of this package, such as
+// ErrDBConstraintViolation and ErrDBNotFound, so that code checking errors from
+// a Store behaves the same regardless of the engine behind it. It returns
+// false if err did not come from its engine's driver.
+type DBErrorTranslator func(err error) (error, bool)
+
+var (
+	dbErrorTranslatorsMtx sync.RWMutex
+	dbErrorTranslators    = map[DBType]DBErrorTranslator{
+		DatabaseSQLite: translateSQLiteError,
+	}
+)
 
-		return NewError(sqlite.ErrorCodeString[sqliteErr.Code()])
-	} else if errors.Is(err, sql.ErrNoRows) {
-		return ErrDBNotFound
+// RegisterDBErrorTranslator registers t as the DBErrorTranslator for the errors
+// of the given engine. It is typically called by whatever registers the
+// connectors for the engine. Registering a translator for an engine that
+// already has one replaces it.
+func RegisterDBErrorTranslator(engine DBType, t DBErrorTranslator) {
+	dbErrorTranslatorsMtx.Lock()
+	defer dbErrorTranslatorsMtx.Unlock()
+
+	if t == nil {
+		delete(dbErrorTranslators, engine)
+		return
 	}
+	dbErrorTranslators[engine] = t
+}
 
+// TranslateDBError converts err into an Error that matches the canonical errors
+// of this package using the DBErrorTranslator registered for the engine that
+// it came from. sql.ErrNoRows from any engine is converted to an error that
+// matches both ErrDBNotFound and ErrNotFound. If no translator recognizes err,
+// it is returned as-is.
+func TranslateDBError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return NewError(ErrDBNotFound.Error(), ErrDBNotFound, ErrNotFound)
+	}
+
+	dbErrorTranslatorsMtx.RLock()
+	defer dbErrorTranslatorsMtx.RUnlock()
+
+	// check in a set order so that the result does not change between calls
+	// if more than one translator recognizes err.
+	engines := make([]string, 0, len(dbErrorTranslators))
+	for engine := range dbErrorTranslators {
+		engines = append(engines, engine.String())
+	}
+	sort.Strings(engines)
+
+	for _, engine := range engines {
+		if translated, ok := dbErrorTranslators[DBType(engine)](err); ok {
+			return translated
+		}
+	}
 	return err
 }
 
+// translateSQLiteError is the DBErrorTranslator for DatabaseSQLite.
+func translateSQLiteError(err error) (error, bool) {
+	sqliteErr := &sqlite.Error{}
+	if !errors.As(err, &sqliteErr) {
+		return nil, false
+	}
+
+	switch primaryCode := sqliteErr.Code() & 0xff; primaryCode {
+	case sqlite3.SQLITE_CONSTRAINT:
+		// preserve the error message for constraints violations
+		code := sqliteErr.Code()
+		if code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY {
+			return NewError(ErrDBConstraintViolation.Error(), err, ErrDBConstraintViolation, ErrAlreadyExists), true
+		}
+		return NewError(ErrDBConstraintViolation.Error(), err, ErrDBConstraintViolation), true
+	case sqlite3.SQLITE_ERROR:
+		// 1 is a generic error and thus the string is not descriptive, so do
+		// not use the error code string
+		return err, true
+	default:
+		return NewError(sqlite.ErrorCodeString[sqliteErr.Code()]), true
+	}
+}
+
 // WrapDBError creates a new Error that wraps the given error as a cause and
 // automatically adds ErrDB as another cause. A user-set message may be provided
 // if desired with msg, but it may be left as "".
 //
 // The provided error being wrapped will itself be converted to an Error of the
-// approriate jelly type if possible; e.g. SQLite-specific errors indicating
-// that a record could not be found would be converted to an Error that returns
-// true for errors.Is(err, jelly.ErrNotFound).
+// approriate jelly type if possible with TranslateDBError; e.g. SQLite-specific
+// errors indicating that a uniqueness constraint was violated would be
+// converted to an Error that returns true for
+// errors.Is(err, jelly.ErrAlreadyExists).
 //
 // msg, if provided, is used to create the msg of the error by calling
 // fmt.Sprint. For format capability, use WrapDBErrorf.
 func WrapDBError(err error, msg ...any) Error {
-	err = convertDBError(err)
+	err = TranslateDBError(err)
 
 	var errMsg string
 	if len(msg) > 0 {
@@ -168,14 +259,15 @@ func WrapDBError(err error, msg ...any) Error {
 // if desired with format and arguments a.
 //
 // The provided error being wrapped will itself be converted to an Error of the
-// approriate jelly type if possible; e.g. SQLite-specific errors indicating
-// that a record could not be found would be converted to an Error that returns
-// true for errors.Is(err, jelly.ErrNotFound).
+// approriate jelly type if possible with TranslateDBError; e.g. SQLite-specific
+// errors indicating that a uniqueness constraint was violated would be
+// converted to an Error that returns true for
+// errors.Is(err, jelly.ErrAlreadyExists).
 //
 // msg, if provided, is used to create the msg of the error by calling
 // fmt.Sprintf.
 func WrapDBErrorf(err error, format string, a ...any) Error {
-	err = convertDBError(err)
+	err = TranslateDBError(err)
 
 	return Error{
 		msg:   fmt.Sprintf(format, a...),
@@ -195,3 +287,238 @@ func NewError(msg string, causes ...error) Error {
 	}
 	return err
 }
+
+// FieldError is a problem with the value of a single field.
+type FieldError struct {
+	// Field is the name of the field as given by the client, such as its name
+	// in JSON. Fields of nested objects are separated by dots, as in
+	// "address.city".
+	Field string `json:"field"`
+
+	// Message says what is wrong with the value of the field.
+	Message string `json:"message"`
+}
+
+// ValidationError is an error giving the fields of a request or entity that
+// are invalid. It matches both ErrValidation and ErrBadArgument with
+// errors.Is, and ResponseGenerator.FromError responds to it with an HTTP-422
+// that gives each FieldError in the fields member of the body.
+//
+// The zero value is a ValidationError with no problems, which fields can be
+// added to as they are checked:
+//
+//	var verr jelly.ValidationError
+//	if req.Name == "" {
+//		verr.Add("name", "must not be empty")
+//	}
+//	if verr.HasErrors() {
+//		return verr
+//	}
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Add adds a problem with the named field, with the message created from
+// format and a as with fmt.Sprintf.
+func (ve *ValidationError) Add(field, format string, a ...interface{}) {
+	ve.Fields = append(ve.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, a...)})
+}
+
+// HasErrors returns whether any fields have been added to ve.
+func (ve ValidationError) HasErrors() bool {
+	return len(ve.Fields) > 0
+}
+
+// Error returns a message giving every field that is invalid.
+func (ve ValidationError) Error() string {
+	if len(ve.Fields) == 0 {
+		return ErrValidation.Error()
+	}
+
+	msgs := make([]string, len(ve.Fields))
+	for i, fe := range ve.Fields {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is returns whether target is ErrValidation or ErrBadArgument.
+//
+// This function is for interaction with the errors API.
+func (ve ValidationError) Is(target error) bool {
+	return target == ErrValidation || target == ErrBadArgument
+}
+
+// errorStatuses maps errors to the HTTP status that ErrorStatus gives for
+// them. It is checked in order, so errors that also match more general ones
+// must come first.
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{ErrValidation, http.StatusUnprocessableEntity},
+	{ErrBadArgument, http.StatusBadRequest},
+	{ErrBodyUnmarshal, http.StatusBadRequest},
+	{ErrUnsupportedMediaType, http.StatusUnsupportedMediaType},
+	{ErrBadCredentials, http.StatusUnauthorized},
+	{ErrPermissions, http.StatusForbidden},
+	{ErrNotFound, http.StatusNotFound},
+	{ErrDBNotFound, http.StatusNotFound},
+	{ErrAlreadyExists, http.StatusConflict},
+	{ErrDBConstraintViolation, http.StatusConflict},
+	{ErrConflict, http.StatusConflict},
+	{ErrDBConflict, http.StatusConflict},
+	{ErrQuotaExceeded, http.StatusTooManyRequests},
+	{ErrRateLimited, http.StatusTooManyRequests},
+	{ErrUnavailable, http.StatusServiceUnavailable},
+	{ErrBreakerOpen, http.StatusServiceUnavailable},
+	{ErrTimeout, http.StatusGatewayTimeout},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout},
+}
+
+// ErrorStatus returns the HTTP status that a request which failed with err
+// should be responded to with, according to which of the errors in this
+// package err matches:
+//
+//   - ErrValidation gives an HTTP-422.
+//   - ErrBadArgument and ErrBodyUnmarshal give an HTTP-400.
+//   - ErrBadCredentials gives an HTTP-401.
+//   - ErrPermissions gives an HTTP-403.
+//   - ErrNotFound and ErrDBNotFound give an HTTP-404.
+//   - ErrAlreadyExists, ErrDBConstraintViolation, ErrConflict, and
+//     ErrDBConflict give an HTTP-409.
+//   - ErrUnsupportedMediaType gives an HTTP-415.
+//   - ErrQuotaExceeded and ErrRateLimited give an HTTP-429.
+//   - ErrUnavailable and ErrBreakerOpen give an HTTP-503.
+//   - ErrTimeout and context.DeadlineExceeded give an HTTP-504.
+//
+// Any other error gives an HTTP-500. If err is nil, 0 is returned.
+func ErrorStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	for _, es := range errorStatuses {
+		if errors.Is(err, es.err) {
+			return es.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// NewUserError creates a new Error that carries userMsg, a message that is safe
+// to show to clients, separately from internalMsg, the message returned by its
+// Error method, which may contain details that should only be logged. If
+// internalMsg is "", userMsg is used for both. As with NewError, any errors it
+// should wrap may be given as its causes.
+func NewUserError(userMsg, internalMsg string, causes ...error) Error {
+	if internalMsg == "" {
+		internalMsg = userMsg
+	}
+	err := NewError(internalMsg, causes...)
+	err.userMsg = userMsg
+	return err
+}
+
+// WrapUserError creates a new Error that wraps err and carries userMsg as its
+// message that is safe to show to clients. Its Error method returns the same
+// message as err, so the details of err are still logged.
+func WrapUserError(err error, userMsg string) Error {
+	return Error{userMsg: userMsg, cause: []error{err}}
+}
+
+// WithField returns a copy of e with the given field added to it. Fields give
+// context for logging, such as the ID of the entity that the error occurred
+// on, and are never shown to clients. If e already has a field with the same
+// key, it is replaced.
+func (e Error) WithField(key string, value interface{}) Error {
+	fields := map[string]interface{}{}
+	if e.fields != nil {
+		for k, v := range *e.fields {
+			fields[k] = v
+		}
+	}
+	fields[key] = value
+	e.fields = &fields
+	return e
+}
+
+// UserMessage returns the message of err that is safe to show to clients. This
+// is the message given to NewUserError or WrapUserError for the outermost
+// Error in the chain of err that has one. If there is none, the message of err
+// itself is returned, the same as calling err.Error(); errors created without a
+// user message, such as by NewError, are shown to clients as-is.
+//
+// UserMessage is intended to be used as the user message given to the error
+// responses of a ServiceProvider, with err.Error() as the internal message:
+//
+//	return em.BadRequest(jelly.UserMessage(err), err.Error())
+func UserMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var userMsg string
+	walkErrors(err, func(e error) bool {
+		if jErr, ok := e.(Error); ok && jErr.userMsg != "" {
+			userMsg = jErr.userMsg
+			return false
+		}
+		return true
+	})
+
+	if userMsg == "" {
+		return err.Error()
+	}
+	return userMsg
+}
+
+// ErrorFields returns the fields given with Error.WithField to every Error in
+// the chain of err. If more than one gives a field with the same key, the value
+// of the outermost one is used. If there are no fields, nil is returned.
+func ErrorFields(err error) map[string]interface{} {
+	var fields map[string]interface{}
+	walkErrors(err, func(e error) bool {
+		if jErr, ok := e.(Error); ok && jErr.fields != nil {
+			if fields == nil {
+				fields = map[string]interface{}{}
+			}
+			for k, v := range *jErr.fields {
+				if _, exists := fields[k]; !exists {
+					fields[k] = v
+				}
+			}
+		}
+		return true
+	})
+	return fields
+}
+
+// walkErrors calls fn on err and then on every error that it wraps, outermost
+// first, until fn returns false. The causes of an Error are followed as well
+// as errors returned by Unwrap. It returns false if fn did.
+func walkErrors(err error, fn func(error) bool) bool {
+	for err != nil {
+		if !fn(err) {
+			return false
+		}
+
+		var causes []error
+		switch wrapper := err.(type) {
+		case Error:
+			causes = wrapper.cause
+		case interface{ Unwrap() []error }:
+			causes = wrapper.Unwrap()
+		default:
+			err = errors.Unwrap(err)
+			continue
+		}
+
+		for _, c := range causes {
+			if !walkErrors(c, fn) {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+package jelly
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ErrorStatus(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		expect int
+	}{
+		{name: "nil", err: nil, expect: 0},
+		{name: "unknown", err: errors.New("bad"), expect: http.StatusInternalServerError},
+		{name: "bad argument", err: ErrBadArgument, expect: http.StatusBadRequest},
+		{name: "wrapped in Error", err: NewError("no such user", ErrNotFound), expect: http.StatusNotFound},
+		{name: "wrapped with fmt", err: fmt.Errorf("update: %w", ErrConflict), expect: http.StatusConflict},
+		{name: "permissions", err: ErrPermissions, expect: http.StatusForbidden},
+		{name: "unsupported media type", err: ErrUnsupportedMediaType, expect: http.StatusUnsupportedMediaType},
+		{name: "rate limited", err: ErrRateLimited, expect: http.StatusTooManyRequests},
+		{name: "unavailable", err: ErrUnavailable, expect: http.StatusServiceUnavailable},
+		{name: "timeout", err: ErrTimeout, expect: http.StatusGatewayTimeout},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, expect: http.StatusGatewayTimeout},
+		{name: "validation before bad argument", err: ValidationError{Fields: []FieldError{{Field: "a", Message: "bad"}}}, expect: http.StatusUnprocessableEntity},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, ErrorStatus(tc.err))
+		})
+	}
+}
+
+func Test_ValidationError(t *testing.T) {
+	assert := assert.New(t)
+
+	var verr ValidationError
+	assert.False(verr.HasErrors())
+
+	verr.Add("name", "must not be empty")
+	verr.Add("address.zip", "must have %d digits", 5)
+
+	assert.True(verr.HasErrors())
+	assert.Equal("name: must not be empty; address.zip: must have 5 digits", verr.Error())
+	assert.ErrorIs(verr, ErrValidation)
+	assert.ErrorIs(verr, ErrBadArgument)
+	assert.NotErrorIs(verr, ErrNotFound)
+}
+
+func Test_UserMessage(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		expect string
+	}{
+		{name: "nil", err: nil, expect: ""},
+		{name: "plain error is used as-is", err: errors.New("bad"), expect: "bad"},
+		{name: "Error without user message", err: NewError("name is required", ErrBadArgument), expect: "name is required: " + ErrBadArgument.Error()},
+		{name: "user error", err: NewUserError("Could not save", "insert row 8: disk full"), expect: "Could not save"},
+		{name: "wrapped user error", err: WrapUserError(errors.New("dial tcp: refused"), "Service unavailable"), expect: "Service unavailable"},
+		{name: "user error in fmt chain", err: fmt.Errorf("handler: %w", NewUserError("Could not save", "")), expect: "Could not save"},
+		{name: "outermost user message wins", err: WrapUserError(NewUserError("inner", "x"), "outer"), expect: "outer"},
+		{name: "user error as a cause", err: NewError("op", NewUserError("inner", "x")), expect: "inner"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, UserMessage(tc.err))
+		})
+	}
+}
+
+func Test_NewUserError(t *testing.T) {
+	assert := assert.New(t)
+
+	err := NewUserError("Could not save", "insert row 8", ErrDB)
+
+	assert.Equal("insert row 8: "+ErrDB.Error(), err.Error())
+	assert.ErrorIs(err, ErrDB)
+	assert.Equal("Could not save", NewUserError("Could not save", "").Error())
+}
+
+func Test_ErrorFields(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(ErrorFields(errors.New("bad")))
+
+	inner := NewError("insert", ErrDB).WithField("table", "users").WithField("id", 8)
+	outer := WrapUserError(inner, "Could not save").WithField("id", 9)
+
+	assert.Equal(map[string]interface{}{"table": "users", "id": 9}, ErrorFields(fmt.Errorf("handler: %w", outer)))
+
+	// adding a field does not change the original
+	assert.Equal(map[string]interface{}{"table": "users", "id": 8}, ErrorFields(inner))
+
+	// Errors with fields can still be compared with errors.Is
+	assert.ErrorIs(NewError("wrap", inner), ErrDB)
+	assert.NotErrorIs(NewError("wrap", inner), NewError("other").WithField("id", 1))
+}
+
+type owdbTestError struct{ code int }
+
+func (e owdbTestError) Error() string { return "owdb error" }
+
+func Test_TranslateDBError(t *testing.T) {
+	assert := assert.New(t)
+
+	RegisterDBErrorTranslator(DatabaseOWDB, func(err error) (error, bool) {
+		var owErr owdbTestError
+		if !errors.As(err, &owErr) {
+			return nil, false
+		}
+		if owErr.code == 1 {
+			return NewError("duplicate", err, ErrDBConstraintViolation, ErrAlreadyExists), true
+		}
+		return err, true
+	})
+	defer RegisterDBErrorTranslator(DatabaseOWDB, nil)
+
+	assert.Nil(TranslateDBError(nil))
+
+	notFound := WrapDBError(fmt.Errorf("select: %w", sql.ErrNoRows))
+	assert.ErrorIs(notFound, ErrDBNotFound)
+	assert.ErrorIs(notFound, ErrNotFound)
+	assert.ErrorIs(notFound, ErrDB)
+
+	dup := WrapDBError(owdbTestError{code: 1}, "create user")
+	assert.ErrorIs(dup, ErrAlreadyExists)
+	assert.ErrorIs(dup, ErrDBConstraintViolation)
+
+	other := errors.New("disk full")
+	assert.Equal(other, TranslateDBError(other))
+}
+
+func Test_TranslateDBError_sqlite(t *testing.T) {
+	assert := assert.New(t)
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if !assert.NoError(err) {
+		return
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE)`)
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = db.Exec(`INSERT INTO users (name) VALUES ('jelly')`)
+	if !assert.NoError(err) {
+		return
+	}
+
+	_, err = db.Exec(`INSERT INTO users (name) VALUES ('jelly')`)
+	assert.ErrorIs(WrapDBError(err), ErrDBConstraintViolation)
+	assert.ErrorIs(WrapDBError(err), ErrAlreadyExists)
+
+	// constraints other than uniqueness do not mean the entity exists
+	_, err = db.Exec(`INSERT INTO users (name) VALUES (NULL)`)
+	assert.ErrorIs(WrapDBError(err), ErrDBConstraintViolation)
+	assert.NotErrorIs(WrapDBError(err), ErrAlreadyExists)
+}
@@ -0,0 +1,124 @@
+package jelly
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event is a notification that something happened in the server, such as a
+// user being created. Events are published to an EventBus and delivered to
+// each of its subscribers whose pattern matches the type of the event.
+type Event struct {
+	// ID uniquely identifies the event.
+	ID uuid.UUID `json:"id"`
+
+	// Type is the type of the event. It is made of dot-separated parts, the
+	// first of which is the name of the API that published it, such as
+	// "jellyauth.user.created".
+	Type string `json:"type"`
+
+	// Time is the time that the event was published.
+	Time time.Time `json:"time"`
+
+	// Data is the details of the event. It must be able to be marshaled to
+	// JSON.
+	Data interface{} `json:"data"`
+}
+
+// EventHandler is called with each Event published to an EventBus that it is
+// subscribed to. It is called in the goroutine that published the event, so it
+// must not block for long; handlers that do slow work, such as sending the
+// event to another server, should do it in another goroutine.
+type EventHandler func(ctx context.Context, ev Event)
+
+// EventMatches returns whether the type of an event matches pattern. Patterns
+// use the syntax of path.Match, so "jellyauth.user.*" matches every event
+// about users that jellyauth publishes and "*" matches every event. A
+// malformed pattern matches nothing.
+func EventMatches(pattern, eventType string) bool {
+	matched, err := path.Match(pattern, eventType)
+	return err == nil && matched
+}
+
+type eventSubscription struct {
+	id      int
+	pattern string
+	handler EventHandler
+}
+
+// EventBus delivers the events that are published to it to every subscriber
+// whose pattern matches them. Every API on a server gets the same EventBus
+// from Bundle.Events. It is safe for concurrent use.
+//
+// A nil *EventBus is ready to use and discards every event published to it,
+// so code that publishes events does not need to check whether it has a bus.
+type EventBus struct {
+	mtx    sync.RWMutex
+	subs   []eventSubscription
+	nextID int
+}
+
+// NewEventBus returns an EventBus with no subscribers.
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe registers handler to be called with every event published to the
+// bus whose type matches pattern (see EventMatches). Handlers are called in
+// the order they subscribed. The returned function removes the subscription.
+func (bus *EventBus) Subscribe(pattern string, handler EventHandler) (unsubscribe func()) {
+	if bus == nil || handler == nil {
+		return func() {}
+	}
+
+	bus.mtx.Lock()
+	defer bus.mtx.Unlock()
+
+	bus.nextID++
+	id := bus.nextID
+	bus.subs = append(bus.subs, eventSubscription{id: id, pattern: pattern, handler: handler})
+
+	return func() {
+		bus.mtx.Lock()
+		defer bus.mtx.Unlock()
+
+		for i := range bus.subs {
+			if bus.subs[i].id == id {
+				bus.subs = append(bus.subs[:i:i], bus.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish creates an Event of the given type with the given data and calls
+// the handler of every matching subscription with it before returning. The
+// published Event is returned.
+func (bus *EventBus) Publish(ctx context.Context, eventType string, data interface{}) Event {
+	ev := Event{
+		ID:   uuid.New(),
+		Type: eventType,
+		Time: time.Now(),
+		Data: data,
+	}
+	if bus == nil {
+		return ev
+	}
+
+	bus.mtx.RLock()
+	subs := make([]eventSubscription, len(bus.subs))
+	copy(subs, bus.subs)
+	bus.mtx.RUnlock()
+
+	for _, s := range subs {
+		if EventMatches(s.pattern, ev.Type) {
+			s.handler(ctx, ev)
+		}
+	}
+
+	return ev
+}
@@ -0,0 +1,239 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+)
+
+// noteModel is a note as it is given to clients.
+type noteModel struct {
+	URI      string `json:"uri"`
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+	Created  string `json:"created"`
+	Modified string `json:"modified"`
+}
+
+// noteRequest is the body of a request to create or update a note.
+type noteRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// notesAPI serves the notes of logged-in users.
+type notesAPI struct {
+	notes     Repo
+	uriBase   string
+	maxLength int
+}
+
+func (api *notesAPI) Init(cb jelly.Bundle) error {
+	api.uriBase = cb.Base()
+	api.maxLength = cb.GetInt(ConfigKeyMaxLength)
+
+	store, err := jelly.DBAs[Store](cb, 0) // will exist, enforced by config.Validate
+	if err != nil {
+		return fmt.Errorf("%w; is the DB using a notes connector?", err)
+	}
+	if store == nil {
+		// DB is not connected for the dry run; nothing else to check
+		return nil
+	}
+	api.notes = store.Notes()
+
+	return nil
+}
+
+func (api *notesAPI) Authenticators() map[string]jelly.Authenticator {
+	return nil
+}
+
+// Shutdown shuts down the notes API. This is added to implement jelly.API, and
+// has no effect on the API but to return the error of the context.
+func (api *notesAPI) Shutdown(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (api *notesAPI) Routes(em jelly.ServiceProvider) (router chi.Router, subpaths bool) {
+	reqAuth := em.RequiredAuth()
+
+	r := chi.NewRouter()
+
+	r.With(reqAuth).Get("/", api.httpGetAllNotes(em))
+	r.With(reqAuth).Post("/", api.httpCreateNote(em))
+	r.With(reqAuth).Get("/"+jelly.PathParam("id:uuid"), api.httpGetNote(em))
+	r.With(reqAuth).Put("/"+jelly.PathParam("id:uuid"), api.httpUpdateNote(em))
+	r.With(reqAuth).Delete("/"+jelly.PathParam("id:uuid"), api.httpDeleteNote(em))
+
+	return r, true
+}
+
+// model gives the noteModel of n.
+func (api *notesAPI) model(n Note) noteModel {
+	return noteModel{
+		URI:      api.uriBase + "/" + n.ID.String(),
+		ID:       n.ID.String(),
+		Title:    n.Title,
+		Body:     n.Body,
+		Created:  n.Created.Format(time.RFC3339),
+		Modified: n.Modified.Format(time.RFC3339),
+	}
+}
+
+// parseNoteRequest parses the noteRequest in the body of req and checks that
+// it is a valid note. The returned error is suitable for showing to the user.
+func (api *notesAPI) parseNoteRequest(req *http.Request) (noteRequest, error) {
+	var body noteRequest
+	if err := jelly.ParseJSONRequest(req, &body); err != nil {
+		return body, errors.New(jelly.UserMessage(err))
+	}
+
+	body.Title = strings.TrimSpace(body.Title)
+	if body.Title == "" {
+		return body, errors.New("title: must not be empty")
+	}
+	if utf8.RuneCountInString(body.Body) > api.maxLength {
+		return body, fmt.Errorf("body: must be at most %d characters", api.maxLength)
+	}
+
+	return body, nil
+}
+
+// getOwnNote gets the note whose ID is in the URI of req and checks that it
+// belongs to the logged-in user. If it cannot be gotten, the returned Result
+// is the response to give; otherwise it is the zero value.
+func (api *notesAPI) getOwnNote(em jelly.ServiceProvider, req *http.Request) (Note, jelly.Result) {
+	id := jelly.RequireIDParam(req)
+	user, _ := em.GetLoggedInUser(req)
+
+	note, err := api.notes.Get(req.Context(), id)
+	if err != nil {
+		if errors.Is(err, jelly.ErrDBNotFound) {
+			return Note{}, em.NotFound()
+		}
+		return Note{}, em.InternalServerError("could not get note: %v", err)
+	}
+
+	// do not reveal that notes of other users exist
+	if note.Owner != user.ID {
+		return Note{}, em.NotFound("user '%s' requested note %s of another user", user.Username, id)
+	}
+
+	return note, jelly.Result{}
+}
+
+// httpGetAllNotes returns a HandlerFunc that gets all notes of the logged-in
+// user.
+func (api *notesAPI) httpGetAllNotes(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := em.GetLoggedInUser(req)
+
+		all, err := api.notes.GetAllByOwner(req.Context(), user.ID)
+		if err != nil {
+			return em.InternalServerError("could not get notes: %v", err)
+		}
+
+		resp := make([]noteModel, len(all))
+		for i := range all {
+			resp[i] = api.model(all[i])
+		}
+
+		return em.OK(resp, "user '%s' got all notes", user.Username)
+	}, jelly.Override{Response: "[]notes.Note"})
+}
+
+// httpCreateNote returns a HandlerFunc that creates a note for the logged-in
+// user.
+func (api *notesAPI) httpCreateNote(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := em.GetLoggedInUser(req)
+
+		body, err := api.parseNoteRequest(req)
+		if err != nil {
+			return em.BadRequest(err.Error(), err.Error())
+		}
+
+		note, err := api.notes.Create(req.Context(), Note{Owner: user.ID, Title: body.Title, Body: body.Body})
+		if err != nil {
+			return em.InternalServerError("could not create note: %v", err)
+		}
+
+		resp := api.model(note)
+		return em.Created(resp, "user '%s' created note %s", user.Username, note.ID).WithHeader("Location", resp.URI)
+	}, jelly.Override{Request: "notes.NoteRequest", Response: "notes.Note"})
+}
+
+// httpGetNote returns a HandlerFunc that gets a note of the logged-in user.
+func (api *notesAPI) httpGetNote(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := em.GetLoggedInUser(req)
+
+		note, res := api.getOwnNote(em, req)
+		if res.Status != 0 {
+			return res
+		}
+
+		return em.OK(api.model(note), "user '%s' got note %s", user.Username, note.ID)
+	}, jelly.Override{Response: "notes.Note"})
+}
+
+// httpUpdateNote returns a HandlerFunc that replaces the title and body of a
+// note of the logged-in user.
+func (api *notesAPI) httpUpdateNote(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := em.GetLoggedInUser(req)
+
+		note, res := api.getOwnNote(em, req)
+		if res.Status != 0 {
+			return res
+		}
+
+		body, err := api.parseNoteRequest(req)
+		if err != nil {
+			return em.BadRequest(err.Error(), err.Error())
+		}
+
+		note.Title = body.Title
+		note.Body = body.Body
+		note, err = api.notes.Update(req.Context(), note.ID, note)
+		if err != nil {
+			if errors.Is(err, jelly.ErrDBNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not update note: %v", err)
+		}
+
+		return em.OK(api.model(note), "user '%s' updated note %s", user.Username, note.ID)
+	}, jelly.Override{Request: "notes.NoteRequest", Response: "notes.Note"})
+}
+
+// httpDeleteNote returns a HandlerFunc that deletes a note of the logged-in
+// user.
+func (api *notesAPI) httpDeleteNote(em jelly.ServiceProvider) http.HandlerFunc {
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := em.GetLoggedInUser(req)
+
+		note, res := api.getOwnNote(em, req)
+		if res.Status != 0 {
+			return res
+		}
+
+		if _, err := api.notes.Delete(req.Context(), note.ID); err != nil {
+			if errors.Is(err, jelly.ErrDBNotFound) {
+				return em.NotFound()
+			}
+			return em.InternalServerError("could not delete note: %v", err)
+		}
+
+		return em.NoContent("user '%s' deleted note %s", user.Username, note.ID)
+	})
+}
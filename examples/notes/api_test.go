@@ -0,0 +1,178 @@
+package notes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	jellyauth "github.com/dekarrin/jelly/auth"
+	"github.com/dekarrin/jelly/examples/notes"
+	"github.com/dekarrin/jelly/examples/notes/inmem"
+	"github.com/dekarrin/jelly/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// note is the JSON of a note as it is given by the API.
+type note struct {
+	URI   string `json:"uri"`
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// newServer starts a server with the notes and jellyauth components on
+// in-memory DBs, and returns its handler along with tokens for the users marty
+// and doc.
+func newServer(t *testing.T) (h http.Handler, martyToken, docToken string) {
+	confFile := filepath.Join(t.TempDir(), "jelly.yml")
+	require.NoError(t, os.WriteFile(confFile, []byte(`
+listen: localhost:8080
+dbs:
+  notes:
+    type: inmem
+    connector: notes
+jellyauth:
+  enabled: true
+  secret: "notes-test-secret-that-is-long-enough"
+  set_admin: marty:hunter2
+  unauth_delay: -1
+  password_cost: 4
+notes:
+  enabled: true
+  max_length: 20
+  uses:
+    - notes
+`), 0600))
+
+	env := &server.Environment{}
+	require.NoError(t, env.RegisterConnector(jelly.DatabaseInMemory, "notes", inmem.Connect))
+	env.UseComponent(jellyauth.Component)
+	env.UseComponent(notes.Component)
+	cfg, err := env.LoadConfig(confFile)
+	require.NoError(t, err)
+	srv, err := env.NewServer(&cfg)
+	require.NoError(t, err)
+	h = srv.Handler()
+
+	martyToken = login(t, h, "marty", "hunter2")
+	w := serve(h, http.MethodPost, "/auth/users", martyToken, `{"username":"doc","password":"1.21gigawatts","role":"normal"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	docToken = login(t, h, "doc", "1.21gigawatts")
+
+	return h, martyToken, docToken
+}
+
+func login(t *testing.T, h http.Handler, username, password string) string {
+	w := serve(h, http.MethodPost, "/auth/login", "", `{"username":"`+username+`","password":"`+password+`"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Token
+}
+
+// serve makes a request to h and returns the recorded response. If token is
+// not empty, it is given as a bearer token. If body is not empty, it is given
+// as JSON.
+func serve(h http.Handler, method, target, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func Test_notesAPI(t *testing.T) {
+	assert := assert.New(t)
+	h, marty, doc := newServer(t)
+
+	// create
+	w := serve(h, http.MethodPost, "/notes", marty, `{"title":"flux","body":"1.21 gigawatts"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created note
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal("/notes/"+created.ID, created.URI)
+	assert.Equal(created.URI, w.Header().Get("Location"))
+
+	// get
+	w = serve(h, http.MethodGet, created.URI, marty, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var got note
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(created, got)
+
+	// update
+	w = serve(h, http.MethodPut, created.URI, marty, `{"title":"flux capacitor","body":"time travel"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var updated note
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal("flux capacitor", updated.Title)
+	assert.Equal("time travel", updated.Body)
+
+	// list
+	w = serve(h, http.MethodGet, "/notes", marty, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var all []note
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &all))
+	assert.Equal([]note{updated}, all)
+
+	// other users cannot see or change it
+	w = serve(h, http.MethodGet, "/notes", doc, "")
+	assert.Equal(http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(`[]`, w.Body.String())
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		w = serve(h, method, created.URI, doc, `{"title":"stolen"}`)
+		assert.Equal(http.StatusNotFound, w.Code, "%s by other user: %s", method, w.Body.String())
+	}
+
+	// delete
+	w = serve(h, http.MethodDelete, created.URI, marty, "")
+	assert.Equal(http.StatusNoContent, w.Code, w.Body.String())
+	w = serve(h, http.MethodGet, created.URI, marty, "")
+	assert.Equal(http.StatusNotFound, w.Code, w.Body.String())
+}
+
+func Test_notesAPI_badRequests(t *testing.T) {
+	testCases := []struct {
+		name         string
+		method       string
+		target       string
+		token        bool
+		body         string
+		expectStatus int
+	}{
+		{name: "not logged in", method: http.MethodGet, target: "/notes", expectStatus: http.StatusUnauthorized},
+		{name: "no title", method: http.MethodPost, target: "/notes", token: true, body: `{"body":"untitled"}`, expectStatus: http.StatusBadRequest},
+		{name: "blank title", method: http.MethodPost, target: "/notes", token: true, body: `{"title":"  "}`, expectStatus: http.StatusBadRequest},
+		{name: "body too long", method: http.MethodPost, target: "/notes", token: true, body: `{"title":"long","body":"more than twenty characters"}`, expectStatus: http.StatusBadRequest},
+		{name: "malformed JSON", method: http.MethodPost, target: "/notes", token: true, body: `{"title":`, expectStatus: http.StatusBadRequest},
+		{name: "no such note", method: http.MethodGet, target: "/notes/00000000-0000-0000-0000-000000000001", token: true, expectStatus: http.StatusNotFound},
+	}
+
+	h, marty, _ := newServer(t)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var token string
+			if tc.token {
+				token = marty
+			}
+
+			w := serve(h, tc.method, tc.target, token, tc.body)
+			assert.Equal(t, tc.expectStatus, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Notes starts a jelly-based RESTServer that serves the notes example component
+along with the pre-rolled jelly auth API that its users log in with.
+
+Usage:
+
+	notes [flags]
+
+Once started, the server will listen for HTTP requests and respond to them as
+configured. The notes endpoints are under /notes and the jelly auth endpoints
+are under /auth, both under the base URI for the server if one is configured.
+
+When the server is seeded with the --seed flag and the configured profile is
+'dev', an admin user is created with username and password both set to 'admin'
+if it does not already exist.
+
+The flags are:
+
+	-c, --config PATH
+		Use the given file for the configuration instead of './jelly.yml'. The
+		file must be in JSON or YAML format.
+
+	--seed
+		Run the seed functions registered for the configured profile before
+		starting the server.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dekarrin/jelly"
+	jellyauth "github.com/dekarrin/jelly/auth"
+	"github.com/dekarrin/jelly/examples/notes"
+	"github.com/dekarrin/jelly/examples/notes/inmem"
+	"github.com/dekarrin/jelly/examples/notes/sqlite"
+	"github.com/dekarrin/jelly/server"
+	"github.com/spf13/pflag"
+)
+
+var (
+	flagConf = pflag.StringP("config", "c", "jelly.yml", "Path to configuration file")
+	flagSeed = pflag.Bool("seed", false, "Seed initial data for the configured profile before starting")
+)
+
+func main() {
+	pflag.Parse()
+	os.Exit(run())
+}
+
+func run() int {
+	env := server.Environment{}
+
+	// register the connectors of the notes stores
+	env.RegisterConnector(jelly.DatabaseInMemory, "notes", inmem.Connect)
+	env.RegisterConnector(jelly.DatabaseSQLite, "notes", sqlite.Connect)
+
+	// mark the components as in-use before loading config
+	env.UseComponent(jellyauth.Component)
+	env.UseComponent(notes.Component)
+
+	// default admin for development
+	env.RegisterSeed("jellyauth", "dev", jellyauth.SeedUser("admin", "admin", jelly.Admin))
+
+	conf, err := env.LoadConfig(filepath.Clean(*flagConf))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+		return jelly.ExitError
+	}
+
+	srv, err := env.NewServer(&conf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err.Error())
+		return jelly.ExitError
+	}
+
+	if *flagSeed {
+		if err := srv.Seed(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: seed: %s\n", err.Error())
+			return jelly.ExitError
+		}
+	}
+
+	return srv.Run(context.Background())
+}
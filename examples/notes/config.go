@@ -0,0 +1,108 @@
+package notes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+)
+
+const (
+	ConfigKeyMaxLength = "max_length"
+)
+
+type Config struct {
+	CommonConf jelly.CommonConfig
+
+	// MaxLength is the maximum number of characters in the body of a note. If
+	// not set it will default to 10000.
+	MaxLength int
+}
+
+// FillDefaults returns a new *Config identical to cfg but with unset values set
+// to their defaults and values normalized.
+func (cfg *Config) FillDefaults() jelly.APIConfig {
+	newCFG := new(Config)
+	*newCFG = *cfg
+
+	if newCFG.CommonConf.Enabled && newCFG.CommonConf.Base == "" {
+		newCFG.Set(jelly.ConfigKeyAPIBase, "/notes")
+	}
+
+	newCFG.CommonConf = newCFG.CommonConf.FillDefaults().Common()
+
+	if newCFG.MaxLength == 0 {
+		newCFG.MaxLength = 10000
+	}
+
+	return newCFG
+}
+
+// Validate returns an error if the Config has invalid field values set. Empty
+// and unset values are considered invalid; if defaults are intended to be used,
+// call Validate on the return value of FillDefaults.
+func (cfg *Config) Validate() error {
+	if err := cfg.CommonConf.Validate(); err != nil {
+		return err
+	}
+
+	if cfg.MaxLength < 1 {
+		return fmt.Errorf(ConfigKeyMaxLength + ": must be greater than 0")
+	}
+
+	if cfg.CommonConf.Enabled && len(cfg.CommonConf.UsesDBs) < 1 {
+		return fmt.Errorf("uses: must exist and have at least one entry")
+	}
+
+	return nil
+}
+
+func (cfg *Config) Common() jelly.CommonConfig {
+	return cfg.CommonConf
+}
+
+func (cfg *Config) Keys() []string {
+	keys := cfg.CommonConf.Keys()
+	keys = append(keys, ConfigKeyMaxLength)
+	return keys
+}
+
+func (cfg *Config) Get(key string) interface{} {
+	switch strings.ToLower(key) {
+	case ConfigKeyMaxLength:
+		return cfg.MaxLength
+	default:
+		return cfg.CommonConf.Get(key)
+	}
+}
+
+func (cfg *Config) Set(key string, value interface{}) error {
+	switch strings.ToLower(key) {
+	case ConfigKeyMaxLength:
+		if valueInt, ok := value.(int); ok {
+			cfg.MaxLength = valueInt
+			return nil
+		} else {
+			return fmt.Errorf("key '"+ConfigKeyMaxLength+"' requires an int but got a %T", value)
+		}
+	default:
+		return cfg.CommonConf.Set(key, value)
+	}
+}
+
+func (cfg *Config) SetFromString(key string, value string) error {
+	switch strings.ToLower(key) {
+	case ConfigKeyMaxLength:
+		if value == "" {
+			return cfg.Set(key, 0)
+		}
+		iVal, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		return cfg.Set(key, iVal)
+	default:
+		return cfg.CommonConf.SetFromString(key, value)
+	}
+}
@@ -0,0 +1,85 @@
+package notes
+
+import (
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Config_FillDefaults(t *testing.T) {
+	testCases := []struct {
+		name            string
+		cfg             Config
+		expectBase      string
+		expectMaxLength int
+	}{
+		{
+			name:            "enabled gets defaults",
+			cfg:             Config{CommonConf: jelly.CommonConfig{Enabled: true}},
+			expectBase:      "/notes",
+			expectMaxLength: 10000,
+		},
+		{
+			name:            "set values are kept",
+			cfg:             Config{CommonConf: jelly.CommonConfig{Enabled: true, Base: "/memos"}, MaxLength: 20},
+			expectBase:      "/memos",
+			expectMaxLength: 20,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			actual := tc.cfg.FillDefaults().(*Config)
+
+			assert.Equal(tc.expectBase, actual.CommonConf.Base)
+			assert.Equal(tc.expectMaxLength, actual.MaxLength)
+		})
+	}
+}
+
+func Test_Config_Validate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cfg       Config
+		expectErr bool
+	}{
+		{
+			name: "valid",
+			cfg:  Config{CommonConf: jelly.CommonConfig{Enabled: true, UsesDBs: []string{"notes"}}},
+		},
+		{
+			name:      "enabled without a DB",
+			cfg:       Config{CommonConf: jelly.CommonConfig{Enabled: true}},
+			expectErr: true,
+		},
+		{
+			name:      "negative max length",
+			cfg:       Config{CommonConf: jelly.CommonConfig{Enabled: true, UsesDBs: []string{"notes"}}, MaxLength: -1},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.FillDefaults().Validate()
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_Config_SetFromString(t *testing.T) {
+	assert := assert.New(t)
+	cfg := &Config{}
+
+	assert.NoError(cfg.SetFromString(ConfigKeyMaxLength, "500"))
+	assert.Equal(500, cfg.Get(ConfigKeyMaxLength))
+	assert.Error(cfg.SetFromString(ConfigKeyMaxLength, "lots"))
+	assert.Error(cfg.Set(ConfigKeyMaxLength, "500"))
+}
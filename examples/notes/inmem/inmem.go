@@ -0,0 +1,150 @@
+// Package inmem provides a notes.Store that keeps notes in memory. Notes are
+// lost when the server stops, so it is suited to tests and development.
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/examples/notes"
+	"github.com/google/uuid"
+)
+
+// Connect is the connector function for in-memory notes DBs. Register it with
+// the server Environment for jelly.DatabaseInMemory.
+func Connect(cfg jelly.DatabaseConfig) (jelly.Store, error) {
+	return NewStore(), nil
+}
+
+// Store is an in-memory notes.Store. It also implements
+// jelly.IDGeneratorStore. Its zero value should not be used; call NewStore to
+// get a Store ready for use.
+type Store struct {
+	notes *NoteRepo
+}
+
+func NewStore() *Store {
+	return &Store{notes: NewNoteRepository()}
+}
+
+func (st *Store) Notes() notes.Repo {
+	return st.notes
+}
+
+// UseIDGenerator sets the generator of the IDs of new notes.
+func (st *Store) UseIDGenerator(gen jelly.IDGenerator) {
+	st.notes.mtx.Lock()
+	defer st.notes.mtx.Unlock()
+
+	st.notes.ids = gen
+}
+
+func (st *Store) Close() error {
+	return st.notes.Close()
+}
+
+func NewNoteRepository() *NoteRepo {
+	return &NoteRepo{
+		notes: make(map[uuid.UUID]notes.Note),
+	}
+}
+
+// NoteRepo is an in-memory notes.Repo. It is safe for concurrent use.
+type NoteRepo struct {
+	mtx   sync.Mutex
+	notes map[uuid.UUID]notes.Note
+
+	// ids generates the IDs of new entities. If nil, random UUIDs are used.
+	ids jelly.IDGenerator
+}
+
+func (nr *NoteRepo) Create(ctx context.Context, n notes.Note) (notes.Note, error) {
+	nr.mtx.Lock()
+	defer nr.mtx.Unlock()
+
+	newUUID, err := jelly.NewID(nr.ids)
+	if err != nil {
+		return notes.Note{}, fmt.Errorf("could not generate ID: %w", err)
+	}
+
+	now := time.Now()
+	n.ID = newUUID
+	n.Created = now
+	n.Modified = now
+
+	nr.notes[n.ID] = n
+
+	return n, nil
+}
+
+func (nr *NoteRepo) Get(ctx context.Context, id uuid.UUID) (notes.Note, error) {
+	nr.mtx.Lock()
+	defer nr.mtx.Unlock()
+
+	n, ok := nr.notes[id]
+	if !ok {
+		return notes.Note{}, jelly.ErrDBNotFound
+	}
+
+	return n, nil
+}
+
+func (nr *NoteRepo) GetAllByOwner(ctx context.Context, owner uuid.UUID) ([]notes.Note, error) {
+	nr.mtx.Lock()
+	defer nr.mtx.Unlock()
+
+	all := make([]notes.Note, 0)
+	for _, n := range nr.notes {
+		if n.Owner == owner {
+			all = append(all, n)
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Created.Equal(all[j].Created) {
+			return all[i].ID.String() < all[j].ID.String()
+		}
+		return all[i].Created.Before(all[j].Created)
+	})
+
+	return all, nil
+}
+
+func (nr *NoteRepo) Update(ctx context.Context, id uuid.UUID, n notes.Note) (notes.Note, error) {
+	nr.mtx.Lock()
+	defer nr.mtx.Unlock()
+
+	existing, ok := nr.notes[id]
+	if !ok {
+		return notes.Note{}, jelly.ErrDBNotFound
+	}
+
+	existing.Title = n.Title
+	existing.Body = n.Body
+	existing.Modified = time.Now()
+	nr.notes[id] = existing
+
+	return existing, nil
+}
+
+func (nr *NoteRepo) Delete(ctx context.Context, id uuid.UUID) (notes.Note, error) {
+	nr.mtx.Lock()
+	defer nr.mtx.Unlock()
+
+	n, ok := nr.notes[id]
+	if !ok {
+		return notes.Note{}, jelly.ErrDBNotFound
+	}
+
+	delete(nr.notes, id)
+
+	return n, nil
+}
+
+func (nr *NoteRepo) Close() error {
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package notes provides an API for users to keep private notes. It supplies
+// the "notes" component.
+//
+// The notes component is a small but complete example of a jelly component,
+// meant to be copied as the starting point of new ones. It has a model and the
+// repo that holds it (this file), a config section (config.go), an API that is
+// built on jellyauth logins (api.go), and stores for in-memory and SQLite DBs
+// (packages inmem and sqlite), each with tests. The program in cmd/notes wires
+// it into a runnable server.
+//
+// To use the notes component, register the connector of each kind of DB it is
+// used with, call UseComponent(notes.Component) on the server Environment
+// before loading config, and add a "notes" section to the config that uses a
+// DB with one of those connectors:
+//
+//	env.RegisterConnector(jelly.DatabaseInMemory, "notes", inmem.Connect)
+//	env.RegisterConnector(jelly.DatabaseSQLite, "notes", sqlite.Connect)
+//	env.UseComponent(notes.Component)
+//
+// Every endpoint requires a login, and users can only see and change their own
+// notes.
+package notes
+
+import (
+	"context"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/google/uuid"
+)
+
+const (
+	Version = "0.0.1"
+)
+
+// Note is a note kept by a user.
+type Note struct {
+	ID       uuid.UUID // PK, NOT NULL
+	Owner    uuid.UUID // NOT NULL
+	Title    string    // NOT NULL
+	Body     string    // NOT NULL
+	Created  time.Time // NOT NULL
+	Modified time.Time // NOT NULL
+}
+
+// Repo is a repository of Notes.
+type Repo interface {
+	// Create creates a new Note in the DB based on the provided one. The ID,
+	// Created, and Modified of the provided one are ignored and set by the
+	// Repo.
+	//
+	// This returns the Note as it appears in the DB after creation.
+	Create(ctx context.Context, n Note) (Note, error)
+
+	// Get retrieves the Note with the given ID. If no Note with that ID exists,
+	// an error matching jelly.ErrDBNotFound is returned.
+	Get(ctx context.Context, id uuid.UUID) (Note, error)
+
+	// GetAllByOwner retrieves all Notes owned by the user with the given ID,
+	// oldest first. If there are none, the returned slice has a length of
+	// zero and the error is nil.
+	GetAllByOwner(ctx context.Context, owner uuid.UUID) ([]Note, error)
+
+	// Update updates the Note with the given ID to have the Title and Body of
+	// the provided one. If no Note with that ID exists, an error matching
+	// jelly.ErrDBNotFound is returned.
+	//
+	// This returns the Note as it appears in the DB after updating.
+	Update(ctx context.Context, id uuid.UUID, n Note) (Note, error)
+
+	// Delete removes the Note with the given ID. If no Note with that ID
+	// exists, an error matching jelly.ErrDBNotFound is returned.
+	//
+	// This returns the Note as it appeared in the DB immediately before
+	// deletion.
+	Delete(ctx context.Context, id uuid.UUID) (Note, error)
+
+	// Close performs any clean-up operations required and flushes pending
+	// operations.
+	Close() error
+}
+
+// Store is a jelly.Store that holds Notes. The DB used by the notes component
+// must be connected with a connector that gives one.
+type Store interface {
+	jelly.Store
+
+	// Notes returns the repository that holds the notes of all users.
+	Notes() Repo
+}
+
+type ComponentInfo struct{}
+
+func (ci ComponentInfo) Name() string {
+	return "notes"
+}
+
+func (ci ComponentInfo) Version() string {
+	return Version
+}
+
+func (ci ComponentInfo) API() jelly.API {
+	return &notesAPI{}
+}
+
+func (ci ComponentInfo) Config() jelly.APIConfig {
+	return &Config{}
+}
+
+func (ci ComponentInfo) Schemas() map[string]interface{} {
+	return map[string]interface{}{
+		"notes.Note":        noteModel{},
+		"notes.NoteRequest": noteRequest{},
+	}
+}
+
+var (
+	// Component holds the component information for notes. This is passed to
+	// UseComponent to enable the use of notes in a server.
+	Component jelly.Component = ComponentInfo{}
+)
@@ -0,0 +1,94 @@
+package notes_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/examples/notes"
+	"github.com/dekarrin/jelly/examples/notes/inmem"
+	"github.com/dekarrin/jelly/examples/notes/sqlite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_Repo checks that each notes.Repo implementation behaves as the
+// interface says it should. A new implementation only needs to be added to
+// the test cases.
+func Test_Repo(t *testing.T) {
+	testCases := []struct {
+		name  string
+		store func(t *testing.T) notes.Store
+	}{
+		{
+			name: "inmem",
+			store: func(t *testing.T) notes.Store {
+				return inmem.NewStore()
+			},
+		},
+		{
+			name: "sqlite",
+			store: func(t *testing.T) notes.Store {
+				st, err := sqlite.NewStore(filepath.Join(t.TempDir(), "notes.db"))
+				require.NoError(t, err)
+				return st
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			ctx := context.Background()
+			st := tc.store(t)
+			defer st.Close()
+			repo := st.Notes()
+
+			marty := uuid.New()
+			doc := uuid.New()
+
+			first, err := repo.Create(ctx, notes.Note{Owner: marty, Title: "flux", Body: "1.21 gigawatts"})
+			require.NoError(t, err)
+			assert.NotEqual(uuid.Nil, first.ID)
+			assert.Equal(marty, first.Owner)
+			assert.False(first.Created.IsZero())
+
+			second, err := repo.Create(ctx, notes.Note{Owner: marty, Title: "clock tower", Body: "10:04 PM"})
+			require.NoError(t, err)
+			_, err = repo.Create(ctx, notes.Note{Owner: doc, Title: "plutonium"})
+			require.NoError(t, err)
+
+			got, err := repo.Get(ctx, first.ID)
+			assert.NoError(err)
+			assert.Equal("1.21 gigawatts", got.Body)
+
+			all, err := repo.GetAllByOwner(ctx, marty)
+			assert.NoError(err)
+			require.Len(t, all, 2)
+			assert.ElementsMatch([]uuid.UUID{first.ID, second.ID}, []uuid.UUID{all[0].ID, all[1].ID})
+
+			none, err := repo.GetAllByOwner(ctx, uuid.New())
+			assert.NoError(err)
+			assert.Len(none, 0)
+
+			updated, err := repo.Update(ctx, first.ID, notes.Note{Title: "flux capacitor", Body: "what makes time travel possible"})
+			assert.NoError(err)
+			assert.Equal("flux capacitor", updated.Title)
+			assert.Equal(marty, updated.Owner, "owner must not be changed by update")
+
+			_, err = repo.Update(ctx, uuid.New(), notes.Note{Title: "nothing"})
+			assert.ErrorIs(err, jelly.ErrDBNotFound)
+
+			deleted, err := repo.Delete(ctx, first.ID)
+			assert.NoError(err)
+			assert.Equal("flux capacitor", deleted.Title)
+
+			_, err = repo.Get(ctx, first.ID)
+			assert.ErrorIs(err, jelly.ErrDBNotFound)
+			_, err = repo.Delete(ctx, first.ID)
+			assert.ErrorIs(err, jelly.ErrDBNotFound)
+		})
+	}
+}
@@ -0,0 +1,244 @@
+// Package sqlite provides a notes.Store that keeps notes in a SQLite DB.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/db"
+	"github.com/dekarrin/jelly/examples/notes"
+	"github.com/google/uuid"
+)
+
+// Connect is the connector function for SQLite notes DBs. Register it with the
+// server Environment for jelly.DatabaseSQLite. The DB file is "notes.db" in
+// the DataDir of cfg unless its DataFile is set.
+func Connect(cfg jelly.DatabaseConfig) (jelly.Store, error) {
+	err := os.MkdirAll(cfg.DataDir, 0770)
+	if err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+
+	filename := "notes.db"
+	if cfg.DataFile != "" {
+		filename = cfg.DataFile
+	}
+
+	return NewStore(filepath.Join(cfg.DataDir, filename))
+}
+
+// Store is a notes.Store backed by a SQLite DB. It also implements
+// jelly.IDGeneratorStore and jelly.ContextClosingStore.
+type Store struct {
+	db    *sql.DB
+	notes *NotesDB
+}
+
+// NewStore opens the SQLite DB in the given file, creating it and its tables
+// if they do not yet exist.
+func NewStore(file string) (*Store, error) {
+	conn, err := sql.Open("sqlite", file)
+	if err != nil {
+		return nil, jelly.WrapDBError(err)
+	}
+
+	st := &Store{
+		db:    conn,
+		notes: &NotesDB{DB: conn},
+	}
+	if err := st.notes.init(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("open notes table: %w", err)
+	}
+
+	return st, nil
+}
+
+func (st *Store) Notes() notes.Repo {
+	return st.notes
+}
+
+// UseIDGenerator sets the generator of the IDs of new notes.
+func (st *Store) UseIDGenerator(gen jelly.IDGenerator) {
+	st.notes.ids = gen
+}
+
+func (st *Store) Close() error {
+	return st.CloseContext(context.Background())
+}
+
+// CloseContext closes the DB after letting SQLite optimize it for later
+// connections, which it stops doing once ctx is done. The DB is closed
+// regardless.
+func (st *Store) CloseContext(ctx context.Context) error {
+	_, optErr := st.db.ExecContext(ctx, "PRAGMA optimize;")
+	if err := st.db.Close(); err != nil {
+		return jelly.WrapDBError(err)
+	}
+	if optErr != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return jelly.WrapDBError(optErr)
+	}
+	return nil
+}
+
+// NotesDB is a notes.Repo backed by a table in a SQLite DB.
+type NotesDB struct {
+	DB *sql.DB
+
+	// ids generates the IDs of new entities. If nil, random UUIDs are used.
+	ids jelly.IDGenerator
+}
+
+func (repo *NotesDB) init() error {
+	_, err := repo.DB.Exec(`CREATE TABLE IF NOT EXISTS notes (
+		id TEXT NOT NULL PRIMARY KEY,
+		owner TEXT NOT NULL,
+		title TEXT NOT NULL,
+		body TEXT NOT NULL,
+		created INTEGER NOT NULL,
+		modified INTEGER NOT NULL
+	);`)
+	if err != nil {
+		return jelly.WrapDBError(err)
+	}
+
+	return nil
+}
+
+func (repo *NotesDB) Create(ctx context.Context, n notes.Note) (notes.Note, error) {
+	newUUID, err := jelly.NewID(repo.ids)
+	if err != nil {
+		return notes.Note{}, fmt.Errorf("could not generate ID: %w", err)
+	}
+
+	now := db.Timestamp(time.Now())
+	_, err = repo.DB.ExecContext(ctx, `INSERT INTO notes (id, owner, title, body, created, modified) VALUES (?, ?, ?, ?, ?, ?)`,
+		newUUID,
+		n.Owner,
+		n.Title,
+		n.Body,
+		now,
+		now,
+	)
+	if err != nil {
+		return notes.Note{}, jelly.WrapDBError(err)
+	}
+
+	return repo.Get(ctx, newUUID)
+}
+
+func (repo *NotesDB) Get(ctx context.Context, id uuid.UUID) (notes.Note, error) {
+	row := repo.DB.QueryRowContext(ctx, `SELECT id, owner, title, body, created, modified FROM notes WHERE id = ?;`, id)
+
+	n, err := scanNote(row)
+	if err != nil {
+		return notes.Note{}, jelly.WrapDBError(err)
+	}
+
+	return n, nil
+}
+
+func (repo *NotesDB) GetAllByOwner(ctx context.Context, owner uuid.UUID) ([]notes.Note, error) {
+	rows, err := repo.DB.QueryContext(ctx, `SELECT id, owner, title, body, created, modified FROM notes WHERE owner = ? ORDER BY created, id;`, owner)
+	if err != nil {
+		return nil, jelly.WrapDBError(err)
+	}
+	defer rows.Close()
+
+	all := make([]notes.Note, 0)
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return nil, jelly.WrapDBError(err)
+		}
+		all = append(all, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		return all, jelly.WrapDBError(err)
+	}
+
+	return all, nil
+}
+
+func (repo *NotesDB) Update(ctx context.Context, id uuid.UUID, n notes.Note) (notes.Note, error) {
+	res, err := repo.DB.ExecContext(ctx, `UPDATE notes SET title=?, body=?, modified=? WHERE id=?;`,
+		n.Title,
+		n.Body,
+		db.Timestamp(time.Now()),
+		id,
+	)
+	if err != nil {
+		return notes.Note{}, jelly.WrapDBError(err)
+	}
+	rowsAff, err := res.RowsAffected()
+	if err != nil {
+		return notes.Note{}, jelly.WrapDBError(err)
+	}
+	if rowsAff < 1 {
+		return notes.Note{}, jelly.ErrDBNotFound
+	}
+
+	return repo.Get(ctx, id)
+}
+
+func (repo *NotesDB) Delete(ctx context.Context, id uuid.UUID) (notes.Note, error) {
+	curVal, err := repo.Get(ctx, id)
+	if err != nil {
+		return curVal, err
+	}
+
+	res, err := repo.DB.ExecContext(ctx, `DELETE FROM notes WHERE id = ?`, id)
+	if err != nil {
+		return curVal, jelly.WrapDBError(err)
+	}
+	rowsAff, err := res.RowsAffected()
+	if err != nil {
+		return curVal, jelly.WrapDBError(err)
+	}
+	if rowsAff < 1 {
+		return curVal, jelly.ErrDBNotFound
+	}
+
+	return curVal, nil
+}
+
+func (repo *NotesDB) Close() error {
+	return nil
+}
+
+// scanner is a *sql.Row or *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanNote scans a row of the notes table, with its columns in the order they
+// are declared in, into a Note.
+func scanNote(row scanner) (notes.Note, error) {
+	var n notes.Note
+	var created, modified db.Timestamp
+
+	err := row.Scan(
+		&n.ID,
+		&n.Owner,
+		&n.Title,
+		&n.Body,
+		&created,
+		&modified,
+	)
+	if err != nil {
+		return notes.Note{}, err
+	}
+
+	n.Created = created.Time()
+	n.Modified = modified.Time()
+	return n, nil
+}
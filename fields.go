@@ -0,0 +1,148 @@
+package jelly
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// FieldsParam is the name of the query parameter that selects the fields of a
+// response in endpoints that support it; see Override.Fields.
+const FieldsParam = "fields"
+
+// ParseFields returns the fields that were selected in the fields query
+// parameter of req, mapped by the type of resource that they are for. Fields
+// given as "fields=a,b" apply to every type and are mapped under "". Fields
+// given for a single type as "fields[TYPE]=a,b", as in JSON:API sparse
+// fieldsets, are mapped under TYPE, which is the Type of the ModelMeta of the
+// resource. Returns nil if no fields were selected.
+func ParseFields(req *http.Request) map[string][]string {
+	var fields map[string][]string
+
+	for key, values := range req.URL.Query() {
+		var typ string
+		if key != FieldsParam {
+			if !strings.HasPrefix(key, FieldsParam+"[") || !strings.HasSuffix(key, "]") {
+				continue
+			}
+			typ = key[len(FieldsParam)+1 : len(key)-1]
+		}
+
+		var names []string
+		for _, v := range values {
+			for _, name := range strings.Split(v, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+
+		if fields == nil {
+			fields = map[string][]string{}
+		}
+		fields[typ] = append(fields[typ], names...)
+	}
+
+	return fields
+}
+
+// WithFields returns a copy of r whose response body only includes the given
+// fields when it is marshaled. Fields are the names that members of the body
+// have in JSON, such as those given in json struct tags, and are mapped by the
+// type of resource they are for as returned by ParseFields. If the body is a
+// JSON array, the fields of each element are selected.
+//
+// If r was created with ResponseGenerator.Resource and an envelope is in use,
+// fields are selected from each resource in the envelope; the members of the
+// envelope itself, the type and id of JSON:API resources, and the links of
+// HAL resources are always included.
+func (r Result) WithFields(fields map[string][]string) Result {
+	erCopy := r.copy()
+	erCopy.fields = fields
+	return erCopy
+}
+
+// selectFields returns data, a marshaled response body in the given envelope,
+// with only the members given in fields.
+func selectFields(data []byte, env Envelope, fields map[string][]string) ([]byte, error) {
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	switch env {
+	case EnvelopeJSONAPI:
+		if obj, ok := doc.(map[string]interface{}); ok {
+			forEachObject(obj["data"], func(res map[string]interface{}) {
+				typ, _ := res["type"].(string)
+				if attrs, ok := res["attributes"].(map[string]interface{}); ok {
+					selectMembers(attrs, fields, typ)
+				}
+			})
+		}
+	case EnvelopeHAL:
+		if obj, ok := doc.(map[string]interface{}); ok {
+			if embedded, ok := obj["_embedded"].(map[string]interface{}); ok {
+				for typ, resources := range embedded {
+					forEachObject(resources, func(res map[string]interface{}) {
+						selectMembers(res, fields, typ, "_links")
+					})
+				}
+			} else {
+				selectMembers(obj, fields, "", "_links", "_embedded")
+			}
+		}
+	default:
+		forEachObject(doc, func(obj map[string]interface{}) {
+			selectMembers(obj, fields, "")
+		})
+	}
+
+	return json.Marshal(doc)
+}
+
+// forEachObject calls fn with v if it is a JSON object, or with each element
+// of v that is a JSON object if it is a JSON array.
+func forEachObject(v interface{}, fn func(obj map[string]interface{})) {
+	switch typed := v.(type) {
+	case map[string]interface{}:
+		fn(typed)
+	case []interface{}:
+		for _, elem := range typed {
+			if obj, ok := elem.(map[string]interface{}); ok {
+				fn(obj)
+			}
+		}
+	}
+}
+
+// selectMembers removes every member of obj that is not selected for typ in
+// fields, except for those named in keep. If no fields are selected for typ,
+// those selected for every type are used, and if there are none, obj is left
+// as-is.
+func selectMembers(obj map[string]interface{}, fields map[string][]string, typ string, keep ...string) {
+	selected, ok := fields[typ]
+	if !ok {
+		selected, ok = fields[""]
+		if !ok {
+			return
+		}
+	}
+
+	want := map[string]bool{}
+	for _, name := range selected {
+		want[name] = true
+	}
+	for _, name := range keep {
+		want[name] = true
+	}
+
+	for name := range obj {
+		if !want[name] {
+			delete(obj, name)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package jelly
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// FlagProvider decides whether feature flags are enabled. The server uses a
+// ConfigFlagProvider for the flags defined in its config by default; an
+// external flag service can be used instead by giving an implementation of
+// FlagProvider to the server's Environment.
+type FlagProvider interface {
+	// Enabled returns whether the named flag is enabled for user. user is the
+	// zero AuthUser if the flag is being checked for a client that is not
+	// logged in. Flags that the provider does not know of are disabled. An
+	// error is returned only if the provider could not decide, such as when
+	// an external service cannot be reached.
+	Enabled(flag string, user AuthUser) (bool, error)
+}
+
+// FlagRule is the definition of a single feature flag in config.
+type FlagRule struct {
+	// Enabled is whether the flag is on. If false, it is off for every user
+	// regardless of the other fields.
+	Enabled bool
+
+	// Percentage is the percentage of users that the flag is on for, from 0
+	// to 100. Users are assigned to the percentage by their ID, so the flag
+	// stays on for the same users as long as Percentage is not lowered, and
+	// every client that is not logged in is treated as the same user. If 0,
+	// the flag is on for every user.
+	Percentage int
+
+	// Roles is the roles of the users that the flag is on for. If empty, it
+	// is on for users of any role. Clients that are not logged in have the
+	// Guest role. Combined with Percentage, the flag is only on for the given
+	// percentage of users who have one of the roles.
+	Roles []Role
+}
+
+func (fr FlagRule) Validate() error {
+	if fr.Percentage < 0 || fr.Percentage > 100 {
+		return fmt.Errorf("percentage: must be between 0 and 100")
+	}
+	return nil
+}
+
+// appliesTo returns whether the flag is on for user according to fr.
+func (fr FlagRule) appliesTo(flag string, user AuthUser) bool {
+	if !fr.Enabled {
+		return false
+	}
+
+	if len(fr.Roles) > 0 {
+		hasRole := false
+		for _, r := range fr.Roles {
+			if user.Role == r {
+				hasRole = true
+				break
+			}
+		}
+		if !hasRole {
+			return false
+		}
+	}
+
+	if fr.Percentage > 0 && fr.Percentage < 100 {
+		// hash with the flag name so that different flags at the same
+		// percentage are not on for exactly the same users.
+		h := fnv.New32a()
+		h.Write([]byte(flag))
+		h.Write([]byte{0})
+		h.Write(user.ID[:])
+		if int(h.Sum32()%100) >= fr.Percentage {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FlagConfig contains options for the feature flags that APIs get from
+// Bundle.Flags.
+type FlagConfig struct {
+	// Rules are the flags that are defined, keyed by their names. Flags that
+	// are not defined are disabled. Flag names are not case-sensitive.
+	Rules map[string]FlagRule
+}
+
+func (fc FlagConfig) FillDefaults() FlagConfig {
+	newFC := fc
+
+	if len(fc.Rules) > 0 {
+		newFC.Rules = make(map[string]FlagRule, len(fc.Rules))
+		for name, fr := range fc.Rules {
+			newFC.Rules[strings.ToLower(name)] = fr
+		}
+	}
+
+	return newFC
+}
+
+func (fc FlagConfig) Validate() error {
+	names := make([]string, 0, len(fc.Rules))
+	for name := range fc.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("rules: flag name must not be empty")
+		}
+		if err := fc.Rules[name].Validate(); err != nil {
+			return fmt.Errorf("rules: %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// ConfigFlagProvider is a FlagProvider for the flags defined in a FlagConfig.
+// It never returns an error.
+type ConfigFlagProvider struct {
+	rules map[string]FlagRule
+}
+
+// NewConfigFlagProvider creates a ConfigFlagProvider for the flags defined in
+// cfg.
+func NewConfigFlagProvider(cfg FlagConfig) *ConfigFlagProvider {
+	return &ConfigFlagProvider{rules: cfg.FillDefaults().Rules}
+}
+
+// Enabled returns whether the named flag is enabled for user according to its
+// FlagRule.
+func (cfp *ConfigFlagProvider) Enabled(flag string, user AuthUser) (bool, error) {
+	flag = strings.ToLower(flag)
+	fr, ok := cfp.rules[flag]
+	if !ok {
+		return false, nil
+	}
+	return fr.appliesTo(flag, user), nil
+}
+
+// Flags checks whether feature flags are enabled with a FlagProvider. A nil
+// *Flags has every flag disabled.
+type Flags struct {
+	provider FlagProvider
+	log      Logger
+}
+
+// NewFlags creates a Flags that checks flags with provider and logs the
+// errors that it returns to log. log may be nil.
+func NewFlags(provider FlagProvider, log Logger) *Flags {
+	return &Flags{provider: provider, log: log}
+}
+
+// Enabled returns whether the named flag is enabled for user. Give the zero
+// AuthUser to check the flag for a client that is not logged in. If the
+// provider returns an error, it is logged and the flag is treated as
+// disabled.
+func (f *Flags) Enabled(flag string, user AuthUser) bool {
+	if f == nil || f.provider == nil {
+		return false
+	}
+
+	enabled, err := f.provider.Enabled(flag, user)
+	if err != nil {
+		if f.log != nil {
+			f.log.Warnf("check feature flag %q: %v; treating it as disabled", flag, err)
+		}
+		return false
+	}
+	return enabled
+}
+
+// Require returns Middleware that only passes on requests to the next handler
+// if the named flag is enabled for the user who made them, and responds with
+// an HTTP-404 to all others, so that routes behind a flag appear to not exist
+// until it is enabled. The user is the one logged in by any auth middleware
+// before it; if there is none, the main authenticator of sp is used to find
+// the user, and clients that are not logged in are checked as the zero
+// AuthUser.
+func (f *Flags) Require(sp ServiceProvider, flag string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			user, loggedIn := sp.GetLoggedInUser(req)
+			if !loggedIn {
+				var err error
+				user, loggedIn, err = sp.SelectAuthenticator().Authenticate(req)
+				if err != nil || !loggedIn {
+					user = AuthUser{}
+				}
+			}
+
+			if !f.Enabled(flag, user) {
+				res := sp.NotFound("feature flag %q is not enabled for user %q", flag, user.Username)
+				res.WriteResponse(w)
+				sp.LogResponse(req, res)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
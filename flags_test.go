@@ -0,0 +1,98 @@
+package jelly
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type errFlagProvider struct{}
+
+func (errFlagProvider) Enabled(string, AuthUser) (bool, error) {
+	return true, errors.New("flag service unreachable")
+}
+
+func Test_ConfigFlagProvider_Enabled(t *testing.T) {
+	admin := AuthUser{ID: uuid.New(), Role: Admin}
+	normal := AuthUser{ID: uuid.New(), Role: Normal}
+
+	prov := NewConfigFlagProvider(FlagConfig{Rules: map[string]FlagRule{
+		"New-User-Flow": {Enabled: true},
+		"off":           {Enabled: false},
+		"admin-reports": {Enabled: true, Roles: []Role{Admin}},
+		"guests":        {Enabled: true, Roles: []Role{Guest}},
+		"none":          {Enabled: true, Percentage: 100, Roles: []Role{Unverified}},
+	}})
+
+	testCases := []struct {
+		name   string
+		flag   string
+		user   AuthUser
+		expect bool
+	}{
+		{name: "enabled", flag: "new-user-flow", user: normal, expect: true},
+		{name: "case-insensitive", flag: "NEW-USER-FLOW", user: normal, expect: true},
+		{name: "disabled", flag: "off", user: admin, expect: false},
+		{name: "undefined", flag: "nope", user: admin, expect: false},
+		{name: "has role", flag: "admin-reports", user: admin, expect: true},
+		{name: "lacks role", flag: "admin-reports", user: normal, expect: false},
+		{name: "not logged in is guest", flag: "guests", user: AuthUser{}, expect: true},
+		{name: "percentage does not override roles", flag: "none", user: admin, expect: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			actual, err := prov.Enabled(tc.flag, tc.user)
+
+			assert.NoError(err)
+			assert.Equal(tc.expect, actual)
+		})
+	}
+}
+
+func Test_ConfigFlagProvider_Enabled_percentage(t *testing.T) {
+	assert := assert.New(t)
+
+	prov := NewConfigFlagProvider(FlagConfig{Rules: map[string]FlagRule{
+		"quarter": {Enabled: true, Percentage: 25},
+	}})
+
+	const users = 2000
+	on := 0
+	for i := 0; i < users; i++ {
+		user := AuthUser{ID: uuid.New()}
+		enabled, _ := prov.Enabled("quarter", user)
+
+		// the same user always gets the same answer
+		again, _ := prov.Enabled("quarter", user)
+		assert.Equal(enabled, again)
+
+		if enabled {
+			on++
+		}
+	}
+
+	assert.InDelta(users/4, on, users/10)
+}
+
+func Test_Flags_Enabled(t *testing.T) {
+	assert := assert.New(t)
+
+	var none *Flags
+	assert.False(none.Enabled("anything", AuthUser{}))
+
+	// errors are treated as disabled
+	assert.False(NewFlags(errFlagProvider{}, nil).Enabled("anything", AuthUser{}))
+}
+
+func Test_FlagConfig_Validate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(FlagConfig{Rules: map[string]FlagRule{"a": {Percentage: 100}}}.Validate())
+	assert.Error(FlagConfig{Rules: map[string]FlagRule{"a": {Percentage: 101}}}.Validate())
+	assert.Error(FlagConfig{Rules: map[string]FlagRule{" ": {}}}.Validate())
+}
@@ -0,0 +1,80 @@
+package jelly
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+)
+
+// GRPCAPI is an interface that can optionally be implemented by an API to
+// serve gRPC services from the same server as its HTTP routes. It is only used
+// if gRPC is enabled in Globals.GRPC.
+type GRPCAPI interface {
+	API
+
+	// RegisterGRPC registers the API's gRPC services with reg. The server
+	// calls it once, after Init has been called for all APIs, and only if the
+	// API is enabled.
+	RegisterGRPC(reg grpc.ServiceRegistrar)
+}
+
+// GRPCConfig contains options for serving gRPC services alongside the HTTP
+// APIs of a server. Calls are authenticated with the same Authenticators that
+// the HTTP auth middleware uses; the HTTP request that is given to the
+// Authenticator has the metadata of the call as its headers. Services get the
+// user that made a call with GRPCUserFromContext.
+type GRPCConfig struct {
+	// Enabled is whether to serve gRPC services.
+	Enabled bool
+
+	// Port is the port of the secondary listener that gRPC is served on. If
+	// it is 0, gRPC is served on the same listener as HTTP, and calls are told
+	// apart from HTTP requests by their Content-Type; clients must then use
+	// HTTP/2 without TLS ("h2c").
+	Port int
+
+	// Address is the internet address of the secondary listener that gRPC is
+	// served on. It is not used if Port is 0. It will default to the address
+	// of the server if not set.
+	Address string
+
+	// Authenticator is the name of the Authenticator used for gRPC calls. It
+	// will default to the main auth provider of the server if not set.
+	Authenticator string
+
+	// RequireAuth is whether calls must be made by a logged-in user. If set,
+	// calls that are not are rejected with the Unauthenticated status code.
+	RequireAuth bool
+}
+
+func (gc GRPCConfig) FillDefaults() GRPCConfig {
+	return gc
+}
+
+func (gc GRPCConfig) Validate() error {
+	if gc.Port < 0 {
+		return fmt.Errorf("listen: port must not be negative")
+	}
+
+	return nil
+}
+
+// grpcUserCtxKey is the key in a context that holds the user that made a gRPC
+// call.
+type grpcUserCtxKey struct{}
+
+// WithGRPCUser returns a copy of ctx that has user set as the logged-in user
+// that made a gRPC call. It is called by the server's auth interceptor, and
+// generally does not need to be called directly.
+func WithGRPCUser(ctx context.Context, user AuthUser) context.Context {
+	return context.WithValue(ctx, grpcUserCtxKey{}, user)
+}
+
+// GRPCUserFromContext returns the logged-in user that made the gRPC call
+// whose context is ctx. If no user is logged in, it returns an empty AuthUser
+// and false.
+func GRPCUserFromContext(ctx context.Context) (user AuthUser, loggedIn bool) {
+	user, loggedIn = ctx.Value(grpcUserCtxKey{}).(AuthUser)
+	return user, loggedIn
+}
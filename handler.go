@@ -0,0 +1,101 @@
+package jelly
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// HandlerOptions controls how the handler given to WrapHandler is served.
+type HandlerOptions struct {
+	// Auth is the authentication that the handler requires of clients. The
+	// authenticators in Authenticators are used for it, or the main
+	// authenticator if there are none. The logged-in user, if any, can be
+	// gotten from the context of requests with ContextOf.
+	Auth RouteAuth
+
+	// Authenticators names the authenticators that Auth uses, in the order
+	// that they are tried.
+	Authenticators []string
+
+	// StripBase is whether the base that the API is mounted at is removed from
+	// the path of requests before the handler is called, as with
+	// http.StripPrefix, so that a handler that routes requests on their path,
+	// such as an http.ServeMux, can be mounted at any base. If not set, the
+	// handler is given requests with their full path.
+	StripBase bool
+
+	// Middleware is applied to the handler after any auth middleware, in
+	// order.
+	Middleware []Middleware
+}
+
+// WrapHandler returns an API that serves every request to its base with h, so
+// that a handler that was not written for jelly, such as a metrics handler or
+// a router from another library, can be added to a server with RESTServer.Add
+// like any other API. The API is configured with the common keys of a section
+// of the same name as it is added with, such as "enabled" and "base"; no
+// section needs to be registered for it. It has no authenticators of its own
+// and does nothing when the server shuts down.
+func WrapHandler(h http.Handler, opts HandlerOptions) API {
+	return &handlerAPI{h: h, opts: opts}
+}
+
+// handlerAPI is the API created by WrapHandler.
+type handlerAPI struct {
+	h    http.Handler
+	opts HandlerOptions
+}
+
+func (api *handlerAPI) Init(cb Bundle) error {
+	return nil
+}
+
+func (api *handlerAPI) Authenticators() map[string]Authenticator {
+	return nil
+}
+
+// Shutdown shuts down the API. This is added to implement API, and has no
+// effect on the API but to return the error of the context.
+func (api *handlerAPI) Shutdown(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (api *handlerAPI) Routes(sp ServiceProvider) (router chi.Router, subpaths bool) {
+	r := chi.NewRouter()
+
+	switch api.opts.Auth {
+	case RouteAuthOptional:
+		r.Use(sp.OptionalAuth(api.opts.Authenticators...))
+	case RouteAuthRequired:
+		r.Use(sp.RequiredAuth(api.opts.Authenticators...))
+	}
+	for _, mw := range api.opts.Middleware {
+		r.Use(mw)
+	}
+
+	h := api.h
+	if api.opts.StripBase {
+		h = stripBase(h)
+	}
+	r.Handle("/", h)
+	r.Handle("/*", h)
+
+	return r, true
+}
+
+// stripBase returns a handler that calls h with requests whose path is only
+// the part that is matched by the "/*" route it is served at.
+func stripBase(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r2 := new(http.Request)
+		*r2 = *req
+		r2.URL = new(url.URL)
+		*r2.URL = *req.URL
+		r2.URL.Path = "/" + chi.URLParam(req, "*")
+		r2.URL.RawPath = ""
+		h.ServeHTTP(w, r2)
+	})
+}
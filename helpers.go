@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -24,6 +27,13 @@ var (
 
 type EndpointFunc func(req *http.Request) Result
 
+// ResultHook inspects the Result that an endpoint returned before it is written
+// to the client and returns the Result to write in its place. It can be used
+// to add headers, rewrite response bodies, or remove fields that the logged-in
+// user should not see; em can be used to get the logged-in user of req. A hook
+// that does not need to change the Result should return it unmodified.
+type ResultHook func(em ServiceProvider, req *http.Request, r Result) Result
+
 func UnPathParam(s string) string {
 	for name, pat := range paramTypePats {
 		s = strings.ReplaceAll(s, ":"+pat+"}", ":"+name+"}")
@@ -90,12 +100,11 @@ func RedirectNoTrailingSlash(sp ServiceProvider) http.HandlerFunc {
 
 // v must be a pointer to a type. Will return error such that
 // errors.Is(err, ErrMalformedBody) returns true if it is problem decoding the
-// JSON itself.
+// JSON itself, and errors.Is(err, ErrUnsupportedMediaType) returns true if the
+// Content-Type of the request is not application/json.
 func ParseJSONRequest(req *http.Request, v interface{}) error {
-	contentType := req.Header.Get("Content-Type")
-
-	if strings.ToLower(contentType) != "application/json" {
-		return fmt.Errorf("request content-type is not application/json")
+	if !MediaTypeIs(req.Header.Get("Content-Type"), "application/json") {
+		return NewError("request content-type is not application/json", ErrUnsupportedMediaType)
 	}
 
 	bodyData, err := io.ReadAll(req.Body)
@@ -115,6 +124,27 @@ func ParseJSONRequest(req *http.Request, v interface{}) error {
 	return nil
 }
 
+// MediaTypeIs returns whether contentType, the value of a Content-Type header,
+// gives a media type that matches one of accepted. Parameters such as charset
+// are ignored, and matching is not case-sensitive. An accepted type may be
+// "type/*" to match any subtype or "*/*" to match any type. If contentType is
+// empty or cannot be parsed, false is returned.
+func MediaTypeIs(contentType string, accepted ...string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+
+	for _, acc := range accepted {
+		acc = strings.ToLower(strings.TrimSpace(acc))
+		if acc == "*/*" || acc == mediaType || acc == major+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
 // RequireIDParam gets the ID of the main entity being referenced in the URI and
 // returns it. It panics if the key is not there or is not parsable.
 func RequireIDParam(r *http.Request) uuid.UUID {
@@ -140,19 +170,188 @@ func GetURLParam[E any](r *http.Request, key string, parse func(string) (E, erro
 	return val, nil
 }
 
+// VersionETag returns the entity tag of version v of an entity, for use in
+// the ETag header of responses that give the entity. It is the version in
+// double quotes, as required of a strong entity tag.
+func VersionETag(v int64) string {
+	return `"` + strconv.FormatInt(v, 10) + `"`
+}
+
+// IfMatchVersion returns the entity version given in the If-Match header of
+// req, in the format created by VersionETag. ok is false if the header is not
+// present or is "*", which matches any version. An error matching
+// ErrBadArgument is returned if the header is present but is not a single
+// strong entity tag that holds a version.
+func IfMatchVersion(req *http.Request) (version int64, ok bool, err error) {
+	tag := strings.TrimSpace(req.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return 0, false, nil
+	}
+
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false, NewError("If-Match must be a single strong entity tag", ErrBadArgument)
+	}
+	version, err = strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, false, NewError("If-Match does not give a valid version", ErrBadArgument)
+	}
+
+	return version, true, nil
+}
+
 // Override is a per-endpoint optional overriding of a global configuration in
 // order to, for instance, use a specific Authenticator. Multiple Overrides can
 // be given in a single Endpoint; if given, they will be evaluated in order with
 // later ones taking precedence over others in cases of conflict and later ones
 // being added to lists at lower prority in cases of lists.
 type Override struct {
+	// Authenticators names the authenticators that the endpoint uses, in the
+	// order that they are tried; see ServiceProvider.SelectAuthenticator.
+	// Responses that the endpoint gives for failed auth are delayed by the
+	// longest of their UnauthDelays. If empty, the main authenticator is used.
 	Authenticators []string
+
+	// Scopes lists scopes that the logged-in user must have to use the
+	// endpoint. If the user authenticated with a scoped token that does not
+	// grant all of them, the endpoint responds with an HTTP-403 without being
+	// called. Users who authenticated with an unscoped token are not affected;
+	// see AuthUser.HasScopes.
+	Scopes []string
+
+	// Fields is whether the endpoint supports selecting the fields of its
+	// response with the fields query parameter. If enabled, successful
+	// responses only include the fields that the client selected, if any; see
+	// ParseFields and Result.WithFields. If the response body is of a model
+	// whose schema is registered with the server's Environment, selecting a
+	// field that is not in the schema gives an HTTP-400.
+	Fields bool
+
+	// Schema is the name of the schema, registered with the server's
+	// Environment, that request bodies given to the endpoint must conform to.
+	// Requests whose body does not are responded to with an HTTP-400 without
+	// the endpoint being called. If empty, request bodies are not checked.
+	Schema string
+
+	// Accepts lists the media types of request bodies that the endpoint
+	// accepts, such as "application/json" or "image/*". Requests made with
+	// POST, PUT, or PATCH that have a body whose Content-Type is not one of
+	// them are responded to with an HTTP-415 without the endpoint being
+	// called. If empty, only "application/json" is accepted if
+	// Globals.RequireContentType is set, and any type is accepted otherwise.
+	Accepts []string
+
+	// Request is the name of the schema, registered with the server's
+	// Environment, of the model that is given in request bodies. Unlike
+	// Schema, request bodies are not checked against it; it only documents
+	// the endpoint for tools such as clientgen. If empty, Schema is used.
+	Request string
+
+	// Response is the name of the schema, registered with the server's
+	// Environment, of the model that is given in the bodies of successful
+	// responses, prefixed with "[]" if the body is a list of them. Like
+	// Request, it only documents the endpoint. If empty, the body of
+	// responses is not documented.
+	Response string
+
+	// Summary is a short description of what the endpoint does, written as a
+	// sentence. Like Request, it only documents the endpoint; tools such as
+	// clientgen give it in the docs of what they generate for the endpoint.
+	Summary string
+
+	// Deprecated marks the endpoint as deprecated if not nil. Every response
+	// of a deprecated endpoint has Deprecation, Sunset, and Link headers as
+	// given by it, each use of the endpoint is logged along with the number
+	// of times it has been used since the server started, and it is flagged
+	// as deprecated in RESTServer.RoutesIndex and in generated clients.
+	Deprecated *Deprecation
+
+	// Cache gives the Cache-Control header of the successful responses of the
+	// endpoint. If nil, responses to clients that are logged in are given
+	// "no-store" so that they are not cached, and other responses are given
+	// no Cache-Control header. Either way, a Cache-Control header set on the
+	// Result with WithHeader takes precedence.
+	Cache *CachePolicy
+}
+
+// CachePolicy gives the caching directives of the successful responses of an
+// endpoint. See Override.Cache.
+type CachePolicy struct {
+	// NoStore is whether responses must not be stored by any cache. If set,
+	// the other fields are ignored.
+	NoStore bool
+
+	// MaxAge is how long responses may be used from a cache before they must
+	// be revalidated. It is truncated to whole seconds. If less than a second,
+	// responses may be stored but must be revalidated each time they are used.
+	MaxAge time.Duration
+
+	// Public is whether responses may be stored by shared caches, such as
+	// proxies. If not set, responses are marked as private to the client. Only
+	// set it for endpoints whose responses are the same for every user.
+	Public bool
+}
+
+// String returns the value of the Cache-Control header given by cp.
+func (cp CachePolicy) String() string {
+	if cp.NoStore {
+		return "no-store"
+	}
+
+	vis := "private"
+	if cp.Public {
+		vis = "public"
+	}
+	if secs := int64(cp.MaxAge / time.Second); secs > 0 {
+		return vis + ", max-age=" + strconv.FormatInt(secs, 10)
+	}
+	return vis + ", no-cache"
+}
+
+// Deprecation gives the details of an endpoint that is deprecated. See
+// Override.Deprecated.
+type Deprecation struct {
+	// Since is when the endpoint was deprecated. It is given in the
+	// Deprecation header of responses as in RFC 9745. If not set, the header
+	// is given as "true" instead, which clients that follow earlier drafts of
+	// the standard understand.
+	Since time.Time
+
+	// Sunset is when the endpoint will stop being available. It is given in
+	// the Sunset header of responses as in RFC 8594. If not set, the header is
+	// not given.
+	Sunset time.Time
+
+	// Replacement is the URL of the endpoint that replaces the deprecated
+	// one. It is given as a Link header with the "successor-version" relation
+	// type. If not set, the header is not given.
+	Replacement string
 }
 
 func CombineOverrides(overs []Override) Override {
 	newOver := Override{}
 	for i := range overs {
 		newOver.Authenticators = append(newOver.Authenticators, overs[i].Authenticators...)
+		newOver.Scopes = append(newOver.Scopes, overs[i].Scopes...)
+		newOver.Accepts = append(newOver.Accepts, overs[i].Accepts...)
+		newOver.Fields = newOver.Fields || overs[i].Fields
+		if overs[i].Schema != "" {
+			newOver.Schema = overs[i].Schema
+		}
+		if overs[i].Request != "" {
+			newOver.Request = overs[i].Request
+		}
+		if overs[i].Response != "" {
+			newOver.Response = overs[i].Response
+		}
+		if overs[i].Summary != "" {
+			newOver.Summary = overs[i].Summary
+		}
+		if overs[i].Deprecated != nil {
+			newOver.Deprecated = overs[i].Deprecated
+		}
+		if overs[i].Cache != nil {
+			newOver.Cache = overs[i].Cache
+		}
 	}
 	return newOver
 }
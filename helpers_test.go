@@ -0,0 +1,49 @@
+package jelly
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MediaTypeIs(t *testing.T) {
+	testCases := []struct {
+		name        string
+		contentType string
+		accepted    []string
+		expect      bool
+	}{
+		{name: "exact", contentType: "application/json", accepted: []string{"application/json"}, expect: true},
+		{name: "with parameters", contentType: "application/json; charset=utf-8", accepted: []string{"application/json"}, expect: true},
+		{name: "case-insensitive", contentType: "Application/JSON", accepted: []string{"application/json"}, expect: true},
+		{name: "subtype wildcard", contentType: "image/png", accepted: []string{"text/plain", "image/*"}, expect: true},
+		{name: "any type", contentType: "text/csv", accepted: []string{"*/*"}, expect: true},
+		{name: "different type", contentType: "text/plain", accepted: []string{"application/json"}, expect: false},
+		{name: "empty", contentType: "", accepted: []string{"*/*"}, expect: false},
+		{name: "unparsable", contentType: "/json", accepted: []string{"application/json"}, expect: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, MediaTypeIs(tc.contentType, tc.accepted...))
+		})
+	}
+}
+
+func Test_ParseJSONRequest_contentType(t *testing.T) {
+	assert := assert.New(t)
+
+	var v map[string]string
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"Eridan"}`))
+	req.Header.Set("Content-Type", "text/plain")
+	err := ParseJSONRequest(req, &v)
+	assert.True(errors.Is(err, ErrUnsupportedMediaType))
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"Eridan"}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	assert.NoError(ParseJSONRequest(req, &v))
+	assert.Equal(map[string]string{"name": "Eridan"}, v)
+}
@@ -0,0 +1,179 @@
+package jelly
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// I18nConfig contains options for localizing the user-facing messages of
+// error responses. Messages given to ResponseGenerator methods such as Err and
+// BadRequest may be the keys of messages in a MessageCatalog, which are
+// replaced with the message for the best locale given in the Accept-Language
+// header of the request.
+type I18nConfig struct {
+	// FallbackLocale is the locale whose messages are used when the request
+	// does not accept any locale that has a catalog. It will default to "en"
+	// if not set.
+	FallbackLocale string
+
+	// Catalogs is the paths to catalog files, in YAML or JSON format, that map
+	// locales to message keys to the message for that locale. They are loaded
+	// in order when the server is created, after the catalogs registered with
+	// the server's Environment, and later messages replace earlier ones with
+	// the same key.
+	Catalogs []string
+}
+
+func (ic I18nConfig) FillDefaults() I18nConfig {
+	newIC := ic
+
+	if newIC.FallbackLocale == "" {
+		newIC.FallbackLocale = "en"
+	}
+
+	return newIC
+}
+
+func (ic I18nConfig) Validate() error {
+	if ic.FallbackLocale == "" {
+		return fmt.Errorf("fallback: must not be empty")
+	}
+
+	return nil
+}
+
+// MessageCatalog holds the user-facing messages of each locale that a server
+// supports, mapped by their key. Locales are IETF language tags such as "en"
+// or "pt-BR" and are not case-sensitive. The zero-value is not ready for use;
+// call NewMessageCatalog to get one.
+type MessageCatalog struct {
+	fallback string
+	locales  map[string]map[string]string
+}
+
+// NewMessageCatalog creates a new MessageCatalog with no messages that uses
+// the messages of fallback when a request accepts no locale in the catalog.
+func NewMessageCatalog(fallback string) *MessageCatalog {
+	return &MessageCatalog{
+		fallback: strings.ToLower(fallback),
+		locales:  map[string]map[string]string{},
+	}
+}
+
+// Add adds the given messages of locale to the catalog, mapped by their keys.
+// They replace any messages with the same keys that were already added for
+// locale.
+func (mc *MessageCatalog) Add(locale string, msgs map[string]string) {
+	locale = strings.ToLower(locale)
+
+	if mc.locales[locale] == nil {
+		mc.locales[locale] = map[string]string{}
+	}
+	for k, v := range msgs {
+		mc.locales[locale][k] = v
+	}
+}
+
+// Locale returns the locale in the catalog that best matches the
+// Accept-Language header of req. A locale matches a language range in the
+// header if it is equal to it, or if the range is a more specific form of it,
+// such as "fr-CA" for "fr". If nothing in the header matches, the fallback
+// locale is returned.
+func (mc *MessageCatalog) Locale(req *http.Request) string {
+	for _, lang := range ParseAcceptLanguage(req.Header.Get("Accept-Language")) {
+		for tag := lang; tag != ""; {
+			if _, ok := mc.locales[tag]; ok {
+				return tag
+			}
+			if i := strings.LastIndex(tag, "-"); i >= 0 {
+				tag = tag[:i]
+			} else {
+				tag = ""
+			}
+		}
+	}
+
+	return mc.fallback
+}
+
+// Message returns the message of locale with the given key. If locale does not
+// have the message, the message of the fallback locale is used. ok is false if
+// neither has it.
+func (mc *MessageCatalog) Message(locale, key string) (msg string, ok bool) {
+	if mc == nil {
+		return "", false
+	}
+
+	if msg, ok = mc.locales[strings.ToLower(locale)][key]; ok {
+		return msg, true
+	}
+	msg, ok = mc.locales[mc.fallback][key]
+	return msg, ok
+}
+
+// Localize returns the message with key msg for the locale that best matches
+// the Accept-Language header of req, along with that locale. If the catalog
+// has no message with key msg, msg itself is returned along with an empty
+// locale.
+func (mc *MessageCatalog) Localize(req *http.Request, msg string) (localized string, locale string) {
+	if mc == nil {
+		return msg, ""
+	}
+
+	locale = mc.Locale(req)
+	localized, ok := mc.Message(locale, msg)
+	if !ok {
+		return msg, ""
+	}
+	if _, hasLocale := mc.locales[locale][msg]; !hasLocale {
+		locale = mc.fallback
+	}
+	return localized, locale
+}
+
+// ParseAcceptLanguage returns the language ranges of an Accept-Language header
+// value in order of preference, lowercased. Ranges with a quality of 0 and
+// the wildcard range "*" are omitted.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if lang == "" || lang == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			name, val, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.TrimSpace(name) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		langs = append(langs, weighted{lang: lang, q: q})
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	ordered := make([]string, len(langs))
+	for i := range langs {
+		ordered[i] = langs[i].lang
+	}
+	return ordered
+}
@@ -0,0 +1,106 @@
+package jelly
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseAcceptLanguage(t *testing.T) {
+	testCases := []struct {
+		name   string
+		header string
+		expect []string
+	}{
+		{
+			name:   "empty",
+			header: "",
+			expect: []string{},
+		},
+		{
+			name:   "single",
+			header: "fr-CA",
+			expect: []string{"fr-ca"},
+		},
+		{
+			name:   "ordered by quality",
+			header: "en;q=0.5, fr-CA, fr;q=0.8, *;q=0.1",
+			expect: []string{"fr-ca", "fr", "en"},
+		},
+		{
+			name:   "zero quality omitted",
+			header: "de;q=0, es",
+			expect: []string{"es"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, ParseAcceptLanguage(tc.header))
+		})
+	}
+}
+
+func Test_MessageCatalog_Localize(t *testing.T) {
+	mc := NewMessageCatalog("en")
+	mc.Add("en", map[string]string{"not_found": "Not found", "gone": "Gone"})
+	mc.Add("FR", map[string]string{"not_found": "Introuvable"})
+
+	testCases := []struct {
+		name         string
+		acceptLang   string
+		msg          string
+		expectMsg    string
+		expectLocale string
+	}{
+		{
+			name:         "exact locale",
+			acceptLang:   "fr",
+			msg:          "not_found",
+			expectMsg:    "Introuvable",
+			expectLocale: "fr",
+		},
+		{
+			name:         "more specific range",
+			acceptLang:   "fr-CA, en;q=0.9",
+			msg:          "not_found",
+			expectMsg:    "Introuvable",
+			expectLocale: "fr",
+		},
+		{
+			name:         "no accepted locale uses fallback",
+			acceptLang:   "de",
+			msg:          "not_found",
+			expectMsg:    "Not found",
+			expectLocale: "en",
+		},
+		{
+			name:         "message missing from locale uses fallback",
+			acceptLang:   "fr",
+			msg:          "gone",
+			expectMsg:    "Gone",
+			expectLocale: "en",
+		},
+		{
+			name:         "not a key",
+			acceptLang:   "fr",
+			msg:          "something broke",
+			expectMsg:    "something broke",
+			expectLocale: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Language", tc.acceptLang)
+
+			msg, locale := mc.Localize(req, tc.msg)
+
+			assert.Equal(tc.expectMsg, msg)
+			assert.Equal(tc.expectLocale, locale)
+		})
+	}
+}
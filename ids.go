@@ -0,0 +1,200 @@
+package jelly
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IDStrategy is a way of generating the IDs of new entities.
+type IDStrategy string
+
+const (
+	// IDUUIDv4 generates random version 4 UUIDs. It is the default.
+	IDUUIDv4 IDStrategy = "uuidv4"
+
+	// IDUUIDv7 generates version 7 UUIDs, which begin with the time they were
+	// generated at and so sort in the order they were created.
+	IDUUIDv7 IDStrategy = "uuidv7"
+
+	// IDULID generates ULIDs, which are a millisecond timestamp followed by
+	// 80 random bits. They are given as UUIDs with the same 128 bits.
+	IDULID IDStrategy = "ulid"
+
+	// IDSnowflake generates 64-bit snowflake IDs, which are a millisecond
+	// timestamp since SnowflakeEpoch followed by the node ID and a sequence
+	// number. They are given as UUIDs whose first 8 bytes are the snowflake
+	// in big-endian order and whose last 8 bytes are zero.
+	IDSnowflake IDStrategy = "snowflake"
+)
+
+// SnowflakeEpoch is the time that the timestamps of snowflake IDs are counted
+// from.
+var SnowflakeEpoch = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// MaxSnowflakeNode is the highest node ID that snowflake IDs may have.
+const MaxSnowflakeNode = 1023
+
+func (s IDStrategy) String() string {
+	return string(s)
+}
+
+// ParseIDStrategy parses the name of an IDStrategy. It is not case-sensitive.
+func ParseIDStrategy(s string) (IDStrategy, error) {
+	strat := IDStrategy(strings.ToLower(s))
+	switch strat {
+	case IDUUIDv4, IDUUIDv7, IDULID, IDSnowflake:
+		return strat, nil
+	default:
+		return "", fmt.Errorf("must be one of %q, %q, %q, or %q", IDUUIDv4, IDUUIDv7, IDULID, IDSnowflake)
+	}
+}
+
+// IDConfig contains options for generating the IDs of new entities.
+type IDConfig struct {
+	// Strategy is how IDs are generated. It will default to IDUUIDv4 if not
+	// set.
+	Strategy IDStrategy
+
+	// Node is the ID of the server among those that generate snowflake IDs
+	// for the same entities, from 0 to MaxSnowflakeNode. It is only used with
+	// IDSnowflake.
+	Node int
+}
+
+func (ic IDConfig) FillDefaults() IDConfig {
+	newIC := ic
+
+	if newIC.Strategy == "" {
+		newIC.Strategy = IDUUIDv4
+	}
+
+	return newIC
+}
+
+func (ic IDConfig) Validate() error {
+	if _, err := ParseIDStrategy(ic.Strategy.String()); err != nil {
+		return fmt.Errorf("strategy: %w", err)
+	}
+	if ic.Node < 0 || ic.Node > MaxSnowflakeNode {
+		return fmt.Errorf("node: must be between 0 and %d", MaxSnowflakeNode)
+	}
+
+	return nil
+}
+
+// IDGenerator generates the IDs of new entities. Implementations must be safe
+// for concurrent use.
+type IDGenerator interface {
+	NewID() (uuid.UUID, error)
+}
+
+// IDGeneratorStore is a Store whose repos create the IDs of new entities with
+// an IDGenerator that is given to it. The server gives every connected
+// IDGeneratorStore the generator for the strategy in its config, so stores
+// that benefit from time-sortable IDs get them by implementing it.
+type IDGeneratorStore interface {
+	Store
+
+	// UseIDGenerator sets the IDGenerator that the Store uses for new
+	// entities.
+	UseIDGenerator(gen IDGenerator)
+}
+
+// defaultIDGenerator is used when no IDGenerator has been given.
+var defaultIDGenerator IDGenerator = IDGeneratorFunc(uuid.NewRandom)
+
+// NewIDGenerator creates an IDGenerator for the strategy in conf.
+func NewIDGenerator(conf IDConfig) (IDGenerator, error) {
+	conf = conf.FillDefaults()
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch conf.Strategy {
+	case IDUUIDv7:
+		return IDGeneratorFunc(uuid.NewV7), nil
+	case IDULID:
+		return IDGeneratorFunc(newULID), nil
+	case IDSnowflake:
+		return &snowflakeGenerator{node: int64(conf.Node)}, nil
+	default:
+		return defaultIDGenerator, nil
+	}
+}
+
+// NewID returns a new ID from gen, or a random version 4 UUID if gen is nil.
+// It is intended for use by repos whose generator may not have been set.
+func NewID(gen IDGenerator) (uuid.UUID, error) {
+	if gen == nil {
+		gen = defaultIDGenerator
+	}
+	return gen.NewID()
+}
+
+// IDGeneratorFunc is a function that is an IDGenerator.
+type IDGeneratorFunc func() (uuid.UUID, error)
+
+func (f IDGeneratorFunc) NewID() (uuid.UUID, error) {
+	return f()
+}
+
+func newULID() (uuid.UUID, error) {
+	var id uuid.UUID
+
+	ms := uint64(time.Now().UnixMilli())
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+
+	if _, err := rand.Read(id[6:]); err != nil {
+		return uuid.UUID{}, err
+	}
+	return id, nil
+}
+
+type snowflakeGenerator struct {
+	node int64
+
+	mtx    sync.Mutex
+	lastMS int64
+	seq    int64
+}
+
+func (g *snowflakeGenerator) NewID() (uuid.UUID, error) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	ms := time.Since(SnowflakeEpoch).Milliseconds()
+	if ms < g.lastMS {
+		// the clock went backwards; keep counting from the last time so IDs
+		// stay unique.
+		ms = g.lastMS
+	}
+
+	if ms == g.lastMS {
+		g.seq = (g.seq + 1) & 0xfff
+		if g.seq == 0 {
+			// the sequence ran out for this millisecond; wait for the next.
+			for ms <= g.lastMS {
+				time.Sleep(100 * time.Microsecond)
+				ms = time.Since(SnowflakeEpoch).Milliseconds()
+			}
+		}
+	} else {
+		g.seq = 0
+	}
+	g.lastMS = ms
+
+	var id uuid.UUID
+	binary.BigEndian.PutUint64(id[:8], uint64(ms<<22|g.node<<12|g.seq))
+	return id, nil
+}
@@ -0,0 +1,93 @@
+package jelly
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewIDGenerator(t *testing.T) {
+	testCases := []struct {
+		name     string
+		conf     IDConfig
+		sortable bool
+		check    func(t *testing.T, id [16]byte)
+	}{
+		{
+			name: "default is uuidv4",
+			conf: IDConfig{},
+			check: func(t *testing.T, id [16]byte) {
+				assert.Equal(t, byte(4), id[6]>>4)
+			},
+		},
+		{
+			name:     "uuidv7",
+			conf:     IDConfig{Strategy: IDUUIDv7},
+			sortable: true,
+			check: func(t *testing.T, id [16]byte) {
+				assert.Equal(t, byte(7), id[6]>>4)
+			},
+		},
+		{
+			name:     "ulid",
+			conf:     IDConfig{Strategy: IDULID},
+			sortable: true,
+		},
+		{
+			name:     "snowflake",
+			conf:     IDConfig{Strategy: IDSnowflake, Node: 413},
+			sortable: true,
+			check: func(t *testing.T, id [16]byte) {
+				sf := binary.BigEndian.Uint64(id[:8])
+				assert.Equal(t, uint64(413), (sf>>12)&0x3ff)
+				assert.Equal(t, make([]byte, 8), id[8:])
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			gen, err := NewIDGenerator(tc.conf)
+			if !assert.NoError(err) {
+				return
+			}
+
+			seen := map[[16]byte]bool{}
+			var prev [16]byte
+			for i := 0; i < 5000; i++ {
+				id, err := gen.NewID()
+				if !assert.NoError(err) {
+					return
+				}
+				assert.False(seen[id], "duplicate ID %s", id)
+				seen[id] = true
+
+				if tc.check != nil {
+					tc.check(t, id)
+				}
+				if tc.sortable && i > 0 {
+					// IDs within the same millisecond are only ordered for
+					// snowflakes, so only compare the timestamps of the others.
+					n := 6
+					if tc.conf.Strategy == IDSnowflake {
+						n = 8
+					}
+					assert.True(bytes.Compare(prev[:n], id[:n]) <= 0, "ID %d sorts before the one before it", i)
+				}
+				prev = id
+			}
+		})
+	}
+}
+
+func Test_NewIDGenerator_invalid(t *testing.T) {
+	_, err := NewIDGenerator(IDConfig{Strategy: "uuidv9"})
+	assert.Error(t, err)
+
+	_, err = NewIDGenerator(IDConfig{Strategy: IDSnowflake, Node: MaxSnowflakeNode + 1})
+	assert.Error(t, err)
+}
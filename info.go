@@ -0,0 +1,237 @@
+package jelly
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Version is the version of the jelly framework.
+const Version = "0.0.1"
+
+// VersionedComponent is an interface that can optionally be implemented by a
+// Component to give its version, which is included in the server's info.
+type VersionedComponent interface {
+	Component
+
+	// Version returns the version of the component.
+	Version() string
+}
+
+// InfoConfig contains options for the server info endpoint, which gives the
+// server's name, the version of jelly and of its components, and build info
+// of the program. It is typically used for keeping an inventory of a fleet of
+// servers.
+type InfoConfig struct {
+	// Enabled is whether to serve the info endpoint.
+	Enabled bool
+
+	// Path is the path of the info endpoint. Unlike the paths of APIs, it is
+	// relative to the server root, not to the server's base. It will default
+	// to "/.well-known/jelly-info" if not set.
+	Path string
+
+	// Name is the name of the server given in its info. If not set, the
+	// hostname of the machine is used.
+	Name string
+
+	// VersionHeader is whether to add an X-App-Version header giving the
+	// version of the program to every response. It has no effect if the
+	// version is not known; see SetBuildInfo.
+	VersionHeader bool
+}
+
+func (ic InfoConfig) FillDefaults() InfoConfig {
+	newIC := ic
+
+	if newIC.Path == "" {
+		newIC.Path = "/.well-known/jelly-info"
+	}
+
+	return newIC
+}
+
+func (ic InfoConfig) Validate() error {
+	if ic.Enabled && !strings.HasPrefix(ic.Path, "/") {
+		return fmt.Errorf("path: must start with a '/'")
+	}
+
+	return nil
+}
+
+// ServerInfo describes a running server.
+type ServerInfo struct {
+	// Name is the name of the server.
+	Name string `json:"name"`
+
+	// Version is the version of the jelly framework.
+	Version string `json:"version"`
+
+	// GoVersion is the version of Go that the program was built with.
+	GoVersion string `json:"go_version"`
+
+	// Components are the components that are enabled in the server, sorted
+	// by name.
+	Components []ComponentVersion `json:"components"`
+
+	// Build is information on the build of the program.
+	Build BuildInfo `json:"build"`
+}
+
+// ComponentVersion is the name and version of a component. If a component is
+// used for more than one API, there is a ComponentVersion for each of them,
+// named after the API.
+type ComponentVersion struct {
+	Name string `json:"name"`
+
+	// Component is the name of the component that the API called Name is an
+	// instance of. It is empty if the API has the same name as the component.
+	Component string `json:"component,omitempty"`
+
+	// Version is the version of the component. It is empty if the component
+	// does not implement VersionedComponent.
+	Version string `json:"version,omitempty"`
+}
+
+// BuildInfo is information on the build of the program that embeds jelly.
+type BuildInfo struct {
+	// Module is the path of the program's main module.
+	Module string `json:"module,omitempty"`
+
+	// Version is the version of the program.
+	Version string `json:"version,omitempty"`
+
+	// Commit is the VCS revision that the program was built from.
+	Commit string `json:"commit,omitempty"`
+
+	// Date is the date that the program was built, as given to SetBuildInfo.
+	// If not given, it is the time of the commit the program was built from.
+	Date string `json:"date,omitempty"`
+
+	// Modified is whether the program was built with uncommitted changes.
+	Modified bool `json:"modified,omitempty"`
+}
+
+var (
+	buildInfoMu  sync.RWMutex
+	setBuildInfo BuildInfo
+)
+
+// SetBuildInfo sets the version of the program that embeds jelly, the commit
+// it was built from, and the date it was built. These are typically injected
+// at build time with -ldflags and passed to SetBuildInfo at the start of main.
+// They take precedence over the values that ReadBuildInfo gets from the Go
+// toolchain, and are used in the server's info, its startup log, and the
+// X-App-Version response header if enabled. Empty arguments are ignored.
+//
+// SetBuildInfo should be called before the server is created. It is safe to
+// call concurrently.
+func SetBuildInfo(version, commit, date string) {
+	buildInfoMu.Lock()
+	defer buildInfoMu.Unlock()
+
+	setBuildInfo = BuildInfo{Version: version, Commit: commit, Date: date}
+}
+
+// ReadBuildInfo returns the build info of the running program. Values given to
+// SetBuildInfo are used if set; otherwise they are taken from the info that
+// the Go toolchain embeds in the program. Fields are left empty if the info is
+// not available, such as when running tests or when the program was built
+// without VCS stamping.
+func ReadBuildInfo() BuildInfo {
+	bi := readToolchainBuildInfo()
+
+	buildInfoMu.RLock()
+	defer buildInfoMu.RUnlock()
+
+	if setBuildInfo.Version != "" {
+		bi.Version = setBuildInfo.Version
+	}
+	if setBuildInfo.Commit != "" {
+		bi.Commit = setBuildInfo.Commit
+		bi.Modified = false
+	}
+	if setBuildInfo.Date != "" {
+		bi.Date = setBuildInfo.Date
+	}
+
+	return bi
+}
+
+func readToolchainBuildInfo() BuildInfo {
+	var bi BuildInfo
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return bi
+	}
+
+	bi.Module = info.Main.Path
+	if info.Main.Version != "(devel)" {
+		bi.Version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			bi.Commit = s.Value
+		case "vcs.time":
+			bi.Date = s.Value
+		case "vcs.modified":
+			bi.Modified = s.Value == "true"
+		}
+	}
+
+	return bi
+}
+
+// NewServerInfo returns the ServerInfo of a server with the given name that
+// has the given components enabled.
+func NewServerInfo(name string, components []ComponentVersion) ServerInfo {
+	comps := make([]ComponentVersion, len(components))
+	copy(comps, components)
+	sort.Slice(comps, func(i, j int) bool {
+		return comps[i].Name < comps[j].Name
+	})
+
+	return ServerInfo{
+		Name:       name,
+		Version:    Version,
+		GoVersion:  runtime.Version(),
+		Components: comps,
+		Build:      ReadBuildInfo(),
+	}
+}
+
+// String returns the info as a single line of space-separated key=value pairs,
+// suitable for logging.
+func (si ServerInfo) String() string {
+	comps := make([]string, len(si.Components))
+	for i, c := range si.Components {
+		comps[i] = c.Name
+		if c.Version != "" {
+			comps[i] += "@" + c.Version
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "name=%q jelly=%s go=%s components=[%s]", si.Name, si.Version, si.GoVersion, strings.Join(comps, ","))
+	if si.Build.Module != "" {
+		fmt.Fprintf(&sb, " module=%s", si.Build.Module)
+	}
+	if si.Build.Version != "" {
+		fmt.Fprintf(&sb, " app_version=%s", si.Build.Version)
+	}
+	if si.Build.Commit != "" {
+		fmt.Fprintf(&sb, " commit=%s", si.Build.Commit)
+		if si.Build.Modified {
+			sb.WriteString("+dirty")
+		}
+	}
+	if si.Build.Date != "" {
+		fmt.Fprintf(&sb, " build_date=%s", si.Build.Date)
+	}
+	return sb.String()
+}
@@ -19,6 +19,21 @@ type User struct {
 	Modified   db.Timestamp // NOT NULL
 	LastLogout db.Timestamp // NOT NULL DEFAULT NOW()
 	LastLogin  db.Timestamp // NOT NULL
+	TenantID   string       // NOT NULL DEFAULT ''
+	Attributes db.JSONMap   // NOT NULL DEFAULT '{}'
+	Archived   db.Timestamp // NOT NULL DEFAULT 0
+	Version    int64        // NOT NULL DEFAULT 1
+}
+
+// IsArchived returns whether u has been archived.
+func (u User) IsArchived() bool {
+	return !u.Archived.Time().IsZero()
+}
+
+// InTenant returns whether u can be accessed by operations whose context has
+// the given current tenant. If tenantID is empty, all users can be accessed.
+func (u User) InTenant(tenantID string) bool {
+	return tenantID == "" || u.TenantID == tenantID
 }
 
 func (u User) AuthUser() jelly.AuthUser {
@@ -32,6 +47,10 @@ func (u User) AuthUser() jelly.AuthUser {
 		Modified:   u.Modified.Time(),
 		LastLogout: u.LastLogout.Time(),
 		LastLogin:  u.LastLogin.Time(),
+		TenantID:   u.TenantID,
+		Attributes: u.Attributes.Copy(),
+		Archived:   u.Archived.Time(),
+		Version:    u.Version,
 	}
 }
 
@@ -45,6 +64,10 @@ func NewUserFromAuthUser(au jelly.AuthUser) User {
 		Modified:   db.Timestamp(au.Modified),
 		LastLogout: db.Timestamp(au.LastLogout),
 		LastLogin:  db.Timestamp(au.LastLogin),
+		TenantID:   au.TenantID,
+		Attributes: db.JSONMap(au.Attributes).Copy(),
+		Archived:   db.Timestamp(au.Archived),
+		Version:    au.Version,
 	}
 
 	if au.Email != "" {
@@ -56,3 +79,159 @@ func NewUserFromAuthUser(au jelly.AuthUser) User {
 
 	return u
 }
+
+// ServiceAccount is a pre-rolled DB model version of a jelly.ServiceAccount.
+type ServiceAccount struct {
+	ID          uuid.UUID    // PK, NOT NULL
+	Name        string       // UNIQUE, NOT NULL
+	Description string       // NOT NULL
+	Secret      string       // NOT NULL
+	Scopes      []string     // NOT NULL
+	Created     db.Timestamp // NOT NULL
+	Modified    db.Timestamp // NOT NULL
+	LastUsed    db.Timestamp // NOT NULL
+}
+
+func (sa ServiceAccount) ServiceAccount() jelly.ServiceAccount {
+	return jelly.ServiceAccount{
+		ID:          sa.ID,
+		Name:        sa.Name,
+		Description: sa.Description,
+		Secret:      sa.Secret,
+		Scopes:      append([]string{}, sa.Scopes...),
+		Created:     sa.Created.Time(),
+		Modified:    sa.Modified.Time(),
+		LastUsed:    sa.LastUsed.Time(),
+	}
+}
+
+func NewServiceAccountFromJelly(jsa jelly.ServiceAccount) ServiceAccount {
+	return ServiceAccount{
+		ID:          jsa.ID,
+		Name:        jsa.Name,
+		Description: jsa.Description,
+		Secret:      jsa.Secret,
+		Scopes:      append([]string{}, jsa.Scopes...),
+		Created:     db.Timestamp(jsa.Created),
+		Modified:    db.Timestamp(jsa.Modified),
+		LastUsed:    db.Timestamp(jsa.LastUsed),
+	}
+}
+
+// Session is a pre-rolled DB model version of a jelly.Session.
+type Session struct {
+	ID        uuid.UUID    // PK, NOT NULL
+	UserID    uuid.UUID    // NOT NULL
+	IP        string       // NOT NULL
+	UserAgent string       // NOT NULL
+	Created   db.Timestamp // NOT NULL
+	Expires   db.Timestamp // NOT NULL
+}
+
+func (s Session) Session() jelly.Session {
+	return jelly.Session{
+		ID:        s.ID,
+		UserID:    s.UserID,
+		IP:        s.IP,
+		UserAgent: s.UserAgent,
+		Created:   s.Created.Time(),
+		Expires:   s.Expires.Time(),
+	}
+}
+
+func NewSessionFromJelly(js jelly.Session) Session {
+	return Session{
+		ID:        js.ID,
+		UserID:    js.UserID,
+		IP:        js.IP,
+		UserAgent: js.UserAgent,
+		Created:   db.Timestamp(js.Created),
+		Expires:   db.Timestamp(js.Expires),
+	}
+}
+
+// LoginAttempt is a pre-rolled DB model version of a jelly.LoginAttempt.
+type LoginAttempt struct {
+	ID        uuid.UUID    // PK, NOT NULL
+	UserID    uuid.UUID    // NOT NULL
+	Username  string       // NOT NULL
+	IP        string       // NOT NULL
+	UserAgent string       // NOT NULL
+	Success   bool         // NOT NULL
+	Time      db.Timestamp // NOT NULL
+	TenantID  string       // NOT NULL DEFAULT ''
+}
+
+// InTenant returns whether la can be accessed by operations whose context has
+// the given current tenant. If tenantID is empty, all attempts can be
+// accessed.
+func (la LoginAttempt) InTenant(tenantID string) bool {
+	return tenantID == "" || la.TenantID == tenantID
+}
+
+func (la LoginAttempt) LoginAttempt() jelly.LoginAttempt {
+	return jelly.LoginAttempt{
+		ID:        la.ID,
+		UserID:    la.UserID,
+		Username:  la.Username,
+		IP:        la.IP,
+		UserAgent: la.UserAgent,
+		Success:   la.Success,
+		Time:      la.Time.Time(),
+		TenantID:  la.TenantID,
+	}
+}
+
+func NewLoginAttemptFromJelly(jla jelly.LoginAttempt) LoginAttempt {
+	return LoginAttempt{
+		ID:        jla.ID,
+		UserID:    jla.UserID,
+		Username:  jla.Username,
+		IP:        jla.IP,
+		UserAgent: jla.UserAgent,
+		Success:   jla.Success,
+		Time:      db.Timestamp(jla.Time),
+		TenantID:  jla.TenantID,
+	}
+}
+
+// TwoFactor is a pre-rolled DB model version of a jelly.TwoFactor.
+type TwoFactor struct {
+	UserID         uuid.UUID    // PK, NOT NULL
+	Secret         string       // NOT NULL
+	Confirmed      bool         // NOT NULL
+	RecoveryCodes  []string     // NOT NULL
+	LastStep       int64        // NOT NULL
+	FailedAttempts int          // NOT NULL DEFAULT 0
+	Version        int64        // NOT NULL DEFAULT 1
+	Created        db.Timestamp // NOT NULL
+	Modified       db.Timestamp // NOT NULL
+}
+
+func (tf TwoFactor) TwoFactor() jelly.TwoFactor {
+	return jelly.TwoFactor{
+		UserID:         tf.UserID,
+		Secret:         tf.Secret,
+		Confirmed:      tf.Confirmed,
+		RecoveryCodes:  append([]string{}, tf.RecoveryCodes...),
+		LastStep:       tf.LastStep,
+		FailedAttempts: tf.FailedAttempts,
+		Version:        tf.Version,
+		Created:        tf.Created.Time(),
+		Modified:       tf.Modified.Time(),
+	}
+}
+
+func NewTwoFactorFromJelly(jtf jelly.TwoFactor) TwoFactor {
+	return TwoFactor{
+		UserID:         jtf.UserID,
+		Secret:         jtf.Secret,
+		Confirmed:      jtf.Confirmed,
+		RecoveryCodes:  append([]string{}, jtf.RecoveryCodes...),
+		LastStep:       jtf.LastStep,
+		FailedAttempts: jtf.FailedAttempts,
+		Version:        jtf.Version,
+		Created:        db.Timestamp(jtf.Created),
+		Modified:       db.Timestamp(jtf.Modified),
+	}
+}
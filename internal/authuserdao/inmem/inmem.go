@@ -7,18 +7,28 @@ import (
 )
 
 // AuthUserStore is an in-memory database that is compatible with built-in jelly
-// user authentication mechanisms. It implements jeldao.AuthUserStore and it can
+// user authentication mechanisms. It implements jelly.AuthUserStore and it can
 // be easily integrated into custom structs by embedding it.
 //
 // Its zero-value should not be used; call NewAuthUserStore to get an
 // AuthUserStore ready for use.
 type AuthUserStore struct {
-	users *AuthUserRepo
+	users    *AuthUserRepo
+	accounts *ServiceAccountRepo
+	sessions *SessionRepo
+	attempts *LoginAttemptRepo
+	twoFacts *TwoFactorRepo
+	quotas   *QuotaRepo
 }
 
 func NewAuthUserStore() *AuthUserStore {
 	st := &AuthUserStore{
-		users: NewAuthUserRepository(),
+		users:    NewAuthUserRepository(),
+		accounts: NewServiceAccountRepository(),
+		sessions: NewSessionRepository(),
+		attempts: NewLoginAttemptRepository(),
+		twoFacts: NewTwoFactorRepository(),
+		quotas:   NewQuotaRepository(),
 	}
 	return st
 }
@@ -27,6 +37,35 @@ func (aus *AuthUserStore) AuthUsers() jelly.AuthUserRepo {
 	return aus.users
 }
 
+func (aus *AuthUserStore) ServiceAccounts() jelly.ServiceAccountRepo {
+	return aus.accounts
+}
+
+func (aus *AuthUserStore) Sessions() jelly.SessionRepo {
+	return aus.sessions
+}
+
+func (aus *AuthUserStore) LoginAttempts() jelly.LoginAttemptRepo {
+	return aus.attempts
+}
+
+func (aus *AuthUserStore) TwoFactors() jelly.TwoFactorRepo {
+	return aus.twoFacts
+}
+
+func (aus *AuthUserStore) Quotas() jelly.QuotaRepo {
+	return aus.quotas
+}
+
+// UseIDGenerator sets the generator of the IDs of new users, service
+// accounts, sessions, and login attempts.
+func (aus *AuthUserStore) UseIDGenerator(gen jelly.IDGenerator) {
+	aus.users.UseIDGenerator(gen)
+	aus.accounts.UseIDGenerator(gen)
+	aus.sessions.UseIDGenerator(gen)
+	aus.attempts.UseIDGenerator(gen)
+}
+
 func (aus *AuthUserStore) Close() error {
 	var err error
 	nextErr := aus.users.Close()
@@ -37,6 +76,46 @@ func (aus *AuthUserStore) Close() error {
 			err = nextErr
 		}
 	}
+	nextErr = aus.accounts.Close()
+	if nextErr != nil {
+		if err != nil {
+			err = fmt.Errorf("%s\nadditionally, %w", err, nextErr)
+		} else {
+			err = nextErr
+		}
+	}
+	nextErr = aus.sessions.Close()
+	if nextErr != nil {
+		if err != nil {
+			err = fmt.Errorf("%s\nadditionally, %w", err, nextErr)
+		} else {
+			err = nextErr
+		}
+	}
+	nextErr = aus.attempts.Close()
+	if nextErr != nil {
+		if err != nil {
+			err = fmt.Errorf("%s\nadditionally, %w", err, nextErr)
+		} else {
+			err = nextErr
+		}
+	}
+	nextErr = aus.twoFacts.Close()
+	if nextErr != nil {
+		if err != nil {
+			err = fmt.Errorf("%s\nadditionally, %w", err, nextErr)
+		} else {
+			err = nextErr
+		}
+	}
+	nextErr = aus.quotas.Close()
+	if nextErr != nil {
+		if err != nil {
+			err = fmt.Errorf("%s\nadditionally, %w", err, nextErr)
+		} else {
+			err = nextErr
+		}
+	}
 
 	return err
 }
@@ -0,0 +1,53 @@
+package inmem
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dekarrin/jelly"
+)
+
+func NewQuotaRepository() *QuotaRepo {
+	return &QuotaRepo{
+		usage: make(map[jelly.QuotaKey]int64),
+	}
+}
+
+// QuotaRepo is an in-memory jelly.QuotaRepo. Unlike the other repositories in
+// this package, it is safe for concurrent use, as quotas are typically
+// consumed by many requests at once.
+type QuotaRepo struct {
+	mtx   sync.Mutex
+	usage map[jelly.QuotaKey]int64
+}
+
+func (qr *QuotaRepo) Close() error {
+	return nil
+}
+
+func (qr *QuotaRepo) Add(ctx context.Context, key jelly.QuotaKey, amount int64, limit int64) (int64, error) {
+	qr.mtx.Lock()
+	defer qr.mtx.Unlock()
+
+	key.Period = key.Period.UTC()
+	used := qr.usage[key]
+
+	newUsed := used + amount
+	if amount > 0 && newUsed > limit {
+		return used, jelly.ErrQuotaExceeded
+	}
+	if newUsed < 0 {
+		newUsed = 0
+	}
+
+	qr.usage[key] = newUsed
+	return newUsed, nil
+}
+
+func (qr *QuotaRepo) Usage(ctx context.Context, key jelly.QuotaKey) (int64, error) {
+	qr.mtx.Lock()
+	defer qr.mtx.Unlock()
+
+	key.Period = key.Period.UTC()
+	return qr.usage[key], nil
+}
@@ -0,0 +1,131 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/db"
+	"github.com/dekarrin/jelly/internal/authuserdao"
+	"github.com/dekarrin/jelly/internal/jelsort"
+	"github.com/google/uuid"
+)
+
+func NewServiceAccountRepository() *ServiceAccountRepo {
+	return &ServiceAccountRepo{
+		accounts:    make(map[uuid.UUID]authuserdao.ServiceAccount),
+		byNameIndex: make(map[string]uuid.UUID),
+	}
+}
+
+type ServiceAccountRepo struct {
+	accounts    map[uuid.UUID]authuserdao.ServiceAccount
+	byNameIndex map[string]uuid.UUID
+
+	// ids generates the IDs of new entities. If nil, random UUIDs are used.
+	ids jelly.IDGenerator
+}
+
+func (sar *ServiceAccountRepo) Close() error {
+	return nil
+}
+
+// UseIDGenerator sets the generator of the IDs of new service accounts.
+func (sar *ServiceAccountRepo) UseIDGenerator(gen jelly.IDGenerator) {
+	sar.ids = gen
+}
+
+func (sar *ServiceAccountRepo) Create(ctx context.Context, sa jelly.ServiceAccount) (jelly.ServiceAccount, error) {
+	newUUID, err := jelly.NewID(sar.ids)
+	if err != nil {
+		return jelly.ServiceAccount{}, fmt.Errorf("could not generate ID: %w", err)
+	}
+
+	acct := authuserdao.NewServiceAccountFromJelly(sa)
+	acct.ID = newUUID
+
+	// make sure it's not already in the DB
+	if _, ok := sar.byNameIndex[acct.Name]; ok {
+		return jelly.ServiceAccount{}, jelly.ErrDBConstraintViolation
+	}
+
+	now := db.Timestamp(time.Now())
+	acct.Created = now
+	acct.Modified = now
+	acct.LastUsed = db.Timestamp{}
+
+	sar.accounts[acct.ID] = acct
+	sar.byNameIndex[acct.Name] = acct.ID
+
+	return acct.ServiceAccount(), nil
+}
+
+func (sar *ServiceAccountRepo) GetAll(ctx context.Context) ([]jelly.ServiceAccount, error) {
+	all := make([]jelly.ServiceAccount, len(sar.accounts))
+
+	i := 0
+	for k := range sar.accounts {
+		all[i] = sar.accounts[k].ServiceAccount()
+		i++
+	}
+
+	all = jelsort.By(all, func(l, r jelly.ServiceAccount) bool {
+		return l.ID.String() < r.ID.String()
+	})
+
+	return all, nil
+}
+
+func (sar *ServiceAccountRepo) Update(ctx context.Context, id uuid.UUID, sa jelly.ServiceAccount) (jelly.ServiceAccount, error) {
+	existing, ok := sar.accounts[id]
+	if !ok {
+		return jelly.ServiceAccount{}, jelly.ErrDBNotFound
+	}
+	acct := authuserdao.NewServiceAccountFromJelly(sa)
+	acct.ID = id
+	acct.Created = existing.Created
+
+	if acct.Name != existing.Name {
+		if _, ok := sar.byNameIndex[acct.Name]; ok {
+			return jelly.ServiceAccount{}, jelly.ErrDBConstraintViolation
+		}
+		delete(sar.byNameIndex, existing.Name)
+	}
+
+	acct.Modified = db.Timestamp(time.Now())
+	sar.accounts[id] = acct
+	sar.byNameIndex[acct.Name] = id
+
+	return acct.ServiceAccount(), nil
+}
+
+func (sar *ServiceAccountRepo) Get(ctx context.Context, id uuid.UUID) (jelly.ServiceAccount, error) {
+	acct, ok := sar.accounts[id]
+	if !ok {
+		return jelly.ServiceAccount{}, jelly.ErrDBNotFound
+	}
+
+	return acct.ServiceAccount(), nil
+}
+
+func (sar *ServiceAccountRepo) GetByName(ctx context.Context, name string) (jelly.ServiceAccount, error) {
+	id, ok := sar.byNameIndex[name]
+	if !ok {
+		return jelly.ServiceAccount{}, jelly.ErrDBNotFound
+	}
+
+	return sar.accounts[id].ServiceAccount(), nil
+}
+
+func (sar *ServiceAccountRepo) Delete(ctx context.Context, id uuid.UUID) (jelly.ServiceAccount, error) {
+	acct, ok := sar.accounts[id]
+	if !ok {
+		return jelly.ServiceAccount{}, jelly.ErrDBNotFound
+	}
+
+	delete(sar.byNameIndex, acct.Name)
+	delete(sar.accounts, acct.ID)
+
+	return acct.ServiceAccount(), nil
+}
@@ -0,0 +1,197 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/db"
+	"github.com/dekarrin/jelly/internal/authuserdao"
+	"github.com/dekarrin/jelly/internal/jelsort"
+	"github.com/google/uuid"
+)
+
+func NewSessionRepository() *SessionRepo {
+	return &SessionRepo{
+		sessions: make(map[uuid.UUID]authuserdao.Session),
+	}
+}
+
+type SessionRepo struct {
+	sessions map[uuid.UUID]authuserdao.Session
+
+	// ids generates the IDs of new entities. If nil, random UUIDs are used.
+	ids jelly.IDGenerator
+}
+
+func (sr *SessionRepo) Close() error {
+	return nil
+}
+
+// UseIDGenerator sets the generator of the IDs of new sessions.
+func (sr *SessionRepo) UseIDGenerator(gen jelly.IDGenerator) {
+	sr.ids = gen
+}
+
+func (sr *SessionRepo) Create(ctx context.Context, s jelly.Session) (jelly.Session, error) {
+	newUUID, err := jelly.NewID(sr.ids)
+	if err != nil {
+		return jelly.Session{}, fmt.Errorf("could not generate ID: %w", err)
+	}
+
+	sess := authuserdao.NewSessionFromJelly(s)
+	sess.ID = newUUID
+	sess.Created = db.Timestamp(time.Now())
+
+	sr.sessions[sess.ID] = sess
+
+	return sess.Session(), nil
+}
+
+func (sr *SessionRepo) Get(ctx context.Context, id uuid.UUID) (jelly.Session, error) {
+	sess, ok := sr.sessions[id]
+	if !ok {
+		return jelly.Session{}, jelly.ErrDBNotFound
+	}
+
+	return sess.Session(), nil
+}
+
+func (sr *SessionRepo) GetAllByUser(ctx context.Context, userID uuid.UUID) ([]jelly.Session, error) {
+	all := make([]jelly.Session, 0)
+	for k := range sr.sessions {
+		if sr.sessions[k].UserID == userID {
+			all = append(all, sr.sessions[k].Session())
+		}
+	}
+
+	all = jelsort.By(all, func(l, r jelly.Session) bool {
+		if l.Created.Equal(r.Created) {
+			return l.ID.String() < r.ID.String()
+		}
+		return l.Created.After(r.Created)
+	})
+
+	return all, nil
+}
+
+func (sr *SessionRepo) Update(ctx context.Context, id uuid.UUID, s jelly.Session) (jelly.Session, error) {
+	existing, ok := sr.sessions[id]
+	if !ok {
+		return jelly.Session{}, jelly.ErrDBNotFound
+	}
+
+	sess := authuserdao.NewSessionFromJelly(s)
+	sess.ID = id
+	sess.UserID = existing.UserID
+	sess.Created = existing.Created
+
+	sr.sessions[id] = sess
+
+	return sess.Session(), nil
+}
+
+func (sr *SessionRepo) Delete(ctx context.Context, id uuid.UUID) (jelly.Session, error) {
+	sess, ok := sr.sessions[id]
+	if !ok {
+		return jelly.Session{}, jelly.ErrDBNotFound
+	}
+
+	delete(sr.sessions, id)
+
+	return sess.Session(), nil
+}
+
+func (sr *SessionRepo) DeleteAllByUser(ctx context.Context, userID uuid.UUID) ([]jelly.Session, error) {
+	deleted, err := sr.GetAllByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range deleted {
+		delete(sr.sessions, s.ID)
+	}
+
+	return deleted, nil
+}
+
+func NewLoginAttemptRepository() *LoginAttemptRepo {
+	return &LoginAttemptRepo{
+		attempts: make(map[uuid.UUID]authuserdao.LoginAttempt),
+	}
+}
+
+type LoginAttemptRepo struct {
+	attempts map[uuid.UUID]authuserdao.LoginAttempt
+
+	// ids generates the IDs of new entities. If nil, random UUIDs are used.
+	ids jelly.IDGenerator
+}
+
+func (lar *LoginAttemptRepo) Close() error {
+	return nil
+}
+
+// UseIDGenerator sets the generator of the IDs of new login attempts.
+func (lar *LoginAttemptRepo) UseIDGenerator(gen jelly.IDGenerator) {
+	lar.ids = gen
+}
+
+func (lar *LoginAttemptRepo) Create(ctx context.Context, la jelly.LoginAttempt) (jelly.LoginAttempt, error) {
+	newUUID, err := jelly.NewID(lar.ids)
+	if err != nil {
+		return jelly.LoginAttempt{}, fmt.Errorf("could not generate ID: %w", err)
+	}
+
+	attempt := authuserdao.NewLoginAttemptFromJelly(la)
+	attempt.ID = newUUID
+	if tenantID, ok := jelly.TenantFromContext(ctx); ok && attempt.TenantID == "" {
+		attempt.TenantID = tenantID
+	}
+
+	lar.attempts[attempt.ID] = attempt
+
+	return attempt.LoginAttempt(), nil
+}
+
+func (lar *LoginAttemptRepo) GetAll(ctx context.Context) ([]jelly.LoginAttempt, error) {
+	return lar.getAllMatching(ctx, func(la authuserdao.LoginAttempt) bool {
+		return true
+	}), nil
+}
+
+func (lar *LoginAttemptRepo) GetAllByUser(ctx context.Context, userID uuid.UUID) ([]jelly.LoginAttempt, error) {
+	return lar.getAllMatching(ctx, func(la authuserdao.LoginAttempt) bool {
+		return la.UserID == userID
+	}), nil
+}
+
+func (lar *LoginAttemptRepo) getAllMatching(ctx context.Context, match func(authuserdao.LoginAttempt) bool) []jelly.LoginAttempt {
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
+	all := make([]jelly.LoginAttempt, 0)
+	for k := range lar.attempts {
+		if lar.attempts[k].InTenant(tenantID) && match(lar.attempts[k]) {
+			all = append(all, lar.attempts[k].LoginAttempt())
+		}
+	}
+
+	all = jelsort.By(all, func(l, r jelly.LoginAttempt) bool {
+		if l.Time.Equal(r.Time) {
+			return l.ID.String() < r.ID.String()
+		}
+		return l.Time.After(r.Time)
+	})
+
+	return all
+}
+
+func (lar *LoginAttemptRepo) DeleteBefore(ctx context.Context, t time.Time) error {
+	for k := range lar.attempts {
+		if lar.attempts[k].Time.Time().Before(t) {
+			delete(lar.attempts, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package inmem
+
+import (
+	"context"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/db"
+	"github.com/dekarrin/jelly/internal/authuserdao"
+	"github.com/google/uuid"
+)
+
+func NewTwoFactorRepository() *TwoFactorRepo {
+	return &TwoFactorRepo{
+		twoFactors: make(map[uuid.UUID]authuserdao.TwoFactor),
+	}
+}
+
+type TwoFactorRepo struct {
+	twoFactors map[uuid.UUID]authuserdao.TwoFactor
+}
+
+func (tfr *TwoFactorRepo) Close() error {
+	return nil
+}
+
+func (tfr *TwoFactorRepo) Create(ctx context.Context, tf jelly.TwoFactor) (jelly.TwoFactor, error) {
+	if _, ok := tfr.twoFactors[tf.UserID]; ok {
+		return jelly.TwoFactor{}, jelly.ErrDBConstraintViolation
+	}
+
+	twoFactor := authuserdao.NewTwoFactorFromJelly(tf)
+	twoFactor.Version = 1
+
+	now := db.Timestamp(time.Now())
+	twoFactor.Created = now
+	twoFactor.Modified = now
+
+	tfr.twoFactors[twoFactor.UserID] = twoFactor
+
+	return twoFactor.TwoFactor(), nil
+}
+
+func (tfr *TwoFactorRepo) Get(ctx context.Context, userID uuid.UUID) (jelly.TwoFactor, error) {
+	twoFactor, ok := tfr.twoFactors[userID]
+	if !ok {
+		return jelly.TwoFactor{}, jelly.ErrDBNotFound
+	}
+
+	return twoFactor.TwoFactor(), nil
+}
+
+func (tfr *TwoFactorRepo) Update(ctx context.Context, userID uuid.UUID, tf jelly.TwoFactor) (jelly.TwoFactor, error) {
+	existing, ok := tfr.twoFactors[userID]
+	if !ok {
+		return jelly.TwoFactor{}, jelly.ErrDBNotFound
+	}
+	if tf.Version != 0 && tf.Version != existing.Version {
+		return jelly.TwoFactor{}, jelly.ErrDBConflict
+	}
+
+	twoFactor := authuserdao.NewTwoFactorFromJelly(tf)
+	twoFactor.UserID = userID
+	twoFactor.Version = existing.Version + 1
+	twoFactor.Created = existing.Created
+	twoFactor.Modified = db.Timestamp(time.Now())
+
+	tfr.twoFactors[userID] = twoFactor
+
+	return twoFactor.TwoFactor(), nil
+}
+
+func (tfr *TwoFactorRepo) Delete(ctx context.Context, userID uuid.UUID) (jelly.TwoFactor, error) {
+	twoFactor, ok := tfr.twoFactors[userID]
+	if !ok {
+		return jelly.TwoFactor{}, jelly.ErrDBNotFound
+	}
+
+	delete(tfr.twoFactors, userID)
+
+	return twoFactor.TwoFactor(), nil
+}
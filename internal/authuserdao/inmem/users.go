@@ -16,26 +16,44 @@ func NewAuthUserRepository() *AuthUserRepo {
 	return &AuthUserRepo{
 		users:           make(map[uuid.UUID]authuserdao.User),
 		byUsernameIndex: make(map[string]uuid.UUID),
+		removed:         make(map[string]time.Time),
 	}
 }
 
 type AuthUserRepo struct {
 	users           map[uuid.UUID]authuserdao.User
 	byUsernameIndex map[string]uuid.UUID
+
+	// removed is the time that a user was last removed from each tenant, for
+	// MaxModified.
+	removed map[string]time.Time
+
+	// ids generates the IDs of new entities. If nil, random UUIDs are used.
+	ids jelly.IDGenerator
 }
 
 func (aur *AuthUserRepo) Close() error {
 	return nil
 }
 
+// UseIDGenerator sets the generator of the IDs of new users.
+func (aur *AuthUserRepo) UseIDGenerator(gen jelly.IDGenerator) {
+	aur.ids = gen
+}
+
 func (aur *AuthUserRepo) Create(ctx context.Context, u jelly.AuthUser) (jelly.AuthUser, error) {
-	newUUID, err := uuid.NewRandom()
+	newUUID, err := jelly.NewID(aur.ids)
 	if err != nil {
 		return jelly.AuthUser{}, fmt.Errorf("could not generate ID: %w", err)
 	}
 
 	user := authuserdao.NewUserFromAuthUser(u)
 	user.ID = newUUID
+	user.Archived = db.Timestamp{}
+	user.Version = 1
+	if tenantID, ok := jelly.TenantFromContext(ctx); ok && user.TenantID == "" {
+		user.TenantID = tenantID
+	}
 
 	// make sure it's not already in the DB
 	if _, ok := aur.byUsernameIndex[user.Username]; ok {
@@ -54,12 +72,14 @@ func (aur *AuthUserRepo) Create(ctx context.Context, u jelly.AuthUser) (jelly.Au
 }
 
 func (aur *AuthUserRepo) GetAll(ctx context.Context) ([]jelly.AuthUser, error) {
-	all := make([]jelly.AuthUser, len(aur.users))
+	tenantID, _ := jelly.TenantFromContext(ctx)
+	withArchived := jelly.ArchivedIncluded(ctx)
 
-	i := 0
+	all := make([]jelly.AuthUser, 0, len(aur.users))
 	for k := range aur.users {
-		all[i] = aur.users[k].AuthUser()
-		i++
+		if aur.users[k].InTenant(tenantID) && (withArchived || !aur.users[k].IsArchived()) {
+			all = append(all, aur.users[k].AuthUser())
+		}
 	}
 
 	all = jelsort.By(all, func(l, r jelly.AuthUser) bool {
@@ -71,11 +91,20 @@ func (aur *AuthUserRepo) GetAll(ctx context.Context) ([]jelly.AuthUser, error) {
 
 func (aur *AuthUserRepo) Update(ctx context.Context, id uuid.UUID, u jelly.AuthUser) (jelly.AuthUser, error) {
 	existing, ok := aur.users[id]
-	if !ok {
+	if !ok || !aur.visible(ctx, existing) {
 		return jelly.AuthUser{}, jelly.ErrDBNotFound
 	}
+	if u.Version != 0 && u.Version != existing.Version {
+		return jelly.AuthUser{}, jelly.ErrDBConflict
+	}
 	user := authuserdao.NewUserFromAuthUser(u)
 
+	// tenant cannot be changed once set, and archiving is only changed by
+	// Archive and Restore
+	user.TenantID = existing.TenantID
+	user.Archived = existing.Archived
+	user.Version = existing.Version + 1
+
 	// check for conflicts on this table only
 	// (inmem does not support enforcement of foreign keys)
 	if user.Username != existing.Username {
@@ -102,7 +131,7 @@ func (aur *AuthUserRepo) Update(ctx context.Context, id uuid.UUID, u jelly.AuthU
 
 func (aur *AuthUserRepo) Get(ctx context.Context, id uuid.UUID) (jelly.AuthUser, error) {
 	user, ok := aur.users[id]
-	if !ok {
+	if !ok || !aur.visible(ctx, user) {
 		return jelly.AuthUser{}, jelly.ErrDBNotFound
 	}
 
@@ -111,7 +140,7 @@ func (aur *AuthUserRepo) Get(ctx context.Context, id uuid.UUID) (jelly.AuthUser,
 
 func (aur *AuthUserRepo) GetByUsername(ctx context.Context, username string) (jelly.AuthUser, error) {
 	userID, ok := aur.byUsernameIndex[username]
-	if !ok {
+	if !ok || !aur.visible(ctx, aur.users[userID]) {
 		return jelly.AuthUser{}, jelly.ErrDBNotFound
 	}
 
@@ -119,13 +148,104 @@ func (aur *AuthUserRepo) GetByUsername(ctx context.Context, username string) (je
 }
 
 func (aur *AuthUserRepo) Delete(ctx context.Context, id uuid.UUID) (jelly.AuthUser, error) {
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
 	user, ok := aur.users[id]
-	if !ok {
+	if !ok || !user.InTenant(tenantID) {
 		return jelly.AuthUser{}, jelly.ErrDBNotFound
 	}
 
 	delete(aur.byUsernameIndex, user.Username)
 	delete(aur.users, user.ID)
+	aur.removed[user.TenantID] = time.Now()
+
+	return user.AuthUser(), nil
+}
+
+func (aur *AuthUserRepo) Archive(ctx context.Context, id uuid.UUID) (jelly.AuthUser, error) {
+	user, ok := aur.users[id]
+	if !ok || !aur.visible(ctx, user) || user.IsArchived() {
+		return jelly.AuthUser{}, jelly.ErrDBNotFound
+	}
+
+	now := db.Timestamp(time.Now())
+	user.Archived = now
+	user.Modified = now
+	user.Version++
+	aur.users[id] = user
+
+	return user.AuthUser(), nil
+}
+
+func (aur *AuthUserRepo) Restore(ctx context.Context, id uuid.UUID) (jelly.AuthUser, error) {
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
+	user, ok := aur.users[id]
+	if !ok || !user.InTenant(tenantID) || !user.IsArchived() {
+		return jelly.AuthUser{}, jelly.ErrDBNotFound
+	}
+
+	user.Archived = db.Timestamp{}
+	user.Modified = db.Timestamp(time.Now())
+	user.Version++
+	aur.users[id] = user
 
 	return user.AuthUser(), nil
 }
+
+func (aur *AuthUserRepo) DeleteArchivedBefore(ctx context.Context, t time.Time) ([]jelly.AuthUser, error) {
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
+	var deleted []jelly.AuthUser
+	for id, user := range aur.users {
+		if !user.InTenant(tenantID) || !user.IsArchived() || !user.Archived.Time().Before(t) {
+			continue
+		}
+
+		delete(aur.byUsernameIndex, user.Username)
+		delete(aur.users, id)
+		aur.removed[user.TenantID] = time.Now()
+		deleted = append(deleted, user.AuthUser())
+	}
+
+	deleted = jelsort.By(deleted, func(l, r jelly.AuthUser) bool {
+		return l.ID.String() < r.ID.String()
+	})
+
+	return deleted, nil
+}
+
+// MaxModified returns the latest time that a user in the tenant of ctx was
+// created, modified, or removed. Archived users are always considered, as
+// archiving one removes it from the users that GetAll gives unless archived
+// users are included. filter must be nil.
+func (aur *AuthUserRepo) MaxModified(ctx context.Context, filter interface{}) (time.Time, error) {
+	if filter != nil {
+		return time.Time{}, jelly.NewError(fmt.Sprintf("unsupported filter type %T", filter), jelly.ErrBadArgument)
+	}
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
+	var max time.Time
+	for _, user := range aur.users {
+		if user.InTenant(tenantID) && user.Modified.Time().After(max) {
+			max = user.Modified.Time()
+		}
+	}
+	for userTenant, removed := range aur.removed {
+		if (tenantID == "" || userTenant == tenantID) && removed.After(max) {
+			max = removed
+		}
+	}
+
+	return max, nil
+}
+
+// visible returns whether user can be accessed by operations given ctx, based
+// on its current tenant and whether archived users are included.
+func (aur *AuthUserRepo) visible(ctx context.Context, user authuserdao.User) bool {
+	tenantID, _ := jelly.TenantFromContext(ctx)
+	if !user.InTenant(tenantID) {
+		return false
+	}
+	return jelly.ArchivedIncluded(ctx) || !user.IsArchived()
+}
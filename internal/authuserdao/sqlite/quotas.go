@@ -0,0 +1,99 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/dekarrin/jelly"
+)
+
+type QuotasDB struct {
+	DB *sql.DB
+}
+
+func (repo *QuotasDB) init() error {
+	_, err := repo.DB.Exec(`CREATE TABLE IF NOT EXISTS quota_usage (
+		quota TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		period INTEGER NOT NULL,
+		used INTEGER NOT NULL,
+		PRIMARY KEY (quota, user_id, period)
+	);`)
+	if err != nil {
+		return jelly.WrapDBError(err)
+	}
+
+	return nil
+}
+
+func (repo *QuotasDB) Add(ctx context.Context, key jelly.QuotaKey, amount int64, limit int64) (int64, error) {
+	period := quotaPeriod(key)
+
+	_, err := repo.DB.ExecContext(ctx, `INSERT INTO quota_usage (quota, user_id, period, used) VALUES (?, ?, ?, 0) ON CONFLICT DO NOTHING;`,
+		key.Quota,
+		key.UserID,
+		period,
+	)
+	if err != nil {
+		return 0, jelly.WrapDBError(err)
+	}
+
+	// the limit is checked in the same statement that updates the usage so
+	// that concurrent calls cannot both use the last of the quota.
+	var used int64
+	row := repo.DB.QueryRowContext(ctx, `UPDATE quota_usage SET used=MAX(used + ?, 0) WHERE quota=? AND user_id=? AND period=? AND (? <= 0 OR used + ? <= ?) RETURNING used;`,
+		amount,
+		key.Quota,
+		key.UserID,
+		period,
+		amount,
+		amount,
+		limit,
+	)
+	err = row.Scan(&used)
+	if errors.Is(err, sql.ErrNoRows) {
+		used, err = repo.Usage(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		return used, jelly.ErrQuotaExceeded
+	}
+	if err != nil {
+		return 0, jelly.WrapDBError(err)
+	}
+
+	return used, nil
+}
+
+func (repo *QuotasDB) Usage(ctx context.Context, key jelly.QuotaKey) (int64, error) {
+	var used int64
+
+	row := repo.DB.QueryRowContext(ctx, `SELECT used FROM quota_usage WHERE quota=? AND user_id=? AND period=?;`,
+		key.Quota,
+		key.UserID,
+		quotaPeriod(key),
+	)
+	err := row.Scan(&used)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, jelly.WrapDBError(err)
+	}
+
+	return used, nil
+}
+
+func (repo *QuotasDB) Close() error {
+	return repo.DB.Close()
+}
+
+// quotaPeriod gives the period of key as stored in the period column; quotas
+// that never reset have a period of 0.
+func quotaPeriod(key jelly.QuotaKey) int64 {
+	if key.Period.IsZero() {
+		return 0
+	}
+	return key.Period.Unix()
+}
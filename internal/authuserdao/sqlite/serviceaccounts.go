@@ -0,0 +1,223 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/db"
+	"github.com/dekarrin/jelly/internal/authuserdao"
+	"github.com/google/uuid"
+)
+
+type ServiceAccountsDB struct {
+	DB *sql.DB
+
+	// ids generates the IDs of new entities. If nil, random UUIDs are used.
+	ids jelly.IDGenerator
+}
+
+func (repo *ServiceAccountsDB) init() error {
+	_, err := repo.DB.Exec(`CREATE TABLE IF NOT EXISTS service_accounts (
+		id TEXT NOT NULL PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		scopes TEXT NOT NULL,
+		created INTEGER NOT NULL,
+		modified INTEGER NOT NULL,
+		last_used_time INTEGER NOT NULL
+	);`)
+	if err != nil {
+		return jelly.WrapDBError(err)
+	}
+
+	return nil
+}
+
+// scopes are stored space-separated, the same format used for them in tokens.
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func splitScopes(s string) []string {
+	return strings.Fields(s)
+}
+
+func (repo *ServiceAccountsDB) Create(ctx context.Context, sa jelly.ServiceAccount) (jelly.ServiceAccount, error) {
+	newUUID, err := jelly.NewID(repo.ids)
+	if err != nil {
+		return jelly.ServiceAccount{}, fmt.Errorf("could not generate ID: %w", err)
+	}
+
+	stmt, err := repo.DB.Prepare(`INSERT INTO service_accounts (id, name, description, secret, scopes, created, modified, last_used_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return jelly.ServiceAccount{}, jelly.WrapDBError(err)
+	}
+
+	now := db.Timestamp(time.Now())
+	acct := authuserdao.NewServiceAccountFromJelly(sa)
+	_, err = stmt.ExecContext(
+		ctx,
+		newUUID,
+		acct.Name,
+		acct.Description,
+		acct.Secret,
+		joinScopes(acct.Scopes),
+		now,
+		now,
+		db.Timestamp{},
+	)
+	if err != nil {
+		return jelly.ServiceAccount{}, jelly.WrapDBError(err)
+	}
+
+	return repo.Get(ctx, newUUID)
+}
+
+func (repo *ServiceAccountsDB) GetAll(ctx context.Context) ([]jelly.ServiceAccount, error) {
+	rows, err := repo.DB.QueryContext(ctx, `SELECT id, name, description, secret, scopes, created, modified, last_used_time FROM service_accounts;`)
+	if err != nil {
+		return nil, jelly.WrapDBError(err)
+	}
+	defer rows.Close()
+
+	var all []jelly.ServiceAccount
+
+	for rows.Next() {
+		var acct authuserdao.ServiceAccount
+		var scopes string
+		err = rows.Scan(
+			&acct.ID,
+			&acct.Name,
+			&acct.Description,
+			&acct.Secret,
+			&scopes,
+			&acct.Created,
+			&acct.Modified,
+			&acct.LastUsed,
+		)
+
+		if err != nil {
+			return nil, jelly.WrapDBError(err)
+		}
+
+		acct.Scopes = splitScopes(scopes)
+		all = append(all, acct.ServiceAccount())
+	}
+
+	if err := rows.Err(); err != nil {
+		return all, jelly.WrapDBError(err)
+	}
+
+	return all, nil
+}
+
+func (repo *ServiceAccountsDB) Update(ctx context.Context, id uuid.UUID, sa jelly.ServiceAccount) (jelly.ServiceAccount, error) {
+	acct := authuserdao.NewServiceAccountFromJelly(sa)
+
+	// deliberately not updating created or id
+	res, err := repo.DB.ExecContext(ctx, `UPDATE service_accounts SET name=?, description=?, secret=?, scopes=?, last_used_time=?, modified=? WHERE id=?;`,
+		acct.Name,
+		acct.Description,
+		acct.Secret,
+		joinScopes(acct.Scopes),
+		acct.LastUsed,
+		db.Timestamp(time.Now()),
+		id,
+	)
+	if err != nil {
+		return jelly.ServiceAccount{}, jelly.WrapDBError(err)
+	}
+	rowsAff, err := res.RowsAffected()
+	if err != nil {
+		return jelly.ServiceAccount{}, jelly.WrapDBError(err)
+	}
+	if rowsAff < 1 {
+		return jelly.ServiceAccount{}, jelly.ErrDBNotFound
+	}
+
+	return repo.Get(ctx, id)
+}
+
+func (repo *ServiceAccountsDB) GetByName(ctx context.Context, name string) (jelly.ServiceAccount, error) {
+	acct := authuserdao.ServiceAccount{
+		Name: name,
+	}
+	var scopes string
+
+	row := repo.DB.QueryRowContext(ctx, `SELECT id, description, secret, scopes, created, modified, last_used_time FROM service_accounts WHERE name = ?;`,
+		name,
+	)
+	err := row.Scan(
+		&acct.ID,
+		&acct.Description,
+		&acct.Secret,
+		&scopes,
+		&acct.Created,
+		&acct.Modified,
+		&acct.LastUsed,
+	)
+
+	if err != nil {
+		return acct.ServiceAccount(), jelly.WrapDBError(err)
+	}
+
+	acct.Scopes = splitScopes(scopes)
+	return acct.ServiceAccount(), nil
+}
+
+func (repo *ServiceAccountsDB) Get(ctx context.Context, id uuid.UUID) (jelly.ServiceAccount, error) {
+	acct := authuserdao.ServiceAccount{
+		ID: id,
+	}
+	var scopes string
+
+	row := repo.DB.QueryRowContext(ctx, `SELECT name, description, secret, scopes, created, modified, last_used_time FROM service_accounts WHERE id = ?;`,
+		id,
+	)
+	err := row.Scan(
+		&acct.Name,
+		&acct.Description,
+		&acct.Secret,
+		&scopes,
+		&acct.Created,
+		&acct.Modified,
+		&acct.LastUsed,
+	)
+
+	if err != nil {
+		return acct.ServiceAccount(), jelly.WrapDBError(err)
+	}
+
+	acct.Scopes = splitScopes(scopes)
+	return acct.ServiceAccount(), nil
+}
+
+func (repo *ServiceAccountsDB) Delete(ctx context.Context, id uuid.UUID) (jelly.ServiceAccount, error) {
+	curVal, err := repo.Get(ctx, id)
+	if err != nil {
+		return curVal, err
+	}
+
+	res, err := repo.DB.ExecContext(ctx, `DELETE FROM service_accounts WHERE id = ?`, id)
+	if err != nil {
+		return curVal, jelly.WrapDBError(err)
+	}
+	rowsAff, err := res.RowsAffected()
+	if err != nil {
+		return curVal, jelly.WrapDBError(err)
+	}
+	if rowsAff < 1 {
+		return curVal, jelly.ErrDBNotFound
+	}
+
+	return curVal, nil
+}
+
+func (repo *ServiceAccountsDB) Close() error {
+	return repo.DB.Close()
+}
@@ -0,0 +1,309 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/db"
+	"github.com/dekarrin/jelly/internal/authuserdao"
+	"github.com/google/uuid"
+)
+
+type SessionsDB struct {
+	DB *sql.DB
+
+	// ids generates the IDs of new entities. If nil, random UUIDs are used.
+	ids jelly.IDGenerator
+}
+
+func (repo *SessionsDB) init() error {
+	_, err := repo.DB.Exec(`CREATE TABLE IF NOT EXISTS sessions (
+		id TEXT NOT NULL PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		ip TEXT NOT NULL,
+		user_agent TEXT NOT NULL,
+		created INTEGER NOT NULL,
+		expires INTEGER NOT NULL
+	);`)
+	if err != nil {
+		return jelly.WrapDBError(err)
+	}
+
+	return nil
+}
+
+func (repo *SessionsDB) Create(ctx context.Context, s jelly.Session) (jelly.Session, error) {
+	newUUID, err := jelly.NewID(repo.ids)
+	if err != nil {
+		return jelly.Session{}, fmt.Errorf("could not generate ID: %w", err)
+	}
+
+	stmt, err := repo.DB.Prepare(`INSERT INTO sessions (id, user_id, ip, user_agent, created, expires) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return jelly.Session{}, jelly.WrapDBError(err)
+	}
+
+	sess := authuserdao.NewSessionFromJelly(s)
+	_, err = stmt.ExecContext(
+		ctx,
+		newUUID,
+		sess.UserID,
+		sess.IP,
+		sess.UserAgent,
+		db.Timestamp(time.Now()),
+		sess.Expires,
+	)
+	if err != nil {
+		return jelly.Session{}, jelly.WrapDBError(err)
+	}
+
+	return repo.Get(ctx, newUUID)
+}
+
+func (repo *SessionsDB) Get(ctx context.Context, id uuid.UUID) (jelly.Session, error) {
+	sess := authuserdao.Session{
+		ID: id,
+	}
+
+	row := repo.DB.QueryRowContext(ctx, `SELECT user_id, ip, user_agent, created, expires FROM sessions WHERE id = ?;`,
+		id,
+	)
+	err := row.Scan(
+		&sess.UserID,
+		&sess.IP,
+		&sess.UserAgent,
+		&sess.Created,
+		&sess.Expires,
+	)
+
+	if err != nil {
+		return sess.Session(), jelly.WrapDBError(err)
+	}
+
+	return sess.Session(), nil
+}
+
+func (repo *SessionsDB) GetAllByUser(ctx context.Context, userID uuid.UUID) ([]jelly.Session, error) {
+	rows, err := repo.DB.QueryContext(ctx, `SELECT id, user_id, ip, user_agent, created, expires FROM sessions WHERE user_id = ? ORDER BY created DESC, id;`,
+		userID,
+	)
+	if err != nil {
+		return nil, jelly.WrapDBError(err)
+	}
+	defer rows.Close()
+
+	all := []jelly.Session{}
+
+	for rows.Next() {
+		var sess authuserdao.Session
+		err = rows.Scan(
+			&sess.ID,
+			&sess.UserID,
+			&sess.IP,
+			&sess.UserAgent,
+			&sess.Created,
+			&sess.Expires,
+		)
+
+		if err != nil {
+			return nil, jelly.WrapDBError(err)
+		}
+
+		all = append(all, sess.Session())
+	}
+
+	if err := rows.Err(); err != nil {
+		return all, jelly.WrapDBError(err)
+	}
+
+	return all, nil
+}
+
+func (repo *SessionsDB) Update(ctx context.Context, id uuid.UUID, s jelly.Session) (jelly.Session, error) {
+	sess := authuserdao.NewSessionFromJelly(s)
+
+	// deliberately not updating id, user_id, or created
+	res, err := repo.DB.ExecContext(ctx, `UPDATE sessions SET ip=?, user_agent=?, expires=? WHERE id=?;`,
+		sess.IP,
+		sess.UserAgent,
+		sess.Expires,
+		id,
+	)
+	if err != nil {
+		return jelly.Session{}, jelly.WrapDBError(err)
+	}
+	rowsAff, err := res.RowsAffected()
+	if err != nil {
+		return jelly.Session{}, jelly.WrapDBError(err)
+	}
+	if rowsAff < 1 {
+		return jelly.Session{}, jelly.ErrDBNotFound
+	}
+
+	return repo.Get(ctx, id)
+}
+
+func (repo *SessionsDB) Delete(ctx context.Context, id uuid.UUID) (jelly.Session, error) {
+	curVal, err := repo.Get(ctx, id)
+	if err != nil {
+		return curVal, err
+	}
+
+	res, err := repo.DB.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, id)
+	if err != nil {
+		return curVal, jelly.WrapDBError(err)
+	}
+	rowsAff, err := res.RowsAffected()
+	if err != nil {
+		return curVal, jelly.WrapDBError(err)
+	}
+	if rowsAff < 1 {
+		return curVal, jelly.ErrDBNotFound
+	}
+
+	return curVal, nil
+}
+
+func (repo *SessionsDB) DeleteAllByUser(ctx context.Context, userID uuid.UUID) ([]jelly.Session, error) {
+	curVals, err := repo.GetAllByUser(ctx, userID)
+	if err != nil {
+		return curVals, err
+	}
+
+	_, err = repo.DB.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?`, userID)
+	if err != nil {
+		return curVals, jelly.WrapDBError(err)
+	}
+
+	return curVals, nil
+}
+
+func (repo *SessionsDB) Close() error {
+	return repo.DB.Close()
+}
+
+type LoginAttemptsDB struct {
+	DB *sql.DB
+
+	// ids generates the IDs of new entities. If nil, random UUIDs are used.
+	ids jelly.IDGenerator
+}
+
+func (repo *LoginAttemptsDB) init() error {
+	_, err := repo.DB.Exec(`CREATE TABLE IF NOT EXISTS login_attempts (
+		id TEXT NOT NULL PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		username TEXT NOT NULL,
+		ip TEXT NOT NULL,
+		user_agent TEXT NOT NULL,
+		success INTEGER NOT NULL,
+		time INTEGER NOT NULL,
+		tenant_id TEXT NOT NULL DEFAULT ''
+	);`)
+	if err != nil {
+		return jelly.WrapDBError(err)
+	}
+
+	return nil
+}
+
+func (repo *LoginAttemptsDB) Create(ctx context.Context, la jelly.LoginAttempt) (jelly.LoginAttempt, error) {
+	newUUID, err := jelly.NewID(repo.ids)
+	if err != nil {
+		return jelly.LoginAttempt{}, fmt.Errorf("could not generate ID: %w", err)
+	}
+
+	stmt, err := repo.DB.Prepare(`INSERT INTO login_attempts (id, user_id, username, ip, user_agent, success, time, tenant_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return jelly.LoginAttempt{}, jelly.WrapDBError(err)
+	}
+
+	attempt := authuserdao.NewLoginAttemptFromJelly(la)
+	attempt.ID = newUUID
+	if tenantID, ok := jelly.TenantFromContext(ctx); ok && attempt.TenantID == "" {
+		attempt.TenantID = tenantID
+	}
+	_, err = stmt.ExecContext(
+		ctx,
+		attempt.ID,
+		attempt.UserID,
+		attempt.Username,
+		attempt.IP,
+		attempt.UserAgent,
+		attempt.Success,
+		attempt.Time,
+		attempt.TenantID,
+	)
+	if err != nil {
+		return jelly.LoginAttempt{}, jelly.WrapDBError(err)
+	}
+
+	return attempt.LoginAttempt(), nil
+}
+
+func (repo *LoginAttemptsDB) GetAll(ctx context.Context) ([]jelly.LoginAttempt, error) {
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
+	return repo.query(ctx, `SELECT id, user_id, username, ip, user_agent, success, time, tenant_id FROM login_attempts WHERE (? = '' OR tenant_id = ?) ORDER BY time DESC, id;`,
+		tenantID, tenantID,
+	)
+}
+
+func (repo *LoginAttemptsDB) GetAllByUser(ctx context.Context, userID uuid.UUID) ([]jelly.LoginAttempt, error) {
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
+	return repo.query(ctx, `SELECT id, user_id, username, ip, user_agent, success, time, tenant_id FROM login_attempts WHERE user_id = ? AND (? = '' OR tenant_id = ?) ORDER BY time DESC, id;`,
+		userID, tenantID, tenantID,
+	)
+}
+
+func (repo *LoginAttemptsDB) query(ctx context.Context, query string, args ...interface{}) ([]jelly.LoginAttempt, error) {
+	rows, err := repo.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, jelly.WrapDBError(err)
+	}
+	defer rows.Close()
+
+	all := []jelly.LoginAttempt{}
+
+	for rows.Next() {
+		var attempt authuserdao.LoginAttempt
+		err = rows.Scan(
+			&attempt.ID,
+			&attempt.UserID,
+			&attempt.Username,
+			&attempt.IP,
+			&attempt.UserAgent,
+			&attempt.Success,
+			&attempt.Time,
+			&attempt.TenantID,
+		)
+
+		if err != nil {
+			return nil, jelly.WrapDBError(err)
+		}
+
+		all = append(all, attempt.LoginAttempt())
+	}
+
+	if err := rows.Err(); err != nil {
+		return all, jelly.WrapDBError(err)
+	}
+
+	return all, nil
+}
+
+func (repo *LoginAttemptsDB) DeleteBefore(ctx context.Context, t time.Time) error {
+	_, err := repo.DB.ExecContext(ctx, `DELETE FROM login_attempts WHERE time < ?`, db.Timestamp(t))
+	if err != nil {
+		return jelly.WrapDBError(err)
+	}
+	return nil
+}
+
+func (repo *LoginAttemptsDB) Close() error {
+	return repo.DB.Close()
+}
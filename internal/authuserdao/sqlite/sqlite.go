@@ -1,6 +1,7 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"path/filepath"
@@ -18,7 +19,12 @@ type AuthUserStore struct {
 	db         *sql.DB
 	dbFilename string
 
-	users *AuthUsersDB
+	users    *AuthUsersDB
+	accounts *ServiceAccountsDB
+	sessions *SessionsDB
+	attempts *LoginAttemptsDB
+	twoFacts *TwoFactorsDB
+	quotas   *QuotasDB
 }
 
 func NewAuthUserStore(storageDir string) (*AuthUserStore, error) {
@@ -37,6 +43,21 @@ func NewAuthUserStore(storageDir string) (*AuthUserStore, error) {
 	st.users = &AuthUsersDB{DB: st.db}
 	st.users.init()
 
+	st.accounts = &ServiceAccountsDB{DB: st.db}
+	st.accounts.init()
+
+	st.sessions = &SessionsDB{DB: st.db}
+	st.sessions.init()
+
+	st.attempts = &LoginAttemptsDB{DB: st.db}
+	st.attempts.init()
+
+	st.twoFacts = &TwoFactorsDB{DB: st.db}
+	st.twoFacts.init()
+
+	st.quotas = &QuotasDB{DB: st.db}
+	st.quotas.init()
+
 	return st, nil
 }
 
@@ -44,6 +65,49 @@ func (aus *AuthUserStore) AuthUsers() jelly.AuthUserRepo {
 	return aus.users
 }
 
+func (aus *AuthUserStore) ServiceAccounts() jelly.ServiceAccountRepo {
+	return aus.accounts
+}
+
+func (aus *AuthUserStore) Sessions() jelly.SessionRepo {
+	return aus.sessions
+}
+
+func (aus *AuthUserStore) LoginAttempts() jelly.LoginAttemptRepo {
+	return aus.attempts
+}
+
+func (aus *AuthUserStore) TwoFactors() jelly.TwoFactorRepo {
+	return aus.twoFacts
+}
+
+func (aus *AuthUserStore) Quotas() jelly.QuotaRepo {
+	return aus.quotas
+}
+
+// UseIDGenerator sets the generator of the IDs of new users, service
+// accounts, sessions, and login attempts.
+func (aus *AuthUserStore) UseIDGenerator(gen jelly.IDGenerator) {
+	aus.users.ids = gen
+	aus.accounts.ids = gen
+	aus.sessions.ids = gen
+	aus.attempts.ids = gen
+}
+
+// UseFieldCipher sets the FieldCipher that the emails of users are encrypted
+// with.
+func (aus *AuthUserStore) UseFieldCipher(fc *jelly.FieldCipher) {
+	aus.users.crypt = fc
+}
+
+// Ping checks that the database file can be reached.
+func (aus *AuthUserStore) Ping(ctx context.Context) error {
+	if err := aus.db.PingContext(ctx); err != nil {
+		return jelly.WrapDBError(err)
+	}
+	return nil
+}
+
 func (aus *AuthUserStore) Close() error {
 	mainDBErr := aus.db.Close()
 
@@ -0,0 +1,170 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/db"
+	"github.com/dekarrin/jelly/internal/authuserdao"
+	"github.com/google/uuid"
+)
+
+type TwoFactorsDB struct {
+	DB *sql.DB
+}
+
+func (repo *TwoFactorsDB) init() error {
+	_, err := repo.DB.Exec(`CREATE TABLE IF NOT EXISTS two_factors (
+		user_id TEXT NOT NULL PRIMARY KEY,
+		secret TEXT NOT NULL,
+		confirmed INTEGER NOT NULL,
+		recovery_codes TEXT NOT NULL,
+		last_step INTEGER NOT NULL,
+		failed_attempts INTEGER NOT NULL DEFAULT 0,
+		version INTEGER NOT NULL DEFAULT 1,
+		created INTEGER NOT NULL,
+		modified INTEGER NOT NULL
+	);`)
+	if err != nil {
+		return jelly.WrapDBError(err)
+	}
+
+	// tables created by earlier versions will not have the newer columns
+	migrations := []struct {
+		column string
+		stmt   string
+	}{
+		{"failed_attempts", `ALTER TABLE two_factors ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0;`},
+		{"version", `ALTER TABLE two_factors ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`},
+	}
+	for _, m := range migrations {
+		has, err := hasColumn(repo.DB, "two_factors", m.column)
+		if err != nil {
+			return err
+		}
+		if !has {
+			_, err = repo.DB.Exec(m.stmt)
+			if err != nil {
+				return jelly.WrapDBError(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (repo *TwoFactorsDB) Create(ctx context.Context, tf jelly.TwoFactor) (jelly.TwoFactor, error) {
+	stmt, err := repo.DB.Prepare(`INSERT INTO two_factors (user_id, secret, confirmed, recovery_codes, last_step, failed_attempts, version, created, modified) VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?)`)
+	if err != nil {
+		return jelly.TwoFactor{}, jelly.WrapDBError(err)
+	}
+
+	now := db.Timestamp(time.Now())
+	twoFactor := authuserdao.NewTwoFactorFromJelly(tf)
+	_, err = stmt.ExecContext(
+		ctx,
+		twoFactor.UserID,
+		twoFactor.Secret,
+		twoFactor.Confirmed,
+		strings.Join(twoFactor.RecoveryCodes, " "),
+		twoFactor.LastStep,
+		twoFactor.FailedAttempts,
+		now,
+		now,
+	)
+	if err != nil {
+		return jelly.TwoFactor{}, jelly.WrapDBError(err)
+	}
+
+	return repo.Get(ctx, twoFactor.UserID)
+}
+
+func (repo *TwoFactorsDB) Get(ctx context.Context, userID uuid.UUID) (jelly.TwoFactor, error) {
+	twoFactor := authuserdao.TwoFactor{
+		UserID: userID,
+	}
+	var codes string
+
+	row := repo.DB.QueryRowContext(ctx, `SELECT secret, confirmed, recovery_codes, last_step, failed_attempts, version, created, modified FROM two_factors WHERE user_id = ?;`,
+		userID,
+	)
+	err := row.Scan(
+		&twoFactor.Secret,
+		&twoFactor.Confirmed,
+		&codes,
+		&twoFactor.LastStep,
+		&twoFactor.FailedAttempts,
+		&twoFactor.Version,
+		&twoFactor.Created,
+		&twoFactor.Modified,
+	)
+
+	if err != nil {
+		return twoFactor.TwoFactor(), jelly.WrapDBError(err)
+	}
+
+	twoFactor.RecoveryCodes = strings.Fields(codes)
+	return twoFactor.TwoFactor(), nil
+}
+
+func (repo *TwoFactorsDB) Update(ctx context.Context, userID uuid.UUID, tf jelly.TwoFactor) (jelly.TwoFactor, error) {
+	twoFactor := authuserdao.NewTwoFactorFromJelly(tf)
+
+	// deliberately not updating user_id or created
+	res, err := repo.DB.ExecContext(ctx, `UPDATE two_factors SET secret=?, confirmed=?, recovery_codes=?, last_step=?, failed_attempts=?, modified=?, version=version+1 WHERE user_id=? AND (? = 0 OR version = ?);`,
+		twoFactor.Secret,
+		twoFactor.Confirmed,
+		strings.Join(twoFactor.RecoveryCodes, " "),
+		twoFactor.LastStep,
+		twoFactor.FailedAttempts,
+		db.Timestamp(time.Now()),
+		userID,
+		twoFactor.Version, twoFactor.Version,
+	)
+	if err != nil {
+		return jelly.TwoFactor{}, jelly.WrapDBError(err)
+	}
+	rowsAff, err := res.RowsAffected()
+	if err != nil {
+		return jelly.TwoFactor{}, jelly.WrapDBError(err)
+	}
+	if rowsAff < 1 {
+		if twoFactor.Version != 0 {
+			// find out if it was the version that did not match
+			if _, err := repo.Get(ctx, userID); err == nil {
+				return jelly.TwoFactor{}, jelly.ErrDBConflict
+			}
+		}
+		return jelly.TwoFactor{}, jelly.ErrDBNotFound
+	}
+
+	return repo.Get(ctx, userID)
+}
+
+func (repo *TwoFactorsDB) Delete(ctx context.Context, userID uuid.UUID) (jelly.TwoFactor, error) {
+	curVal, err := repo.Get(ctx, userID)
+	if err != nil {
+		return curVal, err
+	}
+
+	res, err := repo.DB.ExecContext(ctx, `DELETE FROM two_factors WHERE user_id = ?`, userID)
+	if err != nil {
+		return curVal, jelly.WrapDBError(err)
+	}
+	rowsAff, err := res.RowsAffected()
+	if err != nil {
+		return curVal, jelly.WrapDBError(err)
+	}
+	if rowsAff < 1 {
+		return curVal, jelly.ErrDBNotFound
+	}
+
+	return curVal, nil
+}
+
+func (repo *TwoFactorsDB) Close() error {
+	return repo.DB.Close()
+}
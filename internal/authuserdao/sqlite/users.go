@@ -14,6 +14,34 @@ import (
 
 type AuthUsersDB struct {
 	DB *sql.DB
+
+	// tx is the transaction that queries are run in. If nil, they are run
+	// directly on DB.
+	tx *sql.Tx
+
+	// ids generates the IDs of new entities. If nil, random UUIDs are used.
+	ids jelly.IDGenerator
+
+	// crypt encrypts the emails of users. If nil, they are stored as-is.
+	crypt *jelly.FieldCipher
+}
+
+// dbtx is the subset of the methods of sql.DB and sql.Tx that AuthUsersDB
+// runs queries with.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn returns what queries should be run on; the current transaction if
+// there is one, or the DB if not.
+func (repo *AuthUsersDB) conn() dbtx {
+	if repo.tx != nil {
+		return repo.tx
+	}
+	return repo.DB
 }
 
 func (repo *AuthUsersDB) init() error {
@@ -26,49 +54,123 @@ func (repo *AuthUsersDB) init() error {
 		created INTEGER NOT NULL,
 		modified INTEGER NOT NULL,
 		last_logout_time INTEGER NOT NULL,
-		last_login_time INTEGER NOT NULL
+		last_login_time INTEGER NOT NULL,
+		tenant_id TEXT NOT NULL DEFAULT '',
+		attributes TEXT NOT NULL DEFAULT '{}',
+		archived INTEGER NOT NULL DEFAULT 0,
+		version INTEGER NOT NULL DEFAULT 1
 	);`)
 	if err != nil {
 		return jelly.WrapDBError(err)
 	}
 
+	// the time that a user was last removed from each tenant, for MaxModified
+	_, err = repo.DB.Exec(`CREATE TABLE IF NOT EXISTS user_removals (
+		tenant_id TEXT NOT NULL PRIMARY KEY,
+		removed INTEGER NOT NULL
+	);`)
+	if err != nil {
+		return jelly.WrapDBError(err)
+	}
+
+	// tables created by earlier versions will not have the newer columns
+	migrations := []struct {
+		column string
+		stmt   string
+	}{
+		{"tenant_id", `ALTER TABLE users ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';`},
+		{"attributes", `ALTER TABLE users ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}';`},
+		{"archived", `ALTER TABLE users ADD COLUMN archived INTEGER NOT NULL DEFAULT 0;`},
+		{"version", `ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`},
+	}
+	for _, m := range migrations {
+		has, err := hasColumn(repo.DB, "users", m.column)
+		if err != nil {
+			return err
+		}
+		if !has {
+			_, err = repo.DB.Exec(m.stmt)
+			if err != nil {
+				return jelly.WrapDBError(err)
+			}
+		}
+	}
+
 	return nil
 }
 
+// hasColumn returns whether the given table has a column with the given name.
+func hasColumn(conn *sql.DB, table, name string) (bool, error) {
+	rows, err := conn.Query(`SELECT name FROM pragma_table_info(?);`, table)
+	if err != nil {
+		return false, jelly.WrapDBError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return false, jelly.WrapDBError(err)
+		}
+		if col == name {
+			return true, nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return false, jelly.WrapDBError(err)
+	}
+	return false, nil
+}
+
 func (repo *AuthUsersDB) Create(ctx context.Context, u jelly.AuthUser) (jelly.AuthUser, error) {
-	newUUID, err := uuid.NewRandom()
+	newUUID, err := jelly.NewID(repo.ids)
 	if err != nil {
 		return jelly.AuthUser{}, fmt.Errorf("could not generate ID: %w", err)
 	}
 
-	stmt, err := repo.DB.Prepare(`INSERT INTO users (id, username, password, role, email, created, modified, last_logout_time, last_login_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	stmt, err := repo.conn().PrepareContext(ctx, `INSERT INTO users (id, username, password, role, email, created, modified, last_logout_time, last_login_time, tenant_id, attributes) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return jelly.AuthUser{}, jelly.WrapDBError(err)
 	}
+	defer stmt.Close()
 
 	now := db.Timestamp(time.Now())
 	user := authuserdao.NewUserFromAuthUser(u)
+	if tenantID, ok := jelly.TenantFromContext(ctx); ok && user.TenantID == "" {
+		user.TenantID = tenantID
+	}
+	email, err := repo.crypt.EncryptString(user.Email.String())
+	if err != nil {
+		return jelly.AuthUser{}, fmt.Errorf("encrypt email: %w", err)
+	}
 	_, err = stmt.ExecContext(
 		ctx,
 		newUUID,
 		user.Username,
 		user.Password,
 		user.Role,
-		user.Email,
+		email,
 		now,
 		now,
 		now,
 		db.Timestamp{},
+		user.TenantID,
+		user.Attributes,
 	)
 	if err != nil {
 		return jelly.AuthUser{}, jelly.WrapDBError(err)
 	}
 
-	return repo.Get(ctx, newUUID)
+	return repo.Get(jelly.WithTenant(ctx, user.TenantID), newUUID)
 }
 
 func (repo *AuthUsersDB) GetAll(ctx context.Context) ([]jelly.AuthUser, error) {
-	rows, err := repo.DB.QueryContext(ctx, `SELECT id, username, password, role, email, created, modified, last_logout_time, last_login_time FROM users;`)
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
+	rows, err := repo.conn().QueryContext(ctx, `SELECT id, username, password, role, email, created, modified, last_logout_time, last_login_time, tenant_id, attributes, archived, version FROM users WHERE (? = '' OR tenant_id = ?) AND (? OR archived = 0);`,
+		tenantID, tenantID, jelly.ArchivedIncluded(ctx),
+	)
 	if err != nil {
 		return nil, jelly.WrapDBError(err)
 	}
@@ -78,21 +180,31 @@ func (repo *AuthUsersDB) GetAll(ctx context.Context) ([]jelly.AuthUser, error) {
 
 	for rows.Next() {
 		var user authuserdao.User
+		var archived int64
+		var email string
 		err = rows.Scan(
 			&user.ID,
 			&user.Username,
 			&user.Password,
 			&user.Role,
-			&user.Email,
+			&email,
 			&user.Created,
 			&user.Modified,
 			&user.LastLogout,
 			&user.LastLogin,
+			&user.TenantID,
+			&user.Attributes,
+			&archived,
+			&user.Version,
 		)
 
 		if err != nil {
 			return nil, jelly.WrapDBError(err)
 		}
+		user.Archived = archivedTimestamp(archived)
+		if err := repo.decryptEmail(&user, email); err != nil {
+			return nil, err
+		}
 
 		all = append(all, user.AuthUser())
 	}
@@ -106,18 +218,30 @@ func (repo *AuthUsersDB) GetAll(ctx context.Context) ([]jelly.AuthUser, error) {
 
 func (repo *AuthUsersDB) Update(ctx context.Context, id uuid.UUID, u jelly.AuthUser) (jelly.AuthUser, error) {
 	user := authuserdao.NewUserFromAuthUser(u)
+	tenantID, _ := jelly.TenantFromContext(ctx)
 
-	// deliberately not updating created
-	res, err := repo.DB.ExecContext(ctx, `UPDATE users SET id=?, username=?, password=?, role=?, email=?, last_logout_time=?, last_login_time=?, modified=? WHERE id=?;`,
+	// written with the current key, which rotates emails encrypted with older
+	// ones
+	email, err := repo.crypt.EncryptString(user.Email.String())
+	if err != nil {
+		return jelly.AuthUser{}, fmt.Errorf("encrypt email: %w", err)
+	}
+
+	// deliberately not updating created, tenant_id, or archived
+	res, err := repo.conn().ExecContext(ctx, `UPDATE users SET id=?, username=?, password=?, role=?, email=?, last_logout_time=?, last_login_time=?, attributes=?, modified=?, version=version+1 WHERE id=? AND (? = '' OR tenant_id = ?) AND (? OR archived = 0) AND (? = 0 OR version = ?);`,
 		user.ID,
 		user.Username,
 		user.Password,
 		user.Role,
-		user.Email,
+		email,
 		user.LastLogout,
 		user.LastLogin,
+		user.Attributes,
 		db.Timestamp(time.Now()),
 		id,
+		tenantID, tenantID,
+		jelly.ArchivedIncluded(ctx),
+		user.Version, user.Version,
 	)
 	if err != nil {
 		return jelly.AuthUser{}, jelly.WrapDBError(err)
@@ -127,6 +251,12 @@ func (repo *AuthUsersDB) Update(ctx context.Context, id uuid.UUID, u jelly.AuthU
 		return jelly.AuthUser{}, jelly.WrapDBError(err)
 	}
 	if rowsAff < 1 {
+		if user.Version != 0 {
+			// find out if it was the version that did not match
+			if _, err := repo.Get(ctx, id); err == nil {
+				return jelly.AuthUser{}, jelly.ErrDBConflict
+			}
+		}
 		return jelly.AuthUser{}, jelly.ErrDBNotFound
 	}
 
@@ -138,23 +268,35 @@ func (repo *AuthUsersDB) GetByUsername(ctx context.Context, username string) (je
 		Username: username,
 	}
 
-	row := repo.DB.QueryRowContext(ctx, `SELECT id, password, role, email, created, modified, last_logout_time, last_login_time FROM users WHERE username = ?;`,
-		username,
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
+	var archived int64
+	var email string
+	row := repo.conn().QueryRowContext(ctx, `SELECT id, password, role, email, created, modified, last_logout_time, last_login_time, tenant_id, attributes, archived, version FROM users WHERE username = ? AND (? = '' OR tenant_id = ?) AND (? OR archived = 0);`,
+		username, tenantID, tenantID, jelly.ArchivedIncluded(ctx),
 	)
 	err := row.Scan(
 		&user.ID,
 		&user.Password,
 		&user.Role,
-		&user.Email,
+		&email,
 		&user.Created,
 		&user.Modified,
 		&user.LastLogout,
 		&user.LastLogin,
+		&user.TenantID,
+		&user.Attributes,
+		&archived,
+		&user.Version,
 	)
 
 	if err != nil {
 		return user.AuthUser(), jelly.WrapDBError(err)
 	}
+	user.Archived = archivedTimestamp(archived)
+	if err := repo.decryptEmail(&user, email); err != nil {
+		return user.AuthUser(), err
+	}
 
 	return user.AuthUser(), nil
 }
@@ -164,34 +306,47 @@ func (repo *AuthUsersDB) Get(ctx context.Context, id uuid.UUID) (jelly.AuthUser,
 		ID: id,
 	}
 
-	row := repo.DB.QueryRowContext(ctx, `SELECT username, password, role, email, created, modified, last_logout_time, last_login_time FROM users WHERE id = ?;`,
-		id,
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
+	var archived int64
+	var email string
+	row := repo.conn().QueryRowContext(ctx, `SELECT username, password, role, email, created, modified, last_logout_time, last_login_time, tenant_id, attributes, archived, version FROM users WHERE id = ? AND (? = '' OR tenant_id = ?) AND (? OR archived = 0);`,
+		id, tenantID, tenantID, jelly.ArchivedIncluded(ctx),
 	)
 	err := row.Scan(
 		&user.Username,
 		&user.Password,
 		&user.Role,
-		&user.Email,
+		&email,
 		&user.Created,
 		&user.Modified,
 		&user.LastLogout,
 		&user.LastLogin,
+		&user.TenantID,
+		&user.Attributes,
+		&archived,
+		&user.Version,
 	)
 
 	if err != nil {
 		return user.AuthUser(), jelly.WrapDBError(err)
 	}
+	user.Archived = archivedTimestamp(archived)
+	if err := repo.decryptEmail(&user, email); err != nil {
+		return user.AuthUser(), err
+	}
 
 	return user.AuthUser(), nil
 }
 
 func (repo *AuthUsersDB) Delete(ctx context.Context, id uuid.UUID) (jelly.AuthUser, error) {
-	curVal, err := repo.Get(ctx, id)
+	curVal, err := repo.Get(jelly.WithArchived(ctx), id)
 	if err != nil {
 		return curVal, err
 	}
 
-	res, err := repo.DB.ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
+	// curVal was retrieved within the tenant, so no need to check it again
+	res, err := repo.conn().ExecContext(ctx, `DELETE FROM users WHERE id = ?`, id)
 	if err != nil {
 		return curVal, jelly.WrapDBError(err)
 	}
@@ -202,10 +357,205 @@ func (repo *AuthUsersDB) Delete(ctx context.Context, id uuid.UUID) (jelly.AuthUs
 	if rowsAff < 1 {
 		return curVal, jelly.ErrDBNotFound
 	}
+	if err := repo.recordRemoval(ctx, curVal.TenantID); err != nil {
+		return curVal, err
+	}
 
 	return curVal, nil
 }
 
+func (repo *AuthUsersDB) Archive(ctx context.Context, id uuid.UUID) (jelly.AuthUser, error) {
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
+	now := db.Timestamp(time.Now())
+	res, err := repo.conn().ExecContext(ctx, `UPDATE users SET archived=?, modified=?, version=version+1 WHERE id=? AND (? = '' OR tenant_id = ?) AND archived = 0;`,
+		now.Time().Unix(),
+		now,
+		id,
+		tenantID, tenantID,
+	)
+	if err != nil {
+		return jelly.AuthUser{}, jelly.WrapDBError(err)
+	}
+	rowsAff, err := res.RowsAffected()
+	if err != nil {
+		return jelly.AuthUser{}, jelly.WrapDBError(err)
+	}
+	if rowsAff < 1 {
+		return jelly.AuthUser{}, jelly.ErrDBNotFound
+	}
+
+	return repo.Get(jelly.WithArchived(ctx), id)
+}
+
+func (repo *AuthUsersDB) Restore(ctx context.Context, id uuid.UUID) (jelly.AuthUser, error) {
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
+	res, err := repo.conn().ExecContext(ctx, `UPDATE users SET archived=0, modified=?, version=version+1 WHERE id=? AND (? = '' OR tenant_id = ?) AND archived != 0;`,
+		db.Timestamp(time.Now()),
+		id,
+		tenantID, tenantID,
+	)
+	if err != nil {
+		return jelly.AuthUser{}, jelly.WrapDBError(err)
+	}
+	rowsAff, err := res.RowsAffected()
+	if err != nil {
+		return jelly.AuthUser{}, jelly.WrapDBError(err)
+	}
+	if rowsAff < 1 {
+		return jelly.AuthUser{}, jelly.ErrDBNotFound
+	}
+
+	return repo.Get(ctx, id)
+}
+
+func (repo *AuthUsersDB) DeleteArchivedBefore(ctx context.Context, t time.Time) ([]jelly.AuthUser, error) {
+	all, err := repo.GetAll(jelly.WithArchived(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []jelly.AuthUser
+	for _, u := range all {
+		if u.Archived.IsZero() || !u.Archived.Before(t) {
+			continue
+		}
+
+		// u was retrieved within the tenant, so no need to check it again
+		_, err := repo.conn().ExecContext(ctx, `DELETE FROM users WHERE id = ?`, u.ID)
+		if err != nil {
+			return deleted, jelly.WrapDBError(err)
+		}
+		if err := repo.recordRemoval(ctx, u.TenantID); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, u)
+	}
+
+	return deleted, nil
+}
+
+func (repo *AuthUsersDB) CreateMany(ctx context.Context, users []jelly.AuthUser) ([]jelly.AuthUser, error) {
+	created := make([]jelly.AuthUser, len(users))
+	errs := make([]error, len(users))
+	err := repo.inTx(ctx, func(txRepo *AuthUsersDB) {
+		for i := range users {
+			created[i], errs[i] = txRepo.Create(ctx, users[i])
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, jelly.NewBatchError(errs)
+}
+
+func (repo *AuthUsersDB) UpdateMany(ctx context.Context, users []jelly.AuthUser) ([]jelly.AuthUser, error) {
+	updated := make([]jelly.AuthUser, len(users))
+	errs := make([]error, len(users))
+	err := repo.inTx(ctx, func(txRepo *AuthUsersDB) {
+		for i := range users {
+			updated[i], errs[i] = txRepo.Update(ctx, users[i].ID, users[i])
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, jelly.NewBatchError(errs)
+}
+
+func (repo *AuthUsersDB) DeleteMany(ctx context.Context, ids []uuid.UUID) ([]jelly.AuthUser, error) {
+	deleted := make([]jelly.AuthUser, len(ids))
+	errs := make([]error, len(ids))
+	err := repo.inTx(ctx, func(txRepo *AuthUsersDB) {
+		for i := range ids {
+			deleted[i], errs[i] = txRepo.Delete(ctx, ids[i])
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, jelly.NewBatchError(errs)
+}
+
+// MaxModified returns the latest time that a user in the tenant of ctx was
+// created, modified, or removed. Archived users are always considered, as
+// archiving one removes it from the users that GetAll gives unless archived
+// users are included. filter must be nil.
+func (repo *AuthUsersDB) MaxModified(ctx context.Context, filter interface{}) (time.Time, error) {
+	if filter != nil {
+		return time.Time{}, jelly.NewError(fmt.Sprintf("unsupported filter type %T", filter), jelly.ErrBadArgument)
+	}
+	tenantID, _ := jelly.TenantFromContext(ctx)
+
+	var modified, removed sql.NullInt64
+	row := repo.conn().QueryRowContext(ctx, `SELECT (SELECT MAX(modified) FROM users WHERE ? = '' OR tenant_id = ?), (SELECT MAX(removed) FROM user_removals WHERE ? = '' OR tenant_id = ?);`,
+		tenantID, tenantID, tenantID, tenantID,
+	)
+	if err := row.Scan(&modified, &removed); err != nil {
+		return time.Time{}, jelly.WrapDBError(err)
+	}
+
+	var max time.Time
+	if modified.Valid {
+		max = time.Unix(modified.Int64, 0)
+	}
+	if removed.Valid && time.Unix(removed.Int64, 0).After(max) {
+		max = time.Unix(removed.Int64, 0)
+	}
+	return max, nil
+}
+
+// recordRemoval sets the time that a user was last removed from the tenant
+// with the given ID to now.
+func (repo *AuthUsersDB) recordRemoval(ctx context.Context, tenantID string) error {
+	_, err := repo.conn().ExecContext(ctx, `INSERT INTO user_removals (tenant_id, removed) VALUES (?, ?) ON CONFLICT(tenant_id) DO UPDATE SET removed=excluded.removed;`,
+		tenantID,
+		db.Timestamp(time.Now()),
+	)
+	if err != nil {
+		return jelly.WrapDBError(err)
+	}
+	return nil
+}
+
+// inTx calls fn with a copy of repo that runs its queries in a single
+// transaction, which is committed once fn returns. A failed statement in
+// SQLite does not abort the transaction it is in, so fn can continue after
+// the failure of any one query.
+func (repo *AuthUsersDB) inTx(ctx context.Context, fn func(txRepo *AuthUsersDB)) error {
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return jelly.WrapDBError(err)
+	}
+
+	fn(&AuthUsersDB{DB: repo.DB, tx: tx, ids: repo.ids, crypt: repo.crypt})
+
+	if err := tx.Commit(); err != nil {
+		return jelly.WrapDBError(err)
+	}
+	return nil
+}
+
 func (repo *AuthUsersDB) Close() error {
 	return repo.DB.Close()
 }
+
+// decryptEmail sets the email of user from the value of its email column.
+func (repo *AuthUsersDB) decryptEmail(user *authuserdao.User, stored string) error {
+	email, err := repo.crypt.DecryptString(stored)
+	if err != nil {
+		return fmt.Errorf("decrypt email: %w", err)
+	}
+	return user.Email.Scan(email)
+}
+
+// archivedTimestamp converts the value of the archived column to a Timestamp.
+// The column is 0 for users that are not archived, which is given as the zero
+// Timestamp.
+func archivedTimestamp(unixSecs int64) db.Timestamp {
+	if unixSecs == 0 {
+		return db.Timestamp{}
+	}
+	return db.Timestamp(time.Unix(unixSecs, 0))
+}
@@ -5,6 +5,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"sort"
@@ -96,6 +97,24 @@ func (cr *ConnectorRegistry) Register(engine jelly.DBType, name string, connecto
 	return nil
 }
 
+// RegisterErrorTranslator registers t as the translator for errors from the
+// stores that the connectors of engine create. See
+// jelly.RegisterDBErrorTranslator.
+func (cr *ConnectorRegistry) RegisterErrorTranslator(engine jelly.DBType, t jelly.DBErrorTranslator) error {
+	if t == nil {
+		return fmt.Errorf("error translator function cannot be nil")
+	}
+
+	cr.initDefaults()
+
+	if _, ok := cr.reg[engine]; !ok {
+		return fmt.Errorf("%q is not a supported DB type", engine)
+	}
+
+	jelly.RegisterDBErrorTranslator(engine, t)
+	return nil
+}
+
 // List returns an alphabetized list of all currently registered connector
 // names for an engine.
 func (cr *ConnectorRegistry) List(engine jelly.DBType) []string {
@@ -118,6 +137,23 @@ func (cr *ConnectorRegistry) List(engine jelly.DBType) []string {
 // db.Store. The Store can then be cast to the appropriate type by APIs in
 // their init method.
 func (cr *ConnectorRegistry) Connect(db jelly.DatabaseConfig) (jelly.Store, error) {
+	connector, err := cr.connector(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return connector(db)
+}
+
+// Check returns an error if there is no connector registered that Connect
+// would use for the configured database. It does not connect to it.
+func (cr *ConnectorRegistry) Check(db jelly.DatabaseConfig) error {
+	_, err := cr.connector(db)
+	return err
+}
+
+// connector returns the connector that is used for the configured database.
+func (cr *ConnectorRegistry) connector(db jelly.DatabaseConfig) (func(jelly.DatabaseConfig) (jelly.Store, error), error) {
 	cr.initDefaults()
 
 	engConns := cr.reg[db.Type]
@@ -131,11 +167,11 @@ func (cr *ConnectorRegistry) Connect(db jelly.DatabaseConfig) (jelly.Store, erro
 			if normName != "" && normName != "*" {
 				additionalInfo = fmt.Sprintf("%q/%q is not a registered connector", db.Type, normName)
 			}
-			return nil, fmt.Errorf("%s and %q has no default \"*\" connector registered", additionalInfo, db.Type)
+			return nil, jelly.Permanent(fmt.Errorf("%s and %q has no default \"*\" connector registered", additionalInfo, db.Type))
 		}
 	}
 
-	return connector(db)
+	return connector, nil
 }
 
 // Environment holds all options such as config providers that would normally be
@@ -160,6 +196,20 @@ type marshaledDatabase struct {
 	Connector string `yaml:"connector" json:"connector"`
 	Dir       string `yaml:"dir,omitempty" json:"dir,omitempty"`
 	File      string `yaml:"file,omitempty" json:"file,omitempty"`
+
+	Connect        string `yaml:"connect,omitempty" json:"connect,omitempty"`
+	ConnectTimeout int    `yaml:"connect_timeout,omitempty" json:"connect_timeout,omitempty"`
+
+	Replicas    []marshaledReplica `yaml:"replicas,omitempty" json:"replicas,omitempty"`
+	Failover    bool               `yaml:"failover,omitempty" json:"failover,omitempty"`
+	HealthCheck int                `yaml:"health_check,omitempty" json:"health_check,omitempty"`
+
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+}
+
+type marshaledReplica struct {
+	Dir  string `yaml:"dir,omitempty" json:"dir,omitempty"`
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
 }
 
 type marshaledAPI struct {
@@ -167,6 +217,19 @@ type marshaledAPI struct {
 	Enabled bool     `yaml:"enabled" json:"enabled"`
 	Uses    []string `yaml:"uses" json:"uses"`
 
+	Component string `yaml:"component,omitempty" json:"component,omitempty"`
+
+	Capture       bool     `yaml:"capture,omitempty" json:"capture,omitempty"`
+	CaptureBuffer int      `yaml:"capture_buffer,omitempty" json:"capture_buffer,omitempty"`
+	CaptureRedact []string `yaml:"capture_redact,omitempty" json:"capture_redact,omitempty"`
+	MaxInFlight   int      `yaml:"max_in_flight,omitempty" json:"max_in_flight,omitempty"`
+	Envelope      string   `yaml:"envelope,omitempty" json:"envelope,omitempty"`
+
+	CORS            *marshaledCORS            `yaml:"cors,omitempty" json:"cors,omitempty"`
+	RateLimit       *marshaledRateLimit       `yaml:"ratelimit,omitempty" json:"ratelimit,omitempty"`
+	Timeout         int                       `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	SecurityHeaders *marshaledSecurityHeaders `yaml:"security_headers,omitempty" json:"security_headers,omitempty"`
+
 	others map[string]interface{}
 }
 
@@ -180,6 +243,36 @@ func (mc marshaledAPI) marshalMap() map[string]interface{} {
 	m["base"] = mc.Base
 	m["enabled"] = mc.Enabled
 	m["uses"] = mc.Uses
+	if mc.Component != "" {
+		m["component"] = mc.Component
+	}
+	if mc.Capture {
+		m["capture"] = mc.Capture
+	}
+	if mc.CaptureBuffer != 0 {
+		m["capture_buffer"] = mc.CaptureBuffer
+	}
+	if len(mc.CaptureRedact) > 0 {
+		m["capture_redact"] = mc.CaptureRedact
+	}
+	if mc.MaxInFlight != 0 {
+		m["max_in_flight"] = mc.MaxInFlight
+	}
+	if mc.Envelope != "" {
+		m["envelope"] = mc.Envelope
+	}
+	if mc.CORS != nil {
+		m["cors"] = mc.CORS
+	}
+	if mc.RateLimit != nil {
+		m["ratelimit"] = mc.RateLimit
+	}
+	if mc.Timeout != 0 {
+		m["timeout"] = mc.Timeout
+	}
+	if mc.SecurityHeaders != nil {
+		m["security_headers"] = mc.SecurityHeaders
+	}
 
 	return m
 }
@@ -193,12 +286,244 @@ func (mc marshaledAPI) MarshalJSON() ([]byte, error) {
 }
 
 type marshaledConfig struct {
-	Listen  string                       `yaml:"listen" json:"listen"`
-	Auth    string                       `yaml:"authenticator" json:"authenticator"`
-	Base    string                       `yaml:"base" json:"base"`
-	DBs     map[string]marshaledDatabase `yaml:"dbs" json:"dbs"`
-	APIs    map[string]marshaledAPI      `yaml:"apis" json:"apis"`
-	Logging marshaledLog                 `yaml:"logging" json:"logging"`
+	Listen string `yaml:"listen" json:"listen"`
+	// ExtraListen is every listen address after the first when listen is a
+	// list.
+	ExtraListen []string                     `yaml:"-" json:"-"`
+	Auth        string                       `yaml:"authenticator" json:"authenticator"`
+	Base        string                       `yaml:"base" json:"base"`
+	Tenancy     marshaledTenancy             `yaml:"tenancy" json:"tenancy"`
+	Mirror      marshaledMirror              `yaml:"mirror" json:"mirror"`
+	Breaker     marshaledBreaker             `yaml:"breaker" json:"breaker"`
+	Quota       marshaledQuota               `yaml:"quota" json:"quota"`
+	Flags       marshaledFlags               `yaml:"flags" json:"flags"`
+	Webhooks    marshaledWebhooks            `yaml:"webhooks" json:"webhooks"`
+	GRPC        marshaledGRPC                `yaml:"grpc" json:"grpc"`
+	TLS         marshaledTLS                 `yaml:"tls" json:"tls"`
+	IDs         marshaledIDs                 `yaml:"ids" json:"ids"`
+	Encryption  marshaledEncryption          `yaml:"encryption" json:"encryption"`
+	I18n        marshaledI18n                `yaml:"i18n" json:"i18n"`
+	Info        marshaledInfo                `yaml:"info" json:"info"`
+	Admin       marshaledAdmin               `yaml:"admin" json:"admin"`
+	CORS        marshaledCORS                `yaml:"cors" json:"cors"`
+	RateLimit   marshaledRateLimit           `yaml:"ratelimit" json:"ratelimit"`
+	Defaults    marshaledDefaults            `yaml:"defaults" json:"defaults"`
+	Shutdown    int                          `yaml:"shutdown_timeout" json:"shutdown_timeout"`
+	HotRestart  bool                         `yaml:"hot_restart" json:"hot_restart"`
+	Reload      bool                         `yaml:"reload_config" json:"reload_config"`
+	RouteStats  bool                         `yaml:"route_stats" json:"route_stats"`
+	UnauthLog   string                       `yaml:"unauth_log,omitempty" json:"unauth_log,omitempty"`
+	ContentType bool                         `yaml:"require_content_type" json:"require_content_type"`
+	InFlight    int                          `yaml:"max_in_flight" json:"max_in_flight"`
+	Profile     string                       `yaml:"profile" json:"profile"`
+	Fixtures    []string                     `yaml:"fixtures" json:"fixtures"`
+	Middleware  []string                     `yaml:"middleware" json:"middleware"`
+	DBs         map[string]marshaledDatabase `yaml:"dbs" json:"dbs"`
+	APIs        map[string]marshaledAPI      `yaml:"apis" json:"apis"`
+	Logging     marshaledLog                 `yaml:"logging" json:"logging"`
+}
+
+type marshaledTenancy struct {
+	Enabled bool   `yaml:"enabled" json:"enabled"`
+	Header  string `yaml:"header,omitempty" json:"header,omitempty"`
+	Domain  string `yaml:"domain,omitempty" json:"domain,omitempty"`
+}
+
+type marshaledMirror struct {
+	Enabled      bool     `yaml:"enabled" json:"enabled"`
+	Target       string   `yaml:"target,omitempty" json:"target,omitempty"`
+	SampleRate   float64  `yaml:"sample_rate,omitempty" json:"sample_rate,omitempty"`
+	ScrubHeaders []string `yaml:"scrub_headers,omitempty" json:"scrub_headers,omitempty"`
+	Timeout      int      `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+type marshaledBreaker struct {
+	FailureThreshold int `yaml:"failure_threshold,omitempty" json:"failure_threshold,omitempty"`
+	ResetTimeout     int `yaml:"reset_timeout,omitempty" json:"reset_timeout,omitempty"`
+	HalfOpenProbes   int `yaml:"half_open_probes,omitempty" json:"half_open_probes,omitempty"`
+}
+
+type marshaledQuota struct {
+	DB              string                         `yaml:"db,omitempty" json:"db,omitempty"`
+	PersistInterval int                            `yaml:"persist_interval,omitempty" json:"persist_interval,omitempty"`
+	Limits          map[string]marshaledQuotaLimit `yaml:"limits,omitempty" json:"limits,omitempty"`
+}
+
+type marshaledQuotaLimit struct {
+	Limit      int64  `yaml:"limit" json:"limit"`
+	Period     string `yaml:"period,omitempty" json:"period,omitempty"`
+	PerRequest bool   `yaml:"per_request,omitempty" json:"per_request,omitempty"`
+}
+
+type marshaledFlags struct {
+	Rules map[string]marshaledFlagRule `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+type marshaledFlagRule struct {
+	Enabled    bool     `yaml:"enabled" json:"enabled"`
+	Percentage int      `yaml:"percentage,omitempty" json:"percentage,omitempty"`
+	Roles      []string `yaml:"roles,omitempty" json:"roles,omitempty"`
+}
+
+type marshaledWebhooks struct {
+	Subscriptions []marshaledWebhookSubscription `yaml:"subscriptions,omitempty" json:"subscriptions,omitempty"`
+	Admin         bool                           `yaml:"admin" json:"admin"`
+	Path          string                         `yaml:"path,omitempty" json:"path,omitempty"`
+	Attempts      int                            `yaml:"attempts,omitempty" json:"attempts,omitempty"`
+	RetryDelay    int                            `yaml:"retry_delay,omitempty" json:"retry_delay,omitempty"`
+	Timeout       int                            `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	DeadLetters   int                            `yaml:"dead_letters,omitempty" json:"dead_letters,omitempty"`
+}
+
+type marshaledWebhookSubscription struct {
+	URL    string   `yaml:"url" json:"url"`
+	Secret string   `yaml:"secret,omitempty" json:"secret,omitempty"`
+	Events []string `yaml:"events,omitempty" json:"events,omitempty"`
+}
+
+type marshaledGRPC struct {
+	Enabled     bool   `yaml:"enabled" json:"enabled"`
+	Listen      string `yaml:"listen,omitempty" json:"listen,omitempty"`
+	Auth        string `yaml:"authenticator,omitempty" json:"authenticator,omitempty"`
+	RequireAuth bool   `yaml:"require_auth" json:"require_auth"`
+}
+
+type marshaledTLS struct {
+	Enabled  bool              `yaml:"enabled" json:"enabled"`
+	Cert     string            `yaml:"cert,omitempty" json:"cert,omitempty"`
+	Key      string            `yaml:"key,omitempty" json:"key,omitempty"`
+	Autocert marshaledAutocert `yaml:"autocert" json:"autocert"`
+}
+
+type marshaledAutocert struct {
+	Enabled    bool     `yaml:"enabled" json:"enabled"`
+	Domains    []string `yaml:"domains,omitempty" json:"domains,omitempty"`
+	Cache      string   `yaml:"cache,omitempty" json:"cache,omitempty"`
+	Email      string   `yaml:"email,omitempty" json:"email,omitempty"`
+	Challenge  string   `yaml:"challenge,omitempty" json:"challenge,omitempty"`
+	HTTPListen string   `yaml:"http_listen,omitempty" json:"http_listen,omitempty"`
+	Directory  string   `yaml:"directory,omitempty" json:"directory,omitempty"`
+}
+
+type marshaledIDs struct {
+	Strategy string `yaml:"strategy,omitempty" json:"strategy,omitempty"`
+	Node     int    `yaml:"node,omitempty" json:"node,omitempty"`
+}
+
+type marshaledEncryption struct {
+	Keys []marshaledEncryptionKey `yaml:"keys,omitempty" json:"keys,omitempty"`
+}
+
+type marshaledEncryptionKey struct {
+	ID         string `yaml:"id" json:"id"`
+	Secret     string `yaml:"secret,omitempty" json:"secret,omitempty"`
+	SecretFile string `yaml:"secret_file,omitempty" json:"secret_file,omitempty"`
+}
+
+type marshaledI18n struct {
+	Fallback string   `yaml:"fallback,omitempty" json:"fallback,omitempty"`
+	Catalogs []string `yaml:"catalogs,omitempty" json:"catalogs,omitempty"`
+}
+
+type marshaledInfo struct {
+	Enabled bool   `yaml:"enabled" json:"enabled"`
+	Path    string `yaml:"path,omitempty" json:"path,omitempty"`
+	Name    string `yaml:"name,omitempty" json:"name,omitempty"`
+
+	VersionHeader bool `yaml:"version_header,omitempty" json:"version_header,omitempty"`
+}
+
+type marshaledAdmin struct {
+	Enabled bool   `yaml:"enabled" json:"enabled"`
+	Path    string `yaml:"path,omitempty" json:"path,omitempty"`
+
+	Profiling     bool   `yaml:"profiling,omitempty" json:"profiling,omitempty"`
+	ProfilingPath string `yaml:"profiling_path,omitempty" json:"profiling_path,omitempty"`
+}
+
+type marshaledCORS struct {
+	AllowedOrigins   []string `yaml:"allowed_origins,omitempty" json:"allowed_origins,omitempty"`
+	AllowedMethods   []string `yaml:"allowed_methods,omitempty" json:"allowed_methods,omitempty"`
+	AllowedHeaders   []string `yaml:"allowed_headers,omitempty" json:"allowed_headers,omitempty"`
+	AllowCredentials bool     `yaml:"allow_credentials" json:"allow_credentials"`
+	MaxAge           int      `yaml:"max_age,omitempty" json:"max_age,omitempty"`
+}
+
+type marshaledRateLimit struct {
+	Requests int `yaml:"requests" json:"requests"`
+	Period   int `yaml:"period,omitempty" json:"period,omitempty"`
+	Burst    int `yaml:"burst,omitempty" json:"burst,omitempty"`
+}
+
+type marshaledSecurityHeaders struct {
+	NoSniff               bool   `yaml:"nosniff,omitempty" json:"nosniff,omitempty"`
+	FrameOptions          string `yaml:"frame_options,omitempty" json:"frame_options,omitempty"`
+	ReferrerPolicy        string `yaml:"referrer_policy,omitempty" json:"referrer_policy,omitempty"`
+	ContentSecurityPolicy string `yaml:"content_security_policy,omitempty" json:"content_security_policy,omitempty"`
+	HSTSMaxAge            int    `yaml:"hsts_max_age,omitempty" json:"hsts_max_age,omitempty"`
+}
+
+type marshaledDefaults struct {
+	CORS            marshaledCORS            `yaml:"cors" json:"cors"`
+	RateLimit       marshaledRateLimit       `yaml:"ratelimit" json:"ratelimit"`
+	Timeout         int                      `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	SecurityHeaders marshaledSecurityHeaders `yaml:"security_headers" json:"security_headers"`
+}
+
+func unmarshalCORS(m marshaledCORS) jelly.CORSConfig {
+	return jelly.CORSConfig{
+		AllowedOrigins:   m.AllowedOrigins,
+		AllowedMethods:   m.AllowedMethods,
+		AllowedHeaders:   m.AllowedHeaders,
+		AllowCredentials: m.AllowCredentials,
+		MaxAgeSecs:       m.MaxAge,
+	}
+}
+
+func marshalCORS(cfg jelly.CORSConfig) marshaledCORS {
+	return marshaledCORS{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowedMethods:   cfg.AllowedMethods,
+		AllowedHeaders:   cfg.AllowedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAgeSecs,
+	}
+}
+
+func unmarshalRateLimit(m marshaledRateLimit) jelly.RateLimitConfig {
+	return jelly.RateLimitConfig{
+		Requests:     m.Requests,
+		PeriodMillis: m.Period,
+		Burst:        m.Burst,
+	}
+}
+
+func marshalRateLimit(cfg jelly.RateLimitConfig) marshaledRateLimit {
+	return marshaledRateLimit{
+		Requests: cfg.Requests,
+		Period:   cfg.PeriodMillis,
+		Burst:    cfg.Burst,
+	}
+}
+
+func unmarshalSecurityHeaders(m marshaledSecurityHeaders) jelly.SecurityHeadersConfig {
+	return jelly.SecurityHeadersConfig{
+		NoSniff:               m.NoSniff,
+		FrameOptions:          m.FrameOptions,
+		ReferrerPolicy:        m.ReferrerPolicy,
+		ContentSecurityPolicy: m.ContentSecurityPolicy,
+		HSTSMaxAgeSecs:        m.HSTSMaxAge,
+	}
+}
+
+func marshalSecurityHeaders(cfg jelly.SecurityHeadersConfig) marshaledSecurityHeaders {
+	return marshaledSecurityHeaders{
+		NoSniff:               cfg.NoSniff,
+		FrameOptions:          cfg.FrameOptions,
+		ReferrerPolicy:        cfg.ReferrerPolicy,
+		ContentSecurityPolicy: cfg.ContentSecurityPolicy,
+		HSTSMaxAge:            cfg.HSTSMaxAgeSecs,
+	}
 }
 
 type marshaledLog struct {
@@ -207,7 +532,9 @@ type marshaledLog struct {
 	File     string `yaml:"file,omitempty" json:"file,omitempty"`
 }
 
-func decode(f jelly.Format, env *Environment, data []byte) (jelly.Config, error) {
+// decode decodes config data in format f. envKeys is the set of dotted paths
+// of the values in data that were read from environment variables.
+func decode(f jelly.Format, env *Environment, data []byte, envKeys map[string]bool) (jelly.Config, error) {
 	var cfg jelly.Config
 	var mc marshaledConfig
 	var err error
@@ -225,9 +552,39 @@ func decode(f jelly.Format, env *Environment, data []byte) (jelly.Config, error)
 		return cfg, err
 	}
 
+	// separately record which keys were given for annotating dumps
+	var raw interface{}
+	if f == jelly.JSON {
+		err = json.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return cfg, err
+	}
+	keys := map[string]bool{}
+	fileKeys(raw, "", keys)
+
 	cfg.Format = f
-	err = unmarshalConfig(&cfg, env, mc)
-	return cfg, err
+	if err := unmarshalConfig(&cfg, env, mc); err != nil {
+		return cfg, err
+	}
+
+	values, err := filledValues(cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("record value sources: %w", err)
+	}
+	cfg.Sources = map[string]jelly.ValueSource{}
+	for path, v := range values {
+		src := jelly.SourceDefault
+		if envKeys[path] {
+			src = jelly.SourceEnv
+		} else if keys[path] {
+			src = jelly.SourceFile
+		}
+		cfg.Sources[path] = jelly.ValueSource{Source: src, Value: v}
+	}
+	return cfg, nil
 }
 
 func encode(f jelly.Format, c jelly.Config) ([]byte, error) {
@@ -237,7 +594,7 @@ func encode(f jelly.Format, c jelly.Config) ([]byte, error) {
 
 	switch f {
 	case jelly.JSON:
-		data, err = json.Marshal(mc)
+		data, err = json.Marshal(&mc)
 	case jelly.YAML:
 		data, err = yaml.Marshal(mc)
 	default:
@@ -295,16 +652,301 @@ func Dump(cfg jelly.Config) []byte {
 	return b
 }
 
+// DumpWith is the same as Dump, but it dumps the config for display as
+// specified by opts. It is an error if opts.Section is not in the config.
+func DumpWith(cfg jelly.Config, opts jelly.DumpOptions) ([]byte, error) {
+	f := cfg.Format
+	if f == jelly.NoFormat || opts.Annotate {
+		f = jelly.YAML
+	}
+	data, err := encode(f, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, so both are read the same way.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	n := &doc
+	if len(doc.Content) > 0 {
+		n = doc.Content[0]
+	}
+
+	var path string
+	var sensitive bool
+	if opts.Section != "" {
+		path = strings.ToLower(opts.Section)
+		for _, part := range strings.Split(path, ".") {
+			n = mappingValue(n, part)
+			if n == nil {
+				return nil, fmt.Errorf("section %q: not in config", opts.Section)
+			}
+			sensitive = jelly.IsSensitive(part)
+		}
+	}
+
+	if opts.Redact {
+		redactConfigNode(n, sensitive)
+	}
+	if opts.Annotate {
+		sources, err := configSources(cfg)
+		if err != nil {
+			return nil, err
+		}
+		annotateConfigNode(n, path, sources)
+	}
+
+	if f == jelly.JSON {
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+		return json.Marshal(v)
+	}
+	return yaml.Marshal(n)
+}
+
+// mappingValue returns the value of key in mapping node n, ignoring case. If n
+// is not a mapping or does not have key, nil is returned.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if strings.EqualFold(n.Content[i].Value, key) {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// annotateConfigNode adds a comment to every scalar and sequence value in
+// mapping node n that gives where it came from, as given in sources. path is
+// the dotted path of n.
+func annotateConfigNode(n *yaml.Node, path string, sources map[string]string) {
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+
+		keyPath := strings.ToLower(key.Value)
+		if path != "" {
+			keyPath = path + "." + keyPath
+		}
+
+		if val.Kind == yaml.MappingNode && len(val.Content) > 0 {
+			annotateConfigNode(val, keyPath, sources)
+			continue
+		}
+
+		src, ok := sources[keyPath]
+		if !ok {
+			// only in cfg, and not once defaults are filled
+			src = jelly.SourceCode
+		}
+
+		// comments on block collections must go on their key to be on the
+		// same line as it.
+		if (val.Kind == yaml.SequenceNode || val.Kind == yaml.MappingNode) && len(val.Content) > 0 {
+			key.LineComment = src
+		} else {
+			val.LineComment = src
+		}
+	}
+}
+
+// configSources returns where each value of cfg came from, keyed by dotted
+// path. Values that differ from those that cfg was loaded with, or from the
+// defaults if cfg was not loaded or does not have a value at load time, were
+// set by code.
+func configSources(cfg jelly.Config) (map[string]string, error) {
+	values, err := filledValues(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := filledValues(jelly.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	sources := map[string]string{}
+	for path, v := range values {
+		if loaded, ok := cfg.Sources[path]; ok {
+			if v == loaded.Value {
+				sources[path] = loaded.Source
+			} else {
+				sources[path] = jelly.SourceCode
+			}
+		} else if def, ok := defaults[path]; ok && v == def {
+			sources[path] = jelly.SourceDefault
+		} else {
+			sources[path] = jelly.SourceCode
+		}
+	}
+	return sources, nil
+}
+
+// filledValues returns the YAML encoding of every scalar and sequence value
+// in cfg once its defaults are filled, keyed by dotted path. cfg is not
+// modified.
+func filledValues(cfg jelly.Config) (map[string]string, error) {
+	// FillDefaults replaces the entries of the maps in place
+	filled := cfg
+	filled.DBs = make(map[string]jelly.DatabaseConfig, len(cfg.DBs))
+	for k, v := range cfg.DBs {
+		filled.DBs[k] = v
+	}
+	filled.APIs = make(map[string]jelly.APIConfig, len(cfg.APIs))
+	for k, v := range cfg.APIs {
+		filled.APIs[k] = v
+	}
+	filled = filled.FillDefaults()
+
+	data, err := encode(jelly.YAML, filled)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	if len(doc.Content) > 0 {
+		if err := nodeValues(doc.Content[0], "", values); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// nodeValues adds the YAML encoding of every scalar and sequence value in
+// mapping node n to values, keyed by dotted path. path is the dotted path of
+// n.
+func nodeValues(n *yaml.Node, path string, values map[string]string) error {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+
+		keyPath := strings.ToLower(key.Value)
+		if path != "" {
+			keyPath = path + "." + keyPath
+		}
+
+		if val.Kind == yaml.MappingNode && len(val.Content) > 0 {
+			if err := nodeValues(val, keyPath, values); err != nil {
+				return err
+			}
+			continue
+		}
+
+		enc, err := yaml.Marshal(val)
+		if err != nil {
+			return fmt.Errorf("%s: %w", keyPath, err)
+		}
+		values[keyPath] = string(enc)
+	}
+	return nil
+}
+
+// fileKeys adds the dotted paths of every scalar and list value in decoded
+// config data v to keys. path is the dotted path of v.
+func fileKeys(v interface{}, path string, keys map[string]bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		if path != "" {
+			keys[path] = true
+		}
+		return
+	}
+
+	for k, sub := range m {
+		subPath := strings.ToLower(k)
+		if path != "" {
+			subPath = path + "." + subPath
+		}
+		fileKeys(sub, subPath, keys)
+	}
+}
+
+// redactConfigNode redacts the string values of sensitive keys in n and its
+// children. sensitive is whether n is the value of a sensitive key.
+func redactConfigNode(n *yaml.Node, sensitive bool) {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			redactConfigNode(c, sensitive)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			redactConfigNode(n.Content[i+1], jelly.IsSensitive(n.Content[i].Value))
+		}
+	case yaml.ScalarNode:
+		if sensitive && n.Tag == "!!str" && n.Value != "" {
+			n.Value = jelly.RedactedValue
+			n.Style = 0
+		}
+	}
+}
+
+// redactConfigValue redacts the string values of sensitive keys in decoded
+// JSON v. sensitive is whether v is the value of a sensitive key.
+func redactConfigValue(v interface{}, sensitive bool) interface{} {
+	switch typed := v.(type) {
+	case []interface{}:
+		for i := range typed {
+			typed[i] = redactConfigValue(typed[i], sensitive)
+		}
+	case map[string]interface{}:
+		for k := range typed {
+			typed[k] = redactConfigValue(typed[k], jelly.IsSensitive(k))
+		}
+	case string:
+		if sensitive && typed != "" {
+			return jelly.RedactedValue
+		}
+	}
+	return v
+}
+
 // Load loads a configuration from a JSON or YAML file. The format of the file
 // is determined by examining its extension; files ending in .json are parsed as
 // JSON files, and files ending in .yaml or .yml are parsed as YAML files. Other
 // extensions are not supported. The extension is not case-sensitive.
 //
+// If file is a directory, such as a mounted Kubernetes ConfigMap, every JSON
+// and YAML file in it is loaded and merged in order of their names, with later
+// files taking precedence. Other files and hidden files are ignored.
+//
+// References to pod metadata in the string values of the file are replaced
+// with their values. "${pod.name}", "${pod.namespace}", "${pod.ip}", and
+// "${node.name}" are supported, and are read from the POD_NAME, POD_NAMESPACE,
+// POD_IP, and NODE_NAME environment variables, as set with the Kubernetes
+// downward API.
+//
+// If profile is not "", the overrides given for it under the top-level
+// "profiles" key are merged over the rest of the config, and the profile of
+// the config is set to it. The "profiles" key is never loaded as part of the
+// config itself.
+//
 // Ensure Register is called on the Environment (or an owning jelly.Environment)
 // with all config sections that will be present in the loaded file.
-func (env *Environment) Load(file string) (jelly.Config, error) {
+func (env *Environment) Load(file string, profile string) (jelly.Config, error) {
 	env.initDefaults()
 
+	if info, err := os.Stat(file); err == nil && info.IsDir() {
+		cfg, err := env.loadDir(file, profile)
+		cfg.Path = file
+		return cfg, err
+	}
+
 	f := DetectFormat(file)
 	if f == jelly.NoFormat {
 		var msg strings.Builder
@@ -336,8 +978,22 @@ func (env *Environment) Load(file string) (jelly.Config, error) {
 	if err != nil {
 		return jelly.Config{}, fmt.Errorf("%s: %w", file, err)
 	}
+	data, err = applyProfile(f, data, profile)
+	if err != nil {
+		return jelly.Config{}, fmt.Errorf("%s: %w", file, err)
+	}
+	envKeys, err := podMetaKeys(data)
+	if err != nil {
+		return jelly.Config{}, fmt.Errorf("%s: %w", file, err)
+	}
+	data, err = interpolatePodMeta(f, data)
+	if err != nil {
+		return jelly.Config{}, fmt.Errorf("%s: %w", file, err)
+	}
 
-	return decode(f, env, data)
+	cfg, err := decode(f, env, data, envKeys)
+	cfg.Path = file
+	return cfg, err
 }
 
 func (env *Environment) Register(name string, provider func() jelly.APIConfig) error {
@@ -359,7 +1015,29 @@ func marshalAPI(api jelly.APIConfig) marshaledAPI {
 		Enabled: api.Get(jelly.ConfigKeyAPIEnabled).(bool),
 		Base:    api.Get(jelly.ConfigKeyAPIBase).(string),
 		Uses:    api.Get(jelly.ConfigKeyAPIUsesDBs).([]string),
-		others:  map[string]interface{}{},
+
+		Component: api.Get(jelly.ConfigKeyAPIComponent).(string),
+
+		Capture:       api.Get(jelly.ConfigKeyAPICapture).(bool),
+		CaptureBuffer: api.Get(jelly.ConfigKeyAPICaptureBuffer).(int),
+		CaptureRedact: api.Get(jelly.ConfigKeyAPICaptureRedact).([]string),
+		MaxInFlight:   api.Get(jelly.ConfigKeyAPIMaxInFlight).(int),
+		Envelope:      string(api.Get(jelly.ConfigKeyAPIEnvelope).(jelly.Envelope)),
+		Timeout:       api.Get(jelly.ConfigKeyAPITimeout).(int),
+
+		others: map[string]interface{}{},
+	}
+	if cors, _ := api.Get(jelly.ConfigKeyAPICORS).(*jelly.CORSConfig); cors != nil {
+		mCORS := marshalCORS(*cors)
+		ma.CORS = &mCORS
+	}
+	if rateLimit, _ := api.Get(jelly.ConfigKeyAPIRateLimit).(*jelly.RateLimitConfig); rateLimit != nil {
+		mRateLimit := marshalRateLimit(*rateLimit)
+		ma.RateLimit = &mRateLimit
+	}
+	if headers, _ := api.Get(jelly.ConfigKeyAPISecurityHeaders).(*jelly.SecurityHeadersConfig); headers != nil {
+		mHeaders := marshalSecurityHeaders(*headers)
+		ma.SecurityHeaders = &mHeaders
 	}
 
 	commonKeys := map[string]struct{}{}
@@ -388,11 +1066,21 @@ func unmarshalAPI(env *Environment, ma marshaledAPI, name string) (jelly.APIConf
 	env.initDefaults()
 
 	nameNorm := strings.ToLower(name)
+	compNorm := strings.ToLower(ma.Component)
+
+	// instances of a component are loaded into the config section of the
+	// component
+	section := nameNorm
+	if compNorm != "" {
+		section = compNorm
+	}
 
 	var api jelly.APIConfig
-	prov, ok := env.apiConfigProviders[nameNorm]
+	prov, ok := env.apiConfigProviders[section]
 	if ok {
 		api = prov()
+	} else if compNorm != "" {
+		return nil, fmt.Errorf(jelly.ConfigKeyAPIComponent+": %q is not a registered component", ma.Component)
 	} else {
 		// fallback - if it fails to provide one, it just gets a common config
 		api = &jelly.CommonConfig{}
@@ -401,6 +1089,9 @@ func unmarshalAPI(env *Environment, ma marshaledAPI, name string) (jelly.APIConf
 	if err := api.Set(jelly.ConfigKeyAPIName, nameNorm); err != nil {
 		return nil, fmt.Errorf(jelly.ConfigKeyAPIName+": %w", err)
 	}
+	if err := api.Set(jelly.ConfigKeyAPIComponent, compNorm); err != nil {
+		return nil, fmt.Errorf(jelly.ConfigKeyAPIComponent+": %w", err)
+	}
 	if err := api.Set(jelly.ConfigKeyAPIEnabled, ma.Enabled); err != nil {
 		return nil, fmt.Errorf(jelly.ConfigKeyAPIEnabled+": %w", err)
 	}
@@ -410,6 +1101,42 @@ func unmarshalAPI(env *Environment, ma marshaledAPI, name string) (jelly.APIConf
 	if err := api.Set(jelly.ConfigKeyAPIUsesDBs, ma.Uses); err != nil {
 		return nil, fmt.Errorf(jelly.ConfigKeyAPIUsesDBs+": %w", err)
 	}
+	if err := api.Set(jelly.ConfigKeyAPICapture, ma.Capture); err != nil {
+		return nil, fmt.Errorf(jelly.ConfigKeyAPICapture+": %w", err)
+	}
+	if err := api.Set(jelly.ConfigKeyAPICaptureBuffer, ma.CaptureBuffer); err != nil {
+		return nil, fmt.Errorf(jelly.ConfigKeyAPICaptureBuffer+": %w", err)
+	}
+	if err := api.Set(jelly.ConfigKeyAPICaptureRedact, ma.CaptureRedact); err != nil {
+		return nil, fmt.Errorf(jelly.ConfigKeyAPICaptureRedact+": %w", err)
+	}
+	if err := api.Set(jelly.ConfigKeyAPIMaxInFlight, ma.MaxInFlight); err != nil {
+		return nil, fmt.Errorf(jelly.ConfigKeyAPIMaxInFlight+": %w", err)
+	}
+	if err := api.Set(jelly.ConfigKeyAPIEnvelope, ma.Envelope); err != nil {
+		return nil, fmt.Errorf(jelly.ConfigKeyAPIEnvelope+": %w", err)
+	}
+	if err := api.Set(jelly.ConfigKeyAPITimeout, ma.Timeout); err != nil {
+		return nil, fmt.Errorf(jelly.ConfigKeyAPITimeout+": %w", err)
+	}
+	if ma.CORS != nil {
+		cors := unmarshalCORS(*ma.CORS)
+		if err := api.Set(jelly.ConfigKeyAPICORS, &cors); err != nil {
+			return nil, fmt.Errorf(jelly.ConfigKeyAPICORS+": %w", err)
+		}
+	}
+	if ma.RateLimit != nil {
+		rateLimit := unmarshalRateLimit(*ma.RateLimit)
+		if err := api.Set(jelly.ConfigKeyAPIRateLimit, &rateLimit); err != nil {
+			return nil, fmt.Errorf(jelly.ConfigKeyAPIRateLimit+": %w", err)
+		}
+	}
+	if ma.SecurityHeaders != nil {
+		headers := unmarshalSecurityHeaders(*ma.SecurityHeaders)
+		if err := api.Set(jelly.ConfigKeyAPISecurityHeaders, &headers); err != nil {
+			return nil, fmt.Errorf(jelly.ConfigKeyAPISecurityHeaders+": %w", err)
+		}
+	}
 
 	for k, v := range ma.others {
 		kNorm := strings.ToLower(k)
@@ -454,20 +1181,162 @@ func unmarshalGlobals(cfg *jelly.Globals, m marshaledConfig) error {
 	var err error
 
 	// listen address part...
-	listenAddr := m.Listen
-	bindParts := strings.SplitN(listenAddr, ":", 2)
-	if len(bindParts) != 2 {
-		return fmt.Errorf("listen: not in \"ADDRESS:PORT\" or \":PORT\" format")
-	}
-	cfg.Address = bindParts[0]
-	cfg.Port, err = strconv.Atoi(bindParts[1])
+	cfg.Address, cfg.Port, err = jelly.ParseListenAddress(m.Listen)
 	if err != nil {
-		return fmt.Errorf("listen: %q is not a valid port number", bindParts[1])
+		return fmt.Errorf("listen: %w", err)
+	}
+	cfg.ExtraListen = nil
+	for i, extra := range m.ExtraListen {
+		// checked here so that errors give the line in the file; the
+		// normalized form is what is kept
+		addr, port, err := jelly.ParseListenAddress(extra)
+		if err != nil {
+			return fmt.Errorf("listen[%d]: %w", i+1, err)
+		}
+		cfg.ExtraListen = append(cfg.ExtraListen, net.JoinHostPort(addr, strconv.Itoa(port)))
 	}
 
 	// ...and the rest
 	cfg.URIBase = m.Base
 	cfg.MainAuthProvider = m.Auth
+	cfg.Tenancy = jelly.TenancyConfig{
+		Enabled: m.Tenancy.Enabled,
+		Header:  m.Tenancy.Header,
+		Domain:  m.Tenancy.Domain,
+	}
+	cfg.Mirror = jelly.MirrorConfig{
+		Enabled:       m.Mirror.Enabled,
+		Target:        m.Mirror.Target,
+		SampleRate:    m.Mirror.SampleRate,
+		ScrubHeaders:  m.Mirror.ScrubHeaders,
+		TimeoutMillis: m.Mirror.Timeout,
+	}
+	cfg.Breaker = jelly.BreakerConfig{
+		FailureThreshold:   m.Breaker.FailureThreshold,
+		ResetTimeoutMillis: m.Breaker.ResetTimeout,
+		HalfOpenProbes:     m.Breaker.HalfOpenProbes,
+	}
+	cfg.Quota = jelly.QuotaConfig{DB: m.Quota.DB, PersistIntervalMillis: m.Quota.PersistInterval}
+	if len(m.Quota.Limits) > 0 {
+		cfg.Quota.Limits = make(map[string]jelly.QuotaLimit, len(m.Quota.Limits))
+		for name, ql := range m.Quota.Limits {
+			cfg.Quota.Limits[name] = jelly.QuotaLimit{
+				Limit:      ql.Limit,
+				Period:     jelly.QuotaPeriod(ql.Period),
+				PerRequest: ql.PerRequest,
+			}
+		}
+	}
+	cfg.Flags = jelly.FlagConfig{}
+	if len(m.Flags.Rules) > 0 {
+		cfg.Flags.Rules = make(map[string]jelly.FlagRule, len(m.Flags.Rules))
+		for name, fr := range m.Flags.Rules {
+			rule := jelly.FlagRule{
+				Enabled:    fr.Enabled,
+				Percentage: fr.Percentage,
+			}
+			for i, roleStr := range fr.Roles {
+				role, err := jelly.ParseRole(roleStr)
+				if err != nil {
+					return fmt.Errorf("flags: rules: %s: roles: item #%d: %w", name, i+1, err)
+				}
+				rule.Roles = append(rule.Roles, role)
+			}
+			cfg.Flags.Rules[name] = rule
+		}
+	}
+	cfg.Webhooks = jelly.WebhookConfig{
+		Admin:            m.Webhooks.Admin,
+		Path:             m.Webhooks.Path,
+		Attempts:         m.Webhooks.Attempts,
+		RetryDelayMillis: m.Webhooks.RetryDelay,
+		TimeoutMillis:    m.Webhooks.Timeout,
+		DeadLetters:      m.Webhooks.DeadLetters,
+	}
+	for _, sub := range m.Webhooks.Subscriptions {
+		cfg.Webhooks.Subscriptions = append(cfg.Webhooks.Subscriptions, jelly.WebhookSubscription{
+			URL:    sub.URL,
+			Secret: sub.Secret,
+			Events: sub.Events,
+		})
+	}
+	cfg.GRPC = jelly.GRPCConfig{
+		Enabled:       m.GRPC.Enabled,
+		Authenticator: m.GRPC.Auth,
+		RequireAuth:   m.GRPC.RequireAuth,
+	}
+	if m.GRPC.Listen != "" {
+		cfg.GRPC.Address, cfg.GRPC.Port, err = jelly.ParseListenAddress(m.GRPC.Listen)
+		if err != nil {
+			return fmt.Errorf("grpc: listen: %w", err)
+		}
+	}
+	cfg.TLS = jelly.TLSConfig{
+		Enabled:  m.TLS.Enabled,
+		CertFile: m.TLS.Cert,
+		KeyFile:  m.TLS.Key,
+		Autocert: jelly.AutocertConfig{
+			Enabled:      m.TLS.Autocert.Enabled,
+			Domains:      m.TLS.Autocert.Domains,
+			CacheDir:     m.TLS.Autocert.Cache,
+			Email:        m.TLS.Autocert.Email,
+			HTTPAddress:  m.TLS.Autocert.HTTPListen,
+			DirectoryURL: m.TLS.Autocert.Directory,
+		},
+	}
+	if m.TLS.Autocert.Challenge != "" {
+		cfg.TLS.Autocert.Challenge, err = jelly.ParseACMEChallenge(m.TLS.Autocert.Challenge)
+		if err != nil {
+			return fmt.Errorf("tls: autocert: challenge: %w", err)
+		}
+	}
+	cfg.IDs = jelly.IDConfig{Node: m.IDs.Node}
+	if m.IDs.Strategy != "" {
+		cfg.IDs.Strategy, err = jelly.ParseIDStrategy(m.IDs.Strategy)
+		if err != nil {
+			return fmt.Errorf("ids: strategy: %w", err)
+		}
+	}
+	cfg.Encryption = jelly.EncryptionConfig{}
+	for _, k := range m.Encryption.Keys {
+		cfg.Encryption.Keys = append(cfg.Encryption.Keys, jelly.EncryptionKeyConfig{ID: k.ID, Secret: k.Secret, SecretFile: k.SecretFile})
+	}
+	cfg.I18n = jelly.I18nConfig{
+		FallbackLocale: m.I18n.Fallback,
+		Catalogs:       m.I18n.Catalogs,
+	}
+	cfg.Info = jelly.InfoConfig{
+		Enabled: m.Info.Enabled,
+		Path:    m.Info.Path,
+		Name:    m.Info.Name,
+
+		VersionHeader: m.Info.VersionHeader,
+	}
+	cfg.Admin = jelly.AdminConfig{
+		Enabled: m.Admin.Enabled,
+		Path:    m.Admin.Path,
+
+		Profiling:     m.Admin.Profiling,
+		ProfilingPath: m.Admin.ProfilingPath,
+	}
+	cfg.CORS = unmarshalCORS(m.CORS)
+	cfg.RateLimit = unmarshalRateLimit(m.RateLimit)
+	cfg.Defaults = jelly.APIDefaults{
+		CORS:            unmarshalCORS(m.Defaults.CORS),
+		RateLimit:       unmarshalRateLimit(m.Defaults.RateLimit),
+		TimeoutMillis:   m.Defaults.Timeout,
+		SecurityHeaders: unmarshalSecurityHeaders(m.Defaults.SecurityHeaders),
+	}
+	cfg.ShutdownTimeoutMillis = m.Shutdown
+	cfg.HotRestart = m.HotRestart
+	cfg.ReloadConfig = m.Reload
+	cfg.RouteStats = m.RouteStats
+	cfg.UnauthLog = m.UnauthLog
+	cfg.RequireContentType = m.ContentType
+	cfg.MaxInFlight = m.InFlight
+	cfg.Profile = m.Profile
+	cfg.Fixtures = m.Fixtures
+	cfg.Middleware = m.Middleware
 
 	return nil
 }
@@ -475,9 +1344,132 @@ func unmarshalGlobals(cfg *jelly.Globals, m marshaledConfig) error {
 // marshalToConfig modifies the given marshaledConfig such that it would
 // re-create cfg when it is passed to unmarshal.
 func marshalGlobalsToConfig(cfg jelly.Globals, mc *marshaledConfig) {
-	mc.Listen = fmt.Sprintf("%s:%d", cfg.Address, cfg.Port)
+	mc.Listen = cfg.ListenAddress()
+	mc.ExtraListen = cfg.ExtraListen
 	mc.Base = cfg.URIBase
 	mc.Auth = cfg.MainAuthProvider
+	mc.Tenancy = marshaledTenancy{
+		Enabled: cfg.Tenancy.Enabled,
+		Header:  cfg.Tenancy.Header,
+		Domain:  cfg.Tenancy.Domain,
+	}
+	mc.Mirror = marshaledMirror{
+		Enabled:      cfg.Mirror.Enabled,
+		Target:       cfg.Mirror.Target,
+		SampleRate:   cfg.Mirror.SampleRate,
+		ScrubHeaders: cfg.Mirror.ScrubHeaders,
+		Timeout:      cfg.Mirror.TimeoutMillis,
+	}
+	mc.Breaker = marshaledBreaker{
+		FailureThreshold: cfg.Breaker.FailureThreshold,
+		ResetTimeout:     cfg.Breaker.ResetTimeoutMillis,
+		HalfOpenProbes:   cfg.Breaker.HalfOpenProbes,
+	}
+	mc.Quota = marshaledQuota{DB: cfg.Quota.DB, PersistInterval: cfg.Quota.PersistIntervalMillis}
+	if len(cfg.Quota.Limits) > 0 {
+		mc.Quota.Limits = make(map[string]marshaledQuotaLimit, len(cfg.Quota.Limits))
+		for name, ql := range cfg.Quota.Limits {
+			mc.Quota.Limits[name] = marshaledQuotaLimit{
+				Limit:      ql.Limit,
+				Period:     string(ql.Period),
+				PerRequest: ql.PerRequest,
+			}
+		}
+	}
+	if len(cfg.Flags.Rules) > 0 {
+		mc.Flags.Rules = make(map[string]marshaledFlagRule, len(cfg.Flags.Rules))
+		for name, fr := range cfg.Flags.Rules {
+			rule := marshaledFlagRule{
+				Enabled:    fr.Enabled,
+				Percentage: fr.Percentage,
+			}
+			for _, role := range fr.Roles {
+				rule.Roles = append(rule.Roles, role.String())
+			}
+			mc.Flags.Rules[name] = rule
+		}
+	}
+	mc.Webhooks = marshaledWebhooks{
+		Admin:       cfg.Webhooks.Admin,
+		Path:        cfg.Webhooks.Path,
+		Attempts:    cfg.Webhooks.Attempts,
+		RetryDelay:  cfg.Webhooks.RetryDelayMillis,
+		Timeout:     cfg.Webhooks.TimeoutMillis,
+		DeadLetters: cfg.Webhooks.DeadLetters,
+	}
+	for _, sub := range cfg.Webhooks.Subscriptions {
+		mc.Webhooks.Subscriptions = append(mc.Webhooks.Subscriptions, marshaledWebhookSubscription{
+			URL:    sub.URL,
+			Secret: sub.Secret,
+			Events: sub.Events,
+		})
+	}
+	mc.GRPC = marshaledGRPC{
+		Enabled:     cfg.GRPC.Enabled,
+		Auth:        cfg.GRPC.Authenticator,
+		RequireAuth: cfg.GRPC.RequireAuth,
+	}
+	if cfg.GRPC.Port != 0 {
+		mc.GRPC.Listen = net.JoinHostPort(cfg.GRPC.Address, strconv.Itoa(cfg.GRPC.Port))
+	}
+	mc.TLS = marshaledTLS{
+		Enabled: cfg.TLS.Enabled,
+		Cert:    cfg.TLS.CertFile,
+		Key:     cfg.TLS.KeyFile,
+		Autocert: marshaledAutocert{
+			Enabled:    cfg.TLS.Autocert.Enabled,
+			Domains:    cfg.TLS.Autocert.Domains,
+			Cache:      cfg.TLS.Autocert.CacheDir,
+			Email:      cfg.TLS.Autocert.Email,
+			Challenge:  cfg.TLS.Autocert.Challenge.String(),
+			HTTPListen: cfg.TLS.Autocert.HTTPAddress,
+			Directory:  cfg.TLS.Autocert.DirectoryURL,
+		},
+	}
+	mc.IDs = marshaledIDs{
+		Strategy: cfg.IDs.Strategy.String(),
+		Node:     cfg.IDs.Node,
+	}
+	mc.Encryption = marshaledEncryption{}
+	for _, k := range cfg.Encryption.Keys {
+		mc.Encryption.Keys = append(mc.Encryption.Keys, marshaledEncryptionKey{ID: k.ID, Secret: k.Secret, SecretFile: k.SecretFile})
+	}
+	mc.I18n = marshaledI18n{
+		Fallback: cfg.I18n.FallbackLocale,
+		Catalogs: cfg.I18n.Catalogs,
+	}
+	mc.Info = marshaledInfo{
+		Enabled: cfg.Info.Enabled,
+		Path:    cfg.Info.Path,
+		Name:    cfg.Info.Name,
+
+		VersionHeader: cfg.Info.VersionHeader,
+	}
+	mc.Admin = marshaledAdmin{
+		Enabled: cfg.Admin.Enabled,
+		Path:    cfg.Admin.Path,
+
+		Profiling:     cfg.Admin.Profiling,
+		ProfilingPath: cfg.Admin.ProfilingPath,
+	}
+	mc.CORS = marshalCORS(cfg.CORS)
+	mc.RateLimit = marshalRateLimit(cfg.RateLimit)
+	mc.Defaults = marshaledDefaults{
+		CORS:            marshalCORS(cfg.Defaults.CORS),
+		RateLimit:       marshalRateLimit(cfg.Defaults.RateLimit),
+		Timeout:         cfg.Defaults.TimeoutMillis,
+		SecurityHeaders: marshalSecurityHeaders(cfg.Defaults.SecurityHeaders),
+	}
+	mc.Shutdown = cfg.ShutdownTimeoutMillis
+	mc.HotRestart = cfg.HotRestart
+	mc.Reload = cfg.ReloadConfig
+	mc.RouteStats = cfg.RouteStats
+	mc.UnauthLog = cfg.UnauthLog
+	mc.ContentType = cfg.RequireContentType
+	mc.InFlight = cfg.MaxInFlight
+	mc.Profile = cfg.Profile
+	mc.Fixtures = cfg.Fixtures
+	mc.Middleware = cfg.Middleware
 }
 
 // unmarshal completely replaces all attributes except DBConnector with the
@@ -553,6 +1545,21 @@ func unmarshalDatabase(db *jelly.DatabaseConfig, m marshaledDatabase) error {
 	db.DataDir = m.Dir
 	db.DataFile = m.File
 	db.Connector = m.Connector
+	db.Connect = ""
+	if m.Connect != "" {
+		db.Connect, err = jelly.ParseConnectPolicy(m.Connect)
+		if err != nil {
+			return fmt.Errorf("connect: %w", err)
+		}
+	}
+	db.ConnectTimeoutMillis = m.ConnectTimeout
+	db.Replicas = nil
+	for _, r := range m.Replicas {
+		db.Replicas = append(db.Replicas, jelly.ReplicaConfig{DataDir: r.Dir, DataFile: r.File})
+	}
+	db.Failover = m.Failover
+	db.HealthCheckMillis = m.HealthCheck
+	db.Tags = m.Tags
 
 	return nil
 }
@@ -560,12 +1567,24 @@ func unmarshalDatabase(db *jelly.DatabaseConfig, m marshaledDatabase) error {
 // marshal converts db to the marshaledDatabase that would recreate it if
 // passed to unmarshal.
 func marshalDatabase(db jelly.DatabaseConfig) marshaledDatabase {
-	return marshaledDatabase{
+	m := marshaledDatabase{
 		Type:      db.Type.String(),
 		Dir:       db.DataDir,
 		File:      db.DataFile,
 		Connector: db.Connector,
+
+		Connect:        db.Connect.String(),
+		ConnectTimeout: db.ConnectTimeoutMillis,
+
+		Failover:    db.Failover,
+		HealthCheck: db.HealthCheckMillis,
+
+		Tags: db.Tags,
 	}
+	for _, r := range db.Replicas {
+		m.Replicas = append(m.Replicas, marshaledReplica{Dir: r.DataDir, File: r.DataFile})
+	}
+	return m
 }
 
 func (mc *marshaledConfig) unmarshalMap(m map[string]interface{}, unmarshalFn func([]byte, interface{}) error, marshalFn func(interface{}) ([]byte, error)) error {
@@ -575,11 +1594,27 @@ func (mc *marshaledConfig) unmarshalMap(m map[string]interface{}, unmarshalFn fu
 	}
 
 	if listen, ok := m["listen"]; ok {
-		listenStr, convOk := listen.(string)
-		if !convOk {
-			return fmt.Errorf("listen: should be a string but was of type %T", listen)
+		switch typed := listen.(type) {
+		case string:
+			mc.Listen = typed
+		case []interface{}:
+			if len(typed) == 0 {
+				return fmt.Errorf("listen: must give at least one address")
+			}
+			for i := range typed {
+				addrStr, convOk := typed[i].(string)
+				if !convOk {
+					return fmt.Errorf("listen[%d]: should be a string but was of type %T", i, typed[i])
+				}
+				if i == 0 {
+					mc.Listen = addrStr
+				} else {
+					mc.ExtraListen = append(mc.ExtraListen, addrStr)
+				}
+			}
+		default:
+			return fmt.Errorf("listen: should be a string or list of strings but was of type %T", listen)
 		}
-		mc.Listen = listenStr
 		delete(m, "listen")
 	}
 	if base, ok := m["base"]; ok {
@@ -605,6 +1640,348 @@ func (mc *marshaledConfig) unmarshalMap(m map[string]interface{}, unmarshalFn fu
 		}
 		delete(m, "logging")
 	}
+	if tenancyUntyped, ok := m["tenancy"]; ok {
+		tenancyObj, convOk := tenancyUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("tenancy: should be an object but was of type %T", tenancyUntyped)
+		}
+		encoded, err := marshalFn(tenancyObj)
+		if err != nil {
+			return fmt.Errorf("tenancy: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.Tenancy)
+		if err != nil {
+			return fmt.Errorf("tenancy: %w", err)
+		}
+		delete(m, "tenancy")
+	}
+	if mirrorUntyped, ok := m["mirror"]; ok {
+		mirrorObj, convOk := mirrorUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("mirror: should be an object but was of type %T", mirrorUntyped)
+		}
+		encoded, err := marshalFn(mirrorObj)
+		if err != nil {
+			return fmt.Errorf("mirror: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.Mirror)
+		if err != nil {
+			return fmt.Errorf("mirror: %w", err)
+		}
+		delete(m, "mirror")
+	}
+	if flagsUntyped, ok := m["flags"]; ok {
+		flagsObj, convOk := flagsUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("flags: should be an object but was of type %T", flagsUntyped)
+		}
+		encoded, err := marshalFn(flagsObj)
+		if err != nil {
+			return fmt.Errorf("flags: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.Flags)
+		if err != nil {
+			return fmt.Errorf("flags: %w", err)
+		}
+		delete(m, "flags")
+	}
+	if quotaUntyped, ok := m["quota"]; ok {
+		quotaObj, convOk := quotaUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("quota: should be an object but was of type %T", quotaUntyped)
+		}
+		encoded, err := marshalFn(quotaObj)
+		if err != nil {
+			return fmt.Errorf("quota: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.Quota)
+		if err != nil {
+			return fmt.Errorf("quota: %w", err)
+		}
+		delete(m, "quota")
+	}
+	if webhooksUntyped, ok := m["webhooks"]; ok {
+		webhooksObj, convOk := webhooksUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("webhooks: should be an object but was of type %T", webhooksUntyped)
+		}
+		encoded, err := marshalFn(webhooksObj)
+		if err != nil {
+			return fmt.Errorf("webhooks: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.Webhooks)
+		if err != nil {
+			return fmt.Errorf("webhooks: %w", err)
+		}
+		delete(m, "webhooks")
+	}
+	if breakerUntyped, ok := m["breaker"]; ok {
+		breakerObj, convOk := breakerUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("breaker: should be an object but was of type %T", breakerUntyped)
+		}
+		encoded, err := marshalFn(breakerObj)
+		if err != nil {
+			return fmt.Errorf("breaker: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.Breaker)
+		if err != nil {
+			return fmt.Errorf("breaker: %w", err)
+		}
+		delete(m, "breaker")
+	}
+	if grpcUntyped, ok := m["grpc"]; ok {
+		grpcObj, convOk := grpcUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("grpc: should be an object but was of type %T", grpcUntyped)
+		}
+		encoded, err := marshalFn(grpcObj)
+		if err != nil {
+			return fmt.Errorf("grpc: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.GRPC)
+		if err != nil {
+			return fmt.Errorf("grpc: %w", err)
+		}
+		delete(m, "grpc")
+	}
+	if tlsUntyped, ok := m["tls"]; ok {
+		tlsObj, convOk := tlsUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("tls: should be an object but was of type %T", tlsUntyped)
+		}
+		encoded, err := marshalFn(tlsObj)
+		if err != nil {
+			return fmt.Errorf("tls: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.TLS)
+		if err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+		delete(m, "tls")
+	}
+	if idsUntyped, ok := m["ids"]; ok {
+		idsObj, convOk := idsUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("ids: should be an object but was of type %T", idsUntyped)
+		}
+		encoded, err := marshalFn(idsObj)
+		if err != nil {
+			return fmt.Errorf("ids: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.IDs)
+		if err != nil {
+			return fmt.Errorf("ids: %w", err)
+		}
+		delete(m, "ids")
+	}
+	if encUntyped, ok := m["encryption"]; ok {
+		encObj, convOk := encUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("encryption: should be an object but was of type %T", encUntyped)
+		}
+		encoded, err := marshalFn(encObj)
+		if err != nil {
+			return fmt.Errorf("encryption: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.Encryption)
+		if err != nil {
+			return fmt.Errorf("encryption: %w", err)
+		}
+		delete(m, "encryption")
+	}
+	if i18nUntyped, ok := m["i18n"]; ok {
+		i18nObj, convOk := i18nUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("i18n: should be an object but was of type %T", i18nUntyped)
+		}
+		encoded, err := marshalFn(i18nObj)
+		if err != nil {
+			return fmt.Errorf("i18n: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.I18n)
+		if err != nil {
+			return fmt.Errorf("i18n: %w", err)
+		}
+		delete(m, "i18n")
+	}
+	if infoUntyped, ok := m["info"]; ok {
+		infoObj, convOk := infoUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("info: should be an object but was of type %T", infoUntyped)
+		}
+		encoded, err := marshalFn(infoObj)
+		if err != nil {
+			return fmt.Errorf("info: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.Info)
+		if err != nil {
+			return fmt.Errorf("info: %w", err)
+		}
+		delete(m, "info")
+	}
+	if adminUntyped, ok := m["admin"]; ok {
+		adminObj, convOk := adminUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("admin: should be an object but was of type %T", adminUntyped)
+		}
+		encoded, err := marshalFn(adminObj)
+		if err != nil {
+			return fmt.Errorf("admin: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.Admin)
+		if err != nil {
+			return fmt.Errorf("admin: %w", err)
+		}
+		delete(m, "admin")
+	}
+	if corsUntyped, ok := m["cors"]; ok {
+		corsObj, convOk := corsUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("cors: should be an object but was of type %T", corsUntyped)
+		}
+		encoded, err := marshalFn(corsObj)
+		if err != nil {
+			return fmt.Errorf("cors: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.CORS)
+		if err != nil {
+			return fmt.Errorf("cors: %w", err)
+		}
+		delete(m, "cors")
+	}
+	if rateLimitUntyped, ok := m["ratelimit"]; ok {
+		rateLimitObj, convOk := rateLimitUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("ratelimit: should be an object but was of type %T", rateLimitUntyped)
+		}
+		encoded, err := marshalFn(rateLimitObj)
+		if err != nil {
+			return fmt.Errorf("ratelimit: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.RateLimit)
+		if err != nil {
+			return fmt.Errorf("ratelimit: %w", err)
+		}
+		delete(m, "ratelimit")
+	}
+	if defaultsUntyped, ok := m["defaults"]; ok {
+		defaultsObj, convOk := defaultsUntyped.(map[string]interface{})
+		if !convOk {
+			return fmt.Errorf("defaults: should be an object but was of type %T", defaultsUntyped)
+		}
+		encoded, err := marshalFn(defaultsObj)
+		if err != nil {
+			return fmt.Errorf("defaults: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.Defaults)
+		if err != nil {
+			return fmt.Errorf("defaults: %w", err)
+		}
+		delete(m, "defaults")
+	}
+	if shutdownUntyped, ok := m["shutdown_timeout"]; ok {
+		// re-encode so that numbers decoded from JSON are handled the same
+		encoded, err := marshalFn(shutdownUntyped)
+		if err != nil {
+			return fmt.Errorf("shutdown_timeout: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.Shutdown)
+		if err != nil {
+			return fmt.Errorf("shutdown_timeout: %w", err)
+		}
+		delete(m, "shutdown_timeout")
+	}
+	if hotRestartUntyped, ok := m["hot_restart"]; ok {
+		hotRestart, convOk := hotRestartUntyped.(bool)
+		if !convOk {
+			return fmt.Errorf("hot_restart: should be a bool but was of type %T", hotRestartUntyped)
+		}
+		mc.HotRestart = hotRestart
+		delete(m, "hot_restart")
+	}
+	if reloadUntyped, ok := m["reload_config"]; ok {
+		reload, convOk := reloadUntyped.(bool)
+		if !convOk {
+			return fmt.Errorf("reload_config: should be a bool but was of type %T", reloadUntyped)
+		}
+		mc.Reload = reload
+		delete(m, "reload_config")
+	}
+	if routeStatsUntyped, ok := m["route_stats"]; ok {
+		routeStats, convOk := routeStatsUntyped.(bool)
+		if !convOk {
+			return fmt.Errorf("route_stats: should be a bool but was of type %T", routeStatsUntyped)
+		}
+		mc.RouteStats = routeStats
+		delete(m, "route_stats")
+	}
+	if unauthLogUntyped, ok := m["unauth_log"]; ok {
+		unauthLog, convOk := unauthLogUntyped.(string)
+		if !convOk {
+			return fmt.Errorf("unauth_log: should be a string but was of type %T", unauthLogUntyped)
+		}
+		mc.UnauthLog = unauthLog
+		delete(m, "unauth_log")
+	}
+	if contentTypeUntyped, ok := m["require_content_type"]; ok {
+		contentType, convOk := contentTypeUntyped.(bool)
+		if !convOk {
+			return fmt.Errorf("require_content_type: should be a bool but was of type %T", contentTypeUntyped)
+		}
+		mc.ContentType = contentType
+		delete(m, "require_content_type")
+	}
+	if inFlightUntyped, ok := m["max_in_flight"]; ok {
+		// re-encode so that numbers decoded from JSON are handled the same
+		encoded, err := marshalFn(inFlightUntyped)
+		if err != nil {
+			return fmt.Errorf("max_in_flight: re-encode: %w", err)
+		}
+		err = unmarshalFn(encoded, &mc.InFlight)
+		if err != nil {
+			return fmt.Errorf("max_in_flight: %w", err)
+		}
+		delete(m, "max_in_flight")
+	}
+	if profileUntyped, ok := m["profile"]; ok {
+		profile, convOk := profileUntyped.(string)
+		if !convOk {
+			return fmt.Errorf("profile: should be a string but was of type %T", profileUntyped)
+		}
+		mc.Profile = profile
+		delete(m, "profile")
+	}
+	if fixturesUntyped, ok := m["fixtures"]; ok && fixturesUntyped != nil {
+		fixturesSlice, convOk := fixturesUntyped.([]interface{})
+		if !convOk {
+			return fmt.Errorf("fixtures: should be a list but was of type %T", fixturesUntyped)
+		}
+		mc.Fixtures = make([]string, len(fixturesSlice))
+		for i := range fixturesSlice {
+			path, convOk := fixturesSlice[i].(string)
+			if !convOk {
+				return fmt.Errorf("fixtures: item #%d: should be a string but was of type %T", i+1, fixturesSlice[i])
+			}
+			mc.Fixtures[i] = path
+		}
+		delete(m, "fixtures")
+	}
+	if mwUntyped, ok := m["middleware"]; ok && mwUntyped != nil {
+		mwSlice, convOk := mwUntyped.([]interface{})
+		if !convOk {
+			return fmt.Errorf("middleware: should be a list but was of type %T", mwUntyped)
+		}
+		mc.Middleware = make([]string, len(mwSlice))
+		for i := range mwSlice {
+			name, convOk := mwSlice[i].(string)
+			if !convOk {
+				return fmt.Errorf("middleware: item #%d: should be a string but was of type %T", i+1, mwSlice[i])
+			}
+			mc.Middleware[i] = name
+		}
+		delete(m, "middleware")
+	}
 	if authProv, ok := m["authenticator"]; ok {
 		authProvStr, convOk := authProv.(string)
 		if !convOk {
@@ -681,6 +2058,16 @@ func (mc *marshaledConfig) unmarshalMap(m map[string]interface{}, unmarshalFn fu
 		delete(apiMap, "base")
 		delete(apiMap, "uses")
 		delete(apiMap, "enabled")
+		delete(apiMap, "component")
+		delete(apiMap, "capture")
+		delete(apiMap, "capture_buffer")
+		delete(apiMap, "capture_redact")
+		delete(apiMap, "max_in_flight")
+		delete(apiMap, "envelope")
+		delete(apiMap, "cors")
+		delete(apiMap, "ratelimit")
+		delete(apiMap, "timeout")
+		delete(apiMap, "security_headers")
 
 		api.others = map[string]interface{}{}
 		for k, v := range apiMap {
@@ -710,9 +2097,38 @@ func (mc marshaledConfig) marshalMap() interface{} {
 	}
 
 	m["logging"] = mc.Logging
+	m["tenancy"] = mc.Tenancy
+	m["mirror"] = mc.Mirror
+	m["breaker"] = mc.Breaker
+	m["quota"] = mc.Quota
+	m["flags"] = mc.Flags
+	m["webhooks"] = mc.Webhooks
+	m["grpc"] = mc.GRPC
+	m["tls"] = mc.TLS
+	m["ids"] = mc.IDs
+	m["encryption"] = mc.Encryption
+	m["i18n"] = mc.I18n
+	m["info"] = mc.Info
+	m["admin"] = mc.Admin
+	m["cors"] = mc.CORS
+	m["ratelimit"] = mc.RateLimit
+	m["defaults"] = mc.Defaults
+	m["shutdown_timeout"] = mc.Shutdown
+	m["hot_restart"] = mc.HotRestart
+	m["reload_config"] = mc.Reload
+	m["route_stats"] = mc.RouteStats
+	m["unauth_log"] = mc.UnauthLog
+	m["require_content_type"] = mc.ContentType
+	m["max_in_flight"] = mc.InFlight
+	m["profile"] = mc.Profile
+	m["fixtures"] = mc.Fixtures
+	m["middleware"] = mc.Middleware
 	m["base"] = mc.Base
 	m["dbs"] = mc.DBs
 	m["listen"] = mc.Listen
+	if len(mc.ExtraListen) > 0 {
+		m["listen"] = append([]string{mc.Listen}, mc.ExtraListen...)
+	}
 	m["authenticator"] = mc.Auth
 
 	return m
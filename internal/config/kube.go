@@ -0,0 +1,313 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+	"gopkg.in/yaml.v3"
+)
+
+// serviceAccountNamespaceFile is the file that Kubernetes mounts into every
+// pod with a service account token, giving the namespace of the pod.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// podMetaRegex matches a reference to pod metadata in a config file, such as
+// "${pod.namespace}".
+var podMetaRegex = regexp.MustCompile(`\$\{((?:pod|node)\.[A-Za-z_]+)\}`)
+
+// podMetaSources gives, for each pod metadata reference, the environment
+// variable it is read from. These are the names conventionally given to
+// downward API environment variables.
+var podMetaSources = map[string]string{
+	"pod.name":      "POD_NAME",
+	"pod.namespace": "POD_NAMESPACE",
+	"pod.ip":        "POD_IP",
+	"node.name":     "NODE_NAME",
+}
+
+// podMeta returns the value of the pod metadata with the given name, such as
+// "pod.namespace". If its environment variable is not set, the pod name falls
+// back to the hostname, which Kubernetes sets to the pod name, and the
+// namespace falls back to the one in the pod's service account.
+func podMeta(name string) (string, error) {
+	envVar, ok := podMetaSources[name]
+	if !ok {
+		return "", fmt.Errorf("${%s}: unknown pod metadata; must be one of ${pod.name}, ${pod.namespace}, ${pod.ip}, or ${node.name}", name)
+	}
+	if v := os.Getenv(envVar); v != "" {
+		return v, nil
+	}
+
+	switch name {
+	case "pod.name":
+		if host, err := os.Hostname(); err == nil && host != "" {
+			return host, nil
+		}
+	case "pod.namespace":
+		if ns, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+			return strings.TrimSpace(string(ns)), nil
+		}
+	}
+	return "", fmt.Errorf("${%s}: not known; set %s with the downward API", name, envVar)
+}
+
+// interpolatePodMeta replaces every reference to pod metadata in the string
+// values of data, which is in format f, with its value. Other "${...}"
+// sequences are left as-is, and data is returned unchanged if it has no
+// references.
+func interpolatePodMeta(f jelly.Format, data []byte) ([]byte, error) {
+	if !podMetaRegex.Match(data) {
+		return data, nil
+	}
+
+	var v interface{}
+	var err error
+	if f == jelly.JSON {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&v)
+	} else {
+		err = yaml.Unmarshal(data, &v)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v, err = interpolatePodMetaValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if f == jelly.JSON {
+		return json.Marshal(v)
+	}
+	return yaml.Marshal(v)
+}
+
+// interpolatePodMetaValue replaces every reference to pod metadata in the
+// strings in decoded value v with its value.
+func interpolatePodMetaValue(v interface{}) (interface{}, error) {
+	var err error
+
+	switch typed := v.(type) {
+	case []interface{}:
+		for i := range typed {
+			if typed[i], err = interpolatePodMetaValue(typed[i]); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for k := range typed {
+			if typed[k], err = interpolatePodMetaValue(typed[k]); err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+		}
+	case string:
+		replaced := podMetaRegex.ReplaceAllStringFunc(typed, func(ref string) string {
+			if err != nil {
+				return ref
+			}
+			var meta string
+			meta, err = podMeta(podMetaRegex.FindStringSubmatch(ref)[1])
+			return meta
+		})
+		if err != nil {
+			return nil, err
+		}
+		return replaced, nil
+	}
+	return v, nil
+}
+
+// podMetaKeys returns the dotted paths of every scalar and list value in
+// config data that refers to pod metadata. JSON is also valid YAML, so data in
+// every supported format is read the same way.
+func podMetaKeys(data []byte) (map[string]bool, error) {
+	keys := map[string]bool{}
+	if !podMetaRegex.Match(data) {
+		return keys, nil
+	}
+
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	addPodMetaKeys(v, "", keys)
+	return keys, nil
+}
+
+// addPodMetaKeys adds the dotted paths of every scalar and list value in
+// decoded config data v that refers to pod metadata to keys. path is the
+// dotted path of v.
+func addPodMetaKeys(v interface{}, path string, keys map[string]bool) {
+	if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+		for k, sub := range m {
+			subPath := strings.ToLower(k)
+			if path != "" {
+				subPath = path + "." + subPath
+			}
+			addPodMetaKeys(sub, subPath, keys)
+		}
+		return
+	}
+
+	if path != "" && refersToPodMeta(v) {
+		keys[path] = true
+	}
+}
+
+// refersToPodMeta returns whether decoded value v has a string in it that
+// refers to pod metadata.
+func refersToPodMeta(v interface{}) bool {
+	switch typed := v.(type) {
+	case string:
+		return podMetaRegex.MatchString(typed)
+	case []interface{}:
+		for _, elem := range typed {
+			if refersToPodMeta(elem) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, elem := range typed {
+			if refersToPodMeta(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// configFiles returns the config files in dir, in the order that they are
+// loaded. Files and directories whose names start with a "." are skipped, as
+// are those that are not in a supported format; this skips the hidden
+// "..data" entries that Kubernetes uses to update a mounted ConfigMap
+// atomically, while following the symlinks to the files in it.
+func configFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+
+	var files []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") || DetectFormat(e.Name()) == jelly.NoFormat {
+			continue
+		}
+		file := filepath.Join(dir, e.Name())
+
+		// stat to follow symlinks
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: directory does not contain any config files", dir)
+	}
+	return files, nil
+}
+
+// loadDir loads a configuration from every config file in dir. The files are
+// merged in order of their names, with later files taking precedence, and then
+// the overrides of the named profile are applied.
+func (env *Environment) loadDir(dir string, profile string) (jelly.Config, error) {
+	files, err := configFiles(dir)
+	if err != nil {
+		return jelly.Config{}, err
+	}
+
+	merged := map[string]interface{}{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return jelly.Config{}, fmt.Errorf("%s: %w", file, err)
+		}
+
+		// JSON is also valid YAML, so every supported format can be decoded
+		// as YAML.
+		var m map[string]interface{}
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return jelly.Config{}, fmt.Errorf("%s: %w", file, err)
+		}
+		mergeConfigMaps(merged, m)
+	}
+	if err := applyProfileMap(merged, profile); err != nil {
+		return jelly.Config{}, fmt.Errorf("%s: %w", dir, err)
+	}
+
+	envKeys := map[string]bool{}
+	addPodMetaKeys(merged, "", envKeys)
+	if _, err := interpolatePodMetaValue(merged); err != nil {
+		return jelly.Config{}, fmt.Errorf("%s: %w", dir, err)
+	}
+
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return jelly.Config{}, fmt.Errorf("%s: re-encode merged config: %w", dir, err)
+	}
+	cfg, err := decode(jelly.YAML, env, data, envKeys)
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", dir, err)
+	}
+	cfg.Format = DetectFormat(files[0])
+	return cfg, nil
+}
+
+// mergeConfigMaps merges src into dst. Maps present in both are merged
+// recursively; any other value in src replaces the one in dst.
+func mergeConfigMaps(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeConfigMaps(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// Fingerprint returns a value that changes whenever the config loaded from
+// path would, for detecting changes to it. path is a file or directory as
+// given to Load.
+func Fingerprint(path string) (string, error) {
+	files := []string{path}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	if info.IsDir() {
+		files, err = configFiles(path)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	h := sha256.New()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", file, err)
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.Base(file), len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+	"gopkg.in/yaml.v3"
+)
+
+// profilesKey is the top-level key of a config that holds the overrides for
+// each profile.
+const profilesKey = "profiles"
+
+// applyProfile removes the profile overrides from the config in data, which is
+// in format f, and merges the ones for the named profile over the rest of it.
+// If profile is "", the overrides are only removed. data is returned unchanged
+// if it has no overrides and no profile is given.
+func applyProfile(f jelly.Format, data []byte, profile string) ([]byte, error) {
+	var m map[string]interface{}
+	var err error
+	if f == jelly.JSON {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&m)
+	} else {
+		err = yaml.Unmarshal(data, &m)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := m[profilesKey]; !ok && profile == "" {
+		return data, nil
+	}
+
+	if err := applyProfileMap(m, profile); err != nil {
+		return nil, err
+	}
+
+	if f == jelly.JSON {
+		return json.Marshal(m)
+	}
+	return yaml.Marshal(m)
+}
+
+// applyProfileMap removes the profile overrides from the decoded config m and
+// merges the ones for the named profile over the rest of it. The profile of
+// the config is set to profile if it is not "". It is an error for m to have
+// overrides but none for profile; if m has none at all, any profile may be
+// given.
+func applyProfileMap(m map[string]interface{}, profile string) error {
+	rawProfiles, hasProfiles := m[profilesKey]
+	delete(m, profilesKey)
+
+	if profile == "" {
+		return nil
+	}
+	m["profile"] = profile
+
+	if !hasProfiles || rawProfiles == nil {
+		return nil
+	}
+	profiles, ok := rawProfiles.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: should be an object but was of type %T", profilesKey, rawProfiles)
+	}
+
+	var names []string
+	for name, overrides := range profiles {
+		if !strings.EqualFold(name, profile) {
+			names = append(names, name)
+			continue
+		}
+
+		if overrides == nil {
+			// defined with no overrides
+			return nil
+		}
+		overridesMap, ok := overrides.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s.%s: should be an object but was of type %T", profilesKey, name, overrides)
+		}
+
+		// a profile cannot select another one
+		delete(overridesMap, "profile")
+		mergeConfigMaps(m, overridesMap)
+		return nil
+	}
+
+	sort.Strings(names)
+	return fmt.Errorf("profile %q is not defined in %s; must be one of: %s", profile, profilesKey, strings.Join(names, ", "))
+}
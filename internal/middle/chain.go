@@ -0,0 +1,119 @@
+package middle
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dekarrin/jelly"
+)
+
+// authCounter counts the requests that a single authenticator was asked to
+// authenticate. A nil *authCounter counts nothing.
+type authCounter struct {
+	attempts   int64
+	identified int64
+	errors     int64
+}
+
+func (ac *authCounter) record(loggedIn bool, err error) {
+	if ac == nil {
+		return
+	}
+	atomic.AddInt64(&ac.attempts, 1)
+	if loggedIn {
+		atomic.AddInt64(&ac.identified, 1)
+	}
+	if err != nil {
+		atomic.AddInt64(&ac.errors, 1)
+	}
+}
+
+func (ac *authCounter) stats() jelly.AuthenticatorStats {
+	if ac == nil {
+		return jelly.AuthenticatorStats{}
+	}
+	return jelly.AuthenticatorStats{
+		Attempts:   atomic.LoadInt64(&ac.attempts),
+		Identified: atomic.LoadInt64(&ac.identified),
+		Errors:     atomic.LoadInt64(&ac.errors),
+	}
+}
+
+// authChain is a jelly.Authenticator that tries each of a list of
+// authenticators in order until one of them identifies the user.
+type authChain struct {
+	auths    []jelly.Authenticator
+	counters []*authCounter
+}
+
+// Authenticate calls Authenticate on each authenticator in the chain in order
+// and returns the user given by the first one that identifies them. If none
+// do, the first error that any of them returned is returned.
+func (ac authChain) Authenticate(req *http.Request) (jelly.AuthUser, bool, error) {
+	var firstErr error
+	for i := range ac.auths {
+		user, loggedIn, err := ac.auths[i].Authenticate(req)
+		ac.counters[i].record(loggedIn, err)
+		if loggedIn {
+			return user, true, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return jelly.AuthUser{}, false, firstErr
+}
+
+// UnauthDelay returns the longest UnauthDelay of the authenticators in the
+// chain, so that adding an authenticator to a chain never shortens the delay
+// given to clients who fail all of them.
+func (ac authChain) UnauthDelay() time.Duration {
+	var longest time.Duration
+	for _, a := range ac.auths {
+		if d := a.UnauthDelay(); d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// Service returns the UserLoginService of the first authenticator in the
+// chain.
+func (ac authChain) Service() jelly.UserLoginService {
+	return ac.auths[0].Service()
+}
+
+// replaceableAuth is the jelly.Authenticator that is registered under a name
+// in a Provider. It passes each call on to the authenticator that is currently
+// registered under the name, so that replacing it with
+// Provider.ReplaceAuthenticator affects middleware that was already created.
+type replaceableAuth struct {
+	mtx    sync.RWMutex
+	authen jelly.Authenticator
+}
+
+func (ra *replaceableAuth) current() jelly.Authenticator {
+	ra.mtx.RLock()
+	defer ra.mtx.RUnlock()
+	return ra.authen
+}
+
+func (ra *replaceableAuth) replace(authen jelly.Authenticator) {
+	ra.mtx.Lock()
+	defer ra.mtx.Unlock()
+	ra.authen = authen
+}
+
+func (ra *replaceableAuth) Authenticate(req *http.Request) (jelly.AuthUser, bool, error) {
+	return ra.current().Authenticate(req)
+}
+
+func (ra *replaceableAuth) UnauthDelay() time.Duration {
+	return ra.current().UnauthDelay()
+}
+
+func (ra *replaceableAuth) Service() jelly.UserLoginService {
+	return ra.current().Service()
+}
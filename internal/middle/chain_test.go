@@ -0,0 +1,159 @@
+package middle
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	mock_jelly "github.com/dekarrin/jelly/tools/mocks/jelly"
+)
+
+func Test_Provider_SelectAuthenticator_chain(t *testing.T) {
+	type aValues struct {
+		user     jelly.AuthUser
+		loggedIn bool
+		err      error
+	}
+
+	errBadKey := errors.New("bad API key")
+	errBadToken := errors.New("bad token")
+	user := jelly.AuthUser{Username: "tentacleTherapist"}
+
+	testCases := []struct {
+		name           string
+		from           []string
+		apikey         aValues
+		jwt            aValues
+		expectUser     jelly.AuthUser
+		expectLoggedIn bool
+		expectErr      error
+		expectAPIKey   jelly.AuthenticatorStats
+		expectJWT      jelly.AuthenticatorStats
+	}{
+		{
+			name:           "first identifies user",
+			from:           []string{"apikey", "jwt"},
+			apikey:         aValues{user: user, loggedIn: true},
+			expectUser:     user,
+			expectLoggedIn: true,
+			expectAPIKey:   jelly.AuthenticatorStats{Attempts: 1, Identified: 1},
+		},
+		{
+			name:           "falls back to second",
+			from:           []string{"apikey", "jwt"},
+			jwt:            aValues{user: user, loggedIn: true},
+			expectUser:     user,
+			expectLoggedIn: true,
+			expectAPIKey:   jelly.AuthenticatorStats{Attempts: 1},
+			expectJWT:      jelly.AuthenticatorStats{Attempts: 1, Identified: 1},
+		},
+		{
+			name:           "falls back to second after error",
+			from:           []string{"apikey", "jwt"},
+			apikey:         aValues{err: errBadKey},
+			jwt:            aValues{user: user, loggedIn: true},
+			expectUser:     user,
+			expectLoggedIn: true,
+			expectAPIKey:   jelly.AuthenticatorStats{Attempts: 1, Errors: 1},
+			expectJWT:      jelly.AuthenticatorStats{Attempts: 1, Identified: 1},
+		},
+		{
+			name:         "none identify user",
+			from:         []string{"apikey", "jwt"},
+			expectAPIKey: jelly.AuthenticatorStats{Attempts: 1},
+			expectJWT:    jelly.AuthenticatorStats{Attempts: 1},
+		},
+		{
+			name:         "first error is returned",
+			from:         []string{"apikey", "jwt"},
+			apikey:       aValues{err: errBadKey},
+			jwt:          aValues{err: errBadToken},
+			expectErr:    errBadKey,
+			expectAPIKey: jelly.AuthenticatorStats{Attempts: 1, Errors: 1},
+			expectJWT:    jelly.AuthenticatorStats{Attempts: 1, Errors: 1},
+		},
+		{
+			name:         "missing and repeated names are skipped",
+			from:         []string{"session", "JWT", "jwt"},
+			jwt:          aValues{err: errBadToken},
+			expectErr:    errBadToken,
+			expectJWT:    jelly.AuthenticatorStats{Attempts: 1, Errors: 1},
+			expectAPIKey: jelly.AuthenticatorStats{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			mockCtrl := gomock.NewController(t)
+
+			apikey := mock_jelly.NewMockAuthenticator(mockCtrl)
+			apikey.EXPECT().Authenticate(gomock.Any()).Return(tc.apikey.user, tc.apikey.loggedIn, tc.apikey.err).AnyTimes()
+			jwt := mock_jelly.NewMockAuthenticator(mockCtrl)
+			jwt.EXPECT().Authenticate(gomock.Any()).Return(tc.jwt.user, tc.jwt.loggedIn, tc.jwt.err).AnyTimes()
+
+			p := &Provider{}
+			assert.NoError(p.RegisterAuthenticator("apikey", apikey))
+			assert.NoError(p.RegisterAuthenticator("jwt", jwt))
+
+			actualUser, actualLoggedIn, actualErr := p.SelectAuthenticator(tc.from...).Authenticate(httptest.NewRequest("GET", "/", nil))
+
+			assert.Equal(tc.expectUser, actualUser)
+			assert.Equal(tc.expectLoggedIn, actualLoggedIn)
+			assert.Equal(tc.expectErr, actualErr)
+			assert.Equal(tc.expectAPIKey, p.AuthenticatorStats("apikey"))
+			assert.Equal(tc.expectJWT, p.AuthenticatorStats("jwt"))
+		})
+	}
+}
+
+func Test_authChain_UnauthDelay(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+
+	short := mock_jelly.NewMockAuthenticator(mockCtrl)
+	short.EXPECT().UnauthDelay().Return(time.Millisecond).AnyTimes()
+	long := mock_jelly.NewMockAuthenticator(mockCtrl)
+	long.EXPECT().UnauthDelay().Return(time.Second).AnyTimes()
+
+	p := &Provider{}
+	assert.NoError(p.RegisterAuthenticator("short", short))
+	assert.NoError(p.RegisterAuthenticator("long", long))
+
+	assert.Equal(time.Second, p.SelectAuthenticator("short", "long").UnauthDelay())
+	assert.Equal(time.Second, p.SelectAuthenticator("long", "short").UnauthDelay())
+	assert.Equal(time.Millisecond, p.SelectAuthenticator("short").UnauthDelay())
+}
+
+func Test_Provider_ReplaceAuthenticator(t *testing.T) {
+	assert := assert.New(t)
+	mockCtrl := gomock.NewController(t)
+
+	oldAuth := mock_jelly.NewMockAuthenticator(mockCtrl)
+	oldAuth.EXPECT().Authenticate(gomock.Any()).Return(jelly.AuthUser{Username: "old"}, true, nil).AnyTimes()
+	newAuth := mock_jelly.NewMockAuthenticator(mockCtrl)
+	newAuth.EXPECT().Authenticate(gomock.Any()).Return(jelly.AuthUser{Username: "new"}, true, nil).AnyTimes()
+
+	p := &Provider{}
+	assert.NoError(p.RegisterAuthenticator("jwt", oldAuth))
+	selected := p.SelectAuthenticator("jwt")
+
+	assert.NoError(p.ReplaceAuthenticator("JWT", newAuth))
+	assert.Error(p.ReplaceAuthenticator("jwt", nil))
+
+	user, _, _ := selected.Authenticate(httptest.NewRequest("GET", "/", nil))
+	assert.Equal("new", user.Username, "authenticator selected before replacement")
+	user, _, _ = p.SelectAuthenticator("jwt").Authenticate(httptest.NewRequest("GET", "/", nil))
+	assert.Equal("new", user.Username, "authenticator selected after replacement")
+	assert.Equal(jelly.AuthenticatorStats{Attempts: 2, Identified: 2}, p.AuthenticatorStats("jwt"))
+
+	// names that are not registered yet are registered
+	assert.NoError(p.ReplaceAuthenticator("apikey", oldAuth))
+	user, _, _ = p.SelectAuthenticator("apikey").Authenticate(httptest.NewRequest("GET", "/", nil))
+	assert.Equal("old", user.Username)
+}
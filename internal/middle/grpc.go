@@ -0,0 +1,122 @@
+package middle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCAuth returns interceptors that authenticate gRPC calls using the named
+// authenticator, or the main one for the project if name is empty. The
+// authenticator is given an HTTP request whose headers are the metadata of the
+// call, and the user it gives is set on the context of the call with
+// jelly.WithGRPCUser. If required is true, calls not made by a logged-in user
+// are rejected with codes.Unauthenticated; otherwise, they are allowed and
+// any error from the authenticator is logged to log.
+//
+// Unlike SelectAuthenticator, GRPCAuth returns an error instead of panicking if
+// the named authenticator does not exist.
+func (p *Provider) GRPCAuth(log jelly.Logger, required bool, name string) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor, error) {
+	p.initDefaults()
+
+	prov := p.getMainAuth()
+	if name != "" {
+		var ok bool
+		prov, ok = p.authenticators[strings.ToLower(name)]
+		if !ok {
+			return nil, nil, fmt.Errorf("no authenticator called %q has been registered", strings.ToLower(name))
+		}
+	}
+
+	ga := grpcAuthenticator{provider: prov, required: required, log: log}
+
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := ga.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := ga.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, authedStream{ServerStream: ss, ctx: ctx})
+	}
+
+	return unary, stream, nil
+}
+
+// grpcAuthenticator does the auth of gRPC calls for the interceptors returned
+// by GRPCAuth.
+type grpcAuthenticator struct {
+	provider jelly.Authenticator
+	required bool
+	log      jelly.Logger
+}
+
+// authenticate returns a copy of ctx with the logged-in user of the call set
+// on it. If the call must be authenticated and is not, a status error with
+// codes.Unauthenticated is returned.
+func (ga grpcAuthenticator) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fullMethod, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "create auth request: %v", err)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		// pseudo-headers are not given to the authenticator
+		if strings.HasPrefix(key, ":") {
+			continue
+		}
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	if pr, ok := peer.FromContext(ctx); ok && pr.Addr != nil {
+		req.RemoteAddr = pr.Addr.String()
+	}
+
+	user, loggedIn, err := ga.provider.Authenticate(req)
+
+	if ga.required && !loggedIn {
+		var msg string
+		if err != nil {
+			msg = err.Error()
+		} else {
+			msg = "authorization is required"
+		}
+		time.Sleep(ga.provider.UnauthDelay())
+		ga.log.Debugf("gRPC %s: unauthenticated: %s", fullMethod, msg)
+		return nil, status.Error(codes.Unauthenticated, msg)
+	} else if !ga.required && err != nil {
+		ga.log.Warnf("optional auth returned error: %v", err)
+	}
+
+	if loggedIn {
+		ctx = jelly.WithGRPCUser(ctx, user)
+	}
+	return ctx, nil
+}
+
+// authedStream is a grpc.ServerStream whose context has had the logged-in
+// user set on it.
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (as authedStream) Context() context.Context {
+	return as.ctx
+}
@@ -0,0 +1,119 @@
+package middle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	mock_jelly "github.com/dekarrin/jelly/tools/mocks/jelly"
+)
+
+func Test_Provider_GRPCAuth(t *testing.T) {
+	testCases := []struct {
+		name           string
+		required       bool
+		authUser       jelly.AuthUser
+		authLoggedIn   bool
+		authErr        error
+		expectCode     codes.Code
+		expectCalled   bool
+		expectUser     jelly.AuthUser
+		expectLoggedIn bool
+	}{
+		{
+			name:           "required - logged in",
+			required:       true,
+			authUser:       jelly.AuthUser{Username: "terezi"},
+			authLoggedIn:   true,
+			expectCode:     codes.OK,
+			expectCalled:   true,
+			expectUser:     jelly.AuthUser{Username: "terezi"},
+			expectLoggedIn: true,
+		},
+		{
+			name:       "required - not logged in",
+			required:   true,
+			expectCode: codes.Unauthenticated,
+		},
+		{
+			name:       "required - auth error",
+			required:   true,
+			authErr:    errors.New("bad token"),
+			expectCode: codes.Unauthenticated,
+		},
+		{
+			name:         "optional - not logged in",
+			required:     false,
+			expectCode:   codes.OK,
+			expectCalled: true,
+		},
+		{
+			name:         "optional - auth error",
+			required:     false,
+			authErr:      errors.New("bad token"),
+			expectCode:   codes.OK,
+			expectCalled: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			mockCtrl := gomock.NewController(t)
+			mockAuth := mock_jelly.NewMockAuthenticator(mockCtrl)
+			mockLogger := mock_jelly.NewMockLogger(mockCtrl)
+
+			mockAuth.EXPECT().
+				Authenticate(gomock.Any()).
+				DoAndReturn(func(req *http.Request) (jelly.AuthUser, bool, error) {
+					assert.Equal("Bearer some-token", req.Header.Get("Authorization"))
+					return tc.authUser, tc.authLoggedIn, tc.authErr
+				})
+			mockAuth.EXPECT().UnauthDelay().AnyTimes()
+			mockLogger.EXPECT().Debugf(gomock.Any(), gomock.Any()).AnyTimes()
+			mockLogger.EXPECT().Warnf(gomock.Any(), gomock.Any()).AnyTimes()
+
+			p := &Provider{}
+			p.RegisterAuthenticator("mock", mockAuth)
+
+			unary, _, err := p.GRPCAuth(mockLogger, tc.required, "mock")
+			if !assert.NoError(err) {
+				return
+			}
+
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer some-token"))
+			info := &grpc.UnaryServerInfo{FullMethod: "/jelly.Test/Call"}
+
+			var called bool
+			var actualUser jelly.AuthUser
+			var actualLoggedIn bool
+			_, err = unary(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				actualUser, actualLoggedIn = jelly.GRPCUserFromContext(ctx)
+				return nil, nil
+			})
+
+			assert.Equal(tc.expectCode, status.Code(err))
+			assert.Equal(tc.expectCalled, called)
+			assert.Equal(tc.expectUser, actualUser)
+			assert.Equal(tc.expectLoggedIn, actualLoggedIn)
+		})
+	}
+}
+
+func Test_Provider_GRPCAuth_unknownAuthenticator(t *testing.T) {
+	p := &Provider{}
+
+	_, _, err := p.GRPCAuth(nil, true, "nonexistent")
+
+	assert.Error(t, err)
+}
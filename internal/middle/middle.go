@@ -19,52 +19,27 @@ func (sf mwFunc) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	sf(w, req)
 }
 
-// ctxKey is a key in the context of a request populated by an AuthHandler.
+// ctxKey is a key in the context of a request populated by middleware. The
+// values that endpoints can read are kept in jelly.Context instead.
 type ctxKey int64
 
 const (
-	ctxKeyLoggedIn ctxKey = iota
-	ctxKeyUser
+	ctxKeyTenancy ctxKey = iota
 )
 
 func (ck ctxKey) String() string {
 	switch ck {
-	case ctxKeyLoggedIn:
-		return "loggedIn"
-	case ctxKeyUser:
-		return "user"
+	case ctxKeyTenancy:
+		return "tenancy"
 	default:
 		return fmt.Sprintf("ctxKey(%d)", int64(ck))
 	}
 }
 
+// GetLoggedInUser returns the logged-in user of req. It is the same as
+// calling jelly.ContextOf(req.Context()).LoggedInUser().
 func GetLoggedInUser(req *http.Request) (user jelly.AuthUser, loggedIn bool) {
-	ctx := req.Context()
-	loggedInUntyped := ctx.Value(ctxKeyLoggedIn)
-
-	if loggedInUntyped == nil {
-		return jelly.AuthUser{}, false
-	}
-
-	var ok bool
-	loggedIn, ok = loggedInUntyped.(bool)
-	if !ok {
-		panic(fmt.Sprintf("bad type in request context; %s should have type bool but actually has type %T", ctxKeyLoggedIn, loggedInUntyped))
-	}
-
-	if loggedIn {
-		userUntyped := ctx.Value(ctxKeyUser)
-		if userUntyped == nil {
-			panic(fmt.Sprintf("request context has value for %s but none for %s", ctxKeyLoggedIn, ctxKeyUser))
-		}
-
-		user, ok = userUntyped.(jelly.AuthUser)
-		if !ok {
-			panic(fmt.Sprintf("bad type in request context; %s should have type jelly.AuthUser but actually has type %T", ctxKeyUser, userUntyped))
-		}
-	}
-
-	return user, loggedIn
+	return jelly.ContextOf(req.Context()).LoggedInUser()
 }
 
 // Provider is used to create middleware in a jelly framework project.
@@ -72,6 +47,7 @@ func GetLoggedInUser(req *http.Request) (user jelly.AuthUser, loggedIn bool) {
 // instance of [jelly.Environment].
 type Provider struct {
 	authenticators    map[string]jelly.Authenticator
+	counters          map[string]*authCounter
 	mainAuthenticator string
 	DisableDefaults   bool
 }
@@ -81,36 +57,44 @@ func (p *Provider) initDefaults() {
 		p.authenticators = map[string]jelly.Authenticator{}
 		p.mainAuthenticator = ""
 	}
+	if p.counters == nil {
+		p.counters = map[string]*authCounter{}
+	}
 }
 
-// SelectAuthenticator retrieves and selects the first authenticator that
-// matches one of the names in from. If no names are provided in from, the main
-// auth for the project is returned. If from is not empty, at least one name
-// listed in it must exist, or this function will panic.
+// SelectAuthenticator returns an authenticator that tries each authenticator
+// named in from that exists, in the order they are given, until one of them
+// identifies the user. Names that do not match a registered authenticator are
+// skipped. If no names are provided in from, the main auth for the project is
+// returned. If from is not empty, at least one name listed in it must exist,
+// or this function will panic.
+//
+// The returned authenticator records the use of each authenticator it tries
+// in the stats given by AuthenticatorStats. Its UnauthDelay is the longest of
+// those of the authenticators it tries.
 func (p *Provider) SelectAuthenticator(from ...string) jelly.Authenticator {
 	p.initDefaults()
 
-	var authent jelly.Authenticator
-	if len(from) > 0 {
-		if len(p.authenticators) < 1 {
-			panic(fmt.Sprintf("no valid auth provider given in list: %q", from))
-		}
+	if len(from) < 1 {
+		return p.getMainAuth()
+	}
 
-		var ok bool
-		for _, authName := range from {
-			normName := strings.ToLower(authName)
-			authent, ok = p.authenticators[normName]
-			if ok {
-				break
-			}
+	var chain authChain
+	seen := map[string]bool{}
+	for _, authName := range from {
+		normName := strings.ToLower(authName)
+		authent, ok := p.authenticators[normName]
+		if !ok || seen[normName] {
+			continue
 		}
-		if !ok {
-			panic(fmt.Sprintf("no valid auth provider given in list: %q", from))
-		}
-	} else {
-		authent = p.getMainAuth()
+		seen[normName] = true
+		chain.auths = append(chain.auths, authent)
+		chain.counters = append(chain.counters, p.counters[normName])
+	}
+	if len(chain.auths) < 1 {
+		panic(fmt.Sprintf("no valid auth provider given in list: %q", from))
 	}
-	return authent
+	return chain
 }
 
 func (p *Provider) getMainAuth() jelly.Authenticator {
@@ -119,7 +103,18 @@ func (p *Provider) getMainAuth() jelly.Authenticator {
 	if p.mainAuthenticator == "" {
 		return noopAuthenticator{}
 	}
-	return p.authenticators[p.mainAuthenticator]
+	return authChain{
+		auths:    []jelly.Authenticator{p.authenticators[p.mainAuthenticator]},
+		counters: []*authCounter{p.counters[p.mainAuthenticator]},
+	}
+}
+
+// AuthenticatorStats returns the counts of requests that the named
+// authenticator has been asked to authenticate by authenticators returned from
+// the Provider. It returns zero stats if no authenticator with the name has
+// been registered.
+func (p *Provider) AuthenticatorStats(name string) jelly.AuthenticatorStats {
+	return p.counters[strings.ToLower(name)].stats()
 }
 
 func (p *Provider) RegisterMainAuthenticator(name string) error {
@@ -158,15 +153,36 @@ func (p *Provider) RegisterAuthenticator(name string, authen jelly.Authenticator
 		return fmt.Errorf("authenticator cannot be nil")
 	}
 
-	p.authenticators[normName] = authen
+	p.authenticators[normName] = &replaceableAuth{authen: authen}
+	p.counters[normName] = &authCounter{}
+	return nil
+}
+
+// ReplaceAuthenticator replaces the authenticator registered under name with
+// authen, or registers it if there is none. Middleware and authenticators
+// that were created from the Provider before it is replaced use the new one
+// from then on. Its stats are kept.
+func (p *Provider) ReplaceAuthenticator(name string, authen jelly.Authenticator) error {
+	p.initDefaults()
+
+	ra, ok := p.authenticators[strings.ToLower(name)].(*replaceableAuth)
+	if !ok {
+		return p.RegisterAuthenticator(name, authen)
+	}
+	if authen == nil {
+		return fmt.Errorf("authenticator cannot be nil")
+	}
+
+	ra.replace(authen)
 	return nil
 }
 
 // RequiredAuth returns middleware that requires that auth be used. The
-// authenticators, if provided, must give the names of preferred providers that
-// were registered as an jelly.Authenticator with this package, in priority order. If
-// none of the given authenticators exist, this function panics. If no
-// authenticator is specified, the one set as main for the project is used.
+// authenticators, if provided, must give the names of providers that were
+// registered as an jelly.Authenticator with this package, in the order they
+// are tried; see SelectAuthenticator. If none of the given authenticators
+// exist, this function panics. If no authenticator is specified, the one set
+// as main for the project is used.
 func (p Provider) RequiredAuth(resp jelly.ResponseGenerator, authenticators ...string) jelly.Middleware {
 	prov := p.SelectAuthenticator(authenticators...)
 
@@ -182,10 +198,10 @@ func (p Provider) RequiredAuth(resp jelly.ResponseGenerator, authenticators ...s
 
 // OptionalAuth returns middleware that allows auth be used to retrieved the
 // logged-in user. The authenticators, if provided, must give the names of
-// preferred providers that were registered as an jelly.Authenticator with this
-// package, in priority order. If none of the given authenticators exist, this
-// function panics. If no authenticator is specified, the one set as main for
-// the project is used.
+// providers that were registered as an jelly.Authenticator with this package,
+// in the order they are tried; see SelectAuthenticator. If none of the given
+// authenticators exist, this function panics. If no authenticator is
+// specified, the one set as main for the project is used.
 func (p Provider) OptionalAuth(resp jelly.ResponseGenerator, authenticators ...string) jelly.Middleware {
 	prov := p.SelectAuthenticator(authenticators...)
 
@@ -221,6 +237,24 @@ func (p Provider) DontPanic(resp jelly.ResponseGenerator) jelly.Middleware {
 	}
 }
 
+// ResolveTenant returns a Middleware that resolves the tenant of a request
+// from its header or subdomain as configured in tc and sets it as the current
+// tenant of the request context. Auth middleware that runs after it will
+// additionally resolve the tenant from the logged-in user if no tenant was
+// otherwise given, and will reject users who do not belong to the tenant that
+// was given.
+func (p Provider) ResolveTenant(tc jelly.TenancyConfig) jelly.Middleware {
+	return func(next http.Handler) http.Handler {
+		return mwFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := context.WithValue(req.Context(), ctxKeyTenancy, true)
+			if tenantID := tc.ResolveTenant(req); tenantID != "" {
+				ctx = jelly.WithTenant(ctx, tenantID)
+			}
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
 // noopAuthenticator is used as the active one when no others are specified.
 type noopAuthenticator struct{}
 
@@ -260,6 +294,9 @@ func (noop noopLoginService) CreateUser(ctx context.Context, username, password,
 func (noop noopLoginService) UpdateUser(ctx context.Context, curID, newID, username, email string, role jelly.Role) (jelly.AuthUser, error) {
 	return jelly.AuthUser{}, fmt.Errorf("UpdateUser called on noop")
 }
+func (noop noopLoginService) UpdateUserVersioned(ctx context.Context, curID, newID, username, email string, role jelly.Role, version int64) (jelly.AuthUser, error) {
+	return jelly.AuthUser{}, fmt.Errorf("UpdateUserVersioned called on noop")
+}
 func (noop noopLoginService) UpdatePassword(ctx context.Context, id, password string) (jelly.AuthUser, error) {
 	return jelly.AuthUser{}, fmt.Errorf("UpdatePassword called on noop")
 }
@@ -283,9 +320,33 @@ type authHandler struct {
 	resp     jelly.ResponseGenerator
 }
 
+// AuthRequirement returns whether h is the handler of auth middleware created
+// with RequiredAuth or OptionalAuth, and if so, whether it requires the client
+// to be logged in.
+func AuthRequirement(h http.Handler) (required bool, ok bool) {
+	ah, ok := h.(*authHandler)
+	if !ok {
+		return false, false
+	}
+	return ah.required, true
+}
+
 func (ah *authHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	user, loggedIn, err := ah.provider.Authenticate(req)
 
+	ctx := req.Context()
+	if tenancy, _ := ctx.Value(ctxKeyTenancy).(bool); tenancy && loggedIn {
+		if tenantID, ok := jelly.TenantFromContext(ctx); ok {
+			if user.TenantID != tenantID {
+				user = jelly.AuthUser{}
+				loggedIn = false
+				err = fmt.Errorf("user does not belong to tenant %q", tenantID)
+			}
+		} else if user.TenantID != "" {
+			ctx = jelly.WithTenant(ctx, user.TenantID)
+		}
+	}
+
 	if ah.required && !loggedIn {
 		// there was a validation error or no error but not logged in.
 		// if logging in is required, that's not okay.
@@ -305,9 +366,7 @@ func (ah *authHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		ah.resp.Logger().Warnf("optional auth returned error: %v", err)
 	}
 
-	ctx := req.Context()
-	ctx = context.WithValue(ctx, ctxKeyLoggedIn, loggedIn)
-	ctx = context.WithValue(ctx, ctxKeyUser, user)
+	ctx = jelly.WithLoggedInUser(ctx, user, loggedIn)
 	req = req.WithContext(ctx)
 	ah.next.ServeHTTP(w, req)
 }
@@ -1,7 +1,6 @@
 package middle
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -18,15 +17,9 @@ import (
 	mock_jelly "github.com/dekarrin/jelly/tools/mocks/jelly"
 )
 
-func reqWithContextValues(values map[ctxKey]interface{}) *http.Request {
+func reqWithLoggedInUser(user jelly.AuthUser, loggedIn bool) *http.Request {
 	req := httptest.NewRequest("", "/", nil)
-	ctx := req.Context()
-
-	for k, v := range values {
-		ctx = context.WithValue(ctx, k, v)
-	}
-
-	return req.WithContext(ctx)
+	return req.WithContext(jelly.WithLoggedInUser(req.Context(), user, loggedIn))
 }
 
 func ref[E any](v E) *E {
@@ -47,28 +40,20 @@ func Test_GetLoggedInUser(t *testing.T) {
 			expectLoggedIn: false,
 		},
 		{
-			name: "user is not logged in and user value not present",
-			req: reqWithContextValues(map[ctxKey]interface{}{
-				ctxKeyLoggedIn: false,
-			}),
+			name:           "user is not logged in",
+			req:            reqWithLoggedInUser(jelly.AuthUser{}, false),
 			expectUser:     jelly.AuthUser{},
 			expectLoggedIn: false,
 		},
 		{
-			name: "user is not logged in and user value is present",
-			req: reqWithContextValues(map[ctxKey]interface{}{
-				ctxKeyLoggedIn: false,
-				ctxKeyUser:     jelly.AuthUser{},
-			}),
+			name:           "user is not logged in and user value is present",
+			req:            reqWithLoggedInUser(jelly.AuthUser{Username: "ghostlyTrickster"}, false),
 			expectUser:     jelly.AuthUser{},
 			expectLoggedIn: false,
 		},
 		{
-			name: "user is logged in",
-			req: reqWithContextValues(map[ctxKey]interface{}{
-				ctxKeyUser:     jelly.AuthUser{Username: "ghostlyTrickster"},
-				ctxKeyLoggedIn: true,
-			}),
+			name:           "user is logged in",
+			req:            reqWithLoggedInUser(jelly.AuthUser{Username: "ghostlyTrickster"}, true),
 			expectUser:     jelly.AuthUser{Username: "ghostlyTrickster"},
 			expectLoggedIn: true,
 		},
@@ -377,13 +362,10 @@ func Test_Provider_RequireAuth(t *testing.T) {
 		handler.ServeHTTP(recorder, httptest.NewRequest("", "/", nil))
 
 		reqCtx := reqAfterMW.Context()
-		loggedIn := reqCtx.Value(ctxKeyLoggedIn)
-		user := reqCtx.Value(ctxKeyUser)
+		user, loggedIn := jelly.ContextOf(reqCtx).LoggedInUser()
 
-		assert.NotNil(loggedIn, "loggedIn key not set")
-		assert.NotNil(user, "user key not set")
-		assert.True(loggedIn.(bool), "loggedIn is not true")
-		assert.Equal(storedAuthUser.Username, user.(jelly.AuthUser).Username)
+		assert.True(loggedIn, "loggedIn is not true")
+		assert.Equal(storedAuthUser.Username, user.Username)
 	})
 
 	t.Run("user does not exist", func(t *testing.T) {
@@ -507,13 +489,10 @@ func Test_Provider_OptionalAuth(t *testing.T) {
 		handler.ServeHTTP(recorder, httptest.NewRequest("", "/", nil))
 
 		reqCtx := reqAfterMW.Context()
-		loggedIn := reqCtx.Value(ctxKeyLoggedIn)
-		user := reqCtx.Value(ctxKeyUser)
+		user, loggedIn := jelly.ContextOf(reqCtx).LoggedInUser()
 
-		assert.NotNil(loggedIn, "loggedIn key not set")
-		assert.NotNil(user, "user key not set")
-		assert.True(loggedIn.(bool), "loggedIn is not true")
-		assert.Equal(storedAuthUser.Username, user.(jelly.AuthUser).Username)
+		assert.True(loggedIn, "loggedIn is not true")
+		assert.Equal(storedAuthUser.Username, user.Username)
 	})
 
 	t.Run("user does not exist", func(t *testing.T) {
@@ -547,13 +526,10 @@ func Test_Provider_OptionalAuth(t *testing.T) {
 		handler.ServeHTTP(recorder, httptest.NewRequest("", "/", nil))
 
 		reqCtx := reqAfterMW.Context()
-		loggedIn := reqCtx.Value(ctxKeyLoggedIn)
-		user := reqCtx.Value(ctxKeyUser)
+		user, loggedIn := jelly.ContextOf(reqCtx).LoggedInUser()
 
-		assert.NotNil(loggedIn, "loggedIn key not set")
-		assert.NotNil(user, "user key not set")
-		assert.False(loggedIn.(bool), "loggedIn is not false")
-		assert.Empty(user.(jelly.AuthUser).Username, "user Username not empty")
+		assert.False(loggedIn, "loggedIn is not false")
+		assert.Empty(user.Username, "user Username not empty")
 	})
 
 	t.Run("Authenticate returns an error - log and treat as not logged in", func(t *testing.T) {
@@ -597,13 +573,10 @@ func Test_Provider_OptionalAuth(t *testing.T) {
 		handler.ServeHTTP(recorder, httptest.NewRequest("", "/", nil))
 
 		reqCtx := reqAfterMW.Context()
-		loggedIn := reqCtx.Value(ctxKeyLoggedIn)
-		user := reqCtx.Value(ctxKeyUser)
+		user, loggedIn := jelly.ContextOf(reqCtx).LoggedInUser()
 
-		assert.NotNil(loggedIn, "loggedIn key not set")
-		assert.NotNil(user, "user key not set")
-		assert.False(loggedIn.(bool), "loggedIn is not false")
-		assert.Empty(user.(jelly.AuthUser).Username, "user Username not empty")
+		assert.False(loggedIn, "loggedIn is not false")
+		assert.Empty(user.Username, "user Username not empty")
 	})
 }
 
@@ -692,6 +665,82 @@ func Test_Provider_DontPanic(t *testing.T) {
 	})
 }
 
+func Test_Provider_ResolveTenant(t *testing.T) {
+	testCases := []struct {
+		name         string
+		tc           jelly.TenancyConfig
+		host         string
+		headers      map[string]string
+		expectTenant string
+	}{
+		{
+			name:         "no tenant given",
+			tc:           jelly.TenancyConfig{Enabled: true, Header: "X-Tenant-ID"},
+			host:         "example.com",
+			expectTenant: "",
+		},
+		{
+			name:         "tenant from header",
+			tc:           jelly.TenancyConfig{Enabled: true, Header: "X-Tenant-ID"},
+			host:         "example.com",
+			headers:      map[string]string{"X-Tenant-ID": "acme"},
+			expectTenant: "acme",
+		},
+		{
+			name:         "tenant from subdomain",
+			tc:           jelly.TenancyConfig{Enabled: true, Header: "X-Tenant-ID", Domain: "example.com"},
+			host:         "acme.example.com:8080",
+			expectTenant: "acme",
+		},
+		{
+			name:         "only label below domain is used",
+			tc:           jelly.TenancyConfig{Enabled: true, Header: "X-Tenant-ID", Domain: "example.com"},
+			host:         "api.acme.example.com",
+			expectTenant: "acme",
+		},
+		{
+			name:         "header takes precedence over subdomain",
+			tc:           jelly.TenancyConfig{Enabled: true, Header: "X-Tenant-ID", Domain: "example.com"},
+			host:         "acme.example.com",
+			headers:      map[string]string{"X-Tenant-ID": "globex"},
+			expectTenant: "globex",
+		},
+		{
+			name:         "domain itself has no tenant",
+			tc:           jelly.TenancyConfig{Enabled: true, Header: "X-Tenant-ID", Domain: "example.com"},
+			host:         "example.com",
+			expectTenant: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var actualTenant string
+			var tenancySet bool
+			receiver := mwFunc(func(w http.ResponseWriter, r *http.Request) {
+				actualTenant, _ = jelly.TenantFromContext(r.Context())
+				tenancySet, _ = r.Context().Value(ctxKeyTenancy).(bool)
+			})
+
+			p := &Provider{}
+			handler := p.ResolveTenant(tc.tc)(receiver)
+
+			req := httptest.NewRequest("", "/", nil)
+			req.Host = tc.host
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.True(tenancySet)
+			assert.Equal(tc.expectTenant, actualTenant)
+		})
+	}
+}
+
 func Test_authHandler(t *testing.T) {
 	type aValues struct {
 		user     jelly.AuthUser
@@ -821,8 +870,7 @@ func Test_authHandler(t *testing.T) {
 			// assert
 			if tc.expectHandoff {
 				actualCtx := reqOnHandoff.Context()
-				user := actualCtx.Value(ctxKeyUser)
-				loggedIn := actualCtx.Value(ctxKeyLoggedIn)
+				user, loggedIn := jelly.ContextOf(actualCtx).LoggedInUser()
 
 				assert.Equal(tc.expectUser, user)
 				assert.Equal(tc.expectLoggedIn, loggedIn)
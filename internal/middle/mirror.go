@@ -0,0 +1,116 @@
+package middle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dekarrin/jelly"
+)
+
+const (
+	// mirrorBodyLimit is the largest request body that is mirrored. Requests
+	// with larger bodies are passed through without being mirrored.
+	mirrorBodyLimit = 1024 * 1024
+
+	// mirrorMaxInFlight is the maximum number of mirrored requests that may be
+	// pending at once. Requests received while this many are pending are not
+	// mirrored.
+	mirrorMaxInFlight = 64
+)
+
+// hopHeaders are the headers that apply only to a single connection and are
+// never copied to a mirrored request.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Mirror returns a Middleware that sends a copy of a sample of requests to the
+// upstream given in mc, as configured in mc. Mirrored requests are sent in the
+// background after the request has been passed to the next handler, and their
+// responses are discarded. Failures are logged to log at debug level.
+func (p Provider) Mirror(mc jelly.MirrorConfig, log jelly.Logger) jelly.Middleware {
+	target := strings.TrimSuffix(mc.Target, "/")
+	client := &http.Client{
+		Timeout: time.Duration(mc.TimeoutMillis) * time.Millisecond,
+
+		// the upstream's redirects are part of its response, which is ignored
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	inFlight := make(chan struct{}, mirrorMaxInFlight)
+
+	return func(next http.Handler) http.Handler {
+		return mwFunc(func(w http.ResponseWriter, req *http.Request) {
+			if mc.SampleRate < 1 && rand.Float64() >= mc.SampleRate {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			// copy the body so both the handler and the mirror can read it
+			var body []byte
+			if req.Body != nil && req.Body != http.NoBody {
+				var err error
+				body, err = io.ReadAll(io.LimitReader(req.Body, mirrorBodyLimit+1))
+				req.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+
+				if err != nil || len(body) > mirrorBodyLimit {
+					next.ServeHTTP(w, req)
+					return
+				}
+			}
+
+			mirrored, err := http.NewRequestWithContext(context.Background(), req.Method, target+req.URL.RequestURI(), bytes.NewReader(body))
+			if err != nil {
+				log.Debugf("mirror %s %s: create request: %v", req.Method, req.URL.RequestURI(), err)
+				next.ServeHTTP(w, req)
+				return
+			}
+			mirrored.Header = req.Header.Clone()
+			for _, h := range hopHeaders {
+				mirrored.Header.Del(h)
+			}
+			for _, h := range mc.ScrubHeaders {
+				mirrored.Header.Del(h)
+			}
+			mirrored.ContentLength = int64(len(body))
+
+			next.ServeHTTP(w, req)
+
+			select {
+			case inFlight <- struct{}{}:
+			default:
+				log.Debugf("mirror %s %s: skipped; too many mirrored requests pending", mirrored.Method, req.URL.RequestURI())
+				return
+			}
+
+			go func() {
+				defer func() { <-inFlight }()
+
+				resp, err := client.Do(mirrored)
+				if err != nil {
+					log.Debugf("mirror %s %s: %v", mirrored.Method, mirrored.URL.RequestURI(), err)
+					return
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}()
+		})
+	}
+}
@@ -8,10 +8,12 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
 )
 
 // API holds parameters for endpoints needed to run and a service layer that
@@ -29,7 +31,9 @@ type API interface {
 	// The API should not expect that any other API has yet been initialized,
 	// during a call to Init, and should not attempt to use auth middleware that
 	// relies on other APIs (such as jellyauth's jwt provider). Defer actual
-	// usage to another function, such as Routes.
+	// usage to another function, such as Routes. An API that needs the service
+	// of another API during Init can implement DependentAPI to be initialized
+	// after it.
 	Init(bndl Bundle) error
 
 	// Authenticators returns any configured authenticators that this API
@@ -69,6 +73,41 @@ type API interface {
 	Shutdown(ctx context.Context) error
 }
 
+// MiddlewareAPI is an interface that can optionally be implemented by an API
+// to install its own middleware for all of its routes, such as for
+// cross-cutting concerns like request validation or caching headers that every
+// endpoint in the API needs.
+type MiddlewareAPI interface {
+	API
+
+	// Middleware returns the middleware to apply to every route of the API, in
+	// the order that it should be applied. The server calls it once when the
+	// API's router is mounted, after Init has been called. The middleware runs
+	// after the server's global middleware and before any middleware or
+	// handlers that the API's router itself applies.
+	Middleware() []Middleware
+}
+
+// StartingAPI is an interface that can optionally be implemented by an API to
+// be notified once the server is live, such as to start background consumers,
+// announce itself to service discovery, or begin scheduled jobs only when the
+// server can actually serve requests. It complements Init, which is called
+// before the server is listening, and Shutdown.
+type StartingAPI interface {
+	API
+
+	// OnStart is called by ServeForever once the server's listener is
+	// accepting connections. The OnStart of every API is called in the order
+	// that the APIs were initialized in, one at a time, so it should return
+	// promptly and do any long-running work in a new goroutine. ctx is
+	// canceled when the server begins shutting down, and Shutdown is not
+	// called on any API until every OnStart has returned.
+	//
+	// If OnStart returns an error, it is logged and the server keeps serving.
+	// OnStart is not called if the server is only used through its Handler.
+	OnStart(ctx context.Context) error
+}
+
 type Component interface {
 	// Name returns the name of the component, which must be unique across all
 	// components that jelly is set up to use.
@@ -87,9 +126,304 @@ type Component interface {
 type RESTServer interface {
 	Config() Config
 	RoutesIndex() string
+	Routes() []RouteInfo
 	Add(name string, api API) error
+
+	// UseBefore inserts mw into the server's global middleware chain
+	// immediately before the middleware called before. The inserted
+	// middleware is given the name name, which must not already be in the
+	// chain, so that later calls can refer to it. before may be the name of a
+	// built-in middleware given in Globals.Middleware or of middleware that
+	// was previously added.
+	UseBefore(before string, name string, mw Middleware) error
+
+	// UseAfter inserts mw into the server's global middleware chain
+	// immediately after the middleware called after. It otherwise works the
+	// same as UseBefore.
+	UseAfter(after string, name string, mw Middleware) error
+
+	// OnResult registers hook to be called on the Result of every endpoint in
+	// the server that was created with ServiceProvider.Endpoint, before it is
+	// written to the client. Hooks registered for the whole server are called
+	// in the order they were registered, after any hooks that the endpoint's
+	// API registered with Bundle.OnResult.
+	OnResult(hook ResultHook)
+
+	// SetResponseGenerator replaces the ResponseGenerator of every endpoint in
+	// the server, and of the ServiceProvider given to each API's Routes, with
+	// the one that gen creates. It is called once for each API, so the base
+	// it is given has the API's envelope, and once for the server's own
+	// endpoints. Error messages are only localized with the server's message
+	// catalog if error bodies remain ErrorResponses. A nil gen restores the
+	// default.
+	SetResponseGenerator(gen ResponseGeneratorFunc)
+
+	// Captures returns the most recent requests to the named API that were
+	// recorded by its debug capture mode, oldest first. It returns nil if the
+	// API does not have capture enabled with a non-zero capture buffer.
+	Captures(api string) []CapturedRequest
+
+	// InFlight returns the current in-flight request counts of the named API,
+	// or of the server as a whole if api is the empty string. It returns zero
+	// stats if no in-flight limit is configured for it.
+	InFlight(api string) InFlightStats
+
+	// DBStats returns the statistics on the connection to the named DB, such
+	// as how many times it was connected to and whether it is connected now,
+	// for exporting to metrics systems. It returns zero stats if there is no
+	// DB with the name or if the server is a dry run that does not connect
+	// DBs.
+	DBStats(db string) DBStats
+
+	// AuthenticatorStats returns the counts of requests that the named
+	// Authenticator has been asked to authenticate, for exporting to metrics
+	// systems. Authenticators provided by APIs are named as the name of the
+	// API and the name of the authenticator separated by a dot, such as
+	// "jellyauth.jwt". It returns zero stats if there is no Authenticator with
+	// the name.
+	AuthenticatorStats(name string) AuthenticatorStats
+
+	// UnauthStats returns the counts of requests that the server has rejected
+	// with an HTTP-401, such as those to endpoints that require auth made by
+	// clients that are not logged in. Each is also logged to the file in
+	// Globals.UnauthLog if it is set.
+	UnauthStats() UnauthStats
+
+	// Events returns the EventBus that the server's APIs publish their events
+	// to. Programs can subscribe to it to be told of the events, and publish
+	// their own. Events are also delivered to the webhooks configured in
+	// Globals.Webhooks.
+	Events() *EventBus
+
+	// RegisterGRPCService registers a gRPC service that is not provided by an
+	// API to be served by the server, in addition to those of the enabled APIs
+	// that implement GRPCAPI. It must be called before the server begins
+	// serving, and has no effect unless gRPC is enabled in Globals.GRPC.
+	RegisterGRPCService(desc *grpc.ServiceDesc, impl interface{})
+
+	// Info returns information on the server, including the versions of jelly
+	// and of the enabled components, and build info of the program. It is the
+	// same information given by the info endpoint, if enabled.
+	Info() ServerInfo
+
+	// Certificates returns information on the certificates that the server
+	// obtains with ACME, one for each domain in Globals.TLS.Autocert, sorted
+	// by domain. It returns nil if autocert is not enabled.
+	Certificates() []CertificateInfo
+
+	// Handler returns the server's fully-mounted route tree, with the global
+	// middleware and every enabled API, as an http.Handler. It allows the
+	// server to be embedded in another program's mux, wrapped in additional
+	// middleware, or served by something other than ServeForever, such as a
+	// serverless adapter. Serving the Handler does not start the gRPC server;
+	// gRPC services are only served by ServeForever. Once Handler has been
+	// called, Shutdown may be used to shut down the APIs even if ServeForever
+	// was never called.
+	Handler() http.Handler
+
+	// Usage returns the resources used by the named API, including the
+	// goroutines it started with Bundle.Go and the requests made to it. It
+	// returns zero usage if there is no enabled API with the name.
+	Usage(api string) APIUsage
+
+	// DisableAPI disables the named API while the server is running, such as
+	// to stop a single misbehaving API during an incident without restarting
+	// the server. Every request to its routes is responded to with an
+	// HTTP-503 from then on, and its Shutdown method is called with ctx.
+	// Requests to it that were already in progress are not waited for. It
+	// returns an error if there is no enabled API with the name or if it is
+	// already disabled, or the error that Shutdown returns.
+	DisableAPI(ctx context.Context, name string) error
+
+	// EnableAPI re-enables an API that was disabled with DisableAPI. Its Init
+	// method is called again with a new Bundle, its routes are created again
+	// with its Routes method, and if the server is running, its OnStart is
+	// called again if it is a StartingAPI. The Authenticators that it provided
+	// when it was first initialized continue to be used. If Init returns an
+	// error, the API stays disabled.
+	EnableAPI(name string) error
+
+	// DisabledAPIs returns the names of the APIs that are currently disabled
+	// with DisableAPI, sorted alphabetically.
+	DisabledAPIs() []string
+
+	// Addr returns the address that the server is listening on, in
+	// "ADDRESS:PORT" form. Unlike the address in the config, it has the port
+	// that was actually bound, so it gives the ephemeral port chosen if
+	// Globals.Port is 0. It returns the empty string if the server is not
+	// currently listening.
+	Addr() string
+
 	ServeForever() error
 	Shutdown(ctx context.Context) error
+
+	// Run serves until ctx is done or the process receives SIGINT or SIGTERM,
+	// then shuts the server down gracefully, waiting up to the configured
+	// shutdown timeout. If a second signal is received during shutdown, the
+	// process exits immediately with ExitInterrupt. Run returns the exit code
+	// that the program should exit with: ExitSuccess if the server was shut
+	// down cleanly, or ExitError if it failed to start or to shut down.
+	//
+	// If hot restart is enabled in the config, Run also upgrades the server in
+	// place on SIGUSR2 by handing its listener to a new instance of the
+	// program before shutting down; see Globals.HotRestart.
+	Run(ctx context.Context) int
+
+	// Seed runs the seed functions that were registered with the
+	// Environment the server was created in for its enabled APIs and its
+	// configured profile. APIs are seeded in the order they were added, and
+	// the seed functions of each are run in the order they were registered.
+	// Then, the entities in the configured fixtures files are loaded. Seeding
+	// stops at the first seed function or fixture that fails.
+	Seed(ctx context.Context) error
+
+	// Plan returns what the server will serve once started: its DBs and the
+	// APIs bound to them, its global middleware, and every route along with
+	// the middleware applied to it. It does not start the server. It returns
+	// an error if the server could not be started as it is, such as when an
+	// API depends on one that was never added; the plan is still returned
+	// with as much as could be determined. Use it with a server created with
+	// Environment.NewDryRunServer to check a deployment's config without
+	// serving anything.
+	Plan() (ServerPlan, error)
+}
+
+// Exit codes returned by RESTServer.Run.
+const (
+	ExitSuccess   = 0
+	ExitError     = 1
+	ExitInterrupt = 3
+)
+
+// RouteInfo describes a single route that a RESTServer will respond to.
+type RouteInfo struct {
+	// API is the name of the API that the route belongs to.
+	API string
+
+	// Method is the HTTP method of the route, e.g. "GET".
+	Method string
+
+	// Path is the complete path of the route, including the server's URIBase
+	// and the API's base. Path parameters are given in "{name:type}" format as
+	// would be created with PathParam, or "{name:regex}" if no type shortcut
+	// matches.
+	Path string
+
+	// AuthRequired is whether the client must be logged in to use the route,
+	// as is the case when RequiredAuth middleware is applied to it.
+	AuthRequired bool
+
+	// AuthOptional is whether the route uses the logged-in user if there is
+	// one but allows clients that are not logged in, as is the case when
+	// OptionalAuth middleware is applied to it and RequiredAuth middleware is
+	// not.
+	AuthOptional bool
+
+	// Override is the Override that the route's endpoint was created with, or
+	// the combination of them as made by CombineOverrides if more than one was
+	// given. It is nil if the route's handler was not created with
+	// ServiceProvider.Endpoint.
+	Override *Override
+
+	// Middleware is the names of the middleware that is applied to the route
+	// specifically, such as by its API, in the order that it is applied. Auth middleware is named
+	// "RequiredAuth" or "OptionalAuth"; all other middleware is named for the
+	// function that created it. The server's global middleware, which is
+	// applied to every route, is not included; see Globals.Middleware.
+	Middleware []string
+
+	// Stats is the statistics on requests made to the route since the server
+	// started. It is nil if route stats are not enabled in the server's
+	// config.
+	Stats *RouteStats
+}
+
+// RouteStats is statistics on the requests made to a single route.
+type RouteStats struct {
+	// Requests is the number of requests that have been made to the route.
+	Requests int64
+
+	// Errors is the number of requests to the route whose response had a 5xx
+	// status code.
+	Errors int64
+
+	// P50 is the median latency of recent requests to the route.
+	P50 time.Duration
+
+	// P95 is the 95th percentile latency of recent requests to the route.
+	P95 time.Duration
+
+	// Bytes is the total size of the bodies of the responses from the route
+	// as they were sent, after any compression done by middleware applied to
+	// the route.
+	Bytes int64
+
+	// UncompressedBytes is the total size of the bodies of the responses from
+	// the route as they were written by Results, before any compression.
+	UncompressedBytes int64
+
+	// HandlerTime is the total time that the endpoint of the route took to
+	// return its Results.
+	HandlerTime time.Duration
+
+	// MarshalTime is the total time that the bodies of the Results of the
+	// route took to marshal.
+	MarshalTime time.Duration
+}
+
+// ErrorRate returns the fraction of requests to the route that failed, from 0
+// to 1. It returns 0 if no requests have been made.
+func (rs RouteStats) ErrorRate() float64 {
+	if rs.Requests == 0 {
+		return 0
+	}
+	return float64(rs.Errors) / float64(rs.Requests)
+}
+
+// InFlightStats is the state of an in-flight request limit, for use with
+// metrics systems.
+type InFlightStats struct {
+	// Limit is the maximum number of requests that are handled at once.
+	Limit int
+
+	// InFlight is the number of requests currently being handled.
+	InFlight int64
+
+	// Rejected is the number of requests that have been rejected with an
+	// HTTP-503 because the limit had already been reached.
+	Rejected int64
+}
+
+// CapturedRequest is a request and its response as recorded by the debug
+// capture mode of an API. Values of secret fields in the bodies have been
+// redacted, and bodies that are too long are truncated.
+type CapturedRequest struct {
+	// API is the name of the API that handled the request.
+	API string
+
+	// Time is the time that the request was received.
+	Time time.Time
+
+	// Duration is how long the request took to handle.
+	Duration time.Duration
+
+	// Method is the HTTP method of the request.
+	Method string
+
+	// URI is the request URI, including any query.
+	URI string
+
+	// RemoteAddr is the address of the client that made the request.
+	RemoteAddr string
+
+	// Status is the HTTP status code of the response.
+	Status int
+
+	// RequestBody is the body of the request.
+	RequestBody string
+
+	// ResponseBody is the body of the response.
+	ResponseBody string
 }
 
 // TODO: combine this bundle with the primary one
@@ -98,45 +432,388 @@ type Bundle struct {
 	g      Globals
 	logger Logger
 	dbs    map[string]Store
+
+	// shared between copies of the Bundle so that hooks registered on the
+	// copy given to Init are visible to the server.
+	resultHooks *[]ResultHook
+
+	// shared between copies of the Bundle so that every caller in the API
+	// gets the same Breaker for a name.
+	breakers *breakerRegistry
+
+	quotas   *QuotaManager
+	events   *EventBus
+	ids      IDGenerator
+	services ServiceLocator
+	flags    *Flags
+	goFunc   GoFunc
+	dryRun   bool
+	cipher   *FieldCipher
+	usesDBs  []string // nil if entries of the uses key are not resolved
 }
 
 func NewBundle(api APIConfig, g Globals, log Logger, dbs map[string]Store) Bundle {
 	return Bundle{
-		api:    api,
-		g:      g,
-		logger: log,
-		dbs:    dbs,
+		api:         api,
+		g:           g,
+		logger:      log,
+		dbs:         dbs,
+		resultHooks: new([]ResultHook),
+		breakers:    &breakerRegistry{},
 	}
 }
 
 func (bndl Bundle) WithDBs(dbs map[string]Store) Bundle {
 	return Bundle{
-		api:    bndl.api,
-		g:      bndl.g,
-		logger: bndl.logger,
-		dbs:    dbs,
+		api:         bndl.api,
+		g:           bndl.g,
+		logger:      bndl.logger,
+		dbs:         dbs,
+		resultHooks: bndl.resultHooks,
+		breakers:    bndl.breakers,
+		quotas:      bndl.quotas,
+		events:      bndl.events,
+		ids:         bndl.ids,
+		services:    bndl.services,
+		flags:       bndl.flags,
+		goFunc:      bndl.goFunc,
+		dryRun:      bndl.dryRun,
+		cipher:      bndl.cipher,
+		usesDBs:     bndl.usesDBs,
 	}
 }
 
+// WithUsesDBs returns a copy of the Bundle whose UsesDBs method returns names,
+// which are the names of the DBs that the entries of the API's uses key were
+// resolved to with ResolveUsesDBs.
+func (bndl Bundle) WithUsesDBs(names []string) Bundle {
+	newBndl := bndl
+	newBndl.usesDBs = names
+	return newBndl
+}
+
+// WithDryRun returns a copy of the Bundle whose DryRun method returns dryRun.
+func (bndl Bundle) WithDryRun(dryRun bool) Bundle {
+	newBndl := bndl
+	newBndl.dryRun = dryRun
+	return newBndl
+}
+
+// DryRun returns whether the API is being initialized for a server created
+// with Environment.NewDryRunServer, which will never serve it. An API that is
+// given a Bundle in dry-run mode should check its config as it normally would
+// but must not change anything outside of itself, such as by writing to its
+// DBs or starting background work. Unless the dry run connects DBs, DB,
+// DBNamed, LazyDB, and LazyDBNamed return nil, and the API should not use them.
+func (bndl Bundle) DryRun() bool {
+	return bndl.dryRun
+}
+
+// WithQuotas returns a copy of the Bundle whose Quotas method returns qm.
+func (bndl Bundle) WithQuotas(qm *QuotaManager) Bundle {
+	newBndl := bndl
+	newBndl.quotas = qm
+	return newBndl
+}
+
+// OnResult registers hook to be called on the Result of every endpoint in the
+// API that was created with ServiceProvider.Endpoint, before it is written to
+// the client. Hooks registered for the API are called in the order they were
+// registered, before any hooks registered for the whole server with
+// RESTServer.OnResult. OnResult must be called during the API's Init; hooks
+// registered after Init returns are not used.
+func (bndl Bundle) OnResult(hook ResultHook) {
+	if hook == nil {
+		return
+	}
+	*bndl.resultHooks = append(*bndl.resultHooks, hook)
+}
+
+// ResultHooks returns the hooks that were registered with OnResult, in the
+// order that they were registered.
+func (bndl Bundle) ResultHooks() []ResultHook {
+	if bndl.resultHooks == nil {
+		return nil
+	}
+	hooks := make([]ResultHook, len(*bndl.resultHooks))
+	copy(hooks, *bndl.resultHooks)
+	return hooks
+}
+
+// Breaker returns the circuit breaker with the given name, creating it with
+// the server's breaker config if it does not yet exist. Every call with the
+// same name in the same API returns the same Breaker, so an API typically uses
+// one name for each dependency that it calls. Changes in the state of the
+// Breaker are logged to the API's logger.
+func (bndl Bundle) Breaker(name string) *Breaker {
+	reg := bndl.breakers
+	if reg == nil {
+		// not created with NewBundle; nothing to share it with
+		return NewBreaker(name, bndl.g.Breaker)
+	}
+
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+
+	if b, ok := reg.breakers[name]; ok {
+		return b
+	}
+
+	b := NewBreaker(name, bndl.g.Breaker)
+	if log := bndl.logger; log != nil {
+		b.OnStateChange(func(b *Breaker, from, to BreakerState) {
+			if to == BreakerOpen {
+				log.Warnf("circuit breaker %q opened after failures", b.Name())
+			} else {
+				log.Infof("circuit breaker %q is now %s", b.Name(), to)
+			}
+		})
+	}
+	if reg.breakers == nil {
+		reg.breakers = map[string]*Breaker{}
+	}
+	reg.breakers[name] = b
+	return b
+}
+
+// Quotas returns the QuotaManager that tracks the usage of the quotas defined
+// in the server's config. It is shared by every API on the server. If the
+// Bundle was not given one with WithQuotas, nil is returned.
+func (bndl Bundle) Quotas() *QuotaManager {
+	return bndl.quotas
+}
+
+// WithEvents returns a copy of the Bundle whose Events method returns bus.
+func (bndl Bundle) WithEvents(bus *EventBus) Bundle {
+	newBndl := bndl
+	newBndl.events = bus
+	return newBndl
+}
+
+// Events returns the EventBus that the API publishes its events to and can
+// subscribe to the events of other APIs on. It is shared by every API on the
+// server. If the Bundle was not given one with WithEvents, nil is returned,
+// which discards published events.
+func (bndl Bundle) Events() *EventBus {
+	return bndl.events
+}
+
+// WithIDs returns a copy of the Bundle whose IDs method returns gen.
+func (bndl Bundle) WithIDs(gen IDGenerator) Bundle {
+	newBndl := bndl
+	newBndl.ids = gen
+	return newBndl
+}
+
+// IDs returns the IDGenerator for the ID strategy in the server's config, for
+// generating the IDs of entities that the API creates. It is shared by every
+// API on the server and by the stores that implement IDGeneratorStore. If the
+// Bundle was not given one with WithIDs, a generator of version 4 UUIDs is
+// returned.
+func (bndl Bundle) IDs() IDGenerator {
+	if bndl.ids == nil {
+		return defaultIDGenerator
+	}
+	return bndl.ids
+}
+
+// WithFieldCipher returns a copy of the Bundle whose FieldCipher method returns
+// fc.
+func (bndl Bundle) WithFieldCipher(fc *FieldCipher) Bundle {
+	newBndl := bndl
+	newBndl.cipher = fc
+	return newBndl
+}
+
+// FieldCipher returns the FieldCipher of the keys in the server's encryption
+// config, for encrypting sensitive values that the API stores itself. It is
+// shared by every API on the server and by the stores that implement
+// FieldCipherStore. It returns nil if no keys are configured; a nil
+// FieldCipher leaves values unencrypted.
+func (bndl Bundle) FieldCipher() *FieldCipher {
+	return bndl.cipher
+}
+
+// WithFlags returns a copy of the Bundle whose Flags method returns f.
+func (bndl Bundle) WithFlags(f *Flags) Bundle {
+	newBndl := bndl
+	newBndl.flags = f
+	return newBndl
+}
+
+// Flags returns the feature flags of the server, for checking whether a flag
+// is enabled for a user:
+//
+//	if bndl.Flags().Enabled("new-user-flow", user) {
+//		// ...
+//	}
+//
+// By default, flags are defined in the server's config; see FlagConfig. It is
+// shared by every API on the server. If the Bundle was not given one with
+// WithFlags, nil is returned, which has every flag disabled.
+func (bndl Bundle) Flags() *Flags {
+	return bndl.flags
+}
+
 func (bndl Bundle) Logger() Logger {
 	return bndl.logger
 }
 
 // DB gets the connection to the Nth DB listed in the API's uses. Panics if the API
-// config does not have at least n+1 entries.
+// config does not have at least n+1 entries. Returns nil in a dry run that does
+// not connect DBs; see DryRun.
+//
+// If the DB is not connected to eagerly, DB waits for it to be connected to,
+// and returns nil if it cannot be. APIs that use DBs that are connected to
+// lazily or on first use should call LazyDB instead and get the Store when it
+// is needed so that their Init does not wait for the connection.
+//
+// If the DB has replicas, DB returns the Store that writes went to when it was
+// called. APIs that use DBs with replicas should call ReplicatedDB instead to
+// have their reads go to the replicas and their writes fail over.
 func (bndl Bundle) DB(n int) Store {
 	dbName := bndl.UsesDBs()[n]
 	return bndl.DBNamed(dbName)
 }
 
 // NamedDB gets the exact DB with the given name. This will only return the DB if it
-// was configured as one of the used DBs for the API.
+// was configured as one of the used DBs for the API. See DB for how DBs that are
+// not connected to eagerly are handled.
 func (bndl Bundle) DBNamed(name string) Store {
-	return bndl.dbs[strings.ToLower(name)]
+	db := bndl.dbs[strings.ToLower(name)]
+	if ls, ok := db.(*LazyStore); ok {
+		store, err := ls.Get(context.Background())
+		if err != nil {
+			return nil
+		}
+		return writeStoreOf(store)
+	}
+	return writeStoreOf(db)
+}
+
+// ReplicatedDB gets the ReplicatedStore of the Nth DB listed in the API's uses,
+// which gives the Store of the DB or of one of its replicas for each
+// operation. If the DB has no replicas, the ReplicatedStore gives the DB's
+// Store for every operation. Panics if the API config does not have at least
+// n+1 entries. Returns nil in a dry run that does not connect DBs, or if the DB
+// could not be connected to; see DB.
+func (bndl Bundle) ReplicatedDB(n int) *ReplicatedStore {
+	dbName := bndl.UsesDBs()[n]
+	return bndl.ReplicatedDBNamed(dbName)
+}
+
+// ReplicatedDBNamed gets the ReplicatedStore of the DB with the given name. This
+// will only return the ReplicatedStore if the DB was configured as one of the
+// used DBs for the API.
+func (bndl Bundle) ReplicatedDBNamed(name string) *ReplicatedStore {
+	name = strings.ToLower(name)
+	db := bndl.dbs[name]
+	if ls, ok := db.(*LazyStore); ok {
+		var err error
+		db, err = ls.Get(context.Background())
+		if err != nil {
+			return nil
+		}
+	}
+	if db == nil {
+		return nil
+	}
+	if rs, ok := db.(*ReplicatedStore); ok {
+		return rs
+	}
+	return NewReplicatedStore(name, db, nil, false)
+}
+
+// LazyDB gets the LazyStore of the Nth DB listed in the API's uses, which
+// gives the DB's Store with LazyStore.Get once it is connected to. Panics if
+// the API config does not have at least n+1 entries. Returns nil in a dry run
+// that does not connect DBs; see DryRun.
+func (bndl Bundle) LazyDB(n int) *LazyStore {
+	dbName := bndl.UsesDBs()[n]
+	return bndl.LazyDBNamed(dbName)
+}
+
+// LazyDBNamed gets the LazyStore of the DB with the given name. This will only
+// return the LazyStore if the DB was configured as one of the used DBs for the
+// API.
+func (bndl Bundle) LazyDBNamed(name string) *LazyStore {
+	name = strings.ToLower(name)
+	db := bndl.dbs[name]
+	if db == nil {
+		return nil
+	}
+	if ls, ok := db.(*LazyStore); ok {
+		return ls
+	}
+	return connectedLazyStore(name, db)
+}
+
+// DBAs gets the Nth DB listed in the API's uses as a T, which is usually the
+// interface that the stores of the DB's connector implement:
+//
+//	authStore, err := jelly.DBAs[jelly.AuthUserStore](bndl, 0)
+//	if err != nil {
+//		return err
+//	}
+//
+// Unlike DB, it does not panic if the API uses fewer than n+1 DBs and does not
+// hide why a DB could not be gotten; its errors name the API, the DB, and T.
+// See NamedDBAs for how the DB is gotten.
+func DBAs[T any](bndl Bundle, n int) (T, error) {
+	uses := bndl.UsesDBs()
+	if n < 0 || n >= len(uses) {
+		var zero T
+		return zero, fmt.Errorf("API %q: uses %d DB(s); there is no DB #%d", bndl.Name(), len(uses), n)
+	}
+	return NamedDBAs[T](bndl, uses[n])
+}
+
+// NamedDBAs gets the DB with the given name as a T, which is usually the
+// interface that the stores of the DB's connector implement. The DB must be
+// one of those that the API uses. If it is not connected to eagerly, NamedDBAs
+// waits for it to be connected to. If it has replicas, the ReplicatedStore is
+// given if it is a T, and the Store that writes go to is given otherwise.
+//
+// It returns an error that names the API, the DB, and T if the API does not
+// use the DB, if the DB could not be connected to, or if its Store is not a T.
+// In a dry run that does not connect DBs, it returns the zero value of T and a
+// nil error.
+func NamedDBAs[T any](bndl Bundle, name string) (T, error) {
+	var zero T
+	name = strings.ToLower(name)
+
+	db, ok := bndl.dbs[name]
+	if !ok {
+		return zero, fmt.Errorf("API %q: DB %q is not one of the DBs it uses", bndl.Name(), name)
+	}
+	if ls, ok := db.(*LazyStore); ok {
+		var err error
+		db, err = ls.Get(context.Background())
+		if err != nil {
+			return zero, fmt.Errorf("API %q: %w", bndl.Name(), err)
+		}
+	}
+	if db == nil {
+		if bndl.dryRun {
+			return zero, nil
+		}
+		return zero, fmt.Errorf("API %q: DB %q is not connected", bndl.Name(), name)
+	}
+
+	if typed, ok := db.(T); ok {
+		return typed, nil
+	}
+	store := writeStoreOf(db)
+	typed, ok := store.(T)
+	if !ok {
+		return zero, fmt.Errorf("API %q: DB %q: store of type %T does not implement %s", bndl.Name(), name, store, reflect.TypeOf((*T)(nil)).Elem())
+	}
+	return typed, nil
 }
 
 // ServerPort returns the port that the server the API is being initialized for
-// will listen on.
+// will listen on. It is 0 if the server will listen on an ephemeral port, as
+// the port is not chosen until the server starts serving.
 func (bndl Bundle) ServerPort() int {
 	return bndl.g.Port
 }
@@ -192,6 +869,22 @@ func (bndl Bundle) Base() string {
 	return base
 }
 
+// Tenancy returns the configuration used to resolve the tenants of requests.
+func (bndl Bundle) Tenancy() TenancyConfig {
+	return bndl.g.Tenancy
+}
+
+// Tenant returns the tenant that req is being made on behalf of. If tenancy is
+// not enabled, or if no tenant could be resolved for the request, it returns ""
+// and false. Note that the tenant of the logged-in user is only resolved once
+// auth middleware has been applied to req.
+func (bndl Bundle) Tenant(req *http.Request) (tenantID string, ok bool) {
+	if !bndl.g.Tenancy.Enabled {
+		return "", false
+	}
+	return TenantFromContext(req.Context())
+}
+
 // Has returns whether the given key exists in the API config.
 func (bndl Bundle) Has(key string) bool {
 	return apiHas(bndl.api, key)
@@ -204,6 +897,22 @@ func (bndl Bundle) Name() string {
 	return bndl.Get(ConfigKeyAPIName)
 }
 
+// Component returns the name of the component that the API is an instance of,
+// as read from the API config. If the config does not give one, the API is the
+// component whose name is the same as its own, and its name is returned. When
+// the same component is used for more than one API, each instance is given its
+// own Name, so APIs that keep names of things that must be unique across the
+// server, such as authenticators, should base them on Name and not Component.
+//
+// This is a convenience function equivalent to calling
+// bnd.Get(KeyAPIComponent) and falling back to bnd.Name() if it is empty.
+func (bndl Bundle) Component() string {
+	if comp := bndl.Get(ConfigKeyAPIComponent); comp != "" {
+		return comp
+	}
+	return bndl.Name()
+}
+
 // APIBase returns the base path of the API that its routes are all mounted at.
 // It will perform any needed normalization of the base string to ensure that it
 // is non-empty, starts with a slash, and does not end with a slash except if it
@@ -227,11 +936,16 @@ func (bndl Bundle) APIBase() string {
 }
 
 // UsesDBs returns the list of database names that the API is configured to
-// connect to, in the order they were listed in config.
+// connect to, in the order they were listed in config. Entries that refer to
+// DBs by tag or pattern are replaced with the names of the DBs that they
+// match, as given by ResolveUsesDBs; each DB is listed only once.
 //
-// This is a convenience function equivalent to calling
-// bnd.GetSlice(KeyAPIUsesDBs).
+// If the Bundle was not given the resolved names with WithUsesDBs, this is a
+// convenience function equivalent to calling bnd.GetSlice(KeyAPIUsesDBs).
 func (bndl Bundle) UsesDBs() []string {
+	if bndl.usesDBs != nil {
+		return bndl.usesDBs
+	}
 	return bndl.GetSlice(ConfigKeyAPIUsesDBs)
 }
 
@@ -257,6 +971,18 @@ func (bndl Bundle) Get(key string) string {
 	return configGet[string](bndl.api, key)
 }
 
+// GetValue retrieves the value of an API configuration key without converting
+// it to any particular type. It is intended for keys whose values are of a type
+// that no other getter supports, such as those defined by a component. If it
+// doesn't exist in the config, nil is returned.
+func (bndl Bundle) GetValue(key string) interface{} {
+	if !bndl.Has(key) {
+		return nil
+	}
+
+	return bndl.api.Get(key)
+}
+
 // GetByteSlice retrieves the value of a []byte-typed API configuration key. If
 // it doesn't exist in the config, the zero-value is returned.
 func (bndl Bundle) GetByteSlice(key string) []byte {
@@ -577,6 +1303,50 @@ type Store interface {
 	Close() error
 }
 
+// ContextClosingStore is a Store whose Close can be given a deadline, such as
+// one that must flush data to disk before it is closed. The server closes
+// every DB with the context given to Shutdown, so a slow close does not hang
+// the shutdown of the server.
+type ContextClosingStore interface {
+	Store
+
+	// CloseContext is like Close but gives up once ctx is done, in which case
+	// it returns an error that matches ctx.Err(). The Store cannot be used
+	// again after CloseContext returns, even if it gave up before it was done.
+	CloseContext(ctx context.Context) error
+}
+
+// CloseStore closes s, giving up once ctx is done. If s is a
+// ContextClosingStore, CloseContext is called; otherwise s.Close is called and
+// is left to finish in the background if ctx is done first. If ctx is done
+// before s is closed, the returned error matches ctx.Err().
+func CloseStore(ctx context.Context, s Store) error {
+	if cs, ok := s.(ContextClosingStore); ok {
+		return cs.CloseContext(ctx)
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- s.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		return err
+	case <-ctx.Done():
+		return NewError("close did not finish", ctx.Err())
+	}
+}
+
+// StoreDecorator wraps a Store that was connected for the DB with the given
+// name in config, such as to log or time the calls made to its repos or to
+// retry them when they fail. It returns the Store that is given to APIs in its
+// place. APIs type-assert the Store to the interfaces they need, such as
+// AuthUserStore, so the returned Store must implement each of those that the
+// original one does; a decorator that only applies to some types of Store
+// should return the others as-is.
+type StoreDecorator func(db string, store Store) (Store, error)
+
 // Middleware is a function that takes a handler and returns a new handler which
 // wraps the given one and provides some additional functionality.
 type Middleware func(next http.Handler) http.Handler
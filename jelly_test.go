@@ -0,0 +1,187 @@
+package jelly
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DBAs(t *testing.T) {
+	primary := newHealthStore("primary")
+	closes := 0
+	failing := NewLazyStore("reports", ConnectOnFirstUse, 0, func() (Store, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	testCases := []struct {
+		name      string
+		dbs       map[string]Store
+		dryRun    bool
+		n         int
+		expectErr string
+		expectNil bool
+	}{
+		{
+			name: "store implements interface",
+			dbs:  map[string]Store{"main": primary},
+		},
+		{
+			name:      "index out of range",
+			dbs:       map[string]Store{"main": primary},
+			n:         1,
+			expectErr: `API "api": uses 1 DB(s); there is no DB #1`,
+		},
+		{
+			name:      "store does not implement interface",
+			dbs:       map[string]Store{"main": closeCountStore{closes: &closes}},
+			expectErr: `API "api": DB "main": store of type jelly.closeCountStore does not implement jelly.PingingStore`,
+		},
+		{
+			name:      "DB not given",
+			dbs:       map[string]Store{},
+			expectErr: `API "api": DB "main" is not one of the DBs it uses`,
+		},
+		{
+			name:      "DB not connected",
+			dbs:       map[string]Store{"main": nil},
+			expectErr: `API "api": DB "main" is not connected`,
+		},
+		{
+			name:      "DB not connected in dry run",
+			dbs:       map[string]Store{"main": nil},
+			dryRun:    true,
+			expectNil: true,
+		},
+		{
+			name:      "lazy DB fails to connect",
+			dbs:       map[string]Store{"main": failing},
+			expectErr: `API "api": connect DB "reports": connection refused`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			bndl := NewBundle((&CommonConfig{Name: "api", UsesDBs: []string{"main"}}).FillDefaults(), Globals{}, nil, tc.dbs).WithDryRun(tc.dryRun)
+
+			actual, err := DBAs[PingingStore](bndl, tc.n)
+			if tc.expectErr != "" {
+				assert.EqualError(err, tc.expectErr)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+			if tc.expectNil {
+				assert.Nil(actual)
+				return
+			}
+			assert.Equal("primary", actual.(healthStore).label)
+		})
+	}
+}
+
+func Test_NamedDBAs_replicated(t *testing.T) {
+	assert := assert.New(t)
+
+	primary, r0 := newHealthStore("primary"), newHealthStore("r0")
+	replicated := NewReplicatedStore("main", primary, []Store{r0}, false)
+
+	bndl := NewBundle((&CommonConfig{Name: "api", UsesDBs: []string{"main"}}).FillDefaults(), Globals{}, nil, map[string]Store{
+		"main": replicated,
+	})
+
+	// the ReplicatedStore itself is given when it is a T
+	rs, err := NamedDBAs[*ReplicatedStore](bndl, "MAIN")
+	assert.NoError(err)
+	assert.Same(replicated, rs)
+
+	// and the store that writes go to otherwise
+	hs, err := NamedDBAs[healthStore](bndl, "main")
+	assert.NoError(err)
+	assert.Equal("primary", hs.label)
+}
+
+// blockingStore is a Store whose Close blocks until release is closed.
+type blockingStore struct {
+	release chan struct{}
+}
+
+func (s blockingStore) Close() error {
+	<-s.release
+	return nil
+}
+
+// ctxCloseStore is a ContextClosingStore that records the context it is closed
+// with.
+type ctxCloseStore struct {
+	ctx *context.Context
+}
+
+func (s ctxCloseStore) Close() error { return nil }
+
+func (s ctxCloseStore) CloseContext(ctx context.Context) error {
+	*s.ctx = ctx
+	return ctx.Err()
+}
+
+func Test_CloseStore(t *testing.T) {
+	t.Run("closes in time", func(t *testing.T) {
+		assert := assert.New(t)
+
+		closes := 0
+		assert.NoError(CloseStore(context.Background(), closeCountStore{closes: &closes}))
+		assert.Equal(1, closes)
+	})
+
+	t.Run("gives up at deadline", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s := blockingStore{release: make(chan struct{})}
+		defer close(s.release)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := CloseStore(ctx, s)
+		assert.True(errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+	})
+
+	t.Run("uses CloseContext", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var got context.Context
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := CloseStore(ctx, ctxCloseStore{ctx: &got})
+		assert.ErrorIs(err, context.Canceled)
+		assert.Equal(ctx, got)
+	})
+}
+
+func Test_LazyStore_CloseContext(t *testing.T) {
+	assert := assert.New(t)
+
+	s := blockingStore{release: make(chan struct{})}
+	defer close(s.release)
+	ls := NewLazyStore("main", ConnectEager, 0, func() (Store, error) {
+		return s, nil
+	})
+	if _, err := ls.Get(context.Background()); !assert.NoError(err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := ls.CloseContext(ctx)
+	assert.True(errors.Is(err, context.DeadlineExceeded), "unexpected error: %v", err)
+	assert.False(ls.Connected())
+	_, err = ls.Get(context.Background())
+	assert.ErrorIs(err, ErrUnavailable)
+}
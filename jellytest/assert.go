@@ -0,0 +1,145 @@
+package jellytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/dekarrin/jelly"
+)
+
+// update is whether AssertResult writes the bodies of Results to their golden
+// files instead of comparing them. Set it by running the tests of a single
+// package with -jellytest.update.
+var update = flag.Bool("jellytest.update", false, "write the bodies of results checked by jellytest.AssertResult to their golden files")
+
+// TestingT is the part of *testing.T that the assertions of jellytest use.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Expect is what AssertResult expects of a Result. Each field that is left as
+// its zero value is not checked.
+type Expect struct {
+	// Status is the HTTP status code of the response.
+	Status int
+
+	// UserMsg is the message that is shown to the user in an error response.
+	// For JSON responses, it is the "error" property of the body; for others,
+	// it is the entire body.
+	UserMsg string
+
+	// InternalMsg is the message of the Result that is logged but not shown
+	// to the user.
+	InternalMsg string
+
+	// Golden is the path to a file that holds the expected body of the
+	// response. JSON bodies are compared and stored indented, so that the
+	// file is easy to review. If the tests are run with -jellytest.update,
+	// the file is written with the actual body instead.
+	Golden string
+}
+
+// AssertResult checks that r is what want expects, and reports each way that
+// it is not with t.Errorf. It returns whether r was as expected.
+func AssertResult(t TestingT, r jelly.Result, want Expect) bool {
+	t.Helper()
+
+	if r.Status == 0 {
+		t.Errorf("result has no status; it was not created by a ResponseGenerator")
+		return false
+	}
+
+	ok := true
+	if want.Status != 0 && r.Status != want.Status {
+		t.Errorf("status: expected %d, got %d (internal message: %q)", want.Status, r.Status, r.InternalMsg)
+		ok = false
+	}
+	if want.InternalMsg != "" && r.InternalMsg != want.InternalMsg {
+		t.Errorf("internal message: expected %q, got %q", want.InternalMsg, r.InternalMsg)
+		ok = false
+	}
+
+	if want.UserMsg == "" && want.Golden == "" {
+		return ok
+	}
+
+	body, err := resultBody(r)
+	if err != nil {
+		t.Errorf("could not write result: %v", err)
+		return false
+	}
+
+	if want.UserMsg != "" {
+		msg := string(body)
+		if r.IsJSON {
+			var errResp struct {
+				Error *string `json:"error"`
+			}
+			if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error == nil {
+				t.Errorf("user message: expected %q, but body has no error message: %s", want.UserMsg, body)
+				return false
+			}
+			msg = *errResp.Error
+		}
+		if msg != want.UserMsg {
+			t.Errorf("user message: expected %q, got %q", want.UserMsg, msg)
+			ok = false
+		}
+	}
+
+	if want.Golden != "" {
+		if r.IsJSON && len(body) > 0 {
+			var indented bytes.Buffer
+			if err := json.Indent(&indented, body, "", "  "); err != nil {
+				t.Errorf("body is not valid JSON: %v", err)
+				return false
+			}
+			indented.WriteByte('\n')
+			body = indented.Bytes()
+		}
+
+		if *update {
+			if err := os.MkdirAll(filepath.Dir(want.Golden), 0755); err != nil {
+				t.Errorf("could not update golden file: %v", err)
+				return false
+			}
+			if err := os.WriteFile(want.Golden, body, 0644); err != nil {
+				t.Errorf("could not update golden file: %v", err)
+				return false
+			}
+			return ok
+		}
+
+		expected, err := os.ReadFile(want.Golden)
+		if err != nil {
+			t.Errorf("could not read golden file (run with -jellytest.update to create it): %v", err)
+			return false
+		}
+		if !bytes.Equal(expected, body) {
+			t.Errorf("body does not match golden file %s (run with -jellytest.update to update it)\nexpected:\n%s\nactual:\n%s", want.Golden, expected, body)
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// resultBody returns the body that r gives when it is written as a response.
+func resultBody(r jelly.Result) (body []byte, err error) {
+	defer func() {
+		// WriteResponse panics if the body cannot be marshaled
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+
+	w := httptest.NewRecorder()
+	r.WriteResponse(w)
+	return w.Body.Bytes(), nil
+}
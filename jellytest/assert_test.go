@@ -0,0 +1,98 @@
+package jellytest
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT is a TestingT that records the errors reported to it.
+type recordingT struct {
+	errors []string
+}
+
+func (rt *recordingT) Helper() {}
+
+func (rt *recordingT) Errorf(format string, args ...interface{}) {
+	rt.errors = append(rt.errors, fmt.Sprintf(format, args...))
+}
+
+func Test_AssertResult(t *testing.T) {
+	rr := NewResponseRecorder()
+
+	testCases := []struct {
+		name         string
+		result       jelly.Result
+		expect       Expect
+		expectErrors int
+	}{
+		{
+			name:   "nothing checked",
+			result: rr.OK("hi"),
+			expect: Expect{},
+		},
+		{
+			name:   "matching error",
+			result: rr.Conflict("already exists", "user %s exists", "marty"),
+			expect: Expect{Status: http.StatusConflict, UserMsg: "already exists", InternalMsg: "user marty exists"},
+		},
+		{
+			name:         "every field wrong",
+			result:       rr.Conflict("already exists", "user %s exists", "marty"),
+			expect:       Expect{Status: http.StatusNotFound, UserMsg: "not found", InternalMsg: "user doc exists"},
+			expectErrors: 3,
+		},
+		{
+			name:   "text error",
+			result: rr.TextErr(http.StatusBadRequest, "plain message", "internal"),
+			expect: Expect{Status: http.StatusBadRequest, UserMsg: "plain message"},
+		},
+		{
+			name:         "user message of success",
+			result:       rr.OK(map[string]string{"name": "marty"}),
+			expect:       Expect{UserMsg: "bad"},
+			expectErrors: 1,
+		},
+		{
+			name:   "matching golden",
+			result: rr.Created(map[string]interface{}{"name": "marty", "id": 8}, "created"),
+			expect: Expect{Status: http.StatusCreated, Golden: filepath.Join("testdata", "created.json")},
+		},
+		{
+			name:         "different golden",
+			result:       rr.Created(map[string]interface{}{"name": "doc", "id": 8}, "created"),
+			expect:       Expect{Golden: filepath.Join("testdata", "created.json")},
+			expectErrors: 1,
+		},
+		{
+			name:         "missing golden",
+			result:       rr.Created(map[string]interface{}{"name": "doc", "id": 8}, "created"),
+			expect:       Expect{Golden: filepath.Join("testdata", "does-not-exist.json")},
+			expectErrors: 1,
+		},
+		{
+			name:         "not created by a generator",
+			result:       jelly.Result{},
+			expect:       Expect{Status: http.StatusOK},
+			expectErrors: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if *update && tc.expectErrors > 0 {
+				t.Skip("golden files are being updated")
+			}
+
+			rt := &recordingT{}
+			ok := AssertResult(rt, tc.result, tc.expect)
+
+			assert.Len(t, rt.errors, tc.expectErrors, "errors: %q", rt.errors)
+			assert.Equal(t, tc.expectErrors == 0, ok)
+		})
+	}
+}
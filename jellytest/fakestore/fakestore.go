@@ -0,0 +1,233 @@
+// Package fakestore provides fakes of the repos of the built-in authuser
+// stores whose contents and failures are set up declaratively, for testing
+// services that use them without scripting every call they make as a mock
+// would need:
+//
+//	users := fakestore.AuthUsers().
+//		WithUser(jelly.AuthUser{ID: id, Username: "marty"}).
+//		FailingOn("Update", jelly.ErrDB)
+//	store := fakestore.New().WithAuthUsers(users)
+//
+// Each fake keeps its entities in memory and behaves the same as the in-memory
+// authuser store, except that calls to a method that it is set to fail on
+// return the given error without doing anything. Every call to a method is
+// counted whether or not it fails, so tests can check how many were made with
+// Calls.
+//
+// The builder methods of the fakes panic if they are given a method that the
+// fake does not have or if an entity cannot be added, as either is a mistake
+// in the test that uses it.
+package fakestore
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dekarrin/jelly"
+	"github.com/google/uuid"
+)
+
+// Store is a fake jelly.Store that implements jelly.AuthUserStore,
+// jelly.ServiceAccountStore, jelly.SessionStore, and jelly.TwoFactorStore with
+// fake repos. The zero value is not ready for use; create one with New.
+type Store struct {
+	users      *AuthUserRepo
+	accounts   *ServiceAccountRepo
+	sessions   *SessionRepo
+	attempts   *LoginAttemptRepo
+	twoFactors *TwoFactorRepo
+}
+
+// New returns a new Store whose repos are all empty and never fail. Use the
+// With methods of the Store to give it repos that are set up otherwise.
+func New() *Store {
+	return &Store{
+		users:      AuthUsers(),
+		accounts:   ServiceAccounts(),
+		sessions:   Sessions(),
+		attempts:   LoginAttempts(),
+		twoFactors: TwoFactors(),
+	}
+}
+
+// WithAuthUsers sets the repo of users of s to r and returns s.
+func (s *Store) WithAuthUsers(r *AuthUserRepo) *Store {
+	s.users = r
+	return s
+}
+
+// WithServiceAccounts sets the repo of service accounts of s to r and returns
+// s.
+func (s *Store) WithServiceAccounts(r *ServiceAccountRepo) *Store {
+	s.accounts = r
+	return s
+}
+
+// WithSessions sets the repo of sessions of s to r and returns s.
+func (s *Store) WithSessions(r *SessionRepo) *Store {
+	s.sessions = r
+	return s
+}
+
+// WithLoginAttempts sets the repo of login attempts of s to r and returns s.
+func (s *Store) WithLoginAttempts(r *LoginAttemptRepo) *Store {
+	s.attempts = r
+	return s
+}
+
+// WithTwoFactors sets the repo of two-factor set ups of s to r and returns s.
+func (s *Store) WithTwoFactors(r *TwoFactorRepo) *Store {
+	s.twoFactors = r
+	return s
+}
+
+func (s *Store) AuthUsers() jelly.AuthUserRepo {
+	return s.users
+}
+
+func (s *Store) ServiceAccounts() jelly.ServiceAccountRepo {
+	return s.accounts
+}
+
+func (s *Store) Sessions() jelly.SessionRepo {
+	return s.sessions
+}
+
+func (s *Store) LoginAttempts() jelly.LoginAttemptRepo {
+	return s.attempts
+}
+
+func (s *Store) TwoFactors() jelly.TwoFactorRepo {
+	return s.twoFactors
+}
+
+// Close closes each repo of s. If any fail, the error of the first one to fail
+// is returned.
+func (s *Store) Close() error {
+	closers := []func() error{
+		s.users.Close, s.accounts.Close, s.sessions.Close, s.attempts.Close,
+		s.twoFactors.Close,
+	}
+
+	var err error
+	for _, c := range closers {
+		if closeErr := c(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// failure is an error that a method of a fake is set to fail with.
+type failure struct {
+	// call is the number of the call that fails, starting at 1. If it is 0,
+	// every call fails.
+	call int
+
+	err error
+}
+
+// script holds the failures that the methods of a fake are set to fail with
+// and counts the calls made to each method. It is safe for concurrent use.
+type script struct {
+	repo    string
+	methods map[string]bool
+
+	mtx   sync.Mutex
+	fails map[string][]failure
+	calls map[string]int
+}
+
+// newScript returns a script for the fake with the given name and methods.
+func newScript(repo string, methods ...string) *script {
+	s := &script{
+		repo:    repo,
+		methods: map[string]bool{},
+		fails:   map[string][]failure{},
+		calls:   map[string]int{},
+	}
+	for _, m := range methods {
+		s.methods[m] = true
+	}
+	return s
+}
+
+// checkMethod panics if the fake does not have the given method.
+func (s *script) checkMethod(method string) {
+	if !s.methods[method] {
+		panic(fmt.Sprintf("fakestore: %s has no method %q", s.repo, method))
+	}
+}
+
+// failOn sets the given call of method to fail with err. If call is 0, every
+// call fails. If more than one failure applies to a call, the one that was
+// set last is used.
+func (s *script) failOn(method string, call int, err error) {
+	s.checkMethod(method)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.fails[method] = append(s.fails[method], failure{call: call, err: err})
+}
+
+// failOnCall sets the nth call of method to fail with err. It panics if n is
+// not a valid call number.
+func (s *script) failOnCall(method string, n int, err error) {
+	if n < 1 {
+		panic(fmt.Sprintf("fakestore: call number must be at least 1 but got %d", n))
+	}
+	s.failOn(method, n, err)
+}
+
+// call counts a call to method and returns the error that it is set to fail
+// with, or nil if it does not fail.
+func (s *script) call(method string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.calls[method]++
+	n := s.calls[method]
+
+	var err error
+	for _, f := range s.fails[method] {
+		if f.call == 0 || f.call == n {
+			err = f.err
+		}
+	}
+	return err
+}
+
+// count returns the number of calls made to method.
+func (s *script) count(method string) int {
+	s.checkMethod(method)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.calls[method]
+}
+
+// seedIDs is the IDGenerator of the in-memory repo that a fake wraps. It
+// gives the ID of the entity being added by a builder method so that it is
+// kept, and random IDs otherwise.
+type seedIDs struct {
+	next uuid.UUID
+}
+
+func (g *seedIDs) NewID() (uuid.UUID, error) {
+	if g.next != uuid.Nil {
+		id := g.next
+		g.next = uuid.Nil
+		return id, nil
+	}
+	return uuid.NewRandom()
+}
+
+// mustSeed panics with a message about adding the entity of the given kind if
+// err is not nil.
+func mustSeed(kind string, err error) {
+	if err != nil {
+		panic(fmt.Sprintf("fakestore: could not add %s: %v", kind, err))
+	}
+}
@@ -0,0 +1,166 @@
+package fakestore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AuthUserRepo(t *testing.T) {
+	errBoom := errors.New("boom")
+	martyID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+	testCases := []struct {
+		name         string
+		repo         func() *AuthUserRepo
+		calls        int
+		expectErrs   []error
+		expectGetAll int
+	}{
+		{
+			name:         "seeded users are kept",
+			repo:         func() *AuthUserRepo { return AuthUsers().WithUser(jelly.AuthUser{ID: martyID, Username: "marty"}) },
+			calls:        2,
+			expectErrs:   []error{nil, nil},
+			expectGetAll: 1,
+		},
+		{
+			name: "failing on every call",
+			repo: func() *AuthUserRepo {
+				return AuthUsers().WithUser(jelly.AuthUser{ID: martyID, Username: "marty"}).FailingOn("Get", errBoom)
+			},
+			calls:        2,
+			expectErrs:   []error{errBoom, errBoom},
+			expectGetAll: 1,
+		},
+		{
+			name: "failing on one call",
+			repo: func() *AuthUserRepo {
+				return AuthUsers().WithUser(jelly.AuthUser{ID: martyID, Username: "marty"}).FailingOnCall("Get", 2, errBoom)
+			},
+			calls:        3,
+			expectErrs:   []error{nil, errBoom, nil},
+			expectGetAll: 1,
+		},
+		{
+			name: "later failures take precedence",
+			repo: func() *AuthUserRepo {
+				return AuthUsers().
+					WithUser(jelly.AuthUser{ID: martyID, Username: "marty"}).
+					FailingOn("Get", errBoom).
+					FailingOnCall("Get", 2, jelly.ErrDBConflict)
+			},
+			calls:        3,
+			expectErrs:   []error{errBoom, jelly.ErrDBConflict, errBoom},
+			expectGetAll: 1,
+		},
+		{
+			name: "archived users are hidden",
+			repo: func() *AuthUserRepo {
+				return AuthUsers().WithUser(jelly.AuthUser{ID: martyID, Username: "marty", Archived: time.Now()})
+			},
+			calls:        1,
+			expectErrs:   []error{jelly.ErrDBNotFound},
+			expectGetAll: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			ctx := context.Background()
+			repo := tc.repo()
+
+			for i := 0; i < tc.calls; i++ {
+				user, err := repo.Get(ctx, martyID)
+				if tc.expectErrs[i] != nil {
+					assert.ErrorIs(err, tc.expectErrs[i], "call #%d", i+1)
+					continue
+				}
+				if assert.NoError(err, "call #%d", i+1) {
+					assert.Equal("marty", user.Username, "call #%d", i+1)
+				}
+			}
+			assert.Equal(tc.calls, repo.Calls("Get"))
+
+			all, err := repo.GetAll(ctx)
+			assert.NoError(err)
+			assert.Len(all, tc.expectGetAll)
+			assert.Equal(1, repo.Calls("GetAll"))
+		})
+	}
+}
+
+func Test_AuthUserRepo_WithUser_duplicate(t *testing.T) {
+	assert.Panics(t, func() {
+		AuthUsers().WithUser(jelly.AuthUser{Username: "marty"}).WithUser(jelly.AuthUser{Username: "marty"})
+	})
+}
+
+func Test_script_unknownMethod(t *testing.T) {
+	testCases := []struct {
+		name string
+		call func()
+	}{
+		{name: "FailingOn", call: func() { AuthUsers().FailingOn("Upsert", errors.New("boom")) }},
+		{name: "FailingOnCall", call: func() { Sessions().FailingOnCall("GetAll", 1, errors.New("boom")) }},
+		{name: "FailingOnCall with bad call number", call: func() { TwoFactors().FailingOnCall("Get", 0, errors.New("boom")) }},
+		{name: "Calls", call: func() { LoginAttempts().Calls("Delete") }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Panics(t, tc.call)
+		})
+	}
+}
+
+func Test_Store(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+
+	userID := uuid.New()
+	sessionID := uuid.New()
+	accountID := uuid.New()
+	sessions := Sessions().WithSession(jelly.Session{ID: sessionID, UserID: userID, Expires: time.Now().Add(time.Hour)})
+
+	var st jelly.AuthUserStore = New().
+		WithAuthUsers(AuthUsers().WithUser(jelly.AuthUser{ID: userID, Username: "marty"})).
+		WithServiceAccounts(ServiceAccounts().WithAccount(jelly.ServiceAccount{ID: accountID, Name: "ci"})).
+		WithSessions(sessions).
+		WithLoginAttempts(LoginAttempts().WithAttempt(jelly.LoginAttempt{UserID: userID, Username: "marty", Success: true}).FailingOn("Close", errBoom)).
+		WithTwoFactors(TwoFactors().WithTwoFactor(jelly.TwoFactor{UserID: userID, Confirmed: true}))
+
+	user, err := st.AuthUsers().Get(ctx, userID)
+	assert.NoError(err)
+	assert.Equal("marty", user.Username)
+
+	account, err := st.(jelly.ServiceAccountStore).ServiceAccounts().GetByName(ctx, "ci")
+	assert.NoError(err)
+	assert.Equal(accountID, account.ID)
+
+	sessStore := st.(jelly.SessionStore)
+	userSessions, err := sessStore.Sessions().GetAllByUser(ctx, userID)
+	assert.NoError(err)
+	if assert.Len(userSessions, 1) {
+		assert.Equal(sessionID, userSessions[0].ID)
+	}
+	assert.Equal(1, sessions.Calls("GetAllByUser"))
+
+	attempts, err := sessStore.LoginAttempts().GetAllByUser(ctx, userID)
+	assert.NoError(err)
+	assert.Len(attempts, 1)
+
+	tf, err := st.(jelly.TwoFactorStore).TwoFactors().Get(ctx, userID)
+	assert.NoError(err)
+	assert.True(tf.Confirmed)
+
+	assert.ErrorIs(st.Close(), errBoom)
+	assert.Equal(1, sessions.Calls("Close"), "every repo is closed even if one fails")
+}
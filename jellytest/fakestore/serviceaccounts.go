@@ -0,0 +1,130 @@
+package fakestore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/authuserdao/inmem"
+	"github.com/google/uuid"
+)
+
+// ServiceAccountRepo is a fake jelly.ServiceAccountRepo. The zero value is
+// not ready for use; create one with ServiceAccounts. It is safe for
+// concurrent use.
+type ServiceAccountRepo struct {
+	script *script
+	ids    *seedIDs
+
+	mtx  sync.Mutex
+	repo *inmem.ServiceAccountRepo
+}
+
+// ServiceAccounts returns a new ServiceAccountRepo that has no service
+// accounts and never fails.
+func ServiceAccounts() *ServiceAccountRepo {
+	r := &ServiceAccountRepo{
+		script: newScript("ServiceAccountRepo",
+			"Create", "Get", "GetAll", "Update", "Delete", "GetByName", "Close",
+		),
+		ids:  &seedIDs{},
+		repo: inmem.NewServiceAccountRepository(),
+	}
+	r.repo.UseIDGenerator(r.ids)
+	return r
+}
+
+// WithAccount adds sa to the repo and returns the repo. It is stored as it
+// would be by Create, except that its ID is kept if it has one.
+func (r *ServiceAccountRepo) WithAccount(sa jelly.ServiceAccount) *ServiceAccountRepo {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.ids.next = sa.ID
+	_, err := r.repo.Create(context.Background(), sa)
+	mustSeed("service account "+sa.Name, err)
+	return r
+}
+
+// FailingOn sets every call to the given method to fail with err, and returns
+// the repo.
+func (r *ServiceAccountRepo) FailingOn(method string, err error) *ServiceAccountRepo {
+	r.script.failOn(method, 0, err)
+	return r
+}
+
+// FailingOnCall sets the nth call to the given method to fail with err, and
+// returns the repo. Calls are numbered from 1.
+func (r *ServiceAccountRepo) FailingOnCall(method string, n int, err error) *ServiceAccountRepo {
+	r.script.failOnCall(method, n, err)
+	return r
+}
+
+// Calls returns the number of calls that have been made to the given method,
+// including those that failed.
+func (r *ServiceAccountRepo) Calls(method string) int {
+	return r.script.count(method)
+}
+
+func (r *ServiceAccountRepo) Create(ctx context.Context, sa jelly.ServiceAccount) (jelly.ServiceAccount, error) {
+	if err := r.script.call("Create"); err != nil {
+		return jelly.ServiceAccount{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Create(ctx, sa)
+}
+
+func (r *ServiceAccountRepo) Get(ctx context.Context, id uuid.UUID) (jelly.ServiceAccount, error) {
+	if err := r.script.call("Get"); err != nil {
+		return jelly.ServiceAccount{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Get(ctx, id)
+}
+
+func (r *ServiceAccountRepo) GetAll(ctx context.Context) ([]jelly.ServiceAccount, error) {
+	if err := r.script.call("GetAll"); err != nil {
+		return nil, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.GetAll(ctx)
+}
+
+func (r *ServiceAccountRepo) Update(ctx context.Context, id uuid.UUID, sa jelly.ServiceAccount) (jelly.ServiceAccount, error) {
+	if err := r.script.call("Update"); err != nil {
+		return jelly.ServiceAccount{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Update(ctx, id, sa)
+}
+
+func (r *ServiceAccountRepo) Delete(ctx context.Context, id uuid.UUID) (jelly.ServiceAccount, error) {
+	if err := r.script.call("Delete"); err != nil {
+		return jelly.ServiceAccount{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Delete(ctx, id)
+}
+
+func (r *ServiceAccountRepo) GetByName(ctx context.Context, name string) (jelly.ServiceAccount, error) {
+	if err := r.script.call("GetByName"); err != nil {
+		return jelly.ServiceAccount{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.GetByName(ctx, name)
+}
+
+func (r *ServiceAccountRepo) Close() error {
+	if err := r.script.call("Close"); err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Close()
+}
@@ -0,0 +1,231 @@
+package fakestore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/authuserdao/inmem"
+	"github.com/google/uuid"
+)
+
+// SessionRepo is a fake jelly.SessionRepo. The zero value is not ready for
+// use; create one with Sessions. It is safe for concurrent use.
+type SessionRepo struct {
+	script *script
+	ids    *seedIDs
+
+	mtx  sync.Mutex
+	repo *inmem.SessionRepo
+}
+
+// Sessions returns a new SessionRepo that has no sessions and never fails.
+func Sessions() *SessionRepo {
+	r := &SessionRepo{
+		script: newScript("SessionRepo",
+			"Create", "Get", "GetAllByUser", "Update", "Delete", "DeleteAllByUser",
+			"Close",
+		),
+		ids:  &seedIDs{},
+		repo: inmem.NewSessionRepository(),
+	}
+	r.repo.UseIDGenerator(r.ids)
+	return r
+}
+
+// WithSession adds s to the repo and returns the repo. It is stored as it
+// would be by Create, except that its ID is kept if it has one.
+func (r *SessionRepo) WithSession(s jelly.Session) *SessionRepo {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.ids.next = s.ID
+	_, err := r.repo.Create(context.Background(), s)
+	mustSeed("session "+s.ID.String(), err)
+	return r
+}
+
+// FailingOn sets every call to the given method to fail with err, and returns
+// the repo.
+func (r *SessionRepo) FailingOn(method string, err error) *SessionRepo {
+	r.script.failOn(method, 0, err)
+	return r
+}
+
+// FailingOnCall sets the nth call to the given method to fail with err, and
+// returns the repo. Calls are numbered from 1.
+func (r *SessionRepo) FailingOnCall(method string, n int, err error) *SessionRepo {
+	r.script.failOnCall(method, n, err)
+	return r
+}
+
+// Calls returns the number of calls that have been made to the given method,
+// including those that failed.
+func (r *SessionRepo) Calls(method string) int {
+	return r.script.count(method)
+}
+
+func (r *SessionRepo) Create(ctx context.Context, s jelly.Session) (jelly.Session, error) {
+	if err := r.script.call("Create"); err != nil {
+		return jelly.Session{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Create(ctx, s)
+}
+
+func (r *SessionRepo) Get(ctx context.Context, id uuid.UUID) (jelly.Session, error) {
+	if err := r.script.call("Get"); err != nil {
+		return jelly.Session{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Get(ctx, id)
+}
+
+func (r *SessionRepo) GetAllByUser(ctx context.Context, userID uuid.UUID) ([]jelly.Session, error) {
+	if err := r.script.call("GetAllByUser"); err != nil {
+		return nil, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.GetAllByUser(ctx, userID)
+}
+
+func (r *SessionRepo) Update(ctx context.Context, id uuid.UUID, s jelly.Session) (jelly.Session, error) {
+	if err := r.script.call("Update"); err != nil {
+		return jelly.Session{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Update(ctx, id, s)
+}
+
+func (r *SessionRepo) Delete(ctx context.Context, id uuid.UUID) (jelly.Session, error) {
+	if err := r.script.call("Delete"); err != nil {
+		return jelly.Session{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Delete(ctx, id)
+}
+
+func (r *SessionRepo) DeleteAllByUser(ctx context.Context, userID uuid.UUID) ([]jelly.Session, error) {
+	if err := r.script.call("DeleteAllByUser"); err != nil {
+		return nil, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.DeleteAllByUser(ctx, userID)
+}
+
+func (r *SessionRepo) Close() error {
+	if err := r.script.call("Close"); err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Close()
+}
+
+// LoginAttemptRepo is a fake jelly.LoginAttemptRepo. The zero value is not
+// ready for use; create one with LoginAttempts. It is safe for concurrent use.
+type LoginAttemptRepo struct {
+	script *script
+	ids    *seedIDs
+
+	mtx  sync.Mutex
+	repo *inmem.LoginAttemptRepo
+}
+
+// LoginAttempts returns a new LoginAttemptRepo that has no login attempts and
+// never fails.
+func LoginAttempts() *LoginAttemptRepo {
+	r := &LoginAttemptRepo{
+		script: newScript("LoginAttemptRepo",
+			"Create", "GetAll", "GetAllByUser", "DeleteBefore", "Close",
+		),
+		ids:  &seedIDs{},
+		repo: inmem.NewLoginAttemptRepository(),
+	}
+	r.repo.UseIDGenerator(r.ids)
+	return r
+}
+
+// WithAttempt adds la to the repo and returns the repo. It is stored as it
+// would be by Create, except that its ID is kept if it has one.
+func (r *LoginAttemptRepo) WithAttempt(la jelly.LoginAttempt) *LoginAttemptRepo {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.ids.next = la.ID
+	_, err := r.repo.Create(context.Background(), la)
+	mustSeed("login attempt of "+la.Username, err)
+	return r
+}
+
+// FailingOn sets every call to the given method to fail with err, and returns
+// the repo.
+func (r *LoginAttemptRepo) FailingOn(method string, err error) *LoginAttemptRepo {
+	r.script.failOn(method, 0, err)
+	return r
+}
+
+// FailingOnCall sets the nth call to the given method to fail with err, and
+// returns the repo. Calls are numbered from 1.
+func (r *LoginAttemptRepo) FailingOnCall(method string, n int, err error) *LoginAttemptRepo {
+	r.script.failOnCall(method, n, err)
+	return r
+}
+
+// Calls returns the number of calls that have been made to the given method,
+// including those that failed.
+func (r *LoginAttemptRepo) Calls(method string) int {
+	return r.script.count(method)
+}
+
+func (r *LoginAttemptRepo) Create(ctx context.Context, la jelly.LoginAttempt) (jelly.LoginAttempt, error) {
+	if err := r.script.call("Create"); err != nil {
+		return jelly.LoginAttempt{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Create(ctx, la)
+}
+
+func (r *LoginAttemptRepo) GetAll(ctx context.Context) ([]jelly.LoginAttempt, error) {
+	if err := r.script.call("GetAll"); err != nil {
+		return nil, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.GetAll(ctx)
+}
+
+func (r *LoginAttemptRepo) GetAllByUser(ctx context.Context, userID uuid.UUID) ([]jelly.LoginAttempt, error) {
+	if err := r.script.call("GetAllByUser"); err != nil {
+		return nil, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.GetAllByUser(ctx, userID)
+}
+
+func (r *LoginAttemptRepo) DeleteBefore(ctx context.Context, t time.Time) error {
+	if err := r.script.call("DeleteBefore"); err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.DeleteBefore(ctx, t)
+}
+
+func (r *LoginAttemptRepo) Close() error {
+	if err := r.script.call("Close"); err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Close()
+}
@@ -0,0 +1,104 @@
+package fakestore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/authuserdao/inmem"
+	"github.com/google/uuid"
+)
+
+// TwoFactorRepo is a fake jelly.TwoFactorRepo. The zero value is not ready
+// for use; create one with TwoFactors. It is safe for concurrent use.
+type TwoFactorRepo struct {
+	script *script
+
+	mtx  sync.Mutex
+	repo *inmem.TwoFactorRepo
+}
+
+// TwoFactors returns a new TwoFactorRepo that has no two-factor set ups and
+// never fails.
+func TwoFactors() *TwoFactorRepo {
+	return &TwoFactorRepo{
+		script: newScript("TwoFactorRepo", "Create", "Get", "Update", "Delete", "Close"),
+		repo:   inmem.NewTwoFactorRepository(),
+	}
+}
+
+// WithTwoFactor adds tf to the repo and returns the repo. It is stored as it
+// would be by Create.
+func (r *TwoFactorRepo) WithTwoFactor(tf jelly.TwoFactor) *TwoFactorRepo {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	_, err := r.repo.Create(context.Background(), tf)
+	mustSeed("two-factor of user "+tf.UserID.String(), err)
+	return r
+}
+
+// FailingOn sets every call to the given method to fail with err, and returns
+// the repo.
+func (r *TwoFactorRepo) FailingOn(method string, err error) *TwoFactorRepo {
+	r.script.failOn(method, 0, err)
+	return r
+}
+
+// FailingOnCall sets the nth call to the given method to fail with err, and
+// returns the repo. Calls are numbered from 1.
+func (r *TwoFactorRepo) FailingOnCall(method string, n int, err error) *TwoFactorRepo {
+	r.script.failOnCall(method, n, err)
+	return r
+}
+
+// Calls returns the number of calls that have been made to the given method,
+// including those that failed.
+func (r *TwoFactorRepo) Calls(method string) int {
+	return r.script.count(method)
+}
+
+func (r *TwoFactorRepo) Create(ctx context.Context, tf jelly.TwoFactor) (jelly.TwoFactor, error) {
+	if err := r.script.call("Create"); err != nil {
+		return jelly.TwoFactor{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Create(ctx, tf)
+}
+
+func (r *TwoFactorRepo) Get(ctx context.Context, userID uuid.UUID) (jelly.TwoFactor, error) {
+	if err := r.script.call("Get"); err != nil {
+		return jelly.TwoFactor{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Get(ctx, userID)
+}
+
+func (r *TwoFactorRepo) Update(ctx context.Context, userID uuid.UUID, tf jelly.TwoFactor) (jelly.TwoFactor, error) {
+	if err := r.script.call("Update"); err != nil {
+		return jelly.TwoFactor{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Update(ctx, userID, tf)
+}
+
+func (r *TwoFactorRepo) Delete(ctx context.Context, userID uuid.UUID) (jelly.TwoFactor, error) {
+	if err := r.script.call("Delete"); err != nil {
+		return jelly.TwoFactor{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Delete(ctx, userID)
+}
+
+func (r *TwoFactorRepo) Close() error {
+	if err := r.script.call("Close"); err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Close()
+}
@@ -0,0 +1,175 @@
+package fakestore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/authuserdao/inmem"
+	"github.com/google/uuid"
+)
+
+// AuthUserRepo is a fake jelly.AuthUserRepo. It also implements
+// jelly.ArchivingAuthUserRepo and jelly.LastModifiedRepo, as the built-in
+// authuser repos do. The zero value is not ready for use; create one with
+// AuthUsers. It is safe for concurrent use.
+type AuthUserRepo struct {
+	script *script
+	ids    *seedIDs
+
+	mtx  sync.Mutex
+	repo *inmem.AuthUserRepo
+}
+
+// AuthUsers returns a new AuthUserRepo that has no users and never fails.
+func AuthUsers() *AuthUserRepo {
+	r := &AuthUserRepo{
+		script: newScript("AuthUserRepo",
+			"Create", "Get", "GetAll", "Update", "GetByUsername", "Delete",
+			"Close", "Archive", "Restore", "DeleteArchivedBefore", "MaxModified",
+		),
+		ids:  &seedIDs{},
+		repo: inmem.NewAuthUserRepository(),
+	}
+	r.repo.UseIDGenerator(r.ids)
+	return r
+}
+
+// WithUser adds u to the repo and returns the repo. It is stored as it would
+// be by Create, except that its ID is kept if it has one and it is archived
+// if its Archived time is set. Its Password is stored as-is, so it must be a
+// hash if the user is going to log in.
+func (r *AuthUserRepo) WithUser(u jelly.AuthUser) *AuthUserRepo {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	ctx := context.Background()
+	r.ids.next = u.ID
+	created, err := r.repo.Create(ctx, u)
+	mustSeed("user "+u.Username, err)
+	if !u.Archived.IsZero() {
+		_, err = r.repo.Archive(ctx, created.ID)
+		mustSeed("user "+u.Username, err)
+	}
+	return r
+}
+
+// FailingOn sets every call to the given method to fail with err, and returns
+// the repo.
+func (r *AuthUserRepo) FailingOn(method string, err error) *AuthUserRepo {
+	r.script.failOn(method, 0, err)
+	return r
+}
+
+// FailingOnCall sets the nth call to the given method to fail with err, and
+// returns the repo. Calls are numbered from 1.
+func (r *AuthUserRepo) FailingOnCall(method string, n int, err error) *AuthUserRepo {
+	r.script.failOnCall(method, n, err)
+	return r
+}
+
+// Calls returns the number of calls that have been made to the given method,
+// including those that failed.
+func (r *AuthUserRepo) Calls(method string) int {
+	return r.script.count(method)
+}
+
+func (r *AuthUserRepo) Create(ctx context.Context, u jelly.AuthUser) (jelly.AuthUser, error) {
+	if err := r.script.call("Create"); err != nil {
+		return jelly.AuthUser{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Create(ctx, u)
+}
+
+func (r *AuthUserRepo) Get(ctx context.Context, id uuid.UUID) (jelly.AuthUser, error) {
+	if err := r.script.call("Get"); err != nil {
+		return jelly.AuthUser{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Get(ctx, id)
+}
+
+func (r *AuthUserRepo) GetAll(ctx context.Context) ([]jelly.AuthUser, error) {
+	if err := r.script.call("GetAll"); err != nil {
+		return nil, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.GetAll(ctx)
+}
+
+func (r *AuthUserRepo) Update(ctx context.Context, id uuid.UUID, u jelly.AuthUser) (jelly.AuthUser, error) {
+	if err := r.script.call("Update"); err != nil {
+		return jelly.AuthUser{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Update(ctx, id, u)
+}
+
+func (r *AuthUserRepo) GetByUsername(ctx context.Context, username string) (jelly.AuthUser, error) {
+	if err := r.script.call("GetByUsername"); err != nil {
+		return jelly.AuthUser{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.GetByUsername(ctx, username)
+}
+
+func (r *AuthUserRepo) Delete(ctx context.Context, id uuid.UUID) (jelly.AuthUser, error) {
+	if err := r.script.call("Delete"); err != nil {
+		return jelly.AuthUser{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Delete(ctx, id)
+}
+
+func (r *AuthUserRepo) Close() error {
+	if err := r.script.call("Close"); err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Close()
+}
+
+func (r *AuthUserRepo) Archive(ctx context.Context, id uuid.UUID) (jelly.AuthUser, error) {
+	if err := r.script.call("Archive"); err != nil {
+		return jelly.AuthUser{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Archive(ctx, id)
+}
+
+func (r *AuthUserRepo) Restore(ctx context.Context, id uuid.UUID) (jelly.AuthUser, error) {
+	if err := r.script.call("Restore"); err != nil {
+		return jelly.AuthUser{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.Restore(ctx, id)
+}
+
+func (r *AuthUserRepo) DeleteArchivedBefore(ctx context.Context, t time.Time) ([]jelly.AuthUser, error) {
+	if err := r.script.call("DeleteArchivedBefore"); err != nil {
+		return nil, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.DeleteArchivedBefore(ctx, t)
+}
+
+func (r *AuthUserRepo) MaxModified(ctx context.Context, filter interface{}) (time.Time, error) {
+	if err := r.script.call("MaxModified"); err != nil {
+		return time.Time{}, err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.repo.MaxModified(ctx, filter)
+}
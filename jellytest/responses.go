@@ -0,0 +1,211 @@
+// Package jellytest provides test doubles and assertions for unit testing the
+// endpoints of jelly APIs without starting a server or setting up mocks of
+// every call that an endpoint makes.
+//
+// A ResponseRecorder creates the same Results as the default
+// ResponseGenerator of a server and records each call made to it, and
+// AssertResult checks the status, messages, and body of a Result, optionally
+// against a golden file:
+//
+//	rec := jellytest.NewResponseRecorder()
+//	result := api.epCreateThing(rec)(req)
+//	jellytest.AssertResult(t, result, jellytest.Expect{
+//		Status: http.StatusCreated,
+//		Golden: "testdata/create_thing.json",
+//	})
+package jellytest
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/server"
+)
+
+// Call is a call made to a ResponseRecorder.
+type Call struct {
+	// Method is the name of the method that was called, such as "BadRequest".
+	Method string
+
+	// Result is the Result that the call returned. For calls to LogResponse,
+	// it is the Result that was given to be logged.
+	Result jelly.Result
+}
+
+// ResponseRecorder is a jelly.ResponseGenerator that records each call made to
+// it. The Results it returns are the same as the ones that the default
+// ResponseGenerator of a server would, with no envelope or localization. The
+// zero value is not ready for use; create one with NewResponseRecorder. It is
+// safe for concurrent use.
+type ResponseRecorder struct {
+	gen jelly.ResponseGenerator
+
+	mtx   sync.Mutex
+	calls []Call
+}
+
+// NewResponseRecorder returns a new ResponseRecorder with no calls recorded.
+func NewResponseRecorder() *ResponseRecorder {
+	return &ResponseRecorder{gen: server.NewResponseGenerator(nil)}
+}
+
+// Calls returns every call made to rr so far, in the order they were made.
+func (rr *ResponseRecorder) Calls() []Call {
+	rr.mtx.Lock()
+	defer rr.mtx.Unlock()
+
+	return append([]Call{}, rr.calls...)
+}
+
+// Last returns the most recent call made to rr. If no calls have been made,
+// the returned bool is false.
+func (rr *ResponseRecorder) Last() (Call, bool) {
+	rr.mtx.Lock()
+	defer rr.mtx.Unlock()
+
+	if len(rr.calls) == 0 {
+		return Call{}, false
+	}
+	return rr.calls[len(rr.calls)-1], true
+}
+
+// Reset discards every call recorded so far.
+func (rr *ResponseRecorder) Reset() {
+	rr.mtx.Lock()
+	defer rr.mtx.Unlock()
+
+	rr.calls = nil
+}
+
+// record records a call to method that returned r, and returns r.
+func (rr *ResponseRecorder) record(method string, r jelly.Result) jelly.Result {
+	rr.mtx.Lock()
+	defer rr.mtx.Unlock()
+
+	rr.calls = append(rr.calls, Call{Method: method, Result: r})
+	return r
+}
+
+func (rr *ResponseRecorder) OK(respObj interface{}, internalMsg ...interface{}) jelly.Result {
+	return rr.record("OK", rr.gen.OK(respObj, internalMsg...))
+}
+
+func (rr *ResponseRecorder) NoContent(internalMsg ...interface{}) jelly.Result {
+	return rr.record("NoContent", rr.gen.NoContent(internalMsg...))
+}
+
+func (rr *ResponseRecorder) Created(respObj interface{}, internalMsg ...interface{}) jelly.Result {
+	return rr.record("Created", rr.gen.Created(respObj, internalMsg...))
+}
+
+func (rr *ResponseRecorder) Conflict(userMsg string, internalMsg ...interface{}) jelly.Result {
+	return rr.record("Conflict", rr.gen.Conflict(userMsg, internalMsg...))
+}
+
+func (rr *ResponseRecorder) PreconditionFailed(userMsg string, internalMsg ...interface{}) jelly.Result {
+	return rr.record("PreconditionFailed", rr.gen.PreconditionFailed(userMsg, internalMsg...))
+}
+
+func (rr *ResponseRecorder) BadRequest(userMsg string, internalMsg ...interface{}) jelly.Result {
+	return rr.record("BadRequest", rr.gen.BadRequest(userMsg, internalMsg...))
+}
+
+func (rr *ResponseRecorder) MethodNotAllowed(req *http.Request, internalMsg ...interface{}) jelly.Result {
+	return rr.record("MethodNotAllowed", rr.gen.MethodNotAllowed(req, internalMsg...))
+}
+
+func (rr *ResponseRecorder) NotFound(internalMsg ...interface{}) jelly.Result {
+	return rr.record("NotFound", rr.gen.NotFound(internalMsg...))
+}
+
+func (rr *ResponseRecorder) Forbidden(internalMsg ...interface{}) jelly.Result {
+	return rr.record("Forbidden", rr.gen.Forbidden(internalMsg...))
+}
+
+func (rr *ResponseRecorder) Unauthorized(userMsg string, internalMsg ...interface{}) jelly.Result {
+	return rr.record("Unauthorized", rr.gen.Unauthorized(userMsg, internalMsg...))
+}
+
+func (rr *ResponseRecorder) InternalServerError(internalMsg ...interface{}) jelly.Result {
+	return rr.record("InternalServerError", rr.gen.InternalServerError(internalMsg...))
+}
+
+func (rr *ResponseRecorder) Redirection(uri string) jelly.Result {
+	return rr.record("Redirection", rr.gen.Redirection(uri))
+}
+
+func (rr *ResponseRecorder) Response(status int, respObj interface{}, internalMsg string, v ...interface{}) jelly.Result {
+	return rr.record("Response", rr.gen.Response(status, respObj, internalMsg, v...))
+}
+
+func (rr *ResponseRecorder) Accepted(respObj interface{}, internalMsg ...interface{}) jelly.Result {
+	return rr.record("Accepted", rr.gen.Accepted(respObj, internalMsg...))
+}
+
+func (rr *ResponseRecorder) NotModified(internalMsg ...interface{}) jelly.Result {
+	return rr.record("NotModified", rr.gen.NotModified(internalMsg...))
+}
+
+func (rr *ResponseRecorder) PartialContent(respObj interface{}, contentRange string, internalMsg ...interface{}) jelly.Result {
+	return rr.record("PartialContent", rr.gen.PartialContent(respObj, contentRange, internalMsg...))
+}
+
+func (rr *ResponseRecorder) MovedPermanently(uri string) jelly.Result {
+	return rr.record("MovedPermanently", rr.gen.MovedPermanently(uri))
+}
+
+func (rr *ResponseRecorder) PermanentRedirect(uri string) jelly.Result {
+	return rr.record("PermanentRedirect", rr.gen.PermanentRedirect(uri))
+}
+
+func (rr *ResponseRecorder) ConflictWithBody(respObj interface{}, internalMsg ...interface{}) jelly.Result {
+	return rr.record("ConflictWithBody", rr.gen.ConflictWithBody(respObj, internalMsg...))
+}
+
+func (rr *ResponseRecorder) Gone(internalMsg ...interface{}) jelly.Result {
+	return rr.record("Gone", rr.gen.Gone(internalMsg...))
+}
+
+func (rr *ResponseRecorder) UnprocessableEntity(userMsg string, internalMsg ...interface{}) jelly.Result {
+	return rr.record("UnprocessableEntity", rr.gen.UnprocessableEntity(userMsg, internalMsg...))
+}
+
+func (rr *ResponseRecorder) UnsupportedMediaType(userMsg string, internalMsg ...interface{}) jelly.Result {
+	return rr.record("UnsupportedMediaType", rr.gen.UnsupportedMediaType(userMsg, internalMsg...))
+}
+
+func (rr *ResponseRecorder) TooManyRequests(userMsg string, retryAfter time.Duration, internalMsg ...interface{}) jelly.Result {
+	return rr.record("TooManyRequests", rr.gen.TooManyRequests(userMsg, retryAfter, internalMsg...))
+}
+
+func (rr *ResponseRecorder) ServiceUnavailable(userMsg string, retryAfter time.Duration, internalMsg ...interface{}) jelly.Result {
+	return rr.record("ServiceUnavailable", rr.gen.ServiceUnavailable(userMsg, retryAfter, internalMsg...))
+}
+
+func (rr *ResponseRecorder) FromError(err error, internalMsg ...interface{}) jelly.Result {
+	return rr.record("FromError", rr.gen.FromError(err, internalMsg...))
+}
+
+func (rr *ResponseRecorder) Resource(status int, model interface{}, internalMsg string, v ...interface{}) jelly.Result {
+	return rr.record("Resource", rr.gen.Resource(status, model, internalMsg, v...))
+}
+
+func (rr *ResponseRecorder) Err(status int, userMsg, internalMsg string, v ...interface{}) jelly.Result {
+	return rr.record("Err", rr.gen.Err(status, userMsg, internalMsg, v...))
+}
+
+func (rr *ResponseRecorder) TextErr(status int, userMsg, internalMsg string, v ...interface{}) jelly.Result {
+	return rr.record("TextErr", rr.gen.TextErr(status, userMsg, internalMsg, v...))
+}
+
+// LogResponse records the call but does not log anything. The Result of the
+// recorded Call is r.
+func (rr *ResponseRecorder) LogResponse(req *http.Request, r jelly.Result) {
+	rr.record("LogResponse", r)
+}
+
+func (rr *ResponseRecorder) Logger() jelly.Logger {
+	return rr.gen.Logger()
+}
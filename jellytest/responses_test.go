@@ -0,0 +1,88 @@
+package jellytest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ResponseRecorder(t *testing.T) {
+	testCases := []struct {
+		name         string
+		call         func(rr *ResponseRecorder) jelly.Result
+		expectMethod string
+		expectStatus int
+		expectErr    bool
+	}{
+		{
+			name:         "OK",
+			call:         func(rr *ResponseRecorder) jelly.Result { return rr.OK(map[string]string{"a": "b"}) },
+			expectMethod: "OK",
+			expectStatus: http.StatusOK,
+		},
+		{
+			name:         "BadRequest",
+			call:         func(rr *ResponseRecorder) jelly.Result { return rr.BadRequest("bad", "internal %d", 8) },
+			expectMethod: "BadRequest",
+			expectStatus: http.StatusBadRequest,
+			expectErr:    true,
+		},
+		{
+			name: "MethodNotAllowed",
+			call: func(rr *ResponseRecorder) jelly.Result {
+				return rr.MethodNotAllowed(httptest.NewRequest(http.MethodPut, "/things", nil))
+			},
+			expectMethod: "MethodNotAllowed",
+			expectStatus: http.StatusMethodNotAllowed,
+			expectErr:    true,
+		},
+		{
+			name: "TooManyRequests",
+			call: func(rr *ResponseRecorder) jelly.Result {
+				return rr.TooManyRequests("", time.Second)
+			},
+			expectMethod: "TooManyRequests",
+			expectStatus: http.StatusTooManyRequests,
+			expectErr:    true,
+		},
+		{
+			name:         "Resource without envelope",
+			call:         func(rr *ResponseRecorder) jelly.Result { return rr.Resource(http.StatusCreated, "thing", "created") },
+			expectMethod: "Resource",
+			expectStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			rr := NewResponseRecorder()
+
+			_, ok := rr.Last()
+			assert.False(ok, "call recorded before any were made")
+
+			r := tc.call(rr)
+			assert.Equal(tc.expectStatus, r.Status)
+			assert.Equal(tc.expectErr, r.IsErr)
+
+			// helper methods that build on others are recorded only once
+			calls := rr.Calls()
+			if assert.Len(calls, 1) {
+				assert.Equal(tc.expectMethod, calls[0].Method)
+				assert.Equal(r, calls[0].Result)
+			}
+
+			rr.LogResponse(httptest.NewRequest(http.MethodGet, "/", nil), r)
+			last, ok := rr.Last()
+			assert.True(ok)
+			assert.Equal(Call{Method: "LogResponse", Result: r}, last)
+
+			rr.Reset()
+			assert.Empty(rr.Calls())
+		})
+	}
+}
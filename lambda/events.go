@@ -0,0 +1,236 @@
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// RESTAPIRequest is an API Gateway REST API proxy event, in payload format
+// version 1.0. Only the fields needed to build the request are included.
+type RESTAPIRequest struct {
+	HTTPMethod                      string              `json:"httpMethod"`
+	Path                            string              `json:"path"`
+	Headers                         map[string]string   `json:"headers"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	Body                            string              `json:"body"`
+	IsBase64Encoded                 bool                `json:"isBase64Encoded"`
+	RequestContext                  struct {
+		DomainName string `json:"domainName"`
+		Identity   struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+	} `json:"requestContext"`
+}
+
+// RESTAPIResponse is the response to a RESTAPIRequest.
+type RESTAPIResponse struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// HTTPAPIRequest is an API Gateway HTTP API proxy event, in payload format
+// version 2.0. Only the fields needed to build the request are included.
+type HTTPAPIRequest struct {
+	Version         string            `json:"version"`
+	RawPath         string            `json:"rawPath"`
+	RawQueryString  string            `json:"rawQueryString"`
+	Cookies         []string          `json:"cookies"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+	RequestContext  struct {
+		DomainName string `json:"domainName"`
+		HTTP       struct {
+			Method   string `json:"method"`
+			Path     string `json:"path"`
+			SourceIP string `json:"sourceIp"`
+		} `json:"http"`
+	} `json:"requestContext"`
+}
+
+// HTTPAPIResponse is the response to an HTTPAPIRequest.
+type HTTPAPIResponse struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Cookies         []string          `json:"cookies,omitempty"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+func (event RESTAPIRequest) httpRequest(ctx context.Context) (*http.Request, error) {
+	query := url.Values{}
+	for k, v := range event.QueryStringParameters {
+		query.Set(k, v)
+	}
+	for k, vs := range event.MultiValueQueryStringParameters {
+		query[k] = vs
+	}
+
+	header := http.Header{}
+	for k, v := range event.Headers {
+		header.Set(k, v)
+	}
+	for k, vs := range event.MultiValueHeaders {
+		header[http.CanonicalHeaderKey(k)] = vs
+	}
+
+	u := &url.URL{Path: event.Path, RawQuery: query.Encode()}
+	return newRequest(ctx, event.HTTPMethod, u, header, event.Body, event.IsBase64Encoded, event.RequestContext.DomainName, event.RequestContext.Identity.SourceIP)
+}
+
+func (event HTTPAPIRequest) httpRequest(ctx context.Context) (*http.Request, error) {
+	header := http.Header{}
+	for k, v := range event.Headers {
+		header.Set(k, v)
+	}
+	if len(event.Cookies) > 0 {
+		header.Set("Cookie", strings.Join(event.Cookies, "; "))
+	}
+
+	path := event.RawPath
+	if path == "" {
+		path = event.RequestContext.HTTP.Path
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("decode event: path: %w", err)
+	}
+	u.RawQuery = event.RawQueryString
+
+	return newRequest(ctx, event.RequestContext.HTTP.Method, u, header, event.Body, event.IsBase64Encoded, event.RequestContext.DomainName, event.RequestContext.HTTP.SourceIP)
+}
+
+func newRequest(ctx context.Context, method string, u *url.URL, header http.Header, body string, isBase64 bool, host, sourceIP string) (*http.Request, error) {
+	data := []byte(body)
+	if isBase64 {
+		var err error
+		data, err = base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return nil, fmt.Errorf("decode event: body: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode event: %w", err)
+	}
+	req.Header = header
+	req.RequestURI = u.RequestURI()
+	if host == "" {
+		host = header.Get("Host")
+	}
+	req.Host = host
+	if sourceIP != "" {
+		// there is no port; give one so RemoteAddr has its usual form
+		req.RemoteAddr = sourceIP + ":0"
+	}
+
+	return req, nil
+}
+
+// responseRecorder is an http.ResponseWriter that keeps the response in
+// memory so that it can be given back as an event.
+type responseRecorder struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (w *responseRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+// encodedBody returns the body of the response as it should be given in the
+// response event, base64-encoding it if it is not text.
+func (w *responseRecorder) encodedBody() (body string, isBase64 bool) {
+	data := w.body.Bytes()
+	if isTextual(w.header.Get("Content-Type"), data) {
+		return string(data), false
+	}
+	return base64.StdEncoding.EncodeToString(data), true
+}
+
+func isTextual(contentType string, data []byte) bool {
+	if contentType == "" {
+		return utf8.Valid(data)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return utf8.Valid(data)
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"),
+		mediaType == "application/json",
+		mediaType == "application/xml",
+		mediaType == "application/javascript",
+		mediaType == "application/x-www-form-urlencoded":
+		return true
+	default:
+		return false
+	}
+}
+
+func newRESTAPIResponse(w *responseRecorder) RESTAPIResponse {
+	body, isBase64 := w.encodedBody()
+	return RESTAPIResponse{
+		StatusCode:        w.status,
+		MultiValueHeaders: w.header,
+		Body:              body,
+		IsBase64Encoded:   isBase64,
+	}
+}
+
+func newHTTPAPIResponse(w *responseRecorder) HTTPAPIResponse {
+	headers := map[string]string{}
+	for k, vs := range w.header {
+		if k == "Set-Cookie" {
+			continue
+		}
+		// HTTP APIs do not support multiple values of a header; combine them
+		// as allowed by RFC 9110.
+		headers[k] = strings.Join(vs, ",")
+	}
+
+	body, isBase64 := w.encodedBody()
+	return HTTPAPIResponse{
+		StatusCode:      w.status,
+		Headers:         headers,
+		Cookies:         w.header.Values("Set-Cookie"),
+		Body:            body,
+		IsBase64Encoded: isBase64,
+	}
+}
@@ -0,0 +1,192 @@
+// Package lambda runs a jelly server behind AWS Lambda, with requests arriving
+// as API Gateway proxy events instead of over a listener.
+//
+// An Adapter is created with the same arguments as Environment.Run, but does
+// not create the server until the first event is received; creating it is
+// what connects to the configured DBs, so doing it lazily keeps the
+// function's cold start short. Each event is translated to an http.Request and
+// served by the server's Handler, and the response is translated back to the
+// event's response format. Both the REST API (payload version 1.0) and HTTP API
+// (payload version 2.0) formats are supported.
+//
+// Adapter implements the Handler interface of the aws-lambda-go module, so it
+// can be given directly to lambda.StartHandler:
+//
+//	adapter := jellylambda.New(env, &conf, map[string]jelly.API{"hello": helloAPI})
+//	lambda.StartHandler(adapter)
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/server"
+)
+
+// Adapter serves Lambda events with a jelly server. The zero-value is not
+// ready for use; call New to get one.
+type Adapter struct {
+	env  *server.Environment
+	conf *jelly.Config
+	apis map[string]jelly.API
+
+	mtx     sync.Mutex
+	srv     jelly.RESTServer
+	handler http.Handler
+}
+
+// New creates an Adapter that serves events with a server created from conf
+// in env, with apis added to it in order of their names. The server is not
+// created until it is first needed. No listener is ever opened for it.
+func New(env *server.Environment, conf *jelly.Config, apis map[string]jelly.API) *Adapter {
+	if env == nil {
+		env = &server.Environment{}
+	}
+
+	return &Adapter{
+		env:  env,
+		conf: conf,
+		apis: apis,
+	}
+}
+
+// Server returns the server that the Adapter serves events with, creating it
+// and adding the Adapter's APIs to it if that has not yet been done. If
+// creating it fails, the error is returned and creation is tried again on the
+// next call. If an API could not be added, the APIs that were added before it
+// are shut down first so that they release the DBs they were given.
+func (a *Adapter) Server() (jelly.RESTServer, error) {
+	srv, _, err := a.start()
+	return srv, err
+}
+
+func (a *Adapter) start() (jelly.RESTServer, http.Handler, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if a.srv != nil {
+		return a.srv, a.handler, nil
+	}
+
+	srv, err := a.env.NewServer(a.conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create server: %w", err)
+	}
+
+	names := make([]string, 0, len(a.apis))
+	for name := range a.apis {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := srv.Add(name, a.apis[name]); err != nil {
+			err = fmt.Errorf("add %s API: %w", name, err)
+
+			// a server can only be shut down once it is in use, which
+			// getting its Handler counts as
+			srv.Handler()
+			if shutdownErr := srv.Shutdown(context.Background()); shutdownErr != nil {
+				err = fmt.Errorf("%s\nadditionally: shut down server: %w", err, shutdownErr)
+			}
+			return nil, nil, err
+		}
+	}
+
+	a.srv = srv
+	a.handler = srv.Handler()
+	return a.srv, a.handler, nil
+}
+
+// Invoke serves payload, the JSON of an API Gateway proxy event, and returns
+// the JSON of the response event. The version of the payload format is
+// detected from the event, and the response is given in the same version.
+func (a *Adapter) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	var ver struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(payload, &ver); err != nil {
+		return nil, fmt.Errorf("decode event: %w", err)
+	}
+
+	if ver.Version == "2.0" {
+		var event HTTPAPIRequest
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("decode event: %w", err)
+		}
+		resp, err := a.ServeHTTPAPI(ctx, event)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(resp)
+	}
+
+	var event RESTAPIRequest
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("decode event: %w", err)
+	}
+	resp, err := a.ServeRESTAPI(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
+// ServeRESTAPI serves a REST API (payload version 1.0) proxy event.
+func (a *Adapter) ServeRESTAPI(ctx context.Context, event RESTAPIRequest) (RESTAPIResponse, error) {
+	req, err := event.httpRequest(ctx)
+	if err != nil {
+		return RESTAPIResponse{}, err
+	}
+
+	w, err := a.serve(req)
+	if err != nil {
+		return RESTAPIResponse{}, err
+	}
+	return newRESTAPIResponse(w), nil
+}
+
+// ServeHTTPAPI serves an HTTP API (payload version 2.0) proxy event.
+func (a *Adapter) ServeHTTPAPI(ctx context.Context, event HTTPAPIRequest) (HTTPAPIResponse, error) {
+	req, err := event.httpRequest(ctx)
+	if err != nil {
+		return HTTPAPIResponse{}, err
+	}
+
+	w, err := a.serve(req)
+	if err != nil {
+		return HTTPAPIResponse{}, err
+	}
+	return newHTTPAPIResponse(w), nil
+}
+
+func (a *Adapter) serve(req *http.Request) (*responseRecorder, error) {
+	_, h, err := a.start()
+	if err != nil {
+		return nil, err
+	}
+
+	w := newResponseRecorder()
+	h.ServeHTTP(w, req)
+	return w, nil
+}
+
+// Shutdown shuts down the server if it has been created. A later event will
+// create a new one.
+func (a *Adapter) Shutdown(ctx context.Context) error {
+	a.mtx.Lock()
+	srv := a.srv
+	a.srv = nil
+	a.handler = nil
+	a.mtx.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
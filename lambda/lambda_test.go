@@ -0,0 +1,205 @@
+package lambda
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/server"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type echoAPI struct{}
+
+func (echoAPI) Init(jelly.Bundle) error                        { return nil }
+func (echoAPI) Authenticators() map[string]jelly.Authenticator { return nil }
+func (echoAPI) Shutdown(context.Context) error                 { return nil }
+
+func (echoAPI) Routes(jelly.ServiceProvider) (chi.Router, bool) {
+	r := chi.NewRouter()
+	r.Post("/", func(w http.ResponseWriter, req *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "seen", Value: "1"})
+		w.Header().Set("Content-Type", req.Header.Get("Content-Type"))
+		w.WriteHeader(http.StatusCreated)
+		buf := make([]byte, 64)
+		n, _ := req.Body.Read(buf)
+		w.Write([]byte(req.URL.Query().Get("q") + ":"))
+		w.Write(buf[:n])
+	})
+	return r, false
+}
+
+func newTestAdapter() *Adapter {
+	conf := jelly.Config{
+		APIs: map[string]jelly.APIConfig{
+			"echo": (&jelly.CommonConfig{Name: "echo", Enabled: true, Base: "/echo"}).FillDefaults(),
+		},
+	}
+	return New(&server.Environment{}, &conf, map[string]jelly.API{"echo": echoAPI{}})
+}
+
+func Test_Adapter_Invoke(t *testing.T) {
+	testCases := []struct {
+		name         string
+		event        string
+		expectStatus int
+		expectBody   string
+		expectBase64 bool
+	}{
+		{
+			name: "REST API event",
+			event: `{
+				"httpMethod": "POST",
+				"path": "/echo",
+				"headers": {"content-type": "text/plain"},
+				"queryStringParameters": {"q": "hi"},
+				"body": "Nepeta"
+			}`,
+			expectStatus: http.StatusCreated,
+			expectBody:   "hi:Nepeta",
+		},
+		{
+			name: "HTTP API event",
+			event: `{
+				"version": "2.0",
+				"rawPath": "/echo",
+				"rawQueryString": "q=hi",
+				"headers": {"content-type": "text/plain"},
+				"requestContext": {"http": {"method": "POST", "path": "/echo"}},
+				"body": "TmVwZXRh",
+				"isBase64Encoded": true
+			}`,
+			expectStatus: http.StatusCreated,
+			expectBody:   "hi:Nepeta",
+		},
+		{
+			name: "binary response is base64-encoded",
+			event: `{
+				"version": "2.0",
+				"rawPath": "/echo",
+				"headers": {"content-type": "application/octet-stream"},
+				"requestContext": {"http": {"method": "POST", "path": "/echo"}},
+				"body": "AAE=",
+				"isBase64Encoded": true
+			}`,
+			expectStatus: http.StatusCreated,
+			expectBody:   base64.StdEncoding.EncodeToString([]byte{':', 0, 1}),
+			expectBase64: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			adapter := newTestAdapter()
+
+			out, err := adapter.Invoke(context.Background(), []byte(tc.event))
+			if !assert.NoError(err) {
+				return
+			}
+
+			var actual struct {
+				StatusCode        int                 `json:"statusCode"`
+				MultiValueHeaders map[string][]string `json:"multiValueHeaders"`
+				Cookies           []string            `json:"cookies"`
+				Body              string              `json:"body"`
+				IsBase64Encoded   bool                `json:"isBase64Encoded"`
+			}
+			if !assert.NoError(json.Unmarshal(out, &actual)) {
+				return
+			}
+
+			assert.Equal(tc.expectStatus, actual.StatusCode)
+			assert.Equal(tc.expectBody, actual.Body)
+			assert.Equal(tc.expectBase64, actual.IsBase64Encoded)
+			if actual.MultiValueHeaders != nil {
+				assert.Equal([]string{"seen=1"}, actual.MultiValueHeaders["Set-Cookie"])
+			} else {
+				assert.Equal([]string{"seen=1"}, actual.Cookies)
+			}
+
+			assert.NoError(adapter.Shutdown(context.Background()))
+		})
+	}
+}
+
+func Test_Adapter_lazy(t *testing.T) {
+	assert := assert.New(t)
+	adapter := newTestAdapter()
+
+	assert.Nil(adapter.srv)
+
+	srv, err := adapter.Server()
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NotNil(srv)
+
+	again, err := adapter.Server()
+	assert.NoError(err)
+	assert.Same(srv, again)
+}
+
+// flakyAPI fails its first Init if failFirst is set, and counts its calls to
+// Init and Shutdown.
+type flakyAPI struct {
+	echoAPI
+	failFirst bool
+	inits     *int
+	shutdowns *int
+}
+
+func (api flakyAPI) Init(jelly.Bundle) error {
+	*api.inits++
+	if api.failFirst && *api.inits == 1 {
+		return errors.New("not ready")
+	}
+	return nil
+}
+
+func (api flakyAPI) Shutdown(context.Context) error {
+	*api.shutdowns++
+	return nil
+}
+
+func Test_Adapter_addFails(t *testing.T) {
+	assert := assert.New(t)
+
+	var goodInits, goodShutdowns, badInits, badShutdowns int
+	conf := jelly.Config{
+		APIs: map[string]jelly.APIConfig{
+			"a": (&jelly.CommonConfig{Name: "a", Enabled: true, Base: "/a"}).FillDefaults(),
+			"b": (&jelly.CommonConfig{Name: "b", Enabled: true, Base: "/b"}).FillDefaults(),
+		},
+	}
+	adapter := New(&server.Environment{}, &conf, map[string]jelly.API{
+		"a": flakyAPI{inits: &goodInits, shutdowns: &goodShutdowns},
+		"b": flakyAPI{failFirst: true, inits: &badInits, shutdowns: &badShutdowns},
+	})
+
+	// the API added before the failing one is shut down
+	_, err := adapter.Server()
+	assert.Error(err)
+	assert.Nil(adapter.srv)
+	assert.Equal(1, goodInits)
+	assert.Equal(1, goodShutdowns)
+	assert.Equal(0, badShutdowns)
+
+	// and creation is tried again with a new server
+	srv, err := adapter.Server()
+	if !assert.NoError(err) {
+		return
+	}
+	assert.NotNil(srv)
+	assert.Equal(2, goodInits)
+	assert.Equal(2, badInits)
+
+	assert.NoError(adapter.Shutdown(context.Background()))
+	assert.Equal(2, goodShutdowns)
+	assert.Equal(1, badShutdowns)
+}
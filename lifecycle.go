@@ -0,0 +1,90 @@
+package jelly
+
+// LifecycleObserver is told of each step in the life of a server, such as for
+// custom logging, metrics, or orchestration. Observers are registered on the
+// server Environment before the config is loaded and the server is created.
+// Their methods are called synchronously from the server goroutine taking the
+// step, so they must return quickly and must not call back into the server.
+//
+// To observe only some steps, use LifecycleObserverFuncs.
+type LifecycleObserver interface {
+	// OnConfigLoaded is called when a config has been loaded, before any
+	// server is created with it.
+	OnConfigLoaded(cfg Config)
+
+	// OnDBConnected is called each time the DB with the given name is
+	// connected to, along with all of its replicas. DBs that are connected to
+	// lazily are reported when the connection is made, which may be after
+	// the server starts.
+	OnDBConnected(name string)
+
+	// OnAPIInit is called after the Init of the API with the given name
+	// returns, with the error it returned. It is called both when the server
+	// is created and when the API is enabled again with EnableAPI.
+	OnAPIInit(name string, err error)
+
+	// OnListen is called once the server is bound to its main address and is
+	// accepting connections, with the address it is listening on.
+	OnListen(addr string)
+
+	// OnShutdownBegin is called when Shutdown begins to shut down a running
+	// server.
+	OnShutdownBegin()
+
+	// OnShutdownEnd is called when Shutdown is done, with the error that it
+	// returns.
+	OnShutdownEnd(err error)
+}
+
+// LifecycleObserverFuncs is a LifecycleObserver that calls the function for
+// each step that is set and does nothing for the rest.
+type LifecycleObserverFuncs struct {
+	ConfigLoaded  func(cfg Config)
+	DBConnected   func(name string)
+	APIInit       func(name string, err error)
+	Listen        func(addr string)
+	ShutdownBegin func()
+	ShutdownEnd   func(err error)
+}
+
+// OnConfigLoaded calls lf.ConfigLoaded if it is set.
+func (lf LifecycleObserverFuncs) OnConfigLoaded(cfg Config) {
+	if lf.ConfigLoaded != nil {
+		lf.ConfigLoaded(cfg)
+	}
+}
+
+// OnDBConnected calls lf.DBConnected if it is set.
+func (lf LifecycleObserverFuncs) OnDBConnected(name string) {
+	if lf.DBConnected != nil {
+		lf.DBConnected(name)
+	}
+}
+
+// OnAPIInit calls lf.APIInit if it is set.
+func (lf LifecycleObserverFuncs) OnAPIInit(name string, err error) {
+	if lf.APIInit != nil {
+		lf.APIInit(name, err)
+	}
+}
+
+// OnListen calls lf.Listen if it is set.
+func (lf LifecycleObserverFuncs) OnListen(addr string) {
+	if lf.Listen != nil {
+		lf.Listen(addr)
+	}
+}
+
+// OnShutdownBegin calls lf.ShutdownBegin if it is set.
+func (lf LifecycleObserverFuncs) OnShutdownBegin() {
+	if lf.ShutdownBegin != nil {
+		lf.ShutdownBegin()
+	}
+}
+
+// OnShutdownEnd calls lf.ShutdownEnd if it is set.
+func (lf LifecycleObserverFuncs) OnShutdownEnd(err error) {
+	if lf.ShutdownEnd != nil {
+		lf.ShutdownEnd(err)
+	}
+}
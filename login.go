@@ -72,15 +72,353 @@ func ParseRole(s string) (Role, error) {
 type AuthUser struct {
 	ID         uuid.UUID // PK, NOT NULL
 	Username   string    // UNIQUE, NOT NULL
-	Password   string    // NOT NULL
-	Email      string    // NOT NULL
+	Password   string    `jelly:"sensitive"`         // NOT NULL
+	Email      string    `jelly:"sensitive,encrypt"` // NOT NULL
 	Role       Role      // NOT NULL
 	Created    time.Time // NOT NULL
 	Modified   time.Time // NOT NULL
 	LastLogout time.Time // NOT NULL DEFAULT NOW()
 	LastLogin  time.Time // NOT NULL
+
+	// TenantID is the ID of the tenant that the user belongs to. It is empty
+	// for users that do not belong to a tenant. It cannot be changed after
+	// the user is created.
+	TenantID string // NOT NULL DEFAULT ''
+
+	// Attributes holds additional profile data about the user, such as a
+	// display name or preferences. Which attributes a user may have and their
+	// types are decided by the deployment; stores persist the map as-is. It is
+	// nil if the user has no attributes.
+	Attributes map[string]interface{} // NOT NULL DEFAULT '{}'
+
+	// Archived is the time that the user was archived. It is the zero time
+	// for users that are not archived. See ArchivingAuthUserRepo.
+	Archived time.Time // NOT NULL DEFAULT 0
+
+	// Version is the version of the user in the store. It starts at 1 and is
+	// incremented each time the user is updated. It is used for optimistic
+	// concurrency control; see AuthUserRepo.Update.
+	Version int64 // NOT NULL DEFAULT 1
+
+	// ServiceAccount is whether the AuthUser represents a ServiceAccount
+	// rather than a human user. If so, Password is not the account's password
+	// and Role is always Guest.
+	ServiceAccount bool
+
+	// Guest is whether the AuthUser represents an anonymous client that
+	// authenticated with a guest token rather than a registered user. Guests
+	// are not stored, so only ID, Role, Created, and TenantID are set; Role is
+	// always Guest. The ID stays the same for as long as the client keeps
+	// renewing its guest token, so it can be used to key per-client state.
+	Guest bool
+
+	// Scopes is the list of scopes granted to the token that the AuthUser
+	// authenticated with. It is nil when the token is not scoped, such as
+	// tokens issued to a user when they log in; such tokens are limited only
+	// by the Role of the user.
+	Scopes []string
+
+	// SessionID is the ID of the Session that the token the AuthUser
+	// authenticated with belongs to. It is uuid.Nil if the token is not part
+	// of a tracked session.
+	SessionID uuid.UUID
+}
+
+// HasScopes returns whether the AuthUser may perform actions that require all
+// of the given scopes. This is always true for an AuthUser that authenticated
+// with an unscoped token.
+func (u AuthUser) HasScopes(scopes ...string) bool {
+	if u.Scopes == nil {
+		return true
+	}
+
+	for _, want := range scopes {
+		var found bool
+		for _, have := range u.Scopes {
+			if have == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ServiceAccount is a non-interactive principal used by other programs to
+// authenticate with the pre-rolled auth mechanism. Instead of having a Role,
+// it is granted a list of scopes. It has a long-lived secret that it exchanges
+// for short-lived tokens limited to some or all of its scopes.
+type ServiceAccount struct {
+	ID          uuid.UUID // PK, NOT NULL
+	Name        string    // UNIQUE, NOT NULL
+	Description string    // NOT NULL
+	Secret      string    `jelly:"sensitive"` // NOT NULL
+	Scopes      []string  // NOT NULL
+	Created     time.Time // NOT NULL
+	Modified    time.Time // NOT NULL
+	LastUsed    time.Time // NOT NULL
+}
+
+// ServiceAccountRepo is a repository of ServiceAccounts. It has the same
+// semantics as AuthUserRepo.
+type ServiceAccountRepo interface {
+	// Create creates a new model in the DB based on the provided one. The ID
+	// of the provided one is ignored and a new one is generated.
+	//
+	// This returns the object as it appears in the DB after creation.
+	Create(context.Context, ServiceAccount) (ServiceAccount, error)
+
+	// Get retrieves the model with the given ID. If no entity with that ID
+	// exists, an error is returned.
+	Get(context.Context, uuid.UUID) (ServiceAccount, error)
+
+	// GetAll retrieves all entities in the associated store. If no entities
+	// exist but no error otherwise occurred, the returned list of entities will
+	// have a length of zero and the returned error will be nil.
+	GetAll(context.Context) ([]ServiceAccount, error)
+
+	// Update updates a particular entity in the store to match the provided
+	// model. The ID of the provided model is ignored.
+	//
+	// This returns the object as it appears in the DB after updating.
+	Update(context.Context, uuid.UUID, ServiceAccount) (ServiceAccount, error)
+
+	// Delete removes the given entity from the store.
+	//
+	// This returns the object as it appeared in the DB immediately before
+	// deletion.
+	Delete(context.Context, uuid.UUID) (ServiceAccount, error)
+
+	// GetByName retrieves the ServiceAccount with the given name. If no entity
+	// with that name exists, an error is returned.
+	GetByName(ctx context.Context, name string) (ServiceAccount, error)
+
+	// Close performs any clean-up operations required and flushes pending
+	// operations. Not all Repos will actually perform operations, but it should
+	// always be called as part of tear-down operations.
+	Close() error
+}
+
+// ServiceAccountStore is an interface that can optionally be implemented by an
+// AuthUserStore to add persistence of ServiceAccounts. The built-in
+// authuser stores all implement it.
+type ServiceAccountStore interface {
+	// ServiceAccounts returns a repository that holds service accounts used
+	// as part of authentication.
+	ServiceAccounts() ServiceAccountRepo
+}
+
+// Session is a single logged-in session of a user. One is started each time a
+// user logs in, and every token issued for that login belongs to it. Deleting a
+// Session revokes all of its tokens.
+type Session struct {
+	ID        uuid.UUID // PK, NOT NULL
+	UserID    uuid.UUID // NOT NULL
+	IP        string    // NOT NULL
+	UserAgent string    // NOT NULL
+	Created   time.Time // NOT NULL
+	Expires   time.Time // NOT NULL
+}
+
+// Expired returns whether the session is no longer valid at time t.
+func (s Session) Expired(t time.Time) bool {
+	return !t.Before(s.Expires)
+}
+
+// LoginAttempt is a record of an attempt to log in, successful or not.
+type LoginAttempt struct {
+	ID uuid.UUID // PK, NOT NULL
+
+	// UserID is the ID of the user whose username was given. It is uuid.Nil
+	// if no user with that username existed.
+	UserID uuid.UUID // NOT NULL
+
+	Username  string    // NOT NULL
+	IP        string    // NOT NULL
+	UserAgent string    // NOT NULL
+	Success   bool      // NOT NULL
+	Time      time.Time // NOT NULL
+	TenantID  string    // NOT NULL DEFAULT ''
+}
+
+// SessionRepo is a repository of Sessions. It has the same semantics as
+// AuthUserRepo, except that it does not filter by tenant; Sessions are always
+// accessed through the user they belong to.
+type SessionRepo interface {
+	// Create creates a new model in the DB based on the provided one. The ID
+	// of the provided one is ignored and a new one is generated.
+	//
+	// This returns the object as it appears in the DB after creation.
+	Create(context.Context, Session) (Session, error)
+
+	// Get retrieves the model with the given ID. If no entity with that ID
+	// exists, an error is returned.
+	Get(context.Context, uuid.UUID) (Session, error)
+
+	// GetAllByUser retrieves all Sessions of the user with the given ID,
+	// ordered from newest to oldest. If there are none, the returned list will
+	// have a length of zero and the returned error will be nil.
+	GetAllByUser(ctx context.Context, userID uuid.UUID) ([]Session, error)
+
+	// Update updates a particular entity in the store to match the provided
+	// model. The ID, UserID, and Created time of the provided model are
+	// ignored.
+	//
+	// This returns the object as it appears in the DB after updating.
+	Update(context.Context, uuid.UUID, Session) (Session, error)
+
+	// Delete removes the given entity from the store.
+	//
+	// This returns the object as it appeared in the DB immediately before
+	// deletion.
+	Delete(context.Context, uuid.UUID) (Session, error)
+
+	// DeleteAllByUser removes all Sessions of the user with the given ID.
+	//
+	// This returns the objects as they appeared in the DB immediately before
+	// deletion.
+	DeleteAllByUser(ctx context.Context, userID uuid.UUID) ([]Session, error)
+
+	// Close performs any clean-up operations required and flushes pending
+	// operations. Not all Repos will actually perform operations, but it should
+	// always be called as part of tear-down operations.
+	Close() error
 }
 
+// LoginAttemptRepo is a repository of LoginAttempts. If the context passed to
+// one of its methods has a tenant set on it, implementations should limit the
+// operation to only those attempts made in that tenant, and attempts created
+// with an empty TenantID should be assigned to it.
+type LoginAttemptRepo interface {
+	// Create creates a new model in the DB based on the provided one. The ID
+	// of the provided one is ignored and a new one is generated.
+	//
+	// This returns the object as it appears in the DB after creation.
+	Create(context.Context, LoginAttempt) (LoginAttempt, error)
+
+	// GetAll retrieves all LoginAttempts, ordered from newest to oldest. If
+	// there are none, the returned list will have a length of zero and the
+	// returned error will be nil.
+	GetAll(context.Context) ([]LoginAttempt, error)
+
+	// GetAllByUser retrieves all LoginAttempts for the user with the given ID,
+	// ordered from newest to oldest. If there are none, the returned list will
+	// have a length of zero and the returned error will be nil.
+	GetAllByUser(ctx context.Context, userID uuid.UUID) ([]LoginAttempt, error)
+
+	// DeleteBefore removes all LoginAttempts made before the given time,
+	// regardless of tenant.
+	DeleteBefore(context.Context, time.Time) error
+
+	// Close performs any clean-up operations required and flushes pending
+	// operations. Not all Repos will actually perform operations, but it should
+	// always be called as part of tear-down operations.
+	Close() error
+}
+
+// SessionStore is an interface that can optionally be implemented by an
+// AuthUserStore to add tracking of user Sessions and LoginAttempts. The
+// built-in authuser stores all implement it.
+type SessionStore interface {
+	// Sessions returns a repository that holds the sessions of logged-in
+	// users.
+	Sessions() SessionRepo
+
+	// LoginAttempts returns a repository that holds records of attempts to
+	// log in.
+	LoginAttempts() LoginAttemptRepo
+}
+
+// TwoFactor is the time-based one-time password (TOTP) two-factor
+// authentication set up for a single user. It is keyed by the ID of the user.
+type TwoFactor struct {
+	UserID uuid.UUID // PK, NOT NULL
+
+	// Secret is the base32-encoded shared secret used to generate codes.
+	Secret string `jelly:"sensitive"` // NOT NULL
+
+	// Confirmed is whether the user has proven that they can generate codes
+	// from Secret. Two-factor authentication is not enforced for the user
+	// until it is.
+	Confirmed bool // NOT NULL
+
+	// RecoveryCodes are the hashes of the single-use codes the user can give
+	// in place of a TOTP code. Each is removed once it is used.
+	RecoveryCodes []string `jelly:"sensitive"` // NOT NULL
+
+	// LastStep is the TOTP time step of the last code that was accepted. Codes
+	// for that step or earlier are rejected so that they cannot be replayed.
+	LastStep int64 // NOT NULL
+
+	// FailedAttempts is the number of codes given at login since the last one
+	// that was accepted. Once it reaches the limit, login with two-factor
+	// authentication is locked for a time after the last attempt.
+	FailedAttempts int // NOT NULL DEFAULT 0
+
+	// Version is the version of the TwoFactor in the store. It starts at 1 and
+	// is incremented each time the TwoFactor is updated. It is used for
+	// optimistic concurrency control; see TwoFactorRepo.Update.
+	Version int64 // NOT NULL DEFAULT 1
+
+	Created  time.Time // NOT NULL
+	Modified time.Time // NOT NULL
+}
+
+// TwoFactorRepo is a repository of TwoFactors. Unlike most repos, entities are
+// identified by the ID of the user they belong to rather than a generated ID.
+type TwoFactorRepo interface {
+	// Create creates a new model in the DB based on the provided one. Its
+	// UserID is used as its ID; if a TwoFactor for that user already exists,
+	// an error is returned.
+	//
+	// This returns the object as it appears in the DB after creation.
+	Create(context.Context, TwoFactor) (TwoFactor, error)
+
+	// Get retrieves the TwoFactor of the user with the given ID. If the user
+	// does not have one, an error is returned.
+	Get(ctx context.Context, userID uuid.UUID) (TwoFactor, error)
+
+	// Update updates the TwoFactor of the user with the given ID to match the
+	// provided model. The UserID of the provided model is ignored.
+	//
+	// If the Version of the provided model is non-zero, the update is only
+	// made if the stored TwoFactor is at that version; if it is not,
+	// ErrDBConflict is returned. If the Version is zero, the update is always
+	// made. Either way, the version of the TwoFactor is incremented.
+	//
+	// This returns the object as it appears in the DB after updating.
+	Update(ctx context.Context, userID uuid.UUID, tf TwoFactor) (TwoFactor, error)
+
+	// Delete removes the TwoFactor of the user with the given ID.
+	//
+	// This returns the object as it appeared in the DB immediately before
+	// deletion.
+	Delete(ctx context.Context, userID uuid.UUID) (TwoFactor, error)
+
+	// Close performs any clean-up operations required and flushes pending
+	// operations. Not all Repos will actually perform operations, but it should
+	// always be called as part of tear-down operations.
+	Close() error
+}
+
+// TwoFactorStore is an interface that can optionally be implemented by an
+// AuthUserStore to add persistence of TwoFactors. The built-in authuser stores
+// all implement it.
+type TwoFactorStore interface {
+	// TwoFactors returns a repository that holds the two-factor
+	// authentication set up for users.
+	TwoFactors() TwoFactorRepo
+}
+
+// AuthUserRepo is a repository of AuthUsers. If the context passed to one of
+// its methods has a tenant set on it (see WithTenant), implementations should
+// limit the operation to only those users that belong to that tenant, and
+// users created with an empty TenantID should be assigned to it. The built-in
+// implementations do so.
 type AuthUserRepo interface {
 	// Create creates a new model in the DB based on the provided one. Some
 	// attributes in the provided one might not be used; for instance, many
@@ -116,6 +454,13 @@ type AuthUserRepo interface {
 	// model. Implementors may choose which properties of the provided value are
 	// actually used.
 	//
+	// If the Version of the provided model is non-zero, it is the version that
+	// the entity is expected to be at, and the update is only made if the
+	// stored entity's version matches it; if it does not, ErrDBConflict is
+	// returned. This allows a read-modify-write of an entity to detect that
+	// another one modified it in between. If the Version is zero, the update is
+	// always made. Either way, the version of the entity is incremented.
+	//
 	// This returns the object as it appears in the DB after updating.
 	//
 	// An implementor may provide an empty implementation with a function that
@@ -217,7 +562,8 @@ type UserLoginService interface {
 	// UpdateUser sets all properties except the password of the user with the
 	// given ID to the properties in the provider user. All the given properties
 	// of the user (except password) will overwrite the existing ones. Returns
-	// the updated user.
+	// the updated user. The update fails if the user is modified by another
+	// request while it is being made.
 	//
 	// This function cannot be used to update the password. Use UpdatePassword for
 	// that.
@@ -226,19 +572,27 @@ type UserLoginService interface {
 	// errors.Is depending on what caused the error. If a user with that username or
 	// ID (if they are changing) is already present, it will match
 	// serr.ErrAlreadyExists. If no user with the given ID exists, it will match
-	// serr.ErrNotFound. If the error occured due to an unexpected problem with the
-	// DB, it will match serr.ErrDB. Finally, if one of the arguments is invalid, it
-	// will match serr.ErrBadArgument.
+	// serr.ErrNotFound. If the user was modified concurrently, it will match
+	// serr.ErrConflict. If the error occured due to an unexpected problem with the
+	// DB, it will match serr.ErrDB. Finally, if one of the arguments is invalid,
+	// it will match serr.ErrBadArgument.
 	UpdateUser(ctx context.Context, curID, newID, username, email string, role Role) (AuthUser, error)
 
+	// UpdateUserVersioned is the same as UpdateUser, except that if version is
+	// non-zero, the user is only updated if it is currently at that version. If
+	// it is not, the returned error will match serr.ErrConflict.
+	UpdateUserVersioned(ctx context.Context, curID, newID, username, email string, role Role, version int64) (AuthUser, error)
+
 	// UpdatePassword sets the password of the user with the given ID to the new
 	// password. The new password cannot be empty. Returns the updated user.
 	//
 	// The returned error, if non-nil, will return true for various calls to
 	// errors.Is depending on what caused the error. If no user with the given ID
-	// exists, it will match serr.ErrNotFound. If the error occured due to an
-	// unexpected problem with the DB, it will match serr.ErrDB. Finally, if one of
-	// the arguments is invalid, it will match serr.ErrBadArgument.
+	// exists, it will match serr.ErrNotFound. If the user was modified by another
+	// request while it was being updated, it will match serr.ErrConflict. If the
+	// error occured due to an unexpected problem with the DB, it will match
+	// serr.ErrDB. Finally, if one of the arguments is invalid, it will match
+	// serr.ErrBadArgument.
 	UpdatePassword(ctx context.Context, id, password string) (AuthUser, error)
 
 	// DeleteUser deletes the user with the given ID. It returns the deleted user
@@ -284,3 +638,35 @@ type Authenticator interface {
 	// to unauthenticated requests to endpoints that require auth.
 	UnauthDelay() time.Duration
 }
+
+// AuthenticatorStats are the counts of requests that an Authenticator has been
+// asked to authenticate since the server was created, for use with metrics
+// systems. It is returned by RESTServer.AuthenticatorStats.
+type AuthenticatorStats struct {
+	// Attempts is the number of requests that the Authenticator was asked to
+	// authenticate.
+	Attempts int64 `json:"attempts"`
+
+	// Identified is the number of requests that the Authenticator identified
+	// the user of.
+	Identified int64 `json:"identified"`
+
+	// Errors is the number of requests that the Authenticator returned an
+	// error for, such as for bad credentials. When it is not the last in a
+	// list of authenticators, a later one may still have identified the user.
+	Errors int64 `json:"errors"`
+}
+
+// UnauthStats are the counts of requests that a server has rejected with an
+// HTTP-401 since it was created, for use with metrics systems. It is returned
+// by RESTServer.UnauthStats.
+type UnauthStats struct {
+	// Rejections is the number of requests that were rejected.
+	Rejections int64 `json:"rejections"`
+
+	// ByCredential is the number of requests that were rejected for each
+	// type of credentials they were made with, which is the scheme of their
+	// Authorization header in lowercase, such as "bearer", or "none" for
+	// requests that had none.
+	ByCredential map[string]int64 `json:"by_credential"`
+}
@@ -0,0 +1,86 @@
+package jelly
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// MirrorConfig contains options for mirroring requests to a secondary
+// upstream, also known as shadowing. When mirroring is enabled, a copy of a
+// sample of the requests the server receives is sent to Target in the
+// background. Responses from Target are ignored and never affect the response
+// to the client, which makes mirroring useful for testing a new implementation
+// of a service against production traffic.
+//
+// Mirroring is best-effort. Requests whose bodies are too large to copy, and
+// requests received while too many mirrored requests are already in-flight,
+// are not mirrored.
+type MirrorConfig struct {
+	// Enabled is whether to mirror requests.
+	Enabled bool
+
+	// Target is the base URL of the upstream that requests are mirrored to,
+	// such as "http://shadow.internal:8080". The request URI of each mirrored
+	// request is appended to it.
+	Target string
+
+	// SampleRate is the fraction of requests that are mirrored, between 0 and
+	// 1. It will default to 1, mirroring every request, if not set.
+	SampleRate float64
+
+	// ScrubHeaders are the names of request headers that are removed from
+	// mirrored requests. It will default to Authorization and Cookie if not
+	// set; set it to an empty list to keep all headers.
+	ScrubHeaders []string
+
+	// TimeoutMillis is the maximum amount of time (in milliseconds) that a
+	// mirrored request may take before it is abandoned. It will default to
+	// 5000 if not set.
+	TimeoutMillis int
+}
+
+func (mc MirrorConfig) FillDefaults() MirrorConfig {
+	newMC := mc
+
+	if newMC.SampleRate == 0 {
+		newMC.SampleRate = 1
+	}
+	if newMC.ScrubHeaders == nil {
+		newMC.ScrubHeaders = []string{"Authorization", "Cookie"}
+	}
+	if newMC.TimeoutMillis == 0 {
+		newMC.TimeoutMillis = 5000
+	}
+
+	return newMC
+}
+
+func (mc MirrorConfig) Validate() error {
+	if mc.SampleRate < 0 || mc.SampleRate > 1 {
+		return fmt.Errorf("sample_rate: must be between 0 and 1")
+	}
+	if mc.TimeoutMillis < 0 {
+		return fmt.Errorf("timeout: must not be negative")
+	}
+	for i := range mc.ScrubHeaders {
+		if strings.TrimSpace(mc.ScrubHeaders[i]) == "" {
+			return fmt.Errorf("scrub_headers: item #%d: must not be empty", i+1)
+		}
+	}
+
+	if mc.Enabled {
+		if mc.Target == "" {
+			return fmt.Errorf("target: must be set when mirroring is enabled")
+		}
+		u, err := url.Parse(mc.Target)
+		if err != nil {
+			return fmt.Errorf("target: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("target: must be an absolute http or https URL")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+)
+
+// mockAPI serves the routes declared in its config.
+type mockAPI struct {
+	routes []Route
+	log    jelly.Logger
+}
+
+func (api *mockAPI) Init(cb jelly.Bundle) error {
+	routes, ok := cb.GetValue(ConfigKeyRoutes).([]Route)
+	if !ok {
+		return fmt.Errorf(ConfigKeyRoutes + ": not set")
+	}
+	api.routes = routes
+	api.log = cb.Logger()
+
+	return nil
+}
+
+func (api *mockAPI) Authenticators() map[string]jelly.Authenticator {
+	return nil
+}
+
+// Shutdown shuts down the mock API. This is added to implement jelly.API, and
+// has no effect on the API but to return the error of the context.
+func (api *mockAPI) Shutdown(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (api *mockAPI) Routes(em jelly.ServiceProvider) (router chi.Router, subpaths bool) {
+	r := chi.NewRouter()
+
+	for _, rt := range api.routes {
+		if rt.Method == MethodAny {
+			r.HandleFunc(rt.Path, api.httpMock(em, rt))
+		} else {
+			r.MethodFunc(rt.Method, rt.Path, api.httpMock(em, rt))
+		}
+	}
+
+	return r, true
+}
+
+// httpMock returns a HandlerFunc that responds with the response declared by
+// rt after waiting for its latency.
+func (api *mockAPI) httpMock(em jelly.ServiceProvider, rt Route) http.HandlerFunc {
+	latency := time.Duration(rt.LatencyMillis) * time.Millisecond
+
+	return em.Endpoint(func(req *http.Request) jelly.Result {
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-req.Context().Done():
+			}
+		}
+
+		r := em.Response(rt.Status, rt.Body, "mocked %s %s", rt.Method, rt.Path)
+		for name, val := range rt.Headers {
+			r = r.WithHeader(name, val)
+		}
+		return r
+	})
+}
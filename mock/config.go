@@ -0,0 +1,211 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+)
+
+const (
+	ConfigKeyRoutes = "routes"
+)
+
+// MethodAny is the method of a Route that responds to requests of any method.
+const MethodAny = "*"
+
+// Route is a single mocked endpoint.
+type Route struct {
+	// Method is the HTTP method that the route responds to, or MethodAny to
+	// respond to all methods. If not set, it will default to GET.
+	Method string `yaml:"method" json:"method"`
+
+	// Path is the path of the route relative to the API base. It may contain
+	// URL parameters in the same format as chi patterns, such as
+	// "/users/{id}".
+	Path string `yaml:"path" json:"path"`
+
+	// Status is the HTTP status code of the response. If not set, it will
+	// default to 200.
+	Status int `yaml:"status" json:"status"`
+
+	// Body is the body of the response. It is sent as JSON, so it can be any
+	// value that can be given in config, including a string, a list, or a
+	// map. If not set, the body is JSON null. It is not sent if Status is
+	// 204.
+	Body interface{} `yaml:"body,omitempty" json:"body,omitempty"`
+
+	// Headers are additional headers to set on the response.
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+
+	// LatencyMillis is the amount of time to wait (in milliseconds) before
+	// sending the response, to simulate a slow upstream.
+	LatencyMillis int `yaml:"latency,omitempty" json:"latency,omitempty"`
+}
+
+// parseRoutes converts a value given in config into a slice of Routes. The
+// value must be either a []Route or a list of maps with Route's keys, as is
+// read from a config file.
+func parseRoutes(value interface{}) ([]Route, error) {
+	if routes, ok := value.([]Route); ok {
+		return routes, nil
+	}
+	if _, ok := value.([]interface{}); !ok {
+		return nil, fmt.Errorf("key '"+ConfigKeyRoutes+"' requires a []mock.Route but got a %T", value)
+	}
+
+	// round-trip through JSON to convert the maps read from config
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("key '"+ConfigKeyRoutes+"': %w", err)
+	}
+	return decodeRoutes(data)
+}
+
+// decodeRoutes decodes a JSON list of Routes.
+func decodeRoutes(data []byte) ([]Route, error) {
+	var routes []Route
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("key '"+ConfigKeyRoutes+"': %w", err)
+	}
+	return routes, nil
+}
+
+type Config struct {
+	CommonConf jelly.CommonConfig
+
+	// Routes are the endpoints that the API serves.
+	Routes []Route
+}
+
+// FillDefaults returns a new *Config identical to cfg but with unset values set
+// to their defaults and values normalized.
+func (cfg *Config) FillDefaults() jelly.APIConfig {
+	newCFG := new(Config)
+	*newCFG = *cfg
+
+	if newCFG.CommonConf.Enabled && newCFG.CommonConf.Base == "" {
+		newCFG.Set(jelly.ConfigKeyAPIBase, "/mock")
+	}
+
+	newCFG.CommonConf = newCFG.CommonConf.FillDefaults().Common()
+
+	if newCFG.Routes != nil {
+		newCFG.Routes = make([]Route, len(cfg.Routes))
+		for i, rt := range cfg.Routes {
+			rt.Method = strings.ToUpper(rt.Method)
+			if rt.Method == "" {
+				rt.Method = http.MethodGet
+			}
+			if rt.Status == 0 {
+				rt.Status = http.StatusOK
+			}
+			newCFG.Routes[i] = rt
+		}
+	}
+
+	return newCFG
+}
+
+// Validate returns an error if the Config has invalid field values set. Empty
+// and unset values are considered invalid; if defaults are intended to be used,
+// call Validate on the return value of FillDefaults.
+func (cfg *Config) Validate() error {
+	if err := cfg.CommonConf.Validate(); err != nil {
+		return err
+	}
+
+	if cfg.CommonConf.Enabled && len(cfg.Routes) < 1 {
+		return fmt.Errorf(ConfigKeyRoutes + ": must exist and have at least one entry")
+	}
+
+	seen := map[string]int{}
+	for i, rt := range cfg.Routes {
+		if err := rt.validate(); err != nil {
+			return fmt.Errorf(ConfigKeyRoutes+": item #%d: %w", i+1, err)
+		}
+
+		key := strings.ToUpper(rt.Method) + " " + rt.Path
+		if prev, ok := seen[key]; ok {
+			return fmt.Errorf(ConfigKeyRoutes+": item #%d: %s is already declared by item #%d", i+1, key, prev)
+		}
+		seen[key] = i + 1
+	}
+
+	return nil
+}
+
+func (rt Route) validate() error {
+	switch strings.ToUpper(rt.Method) {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace, MethodAny:
+	default:
+		return fmt.Errorf("method: %q is not a valid HTTP method", rt.Method)
+	}
+
+	if !strings.HasPrefix(rt.Path, "/") {
+		return fmt.Errorf("path: must start with a '/'")
+	}
+
+	if rt.Status < 100 || rt.Status > 599 {
+		return fmt.Errorf("status: %d is not a valid HTTP status code", rt.Status)
+	}
+
+	if rt.LatencyMillis < 0 {
+		return fmt.Errorf("latency: must not be negative")
+	}
+
+	return nil
+}
+
+func (cfg *Config) Common() jelly.CommonConfig {
+	return cfg.CommonConf
+}
+
+func (cfg *Config) Keys() []string {
+	keys := cfg.CommonConf.Keys()
+	keys = append(keys, ConfigKeyRoutes)
+	return keys
+}
+
+func (cfg *Config) Get(key string) interface{} {
+	switch strings.ToLower(key) {
+	case ConfigKeyRoutes:
+		return cfg.Routes
+	default:
+		return cfg.CommonConf.Get(key)
+	}
+}
+
+func (cfg *Config) Set(key string, value interface{}) error {
+	switch strings.ToLower(key) {
+	case ConfigKeyRoutes:
+		routes, err := parseRoutes(value)
+		if err == nil {
+			cfg.Routes = routes
+		}
+		return err
+	default:
+		return cfg.CommonConf.Set(key, value)
+	}
+}
+
+// SetFromString sets the value of key from a string. The routes key is given
+// as a JSON list of route objects.
+func (cfg *Config) SetFromString(key string, value string) error {
+	switch strings.ToLower(key) {
+	case ConfigKeyRoutes:
+		if value == "" {
+			return cfg.Set(key, []Route{})
+		}
+		routes, err := decodeRoutes([]byte(value))
+		if err != nil {
+			return err
+		}
+		return cfg.Set(key, routes)
+	default:
+		return cfg.CommonConf.SetFromString(key, value)
+	}
+}
@@ -0,0 +1,42 @@
+// Package mock provides an API whose endpoints are declared entirely in config.
+// It supplies the "jellymock" component.
+//
+// To use the jellymock component, add a "jellymock" section to your config
+// that lists the routes to serve and call jelly.Use(mock.Component) before
+// loading config. Each route responds with a fixed status, body, and set of
+// headers, optionally after a delay, which makes it useful for standing up
+// stub endpoints for integration tests or prototyping without writing any Go
+// code.
+package mock
+
+import (
+	"github.com/dekarrin/jelly"
+)
+
+const (
+	Version = "0.0.1"
+)
+
+type ComponentInfo struct{}
+
+func (ci ComponentInfo) Name() string {
+	return "jellymock"
+}
+
+func (ci ComponentInfo) Version() string {
+	return Version
+}
+
+func (ci ComponentInfo) API() jelly.API {
+	return &mockAPI{}
+}
+
+func (ci ComponentInfo) Config() jelly.APIConfig {
+	return &Config{}
+}
+
+var (
+	// Component holds the component information for jellymock. This is passed
+	// to jelly.Use to enable the use of jellymock in a server.
+	Component jelly.Component = ComponentInfo{}
+)
@@ -0,0 +1,168 @@
+package jelly
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PageParam is the name of the query parameter that selects the page of a
+	// collection to give. Pages are numbered from 1.
+	PageParam = "page"
+
+	// PageSizeParam is the name of the query parameter that selects the
+	// number of items in each page of a collection.
+	PageSizeParam = "page_size"
+)
+
+// Page is the pagination state of a response that gives part of a collection.
+// It is parsed from a request with ParsePage, and its Total is set once the
+// size of the collection is known, such as by Paginate.
+type Page struct {
+	// Number is the number of the page, starting from 1.
+	Number int
+
+	// Size is the maximum number of items in each page. If it is 0, the
+	// collection is not paginated and the whole of it is on one page.
+	Size int
+
+	// Total is the number of items in the whole collection, or -1 if it is
+	// not known. If not known, the last page is not linked to and the next
+	// page is always linked to.
+	Total int
+}
+
+// ParsePage returns the page of a collection that was selected in the page and
+// page_size query parameters of req. If page is not given, it is 1. If
+// page_size is not given, it is defaultSize; a defaultSize of 0 gives the
+// whole collection unless the client asks for pages. Sizes greater than
+// maxSize are reduced to it if maxSize is greater than 0. The Total of the
+// returned Page is -1.
+//
+// If a parameter cannot be parsed, or if a page other than the first is
+// selected without a page size, the returned error matches ErrBadArgument and
+// has a message suitable for giving to the client with
+// ResponseGenerator.BadRequest.
+func ParsePage(req *http.Request, defaultSize, maxSize int) (Page, error) {
+	p := Page{Number: 1, Size: defaultSize, Total: -1}
+	query := req.URL.Query()
+
+	if v := query.Get(PageParam); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return Page{}, NewUserError(PageParam+": must be a whole number of at least 1", "bad "+PageParam+" query parameter: "+strconv.Quote(v), ErrBadArgument)
+		}
+		p.Number = n
+	}
+	if v := query.Get(PageSizeParam); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return Page{}, NewUserError(PageSizeParam+": must be a whole number of at least 1", "bad "+PageSizeParam+" query parameter: "+strconv.Quote(v), ErrBadArgument)
+		}
+		p.Size = n
+	}
+	if maxSize > 0 && p.Size > maxSize {
+		p.Size = maxSize
+	}
+	if p.Size == 0 && p.Number > 1 {
+		return Page{}, NewUserError(PageSizeParam+": must be given to select a page", "query parameter "+PageParam+" given without "+PageSizeParam, ErrBadArgument)
+	}
+
+	return p, nil
+}
+
+// Paginate returns the items of the given page of items along with p with its
+// Total set to the number of items. If p.Size is 0, all of the items are
+// returned. If the page is past the end of items, an empty slice is returned.
+func Paginate[E any](items []E, p Page) ([]E, Page) {
+	p.Total = len(items)
+	if p.Size == 0 {
+		return items, p
+	}
+
+	// page numbers are compared instead of the offsets of items so that a
+	// page number given by a client cannot overflow.
+	if p.Number < 1 || len(items) == 0 || p.Number-1 > (len(items)-1)/p.Size {
+		return []E{}, p
+	}
+	start := (p.Number - 1) * p.Size
+	end := len(items)
+	if end-start > p.Size {
+		end = start + p.Size
+	}
+	return items[start:end], p
+}
+
+// Last returns the number of the last page. It is 1 for an empty collection,
+// and 0 if p.Total is not known.
+func (p Page) Last() int {
+	if p.Total < 0 {
+		return 0
+	}
+	if p.Size == 0 || p.Total == 0 {
+		return 1
+	}
+	last := p.Total / p.Size
+	if p.Total%p.Size != 0 {
+		last++
+	}
+	return last
+}
+
+// Links returns the value of a Link header, as in RFC 8288, that links to the
+// first, previous, next, and last pages of the collection at uri, which is
+// usually the URL that the request for the page was made to, such as one
+// built with Bundle.Absolute. Any page and page_size query parameters of uri
+// are replaced and others are kept. Links to pages that do not exist are not
+// given. If p.Size is 0, the collection is not paginated and "" is returned.
+func (p Page) Links(uri string) string {
+	if p.Size == 0 {
+		return ""
+	}
+
+	base, query := uri, ""
+	if i := strings.IndexByte(uri, '?'); i >= 0 {
+		base, query = uri[:i], uri[i+1:]
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		values = url.Values{}
+	}
+
+	link := func(number int, rel string) string {
+		values.Set(PageParam, strconv.Itoa(number))
+		values.Set(PageSizeParam, strconv.Itoa(p.Size))
+		return "<" + base + "?" + values.Encode() + `>; rel="` + rel + `"`
+	}
+
+	last := p.Last()
+	links := []string{link(1, "first")}
+	if p.Number > 1 {
+		prev := p.Number - 1
+		if last > 0 && prev > last {
+			prev = last
+		}
+		links = append(links, link(prev, "prev"))
+	}
+	if (last == 0 && p.Number < math.MaxInt) || p.Number < last {
+		links = append(links, link(p.Number+1, "next"))
+	}
+	if last > 0 {
+		links = append(links, link(last, "last"))
+	}
+	return strings.Join(links, ", ")
+}
+
+// WithPage returns a copy of r with a Link header giving the pages of the
+// collection at uri as given by p.Links. If p.Size is 0, r is returned
+// unchanged.
+func (r Result) WithPage(uri string, p Page) Result {
+	links := p.Links(uri)
+	if links == "" {
+		return r
+	}
+	return r.WithHeader("Link", links)
+}
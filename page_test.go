@@ -0,0 +1,161 @@
+package jelly
+
+import (
+	"errors"
+	"math"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParsePage(t *testing.T) {
+	testCases := []struct {
+		name        string
+		query       string
+		defaultSize int
+		maxSize     int
+		expect      Page
+		expectErr   bool
+	}{
+		{name: "defaults", defaultSize: 20, maxSize: 100, expect: Page{Number: 1, Size: 20, Total: -1}},
+		{name: "unpaginated by default", expect: Page{Number: 1, Size: 0, Total: -1}},
+		{name: "given", query: "page=3&page_size=10", defaultSize: 20, expect: Page{Number: 3, Size: 10, Total: -1}},
+		{name: "size over max", query: "page_size=1000", maxSize: 100, expect: Page{Number: 1, Size: 100, Total: -1}},
+		{name: "bad page", query: "page=zero", expectErr: true},
+		{name: "page below 1", query: "page=0&page_size=10", expectErr: true},
+		{name: "bad size", query: "page_size=-4", expectErr: true},
+		{name: "later page without size", query: "page=2", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			actual, err := ParsePage(httptest.NewRequest("GET", "/things?"+tc.query, nil), tc.defaultSize, tc.maxSize)
+
+			if tc.expectErr {
+				assert.True(errors.Is(err, ErrBadArgument))
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.expect, actual)
+		})
+	}
+}
+
+func Test_Paginate(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e"}
+
+	testCases := []struct {
+		name   string
+		page   Page
+		expect []string
+	}{
+		{name: "first page", page: Page{Number: 1, Size: 2}, expect: []string{"a", "b"}},
+		{name: "last partial page", page: Page{Number: 3, Size: 2}, expect: []string{"e"}},
+		{name: "past the end", page: Page{Number: 4, Size: 2}, expect: []string{}},
+		{name: "page number that overflows offset", page: Page{Number: math.MaxInt / 2, Size: 4}, expect: []string{}},
+		{name: "largest page number", page: Page{Number: math.MaxInt, Size: 2}, expect: []string{}},
+		{name: "largest page size", page: Page{Number: 1, Size: math.MaxInt}, expect: items},
+		{name: "unpaginated", page: Page{Number: 1}, expect: items},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			actual, page := Paginate(items, tc.page)
+
+			assert.Equal(tc.expect, actual)
+			assert.Equal(len(items), page.Total)
+		})
+	}
+}
+
+func Test_ParsePage_Paginate_hugePage(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest("GET", "/users?page=4611686018427387904&page_size=4", nil)
+	p, err := ParsePage(req, 0, 500)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.NotPanics(func() {
+		items, page := Paginate([]int{1, 2, 3, 4, 5}, p)
+		assert.Empty(items)
+		assert.Equal(2, page.Last())
+	})
+}
+
+func Test_Page_Links(t *testing.T) {
+	testCases := []struct {
+		name   string
+		uri    string
+		page   Page
+		expect string
+	}{
+		{
+			name:   "unpaginated",
+			uri:    "/users",
+			page:   Page{Number: 1, Total: 5},
+			expect: "",
+		},
+		{
+			name: "first of several",
+			uri:  "https://example.com/users",
+			page: Page{Number: 1, Size: 2, Total: 5},
+			expect: `<https://example.com/users?page=1&page_size=2>; rel="first", ` +
+				`<https://example.com/users?page=2&page_size=2>; rel="next", ` +
+				`<https://example.com/users?page=3&page_size=2>; rel="last"`,
+		},
+		{
+			name: "middle keeps other parameters",
+			uri:  "/users?archived=true&page=2&page_size=2",
+			page: Page{Number: 2, Size: 2, Total: 5},
+			expect: `</users?archived=true&page=1&page_size=2>; rel="first", ` +
+				`</users?archived=true&page=1&page_size=2>; rel="prev", ` +
+				`</users?archived=true&page=3&page_size=2>; rel="next", ` +
+				`</users?archived=true&page=3&page_size=2>; rel="last"`,
+		},
+		{
+			name: "last",
+			uri:  "/users",
+			page: Page{Number: 3, Size: 2, Total: 5},
+			expect: `</users?page=1&page_size=2>; rel="first", ` +
+				`</users?page=2&page_size=2>; rel="prev", ` +
+				`</users?page=3&page_size=2>; rel="last"`,
+		},
+		{
+			name: "past the end",
+			uri:  "/users",
+			page: Page{Number: 7, Size: 2, Total: 5},
+			expect: `</users?page=1&page_size=2>; rel="first", ` +
+				`</users?page=3&page_size=2>; rel="prev", ` +
+				`</users?page=3&page_size=2>; rel="last"`,
+		},
+		{
+			name: "largest page number with unknown total",
+			uri:  "/users",
+			page: Page{Number: math.MaxInt, Size: 2, Total: -1},
+			expect: `</users?page=1&page_size=2>; rel="first", ` +
+				`</users?page=` + strconv.Itoa(math.MaxInt-1) + `&page_size=2>; rel="prev"`,
+		},
+		{
+			name: "unknown total",
+			uri:  "/users",
+			page: Page{Number: 2, Size: 2, Total: -1},
+			expect: `</users?page=1&page_size=2>; rel="first", ` +
+				`</users?page=1&page_size=2>; rel="prev", ` +
+				`</users?page=3&page_size=2>; rel="next"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, tc.page.Links(tc.uri))
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package jelly
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DryRunOptions are options for a server created with
+// Environment.NewDryRunServer, which sets up everything that a server would
+// serve without serving it so that a deployment's config can be checked, such
+// as in CI.
+type DryRunOptions struct {
+	// ConnectDBs is whether the DBs in the config are connected to. If true,
+	// each DB is connected to and, if its Store is a PingingStore, pinged, and
+	// the APIs are given the connected Stores. If false, the DBs are only
+	// checked for having a registered connector, and APIs are given nil in
+	// place of each Store.
+	ConnectDBs bool
+}
+
+// PingingStore is a Store that can check that its connection to its DB is
+// alive. Stores that implement it are pinged when a dry run connects to them.
+type PingingStore interface {
+	Store
+
+	// Ping returns an error if the DB cannot be reached.
+	Ping(ctx context.Context) error
+}
+
+// ServerPlan is what a server will serve once started: its DBs, its APIs and
+// the DBs they are bound to, its global middleware, and every route. It is
+// returned by RESTServer.Plan.
+type ServerPlan struct {
+	// DryRun is whether the server was created with
+	// Environment.NewDryRunServer.
+	DryRun bool
+
+	// Listen is the address that the server will listen on, in "ADDRESS:PORT"
+	// form.
+	Listen string
+
+	// URIBase is the base path that all APIs in the server are mounted at.
+	URIBase string
+
+	// Middleware is the names of the middleware in the server's global
+	// middleware chain, in the order that it is applied.
+	Middleware []string
+
+	// DBs are the DBs in the server's config, sorted by name.
+	DBs []DBPlan
+
+	// APIs are the APIs that have been added to the server, in the order that
+	// they were added.
+	APIs []APIPlan
+
+	// Routes are the routes of the server, as returned by RESTServer.Routes.
+	Routes []RouteInfo
+}
+
+// DBPlan is a DB that a server uses.
+type DBPlan struct {
+	Name      string
+	Type      DBType
+	Connector string
+
+	// Connect is when the DB is connected to, as given in its config.
+	Connect ConnectPolicy
+
+	// Replicas is the number of read replicas of the DB.
+	Replicas int
+
+	// Failover is whether writes to the DB fail over to a healthy replica.
+	Failover bool
+
+	// Connected is whether the DB is currently connected to. It is false in a
+	// dry run that does not connect DBs, and for DBs that are not connected to
+	// eagerly until they are.
+	Connected bool
+
+	// UsedBy is the names of the enabled APIs that use the DB, sorted
+	// alphabetically.
+	UsedBy []string
+}
+
+// APIPlan is an API that has been added to a server.
+type APIPlan struct {
+	Name string
+
+	// Component is the name of the component that the API is an instance of,
+	// or the empty string if it is not a pre-rolled component.
+	Component string
+
+	Enabled bool
+
+	// Base is the complete base path of the API, including the server's
+	// URIBase. It is the empty string if the API is not enabled.
+	Base string
+
+	// UsesDBs is the names of the DBs that the API uses, in the order that its
+	// config gives them.
+	UsesDBs []string
+
+	// Middleware is the names of the middleware that is applied to every route
+	// of the API where it is mounted, in the order that it is applied.
+	Middleware []string
+}
+
+// String returns a human-readable report of the plan.
+func (p ServerPlan) String() string {
+	var sb strings.Builder
+
+	if p.DryRun {
+		sb.WriteString("Dry run; the server will not be started\n")
+	}
+	fmt.Fprintf(&sb, "Listen: %s\n", p.Listen)
+	fmt.Fprintf(&sb, "URI base: %s\n", p.URIBase)
+	fmt.Fprintf(&sb, "Global middleware: %s\n", listOrNone(p.Middleware, " -> "))
+
+	sb.WriteString("\nDBs:\n")
+	if len(p.DBs) == 0 {
+		sb.WriteString("  (none)\n")
+	}
+	for _, db := range p.DBs {
+		state := "connected"
+		if !db.Connected {
+			state = "not connected"
+		}
+		if db.Connect != "" && db.Connect != ConnectEager {
+			state += ", connects " + db.Connect.String()
+		}
+		if db.Replicas > 0 {
+			state += fmt.Sprintf(", %d replica(s)", db.Replicas)
+			if db.Failover {
+				state += " with failover"
+			}
+		}
+		fmt.Fprintf(&sb, "  %s (%s/%s, %s) - used by %s\n", db.Name, db.Type, db.Connector, state, listOrNone(db.UsedBy, ", "))
+	}
+
+	sb.WriteString("\nAPIs:\n")
+	if len(p.APIs) == 0 {
+		sb.WriteString("  (none)\n")
+	}
+	for _, api := range p.APIs {
+		name := api.Name
+		if api.Component != "" && api.Component != api.Name {
+			name += " (" + api.Component + ")"
+		}
+		if !api.Enabled {
+			fmt.Fprintf(&sb, "  %s - disabled\n", name)
+			continue
+		}
+		fmt.Fprintf(&sb, "  %s at %s\n", name, api.Base)
+		fmt.Fprintf(&sb, "    DBs: %s\n", listOrNone(api.UsesDBs, ", "))
+		fmt.Fprintf(&sb, "    Middleware: %s\n", listOrNone(api.Middleware, " -> "))
+	}
+
+	sb.WriteString("\nRoutes:\n")
+	if len(p.Routes) == 0 {
+		sb.WriteString("  (none)\n")
+	}
+	for _, r := range p.Routes {
+		fmt.Fprintf(&sb, "  %s %s [%s] - %s\n", r.Method, r.Path, r.API, listOrNone(r.Middleware, " -> "))
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// listOrNone joins items with sep, or returns "(none)" if there are no items.
+func listOrNone(items []string, sep string) string {
+	if len(items) == 0 {
+		return "(none)"
+	}
+	return strings.Join(items, sep)
+}
@@ -0,0 +1,230 @@
+package jelly
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	queryParsersMtx sync.RWMutex
+	queryParsers    = map[reflect.Type]func(string) (interface{}, error){}
+)
+
+func init() {
+	RegisterQueryParser(ParseRole)
+	RegisterQueryParser(ParseEnvelope)
+}
+
+// RegisterQueryParser registers parse as the function that BindQuery uses to
+// parse query parameters into fields of type E. It is typically given the
+// ParseX function of an enum type, such as ParseRole for Role. Registering a
+// parser for a type that already has one replaces it.
+func RegisterQueryParser[E any](parse func(string) (E, error)) {
+	t := reflect.TypeOf((*E)(nil)).Elem()
+
+	queryParsersMtx.Lock()
+	defer queryParsersMtx.Unlock()
+
+	queryParsers[t] = func(s string) (interface{}, error) {
+		return parse(s)
+	}
+}
+
+// BindQuery sets the fields of the struct that v points to from the query
+// parameters of req. Each field that is set has a struct tag giving the name of
+// its parameter, as in `query:"name"`; fields with no query tag or a tag of
+// "-" are not set, and fields whose parameter is not given keep their current
+// value, which allows defaults to be set before calling BindQuery. Adding
+// ",required" to the tag, as in `query:"name,required"`, makes it an error for
+// the parameter to not be given.
+//
+// Fields may be strings, bools, ints, uints, floats, time.Time (in RFC 3339
+// format), time.Duration, any type that implements encoding.TextUnmarshaler,
+// any type with a parser registered with RegisterQueryParser, or slices of or
+// pointers to any of those. Slices are set from every value given for their
+// parameter, each of which may be a comma-separated list.
+//
+// If a parameter is missing or cannot be parsed, the returned error matches
+// ErrBadArgument and has a message suitable for giving to the client with
+// ResponseGenerator.BadRequest. Fields are set in order and BindQuery stops at
+// the first bad parameter. If v is not a non-nil pointer to a struct, or if a
+// field has a type that BindQuery cannot set, a different error is returned.
+func BindQuery(req *http.Request, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("BindQuery requires a non-nil pointer to a struct but got %T", v)
+	}
+
+	return bindQueryStruct(req.URL.Query(), rv.Elem())
+}
+
+func bindQueryStruct(query map[string][]string, sv reflect.Value) error {
+	st := sv.Type()
+
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		fv := sv.Field(i)
+
+		tag, hasTag := sf.Tag.Lookup("query")
+		if !hasTag {
+			// embedded structs are bound as if their fields were in this one
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				if err := bindQueryStruct(query, fv); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if tag == "-" || !sf.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		required := opts == "required"
+
+		values, ok := query[name]
+		if !ok || len(values) == 0 {
+			if required {
+				return NewError(name+": is required", ErrBadArgument)
+			}
+			continue
+		}
+
+		if err := setQueryField(fv, values); err != nil {
+			if _, unsupported := err.(unsupportedQueryTypeError); unsupported {
+				return fmt.Errorf("field %s: %w", sf.Name, err)
+			}
+			return NewError(name+": "+err.Error(), ErrBadArgument)
+		}
+	}
+
+	return nil
+}
+
+// unsupportedQueryTypeError is returned by setQueryField for fields whose
+// type cannot be parsed from a query parameter.
+type unsupportedQueryTypeError struct {
+	t reflect.Type
+}
+
+func (e unsupportedQueryTypeError) Error() string {
+	return fmt.Sprintf("cannot bind query parameter to type %s", e.t)
+}
+
+// setQueryField sets fv from the values given for its query parameter.
+func setQueryField(fv reflect.Value, values []string) error {
+	if _, ok := queryParser(fv.Type()); !ok && fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		var items []string
+		for _, v := range values {
+			items = append(items, strings.Split(v, ",")...)
+		}
+
+		sl := reflect.MakeSlice(fv.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setQueryValue(sl.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		fv.Set(sl)
+		return nil
+	}
+
+	// for non-slices, the last value given is used
+	return setQueryValue(fv, values[len(values)-1])
+}
+
+func queryParser(t reflect.Type) (func(string) (interface{}, error), bool) {
+	queryParsersMtx.RLock()
+	defer queryParsersMtx.RUnlock()
+
+	parse, ok := queryParsers[t]
+	return parse, ok
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// setQueryValue sets a single non-slice value from s.
+func setQueryValue(v reflect.Value, s string) error {
+	if parse, ok := queryParser(v.Type()); ok {
+		parsed, err := parse(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(parsed))
+		return nil
+	}
+
+	if v.Kind() == reflect.Pointer {
+		pv := reflect.New(v.Type().Elem())
+		if err := setQueryValue(pv.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(pv)
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return fmt.Errorf("must be a time in RFC 3339 format")
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as \"1h30m\"")
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	if v.CanAddr() {
+		if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return tu.UnmarshalText([]byte(s))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a non-negative integer")
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		v.SetFloat(f)
+	default:
+		return unsupportedQueryTypeError{t: v.Type()}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package jelly
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BindQuery(t *testing.T) {
+	type embedded struct {
+		Page int `query:"page"`
+	}
+	type params struct {
+		embedded
+		Archived bool          `query:"archived"`
+		Limit    int           `query:"limit"`
+		Ratio    float64       `query:"ratio"`
+		Since    time.Time     `query:"since"`
+		Timeout  time.Duration `query:"timeout"`
+		Roles    []Role        `query:"role"`
+		IDs      []uuid.UUID   `query:"id"`
+		Name     *string       `query:"name"`
+		Ignored  string        `query:"-"`
+		Untagged string
+	}
+
+	name := "Nepeta"
+	id1 := uuid.MustParse("0b1e7a8e-1f5c-4c42-9d1a-3f0d2c8b7e61")
+	id2 := uuid.MustParse("5d2b8c49-6f0e-4e2a-8a3b-9c1d4e5f6a7b")
+
+	testCases := []struct {
+		name         string
+		query        string
+		start        params
+		expect       params
+		expectBadArg bool
+	}{
+		{
+			name:   "no params keeps existing values",
+			query:  "",
+			start:  params{Limit: 20},
+			expect: params{Limit: 20},
+		},
+		{
+			name:  "all types",
+			query: "?archived=true&limit=5&ratio=0.5&since=2024-03-01T12:00:00Z&timeout=1m30s&role=admin,normal&role=guest&id=" + id1.String() + "&id=" + id2.String() + "&name=Nepeta&page=2&Ignored=x&Untagged=x",
+			expect: params{
+				embedded: embedded{Page: 2},
+				Archived: true,
+				Limit:    5,
+				Ratio:    0.5,
+				Since:    time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+				Timeout:  90 * time.Second,
+				Roles:    []Role{Admin, Normal, Guest},
+				IDs:      []uuid.UUID{id1, id2},
+				Name:     &name,
+			},
+		},
+		{
+			name:         "bad bool",
+			query:        "?archived=maybe",
+			expectBadArg: true,
+		},
+		{
+			name:         "bad int",
+			query:        "?limit=many",
+			expectBadArg: true,
+		},
+		{
+			name:         "bad time",
+			query:        "?since=yesterday",
+			expectBadArg: true,
+		},
+		{
+			name:         "bad enum",
+			query:        "?role=admin,emperor",
+			expectBadArg: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			req := httptest.NewRequest("GET", "/"+tc.query, nil)
+
+			actual := tc.start
+			err := BindQuery(req, &actual)
+
+			if tc.expectBadArg {
+				assert.True(errors.Is(err, ErrBadArgument), "expected ErrBadArgument but got %v", err)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+			assert.Equal(tc.expect, actual)
+		})
+	}
+}
+
+func Test_BindQuery_required(t *testing.T) {
+	var params struct {
+		Q string `query:"q,required"`
+	}
+
+	err := BindQuery(httptest.NewRequest("GET", "/", nil), &params)
+
+	assert.True(t, errors.Is(err, ErrBadArgument))
+	assert.Contains(t, err.Error(), "q: is required")
+}
+
+func Test_BindQuery_notStructPointer(t *testing.T) {
+	var n int
+
+	err := BindQuery(httptest.NewRequest("GET", "/", nil), &n)
+
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrBadArgument))
+}
@@ -0,0 +1,330 @@
+package jelly
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// QuotaPeriod is how often the usage of a quota is reset.
+type QuotaPeriod string
+
+const (
+	// QuotaPeriodNone is the period of a quota whose usage is never reset,
+	// such as one on the amount of storage a user has.
+	QuotaPeriodNone QuotaPeriod = ""
+
+	QuotaPeriodMinute QuotaPeriod = "minute"
+	QuotaPeriodHour   QuotaPeriod = "hour"
+	QuotaPeriodDay    QuotaPeriod = "day"
+
+	// QuotaPeriodWeek is the period of a quota whose usage is reset each
+	// Monday.
+	QuotaPeriodWeek QuotaPeriod = "week"
+
+	QuotaPeriodMonth QuotaPeriod = "month"
+)
+
+// Start returns the start of the period that t is in. Periods are calculated
+// in UTC. If qp is QuotaPeriodNone, the zero Time is returned.
+func (qp QuotaPeriod) Start(t time.Time) time.Time {
+	t = t.UTC()
+	switch qp {
+	case QuotaPeriodMinute:
+		return t.Truncate(time.Minute)
+	case QuotaPeriodHour:
+		return t.Truncate(time.Hour)
+	case QuotaPeriodDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case QuotaPeriodWeek:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+	case QuotaPeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Time{}
+	}
+}
+
+// End returns the start of the period after the one that t is in. If qp is
+// QuotaPeriodNone, the zero Time is returned.
+func (qp QuotaPeriod) End(t time.Time) time.Time {
+	start := qp.Start(t)
+	switch qp {
+	case QuotaPeriodMinute:
+		return start.Add(time.Minute)
+	case QuotaPeriodHour:
+		return start.Add(time.Hour)
+	case QuotaPeriodDay:
+		return start.AddDate(0, 0, 1)
+	case QuotaPeriodWeek:
+		return start.AddDate(0, 0, 7)
+	case QuotaPeriodMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return time.Time{}
+	}
+}
+
+func (qp QuotaPeriod) Validate() error {
+	switch qp {
+	case QuotaPeriodNone, QuotaPeriodMinute, QuotaPeriodHour, QuotaPeriodDay, QuotaPeriodWeek, QuotaPeriodMonth:
+		return nil
+	default:
+		return fmt.Errorf("must be one of \"minute\", \"hour\", \"day\", \"week\", or \"month\", or empty for none; got %q", string(qp))
+	}
+}
+
+// QuotaLimit is the definition of a single named quota.
+type QuotaLimit struct {
+	// Limit is the maximum usage that each user may have in a period.
+	Limit int64
+
+	// Period is how often the usage of each user is reset. If not set, it is
+	// never reset.
+	Period QuotaPeriod
+
+	// PerRequest is whether each request made by a logged-in user uses one of
+	// the quota. Requests are only counted against it if the "quota"
+	// middleware is in the server's middleware chain.
+	PerRequest bool
+}
+
+func (ql QuotaLimit) Validate() error {
+	if ql.Limit < 1 {
+		return fmt.Errorf("limit: must be at least 1")
+	}
+	if err := ql.Period.Validate(); err != nil {
+		return fmt.Errorf("period: %w", err)
+	}
+	return nil
+}
+
+// Current returns whether key is for the current period of the quota it is
+// for, according to ql. Usage of past periods is no longer used and may be
+// discarded.
+func (ql QuotaLimit) Current(key QuotaKey, now time.Time) bool {
+	return key.Period.Equal(ql.Period.Start(now))
+}
+
+// QuotaConfig contains options for the quotas that APIs get from
+// Bundle.Quotas.
+type QuotaConfig struct {
+	// DB is the name of the configured DB that the usage of quotas is kept
+	// in. Its store must implement QuotaStore. If not set, usage is kept in
+	// memory and is lost when the server stops.
+	DB string
+
+	// PersistIntervalMillis is the amount of time (in milliseconds) between
+	// writes of the usage of quotas to DB. If set, usage is counted in memory
+	// and written to DB in batches on this interval and when the server shuts
+	// down, so that quotas are not reset by a restart without every request
+	// waiting on the DB. Usage made since the last write is lost if the
+	// server stops without shutting down. If not set, every change to usage
+	// is written to DB as it is made. It must not be set if DB is not.
+	PersistIntervalMillis int
+
+	// Limits are the quotas that are defined, keyed by their names.
+	Limits map[string]QuotaLimit
+}
+
+func (qc QuotaConfig) FillDefaults() QuotaConfig {
+	newQC := qc
+
+	if len(qc.Limits) > 0 {
+		newQC.Limits = make(map[string]QuotaLimit, len(qc.Limits))
+		for name, ql := range qc.Limits {
+			newQC.Limits[strings.ToLower(name)] = ql
+		}
+	}
+
+	return newQC
+}
+
+func (qc QuotaConfig) Validate() error {
+	if qc.PersistIntervalMillis < 0 {
+		return fmt.Errorf("persist_interval: must not be negative")
+	}
+	if qc.PersistIntervalMillis > 0 && qc.DB == "" {
+		return fmt.Errorf("persist_interval: requires db to be set")
+	}
+
+	names := make([]string, 0, len(qc.Limits))
+	for name := range qc.Limits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("limits: quota name must not be empty")
+		}
+		if err := qc.Limits[name].Validate(); err != nil {
+			return fmt.Errorf("limits: %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// QuotaKey identifies the usage of a quota by a single user in a single
+// period.
+type QuotaKey struct {
+	// Quota is the name of the quota.
+	Quota string
+
+	// UserID is the ID of the user that the usage is for.
+	UserID uuid.UUID
+
+	// Period is the start of the period that the usage is for. It is the zero
+	// Time for quotas that are never reset.
+	Period time.Time
+}
+
+// QuotaRepo is a repository that holds the usage of quotas.
+type QuotaRepo interface {
+	// Add adds amount to the usage recorded for key and returns the new usage.
+	// Amount may be negative to give back usage, but usage is never made less
+	// than 0. If amount is positive and the new usage would be greater than
+	// limit, the usage is not changed and an error matching ErrQuotaExceeded
+	// is returned along with the current usage.
+	Add(ctx context.Context, key QuotaKey, amount int64, limit int64) (int64, error)
+
+	// Usage returns the usage recorded for key. If none has been recorded, it
+	// returns 0.
+	Usage(ctx context.Context, key QuotaKey) (int64, error)
+
+	// Close performs any operations required to close the repository.
+	Close() error
+}
+
+// QuotaStore is an interface that can optionally be implemented by a Store to
+// add persistence of the usage of quotas. The built-in authuser stores all
+// implement it.
+type QuotaStore interface {
+	// Quotas returns a repository that holds the usage of quotas.
+	Quotas() QuotaRepo
+}
+
+// QuotaUsage is the usage of a quota by a single user.
+type QuotaUsage struct {
+	// Quota is the name of the quota.
+	Quota string
+
+	// Limit is the maximum usage allowed in a period.
+	Limit int64
+
+	// Used is the usage in the current period.
+	Used int64
+
+	// Resets is the time that the current period ends. It is the zero Time for
+	// quotas that are never reset.
+	Resets time.Time
+}
+
+// Remaining returns how much of the quota is left in the current period.
+func (qu QuotaUsage) Remaining() int64 {
+	if qu.Used >= qu.Limit {
+		return 0
+	}
+	return qu.Limit - qu.Used
+}
+
+// QuotaManager tracks the usage of the quotas defined in the server's config
+// by each user. Every API on a server gets the same QuotaManager from
+// Bundle.Quotas.
+type QuotaManager struct {
+	limits map[string]QuotaLimit
+	repo   QuotaRepo
+}
+
+// NewQuotaManager creates a QuotaManager for the quotas defined in cfg that
+// keeps their usage in repo.
+func NewQuotaManager(cfg QuotaConfig, repo QuotaRepo) *QuotaManager {
+	return &QuotaManager{
+		limits: cfg.FillDefaults().Limits,
+		repo:   repo,
+	}
+}
+
+// Limit returns the definition of the named quota. If no quota with that name
+// is defined, ok will be false.
+func (qm *QuotaManager) Limit(quota string) (ql QuotaLimit, ok bool) {
+	ql, ok = qm.limits[strings.ToLower(quota)]
+	return ql, ok
+}
+
+// PerRequest returns the names of all quotas that each request uses one of,
+// in alphabetical order.
+func (qm *QuotaManager) PerRequest() []string {
+	var names []string
+	for name, ql := range qm.limits {
+		if ql.PerRequest {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Consume uses amount of the named quota for the given user. Amount may be
+// negative to give back usage, such as when a user deletes stored data. If
+// using amount would exceed the quota, none of it is used and an error
+// matching ErrQuotaExceeded is returned along with the current usage. If no
+// quota with that name is defined, an error matching ErrNotFound is returned.
+func (qm *QuotaManager) Consume(ctx context.Context, quota string, userID uuid.UUID, amount int64) (QuotaUsage, error) {
+	key, usage, err := qm.key(quota, userID)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+
+	used, err := qm.repo.Add(ctx, key, amount, usage.Limit)
+	usage.Used = used
+	if err != nil {
+		return usage, err
+	}
+	return usage, nil
+}
+
+// Usage returns the current usage of the named quota by the given user. If no
+// quota with that name is defined, an error matching ErrNotFound is returned.
+func (qm *QuotaManager) Usage(ctx context.Context, quota string, userID uuid.UUID) (QuotaUsage, error) {
+	key, usage, err := qm.key(quota, userID)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+
+	used, err := qm.repo.Usage(ctx, key)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	usage.Used = used
+	return usage, nil
+}
+
+// key returns the key of the current period of the named quota for the user,
+// along with a QuotaUsage that has everything but Used set.
+func (qm *QuotaManager) key(quota string, userID uuid.UUID) (QuotaKey, QuotaUsage, error) {
+	quota = strings.ToLower(quota)
+	ql, ok := qm.limits[quota]
+	if !ok {
+		return QuotaKey{}, QuotaUsage{}, fmt.Errorf("%w: no quota named %q is defined", ErrNotFound, quota)
+	}
+
+	now := time.Now()
+	key := QuotaKey{
+		Quota:  quota,
+		UserID: userID,
+		Period: ql.Period.Start(now),
+	}
+	usage := QuotaUsage{
+		Quota:  quota,
+		Limit:  ql.Limit,
+		Resets: ql.Period.End(now),
+	}
+	return key, usage, nil
+}
@@ -0,0 +1,52 @@
+package jelly
+
+import "fmt"
+
+// RateLimitConfig contains options for the "ratelimit" built-in middleware,
+// which limits how often each client may make requests to the server. Clients
+// are told apart by their remote address, so the "real_ip" middleware should
+// come before it when the server is behind a proxy. Requests over the limit
+// are rejected with an HTTP-429.
+type RateLimitConfig struct {
+	// Requests is the number of requests that each client may make per
+	// period. If 0, there is no limit and the middleware has no effect.
+	Requests int
+
+	// PeriodMillis is the length of the period that Requests is counted over,
+	// in milliseconds. Requests become available again evenly over the
+	// period rather than all at once at its end. It will default to 1000 (1
+	// second) if not set.
+	PeriodMillis int
+
+	// Burst is the maximum number of requests that a client may make at
+	// once after not making any for a while. It will default to Requests if
+	// not set.
+	Burst int
+}
+
+func (rc RateLimitConfig) FillDefaults() RateLimitConfig {
+	newRC := rc
+
+	if newRC.PeriodMillis == 0 {
+		newRC.PeriodMillis = 1000
+	}
+	if newRC.Burst == 0 {
+		newRC.Burst = newRC.Requests
+	}
+
+	return newRC
+}
+
+func (rc RateLimitConfig) Validate() error {
+	if rc.Requests < 0 {
+		return fmt.Errorf("requests: must not be negative")
+	}
+	if rc.PeriodMillis < 0 {
+		return fmt.Errorf("period: must not be negative")
+	}
+	if rc.Burst < 0 {
+		return fmt.Errorf("burst: must not be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package jelly
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicationHealth is whether a DB and each of its replicas were healthy when
+// last checked.
+type ReplicationHealth struct {
+	// Primary is whether the DB itself is healthy.
+	Primary bool `json:"primary"`
+
+	// Replicas is whether each replica is healthy, in the order they are
+	// configured.
+	Replicas []bool `json:"replicas"`
+
+	// FailedOver is whether writes are going to a replica because the DB
+	// itself is unhealthy.
+	FailedOver bool `json:"failed_over"`
+}
+
+// ReplicatedStore is a Store for a DB with a primary and read replicas. APIs
+// get it with Bundle.ReplicatedDB and call ReadStore for the Store to use for
+// an operation that only reads, and WriteStore for one that writes; each gives
+// the Store of the same type that the DB's connector returns. It is safe for
+// concurrent use.
+//
+// Reads are spread across the healthy replicas in turn, and go to the primary
+// if there are none. If health checks are started with StartHealthChecks and
+// failover is enabled, writes go to the first healthy replica while the
+// primary is unhealthy.
+type ReplicatedStore struct {
+	name     string
+	primary  Store
+	replicas []Store
+	failover bool
+
+	next uint32 // index of the next replica to read from; used atomically
+
+	mtx     sync.RWMutex
+	healthy []bool // index 0 is the primary, and i+1 is replica i
+	stop    chan struct{}
+	closed  bool
+}
+
+// NewReplicatedStore returns a ReplicatedStore of the named DB whose primary
+// Store is primary and whose replicas are replicas. All are considered healthy
+// until they are checked. If failover is set, writes go to a healthy replica
+// while the primary is unhealthy.
+func NewReplicatedStore(name string, primary Store, replicas []Store, failover bool) *ReplicatedStore {
+	rs := &ReplicatedStore{
+		name:     name,
+		primary:  primary,
+		replicas: replicas,
+		failover: failover,
+		healthy:  make([]bool, len(replicas)+1),
+	}
+	for i := range rs.healthy {
+		rs.healthy[i] = true
+	}
+	return rs
+}
+
+// Name returns the name of the DB in the config.
+func (rs *ReplicatedStore) Name() string {
+	return rs.name
+}
+
+// Primary returns the Store of the DB itself, regardless of its health.
+func (rs *ReplicatedStore) Primary() Store {
+	return rs.primary
+}
+
+// Replicas returns the Stores of the replicas of the DB, in the order they are
+// configured, regardless of their health.
+func (rs *ReplicatedStore) Replicas() []Store {
+	replicas := make([]Store, len(rs.replicas))
+	copy(replicas, rs.replicas)
+	return replicas
+}
+
+// ReadStore returns the Store to use for an operation that only reads. It is
+// the next healthy replica in turn, or the primary if there are no healthy
+// replicas.
+func (rs *ReplicatedStore) ReadStore() Store {
+	if len(rs.replicas) == 0 {
+		return rs.primary
+	}
+
+	rs.mtx.RLock()
+	defer rs.mtx.RUnlock()
+
+	start := atomic.AddUint32(&rs.next, 1) - 1
+	for i := 0; i < len(rs.replicas); i++ {
+		idx := (int(start) + i) % len(rs.replicas)
+		if rs.healthy[idx+1] {
+			return rs.replicas[idx]
+		}
+	}
+	return rs.primary
+}
+
+// WriteStore returns the Store to use for an operation that writes. It is the
+// primary, unless failover is enabled and the primary is unhealthy, in which
+// case it is the first healthy replica. If no replica is healthy either, it is
+// the primary.
+func (rs *ReplicatedStore) WriteStore() Store {
+	rs.mtx.RLock()
+	defer rs.mtx.RUnlock()
+
+	if idx := rs.writeIndex(); idx >= 0 {
+		return rs.replicas[idx]
+	}
+	return rs.primary
+}
+
+// writeIndex returns the index of the replica that writes go to, or -1 if they
+// go to the primary. rs.mtx must be held by the caller.
+func (rs *ReplicatedStore) writeIndex() int {
+	if !rs.failover || rs.healthy[0] {
+		return -1
+	}
+	for i := range rs.replicas {
+		if rs.healthy[i+1] {
+			return i
+		}
+	}
+	return -1
+}
+
+// Health returns whether the primary and each replica were healthy when last
+// checked.
+func (rs *ReplicatedStore) Health() ReplicationHealth {
+	rs.mtx.RLock()
+	defer rs.mtx.RUnlock()
+
+	health := ReplicationHealth{
+		Primary:    rs.healthy[0],
+		Replicas:   make([]bool, len(rs.replicas)),
+		FailedOver: rs.writeIndex() >= 0,
+	}
+	copy(health.Replicas, rs.healthy[1:])
+	return health
+}
+
+// Ping pings the primary and each replica whose Store is a PingingStore and
+// records whether each is healthy. It returns the error of the first that
+// could not be pinged, so that ReplicatedStore is itself a PingingStore.
+func (rs *ReplicatedStore) Ping(ctx context.Context) error {
+	_, _, err := rs.checkHealth(ctx)
+	return err
+}
+
+// checkHealth pings every Store and records whether each is healthy. It returns
+// the new health of each, the indexes in rs.healthy whose health changed, and
+// the error of the first Store that could not be pinged.
+func (rs *ReplicatedStore) checkHealth(ctx context.Context) ([]bool, []int, error) {
+	stores := append([]Store{rs.primary}, rs.replicas...)
+	healthy := make([]bool, len(stores))
+	var firstErr error
+	for i, s := range stores {
+		healthy[i] = true
+		pinger, ok := s.(PingingStore)
+		if !ok {
+			continue
+		}
+		if err := pinger.Ping(ctx); err != nil {
+			healthy[i] = false
+			if firstErr == nil {
+				if i == 0 {
+					firstErr = err
+				} else {
+					firstErr = fmt.Errorf("replicas[%d]: %w", i-1, err)
+				}
+			}
+		}
+	}
+
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	var changed []int
+	for i := range healthy {
+		if healthy[i] != rs.healthy[i] {
+			changed = append(changed, i)
+		}
+	}
+	rs.healthy = healthy
+	return healthy, changed, firstErr
+}
+
+// StartHealthChecks starts checking the health of the primary and each replica
+// every interval in the background until the ReplicatedStore is closed. Each
+// check times out after interval. If onChange is not nil, it is called each
+// time that the health of one changes, with replica set to -1 for the primary.
+// It does nothing if health checks were already started.
+func (rs *ReplicatedStore) StartHealthChecks(interval time.Duration, onChange func(replica int, healthy bool)) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	if rs.stop != nil || rs.closed {
+		return
+	}
+	stop := make(chan struct{})
+	rs.stop = stop
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				healthy, changed, _ := rs.checkHealth(ctx)
+				cancel()
+
+				if onChange == nil {
+					continue
+				}
+				for _, idx := range changed {
+					onChange(idx-1, healthy[idx])
+				}
+			}
+		}
+	}()
+}
+
+// Close stops health checks and closes the primary and every replica. It
+// returns the first error that closing one of them returns.
+func (rs *ReplicatedStore) Close() error {
+	return rs.CloseContext(context.Background())
+}
+
+// CloseContext is like Close but closes the primary and each replica with
+// CloseStore, giving up on each once ctx is done.
+func (rs *ReplicatedStore) CloseContext(ctx context.Context) error {
+	rs.mtx.Lock()
+	if rs.closed {
+		rs.mtx.Unlock()
+		return nil
+	}
+	rs.closed = true
+	if rs.stop != nil {
+		close(rs.stop)
+	}
+	rs.mtx.Unlock()
+
+	err := CloseStore(ctx, rs.primary)
+	for i, r := range rs.replicas {
+		if rErr := CloseStore(ctx, r); rErr != nil && err == nil {
+			err = fmt.Errorf("replicas[%d]: %w", i, rErr)
+		}
+	}
+	return err
+}
+
+// writeStoreOf returns the Store that db writes to if it is a ReplicatedStore,
+// or db itself otherwise.
+func writeStoreOf(db Store) Store {
+	if rs, ok := db.(*ReplicatedStore); ok {
+		return rs.WriteStore()
+	}
+	return db
+}
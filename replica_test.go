@@ -0,0 +1,168 @@
+package jelly
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// healthStore is a PingingStore whose health can be changed.
+type healthStore struct {
+	label string
+
+	mtx *sync.Mutex
+	err *error
+}
+
+func newHealthStore(label string) healthStore {
+	return healthStore{label: label, mtx: &sync.Mutex{}, err: new(error)}
+}
+
+func (s healthStore) Close() error { return nil }
+
+func (s healthStore) Ping(ctx context.Context) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return *s.err
+}
+
+func (s healthStore) setErr(err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	*s.err = err
+}
+
+func Test_ReplicatedStore_ReadStore(t *testing.T) {
+	assert := assert.New(t)
+
+	primary := newHealthStore("primary")
+	r0, r1 := newHealthStore("r0"), newHealthStore("r1")
+	rs := NewReplicatedStore("main", primary, []Store{r0, r1}, false)
+
+	var reads []string
+	for i := 0; i < 4; i++ {
+		reads = append(reads, rs.ReadStore().(healthStore).label)
+	}
+	assert.Equal([]string{"r0", "r1", "r0", "r1"}, reads)
+
+	r0.setErr(errors.New("connection reset"))
+	err := rs.Ping(context.Background())
+	assert.EqualError(err, "replicas[0]: connection reset")
+	assert.Equal(ReplicationHealth{Primary: true, Replicas: []bool{false, true}}, rs.Health())
+
+	reads = nil
+	for i := 0; i < 3; i++ {
+		reads = append(reads, rs.ReadStore().(healthStore).label)
+	}
+	assert.Equal([]string{"r1", "r1", "r1"}, reads)
+
+	r1.setErr(errors.New("connection reset"))
+	assert.Error(rs.Ping(context.Background()))
+	assert.Equal("primary", rs.ReadStore().(healthStore).label)
+}
+
+func Test_ReplicatedStore_WriteStore(t *testing.T) {
+	testCases := []struct {
+		name       string
+		failover   bool
+		replicaErr error
+		expect     string
+		expectOver bool
+	}{
+		{
+			name:   "no failover",
+			expect: "primary",
+		},
+		{
+			name:       "failover to healthy replica",
+			failover:   true,
+			expect:     "r0",
+			expectOver: true,
+		},
+		{
+			name:       "no healthy replica",
+			failover:   true,
+			replicaErr: errors.New("no route to host"),
+			expect:     "primary",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			primary, r0 := newHealthStore("primary"), newHealthStore("r0")
+			rs := NewReplicatedStore("main", primary, []Store{r0}, tc.failover)
+			assert.Equal("primary", rs.WriteStore().(healthStore).label)
+
+			primary.setErr(errors.New("no route to host"))
+			r0.setErr(tc.replicaErr)
+			assert.EqualError(rs.Ping(context.Background()), "no route to host")
+
+			assert.Equal(tc.expect, rs.WriteStore().(healthStore).label)
+			assert.Equal(tc.expectOver, rs.Health().FailedOver)
+
+			primary.setErr(nil)
+			rs.Ping(context.Background())
+			assert.Equal("primary", rs.WriteStore().(healthStore).label)
+		})
+	}
+}
+
+func Test_ReplicatedStore_StartHealthChecks(t *testing.T) {
+	assert := assert.New(t)
+
+	primary, r0 := newHealthStore("primary"), newHealthStore("r0")
+	rs := NewReplicatedStore("main", primary, []Store{r0}, true)
+
+	changes := make(chan [2]interface{}, 4)
+	rs.StartHealthChecks(time.Millisecond, func(replica int, healthy bool) {
+		changes <- [2]interface{}{replica, healthy}
+	})
+	defer rs.Close()
+
+	primary.setErr(errors.New("no route to host"))
+	select {
+	case change := <-changes:
+		assert.Equal([2]interface{}{-1, false}, change)
+	case <-time.After(time.Second):
+		assert.Fail("health change was never reported")
+		return
+	}
+	assert.Equal("r0", rs.WriteStore().(healthStore).label)
+
+	primary.setErr(nil)
+	select {
+	case change := <-changes:
+		assert.Equal([2]interface{}{-1, true}, change)
+	case <-time.After(time.Second):
+		assert.Fail("health change was never reported")
+	}
+}
+
+func Test_Bundle_ReplicatedDB(t *testing.T) {
+	assert := assert.New(t)
+
+	primary, r0 := newHealthStore("primary"), newHealthStore("r0")
+	replicated := NewReplicatedStore("main", primary, []Store{r0}, false)
+	plain := newHealthStore("plain")
+
+	bndl := NewBundle((&CommonConfig{Name: "api", UsesDBs: []string{"main", "other"}}).FillDefaults(), Globals{}, nil, map[string]Store{
+		"main":  replicated,
+		"other": plain,
+	})
+
+	assert.Same(replicated, bndl.ReplicatedDB(0))
+	assert.Equal("primary", bndl.DB(0).(healthStore).label)
+
+	other := bndl.ReplicatedDB(1)
+	if assert.NotNil(other) {
+		assert.Equal("plain", other.ReadStore().(healthStore).label)
+		assert.Equal("plain", other.WriteStore().(healthStore).label)
+	}
+	assert.Equal("plain", bndl.DB(1).(healthStore).label)
+}
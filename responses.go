@@ -4,11 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type ErrorResponse struct {
 	Error  string `json:"error"`
 	Status int    `json:"status"`
+
+	// Fields gives the fields that were invalid, for responses to a
+	// ValidationError.
+	Fields []FieldError `json:"fields,omitempty"`
 }
 
 // should not be directly init'd probs because log will not be set
@@ -21,8 +26,15 @@ type Result struct {
 	Resp  interface{}
 	Redir string // only used for redirects
 
+	// Envelope is the envelope that Resp is in, if it was created with
+	// ResponseGenerator.Resource.
+	Envelope Envelope
+
 	hdrs [][2]string
 
+	// fields selected with WithFields.
+	fields map[string][]string
+
 	log Logger
 
 	// set by calling PrepareMarshaledResponse.
@@ -30,18 +42,41 @@ type Result struct {
 }
 
 func (r Result) WithHeader(name, val string) Result {
-	erCopy := Result{
+	erCopy := r.copy()
+	erCopy.hdrs = append(erCopy.hdrs, [2]string{name, val})
+	return erCopy
+}
+
+// WithLastModified returns a copy of r with the Last-Modified header set to t.
+// If t is the zero time, r is returned unchanged. See NotModifiedSince for
+// answering the conditional requests that clients make with it.
+func (r Result) WithLastModified(t time.Time) Result {
+	if t.IsZero() {
+		return r
+	}
+	return r.WithHeader("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+// hasBody returns whether the status of r is one that allows a response body.
+func (r Result) hasBody() bool {
+	return r.Status != http.StatusNoContent && r.Status != http.StatusNotModified
+}
+
+// copy returns a copy of r that does not share its headers and that has not
+// had its response marshaled.
+func (r Result) copy() Result {
+	return Result{
 		IsErr:       r.IsErr,
 		IsJSON:      r.IsJSON,
 		Status:      r.Status,
 		InternalMsg: r.InternalMsg,
 		Resp:        r.Resp,
-		hdrs:        r.hdrs,
+		Redir:       r.Redir,
+		Envelope:    r.Envelope,
+		hdrs:        append([][2]string{}, r.hdrs...),
+		fields:      r.fields,
 		log:         r.log,
 	}
-
-	erCopy.hdrs = append(erCopy.hdrs, [2]string{name, val})
-	return erCopy
 }
 
 // PrepareMarshaledResponse sets the respJSONBytes to the marshaled version of
@@ -56,12 +91,19 @@ func (r *Result) PrepareMarshaledResponse() error {
 		return nil
 	}
 
-	if r.IsJSON && r.Status != http.StatusNoContent && r.Redir == "" {
+	if r.IsJSON && r.hasBody() && r.Redir == "" {
 		var err error
-		r.respJSONBytes, err = json.Marshal(r.Resp)
+		respJSONBytes, err := json.Marshal(r.Resp)
 		if err != nil {
 			return err
 		}
+		if len(r.fields) > 0 {
+			respJSONBytes, err = selectFields(respJSONBytes, r.Envelope, r.fields)
+			if err != nil {
+				return err
+			}
+		}
+		r.respJSONBytes = respJSONBytes
 	}
 
 	return nil
@@ -73,6 +115,7 @@ func (r Result) WriteResponse(w http.ResponseWriter) {
 		panic("result not populated")
 	}
 
+	marshalStart := time.Now()
 	err := r.PrepareMarshaledResponse()
 	if err != nil {
 		panic(fmt.Sprintf("could not marshal response: %s", err.Error()))
@@ -89,10 +132,11 @@ func (r Result) WriteResponse(w http.ResponseWriter) {
 	} else {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
-		if r.Status != http.StatusNoContent && r.Redir == "" {
+		if r.hasBody() && r.Redir == "" {
 			respBytes = []byte(fmt.Sprintf("%v", r.Resp))
 		}
 	}
+	marshalTime := time.Since(marshalStart)
 
 	// if there is a redir, handle that now
 	if r.Redir != "" {
@@ -105,8 +149,56 @@ func (r Result) WriteResponse(w http.ResponseWriter) {
 
 	w.WriteHeader(r.Status)
 
-	if r.Status != http.StatusNoContent {
-		w.Write(respBytes)
+	var n int
+	if r.hasBody() {
+		n, _ = w.Write(respBytes)
+	}
+	RecordResponseMetrics(w, ResponseMetrics{Marshal: marshalTime, Bytes: int64(n)})
+}
+
+// ResponseMetrics are measurements of how a response was made, for finding
+// endpoints that are slow or that give oversized responses. They are collected
+// by middleware that wraps the http.ResponseWriter of a request in a
+// ResponseMetricsWriter, such as the "access_log" built-in middleware.
+type ResponseMetrics struct {
+	// Handler is how long the EndpointFunc took to return the Result that was
+	// written. It is only measured for endpoints created with
+	// ServiceProvider.Endpoint.
+	Handler time.Duration
+
+	// Marshal is how long the body of the Result took to marshal.
+	Marshal time.Duration
+
+	// Bytes is the size of the body that was written by Result.WriteResponse.
+	// It is measured before any compression done by middleware, so it is
+	// larger than the number of bytes sent to the client if the response was
+	// compressed.
+	Bytes int64
+}
+
+// ResponseMetricsWriter is an http.ResponseWriter that collects the
+// ResponseMetrics of the response written to it. See RecordResponseMetrics.
+type ResponseMetricsWriter interface {
+	http.ResponseWriter
+
+	// AddResponseMetrics adds m to the metrics collected so far.
+	AddResponseMetrics(m ResponseMetrics)
+}
+
+// RecordResponseMetrics adds m to the metrics of every ResponseMetricsWriter
+// that w is or wraps. Writers are unwrapped with their Unwrap method, as done
+// by http.ResponseController. It is called by Result.WriteResponse, and may be
+// called by handlers that write responses in other ways.
+func RecordResponseMetrics(w http.ResponseWriter, m ResponseMetrics) {
+	for w != nil {
+		if mw, ok := w.(ResponseMetricsWriter); ok {
+			mw.AddResponseMetrics(m)
+		}
+		uw, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return
+		}
+		w = uw.Unwrap()
 	}
 }
 
@@ -115,6 +207,7 @@ type ResponseGenerator interface {
 	NoContent(internalMsg ...interface{}) Result
 	Created(respObj interface{}, internalMsg ...interface{}) Result
 	Conflict(userMsg string, internalMsg ...interface{}) Result
+	PreconditionFailed(userMsg string, internalMsg ...interface{}) Result
 	BadRequest(userMsg string, internalMsg ...interface{}) Result
 	MethodNotAllowed(req *http.Request, internalMsg ...interface{}) Result
 	NotFound(internalMsg ...interface{}) Result
@@ -123,6 +216,74 @@ type ResponseGenerator interface {
 	InternalServerError(internalMsg ...interface{}) Result
 	Redirection(uri string) Result
 	Response(status int, respObj interface{}, internalMsg string, v ...interface{}) Result
+
+	// Accepted returns a Result containing an HTTP-202 that gives respObj,
+	// for a request that was accepted but is not yet complete.
+	Accepted(respObj interface{}, internalMsg ...interface{}) Result
+
+	// NotModified returns a Result containing an HTTP-304 with no body, for
+	// a conditional request whose precondition shows that the client's copy
+	// of the resource is current. See NotModifiedSince.
+	NotModified(internalMsg ...interface{}) Result
+
+	// PartialContent returns a Result containing an HTTP-206 that gives
+	// respObj, the part of the resource given by contentRange, which is set
+	// as the Content-Range header. If contentRange is empty, the header is not
+	// set.
+	PartialContent(respObj interface{}, contentRange string, internalMsg ...interface{}) Result
+
+	// MovedPermanently returns a Result containing an HTTP-301 that redirects
+	// to uri. Clients may change the method of the redirected request to GET.
+	MovedPermanently(uri string) Result
+
+	// PermanentRedirect returns a Result containing an HTTP-308 that
+	// redirects to uri. Clients must not change the method of the redirected
+	// request. It is the same as Redirection.
+	PermanentRedirect(uri string) Result
+
+	// ConflictWithBody returns a Result containing an HTTP-409 that gives
+	// respObj instead of an error message, such as the current state of the
+	// resource that the request conflicted with.
+	ConflictWithBody(respObj interface{}, internalMsg ...interface{}) Result
+
+	// Gone returns a Result containing an HTTP-410, for a resource that
+	// existed but was permanently removed.
+	Gone(internalMsg ...interface{}) Result
+
+	// UnprocessableEntity returns a Result containing an HTTP-422, for a
+	// request that was well-formed but whose contents are not valid.
+	UnprocessableEntity(userMsg string, internalMsg ...interface{}) Result
+
+	// UnsupportedMediaType returns a Result containing an HTTP-415, for a
+	// request whose body is not of a media type that the endpoint accepts. If
+	// userMsg is empty, a generic message is used.
+	UnsupportedMediaType(userMsg string, internalMsg ...interface{}) Result
+
+	// TooManyRequests returns a Result containing an HTTP-429. If retryAfter
+	// is greater than 0, the Retry-After header is set to it, rounded up to
+	// the second. If userMsg is empty, a generic message is used.
+	TooManyRequests(userMsg string, retryAfter time.Duration, internalMsg ...interface{}) Result
+
+	// ServiceUnavailable returns a Result containing an HTTP-503. If
+	// retryAfter is greater than 0, the Retry-After header is set to it,
+	// rounded up to the second. If userMsg is empty, a generic message is
+	// used.
+	ServiceUnavailable(userMsg string, retryAfter time.Duration, internalMsg ...interface{}) Result
+
+	// FromError returns the error Result for a request that failed with err,
+	// with the status given by ErrorStatus. Errors that give a 4xx status are
+	// shown to the user; others are only logged. If err is a ValidationError,
+	// its fields are given in the Fields of the ErrorResponse. If no internal
+	// message is given, the message of err is used.
+	FromError(err error, internalMsg ...interface{}) Result
+
+	// Resource returns a Result that gives model, or a slice of models, in the
+	// envelope that is configured for the API with the "envelope" key. If no
+	// envelope is configured, it is the same as Response. Metadata must be
+	// registered for the type of model if an envelope is configured; see
+	// ModelMeta.
+	Resource(status int, model interface{}, internalMsg string, v ...interface{}) Result
+
 	Err(status int, userMsg, internalMsg string, v ...interface{}) Result
 	TextErr(status int, userMsg, internalMsg string, v ...interface{}) Result
 	LogResponse(req *http.Request, r Result)
@@ -131,3 +292,12 @@ type ResponseGenerator interface {
 	// transitory state and is slated for removal in a future release.
 	Logger() Logger
 }
+
+// ResponseGeneratorFunc creates a ResponseGenerator that replaces the default
+// one of a server, such as to change the shape of error response bodies. It is
+// given base, the default ResponseGenerator, which the returned one can embed
+// to only replace some of its methods. The helper methods of base, such as
+// BadRequest and NotFound, create their Results with the Response and Err
+// methods of the returned ResponseGenerator, so replacing Err is enough to
+// change the body of every error response.
+type ResponseGeneratorFunc func(base ResponseGenerator) ResponseGenerator
@@ -0,0 +1,47 @@
+package jelly
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type metricsWriter struct {
+	http.ResponseWriter
+	metrics ResponseMetrics
+}
+
+func (mw *metricsWriter) AddResponseMetrics(m ResponseMetrics) {
+	mw.metrics.Handler += m.Handler
+	mw.metrics.Marshal += m.Marshal
+	mw.metrics.Bytes += m.Bytes
+}
+
+func (mw *metricsWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+type plainWrapper struct {
+	http.ResponseWriter
+}
+
+func (pw plainWrapper) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+func Test_RecordResponseMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	inner := &metricsWriter{ResponseWriter: httptest.NewRecorder()}
+	outer := &metricsWriter{ResponseWriter: plainWrapper{inner}}
+
+	RecordResponseMetrics(outer, ResponseMetrics{Handler: time.Second})
+	Result{Status: http.StatusOK, Resp: "gamzee"}.WriteResponse(outer)
+
+	assert.Equal(time.Second, inner.metrics.Handler)
+	assert.Equal(int64(6), inner.metrics.Bytes)
+	assert.Equal(inner.metrics, outer.metrics)
+}
@@ -0,0 +1,154 @@
+package jelly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy gives how Retry retries a failing operation. The zero value is
+// ready to use and makes up to 3 attempts with exponential backoff starting at
+// 100ms.
+type RetryPolicy struct {
+	// Attempts is the maximum number of times the operation is attempted,
+	// including the first. It will default to 3 if not set.
+	Attempts int
+
+	// InitialDelay is the delay before the second attempt. It will default to
+	// 100ms if not set.
+	InitialDelay time.Duration
+
+	// MaxDelay is the longest delay between two attempts. It will default to
+	// 10s if not set.
+	MaxDelay time.Duration
+
+	// Multiplier is the factor that the delay grows by after each attempt. It
+	// will default to 2 if not set.
+	Multiplier float64
+
+	// Jitter is the fraction of each delay that is randomized, between 0 and
+	// 1, so that many clients retrying at once do not do so in lockstep. A
+	// Jitter of 0.2 gives delays between 80% and 120% of the computed delay.
+	// It will default to 0.2 if not set; set it to a negative number to
+	// disable jitter.
+	Jitter float64
+
+	// Retryable returns whether an operation that failed with err should be
+	// attempted again. If nil, every error is retried except those created
+	// with Permanent.
+	Retryable func(err error) bool
+
+	// OnRetry, if set, is called after each failed attempt that will be
+	// retried, with the number of the attempt that failed, its error, and the
+	// delay before the next attempt. It is typically used for logging.
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+func (rp RetryPolicy) withDefaults() RetryPolicy {
+	if rp.Attempts == 0 {
+		rp.Attempts = 3
+	}
+	if rp.InitialDelay == 0 {
+		rp.InitialDelay = 100 * time.Millisecond
+	}
+	if rp.MaxDelay == 0 {
+		rp.MaxDelay = 10 * time.Second
+	}
+	if rp.Multiplier == 0 {
+		rp.Multiplier = 2
+	}
+	if rp.Jitter == 0 {
+		rp.Jitter = 0.2
+	}
+	return rp
+}
+
+// delay returns the delay after the given failed attempt, starting from 1.
+func (rp RetryPolicy) delay(attempt int) time.Duration {
+	d := float64(rp.InitialDelay)
+	for i := 1; i < attempt && d < float64(rp.MaxDelay); i++ {
+		d *= rp.Multiplier
+	}
+	if d > float64(rp.MaxDelay) {
+		d = float64(rp.MaxDelay)
+	}
+	if rp.Jitter > 0 {
+		d += d * rp.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// permanentError marks an error as one that Retry should not retry.
+type permanentError struct {
+	err error
+}
+
+func (pe permanentError) Error() string {
+	return pe.err.Error()
+}
+
+func (pe permanentError) Unwrap() error {
+	return pe.err
+}
+
+// Permanent wraps err so that Retry does not retry an operation that returns it
+// or an error that wraps it, regardless of the policy's Retryable function. If
+// the operation returns the result of Permanent directly, Retry returns err
+// itself without the wrapping. If err is nil, nil is returned.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// Retry calls fn until it succeeds, it returns an error that is not retryable,
+// or the attempts given by policy are used up, waiting with exponential
+// backoff between attempts. The context given to fn is ctx; if ctx is done
+// while waiting between attempts, Retry stops and returns an error that wraps
+// ctx.Err().
+//
+// If fn fails with an error that is not retryable, that error is returned. If
+// every attempt fails, an error wrapping the last one is returned.
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	policy = policy.withDefaults()
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if perm, ok := err.(permanentError); ok {
+			return perm.err
+		}
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return err
+		}
+		if policy.Retryable != nil && !policy.Retryable(err) {
+			return err
+		}
+		if attempt >= policy.Attempts {
+			if policy.Attempts == 1 {
+				return err
+			}
+			return fmt.Errorf("after %d attempts: %w", attempt, err)
+		}
+
+		d := policy.delay(attempt)
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, d)
+		}
+
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		}
+	}
+}
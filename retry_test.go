@@ -0,0 +1,168 @@
+package jelly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RetryPolicy_delay(t *testing.T) {
+	policy := RetryPolicy{
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Multiplier:   2,
+		Jitter:       -1,
+	}.withDefaults()
+
+	testCases := []struct {
+		attempt int
+		expect  time.Duration
+	}{
+		{attempt: 1, expect: 100 * time.Millisecond},
+		{attempt: 2, expect: 200 * time.Millisecond},
+		{attempt: 3, expect: 400 * time.Millisecond},
+		{attempt: 4, expect: 800 * time.Millisecond},
+		{attempt: 5, expect: time.Second},
+		{attempt: 20, expect: time.Second},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expect, policy.delay(tc.attempt), "attempt %d", tc.attempt)
+	}
+}
+
+func Test_RetryPolicy_delay_jitter(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: 100 * time.Millisecond, Jitter: 0.5}.withDefaults()
+
+	for i := 0; i < 100; i++ {
+		d := policy.delay(1)
+		assert.GreaterOrEqual(t, d, 50*time.Millisecond)
+		assert.LessOrEqual(t, d, 150*time.Millisecond)
+	}
+}
+
+func Test_Retry(t *testing.T) {
+	errTemp := errors.New("temporary")
+	errFatal := errors.New("fatal")
+
+	testCases := []struct {
+		name          string
+		attempts      int
+		retryable     func(error) bool
+		results       []error // returned by each attempt; nil after the last
+		expectCalls   int
+		expectRetries []int
+		expectErr     error
+		expectWrapped bool // whether expectErr is wrapped rather than returned as-is
+	}{
+		{
+			name:        "succeeds first time",
+			results:     nil,
+			expectCalls: 1,
+		},
+		{
+			name:          "succeeds after retries",
+			results:       []error{errTemp, errTemp},
+			expectCalls:   3,
+			expectRetries: []int{1, 2},
+		},
+		{
+			name:          "all attempts fail",
+			results:       []error{errTemp, errTemp, errTemp, errTemp},
+			expectCalls:   3,
+			expectRetries: []int{1, 2},
+			expectErr:     errTemp,
+			expectWrapped: true,
+		},
+		{
+			name:        "single attempt returns error as-is",
+			attempts:    1,
+			results:     []error{errTemp},
+			expectCalls: 1,
+			expectErr:   errTemp,
+		},
+		{
+			name:        "permanent error is unwrapped",
+			results:     []error{Permanent(errFatal)},
+			expectCalls: 1,
+			expectErr:   errFatal,
+		},
+		{
+			name:          "wrapped permanent error is not retried",
+			results:       []error{errTemp, fmt.Errorf("wrapped: %w", Permanent(errFatal))},
+			expectCalls:   2,
+			expectRetries: []int{1},
+			expectErr:     errFatal,
+			expectWrapped: true,
+		},
+		{
+			name:        "not retryable",
+			retryable:   func(err error) bool { return err != errFatal },
+			results:     []error{errFatal},
+			expectCalls: 1,
+			expectErr:   errFatal,
+		},
+		{
+			name:          "retryable until one is not",
+			retryable:     func(err error) bool { return err != errFatal },
+			results:       []error{errTemp, errFatal},
+			expectCalls:   2,
+			expectRetries: []int{1},
+			expectErr:     errFatal,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var retries []int
+			policy := RetryPolicy{
+				Attempts:     tc.attempts,
+				InitialDelay: time.Millisecond,
+				Jitter:       -1,
+				Retryable:    tc.retryable,
+				OnRetry: func(attempt int, err error, delay time.Duration) {
+					retries = append(retries, attempt)
+				},
+			}
+
+			calls := 0
+			err := Retry(context.Background(), policy, func(ctx context.Context) error {
+				calls++
+				if calls > len(tc.results) {
+					return nil
+				}
+				return tc.results[calls-1]
+			})
+
+			assert.Equal(t, tc.expectCalls, calls)
+			assert.Equal(t, tc.expectRetries, retries)
+			if tc.expectErr == nil {
+				assert.NoError(t, err)
+			} else if tc.expectWrapped {
+				assert.ErrorIs(t, err, tc.expectErr)
+				assert.NotEqual(t, tc.expectErr, err)
+			} else {
+				assert.Equal(t, tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func Test_Retry_contextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errTemp := errors.New("temporary")
+
+	calls := 0
+	err := Retry(ctx, RetryPolicy{Attempts: 5, InitialDelay: time.Hour}, func(ctx context.Context) error {
+		calls++
+		cancel()
+		return errTemp
+	})
+
+	assert.Equal(t, 1, calls)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,127 @@
+package jelly
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RouteAuth is the authentication that a Route requires of clients.
+type RouteAuth int
+
+const (
+	// RouteAuthNone is the auth of a Route that does not use the logged-in
+	// user.
+	RouteAuthNone RouteAuth = iota
+
+	// RouteAuthOptional is the auth of a Route that uses the logged-in user if
+	// there is one but allows clients that are not logged in, as with
+	// ServiceProvider.OptionalAuth.
+	RouteAuthOptional
+
+	// RouteAuthRequired is the auth of a Route that requires the client to be
+	// logged in, as with ServiceProvider.RequiredAuth.
+	RouteAuthRequired
+)
+
+// shortcutParamRegex matches a path parameter that is given with one of the
+// type shortcuts of PathParam, such as "{id:uuid}".
+var shortcutParamRegex = regexp.MustCompile(`\{([^{}:]+):([A-Za-z]+)\}`)
+
+// Route declares a single route of an API as data. An API can give a
+// RouteTable of them in place of building its router by hand in its Routes
+// method.
+type Route struct {
+	// Method is the HTTP method of the route, such as "GET".
+	Method string
+
+	// Path is the path of the route relative to the API base, in the same
+	// format as chi patterns. Path parameters may use the type shortcuts of
+	// PathParam, such as "/{id:uuid}".
+	Path string
+
+	// Handler is called to respond to requests to the route. It is made into
+	// a handler with ServiceProvider.Endpoint, given Override.
+	Handler EndpointFunc
+
+	// Auth is the authentication that the route requires. The authenticators
+	// in Override.Authenticators are used for it, or the main authenticator
+	// if there are none.
+	Auth RouteAuth
+
+	// Middleware is applied to the route after any auth middleware, in order.
+	Middleware []Middleware
+
+	// Override is given to ServiceProvider.Endpoint when Handler is made into
+	// a handler. Its fields that only document the endpoint, such as Summary,
+	// Request, and Response, are what RESTServer.Routes gives for the route
+	// and what tools such as clientgen generate from.
+	Override Override
+}
+
+// RouteTable is the routes of an API declared as data. Using one in the Routes
+// method of an API keeps the code that serves each route and the description
+// of it that is given to docs and generated clients in one place:
+//
+//	func (api *thingsAPI) Routes(sp jelly.ServiceProvider) (chi.Router, bool) {
+//		return jelly.RouteTable{
+//			{Method: "GET", Path: "/", Handler: api.getAll, Auth: jelly.RouteAuthRequired},
+//			{Method: "GET", Path: "/{id:uuid}", Handler: api.get, Auth: jelly.RouteAuthRequired,
+//				Override: jelly.Override{Summary: "Get a thing by its ID.", Response: "thing"}},
+//		}.Router(sp), true
+//	}
+type RouteTable []Route
+
+// Router returns a router that serves every route in rt. It panics if a route
+// has no method, path, or handler, or if two routes have the same method and
+// path, so that a mistake in a table is found when the server starts.
+func (rt RouteTable) Router(sp ServiceProvider) chi.Router {
+	r := chi.NewRouter()
+	seen := map[string]bool{}
+
+	for _, route := range rt {
+		method := strings.ToUpper(route.Method)
+		path := expandPathParams(route.Path)
+		if method == "" || path == "" {
+			panic(fmt.Sprintf("jelly: route %q %q needs both a method and a path", route.Method, route.Path))
+		}
+		if route.Handler == nil {
+			panic(fmt.Sprintf("jelly: route %s %s has no handler", method, route.Path))
+		}
+		if seen[method+" "+path] {
+			panic(fmt.Sprintf("jelly: route %s %s is declared more than once", method, route.Path))
+		}
+		seen[method+" "+path] = true
+
+		var mws []func(http.Handler) http.Handler
+		switch route.Auth {
+		case RouteAuthOptional:
+			mws = append(mws, sp.OptionalAuth(route.Override.Authenticators...))
+		case RouteAuthRequired:
+			mws = append(mws, sp.RequiredAuth(route.Override.Authenticators...))
+		}
+		for _, mw := range route.Middleware {
+			mws = append(mws, mw)
+		}
+
+		r.With(mws...).Method(method, path, sp.Endpoint(route.Handler, route.Override))
+	}
+
+	return r
+}
+
+// expandPathParams replaces every path parameter in path that uses one of the
+// type shortcuts of PathParam with the regex it stands for. Parameters with
+// no type or with a regex are left as they are.
+func expandPathParams(path string) string {
+	return shortcutParamRegex.ReplaceAllStringFunc(path, func(param string) string {
+		m := shortcutParamRegex.FindStringSubmatch(param)
+		if _, ok := paramTypePats[m[2]]; !ok {
+			return param
+		}
+		return PathParam(m[1] + ":" + m[2])
+	})
+}
@@ -0,0 +1,28 @@
+package jelly
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_expandPathParams(t *testing.T) {
+	testCases := []struct {
+		name   string
+		path   string
+		expect string
+	}{
+		{name: "no params", path: "/things", expect: "/things"},
+		{name: "untyped param", path: "/things/{id}", expect: "/things/{id}"},
+		{name: "shortcut", path: "/things/{n:num}", expect: `/things/{n:\d+}`},
+		{name: "several shortcuts", path: "/{a:alpha}/{n:num}", expect: `/{a:[A-Za-z]+}/{n:\d+}`},
+		{name: "not a shortcut", path: "/things/{n:abc}", expect: "/things/{n:abc}"},
+		{name: "regex", path: `/things/{n:[0-9]{3}}`, expect: `/things/{n:[0-9]{3}}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, expandPathParams(tc.path))
+		})
+	}
+}
@@ -0,0 +1,439 @@
+package jelly
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Schema describes a model that is given in request or response bodies. It is
+// registered once with the RegisterSchema method of the server's Environment
+// and is then used by every part of the server that needs to know the shape of
+// the model, such as validating request bodies given to an endpoint with
+// Override.Schema and checking the fields selected with the fields query
+// parameter.
+type Schema struct {
+	// Name is the name that the schema is registered under, such as "User".
+	Name string
+
+	// Type is the Go type of the model. It is never a pointer type.
+	Type reflect.Type
+
+	// JSON is the JSON Schema of the model as it is marshaled to JSON, decoded
+	// into a map.
+	JSON map[string]interface{}
+}
+
+// Properties returns the names of the properties of the model as given in its
+// JSON Schema, in sorted order. It returns nil if the model is not an object.
+func (s Schema) Properties() []string {
+	props, _ := s.JSON["properties"].(map[string]interface{})
+	if len(props) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateJSON checks that data, a JSON document, conforms to the JSON Schema
+// of the model. The "type", "properties", "required", "additionalProperties",
+// "items", and "enum" keywords are checked; others are ignored. If data does
+// not conform, the returned error matches ErrBadArgument and its message says
+// which value is invalid and why. If data is not valid JSON, the returned
+// error matches ErrBodyUnmarshal.
+func (s Schema) ValidateJSON(data []byte) error {
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return NewError("malformed JSON", err, ErrBodyUnmarshal)
+	}
+
+	if msg := validateSchemaValue(s.JSON, doc, ""); msg != "" {
+		return NewError(msg, ErrBadArgument)
+	}
+	return nil
+}
+
+// validateSchemaValue returns a message describing why v does not conform to
+// schema, or "" if it does. path is the location of v in the document, used in
+// the message.
+func validateSchemaValue(schema map[string]interface{}, v interface{}, path string) string {
+	describe := func(msg string) string {
+		if path == "" {
+			return "body " + msg
+		}
+		return fmt.Sprintf("%q %s", path, msg)
+	}
+
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if jsonValueIsType(v, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return describe("must be of type " + strings.Join(types, " or "))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return describe("is not one of the allowed values")
+		}
+	}
+
+	switch typed := v.(type) {
+	case map[string]interface{}:
+		props, _ := schema["properties"].(map[string]interface{})
+
+		required, _ := schema["required"].([]interface{})
+		for _, req := range required {
+			name, _ := req.(string)
+			if _, ok := typed[name]; !ok {
+				return fmt.Sprintf("%q is required", joinSchemaPath(path, name))
+			}
+		}
+
+		names := make([]string, 0, len(typed))
+		for name := range typed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			propSchema, ok := props[name].(map[string]interface{})
+			if !ok {
+				if allowed, isBool := schema["additionalProperties"].(bool); isBool && !allowed {
+					return fmt.Sprintf("%q is not an allowed property", joinSchemaPath(path, name))
+				}
+				if addl, isSchema := schema["additionalProperties"].(map[string]interface{}); isSchema {
+					propSchema = addl
+				} else {
+					continue
+				}
+			}
+			if msg := validateSchemaValue(propSchema, typed[name], joinSchemaPath(path, name)); msg != "" {
+				return msg
+			}
+		}
+	case []interface{}:
+		items, ok := schema["items"].(map[string]interface{})
+		if !ok {
+			break
+		}
+		for i := range typed {
+			if msg := validateSchemaValue(items, typed[i], fmt.Sprintf("%s[%d]", path, i)); msg != "" {
+				return msg
+			}
+		}
+	}
+
+	return ""
+}
+
+func joinSchemaPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// schemaTypes returns the types given in the "type" keyword of a JSON Schema,
+// which may be a single type or a list of them.
+func schemaTypes(v interface{}) []string {
+	switch typed := v.(type) {
+	case string:
+		return []string{typed}
+	case []interface{}:
+		var types []string
+		for _, t := range typed {
+			if s, ok := t.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	case []string:
+		return typed
+	default:
+		return nil
+	}
+}
+
+// jsonValueIsType returns whether v, decoded from JSON with numbers as
+// json.Number, is of the given JSON Schema type.
+func jsonValueIsType(v interface{}, t string) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	default:
+		// unknown types are not checked
+		return true
+	}
+}
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// GenerateJSONSchema returns a JSON Schema for values of type t as they are
+// marshaled by encoding/json, following json struct tags. Generated schemas do
+// not require any properties, as encoding/json does not; give a schema to
+// RegisterSchema to be stricter.
+func GenerateJSONSchema(t reflect.Type) map[string]interface{} {
+	return generateJSONSchema(t, map[reflect.Type]bool{})
+}
+
+func generateJSONSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema map[string]interface{}
+	switch {
+	case t == timeType:
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// marshals itself; could be anything
+		return map[string]interface{}{}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		schema = map[string]interface{}{"type": "string"}
+	default:
+		schema = generateKindSchema(t, seen)
+	}
+
+	if nullable && schema["type"] != nil {
+		schema["type"] = []interface{}{schema["type"], "null"}
+	}
+	return schema
+}
+
+func generateKindSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json gives byte slices as base64 strings
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": generateJSONSchema(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": generateJSONSchema(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			// recursive type; do not describe it again
+			return map[string]interface{}{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		props := map[string]interface{}{}
+		addStructProperties(t, props, seen)
+		return map[string]interface{}{"type": "object", "properties": props}
+	default:
+		// interfaces could hold anything
+		return map[string]interface{}{}
+	}
+}
+
+// addStructProperties adds the schema of each field of struct type t that is
+// marshaled by encoding/json to props, including those of embedded structs.
+func addStructProperties(t reflect.Type, props map[string]interface{}, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addStructProperties(ft, props, seen)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = generateJSONSchema(f.Type, seen)
+	}
+}
+
+// SchemaComponent is an interface that can optionally be implemented by a
+// Component to give the models that its API uses in request and response
+// bodies. Their schemas are registered automatically when the component is
+// used, generated from their Go types with GenerateJSONSchema.
+type SchemaComponent interface {
+	Component
+
+	// Schemas returns a value of the Go type of each model, keyed by the name
+	// that its schema is registered under. Names should be prefixed with the
+	// name of the component, as in "jellyauth.User", so that they do not
+	// collide with those of other components.
+	Schemas() map[string]interface{}
+}
+
+// SchemaRegistry holds the schemas of models, for looking them up by name or
+// by Go type. It is safe for concurrent use. A nil *SchemaRegistry has no
+// schemas.
+type SchemaRegistry struct {
+	mtx    sync.RWMutex
+	byName map[string]Schema
+	byType map[reflect.Type]string
+}
+
+// NewSchemaRegistry creates a SchemaRegistry with no schemas.
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		byName: map[string]Schema{},
+		byType: map[reflect.Type]string{},
+	}
+}
+
+// Register registers the schema of models of the same Go type as model, which
+// may be a value or a pointer to one, under the given name. jsonSchema is the
+// JSON Schema of the model decoded into a map; if nil, one is generated from
+// the Go type with GenerateJSONSchema. It is an error to register the same
+// name or the same type twice.
+func (sr *SchemaRegistry) Register(name string, model interface{}, jsonSchema map[string]interface{}) error {
+	if name == "" {
+		return fmt.Errorf("schema name cannot be empty")
+	}
+	if model == nil {
+		return fmt.Errorf("model cannot be nil")
+	}
+
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if jsonSchema == nil {
+		jsonSchema = GenerateJSONSchema(t)
+	}
+
+	sr.mtx.Lock()
+	defer sr.mtx.Unlock()
+
+	if _, ok := sr.byName[name]; ok {
+		return fmt.Errorf("schema %q is already registered", name)
+	}
+	if existing, ok := sr.byType[t]; ok {
+		return fmt.Errorf("schema for %s is already registered as %q", t, existing)
+	}
+	sr.byName[name] = Schema{Name: name, Type: t, JSON: jsonSchema}
+	sr.byType[t] = name
+	return nil
+}
+
+// Get returns the schema registered under name. If there is none, ok will be
+// false.
+func (sr *SchemaRegistry) Get(name string) (s Schema, ok bool) {
+	if sr == nil {
+		return Schema{}, false
+	}
+
+	sr.mtx.RLock()
+	defer sr.mtx.RUnlock()
+
+	s, ok = sr.byName[name]
+	return s, ok
+}
+
+// ForType returns the schema registered for the Go type of model, which may
+// be a value or a pointer to one. If there is none, ok will be false.
+func (sr *SchemaRegistry) ForType(model interface{}) (s Schema, ok bool) {
+	if sr == nil || model == nil {
+		return Schema{}, false
+	}
+
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	sr.mtx.RLock()
+	defer sr.mtx.RUnlock()
+
+	name, ok := sr.byType[t]
+	if !ok {
+		return Schema{}, false
+	}
+	return sr.byName[name], true
+}
+
+// Names returns the names of every registered schema, in sorted order.
+func (sr *SchemaRegistry) Names() []string {
+	if sr == nil {
+		return nil
+	}
+
+	sr.mtx.RLock()
+	defer sr.mtx.RUnlock()
+
+	names := make([]string, 0, len(sr.byName))
+	for name := range sr.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,113 @@
+package jelly
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type schemaTestPerson struct {
+	ID       uuid.UUID         `json:"id"`
+	Name     string            `json:"name"`
+	Age      int               `json:"age,omitempty"`
+	Born     time.Time         `json:"born"`
+	Nickname *string           `json:"nickname"`
+	Tags     []string          `json:"tags"`
+	Extra    map[string]int    `json:"extra"`
+	Secret   string            `json:"-"`
+	Friend   *schemaTestPerson `json:"friend,omitempty"`
+	hidden   string
+}
+
+func Test_GenerateJSONSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	schema := GenerateJSONSchema(reflect.TypeOf(schemaTestPerson{}))
+
+	assert.Equal("object", schema["type"])
+	props := schema["properties"].(map[string]interface{})
+	assert.Equal(map[string]interface{}{"type": "string"}, props["id"])
+	assert.Equal(map[string]interface{}{"type": "string"}, props["name"])
+	assert.Equal(map[string]interface{}{"type": "integer"}, props["age"])
+	assert.Equal(map[string]interface{}{"type": "string", "format": "date-time"}, props["born"])
+	assert.Equal(map[string]interface{}{"type": []interface{}{"string", "null"}}, props["nickname"])
+	assert.Equal(map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}, props["tags"])
+	assert.Equal(map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "integer"}}, props["extra"])
+	assert.Equal(map[string]interface{}{"type": []interface{}{"object", "null"}}, props["friend"])
+	assert.NotContains(props, "Secret")
+	assert.NotContains(props, "hidden")
+}
+
+func Test_Schema_ValidateJSON(t *testing.T) {
+	schema := Schema{Name: "Person", JSON: map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"name"},
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string"},
+			"age":  map[string]interface{}{"type": "integer"},
+			"role": map[string]interface{}{"enum": []interface{}{"admin", "normal"}},
+			"tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+		"additionalProperties": false,
+	}}
+
+	testCases := []struct {
+		name      string
+		input     string
+		expectErr string
+		expectIs  error
+	}{
+		{name: "valid", input: `{"name": "Terezi", "age": 13, "role": "admin", "tags": ["seer"]}`},
+		{name: "missing required", input: `{"age": 13}`, expectErr: `"name" is required`, expectIs: ErrBadArgument},
+		{name: "wrong type", input: `{"name": "Terezi", "age": 13.5}`, expectErr: `"age" must be of type integer`, expectIs: ErrBadArgument},
+		{name: "not in enum", input: `{"name": "Terezi", "role": "god"}`, expectErr: `"role" is not one of the allowed values`, expectIs: ErrBadArgument},
+		{name: "bad item", input: `{"name": "Terezi", "tags": [8]}`, expectErr: `"tags[0]" must be of type string`, expectIs: ErrBadArgument},
+		{name: "additional property", input: `{"name": "Terezi", "dragon": true}`, expectErr: `"dragon" is not an allowed property`, expectIs: ErrBadArgument},
+		{name: "not an object", input: `[]`, expectErr: `body must be of type object`, expectIs: ErrBadArgument},
+		{name: "malformed", input: `{`, expectIs: ErrBodyUnmarshal},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			err := schema.ValidateJSON([]byte(tc.input))
+
+			if tc.expectIs == nil {
+				assert.NoError(err)
+				return
+			}
+			assert.True(errors.Is(err, tc.expectIs))
+			if tc.expectErr != "" {
+				assert.ErrorContains(err, tc.expectErr)
+			}
+		})
+	}
+}
+
+func Test_SchemaRegistry(t *testing.T) {
+	assert := assert.New(t)
+	sr := NewSchemaRegistry()
+
+	assert.NoError(sr.Register("Person", &schemaTestPerson{}, nil))
+	assert.Error(sr.Register("Person", struct{}{}, nil))
+	assert.Error(sr.Register("Other", schemaTestPerson{}, nil))
+
+	byType, ok := sr.ForType([]schemaTestPerson{}[0:0])
+	assert.False(ok, "slices are not the type")
+	byType, ok = sr.ForType(&schemaTestPerson{})
+	assert.True(ok)
+	assert.Equal("Person", byType.Name)
+	assert.Equal(reflect.TypeOf(schemaTestPerson{}), byType.Type)
+	assert.Contains(byType.Properties(), "nickname")
+
+	assert.Equal([]string{"Person"}, sr.Names())
+
+	var none *SchemaRegistry
+	_, ok = none.Get("Person")
+	assert.False(ok)
+}
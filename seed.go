@@ -0,0 +1,34 @@
+package jelly
+
+import "context"
+
+// SeedFunc creates initial data for an API, such as a default admin user or
+// sample records for development. It is given the same Bundle that the API was
+// initialized with, and should create the data through the stores in it.
+//
+// A SeedFunc must be idempotent; seeding may be run on every start of the
+// server, so it must not create data that already exists or fail because it
+// does.
+type SeedFunc func(ctx context.Context, b Bundle) error
+
+// FixtureDecoder inserts a single entity that is described in a fixtures file
+// into the stores of an API. It is given the same Bundle that the API was
+// initialized with, along with a function that decodes the entity's
+// description into v in the same way that config is decoded, using the "yaml"
+// tags of struct fields.
+//
+// Like a SeedFunc, a FixtureDecoder must be idempotent; it must not create an
+// entity that already exists or fail because it does.
+type FixtureDecoder func(ctx context.Context, b Bundle, decode func(v interface{}) error) error
+
+// FixtureComponent is an interface that can optionally be implemented by a
+// Component to give the FixtureDecoders for the kinds of entities of its API
+// that can be loaded from fixtures files. They are registered automatically
+// when the component is used.
+type FixtureComponent interface {
+	Component
+
+	// FixtureDecoders returns the FixtureDecoder for each kind of entity,
+	// keyed by the name that the kind is given under in fixtures files.
+	FixtureDecoders() map[string]FixtureDecoder
+}
@@ -0,0 +1,210 @@
+package jelly
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// RedactedValue replaces the values of sensitive fields wherever they are
+// redacted.
+const RedactedValue = "[REDACTED]"
+
+// SensitiveTag is the struct tag that marks a field of a model as sensitive,
+// as in `jelly:"sensitive"`. Tagged fields are only known to be sensitive once
+// the model is registered with RegisterSensitiveFields.
+const SensitiveTag = "sensitive"
+
+// defaultSensitiveTerms are the terms that always mark a field as sensitive
+// when they appear anywhere in its name.
+var defaultSensitiveTerms = []string{"password", "secret", "token", "recovery_code"}
+
+var (
+	sensitiveMtx   sync.RWMutex
+	sensitiveNames = map[string]bool{}
+)
+
+func init() {
+	RegisterSensitiveFields(AuthUser{}, ServiceAccount{}, TwoFactor{})
+}
+
+// RegisterSensitive registers the names of fields whose values are sensitive,
+// such as personal information. They are redacted from the request and
+// response bodies kept by debug capture, from echoed requests, and from config
+// dumps made with Environment.DumpConfig. Names are matched against field
+// names, JSON members, form values, and config keys in full and are not
+// case-sensitive.
+//
+// Fields whose names contain "password", "secret", "token", or
+// "recovery_code" are always sensitive and do not need to be registered.
+func RegisterSensitive(names ...string) {
+	sensitiveMtx.Lock()
+	defer sensitiveMtx.Unlock()
+
+	for _, n := range names {
+		if n = strings.ToLower(strings.TrimSpace(n)); n != "" {
+			sensitiveNames[n] = true
+		}
+	}
+}
+
+// RegisterSensitiveFields registers the fields of each model that are tagged
+// with `jelly:"sensitive"` with RegisterSensitive, along with those of any
+// structs it contains. Both the Go name of each field and the name it has in
+// JSON are registered.
+func RegisterSensitiveFields(models ...interface{}) {
+	for _, m := range models {
+		if m == nil {
+			continue
+		}
+		RegisterSensitive(sensitiveFieldNames(reflect.TypeOf(m), map[reflect.Type]bool{})...)
+	}
+}
+
+func sensitiveFieldNames(t reflect.Type, seen map[reflect.Type]bool) []string {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		if isSensitiveTag(sf.Tag.Get("jelly")) {
+			names = append(names, sf.Name)
+			if jsonName, _, _ := strings.Cut(sf.Tag.Get("json"), ","); jsonName != "" && jsonName != "-" {
+				names = append(names, jsonName)
+			}
+			continue
+		}
+		names = append(names, sensitiveFieldNames(sf.Type, seen)...)
+	}
+	return names
+}
+
+func isSensitiveTag(tag string) bool {
+	return hasTagOption(tag, SensitiveTag)
+}
+
+// IsSensitive returns whether the field with the given name has a sensitive
+// value. This is true if it was registered with RegisterSensitive or
+// RegisterSensitiveFields, or if it contains one of the terms that are always
+// sensitive or one of the given extra terms.
+func IsSensitive(name string, extraTerms ...string) bool {
+	name = strings.ToLower(name)
+
+	sensitiveMtx.RLock()
+	registered := sensitiveNames[name]
+	sensitiveMtx.RUnlock()
+	if registered {
+		return true
+	}
+
+	for _, t := range defaultSensitiveTerms {
+		if strings.Contains(name, t) {
+			return true
+		}
+	}
+	for _, t := range extraTerms {
+		if t = strings.ToLower(t); t != "" && strings.Contains(name, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns the value that v is marshaled to as JSON, decoded into maps,
+// slices, and primitive values, with the values of sensitive fields replaced
+// with RedactedValue. Fields tagged with `jelly:"sensitive"` are redacted even
+// if their model was not registered. It is intended for logging models, as in
+// log.Debugf("created %v", jelly.Redact(user)). If v cannot be marshaled,
+// RedactedValue is returned.
+func Redact(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return RedactedValue
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return RedactedValue
+	}
+
+	tagged := map[string]bool{}
+	if v != nil {
+		for _, n := range sensitiveFieldNames(reflect.TypeOf(v), map[reflect.Type]bool{}) {
+			tagged[strings.ToLower(n)] = true
+		}
+	}
+	return redactJSON(decoded, func(name string) bool {
+		return tagged[strings.ToLower(name)] || IsSensitive(name)
+	})
+}
+
+// RedactJSON replaces the values of sensitive members in decoded JSON data,
+// which is modified in place. Members are sensitive if IsSensitive returns
+// true for their names with the given extra terms. data is returned for
+// convenience.
+func RedactJSON(data interface{}, extraTerms ...string) interface{} {
+	return redactJSON(data, func(name string) bool {
+		return IsSensitive(name, extraTerms...)
+	})
+}
+
+func redactJSON(data interface{}, sensitive func(name string) bool) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for k := range v {
+			if sensitive(k) {
+				v[k] = RedactedValue
+			} else {
+				v[k] = redactJSON(v[k], sensitive)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactJSON(v[i], sensitive)
+		}
+	}
+	return data
+}
+
+// RedactBody returns body, a request or response body of the given content
+// type, with the values of sensitive fields redacted. Members of JSON bodies
+// and values of form bodies are redacted if IsSensitive returns true for their
+// names with the given extra terms. Bodies of other types are returned as-is.
+// ok is false if body looks like JSON but could not be parsed, such as when it
+// was truncated, in which case it cannot be safely shown.
+func RedactBody(body []byte, contentType string, extraTerms ...string) (redacted []byte, ok bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	if mediaType == "application/x-www-form-urlencoded" {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			for k := range values {
+				if IsSensitive(k, extraTerms...) {
+					values[k] = []string{RedactedValue}
+				}
+			}
+			return []byte(values.Encode()), true
+		}
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err == nil {
+		if redacted, err := json.Marshal(RedactJSON(data, extraTerms...)); err == nil {
+			return redacted, true
+		}
+	} else if mediaType == "application/json" || bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		return nil, false
+	}
+
+	return body, true
+}
@@ -0,0 +1,107 @@
+package jelly
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_IsSensitive(t *testing.T) {
+	RegisterSensitive("Phone_Number")
+
+	testCases := []struct {
+		name   string
+		field  string
+		extra  []string
+		expect bool
+	}{
+		{name: "default term", field: "new_password", expect: true},
+		{name: "default term, other case", field: "ClientSecret", expect: true},
+		{name: "registered name", field: "phone_number", expect: true},
+		{name: "registered name only matches in full", field: "phone_number_type", expect: false},
+		{name: "registered model field", field: "email", expect: true},
+		{name: "extra term", field: "ssn_last4", extra: []string{"ssn"}, expect: true},
+		{name: "not sensitive", field: "username", expect: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, IsSensitive(tc.field, tc.extra...))
+		})
+	}
+}
+
+func Test_Redact(t *testing.T) {
+	type contact struct {
+		Address string `json:"address" jelly:"sensitive"`
+		City    string `json:"city"`
+	}
+	type person struct {
+		Name     string    `json:"name"`
+		APIToken string    `json:"api_token"`
+		Contacts []contact `json:"contacts"`
+	}
+
+	actual := Redact(person{
+		Name:     "Jade",
+		APIToken: "abc123",
+		Contacts: []contact{{Address: "413 Island Rd", City: "Nowhere"}},
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"name":      "Jade",
+		"api_token": RedactedValue,
+		"contacts": []interface{}{
+			map[string]interface{}{"address": RedactedValue, "city": "Nowhere"},
+		},
+	}, actual)
+}
+
+func Test_RedactBody(t *testing.T) {
+	testCases := []struct {
+		name        string
+		body        string
+		contentType string
+		expect      string
+		expectOK    bool
+	}{
+		{
+			name:        "json",
+			body:        `{"username":"jade","password":"hunter2","nested":[{"secret":"x"}]}`,
+			contentType: "application/json",
+			expect:      `{"nested":[{"secret":"[REDACTED]"}],"password":"[REDACTED]","username":"jade"}`,
+			expectOK:    true,
+		},
+		{
+			name:        "form",
+			body:        "username=jade&password=hunter2",
+			contentType: "application/x-www-form-urlencoded",
+			expect:      "password=%5BREDACTED%5D&username=jade",
+			expectOK:    true,
+		},
+		{
+			name:        "truncated json",
+			body:        `{"password":"hun`,
+			contentType: "application/json",
+			expectOK:    false,
+		},
+		{
+			name:        "plain text",
+			body:        "password=hunter2",
+			contentType: "text/plain",
+			expect:      "password=hunter2",
+			expectOK:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, ok := RedactBody([]byte(tc.body), tc.contentType)
+
+			assert.Equal(t, tc.expectOK, ok)
+			if tc.expectOK {
+				assert.Equal(t, tc.expect, string(actual))
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+)
+
+// adminAPIModel is the status of an API as given by the admin endpoints.
+type adminAPIModel struct {
+	Name     string          `json:"name"`
+	Disabled bool            `json:"disabled"`
+	Usage    *jelly.APIUsage `json:"usage,omitempty"`
+}
+
+// routeAdmin adds the admin endpoints to r if they are enabled. rs.mtx must be
+// held by the caller.
+func (rs *restServer) routeAdmin(r chi.Router, sp jelly.ServiceProvider) {
+	ac := rs.cfg.Globals.Admin.FillDefaults()
+	if !ac.Enabled {
+		return
+	}
+
+	r.Route(ac.Path, func(r chi.Router) {
+		r.Use(sp.RequiredAuth())
+
+		r.Get("/apis", rs.httpGetAdminAPIs(sp))
+		r.Post("/apis/{name}/disable", rs.httpDisableAPI(sp))
+		r.Post("/apis/{name}/enable", rs.httpEnableAPI(sp))
+
+		if ac.Profiling {
+			r.Route(ac.ProfilingPath, func(r chi.Router) {
+				routeProfiling(r, sp)
+			})
+		}
+	})
+}
+
+// adminAPIs returns the status and usage of every enabled API, in the order
+// they were initialized.
+func (rs *restServer) adminAPIs() []adminAPIModel {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	apis := make([]adminAPIModel, len(rs.initOrder))
+	for i, name := range rs.initOrder {
+		usage := rs.usageTracker(name).usage()
+		apis[i] = adminAPIModel{Name: name, Disabled: rs.disabled[name], Usage: &usage}
+	}
+	return apis
+}
+
+func (rs *restServer) httpGetAdminAPIs(sp jelly.ServiceProvider) http.HandlerFunc {
+	return sp.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := sp.GetLoggedInUser(req)
+		if user.Role != jelly.Admin {
+			return sp.Forbidden("user '%s' (role %s) get API statuses: forbidden", user.Username, user.Role)
+		}
+
+		return sp.OK(rs.adminAPIs(), "user '%s' got API statuses", user.Username)
+	})
+}
+
+func (rs *restServer) httpDisableAPI(sp jelly.ServiceProvider) http.HandlerFunc {
+	return sp.Endpoint(func(req *http.Request) jelly.Result {
+		name := strings.ToLower(chi.URLParam(req, "name"))
+		user, _ := sp.GetLoggedInUser(req)
+		if user.Role != jelly.Admin {
+			return sp.Forbidden("user '%s' (role %s) disable API %q: forbidden", user.Username, user.Role, name)
+		}
+
+		disabled, ok := rs.apiStatus(name)
+		if !ok {
+			return sp.NotFound("user '%s' disable API %q: no enabled API has that name", user.Username, name)
+		}
+		if disabled {
+			return sp.Conflict("API is already disabled", "user '%s' disable API %q: API is already disabled", user.Username, name)
+		}
+		if err := rs.DisableAPI(req.Context(), name); err != nil {
+			// it is disabled; only its shutdown failed
+			rs.log.Errorf("user '%s' disabled API %q but it did not shut down cleanly: %v", user.Username, name, err)
+		}
+
+		return sp.OK(adminAPIModel{Name: name, Disabled: true}, "user '%s' disabled API %q", user.Username, name)
+	})
+}
+
+func (rs *restServer) httpEnableAPI(sp jelly.ServiceProvider) http.HandlerFunc {
+	return sp.Endpoint(func(req *http.Request) jelly.Result {
+		name := strings.ToLower(chi.URLParam(req, "name"))
+		user, _ := sp.GetLoggedInUser(req)
+		if user.Role != jelly.Admin {
+			return sp.Forbidden("user '%s' (role %s) enable API %q: forbidden", user.Username, user.Role, name)
+		}
+
+		disabled, ok := rs.apiStatus(name)
+		if !ok {
+			return sp.NotFound("user '%s' enable API %q: no enabled API has that name", user.Username, name)
+		}
+		if !disabled {
+			return sp.Conflict("API is not disabled", "user '%s' enable API %q: API is not disabled", user.Username, name)
+		}
+		if err := rs.EnableAPI(name); err != nil {
+			return sp.InternalServerError("user '%s' enable API %q: %s", user.Username, name, err.Error())
+		}
+
+		return sp.OK(adminAPIModel{Name: name, Disabled: false}, "user '%s' enabled API %q", user.Username, name)
+	})
+}
+
+// apiStatus returns whether the named API is disabled. ok is false if it is
+// not an enabled API of the server.
+func (rs *restServer) apiStatus(name string) (disabled bool, ok bool) {
+	name = strings.ToLower(name)
+
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	if _, exists := rs.apis[name]; !exists || !rs.initialized(name) {
+		return false, false
+	}
+	return rs.disabled[name], true
+}
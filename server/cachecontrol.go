@@ -0,0 +1,22 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/middle"
+)
+
+// setCacheControl sets the Cache-Control header of the successful response to
+// req as given by policy. If policy is nil, the header is set to "no-store" if
+// the client is logged in and is not set otherwise. It must be called before
+// the response is written; headers of the Result replace it.
+func setCacheControl(h http.Header, req *http.Request, policy *jelly.CachePolicy) {
+	if policy != nil {
+		h.Set("Cache-Control", policy.String())
+		return
+	}
+	if _, loggedIn := middle.GetLoggedInUser(req); loggedIn {
+		h.Set("Cache-Control", "no-store")
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/dekarrin/jelly/internal/middle"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Endpoint_cacheControl(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cache    *jelly.CachePolicy
+		loggedIn bool
+		ep       func(em endpointCreator) jelly.Result
+		expect   string
+	}{
+		{
+			name:   "no policy, not logged in",
+			ep:     func(em endpointCreator) jelly.Result { return em.OK("nepeta") },
+			expect: "",
+		},
+		{
+			name:     "no policy, logged in",
+			loggedIn: true,
+			ep:       func(em endpointCreator) jelly.Result { return em.OK("nepeta") },
+			expect:   "no-store",
+		},
+		{
+			name:     "private with max age",
+			cache:    &jelly.CachePolicy{MaxAge: 90 * time.Second},
+			loggedIn: true,
+			ep:       func(em endpointCreator) jelly.Result { return em.OK("nepeta") },
+			expect:   "private, max-age=90",
+		},
+		{
+			name:   "public without max age",
+			cache:  &jelly.CachePolicy{Public: true},
+			ep:     func(em endpointCreator) jelly.Result { return em.OK("nepeta") },
+			expect: "public, no-cache",
+		},
+		{
+			name:   "no-store ignores other fields",
+			cache:  &jelly.CachePolicy{NoStore: true, Public: true, MaxAge: time.Hour},
+			ep:     func(em endpointCreator) jelly.Result { return em.OK("nepeta") },
+			expect: "no-store",
+		},
+		{
+			name:  "result header takes precedence",
+			cache: &jelly.CachePolicy{Public: true, MaxAge: time.Hour},
+			ep: func(em endpointCreator) jelly.Result {
+				return em.OK("nepeta").WithHeader("Cache-Control", "no-cache")
+			},
+			expect: "no-cache",
+		},
+		{
+			name:     "not set on errors",
+			cache:    &jelly.CachePolicy{Public: true, MaxAge: time.Hour},
+			loggedIn: true,
+			ep:       func(em endpointCreator) jelly.Result { return em.NotFound() },
+			expect:   "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			em := endpointCreator{mid: &middle.Provider{}, log: logging.NoOpLogger{}}
+
+			handler := em.Endpoint(func(req *http.Request) jelly.Result {
+				return tc.ep(em)
+			}, jelly.Override{Cache: tc.cache})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.loggedIn {
+				req = req.WithContext(jelly.WithTestValues(req.Context(), jelly.TestValues{
+					User: &jelly.AuthUser{Username: "arsenicCatnip"},
+				}))
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			assert.Equal(tc.expect, w.Header().Get("Cache-Control"))
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dekarrin/jelly"
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// captureBodyLimit is the maximum number of bytes of each body that is
+	// captured. Anything beyond it is truncated.
+	captureBodyLimit = 64 * 1024
+)
+
+// captureBuffer is a ring buffer of the most recent captured requests.
+type captureBuffer struct {
+	mtx     sync.Mutex
+	entries []jelly.CapturedRequest
+	next    int
+	full    bool
+}
+
+func newCaptureBuffer(size int) *captureBuffer {
+	return &captureBuffer{entries: make([]jelly.CapturedRequest, size)}
+}
+
+func (cb *captureBuffer) add(c jelly.CapturedRequest) {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	cb.entries[cb.next] = c
+	cb.next = (cb.next + 1) % len(cb.entries)
+	if cb.next == 0 {
+		cb.full = true
+	}
+}
+
+// list returns the captured requests in the buffer, oldest first.
+func (cb *captureBuffer) list() []jelly.CapturedRequest {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	if !cb.full {
+		return append([]jelly.CapturedRequest{}, cb.entries[:cb.next]...)
+	}
+
+	list := make([]jelly.CapturedRequest, 0, len(cb.entries))
+	list = append(list, cb.entries[cb.next:]...)
+	list = append(list, cb.entries[:cb.next]...)
+	return list
+}
+
+// Captures returns the most recent captured requests to the named API. See
+// jelly.RESTServer.Captures.
+func (rs *restServer) Captures(api string) []jelly.CapturedRequest {
+	rs.mtx.Lock()
+	buf := rs.captures[strings.ToLower(api)]
+	rs.mtx.Unlock()
+
+	if buf == nil {
+		return nil
+	}
+	return buf.list()
+}
+
+// captureMiddleware returns middleware that logs the requests to the named API
+// and their responses as configured in its bundle. If capture is not enabled
+// for the API, nil is returned. rs.mtx must be held by the caller.
+func (rs *restServer) captureMiddleware(name string, bndl jelly.Bundle) jelly.Middleware {
+	if !bndl.GetBool(jelly.ConfigKeyAPICapture) {
+		return nil
+	}
+
+	var buf *captureBuffer
+	if size := bndl.GetInt(jelly.ConfigKeyAPICaptureBuffer); size > 0 {
+		// keep the same buffer if the router is re-created
+		buf = rs.captures[name]
+		if buf == nil || len(buf.entries) != size {
+			buf = newCaptureBuffer(size)
+			if rs.captures == nil {
+				rs.captures = map[string]*captureBuffer{}
+			}
+			rs.captures[name] = buf
+		}
+	}
+
+	var terms []string
+	for _, t := range bndl.GetSlice(jelly.ConfigKeyAPICaptureRedact) {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			terms = append(terms, t)
+		}
+	}
+
+	log := rs.log
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+
+			// read the start of the body for capture, then give the handler
+			// the complete body
+			reqBody, _ := io.ReadAll(io.LimitReader(req.Body, captureBodyLimit+1))
+			req.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(reqBody), req.Body), req.Body}
+
+			var respBody limitedBuffer
+			ww := chimw.NewWrapResponseWriter(w, req.ProtoMajor)
+			ww.Tee(&respBody)
+
+			next.ServeHTTP(ww, req)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			c := jelly.CapturedRequest{
+				API:          name,
+				Time:         start,
+				Duration:     time.Since(start),
+				Method:       req.Method,
+				URI:          req.URL.RequestURI(),
+				RemoteAddr:   req.RemoteAddr,
+				Status:       status,
+				RequestBody:  sanitizeBody(reqBody, req.Header.Get("Content-Type"), terms),
+				ResponseBody: sanitizeBody(respBody.buf.Bytes(), ww.Header().Get("Content-Type"), terms),
+			}
+			if respBody.truncated {
+				c.ResponseBody += " (truncated)"
+			}
+
+			log.Tracef("%s capture: %s %s -> HTTP-%d (%s)\n  request: %s\n  response: %s", name, c.Method, c.URI, c.Status, c.Duration, c.RequestBody, c.ResponseBody)
+			if buf != nil {
+				buf.add(c)
+			}
+		})
+	}
+}
+
+// limitedBuffer is an io.Writer that keeps only the first captureBodyLimit
+// bytes written to it. Writes never fail.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := captureBodyLimit - lb.buf.Len(); len(p) > room {
+		p = p[:room]
+		lb.truncated = true
+	}
+	lb.buf.Write(p)
+	return n, nil
+}
+
+// sanitizeBody returns a printable version of body with the values of any
+// sensitive fields redacted, including those whose names contain one of terms.
+// Only JSON and form bodies can be redacted; JSON that cannot be parsed, such
+// as when it was truncated, and binary bodies are replaced with a description
+// of their size, and other text bodies are returned as-is.
+func sanitizeBody(body []byte, contentType string, terms []string) string {
+	if len(body) == 0 {
+		return "(empty)"
+	}
+
+	var suffix string
+	if len(body) > captureBodyLimit {
+		body = body[:captureBodyLimit]
+		suffix = " (truncated)"
+	}
+
+	redacted, ok := jelly.RedactBody(body, contentType, terms...)
+	if !ok {
+		// it cannot be redacted, so it must not be shown
+		return fmt.Sprintf("(%d bytes of JSON that could not be parsed for redaction)", len(body))
+	}
+
+	if !utf8.Valid(redacted) {
+		return fmt.Sprintf("(%d bytes of binary data)", len(body))
+	}
+	return string(redacted) + suffix
+}
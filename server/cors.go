@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+)
+
+// corsMiddleware returns middleware that allows cross-origin requests as
+// given in cfg, or nil if no origins are allowed. Preflight requests from an
+// allowed origin are answered with an HTTP-204 and are not passed on.
+// Requests from origins that are not allowed are passed on without CORS
+// headers, which makes the browser refuse to give the response to the page.
+func corsMiddleware(cfg jelly.CORSConfig) jelly.Middleware {
+	if len(cfg.AllowedOrigins) == 0 {
+		return nil
+	}
+	cfg = cfg.FillDefaults()
+
+	anyOrigin := false
+	origins := map[string]bool{}
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" {
+			anyOrigin = true
+		}
+		origins[strings.ToLower(o)] = true
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			origin := req.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			// the response differs by origin, so caches must keep them apart
+			w.Header().Add("Vary", "Origin")
+			if !anyOrigin && !origins[strings.ToLower(origin)] {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			if anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+			if !preflight {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			if cfg.MaxAgeSecs > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAgeSecs))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+)
+
+// deprecationUsage counts the uses of deprecated endpoints, keyed by method
+// and route pattern.
+type deprecationUsage struct {
+	mtx    sync.Mutex
+	counts map[string]int64
+}
+
+func newDeprecationUsage() *deprecationUsage {
+	return &deprecationUsage{counts: map[string]int64{}}
+}
+
+// record adds a use of the route and returns the number of times it has been
+// used, including this one.
+func (du *deprecationUsage) record(method, pattern string) int64 {
+	du.mtx.Lock()
+	defer du.mtx.Unlock()
+
+	key := method + " " + pattern
+	du.counts[key]++
+	return du.counts[key]
+}
+
+// deprecated sets the deprecation headers given by dep on w and records and
+// logs the use of the deprecated endpoint that req was made to. It must be
+// called before the response is written.
+func (em endpointCreator) deprecated(w http.ResponseWriter, req *http.Request, dep jelly.Deprecation) {
+	setDeprecationHeaders(w.Header(), dep)
+
+	if em.deprecations == nil {
+		return
+	}
+	pattern := req.URL.Path
+	if rctx := chi.RouteContext(req.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		pattern = rctx.RoutePattern()
+	}
+	uses := em.deprecations.record(req.Method, pattern)
+	if em.log != nil {
+		em.log.Warnf("deprecated endpoint %s %s called; used %d time(s) since server start", req.Method, jelly.UnPathParam(pattern), uses)
+	}
+}
+
+func setDeprecationHeaders(h http.Header, dep jelly.Deprecation) {
+	if dep.Since.IsZero() {
+		h.Set("Deprecation", "true")
+	} else {
+		h.Set("Deprecation", "@"+strconv.FormatInt(dep.Since.Unix(), 10))
+	}
+	if !dep.Sunset.IsZero() {
+		h.Set("Sunset", dep.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if dep.Replacement != "" {
+		h.Add("Link", "<"+dep.Replacement+">; rel=\"successor-version\"")
+	}
+}
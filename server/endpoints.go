@@ -2,6 +2,8 @@ package server
 
 import (
 	"net/http"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/dekarrin/jelly"
@@ -11,6 +13,34 @@ import (
 type endpointCreator struct {
 	mid *middle.Provider
 	log jelly.Logger
+
+	// hooks is called in order on the Result of every endpoint.
+	hooks []jelly.ResultHook
+
+	// envelope is the convention that Resource uses for the API.
+	envelope jelly.Envelope
+
+	// models is the metadata of models registered with the Environment.
+	models map[reflect.Type]jelly.ModelMeta
+
+	// schemas is the schemas registered with the Environment.
+	schemas *jelly.SchemaRegistry
+
+	// messages is the catalog that user-facing error messages are localized
+	// with. If nil, they are not localized.
+	messages *jelly.MessageCatalog
+
+	// resp is the ResponseGenerator that replaces the default one, if one was
+	// set with SetResponseGenerator. Set it with withResponses.
+	resp jelly.ResponseGenerator
+
+	// deprecations counts the uses of deprecated endpoints. If nil, they are
+	// not counted or logged.
+	deprecations *deprecationUsage
+
+	// requireContentType is whether endpoints that do not set
+	// Override.Accepts only accept JSON request bodies.
+	requireContentType bool
 }
 
 func (em endpointCreator) DontPanic() jelly.Middleware {
@@ -37,7 +67,43 @@ func (em endpointCreator) Endpoint(ep jelly.EndpointFunc, overrides ...jelly.Ove
 	overs := jelly.CombineOverrides(overrides)
 
 	return func(w http.ResponseWriter, req *http.Request) {
-		r := ep(req)
+		if probe, ok := req.Context().Value(endpointProbeKey{}).(*endpointProbe); ok {
+			probe.override = overs
+			probe.found = true
+			return
+		}
+		if overs.Deprecated != nil {
+			em.deprecated(w, req, *overs.Deprecated)
+		}
+
+		var r jelly.Result
+		if len(overs.Scopes) > 0 {
+			r = em.checkScopes(req, overs.Scopes)
+		}
+		if r.Status == 0 {
+			r = em.checkContentType(req, overs.Accepts)
+		}
+		if r.Status == 0 && overs.Schema != "" {
+			r = em.checkSchema(req, overs.Schema)
+		}
+		if r.Status == 0 {
+			handlerStart := time.Now()
+			r = ep(req)
+			jelly.RecordResponseMetrics(w, jelly.ResponseMetrics{Handler: time.Since(handlerStart)})
+			if overs.Fields && !r.IsErr {
+				if fields := jelly.ParseFields(req); fields != nil {
+					if bad := em.checkFields(r, fields); bad.Status != 0 {
+						r = bad
+					} else {
+						r = r.WithFields(fields)
+					}
+				}
+			}
+		}
+		for _, hook := range em.hooks {
+			r = hook(em, req, r)
+		}
+		r = em.localize(req, r)
 
 		if r.Status == http.StatusUnauthorized || r.Status == http.StatusForbidden || r.Status == http.StatusInternalServerError {
 			// if it's one of these statuses, either the user is improperly
@@ -47,7 +113,53 @@ func (em endpointCreator) Endpoint(ep jelly.EndpointFunc, overrides ...jelly.Ove
 			time.Sleep(auth.UnauthDelay())
 		}
 
+		if !r.IsErr && (r.Status/100 == 2 || r.Status == http.StatusNotModified) {
+			setCacheControl(w.Header(), req, overs.Cache)
+		}
+
 		r.WriteResponse(w)
 		em.LogResponse(req, r)
 	}
 }
+
+// checkContentType returns an error Result if req has a body that is not of one
+// of the accepted media types. If accepted is empty, the body must be JSON if
+// em.requireContentType is set and may be of any type otherwise. Only requests
+// made with a method that carries a body are checked. If the body is
+// acceptable, the zero-value Result is returned.
+func (em endpointCreator) checkContentType(req *http.Request, accepted []string) jelly.Result {
+	if len(accepted) == 0 {
+		if !em.requireContentType {
+			return jelly.Result{}
+		}
+		accepted = []string{"application/json"}
+	}
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return jelly.Result{}
+	}
+	if req.ContentLength == 0 {
+		return jelly.Result{}
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	if jelly.MediaTypeIs(contentType, accepted...) {
+		return jelly.Result{}
+	}
+	userMsg := "Request body must be of type " + strings.Join(accepted, " or ")
+	return em.UnsupportedMediaType(userMsg, "request body has content-type %q; endpoint accepts %q", contentType, accepted)
+}
+
+// checkScopes returns an error Result if the logged-in user does not have all
+// of the given scopes. If they do, the zero-value Result is returned.
+func (em endpointCreator) checkScopes(req *http.Request, scopes []string) jelly.Result {
+	user, loggedIn := middle.GetLoggedInUser(req)
+	if !loggedIn {
+		return em.Unauthorized("", "endpoint requires scopes %q but client is not logged in", scopes)
+	}
+	if !user.HasScopes(scopes...) {
+		return em.Forbidden("user '%s' token scopes %q do not include all of %q", user.Username, user.Scopes, scopes)
+	}
+	return jelly.Result{}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/dekarrin/jelly/internal/middle"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Endpoint_contentType(t *testing.T) {
+	testCases := []struct {
+		name        string
+		require     bool
+		accepts     []string
+		method      string
+		contentType string
+		body        string
+		expect      int
+	}{
+		{
+			name:        "not required, no declared types",
+			method:      "POST",
+			contentType: "text/plain",
+			body:        "hi",
+			expect:      http.StatusNoContent,
+		},
+		{
+			name:        "required, JSON",
+			require:     true,
+			method:      "POST",
+			contentType: "application/json; charset=utf-8",
+			body:        "{}",
+			expect:      http.StatusNoContent,
+		},
+		{
+			name:        "required, not JSON",
+			require:     true,
+			method:      "PUT",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "a=b",
+			expect:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:    "required, no content type",
+			require: true,
+			method:  "PATCH",
+			body:    "{}",
+			expect:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:    "required, no body",
+			require: true,
+			method:  "POST",
+			expect:  http.StatusNoContent,
+		},
+		{
+			name:        "required, method without body",
+			require:     true,
+			method:      "DELETE",
+			contentType: "text/plain",
+			body:        "hi",
+			expect:      http.StatusNoContent,
+		},
+		{
+			name:        "declared types checked when not required",
+			accepts:     []string{"image/*"},
+			method:      "POST",
+			contentType: "application/json",
+			body:        "{}",
+			expect:      http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "declared wildcard type",
+			require:     true,
+			accepts:     []string{"image/*"},
+			method:      "POST",
+			contentType: "image/png",
+			body:        "\x89PNG",
+			expect:      http.StatusNoContent,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			em := endpointCreator{mid: &middle.Provider{}, log: logging.NoOpLogger{}, requireContentType: tc.require}
+
+			var called bool
+			handler := em.Endpoint(func(req *http.Request) jelly.Result {
+				called = true
+				return em.NoContent()
+			}, jelly.Override{Accepts: tc.accepts})
+
+			req := httptest.NewRequest(tc.method, "/", strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			assert.Equal(tc.expect, w.Code)
+			assert.Equal(tc.expect == http.StatusNoContent, called)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/dekarrin/jelly"
+)
+
+// RegisterModel registers the metadata that is used to build the envelopes of
+// resources of the same Go type as model, which may be a value or a pointer to
+// one. Metadata must be registered for every type of model that an API with an
+// envelope configured returns with ResponseGenerator.Resource. It is an error
+// to register metadata for the same type twice.
+func (env *Environment) RegisterModel(model interface{}, meta jelly.ModelMeta) error {
+	env.initDefaults()
+
+	if model == nil {
+		return fmt.Errorf("model cannot be nil")
+	}
+	if err := meta.Validate(); err != nil {
+		return err
+	}
+
+	t := modelType(reflect.TypeOf(model))
+	if _, ok := env.models[t]; ok {
+		return fmt.Errorf("model metadata for %s is already registered", t)
+	}
+	env.models[t] = meta
+	return nil
+}
+
+// modelType returns the type that model metadata is registered under for
+// values of type t.
+func modelType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// Resource returns a Result that gives model, or a slice of models, in the
+// envelope configured for the API. If the API has no envelope configured, it
+// is the same as calling Response. If additional values are provided they are
+// given to internalMsg as a format string.
+func (d *defaultResponses) Resource(status int, model interface{}, internalMsg string, v ...interface{}) jelly.Result {
+	gen := d.generator()
+	if d.em.envelope == jelly.EnvelopeNone {
+		return gen.Response(status, model, internalMsg, v...)
+	}
+
+	doc, err := d.em.envelopeDocument(model)
+	if err != nil {
+		return gen.InternalServerError("build %s envelope: %v", d.em.envelope, err)
+	}
+
+	r := gen.Response(status, doc, internalMsg, v...)
+	r.Envelope = d.em.envelope
+	return r.WithHeader("Content-Type", d.em.envelope.ContentType())
+}
+
+// envelopeDocument returns the full response body that gives model in the
+// envelope of em.
+func (em endpointCreator) envelopeDocument(model interface{}) (interface{}, error) {
+	if model == nil {
+		return nil, fmt.Errorf("model is nil")
+	}
+
+	val := reflect.ValueOf(model)
+	for val.Kind() == reflect.Pointer && !val.IsNil() {
+		val = val.Elem()
+	}
+
+	isCollection := (val.Kind() == reflect.Slice || val.Kind() == reflect.Array) && val.Type().Elem().Kind() != reflect.Uint8
+
+	var meta jelly.ModelMeta
+	var ok bool
+	if isCollection {
+		meta, ok = em.models[modelType(val.Type().Elem())]
+	} else {
+		meta, ok = em.models[modelType(val.Type())]
+	}
+	if !ok {
+		return nil, fmt.Errorf("no model metadata is registered for %T", model)
+	}
+
+	if !isCollection {
+		res, err := em.envelopeResource(meta, val.Interface())
+		if err != nil {
+			return nil, err
+		}
+		if em.envelope == jelly.EnvelopeJSONAPI {
+			return map[string]interface{}{"data": res}, nil
+		}
+		return res, nil
+	}
+
+	resources := make([]map[string]interface{}, val.Len())
+	for i := 0; i < val.Len(); i++ {
+		res, err := em.envelopeResource(meta, val.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		resources[i] = res
+	}
+
+	if em.envelope == jelly.EnvelopeJSONAPI {
+		return map[string]interface{}{"data": resources}, nil
+	}
+	return map[string]interface{}{
+		"_embedded": map[string]interface{}{meta.Type: resources},
+	}, nil
+}
+
+// envelopeResource returns the resource object of a single model in the
+// envelope of em.
+func (em endpointCreator) envelopeResource(meta jelly.ModelMeta, model interface{}) (map[string]interface{}, error) {
+	// the ModelMeta funcs are always given values, not pointers
+	mv := reflect.ValueOf(model)
+	for mv.Kind() == reflect.Pointer {
+		if mv.IsNil() {
+			return nil, fmt.Errorf("model is nil")
+		}
+		mv = mv.Elem()
+	}
+	model = mv.Interface()
+
+	data, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	var attrs map[string]interface{}
+	if err := json.Unmarshal(data, &attrs); err != nil || attrs == nil {
+		return nil, fmt.Errorf("%T does not marshal to a JSON object", model)
+	}
+
+	var links map[string]string
+	if meta.Links != nil {
+		links = meta.Links(model)
+	}
+
+	if em.envelope == jelly.EnvelopeHAL {
+		if len(links) > 0 {
+			halLinks := map[string]interface{}{}
+			for rel, href := range links {
+				halLinks[rel] = map[string]string{"href": href}
+			}
+			attrs["_links"] = halLinks
+		}
+		return attrs, nil
+	}
+
+	// JSON:API does not allow these members in attributes
+	delete(attrs, "id")
+	delete(attrs, "type")
+
+	res := map[string]interface{}{
+		"type":       meta.Type,
+		"id":         meta.ID(model),
+		"attributes": attrs,
+	}
+	if len(links) > 0 {
+		res["links"] = links
+	}
+	return res, nil
+}
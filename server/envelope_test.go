@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/dekarrin/jelly/internal/middle"
+	"github.com/stretchr/testify/assert"
+)
+
+type testModel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func Test_endpointCreator_Resource(t *testing.T) {
+	meta := jelly.ModelMeta{
+		Type: "things",
+		ID:   func(m interface{}) string { return m.(testModel).ID },
+		Links: func(m interface{}) map[string]string {
+			return map[string]string{"self": "/things/" + m.(testModel).ID}
+		},
+	}
+	models := map[reflect.Type]jelly.ModelMeta{reflect.TypeOf(testModel{}): meta}
+
+	testCases := []struct {
+		name         string
+		envelope     jelly.Envelope
+		model        interface{}
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			name:         "no envelope",
+			envelope:     jelly.EnvelopeNone,
+			model:        testModel{ID: "1", Name: "Vriska"},
+			expectStatus: http.StatusOK,
+			expectBody:   `{"id":"1","name":"Vriska"}`,
+		},
+		{
+			name:         "jsonapi - single",
+			envelope:     jelly.EnvelopeJSONAPI,
+			model:        &testModel{ID: "1", Name: "Vriska"},
+			expectStatus: http.StatusOK,
+			expectBody:   `{"data":{"type":"things","id":"1","attributes":{"name":"Vriska"},"links":{"self":"/things/1"}}}`,
+		},
+		{
+			name:         "jsonapi - collection",
+			envelope:     jelly.EnvelopeJSONAPI,
+			model:        []testModel{{ID: "1", Name: "Vriska"}, {ID: "2", Name: "Kanaya"}},
+			expectStatus: http.StatusOK,
+			expectBody:   `{"data":[{"type":"things","id":"1","attributes":{"name":"Vriska"},"links":{"self":"/things/1"}},{"type":"things","id":"2","attributes":{"name":"Kanaya"},"links":{"self":"/things/2"}}]}`,
+		},
+		{
+			name:         "hal - single",
+			envelope:     jelly.EnvelopeHAL,
+			model:        testModel{ID: "1", Name: "Vriska"},
+			expectStatus: http.StatusOK,
+			expectBody:   `{"id":"1","name":"Vriska","_links":{"self":{"href":"/things/1"}}}`,
+		},
+		{
+			name:         "hal - collection",
+			envelope:     jelly.EnvelopeHAL,
+			model:        []*testModel{{ID: "1", Name: "Vriska"}},
+			expectStatus: http.StatusOK,
+			expectBody:   `{"_embedded":{"things":[{"id":"1","name":"Vriska","_links":{"self":{"href":"/things/1"}}}]}}`,
+		},
+		{
+			name:         "unregistered model",
+			envelope:     jelly.EnvelopeJSONAPI,
+			model:        struct{ Name string }{Name: "Terezi"},
+			expectStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			em := endpointCreator{log: logging.NoOpLogger{}, envelope: tc.envelope, models: models}
+
+			r := em.Resource(http.StatusOK, tc.model, "ok")
+
+			assert.Equal(tc.expectStatus, r.Status)
+			if tc.expectBody != "" {
+				actual, err := json.Marshal(r.Resp)
+				if !assert.NoError(err) {
+					return
+				}
+				assert.JSONEq(tc.expectBody, string(actual))
+			}
+		})
+	}
+}
+
+func Test_endpointCreator_Endpoint_fields(t *testing.T) {
+	meta := jelly.ModelMeta{
+		Type: "things",
+		ID:   func(m interface{}) string { return m.(testModel).ID },
+	}
+	models := map[reflect.Type]jelly.ModelMeta{reflect.TypeOf(testModel{}): meta}
+	things := []testModel{{ID: "1", Name: "Vriska"}, {ID: "2", Name: "Kanaya"}}
+
+	testCases := []struct {
+		name       string
+		envelope   jelly.Envelope
+		override   jelly.Override
+		query      string
+		expectBody string
+	}{
+		{
+			name:       "fields not enabled",
+			query:      "?fields=id",
+			expectBody: `[{"id":"1","name":"Vriska"},{"id":"2","name":"Kanaya"}]`,
+		},
+		{
+			name:       "no fields selected",
+			override:   jelly.Override{Fields: true},
+			expectBody: `[{"id":"1","name":"Vriska"},{"id":"2","name":"Kanaya"}]`,
+		},
+		{
+			name:       "fields selected",
+			override:   jelly.Override{Fields: true},
+			query:      "?fields=id",
+			expectBody: `[{"id":"1"},{"id":"2"}]`,
+		},
+		{
+			name:       "jsonapi - fields selected for type",
+			envelope:   jelly.EnvelopeJSONAPI,
+			override:   jelly.Override{Fields: true},
+			query:      "?fields[things]=id",
+			expectBody: `{"data":[{"type":"things","id":"1","attributes":{}},{"type":"things","id":"2","attributes":{}}]}`,
+		},
+		{
+			name:       "jsonapi - fields selected for other type",
+			envelope:   jelly.EnvelopeJSONAPI,
+			override:   jelly.Override{Fields: true},
+			query:      "?fields[people]=id",
+			expectBody: `{"data":[{"type":"things","id":"1","attributes":{"name":"Vriska"}},{"type":"things","id":"2","attributes":{"name":"Kanaya"}}]}`,
+		},
+		{
+			name:       "hal - fields selected",
+			envelope:   jelly.EnvelopeHAL,
+			override:   jelly.Override{Fields: true},
+			query:      "?fields=name",
+			expectBody: `{"_embedded":{"things":[{"name":"Vriska"},{"name":"Kanaya"}]}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			em := endpointCreator{mid: &middle.Provider{}, log: logging.NoOpLogger{}, envelope: tc.envelope, models: models}
+
+			handler := em.Endpoint(func(req *http.Request) jelly.Result {
+				return em.Resource(http.StatusOK, things, "ok")
+			}, tc.override)
+
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/things"+tc.query, nil))
+
+			assert.Equal(http.StatusOK, w.Code)
+			assert.JSONEq(tc.expectBody, w.Body.String())
+		})
+	}
+}
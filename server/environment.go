@@ -2,6 +2,9 @@ package server
 
 import (
 	"fmt"
+	"os"
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/dekarrin/jelly"
@@ -9,12 +12,17 @@ import (
 	"github.com/dekarrin/jelly/internal/middle"
 )
 
+// envProfile is the environment variable that gives the profile that
+// LoadConfig selects.
+const envProfile = "JELLY_PROFILE"
+
 // Environment is a full Jelly environment that contains all parameters needed
 // to run a server. Creating an Environment prior to config loading allows all
 // required external functionality to be properly registered.
 type Environment struct {
 	componentProviders      map[string]func() jelly.API
 	componentProvidersOrder []string
+	componentVersions       map[string]string
 
 	confEnv *config.Environment
 
@@ -22,6 +30,16 @@ type Environment struct {
 
 	connectors *config.ConnectorRegistry
 
+	seeds           map[string][]registeredSeed
+	fixtureDecoders map[string]map[string]jelly.FixtureDecoder
+	models          map[reflect.Type]jelly.ModelMeta
+	schemas         *jelly.SchemaRegistry
+	messages        map[string]map[string]string
+	servers         []*restServer
+	flagProvider    jelly.FlagProvider
+	storeDecorators []jelly.StoreDecorator
+	observers       []jelly.LifecycleObserver
+
 	DisableDefaults bool
 }
 
@@ -29,6 +47,12 @@ func (env *Environment) initDefaults() {
 	if env.componentProviders == nil {
 		env.componentProviders = map[string]func() jelly.API{}
 		env.componentProvidersOrder = []string{}
+		env.componentVersions = map[string]string{}
+		env.seeds = map[string][]registeredSeed{}
+		env.fixtureDecoders = map[string]map[string]jelly.FixtureDecoder{}
+		env.models = map[reflect.Type]jelly.ModelMeta{}
+		env.schemas = jelly.NewSchemaRegistry()
+		env.messages = map[string]map[string]string{}
 		env.confEnv = &config.Environment{DisableDefaults: env.DisableDefaults}
 		env.middleProv = &middle.Provider{DisableDefaults: env.DisableDefaults}
 		env.connectors = &config.ConnectorRegistry{DisableDefaults: env.DisableDefaults}
@@ -53,6 +77,29 @@ func (env *Environment) UseComponent(c jelly.Component) {
 
 	env.componentProviders[normName] = c.API
 	env.componentProvidersOrder = append(env.componentProvidersOrder, normName)
+	if vc, ok := c.(jelly.VersionedComponent); ok {
+		env.componentVersions[normName] = vc.Version()
+	}
+	if sc, ok := c.(jelly.SchemaComponent); ok {
+		schemas := sc.Schemas()
+		names := make([]string, 0, len(schemas))
+		for name := range schemas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := env.RegisterSchema(name, schemas[name], nil); err != nil {
+				panic(fmt.Sprintf("register component schema: %v", err))
+			}
+		}
+	}
+	if fc, ok := c.(jelly.FixtureComponent); ok {
+		for kind, dec := range fc.FixtureDecoders() {
+			if err := env.RegisterFixtureDecoder(normName, kind, dec); err != nil {
+				panic(fmt.Sprintf("register component fixture decoder: %v", err))
+			}
+		}
+	}
 }
 
 // RegisterConfigSection registers a provider function, which creates an
@@ -82,6 +129,72 @@ func (env *Environment) RegisterConnector(engine jelly.DBType, name string, conn
 	return env.connectors.Register(engine, name, connector)
 }
 
+// RegisterDBErrorTranslator sets the function that converts errors from the
+// driver of the given engine into the canonical errors of the jelly package,
+// such as jelly.ErrDBConstraintViolation, when they are wrapped with
+// jelly.WrapDBError. This lets APIs check errors from their stores the same way
+// regardless of engine. It is typically called along with RegisterConnector
+// for the engine's connectors. The engine must be a supported DB type; SQLite
+// has a translator registered by default, which this replaces.
+func (env *Environment) RegisterDBErrorTranslator(engine jelly.DBType, t jelly.DBErrorTranslator) error {
+	env.initDefaults()
+	return env.connectors.RegisterErrorTranslator(engine, t)
+}
+
+// DecorateStores adds decorators that wrap every Store that a server connects
+// for the DBs in its config, regardless of the connector that created it. They
+// are applied in the order that they are added, so the last one added is the
+// outermost. Nil decorators are ignored. It must be called before NewServer to
+// have an effect on the server.
+func (env *Environment) DecorateStores(decorators ...jelly.StoreDecorator) {
+	env.initDefaults()
+	for _, d := range decorators {
+		if d != nil {
+			env.storeDecorators = append(env.storeDecorators, d)
+		}
+	}
+}
+
+// ObserveLifecycle adds observers that are told of each step in the life of the
+// servers of the Environment, from the loading of config with LoadConfig to
+// the end of Shutdown. They are told of each step in the order that they are
+// added. Nil observers are ignored. It must be called before LoadConfig and
+// NewServer to observe them.
+func (env *Environment) ObserveLifecycle(observers ...jelly.LifecycleObserver) {
+	env.initDefaults()
+	for _, o := range observers {
+		if o != nil {
+			env.observers = append(env.observers, o)
+		}
+	}
+}
+
+// decorateStore applies the decorators added with DecorateStores to the Store
+// connected for the named DB.
+func (env *Environment) decorateStore(name string, db jelly.Store) (jelly.Store, error) {
+	for i, d := range env.storeDecorators {
+		var err error
+		db, err = d(name, db)
+		if err != nil {
+			return nil, fmt.Errorf("decorator #%d: %w", i+1, err)
+		}
+		if db == nil {
+			return nil, fmt.Errorf("decorator #%d: returned a nil Store", i+1)
+		}
+	}
+	return db, nil
+}
+
+// UseFlagProvider sets the FlagProvider that decides whether the feature flags
+// that APIs check with Bundle.Flags are enabled, such as a client of an
+// external flag service. It must be called before NewServer to have an effect
+// on the server. If it is not called, flags are defined in the server's
+// config; see jelly.FlagConfig.
+func (env *Environment) UseFlagProvider(p jelly.FlagProvider) {
+	env.initDefaults()
+	env.flagProvider = p
+}
+
 // RegisterAuthenticator registers an authenticator for use with other
 // components in a jelly framework environment. This is generally not called
 // directly but can be. If attempting to register the authenticator of a
@@ -93,18 +206,72 @@ func (env *Environment) RegisterAuthenticator(name string, authen jelly.Authenti
 	return env.middleProv.RegisterAuthenticator(name, authen)
 }
 
+// replaceAuthenticator replaces the authenticator registered under name with
+// authen, or registers it if there is none. Middleware that already uses the
+// old one uses authen from then on.
+func (env *Environment) replaceAuthenticator(name string, authen jelly.Authenticator) error {
+	env.initDefaults()
+	return env.middleProv.ReplaceAuthenticator(name, authen)
+}
+
 // LoadConfig loads a configuration from file. Ensure that UseComponent is first
 // called on every component that will be configured (such as jelly/auth), and
 // ensure RegisterConfigSection is called for each custom config section not
 // associated with a component.
+//
+// file may also be a directory, such as a mounted Kubernetes ConfigMap, in
+// which case every JSON and YAML file in it is merged in order of their names.
+// References to pod metadata in the config are replaced with their values:
+// "${pod.name}", "${pod.namespace}", "${pod.ip}", and "${node.name}" are read
+// from the POD_NAME, POD_NAMESPACE, POD_IP, and NODE_NAME environment
+// variables, as set with the Kubernetes downward API. If not set, the pod name
+// falls back to the hostname and the namespace to that of the pod's service
+// account.
+//
+// The config may give overrides for each profile that the server can be run
+// as under the top-level "profiles" key, which are merged over the rest of the
+// config when that profile is selected. The profile is selected with the
+// JELLY_PROFILE environment variable; to give it directly, such as from a
+// command-line flag, use LoadConfigProfile.
 func (env *Environment) LoadConfig(file string) (jelly.Config, error) {
+	return env.LoadConfigProfile(file, os.Getenv(envProfile))
+}
+
+// LoadConfigProfile loads the config the same as LoadConfig, but with the
+// given profile selected instead of the one in the JELLY_PROFILE environment
+// variable. The overrides under "profiles" for the profile are merged over the
+// rest of the config, and Globals.Profile is set to it. It is an error to
+// select a profile that the config has no overrides for if it has overrides
+// for any others. If profile is "", no overrides are applied.
+func (env *Environment) LoadConfigProfile(file string, profile string) (jelly.Config, error) {
 	env.initDefaults()
-	return env.confEnv.Load(file)
+	cfg, err := env.confEnv.Load(file, profile)
+	if err != nil {
+		return cfg, err
+	}
+	for _, o := range env.observers {
+		o.OnConfigLoaded(cfg)
+	}
+	return cfg, nil
 }
 
-// DumpConfig dumpes the given config to bytes. If Format is not set on the
-// Config, YAML is assumed.
+// DumpConfig dumpes the given config to bytes for display. If Format is not set
+// on the Config, YAML is assumed. The values of sensitive keys, such as secrets
+// and those registered with jelly.RegisterSensitive, are redacted, so the
+// result will not load as an equivalent config. To dump it differently, use
+// DumpConfigWith.
 func (env *Environment) DumpConfig(cfg jelly.Config) []byte {
+	b, err := env.DumpConfigWith(cfg, jelly.DumpOptions{Redact: true})
+	if err != nil {
+		panic(fmt.Sprintf("format encoding failed: %v", err))
+	}
+	return b
+}
+
+// DumpConfigWith dumps the given config to bytes for display as specified by
+// opts. If Format is not set on the Config, YAML is assumed. It is an error if
+// opts.Section is not in the config.
+func (env *Environment) DumpConfigWith(cfg jelly.Config, opts jelly.DumpOptions) ([]byte, error) {
 	env.initDefaults()
-	return config.Dump(cfg)
+	return config.DumpWith(cfg, opts)
 }
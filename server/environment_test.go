@@ -0,0 +1,682 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Environment_DumpConfigWith(t *testing.T) {
+	confFile := filepath.Join(t.TempDir(), "jelly.yml")
+	err := os.WriteFile(confFile, []byte(`
+listen: localhost:8080
+webhooks:
+  path: /hooks
+  subscriptions:
+    - url: http://localhost:9000
+      secret: hunter2
+`), 0600)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	env := &Environment{}
+	cfg, err := env.LoadConfig(confFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cfg = cfg.FillDefaults()
+
+	testCases := []struct {
+		name      string
+		opts      jelly.DumpOptions
+		expect    string
+		expectErr bool
+	}{
+		{
+			name: "section",
+			opts: jelly.DumpOptions{Section: "webhooks.subscriptions"},
+			expect: `- url: http://localhost:9000
+  secret: hunter2
+`,
+		},
+		{
+			name: "redacted section",
+			opts: jelly.DumpOptions{Section: "webhooks.subscriptions", Redact: true},
+			expect: `- url: http://localhost:9000
+  secret: '[REDACTED]'
+`,
+		},
+		{
+			name: "annotated section",
+			opts: jelly.DumpOptions{Section: "webhooks", Redact: true, Annotate: true},
+			expect: `subscriptions: # file
+    - url: http://localhost:9000
+      secret: '[REDACTED]'
+admin: false # default
+path: /hooks # file
+attempts: 5 # default
+retry_delay: 1000 # default
+timeout: 5000 # default
+dead_letters: 100 # default
+`,
+		},
+		{
+			name:      "missing section",
+			opts:      jelly.DumpOptions{Section: "webhooks.nope"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			actual, err := env.DumpConfigWith(cfg, tc.opts)
+
+			if tc.expectErr {
+				assert.Error(err)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+			assert.Equal(tc.expect, string(actual))
+		})
+	}
+}
+
+func Test_Environment_DumpConfigWith_sources(t *testing.T) {
+	testCases := []struct {
+		name   string
+		conf   string // if empty, the config is not loaded
+		modify func(cfg *jelly.Config)
+		expect string
+	}{
+		{
+			name: "file and default",
+			conf: `
+listen: localhost:8080
+webhooks:
+  path: /hooks
+`,
+			expect: `admin: false # default
+path: /hooks # file
+attempts: 5 # default
+retry_delay: 1000 # default
+timeout: 5000 # default
+dead_letters: 100 # default
+`,
+		},
+		{
+			name: "env",
+			conf: `
+listen: localhost:8080
+webhooks:
+  path: /hooks/${pod.name}
+`,
+			expect: `admin: false # default
+path: /hooks/jelly-0 # env
+attempts: 5 # default
+retry_delay: 1000 # default
+timeout: 5000 # default
+dead_letters: 100 # default
+`,
+		},
+		{
+			name: "changed by code after load",
+			conf: `
+listen: localhost:8080
+webhooks:
+  path: /hooks
+`,
+			modify: func(cfg *jelly.Config) {
+				cfg.Globals.Webhooks.Path = "/other"
+				cfg.Globals.Webhooks.Attempts = 3
+			},
+			expect: `admin: false # default
+path: /other # code
+attempts: 3 # code
+retry_delay: 1000 # default
+timeout: 5000 # default
+dead_letters: 100 # default
+`,
+		},
+		{
+			name: "not loaded",
+			modify: func(cfg *jelly.Config) {
+				cfg.Globals.Webhooks.Path = "/hooks"
+			},
+			expect: `admin: false # default
+path: /hooks # code
+attempts: 5 # default
+retry_delay: 1000 # default
+timeout: 5000 # default
+dead_letters: 100 # default
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			t.Setenv("POD_NAME", "jelly-0")
+			env := &Environment{}
+
+			var cfg jelly.Config
+			if tc.conf != "" {
+				confFile := filepath.Join(t.TempDir(), "jelly.yml")
+				if err := os.WriteFile(confFile, []byte(tc.conf), 0600); err != nil {
+					t.Fatal(err)
+				}
+				var err error
+				cfg, err = env.LoadConfig(confFile)
+				if !assert.NoError(err) {
+					return
+				}
+			}
+			if tc.modify != nil {
+				tc.modify(&cfg)
+			}
+			cfg = cfg.FillDefaults()
+
+			actual, err := env.DumpConfigWith(cfg, jelly.DumpOptions{Section: "webhooks", Annotate: true})
+			if !assert.NoError(err) {
+				return
+			}
+			assert.Equal(tc.expect, string(actual))
+		})
+	}
+}
+
+// writeConfigMap writes files to dir the way that Kubernetes mounts a
+// ConfigMap: in a hidden timestamped directory, linked to by "..data", with a
+// symlink to each file through "..data".
+func writeConfigMap(t *testing.T, dir string, version string, files map[string]string) {
+	t.Helper()
+
+	dataDir := "..2024_" + version
+	if err := os.MkdirAll(filepath.Join(dir, dataDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, dataDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// swap ..data atomically, as kubelet does
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(dataDir, tmpLink); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmpLink, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	for name := range files {
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); err == nil {
+			continue
+		}
+		if err := os.Symlink(filepath.Join("..data", name), link); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_Environment_LoadConfig_directory(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv("POD_NAMESPACE", "prospit")
+
+	dir := t.TempDir()
+	writeConfigMap(t, dir, "1", map[string]string{
+		"00-base.yml": `
+listen: localhost:8080
+# comments are not interpolated: ${pod.ip}
+profile: ${pod.namespace}-profile
+webhooks:
+  path: /hooks
+`,
+		"10-override.json": `{"listen": ":9000", "webhooks": {"attempts": 7}}`,
+		"README.txt":       "not a config file",
+	})
+
+	env := &Environment{}
+	cfg, err := env.LoadConfig(dir)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.Equal(dir, cfg.Path)
+	assert.Equal(jelly.YAML, cfg.Format)
+	assert.Equal(9000, cfg.Globals.Port)
+	assert.Equal("prospit-profile", cfg.Globals.Profile)
+	assert.Equal("/hooks", cfg.Globals.Webhooks.Path)
+	assert.Equal(7, cfg.Globals.Webhooks.Attempts)
+}
+
+func Test_Environment_LoadConfig_podMetadata(t *testing.T) {
+	testCases := []struct {
+		name      string
+		content   string
+		expect    string
+		expectErr bool
+	}{
+		{
+			name:    "yaml",
+			content: "profile: ${pod.name}.${pod.namespace}",
+			expect:  "pod-413.prospit",
+		},
+		{
+			name:    "other references are left as-is",
+			content: "profile: ${HOME}-${pod.name}",
+			expect:  "${HOME}-pod-413",
+		},
+		{
+			name:      "unknown metadata",
+			content:   "profile: ${pod.uid}",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			t.Setenv("POD_NAME", "pod-413")
+			t.Setenv("POD_NAMESPACE", "prospit")
+
+			confFile := filepath.Join(t.TempDir(), "jelly.yml")
+			content := "listen: localhost:8080\n" + tc.content
+			if err := os.WriteFile(confFile, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			env := &Environment{}
+			cfg, err := env.LoadConfig(confFile)
+
+			if tc.expectErr {
+				assert.Error(err)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+			assert.Equal(tc.expect, cfg.Globals.Profile)
+		})
+	}
+}
+
+func Test_watchConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	writeConfigMap(t, dir, "1", map[string]string{"jelly.yml": "listen: :8080"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := watchConfig(ctx, dir, 10*time.Millisecond, logging.NoOpLogger{})
+
+	select {
+	case <-changed:
+		assert.Fail("change reported before config changed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	writeConfigMap(t, dir, "2", map[string]string{"jelly.yml": "listen: :9000"})
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		assert.Fail("change to config was not reported")
+	}
+}
+
+func Test_Environment_LoadConfig_flags(t *testing.T) {
+	assert := assert.New(t)
+
+	confFile := filepath.Join(t.TempDir(), "jelly.yml")
+	err := os.WriteFile(confFile, []byte(`
+listen: localhost:8080
+flags:
+  rules:
+    admin-reports:
+      enabled: true
+      percentage: 50
+      roles: [admin, normal]
+`), 0600)
+	if !assert.NoError(err) {
+		return
+	}
+
+	env := &Environment{}
+	cfg, err := env.LoadConfig(confFile)
+	if !assert.NoError(err) {
+		return
+	}
+
+	expect := jelly.FlagRule{Enabled: true, Percentage: 50, Roles: []jelly.Role{jelly.Admin, jelly.Normal}}
+	assert.Equal(expect, cfg.Globals.Flags.Rules["admin-reports"])
+}
+
+func Test_Environment_RegisterDBErrorTranslator(t *testing.T) {
+	assert := assert.New(t)
+
+	env := Environment{}
+	translate := func(err error) (error, bool) { return nil, false }
+
+	assert.Error(env.RegisterDBErrorTranslator(jelly.DBType("postgres"), translate))
+	assert.Error(env.RegisterDBErrorTranslator(jelly.DatabaseInMemory, nil))
+
+	assert.NoError(env.RegisterDBErrorTranslator(jelly.DatabaseInMemory, translate))
+	jelly.RegisterDBErrorTranslator(jelly.DatabaseInMemory, nil)
+}
+
+type decoratedStore struct {
+	jelly.AuthUserStore
+	label string
+}
+
+func Test_Environment_DecorateStores(t *testing.T) {
+	assert := assert.New(t)
+
+	env := Environment{}
+	var decorated []string
+	env.DecorateStores(
+		func(db string, store jelly.Store) (jelly.Store, error) {
+			decorated = append(decorated, db)
+			return decoratedStore{AuthUserStore: store.(jelly.AuthUserStore), label: "inner"}, nil
+		},
+		nil,
+		func(db string, store jelly.Store) (jelly.Store, error) {
+			return decoratedStore{AuthUserStore: store.(jelly.AuthUserStore), label: "outer"}, nil
+		},
+	)
+
+	cfg := jelly.Config{
+		Globals: jelly.Globals{Address: "localhost:8080"},
+		DBs: map[string]jelly.DatabaseConfig{
+			"Users": {Type: jelly.DatabaseInMemory, Connector: "authuser"},
+		},
+	}
+	srv, err := env.NewServer(&cfg)
+	if !assert.NoError(err) {
+		return
+	}
+
+	db, err := srv.(*restServer).dbs["users"].Get(context.Background())
+	if !assert.NoError(err) {
+		return
+	}
+	if assert.IsType(decoratedStore{}, db) {
+		assert.Equal("outer", db.(decoratedStore).label)
+		assert.Equal("inner", db.(decoratedStore).AuthUserStore.(decoratedStore).label)
+	}
+	assert.Equal([]string{"Users"}, decorated)
+}
+
+func Test_Environment_DecorateStores_error(t *testing.T) {
+	assert := assert.New(t)
+
+	env := Environment{}
+	env.DecorateStores(func(db string, store jelly.Store) (jelly.Store, error) {
+		return nil, errors.New("metrics backend unreachable")
+	})
+
+	cfg := jelly.Config{
+		Globals: jelly.Globals{Address: "localhost:8080"},
+		DBs: map[string]jelly.DatabaseConfig{
+			"users": {Type: jelly.DatabaseInMemory, Connector: "authuser"},
+		},
+	}
+	_, err := env.NewServer(&cfg)
+	assert.ErrorContains(err, "metrics backend unreachable")
+}
+
+type counterComponent struct{}
+
+func (counterComponent) Name() string            { return "counter" }
+func (counterComponent) API() jelly.API          { return &counterAPI{} }
+func (counterComponent) Config() jelly.APIConfig { return &jelly.CommonConfig{} }
+
+// counterAPI counts the times it is initialized, so that tests can check
+// that each instance of a component has its own state.
+type counterAPI struct {
+	name  string
+	inits int
+}
+
+func (api *counterAPI) Init(b jelly.Bundle) error {
+	api.name = b.Name()
+	api.inits++
+	return nil
+}
+func (api *counterAPI) Authenticators() map[string]jelly.Authenticator { return nil }
+func (api *counterAPI) Shutdown(context.Context) error                 { return nil }
+func (api *counterAPI) Routes(jelly.ServiceProvider) (chi.Router, bool) {
+	return chi.NewRouter(), false
+}
+
+func Test_Environment_componentInstances(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	err := os.WriteFile(file, []byte(`
+listen: localhost:8080
+counter:
+  enabled: true
+  base: /count
+second:
+  component: Counter
+  enabled: true
+  base: /count2
+plain:
+  enabled: true
+`), 0644)
+	if !assert.NoError(err) {
+		return
+	}
+
+	env := &Environment{}
+	env.UseComponent(counterComponent{})
+
+	cfg, err := env.LoadConfig(file)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("counter", cfg.APIs["second"].Common().Component)
+
+	srv, err := env.NewServer(&cfg)
+	if !assert.NoError(err) {
+		return
+	}
+	rs := srv.(*restServer)
+
+	first, _ := rs.apis["counter"].(*counterAPI)
+	second, _ := rs.apis["second"].(*counterAPI)
+	if assert.NotNil(first) && assert.NotNil(second) {
+		assert.NotSame(first, second)
+		assert.Equal("counter", first.name)
+		assert.Equal("second", second.name)
+		assert.Equal(1, second.inits)
+	}
+	assert.NotContains(rs.apis, "plain")
+
+	assert.Equal([]jelly.ComponentVersion{
+		{Name: "counter"},
+		{Name: "second", Component: "counter"},
+	}, rs.info().Components)
+}
+
+func Test_Environment_LoadConfig_unknownComponent(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	err := os.WriteFile(file, []byte("listen: localhost:8080\nsecond:\n  component: nope\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &Environment{}
+	_, err = env.LoadConfig(file)
+	assert.ErrorContains(t, err, `"nope" is not a registered component`)
+}
+
+func Test_Environment_LoadConfigProfile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	err := os.WriteFile(file, []byte(`
+listen: localhost:8080
+route_stats: false
+webhooks:
+  path: /hooks
+  attempts: 3
+profiles:
+  dev:
+    route_stats: true
+    webhooks:
+      attempts: 7
+  Prod:
+    listen: 0.0.0.0:9000
+  test:
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name         string
+		profile      string
+		expectPort   int
+		expectStats  bool
+		expectTries  int
+		expectErr    bool
+		expectGlobal string
+	}{
+		{name: "no profile", profile: "", expectPort: 8080, expectTries: 3},
+		{name: "nested overrides are merged", profile: "dev", expectPort: 8080, expectStats: true, expectTries: 7, expectGlobal: "dev"},
+		{name: "case-insensitive", profile: "prod", expectPort: 9000, expectTries: 3, expectGlobal: "prod"},
+		{name: "no overrides", profile: "test", expectPort: 8080, expectTries: 3, expectGlobal: "test"},
+		{name: "undefined", profile: "staging", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			env := &Environment{}
+			cfg, err := env.LoadConfigProfile(file, tc.profile)
+			if tc.expectErr {
+				assert.Error(err)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+
+			assert.Equal(tc.expectPort, cfg.Globals.Port)
+			assert.Equal(tc.expectStats, cfg.Globals.RouteStats)
+			assert.Equal(tc.expectTries, cfg.Globals.Webhooks.Attempts)
+			assert.Equal("/hooks", cfg.Globals.Webhooks.Path)
+			assert.Equal(tc.expectGlobal, cfg.Globals.Profile)
+			assert.NotContains(cfg.APIs, "profiles")
+		})
+	}
+}
+
+func Test_Environment_LoadConfig_profileFromEnv(t *testing.T) {
+	assert := assert.New(t)
+	t.Setenv("JELLY_PROFILE", "dev")
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.json")
+	err := os.WriteFile(file, []byte(`{"listen": "localhost:8080", "profiles": {"dev": {"listen": "localhost:8081"}}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &Environment{}
+	cfg, err := env.LoadConfig(file)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(8081, cfg.Globals.Port)
+	assert.Equal("dev", cfg.Globals.Profile)
+}
+
+func Test_Environment_LoadConfig_listen(t *testing.T) {
+	testCases := []struct {
+		name        string
+		config      string
+		expectAddr  string
+		expectPort  int
+		expectExtra []string
+		expectError bool
+	}{
+		{
+			name:       "single address",
+			config:     `listen: localhost:8080`,
+			expectAddr: "localhost",
+			expectPort: 8080,
+		},
+		{
+			name:       "IPv6",
+			config:     `listen: "[::1]:8081"`,
+			expectAddr: "::1",
+			expectPort: 8081,
+		},
+		{
+			name:        "multiple addresses",
+			config:      "listen:\n  - 127.0.0.1:8080\n  - \"[::1]:8080\"",
+			expectAddr:  "127.0.0.1",
+			expectPort:  8080,
+			expectExtra: []string{"[::1]:8080"},
+		},
+		{
+			name:        "IPv6 without brackets",
+			config:      `listen: "::1:8080"`,
+			expectError: true,
+		},
+		{
+			name:        "invalid later address",
+			config:      "listen:\n  - localhost:8080\n  - \"[::1:8080\"",
+			expectError: true,
+		},
+		{
+			name:        "empty list",
+			config:      "listen: []",
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			file := filepath.Join(t.TempDir(), "config.yml")
+			if err := os.WriteFile(file, []byte(tc.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			env := &Environment{}
+			cfg, err := env.LoadConfig(file)
+			if tc.expectError {
+				assert.Error(err)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+			assert.Equal(tc.expectAddr, cfg.Globals.Address)
+			assert.Equal(tc.expectPort, cfg.Globals.Port)
+			assert.Equal(tc.expectExtra, cfg.Globals.ExtraListen)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+	"gopkg.in/yaml.v3"
+)
+
+// RegisterFixtureDecoder registers the decoder for the kind of entity of the
+// API with the given name that is given under kind in fixtures files. The
+// decoders of components that implement jelly.FixtureComponent are registered
+// automatically by UseComponent. It is an error to register two decoders for
+// the same kind of the same API.
+func (env *Environment) RegisterFixtureDecoder(api, kind string, dec jelly.FixtureDecoder) error {
+	env.initDefaults()
+
+	if dec == nil {
+		return fmt.Errorf("fixture decoder cannot be nil")
+	}
+
+	name := strings.ToLower(api)
+	if env.fixtureDecoders[name] == nil {
+		env.fixtureDecoders[name] = map[string]jelly.FixtureDecoder{}
+	}
+	if _, ok := env.fixtureDecoders[name][kind]; ok {
+		return fmt.Errorf("fixture decoder for %q in API %q is already registered", kind, name)
+	}
+	env.fixtureDecoders[name][kind] = dec
+	return nil
+}
+
+// loadFixtures inserts the entities in the fixtures file at path into the
+// stores of the APIs they are given under. bundles holds the init bundle of
+// each enabled API.
+func (rs *restServer) loadFixtures(ctx context.Context, path string, bundles map[string]jelly.Bundle) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// JSON is valid YAML, so both are read the same way.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		// empty file
+		return nil
+	}
+
+	// walk the nodes instead of decoding to maps so that entities are loaded
+	// in the order they are given.
+	apis := doc.Content[0]
+	if apis.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: should be a mapping of API names", apis.Line)
+	}
+	for i := 0; i+1 < len(apis.Content); i += 2 {
+		name := strings.ToLower(apis.Content[i].Value)
+		kinds := apis.Content[i+1]
+
+		b, ok := bundles[name]
+		if !ok {
+			return fmt.Errorf("%s: no enabled API has that name", name)
+		}
+		if kinds.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s: line %d: should be a mapping of entity kinds", name, kinds.Line)
+		}
+
+		for j := 0; j+1 < len(kinds.Content); j += 2 {
+			kind := kinds.Content[j].Value
+			entities := kinds.Content[j+1]
+
+			dec, ok := rs.env.fixtureDecoders[name][kind]
+			if !ok {
+				// instances of a component use the decoders of the component
+				dec, ok = rs.env.fixtureDecoders[b.Component()][kind]
+			}
+			if !ok {
+				return fmt.Errorf("%s.%s: no fixture decoder is registered for that kind", name, kind)
+			}
+			if entities.Kind != yaml.SequenceNode {
+				return fmt.Errorf("%s.%s: line %d: should be a list of entities", name, kind, entities.Line)
+			}
+
+			for k, ent := range entities.Content {
+				if err := dec(ctx, b, ent.Decode); err != nil {
+					return fmt.Errorf("%s.%s: item #%d (line %d): %w", name, kind, k+1, ent.Line, err)
+				}
+			}
+			rs.log.Debugf("Loaded %d %s fixture(s) for API %q", len(entities.Content), kind, name)
+		}
+	}
+
+	return nil
+}
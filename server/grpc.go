@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dekarrin/jelly"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+// grpcService is a gRPC service registered with RegisterGRPCService.
+type grpcService struct {
+	desc *grpc.ServiceDesc
+	impl interface{}
+}
+
+// RegisterGRPCService registers a gRPC service to be served by the server. See
+// jelly.RESTServer.RegisterGRPCService.
+func (rs *restServer) RegisterGRPCService(desc *grpc.ServiceDesc, impl interface{}) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	rs.grpcServices = append(rs.grpcServices, grpcService{desc: desc, impl: impl})
+}
+
+// newGRPCServer creates the gRPC server with the services of every enabled API
+// that implements jelly.GRPCAPI, followed by those registered with
+// RegisterGRPCService. Calls to it are authenticated as configured in
+// Globals.GRPC.
+func (rs *restServer) newGRPCServer() (*grpc.Server, error) {
+	env := rs.env
+	if env == nil {
+		env = &Environment{}
+		env.initDefaults()
+	}
+
+	gc := rs.cfg.Globals.GRPC
+	unary, stream, err := env.middleProv.GRPCAuth(rs.log, gc.RequireAuth, gc.Authenticator)
+	if err != nil {
+		return nil, fmt.Errorf("authenticator: %w", err)
+	}
+
+	gs := grpc.NewServer(grpc.ChainUnaryInterceptor(unary), grpc.ChainStreamInterceptor(stream))
+
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	for _, name := range rs.initOrder {
+		gAPI, ok := rs.apis[name].(jelly.GRPCAPI)
+		if !ok {
+			continue
+		}
+		gAPI.RegisterGRPC(gs)
+		rs.log.Debugf("Registered gRPC services of API %q", name)
+	}
+	for _, svc := range rs.grpcServices {
+		gs.RegisterService(svc.desc, svc.impl)
+	}
+
+	return gs, nil
+}
+
+// serveGRPC starts serving gs. If gRPC is configured to have its own listener,
+// it is served on it in a new goroutine and handler is returned unchanged.
+// Otherwise, the returned handler serves gRPC calls made to the HTTP listener
+// with gs and passes all other requests to handler.
+func (rs *restServer) serveGRPC(gs *grpc.Server, handler http.Handler) (http.Handler, error) {
+	gc := rs.cfg.Globals.GRPC
+
+	if gc.Port == 0 {
+		mux := &grpcMux{grpc: gs, http: handler}
+		rs.mtx.Lock()
+		rs.grpc = gs
+		rs.grpcMux = mux
+		rs.mtx.Unlock()
+
+		rs.log.Infof("Serving gRPC on the HTTP listener")
+		return h2c.NewHandler(mux, &http2.Server{}), nil
+	}
+
+	addr := net.JoinHostPort(gc.Address, strconv.Itoa(gc.Port))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen for gRPC: %w", err)
+	}
+
+	rs.mtx.Lock()
+	rs.grpc = gs
+	rs.mtx.Unlock()
+
+	rs.log.Infof("Serving gRPC on %s", ln.Addr())
+	go func() {
+		if err := gs.Serve(ln); err != nil && err != grpc.ErrServerStopped {
+			rs.log.Errorf("gRPC server stopped: %v", err)
+		}
+	}()
+
+	return handler, nil
+}
+
+// stopGRPC stops the gRPC server gracefully, waiting for calls in progress to
+// complete. If ctx is done before they do, the server is stopped immediately
+// and the context's error is returned. rs.mtx must be held by the caller.
+func (rs *restServer) stopGRPC(ctx context.Context) error {
+	gs := rs.grpc
+	mux := rs.grpcMux
+	rs.grpc = nil
+	rs.grpcMux = nil
+
+	if mux != nil {
+		return mux.shutdown(ctx)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		gs.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		gs.Stop()
+		return ctx.Err()
+	}
+}
+
+// grpcMux serves the gRPC calls made to the HTTP listener with a gRPC server
+// and passes every other request to an HTTP handler. It tracks calls itself
+// because grpc.Server.GracefulStop cannot be used with calls that are served
+// with grpc.Server.ServeHTTP.
+type grpcMux struct {
+	grpc *grpc.Server
+	http http.Handler
+
+	mtx      sync.Mutex
+	calls    sync.WaitGroup
+	draining bool
+}
+
+func (gm *grpcMux) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.ProtoMajor != 2 || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+		gm.http.ServeHTTP(w, req)
+		return
+	}
+
+	gm.mtx.Lock()
+	if gm.draining {
+		gm.mtx.Unlock()
+		// gRPC clients treat this as codes.Unavailable
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	gm.calls.Add(1)
+	gm.mtx.Unlock()
+
+	defer gm.calls.Done()
+	gm.grpc.ServeHTTP(w, req)
+}
+
+// shutdown rejects new calls and waits for those in progress to complete
+// before stopping the gRPC server. If ctx is done first, the server is stopped
+// immediately and the context's error is returned.
+func (gm *grpcMux) shutdown(ctx context.Context) error {
+	gm.mtx.Lock()
+	gm.draining = true
+	gm.mtx.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		gm.calls.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	gm.grpc.Stop()
+	return err
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dekarrin/jelly"
+)
+
+// securityHeadersMiddleware returns middleware that sets the headers given in
+// cfg on every response, or nil if none are configured.
+func securityHeadersMiddleware(cfg jelly.SecurityHeadersConfig) jelly.Middleware {
+	headers := cfg.Headers()
+	if len(headers) == 0 {
+		return nil
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			for name, value := range headers {
+				w.Header().Set(name, value)
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// timeoutMiddleware returns middleware that cancels the context of each
+// request after millis milliseconds, or nil if millis is not positive.
+func timeoutMiddleware(millis int) jelly.Middleware {
+	if millis < 1 {
+		return nil
+	}
+	timeout := time.Duration(millis) * time.Millisecond
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx, cancel := context.WithTimeout(req.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
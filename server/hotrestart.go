@@ -0,0 +1,154 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables used to pass the listening socket from a server to the
+// process that replaces it during a hot restart. Each gives the number of an
+// inherited file descriptor.
+const (
+	envListenFD = "JELLY_LISTEN_FD"
+	envReadyFD  = "JELLY_READY_FD"
+)
+
+// hotRestartReadyTimeout is the maximum amount of time that a hot restart waits
+// for the new process to become ready before giving up on it.
+const hotRestartReadyTimeout = time.Minute
+
+// listen returns the listener that the server should accept connections on.
+// If the process was started by a hot restart, this is the listener inherited
+// from the old process, and ready is a file that must be written to once the
+// server is about to serve so that the old process knows it can shut down;
+// otherwise, a new listener bound to addr is returned and ready is nil.
+func listen(addr string) (ln net.Listener, ready *os.File, err error) {
+	listenFD := os.Getenv(envListenFD)
+	if listenFD == "" {
+		ln, err = net.Listen("tcp", addr)
+		return ln, nil, err
+	}
+
+	// unset so that they are not passed on to any other process this one
+	// starts.
+	readyFD := os.Getenv(envReadyFD)
+	os.Unsetenv(envListenFD)
+	os.Unsetenv(envReadyFD)
+
+	lf, err := inheritedFile(listenFD, "listener")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer lf.Close()
+
+	ln, err = net.FileListener(lf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("inherit listener: %w", err)
+	}
+
+	if readyFD != "" {
+		ready, err = inheritedFile(readyFD, "ready pipe")
+		if err != nil {
+			ln.Close()
+			return nil, nil, err
+		}
+	}
+
+	return ln, ready, nil
+}
+
+func inheritedFile(fdStr string, name string) (*os.File, error) {
+	fd, err := strconv.Atoi(fdStr)
+	if err != nil || fd < 3 {
+		return nil, fmt.Errorf("inherit %s: invalid file descriptor %q", name, fdStr)
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+// handOff starts a new instance of the program that inherits ln, and waits
+// for it to signal that it is ready to serve. If handOff returns a nil error,
+// the new process is accepting connections on ln and the caller should shut
+// down; otherwise, the new process has been stopped and the caller should
+// continue serving.
+func handOff(ln net.Listener) error {
+	fl, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return fmt.Errorf("listener of type %T cannot be passed to another process", ln)
+	}
+	lf, err := fl.File()
+	if err != nil {
+		return fmt.Errorf("get listener file: %w", err)
+	}
+	defer lf.Close()
+
+	// the program is looked up again instead of using os.Executable so that a
+	// binary replaced on disk is picked up.
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return fmt.Errorf("find program: %w", err)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("create ready pipe: %w", err)
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{lf, readyW}
+	cmd.Env = append(withoutHandOffEnv(os.Environ()),
+		// ExtraFiles[i] becomes file descriptor 3+i in the new process
+		envListenFD+"=3",
+		envReadyFD+"=4",
+	)
+
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return fmt.Errorf("start new process: %w", err)
+	}
+
+	// the new process writes to the pipe once it is ready, or the pipe is
+	// closed without a write if it exits before then.
+	readyErr := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		readyErr <- err
+	}()
+
+	select {
+	case err = <-readyErr:
+		if err == io.EOF {
+			err = fmt.Errorf("new process exited before it was ready")
+		}
+	case <-time.After(hotRestartReadyTimeout):
+		err = fmt.Errorf("new process was not ready after %s", hotRestartReadyTimeout)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	return cmd.Process.Release()
+}
+
+func withoutHandOffEnv(env []string) []string {
+	filtered := make([]string, 0, len(env))
+	for _, kv := range env {
+		if strings.HasPrefix(kv, envListenFD+"=") || strings.HasPrefix(kv, envReadyFD+"=") {
+			continue
+		}
+		filtered = append(filtered, kv)
+	}
+	return filtered
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// restartSignal is the signal that triggers a hot restart in Run.
+var restartSignal os.Signal = syscall.SIGUSR2
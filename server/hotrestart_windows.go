@@ -0,0 +1,7 @@
+package server
+
+import "os"
+
+// restartSignal is the signal that triggers a hot restart in Run. It is nil on
+// Windows, where hot restarts are not supported.
+var restartSignal os.Signal
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+	"gopkg.in/yaml.v3"
+)
+
+// RegisterMessages registers the messages of locale, mapped by their keys, to
+// the message catalog of servers created from the Environment. The
+// user-facing messages of error responses that are keys in the catalog are
+// replaced with the message for the locale that the request accepts; see
+// jelly.I18nConfig. Registering messages with the same key in the same locale
+// as already registered ones replaces them.
+func (env *Environment) RegisterMessages(locale string, msgs map[string]string) error {
+	env.initDefaults()
+
+	if locale == "" {
+		return fmt.Errorf("locale cannot be empty")
+	}
+
+	locale = strings.ToLower(locale)
+	if env.messages[locale] == nil {
+		env.messages[locale] = map[string]string{}
+	}
+	for k, v := range msgs {
+		env.messages[locale][k] = v
+	}
+	return nil
+}
+
+// newMessageCatalog creates the message catalog for a server from the
+// messages registered with env followed by those in the catalog files of
+// conf.
+func (env *Environment) newMessageCatalog(conf jelly.I18nConfig) (*jelly.MessageCatalog, error) {
+	mc := jelly.NewMessageCatalog(conf.FallbackLocale)
+	for locale, msgs := range env.messages {
+		mc.Add(locale, msgs)
+	}
+
+	for _, path := range conf.Catalogs {
+		if err := loadCatalog(mc, path); err != nil {
+			return nil, fmt.Errorf("catalog %s: %w", path, err)
+		}
+	}
+
+	return mc, nil
+}
+
+// loadCatalog adds the messages in the catalog file at path to mc.
+func loadCatalog(mc *jelly.MessageCatalog, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// JSON is valid YAML, so both are read the same way.
+	var locales map[string]map[string]string
+	if err := yaml.Unmarshal(data, &locales); err != nil {
+		return err
+	}
+	for locale, msgs := range locales {
+		mc.Add(locale, msgs)
+	}
+	return nil
+}
+
+// localize returns r with its user-facing error message replaced with the
+// message in em's catalog for the locale that req accepts, if the message is a
+// key in the catalog. Results that are not errors are returned as-is.
+func (em endpointCreator) localize(req *http.Request, r jelly.Result) jelly.Result {
+	if em.messages == nil || !r.IsErr {
+		return r
+	}
+
+	var locale string
+	switch resp := r.Resp.(type) {
+	case jelly.ErrorResponse:
+		resp.Error, locale = em.messages.Localize(req, resp.Error)
+		r.Resp = resp
+	case string:
+		r.Resp, locale = em.messages.Localize(req, resp)
+	}
+
+	if locale == "" {
+		return r
+	}
+	return r.WithHeader("Content-Language", locale)
+}
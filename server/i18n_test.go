@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/dekarrin/jelly/internal/middle"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_endpointCreator_Endpoint_localize(t *testing.T) {
+	mc := jelly.NewMessageCatalog("en")
+	mc.Add("en", map[string]string{"user.taken": "That username is taken"})
+	mc.Add("es", map[string]string{"user.taken": "Ese nombre de usuario ya existe"})
+
+	testCases := []struct {
+		name              string
+		acceptLang        string
+		userMsg           string
+		expectBody        string
+		expectContentLang string
+	}{
+		{
+			name:              "requested locale",
+			acceptLang:        "es-MX",
+			userMsg:           "user.taken",
+			expectBody:        `{"error":"Ese nombre de usuario ya existe","status":409}`,
+			expectContentLang: "es",
+		},
+		{
+			name:              "fallback locale",
+			acceptLang:        "ja",
+			userMsg:           "user.taken",
+			expectBody:        `{"error":"That username is taken","status":409}`,
+			expectContentLang: "en",
+		},
+		{
+			name:       "not a message key",
+			acceptLang: "es",
+			userMsg:    "nope",
+			expectBody: `{"error":"nope","status":409}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			em := endpointCreator{mid: &middle.Provider{}, log: logging.NoOpLogger{}, messages: mc}
+
+			handler := em.Endpoint(func(req *http.Request) jelly.Result {
+				return em.Conflict(tc.userMsg, "conflict")
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/users", nil)
+			req.Header.Set("Accept-Language", tc.acceptLang)
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			assert.Equal(http.StatusConflict, w.Code)
+			assert.JSONEq(tc.expectBody, w.Body.String())
+			assert.Equal(tc.expectContentLang, w.Header().Get("Content-Language"))
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+)
+
+// inFlightRetryAfter is how long clients are told to wait before retrying a
+// request that was rejected because too many were in flight.
+const inFlightRetryAfter = time.Second
+
+// inFlightLimiter limits the number of requests that are handled at once. It
+// does not queue requests; any that arrive while it is full are rejected.
+type inFlightLimiter struct {
+	sem      chan struct{}
+	inFlight int64
+	rejected int64
+}
+
+func newInFlightLimiter(limit int) *inFlightLimiter {
+	return &inFlightLimiter{sem: make(chan struct{}, limit)}
+}
+
+func (lim *inFlightLimiter) stats() jelly.InFlightStats {
+	return jelly.InFlightStats{
+		Limit:    cap(lim.sem),
+		InFlight: atomic.LoadInt64(&lim.inFlight),
+		Rejected: atomic.LoadInt64(&lim.rejected),
+	}
+}
+
+// middleware returns middleware that passes requests on only while fewer than
+// the limit are in flight, and responds with an HTTP-503 otherwise.
+func (lim *inFlightLimiter) middleware(sp endpointCreator, name string) jelly.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			select {
+			case lim.sem <- struct{}{}:
+			default:
+				atomic.AddInt64(&lim.rejected, 1)
+				res := sp.ServiceUnavailable("The server is too busy; try again later", inFlightRetryAfter, "%s: %d requests already in flight", name, cap(lim.sem))
+				res.WriteResponse(w)
+				sp.LogResponse(req, res)
+				return
+			}
+
+			atomic.AddInt64(&lim.inFlight, 1)
+			defer func() {
+				atomic.AddInt64(&lim.inFlight, -1)
+				<-lim.sem
+			}()
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// InFlight returns the current in-flight request counts of the named API, or
+// of the server as a whole if api is empty. See jelly.RESTServer.InFlight.
+func (rs *restServer) InFlight(api string) jelly.InFlightStats {
+	rs.mtx.Lock()
+	lim := rs.inFlight[strings.ToLower(api)]
+	rs.mtx.Unlock()
+
+	if lim == nil {
+		return jelly.InFlightStats{}
+	}
+	return lim.stats()
+}
+
+// inFlightMiddleware returns middleware that limits the number of requests to
+// the named API that are handled at once, or to the whole server if name is
+// empty. If there is no limit, nil is returned. rs.mtx must be held by the
+// caller.
+func (rs *restServer) inFlightMiddleware(name string, limit int, sp endpointCreator) jelly.Middleware {
+	if limit < 1 {
+		delete(rs.inFlight, name)
+		return nil
+	}
+
+	// keep the same limiter if the router is re-created so that requests
+	// already in flight are still counted
+	lim := rs.inFlight[name]
+	if lim == nil || cap(lim.sem) != limit {
+		lim = newInFlightLimiter(limit)
+		if rs.inFlight == nil {
+			rs.inFlight = map[string]*inFlightLimiter{}
+		}
+		rs.inFlight[name] = lim
+	}
+
+	logName := name
+	if logName == "" {
+		logName = "server"
+	}
+	return lim.middleware(sp, logName)
+}
+
+// useInFlightLimit adds middleware to r that limits the number of requests to
+// the server that are handled at once if a limit is configured. rs.mtx must be
+// held by the caller.
+func (rs *restServer) useInFlightLimit(r chi.Router, sp endpointCreator) {
+	if mw := rs.inFlightMiddleware("", rs.cfg.Globals.MaxInFlight, sp); mw != nil {
+		r.Use(mw)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_inFlightLimiter_middleware(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limit   int
+		blocked int // requests that are still being handled
+		expect  int // status of the next request
+	}{
+		{name: "none in flight", limit: 1, blocked: 0, expect: http.StatusOK},
+		{name: "below limit", limit: 3, blocked: 2, expect: http.StatusOK},
+		{name: "at limit", limit: 1, blocked: 1, expect: http.StatusServiceUnavailable},
+		{name: "at higher limit", limit: 3, blocked: 3, expect: http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			lim := newInFlightLimiter(tc.limit)
+			release := make(chan struct{})
+			h := lim.middleware(endpointCreator{log: logging.NoOpLogger{}}, "test")(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/block" {
+					<-release
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			var wg sync.WaitGroup
+			for i := 0; i < tc.blocked; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/block", nil))
+				}()
+			}
+			assert.Eventually(func() bool {
+				return lim.stats().InFlight == int64(tc.blocked)
+			}, time.Second, time.Millisecond)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			assert.Equal(tc.expect, w.Code)
+
+			expectRejected := int64(0)
+			if tc.expect == http.StatusServiceUnavailable {
+				expectRejected = 1
+				assert.Equal("1", w.Header().Get("Retry-After"))
+			}
+			assert.Equal(jelly.InFlightStats{Limit: tc.limit, InFlight: int64(tc.blocked), Rejected: expectRejected}, lim.stats())
+
+			// once the requests in flight are done, there is room again
+			close(release)
+			wg.Wait()
+			assert.Equal(int64(0), lim.stats().InFlight)
+
+			w = httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			assert.Equal(http.StatusOK, w.Code)
+		})
+	}
+}
+
+func Test_restServer_inFlightMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	rs := &restServer{mtx: &sync.Mutex{}}
+	sp := endpointCreator{log: logging.NoOpLogger{}}
+
+	assert.NotNil(rs.inFlightMiddleware("api", 2, sp))
+	first := rs.inFlight["api"]
+	assert.Equal(jelly.InFlightStats{Limit: 2}, rs.InFlight("API"))
+
+	// an unchanged limit keeps the limiter so requests in flight still count
+	rs.inFlightMiddleware("api", 2, sp)
+	assert.Same(first, rs.inFlight["api"])
+
+	rs.inFlightMiddleware("api", 5, sp)
+	assert.NotSame(first, rs.inFlight["api"])
+	assert.Equal(5, rs.InFlight("api").Limit)
+
+	assert.Nil(rs.inFlightMiddleware("api", 0, sp))
+	assert.Equal(jelly.InFlightStats{}, rs.InFlight("api"))
+}
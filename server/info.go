@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+)
+
+// Info returns information on the server. See jelly.RESTServer.Info.
+func (rs *restServer) Info() jelly.ServerInfo {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	return rs.info()
+}
+
+// info returns information on the server. rs.mtx must be held by the caller.
+func (rs *restServer) info() jelly.ServerInfo {
+	name := rs.cfg.Globals.Info.Name
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+
+	var comps []jelly.ComponentVersion
+	if rs.env != nil {
+		for _, compName := range rs.env.componentProvidersOrder {
+			for _, name := range rs.apiOrder {
+				b := rs.getAPIConfigBundle(name)
+				if b.Component() != compName || !b.Enabled() {
+					continue
+				}
+				cv := jelly.ComponentVersion{
+					Name:    name,
+					Version: rs.env.componentVersions[compName],
+				}
+				if name != compName {
+					cv.Component = compName
+				}
+				comps = append(comps, cv)
+			}
+		}
+	}
+
+	return jelly.NewServerInfo(name, comps)
+}
+
+// useVersionHeader adds middleware to r that sets the X-App-Version header on
+// every response if it is enabled and the version of the program is known.
+// rs.mtx must be held by the caller.
+func (rs *restServer) useVersionHeader(r chi.Router) {
+	if !rs.cfg.Globals.Info.VersionHeader {
+		return
+	}
+
+	version := jelly.ReadBuildInfo().Version
+	if version == "" {
+		rs.log.Warnf("info: version_header is enabled but the program version is not known")
+		return
+	}
+
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("X-App-Version", version)
+			next.ServeHTTP(w, req)
+		})
+	})
+}
+
+// routeInfo adds the info endpoint to r if it is enabled. rs.mtx must be held
+// by the caller.
+func (rs *restServer) routeInfo(r chi.Router, sp jelly.ServiceProvider) {
+	ic := rs.cfg.Globals.Info.FillDefaults()
+	if !ic.Enabled {
+		return
+	}
+
+	info := rs.info()
+	r.Get(ic.Path, sp.Endpoint(func(req *http.Request) jelly.Result {
+		return sp.OK(info, "got server info")
+	}))
+}
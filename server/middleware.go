@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// chainEntry is a single named middleware in the server's global middleware
+// chain. Built-in middleware has a nil mw and is created from its name when
+// the chain is applied.
+type chainEntry struct {
+	name string
+	mw   jelly.Middleware
+}
+
+// UseBefore inserts mw into the global middleware chain immediately before the
+// middleware called before. See jelly.RESTServer.UseBefore.
+func (rs *restServer) UseBefore(before string, name string, mw jelly.Middleware) error {
+	return rs.insertMiddleware(before, 0, name, mw)
+}
+
+// UseAfter inserts mw into the global middleware chain immediately after the
+// middleware called after. See jelly.RESTServer.UseAfter.
+func (rs *restServer) UseAfter(after string, name string, mw jelly.Middleware) error {
+	return rs.insertMiddleware(after, 1, name, mw)
+}
+
+// insertMiddleware inserts mw into the chain at offset from the position of
+// the middleware called anchor.
+func (rs *restServer) insertMiddleware(anchor string, offset int, name string, mw jelly.Middleware) error {
+	if name == "" {
+		return fmt.Errorf("middleware name cannot be empty")
+	}
+	if mw == nil {
+		return fmt.Errorf("middleware %q cannot be nil", name)
+	}
+
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	chain := rs.middlewareChain()
+
+	pos := -1
+	for i := range chain {
+		if chain[i].name == name {
+			return fmt.Errorf("middleware %q is already in the chain", name)
+		}
+		if chain[i].name == anchor {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		return fmt.Errorf("middleware %q is not in the chain", anchor)
+	}
+	pos += offset
+
+	newChain := make([]chainEntry, 0, len(chain)+1)
+	newChain = append(newChain, chain[:pos]...)
+	newChain = append(newChain, chainEntry{name: name, mw: mw})
+	newChain = append(newChain, chain[pos:]...)
+	rs.mwChain = newChain
+
+	// make shore to reset the router so the new middleware is used
+	rs.rtr = nil
+
+	return nil
+}
+
+// middlewareChain returns the global middleware chain, creating it from the
+// config if it has not yet been created. rs.mtx must be held by the caller.
+func (rs *restServer) middlewareChain() []chainEntry {
+	if rs.mwChain == nil {
+		names := rs.cfg.Globals.Middleware
+		if names == nil {
+			names = jelly.Globals{}.FillDefaults().Middleware
+		}
+
+		rs.mwChain = make([]chainEntry, len(names))
+		for i := range names {
+			rs.mwChain[i] = chainEntry{name: names[i]}
+		}
+	}
+	return rs.mwChain
+}
+
+// useStartTime adds middleware to r that records the time that the server
+// started handling each request, for jelly.Context.StartTime. It must be the
+// first middleware added to the root router.
+func (rs *restServer) useStartTime(r chi.Router) {
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := jelly.WithStartTime(req.Context(), time.Now())
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	})
+}
+
+// useMiddlewareChain applies every middleware in the global middleware chain
+// to r in order. rs.mtx must be held by the caller.
+func (rs *restServer) useMiddlewareChain(r chi.Router, env *Environment, sp jelly.ServiceProvider) {
+	for _, entry := range rs.middlewareChain() {
+		if entry.mw != nil {
+			r.Use(entry.mw)
+			continue
+		}
+
+		switch entry.name {
+		case jelly.MiddlewareRecover:
+			r.Use(env.middleProv.DontPanic(sp))
+		case jelly.MiddlewareTenant:
+			if rs.cfg.Globals.Tenancy.Enabled {
+				r.Use(env.middleProv.ResolveTenant(rs.cfg.Globals.Tenancy))
+			}
+		case jelly.MiddlewareRequestID:
+			r.Use(chimw.RequestID)
+		case jelly.MiddlewareRealIP:
+			r.Use(chimw.RealIP)
+		case jelly.MiddlewareMirror:
+			if rs.cfg.Globals.Mirror.Enabled {
+				r.Use(env.middleProv.Mirror(rs.cfg.Globals.Mirror.FillDefaults(), rs.log))
+			}
+		case jelly.MiddlewareQuota:
+			if rs.quotas != nil && len(rs.quotas.PerRequest()) > 0 {
+				r.Use(rs.quotaMiddleware(env, sp))
+			}
+		case jelly.MiddlewareAccessLog:
+			r.Use(accessLogMiddleware(rs.log))
+		case jelly.MiddlewareCORS:
+			if mw := corsMiddleware(rs.cfg.Globals.CORS); mw != nil {
+				r.Use(mw)
+			}
+		case jelly.MiddlewareRateLimit:
+			if mw := rs.rateLimitMiddleware(sp); mw != nil {
+				r.Use(mw)
+			}
+		default:
+			// config validation should have caught this
+			rs.log.Warnf("skipping unknown middleware %q", entry.name)
+		}
+	}
+}
+
+// accessLogMiddleware returns middleware that logs each request at info level
+// once it has been handled, with the status and size of its response and how
+// long it took. The size is that of the response as written to the writer the
+// middleware was given, so middleware that compresses responses must come
+// after it in the chain for the compressed size to be logged. If the response
+// was written by a Result, the size before compression and the time taken by
+// the endpoint and by marshaling are logged as well. If the request was given
+// an ID by the "request_id" middleware, it ends the line so that the line can
+// be matched with other records of the request, such as the Hit that an
+// analytics store has of it.
+func accessLogMiddleware(log jelly.Logger) jelly.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			mw := newMeasuredWriter(w, req.ProtoMajor)
+			next.ServeHTTP(mw, req)
+
+			status := mw.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			wire := int64(mw.BytesWritten())
+
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "%s %s %s: HTTP-%d, %d bytes", req.RemoteAddr, req.Method, req.URL.RequestURI(), status, wire)
+			if mw.metrics.Bytes > 0 && mw.metrics.Bytes != wire {
+				fmt.Fprintf(&sb, " (%d uncompressed)", mw.metrics.Bytes)
+			}
+			fmt.Fprintf(&sb, " in %s", time.Since(start).Round(time.Microsecond))
+			if mw.metrics.Handler > 0 || mw.metrics.Marshal > 0 {
+				fmt.Fprintf(&sb, " (handler %s, marshal %s)", mw.metrics.Handler.Round(time.Microsecond), mw.metrics.Marshal.Round(time.Microsecond))
+			}
+			if id := jelly.ContextOf(req.Context()).RequestID(); id != "" {
+				fmt.Fprintf(&sb, " [request %s]", id)
+			}
+			log.Infof("%s", sb.String())
+		})
+	}
+}
+
+// measuredWriter is a chimw.WrapResponseWriter that is also a
+// jelly.ResponseMetricsWriter, so that it collects the metrics of the response
+// that Results give as they are written to it.
+type measuredWriter struct {
+	chimw.WrapResponseWriter
+	metrics jelly.ResponseMetrics
+}
+
+func newMeasuredWriter(w http.ResponseWriter, protoMajor int) *measuredWriter {
+	return &measuredWriter{WrapResponseWriter: chimw.NewWrapResponseWriter(w, protoMajor)}
+}
+
+func (mw *measuredWriter) AddResponseMetrics(m jelly.ResponseMetrics) {
+	mw.metrics.Handler += m.Handler
+	mw.metrics.Marshal += m.Marshal
+	mw.metrics.Bytes += m.Bytes
+}
+
+// Flush flushes the response if the wrapped writer supports it. It is given
+// so that handlers can stream responses through a measuredWriter.
+func (mw *measuredWriter) Flush() {
+	if f, ok := mw.WrapResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the connection if the wrapped writer supports it.
+func (mw *measuredWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := mw.WrapResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("response writer does not support hijacking")
+}
@@ -0,0 +1,416 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// orderMiddleware returns middleware that adds name to the X-Order header of
+// the response so that the order middleware ran in can be checked.
+func orderMiddleware(name string) jelly.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Add("X-Order", name)
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+func Test_UseBefore_UseAfter(t *testing.T) {
+	type insert struct {
+		after  bool
+		anchor string
+		name   string
+	}
+
+	testCases := []struct {
+		name        string
+		inserts     []insert
+		expectChain []string
+		expectOrder []string
+		expectErr   bool
+	}{
+		{
+			name:        "before first built-in",
+			inserts:     []insert{{anchor: "recover", name: "a"}},
+			expectChain: []string{"a", "recover", "tenant", "cors", "ratelimit", "mirror", "quota"},
+			expectOrder: []string{"a"},
+		},
+		{
+			name:        "after last built-in",
+			inserts:     []insert{{after: true, anchor: "quota", name: "a"}},
+			expectChain: []string{"recover", "tenant", "cors", "ratelimit", "mirror", "quota", "a"},
+			expectOrder: []string{"a"},
+		},
+		{
+			name: "around added middleware",
+			inserts: []insert{
+				{after: true, anchor: "recover", name: "b"},
+				{anchor: "b", name: "a"},
+				{after: true, anchor: "b", name: "c"},
+			},
+			expectChain: []string{"recover", "a", "b", "c", "tenant", "cors", "ratelimit", "mirror", "quota"},
+			expectOrder: []string{"a", "b", "c"},
+		},
+		{
+			name: "after the same anchor twice",
+			inserts: []insert{
+				{after: true, anchor: "tenant", name: "a"},
+				{after: true, anchor: "tenant", name: "b"},
+			},
+			expectChain: []string{"recover", "tenant", "b", "a", "cors", "ratelimit", "mirror", "quota"},
+			expectOrder: []string{"b", "a"},
+		},
+		{
+			name:      "unknown anchor",
+			inserts:   []insert{{anchor: "nope", name: "a"}},
+			expectErr: true,
+		},
+		{
+			name:      "name already in chain",
+			inserts:   []insert{{anchor: "recover", name: "quota"}},
+			expectErr: true,
+		},
+		{
+			name:      "empty name",
+			inserts:   []insert{{anchor: "recover", name: ""}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			server := &restServer{
+				mtx:         &sync.Mutex{},
+				apis:        map[string]jelly.API{},
+				apiBases:    map[string]string{},
+				basesToAPIs: map[string]string{},
+				log:         logging.NoOpLogger{},
+				dbs:         map[string]*jelly.LazyStore{},
+				cfg: jelly.Config{
+					APIs: map[string]jelly.APIConfig{
+						"hello": (&jelly.CommonConfig{Name: "hello", Enabled: true, Base: "/hello"}).FillDefaults(),
+					},
+				}.FillDefaults(),
+			}
+			if !assert.NoError(server.Add("hello", helloAPI{})) {
+				return
+			}
+
+			var err error
+			for _, ins := range tc.inserts {
+				if ins.after {
+					err = server.UseAfter(ins.anchor, ins.name, orderMiddleware(ins.name))
+				} else {
+					err = server.UseBefore(ins.anchor, ins.name, orderMiddleware(ins.name))
+				}
+				if err != nil {
+					break
+				}
+			}
+			if tc.expectErr {
+				assert.Error(err)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+
+			var chain []string
+			for _, entry := range server.middlewareChain() {
+				chain = append(chain, entry.name)
+			}
+			assert.Equal(tc.expectChain, chain)
+
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/hello", nil))
+			assert.Equal(http.StatusOK, w.Code)
+			assert.Equal(tc.expectOrder, w.Header().Values("X-Order"))
+		})
+	}
+}
+
+func Test_corsMiddleware(t *testing.T) {
+	testCases := []struct {
+		name          string
+		cfg           jelly.CORSConfig
+		method        string
+		headers       map[string]string
+		expectStatus  int
+		expectHeaders map[string]string
+	}{
+		{
+			name:          "no origin",
+			cfg:           jelly.CORSConfig{AllowedOrigins: []string{"https://example.com"}},
+			method:        "GET",
+			expectStatus:  http.StatusOK,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:          "origin not allowed",
+			cfg:           jelly.CORSConfig{AllowedOrigins: []string{"https://example.com"}},
+			method:        "GET",
+			headers:       map[string]string{"Origin": "https://evil.example.com"},
+			expectStatus:  http.StatusOK,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"},
+		},
+		{
+			name:          "allowed origin",
+			cfg:           jelly.CORSConfig{AllowedOrigins: []string{"https://example.com"}},
+			method:        "GET",
+			headers:       map[string]string{"Origin": "https://example.com"},
+			expectStatus:  http.StatusOK,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": "https://example.com", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:          "any origin",
+			cfg:           jelly.CORSConfig{AllowedOrigins: []string{"*"}},
+			method:        "GET",
+			headers:       map[string]string{"Origin": "https://example.com"},
+			expectStatus:  http.StatusOK,
+			expectHeaders: map[string]string{"Access-Control-Allow-Origin": "*"},
+		},
+		{
+			name:         "preflight",
+			cfg:          jelly.CORSConfig{AllowedOrigins: []string{"https://example.com"}, AllowCredentials: true, MaxAgeSecs: 600},
+			method:       "OPTIONS",
+			headers:      map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "PUT"},
+			expectStatus: http.StatusNoContent,
+			expectHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://example.com",
+				"Access-Control-Allow-Methods":     "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			name:          "options without preflight headers is passed on",
+			cfg:           jelly.CORSConfig{AllowedOrigins: []string{"https://example.com"}},
+			method:        "OPTIONS",
+			headers:       map[string]string{"Origin": "https://example.com"},
+			expectStatus:  http.StatusOK,
+			expectHeaders: map[string]string{"Access-Control-Allow-Methods": ""},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			h := corsMiddleware(tc.cfg)(next)
+
+			req := httptest.NewRequest(tc.method, "/", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			assert.Equal(tc.expectStatus, w.Code)
+			for k, v := range tc.expectHeaders {
+				assert.Equal(v, w.Header().Get(k), k)
+			}
+		})
+	}
+}
+
+func Test_corsMiddleware_noOrigins(t *testing.T) {
+	assert.Nil(t, corsMiddleware(jelly.CORSConfig{}))
+}
+
+func Test_rateLimiter_allow(t *testing.T) {
+	assert := assert.New(t)
+	rl := newRateLimiter(jelly.RateLimitConfig{Requests: 2, PeriodMillis: 1000, Burst: 3})
+	start := time.Unix(1000, 0)
+
+	// the burst is available at once
+	for i := 0; i < 3; i++ {
+		ok, _ := rl.allow("10.0.0.1", start)
+		assert.True(ok, "request #%d", i+1)
+	}
+	ok, retryAfter := rl.allow("10.0.0.1", start)
+	assert.False(ok)
+	assert.Equal(500*time.Millisecond, retryAfter)
+
+	// other clients have their own bucket
+	ok, _ = rl.allow("10.0.0.2", start)
+	assert.True(ok)
+
+	// tokens come back at the rate
+	ok, _ = rl.allow("10.0.0.1", start.Add(500*time.Millisecond))
+	assert.True(ok)
+	ok, _ = rl.allow("10.0.0.1", start.Add(500*time.Millisecond))
+	assert.False(ok)
+
+	// full buckets are discarded by the sweep
+	rl.allow("10.0.0.3", start.Add(time.Hour))
+	assert.Len(rl.buckets, 1)
+}
+
+func Test_rateLimiter_middleware(t *testing.T) {
+	assert := assert.New(t)
+	rl := newRateLimiter(jelly.RateLimitConfig{Requests: 1, PeriodMillis: 60000})
+	h := rl.middleware(endpointCreator{log: logging.NoOpLogger{}})(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	get := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(http.StatusOK, get("10.0.0.1:1234").Code)
+
+	// the port is not part of the client
+	w := get("10.0.0.1:5678")
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Equal("60", w.Header().Get("Retry-After"))
+
+	assert.Equal(http.StatusOK, get("10.0.0.2:1234").Code)
+}
+
+// infoLogger records the messages logged to it at info level.
+type infoLogger struct {
+	logging.NoOpLogger
+	lines []string
+}
+
+func (l *infoLogger) Infof(format string, a ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, a...))
+}
+
+func Test_accessLogMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	log := &infoLogger{}
+	h := accessLogMiddleware(log)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+
+	req := httptest.NewRequest("POST", "/pots?size=little", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if assert.Len(log.lines, 1) {
+		assert.Regexp(`^10\.0\.0\.1:1234 POST /pots\?size=little: HTTP-418, 15 bytes in `, log.lines[0])
+	}
+}
+
+func Test_accessLogMiddleware_compressedResult(t *testing.T) {
+	assert := assert.New(t)
+	log := &infoLogger{}
+	endpoint := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		jelly.RecordResponseMetrics(w, jelly.ResponseMetrics{Handler: 3 * time.Millisecond})
+		r := jelly.Result{
+			IsJSON: true,
+			Status: http.StatusOK,
+			Resp:   map[string]string{"quest": strings.Repeat("dig ", 500)},
+		}
+		r.WriteResponse(w)
+	})
+	h := accessLogMiddleware(log)(chimw.Compress(5)(endpoint))
+
+	req := httptest.NewRequest("GET", "/land", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if assert.Len(log.lines, 1) {
+		assert.Regexp(`^10\.0\.0\.1:1234 GET /land: HTTP-200, \d+ bytes \(2012 uncompressed\) in \S+ \(handler 3ms, marshal \S+\)$`, log.lines[0])
+	}
+}
+
+func Test_accessLogMiddleware_requestID(t *testing.T) {
+	assert := assert.New(t)
+	log := &infoLogger{}
+	h := chimw.RequestID(accessLogMiddleware(log)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	req := httptest.NewRequest("DELETE", "/pots/1", nil)
+	req.Header.Set(chimw.RequestIDHeader, "pot-413")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if assert.Len(log.lines, 1) {
+		assert.Regexp(`: HTTP-204, 0 bytes in \S+ \[request pot-413\]$`, log.lines[0])
+	}
+}
+
+func Test_securityHeadersMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(securityHeadersMiddleware(jelly.SecurityHeadersConfig{}))
+
+	mw := securityHeadersMiddleware(jelly.SecurityHeadersConfig{NoSniff: true, FrameOptions: "sameorigin", HSTSMaxAgeSecs: 3600})
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal("nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal("SAMEORIGIN", w.Header().Get("X-Frame-Options"))
+	assert.Equal("max-age=3600", w.Header().Get("Strict-Transport-Security"))
+	assert.Empty(w.Header().Get("Referrer-Policy"))
+}
+
+func Test_timeoutMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(timeoutMiddleware(0))
+	assert.Nil(timeoutMiddleware(-1))
+
+	var ctxErr error
+	h := timeoutMiddleware(1)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+		ctxErr = req.Context().Err()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(context.DeadlineExceeded, ctxErr)
+}
+
+func Test_restServer_apiRateLimitMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	rs := &restServer{mtx: &sync.Mutex{}}
+	sp := endpointCreator{log: logging.NoOpLogger{}}
+
+	assert.Nil(rs.apiRateLimitMiddleware("api", nil, sp))
+	assert.Nil(rs.apiRateLimitMiddleware("api", &jelly.RateLimitConfig{}, sp))
+
+	assert.NotNil(rs.apiRateLimitMiddleware("api", &jelly.RateLimitConfig{Requests: 2}, sp))
+	first := rs.apiRateLimiters["api"]
+
+	// an unchanged limit keeps the limiter so clients keep their buckets
+	rs.apiRateLimitMiddleware("api", &jelly.RateLimitConfig{Requests: 2}, sp)
+	assert.Same(first, rs.apiRateLimiters["api"])
+
+	rs.apiRateLimitMiddleware("api", &jelly.RateLimitConfig{Requests: 5}, sp)
+	assert.NotSame(first, rs.apiRateLimiters["api"])
+
+	// each API is limited separately
+	rs.apiRateLimitMiddleware("other", &jelly.RateLimitConfig{Requests: 5}, sp)
+	assert.NotSame(rs.apiRateLimiters["api"], rs.apiRateLimiters["other"])
+
+	assert.Nil(rs.apiRateLimitMiddleware("api", nil, sp))
+	assert.NotContains(rs.apiRateLimiters, "api")
+}
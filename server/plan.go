@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+)
+
+// errDryRun is returned by the methods of a server created with
+// NewDryRunServer that would have it serve or change its DBs.
+var errDryRun = errors.New("server was created for a dry run and cannot be started")
+
+// Plan returns what the server will serve once started. See
+// jelly.RESTServer.Plan.
+func (rs *restServer) Plan() (jelly.ServerPlan, error) {
+	rs.checkCreatedViaNew()
+
+	// also routes every API, so apiSwitches is up to date below
+	routes := rs.Routes()
+
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	plan := jelly.ServerPlan{
+		DryRun:  rs.dryRun,
+		Listen:  rs.cfg.Globals.ListenAddress(),
+		URIBase: rs.cfg.Globals.URIBase,
+		Routes:  routes,
+	}
+	for _, entry := range rs.middlewareChain() {
+		plan.Middleware = append(plan.Middleware, entry.name)
+	}
+
+	usedBy := map[string][]string{}
+	for _, name := range rs.apiOrder {
+		apiConf := rs.getAPIConfigBundle(name)
+		api := jelly.APIPlan{
+			Name:    name,
+			Enabled: apiConf.Enabled(),
+		}
+		if rs.env != nil {
+			if _, ok := rs.env.componentProviders[strings.ToLower(apiConf.Component())]; ok {
+				api.Component = strings.ToLower(apiConf.Component())
+			}
+		}
+
+		if api.Enabled {
+			api.Base = apiConf.Base()
+			usesDBs, err := jelly.ResolveUsesDBs(apiConf.UsesDBs(), rs.cfg.DBs)
+			if err != nil {
+				// the API could not have been initialized; list what it asked
+				// for
+				usesDBs = apiConf.UsesDBs()
+			}
+			for _, db := range usesDBs {
+				db = strings.ToLower(db)
+				api.UsesDBs = append(api.UsesDBs, db)
+				usedBy[db] = append(usedBy[db], name)
+			}
+			if sw := rs.apiSwitches[name]; sw != nil {
+				var ri jelly.RouteInfo
+				describeMiddleware(&ri, sw.middleware())
+				api.Middleware = ri.Middleware
+			}
+		}
+
+		plan.APIs = append(plan.APIs, api)
+	}
+
+	for name, dbConf := range rs.cfg.DBs {
+		name = strings.ToLower(name)
+		users := usedBy[name]
+		sort.Strings(users)
+
+		ls := rs.dbs[name]
+		plan.DBs = append(plan.DBs, jelly.DBPlan{
+			Name:      name,
+			Type:      dbConf.Type,
+			Connector: dbConf.Connector,
+			Connect:   dbConf.Connect,
+			Replicas:  len(dbConf.Replicas),
+			Failover:  dbConf.Failover && len(dbConf.Replicas) > 0,
+			Connected: ls != nil && ls.Connected(),
+			UsedBy:    users,
+		})
+	}
+	sort.Slice(plan.DBs, func(i, j int) bool {
+		return plan.DBs[i].Name < plan.DBs[j].Name
+	})
+
+	return plan, rs.checkPending()
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/stretchr/testify/assert"
+)
+
+// bundleAPI is a helloAPI that keeps the Bundle it is initialized with.
+type bundleAPI struct {
+	helloAPI
+	bndl *jelly.Bundle
+}
+
+func (api bundleAPI) Init(b jelly.Bundle) error {
+	*api.bndl = b
+	return nil
+}
+
+type pingStore struct {
+	err    error
+	pinged *bool
+}
+
+func (s pingStore) Close() error { return nil }
+
+func (s pingStore) Ping(ctx context.Context) error {
+	*s.pinged = true
+	return s.err
+}
+
+func Test_NewDryRunServer(t *testing.T) {
+	testCases := []struct {
+		name      string
+		opts      jelly.DryRunOptions
+		connector string
+		pingErr   error
+
+		expectErr       string
+		expectConnected bool
+		expectPinged    bool
+	}{
+		{
+			name:      "DBs are not connected",
+			connector: "ping",
+		},
+		{
+			name:            "DBs are connected and pinged",
+			opts:            jelly.DryRunOptions{ConnectDBs: true},
+			connector:       "ping",
+			expectConnected: true,
+			expectPinged:    true,
+		},
+		{
+			name:      "ping fails",
+			opts:      jelly.DryRunOptions{ConnectDBs: true},
+			connector: "ping",
+			pingErr:   errors.New("no route to host"),
+
+			expectErr:       `ping DB "main": no route to host`,
+			expectConnected: true,
+			expectPinged:    true,
+		},
+		{
+			name:      "connector is not registered",
+			connector: "missing",
+			expectErr: `DB "Main": "inmem"/"missing" is not a registered connector`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			connected, pinged := false, false
+			env := &Environment{}
+			env.RegisterConnector(jelly.DatabaseInMemory, "ping", func(jelly.DatabaseConfig) (jelly.Store, error) {
+				connected = true
+				return pingStore{err: tc.pingErr, pinged: &pinged}, nil
+			})
+
+			cfg := jelly.Config{
+				DBs: map[string]jelly.DatabaseConfig{
+					"Main": {Type: jelly.DatabaseInMemory, Connector: tc.connector},
+				},
+				APIs: map[string]jelly.APIConfig{
+					"hello": (&jelly.CommonConfig{Name: "hello", Enabled: true, Base: "/hello", UsesDBs: []string{"main"}}).FillDefaults(),
+				},
+			}
+
+			srv, err := env.NewDryRunServer(&cfg, tc.opts)
+			assert.Equal(tc.expectConnected, connected)
+			assert.Equal(tc.expectPinged, pinged)
+			if tc.expectErr != "" {
+				assert.ErrorContains(err, tc.expectErr)
+				return
+			}
+			if !assert.NoError(err) {
+				return
+			}
+
+			var bndl jelly.Bundle
+			if !assert.NoError(srv.Add("hello", bundleAPI{bndl: &bndl})) {
+				return
+			}
+			assert.True(bndl.DryRun())
+			assert.Equal(tc.expectConnected, bndl.DB(0) != nil)
+
+			assert.ErrorIs(srv.ServeForever(), errDryRun)
+			assert.ErrorIs(srv.Seed(context.Background()), errDryRun)
+
+			plan, err := srv.Plan()
+			if !assert.NoError(err) {
+				return
+			}
+			assert.True(plan.DryRun)
+			assert.Equal([]jelly.DBPlan{
+				{Name: "main", Type: jelly.DatabaseInMemory, Connector: tc.connector, Connect: jelly.ConnectEager, Connected: tc.expectConnected, UsedBy: []string{"hello"}},
+			}, plan.DBs)
+			assert.Equal([]jelly.APIPlan{
+				{Name: "hello", Enabled: true, Base: "/hello", UsesDBs: []string{"main"}},
+			}, plan.APIs)
+			if assert.Len(plan.Routes, 1) {
+				assert.Equal("/hello/", plan.Routes[0].Path)
+			}
+		})
+	}
+}
+
+func Test_Plan_pendingDependency(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := jelly.Config{
+		APIs: map[string]jelly.APIConfig{
+			"reports": (&jelly.CommonConfig{Name: "reports", Enabled: true, Base: "/reports"}).FillDefaults(),
+		},
+	}
+	srv, err := (&Environment{}).NewDryRunServer(&cfg, jelly.DryRunOptions{})
+	if !assert.NoError(err) {
+		return
+	}
+	if !assert.NoError(srv.Add("reports", &greeterAPI{name: "reports", deps: []string{"users"}, log: &[]string{}})) {
+		return
+	}
+
+	plan, err := srv.Plan()
+	assert.EqualError(err, `API "reports" depends on API "users", which was never added`)
+	if assert.Len(plan.APIs, 1) {
+		assert.Equal("reports", plan.APIs[0].Name)
+	}
+	assert.Empty(plan.Routes)
+}
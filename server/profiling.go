@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+)
+
+// routeProfiling adds the runtime profiles of net/http/pprof to r. Only
+// logged-in users with the admin role may get them; r must already require
+// that users are logged in.
+//
+// The named profiles are routed explicitly rather than through pprof.Index,
+// which only finds them under "/debug/pprof/".
+func routeProfiling(r chi.Router, sp jelly.ServiceProvider) {
+	r.Use(requireAdmin(sp, "get runtime profile"))
+
+	r.Get("/", pprof.Index)
+	r.Get("/cmdline", pprof.Cmdline)
+	r.Get("/profile", pprof.Profile)
+	r.Get("/symbol", pprof.Symbol)
+	r.Post("/symbol", pprof.Symbol)
+	r.Get("/trace", pprof.Trace)
+	r.Get("/{profile}", func(w http.ResponseWriter, req *http.Request) {
+		pprof.Handler(chi.URLParam(req, "profile")).ServeHTTP(w, req)
+	})
+}
+
+// requireAdmin returns middleware that responds with an HTTP-403 to requests
+// from users that do not have the admin role. action describes what the user
+// was attempting in the log message of the response.
+func requireAdmin(sp jelly.ServiceProvider, action string) jelly.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			user, _ := sp.GetLoggedInUser(req)
+			if user.Role != jelly.Admin {
+				sp.Endpoint(func(req *http.Request) jelly.Result {
+					return sp.Forbidden("user '%s' (role %s) %s: forbidden", user.Username, user.Role, action)
+				})(w, req)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
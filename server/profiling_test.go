@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/dekarrin/jelly/internal/middle"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_routeProfiling(t *testing.T) {
+	testCases := []struct {
+		name         string
+		path         string
+		role         jelly.Role
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			name:         "index",
+			path:         "/debug/pprof/",
+			role:         jelly.Admin,
+			expectStatus: http.StatusOK,
+			expectBody:   "goroutine",
+		},
+		{
+			name:         "named profile",
+			path:         "/debug/pprof/goroutine?debug=1",
+			role:         jelly.Admin,
+			expectStatus: http.StatusOK,
+			expectBody:   "goroutine profile:",
+		},
+		{
+			name:         "unknown profile",
+			path:         "/debug/pprof/karkat",
+			role:         jelly.Admin,
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:         "not an admin",
+			path:         "/debug/pprof/goroutine?debug=1",
+			role:         jelly.Normal,
+			expectStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			sp := endpointCreator{mid: &middle.Provider{}, log: logging.NoOpLogger{}}
+			r := chi.NewRouter()
+			r.Route("/debug/pprof", func(r chi.Router) {
+				routeProfiling(r, sp)
+			})
+
+			req := httptest.NewRequest("GET", tc.path, nil)
+			req = req.WithContext(jelly.WithTestValues(req.Context(), jelly.TestValues{
+				User: &jelly.AuthUser{Username: "carcinoGeneticist", Role: tc.role},
+			}))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(tc.expectStatus, w.Code)
+			assert.Contains(w.Body.String(), tc.expectBody)
+		})
+	}
+}
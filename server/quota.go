@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dekarrin/jelly"
+)
+
+// newQuotaManager creates the QuotaManager for the quotas in cfg, keeping
+// their usage in the configured DB out of dbs or in memory if none is
+// configured. If usage is counted in memory, the quotaCache that it is counted
+// in is also returned; it must be run while the server is running to discard
+// old usage and to write usage to the DB on the configured interval. The DB is
+// connected to if it is not already, regardless of its connect policy.
+func newQuotaManager(cfg jelly.QuotaConfig, dbs map[string]*jelly.LazyStore, log jelly.Logger) (*jelly.QuotaManager, *quotaCache, error) {
+	if cfg.DB == "" {
+		cache := newQuotaCache(cfg, nil, log)
+		return jelly.NewQuotaManager(cfg, cache), cache, nil
+	}
+
+	ls, ok := dbs[strings.ToLower(cfg.DB)]
+	if !ok {
+		return nil, nil, fmt.Errorf("db: no DB named %q is configured", cfg.DB)
+	}
+	db, err := ls.Get(context.Background())
+	if err != nil {
+		return nil, nil, fmt.Errorf("db: %w", err)
+	}
+	if rs, ok := db.(*jelly.ReplicatedStore); ok {
+		db = rs.WriteStore()
+	}
+	qs, ok := db.(jelly.QuotaStore)
+	if !ok {
+		return nil, nil, fmt.Errorf("db: DB %q does not implement jelly.QuotaStore", cfg.DB)
+	}
+	if cfg.PersistIntervalMillis < 1 {
+		return jelly.NewQuotaManager(cfg, qs.Quotas()), nil, nil
+	}
+
+	cache := newQuotaCache(cfg, qs.Quotas(), log)
+	return jelly.NewQuotaManager(cfg, cache), cache, nil
+}
+
+// runQuotaCache starts the loop of the quotaCache that quota usage is counted
+// in, if there is one. It does nothing if the loop is already running.
+func (rs *restServer) runQuotaCache() {
+	if rs.quotaCache == nil {
+		return
+	}
+	interval := quotaEvictInterval
+	if ms := rs.cfg.Globals.Quota.PersistIntervalMillis; ms > 0 {
+		interval = time.Duration(ms) * time.Millisecond
+	}
+	rs.quotaCache.run(interval)
+}
+
+// quotaMiddleware returns middleware that uses one of each per-request quota
+// for every request made by a logged-in user. The user is found with the main
+// authenticator; requests that are not logged in are passed on as-is so that
+// the API can decide what to do with them.
+func (rs *restServer) quotaMiddleware(env *Environment, sp jelly.ServiceProvider) jelly.Middleware {
+	quotas := rs.quotas
+	names := quotas.PerRequest()
+	log := rs.log
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			user, loggedIn, err := env.middleProv.SelectAuthenticator().Authenticate(req)
+			if err != nil || !loggedIn {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			ctx := req.Context()
+			for i, name := range names {
+				usage, err := quotas.Consume(ctx, name, user.ID, 1)
+				if err == nil {
+					continue
+				}
+
+				// give back what this request already used of the others
+				for _, consumed := range names[:i] {
+					if _, err := quotas.Consume(ctx, consumed, user.ID, -1); err != nil {
+						log.Warnf("quota %q: give back usage of user %s: %v", consumed, user.ID, err)
+					}
+				}
+
+				if !errors.Is(err, jelly.ErrQuotaExceeded) {
+					// do not turn away requests just because usage could not
+					// be recorded
+					log.Errorf("quota %q: record usage of user %s: %v", name, user.ID, err)
+					next.ServeHTTP(w, req)
+					return
+				}
+
+				var retryAfter time.Duration
+				if !usage.Resets.IsZero() {
+					retryAfter = time.Until(usage.Resets)
+				}
+				res := sp.TooManyRequests("Quota exceeded; try again later", retryAfter, "user %s has used all %d of quota %q", user.ID, usage.Limit, name)
+				res.WriteResponse(w)
+				sp.LogResponse(req, res)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dekarrin/jelly"
+)
+
+// quotaEvictInterval is how often usage of periods that have ended is
+// discarded from a quotaCache that does not write to a DB. The shortest
+// quota period is a minute, so discarding more often than this gains little.
+const quotaEvictInterval = time.Minute
+
+// quotaCache is a jelly.QuotaRepo that counts usage in memory. If it has a
+// backing repo, usage is read from it the first time each key is used and
+// is written to it in batches by flush, so that usage survives restarts
+// without every request waiting on the DB.
+//
+// Usage of periods that have ended is discarded by evict so that memory use
+// does not grow without bound.
+type quotaCache struct {
+	limits  map[string]jelly.QuotaLimit
+	backing jelly.QuotaRepo // nil if usage is kept only in memory
+	log     jelly.Logger
+
+	mtx     sync.Mutex
+	entries map[jelly.QuotaKey]*quotaCacheEntry
+
+	loopMtx sync.Mutex
+	cancel  context.CancelFunc // stops the loop started by run
+	done    chan struct{}      // closed when the loop has returned
+}
+
+type quotaCacheEntry struct {
+	used    int64
+	pending int64 // change to used not yet written to backing
+}
+
+func newQuotaCache(cfg jelly.QuotaConfig, backing jelly.QuotaRepo, log jelly.Logger) *quotaCache {
+	return &quotaCache{
+		limits:  cfg.FillDefaults().Limits,
+		backing: backing,
+		log:     log,
+		entries: map[jelly.QuotaKey]*quotaCacheEntry{},
+	}
+}
+
+// entry returns the entry for key, loading its usage from the backing repo if
+// it is not yet in memory. qc.mtx must be held by the caller.
+func (qc *quotaCache) entry(ctx context.Context, key jelly.QuotaKey) (*quotaCacheEntry, error) {
+	if e, ok := qc.entries[key]; ok {
+		return e, nil
+	}
+
+	e := &quotaCacheEntry{}
+	if qc.backing != nil {
+		used, err := qc.backing.Usage(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		e.used = used
+	}
+	qc.entries[key] = e
+	return e, nil
+}
+
+func (qc *quotaCache) Add(ctx context.Context, key jelly.QuotaKey, amount int64, limit int64) (int64, error) {
+	key.Period = key.Period.UTC()
+
+	qc.mtx.Lock()
+	defer qc.mtx.Unlock()
+
+	e, err := qc.entry(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	newUsed := e.used + amount
+	if amount > 0 && newUsed > limit {
+		return e.used, jelly.ErrQuotaExceeded
+	}
+	if newUsed < 0 {
+		newUsed = 0
+	}
+
+	if qc.backing != nil {
+		e.pending += newUsed - e.used
+	}
+	e.used = newUsed
+	return newUsed, nil
+}
+
+func (qc *quotaCache) Usage(ctx context.Context, key jelly.QuotaKey) (int64, error) {
+	key.Period = key.Period.UTC()
+
+	qc.mtx.Lock()
+	defer qc.mtx.Unlock()
+
+	e, err := qc.entry(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return e.used, nil
+}
+
+// Close does nothing; the backing repo is closed with the store it belongs
+// to.
+func (qc *quotaCache) Close() error {
+	return nil
+}
+
+// flush writes all usage not yet written to the backing repo. Usage that
+// could not be written is kept to be written by the next flush, and the first
+// error is returned.
+func (qc *quotaCache) flush(ctx context.Context) error {
+	if qc.backing == nil {
+		return nil
+	}
+
+	qc.mtx.Lock()
+	pending := map[jelly.QuotaKey]int64{}
+	for key, e := range qc.entries {
+		if e.pending != 0 {
+			pending[key] = e.pending
+			e.pending = 0
+		}
+	}
+	qc.mtx.Unlock()
+
+	var firstErr error
+	for key, amount := range pending {
+		// the limit was already checked when the usage was counted
+		used, err := qc.backing.Add(ctx, key, amount, math.MaxInt64)
+
+		qc.mtx.Lock()
+		e, ok := qc.entries[key]
+		if !ok {
+			e = &quotaCacheEntry{}
+			qc.entries[key] = e
+		}
+		if err != nil {
+			e.pending += amount
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			// take in usage recorded by other servers sharing the DB
+			e.used = used + e.pending
+		}
+		qc.mtx.Unlock()
+	}
+
+	return firstErr
+}
+
+// evict discards the usage of periods that have ended as of now, along with
+// usage of quotas that are no longer defined. Usage that has not yet been
+// written to the backing repo is kept.
+func (qc *quotaCache) evict(now time.Time) {
+	qc.mtx.Lock()
+	defer qc.mtx.Unlock()
+
+	for key, e := range qc.entries {
+		if e.pending != 0 {
+			continue
+		}
+		if ql, ok := qc.limits[strings.ToLower(key.Quota)]; !ok || !ql.Current(key, now) {
+			delete(qc.entries, key)
+		}
+	}
+}
+
+// run starts writing usage to the backing repo every interval and discarding
+// usage of ended periods, until stop is called. If it is already running, it
+// does nothing.
+func (qc *quotaCache) run(interval time.Duration) {
+	qc.loopMtx.Lock()
+	defer qc.loopMtx.Unlock()
+	if qc.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	qc.cancel = cancel
+	qc.done = done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := qc.flush(ctx); err != nil {
+				qc.log.Warnf("quota: write usage to DB: %v; retrying next interval", err)
+			}
+			qc.evict(time.Now())
+		}
+	}()
+}
+
+// stop stops the loop started by run and writes all usage not yet written to
+// the backing repo.
+func (qc *quotaCache) stop(ctx context.Context) error {
+	qc.loopMtx.Lock()
+	if qc.cancel != nil {
+		qc.cancel()
+		<-qc.done
+		qc.cancel = nil
+		qc.done = nil
+	}
+	qc.loopMtx.Unlock()
+
+	return qc.flush(ctx)
+}
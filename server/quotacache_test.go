@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/authuserdao/inmem"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_quotaCache(t *testing.T) {
+	cfg := jelly.QuotaConfig{
+		DB:                    "main",
+		PersistIntervalMillis: 1000,
+		Limits: map[string]jelly.QuotaLimit{
+			"requests": {Limit: 5, Period: jelly.QuotaPeriodMinute},
+		},
+	}
+	ctx := context.Background()
+	now := time.Now()
+	key := jelly.QuotaKey{Quota: "requests", UserID: uuid.New(), Period: jelly.QuotaPeriodMinute.Start(now)}
+
+	t.Run("usage is written to the backing repo on flush", func(t *testing.T) {
+		assert := assert.New(t)
+		backing := inmem.NewQuotaRepository()
+		qc := newQuotaCache(cfg, backing, logging.NoOpLogger{})
+
+		used, err := qc.Add(ctx, key, 3, 5)
+		assert.NoError(err)
+		assert.Equal(int64(3), used)
+
+		stored, _ := backing.Usage(ctx, key)
+		assert.Equal(int64(0), stored, "written before flush")
+
+		assert.NoError(qc.flush(ctx))
+		stored, _ = backing.Usage(ctx, key)
+		assert.Equal(int64(3), stored)
+
+		// a restarted server picks up where the last one left off
+		restarted := newQuotaCache(cfg, backing, logging.NoOpLogger{})
+		used, err = restarted.Add(ctx, key, 3, 5)
+		assert.ErrorIs(err, jelly.ErrQuotaExceeded)
+		assert.Equal(int64(3), used)
+	})
+
+	t.Run("stop writes pending usage", func(t *testing.T) {
+		assert := assert.New(t)
+		backing := inmem.NewQuotaRepository()
+		qc := newQuotaCache(cfg, backing, logging.NoOpLogger{})
+		qc.run(time.Hour)
+
+		_, err := qc.Add(ctx, key, 2, 5)
+		assert.NoError(err)
+		assert.NoError(qc.stop(ctx))
+
+		stored, _ := backing.Usage(ctx, key)
+		assert.Equal(int64(2), stored)
+	})
+
+	t.Run("usage of ended periods is evicted", func(t *testing.T) {
+		assert := assert.New(t)
+		qc := newQuotaCache(cfg, nil, logging.NoOpLogger{})
+
+		_, err := qc.Add(ctx, key, 1, 5)
+		assert.NoError(err)
+
+		qc.evict(now)
+		assert.Len(qc.entries, 1)
+
+		qc.evict(now.Add(2 * time.Minute))
+		assert.Empty(qc.entries)
+	})
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dekarrin/jelly"
+)
+
+// rateLimitSweepInterval is how often the buckets of clients that have not
+// made a request for long enough to have refilled are discarded.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter limits the rate of requests from each client with a token
+// bucket per client. Each bucket holds up to burst tokens and gains them at
+// rate per second; every request takes one.
+type rateLimiter struct {
+	cfg   jelly.RateLimitConfig
+	rate  float64
+	burst float64
+
+	mtx       sync.Mutex
+	buckets   map[string]*rateBucket
+	lastSweep time.Time
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time // when tokens was last brought up to date
+}
+
+func newRateLimiter(cfg jelly.RateLimitConfig) *rateLimiter {
+	cfg = cfg.FillDefaults()
+	period := time.Duration(cfg.PeriodMillis) * time.Millisecond
+
+	return &rateLimiter{
+		cfg:     cfg,
+		rate:    float64(cfg.Requests) / period.Seconds(),
+		burst:   float64(cfg.Burst),
+		buckets: map[string]*rateBucket{},
+	}
+}
+
+// allow takes a token from the bucket of client at time now. If there is none
+// to take, it returns false along with how long until there will be.
+func (rl *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+
+	if now.Sub(rl.lastSweep) >= rateLimitSweepInterval {
+		rl.sweep(now)
+	}
+
+	b := rl.buckets[client]
+	if b == nil {
+		b = &rateBucket{tokens: rl.burst, last: now}
+		rl.buckets[client] = b
+	} else {
+		b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep discards the buckets that would be full by now, as they are the same
+// as a new bucket. rl.mtx must be held by the caller.
+func (rl *rateLimiter) sweep(now time.Time) {
+	for client, b := range rl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.rate >= rl.burst {
+			delete(rl.buckets, client)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// middleware returns middleware that responds with an HTTP-429 to requests
+// from clients that are over the limit. Clients are identified by the host of
+// their remote address.
+func (rl *rateLimiter) middleware(sp jelly.ServiceProvider) jelly.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			client, _, err := net.SplitHostPort(req.RemoteAddr)
+			if err != nil {
+				client = req.RemoteAddr
+			}
+
+			if ok, retryAfter := rl.allow(client, time.Now()); !ok {
+				res := sp.TooManyRequests("Too many requests; try again later", retryAfter, "client %s is over the rate limit", client)
+				res.WriteResponse(w)
+				sp.LogResponse(req, res)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// rateLimitMiddleware returns middleware that limits the rate of requests
+// from each client as configured, or nil if there is no limit. The same
+// limiter is kept if the router is re-created. rs.mtx must be held by the
+// caller.
+func (rs *restServer) rateLimitMiddleware(sp jelly.ServiceProvider) jelly.Middleware {
+	if rs.cfg.Globals.RateLimit.Requests < 1 {
+		return nil
+	}
+	if rs.rateLimiter == nil {
+		rs.rateLimiter = newRateLimiter(rs.cfg.Globals.RateLimit)
+	}
+	return rs.rateLimiter.middleware(sp)
+}
+
+// apiRateLimitMiddleware returns middleware that limits the rate of requests
+// from each client to the named API as given in cfg, or nil if there is no
+// limit. The same limiter is kept if the router is re-created with the same
+// config. rs.mtx must be held by the caller.
+func (rs *restServer) apiRateLimitMiddleware(name string, cfg *jelly.RateLimitConfig, sp jelly.ServiceProvider) jelly.Middleware {
+	if cfg == nil || cfg.Requests < 1 {
+		delete(rs.apiRateLimiters, name)
+		return nil
+	}
+
+	rl := rs.apiRateLimiters[name]
+	if rl == nil || rl.cfg != cfg.FillDefaults() {
+		rl = newRateLimiter(*cfg)
+		if rs.apiRateLimiters == nil {
+			rs.apiRateLimiters = map[string]*rateLimiter{}
+		}
+		rs.apiRateLimiters[name] = rl
+	}
+	return rl.middleware(sp)
+}
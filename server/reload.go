@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/config"
+)
+
+// configCheckInterval is how often the config is checked for changes when
+// Globals.ReloadConfig is enabled. Kubernetes takes up to a minute to update a
+// mounted ConfigMap, so checking more often than this gains little.
+const configCheckInterval = 10 * time.Second
+
+// watchConfig checks the config at path for changes every interval until ctx
+// is done, and sends on the returned channel each time it changes. A change
+// that is not received before the next one is dropped.
+func watchConfig(ctx context.Context, path string, interval time.Duration, log jelly.Logger) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+
+	last, err := config.Fingerprint(path)
+	if err != nil {
+		log.Warnf("Check config for changes: %v", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			cur, err := config.Fingerprint(path)
+			if err != nil {
+				// possibly in the middle of an update; check again next time
+				log.Warnf("Check config for changes: %v", err)
+				continue
+			}
+			if cur == last {
+				continue
+			}
+			last = cur
+
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changed
+}
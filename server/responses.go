@@ -1,24 +1,50 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
 )
 
-func (em endpointCreator) Logger() jelly.Logger {
-	return em.log
+// defaultResponses is the default ResponseGenerator of endpoints. Its helper
+// methods, such as BadRequest and NotFound, create their Results with the
+// Response and Err methods of gen, which is the ResponseGenerator that replaces
+// it if one was set with SetResponseGenerator. This way, a replacement only
+// needs its own Err to change the body of every error response.
+type defaultResponses struct {
+	em  endpointCreator
+	gen jelly.ResponseGenerator
 }
 
-func (em endpointCreator) LogResponse(req *http.Request, r jelly.Result) {
-	em.log.LogResult(req, r)
+// generator returns the ResponseGenerator whose methods are used by the helper
+// methods of d.
+func (d *defaultResponses) generator() jelly.ResponseGenerator {
+	if d.gen != nil {
+		return d.gen
+	}
+	return d
+}
+
+func (d *defaultResponses) Logger() jelly.Logger {
+	return d.em.log
+}
+
+func (d *defaultResponses) LogResponse(req *http.Request, r jelly.Result) {
+	d.em.log.LogResult(req, r)
 }
 
-// if status is http.StatusNoContent, respObj will not be read and may be nil.
+// if status is http.StatusNoContent or http.StatusNotModified, respObj will not
+// be read and may be nil.
 // Otherwise, respObj MUST NOT be nil. If additional values are provided they
 // are given to internalMsg as a format string.
-func (em endpointCreator) Response(status int, respObj interface{}, internalMsg string, v ...interface{}) jelly.Result {
+func (d *defaultResponses) Response(status int, respObj interface{}, internalMsg string, v ...interface{}) jelly.Result {
 	msg := fmt.Sprintf(internalMsg, v...)
 	return jelly.Result{
 		IsJSON:      true,
@@ -31,7 +57,7 @@ func (em endpointCreator) Response(status int, respObj interface{}, internalMsg
 
 // If additional values are provided they are given to internalMsg as a format
 // string.
-func (em endpointCreator) Err(status int, userMsg, internalMsg string, v ...interface{}) jelly.Result {
+func (d *defaultResponses) Err(status int, userMsg, internalMsg string, v ...interface{}) jelly.Result {
 	msg := fmt.Sprintf(internalMsg, v...)
 	return jelly.Result{
 		IsJSON:      true,
@@ -45,7 +71,7 @@ func (em endpointCreator) Err(status int, userMsg, internalMsg string, v ...inte
 	}
 }
 
-func (em endpointCreator) Redirection(uri string) jelly.Result {
+func (d *defaultResponses) Redirection(uri string) jelly.Result {
 	msg := fmt.Sprintf("redirect -> %s", uri)
 	return jelly.Result{
 		Status:      http.StatusPermanentRedirect,
@@ -57,7 +83,7 @@ func (em endpointCreator) Redirection(uri string) jelly.Result {
 // TextErr is like jsonErr but it avoids JSON encoding of any kind and writes
 // the output as plain text. If additional values are provided they are given to
 // internalMsg as a format string.
-func (em endpointCreator) TextErr(status int, userMsg, internalMsg string, v ...interface{}) jelly.Result {
+func (d *defaultResponses) TextErr(status int, userMsg, internalMsg string, v ...interface{}) jelly.Result {
 	msg := fmt.Sprintf(internalMsg, v...)
 	return jelly.Result{
 		IsJSON:      false,
@@ -71,7 +97,7 @@ func (em endpointCreator) TextErr(status int, userMsg, internalMsg string, v ...
 // OK returns an endpointResult containing an HTTP-200 along with a more
 // detailed message (if desired; if none is provided it defaults to a generic
 // one) that is not displayed to the user.
-func (em endpointCreator) OK(respObj interface{}, internalMsg ...interface{}) jelly.Result {
+func (d *defaultResponses) OK(respObj interface{}, internalMsg ...interface{}) jelly.Result {
 	internalMsgFmt := "OK"
 	var msgArgs []interface{}
 	if len(internalMsg) >= 1 {
@@ -79,13 +105,13 @@ func (em endpointCreator) OK(respObj interface{}, internalMsg ...interface{}) je
 		msgArgs = internalMsg[1:]
 	}
 
-	return em.Response(http.StatusOK, respObj, internalMsgFmt, msgArgs...)
+	return d.generator().Response(http.StatusOK, respObj, internalMsgFmt, msgArgs...)
 }
 
 // NoContent returns an endpointResult containing an HTTP-204 along
 // with a more detailed message (if desired; if none is provided it defaults to
 // a generic one) that is not displayed to the user.
-func (em endpointCreator) NoContent(internalMsg ...interface{}) jelly.Result {
+func (d *defaultResponses) NoContent(internalMsg ...interface{}) jelly.Result {
 	internalMsgFmt := "no content"
 	var msgArgs []interface{}
 	if len(internalMsg) >= 1 {
@@ -93,13 +119,13 @@ func (em endpointCreator) NoContent(internalMsg ...interface{}) jelly.Result {
 		msgArgs = internalMsg[1:]
 	}
 
-	return em.Response(http.StatusNoContent, nil, internalMsgFmt, msgArgs...)
+	return d.generator().Response(http.StatusNoContent, nil, internalMsgFmt, msgArgs...)
 }
 
 // Created returns an endpointResult containing an HTTP-201 along
 // with a more detailed message (if desired; if none is provided it defaults to
 // a generic one) that is not displayed to the user.
-func (em endpointCreator) Created(respObj interface{}, internalMsg ...interface{}) jelly.Result {
+func (d *defaultResponses) Created(respObj interface{}, internalMsg ...interface{}) jelly.Result {
 	internalMsgFmt := "created"
 	var msgArgs []interface{}
 	if len(internalMsg) >= 1 {
@@ -107,13 +133,13 @@ func (em endpointCreator) Created(respObj interface{}, internalMsg ...interface{
 		msgArgs = internalMsg[1:]
 	}
 
-	return em.Response(http.StatusCreated, respObj, internalMsgFmt, msgArgs...)
+	return d.generator().Response(http.StatusCreated, respObj, internalMsgFmt, msgArgs...)
 }
 
 // Conflict returns an endpointResult containing an HTTP-409 along
 // with a more detailed message (if desired; if none is provided it defaults to
 // a generic one) that is not displayed to the user.
-func (em endpointCreator) Conflict(userMsg string, internalMsg ...interface{}) jelly.Result {
+func (d *defaultResponses) Conflict(userMsg string, internalMsg ...interface{}) jelly.Result {
 	internalMsgFmt := "conflict"
 	var msgArgs []interface{}
 	if len(internalMsg) >= 1 {
@@ -121,13 +147,27 @@ func (em endpointCreator) Conflict(userMsg string, internalMsg ...interface{}) j
 		msgArgs = internalMsg[1:]
 	}
 
-	return em.Err(http.StatusConflict, userMsg, internalMsgFmt, msgArgs...)
+	return d.generator().Err(http.StatusConflict, userMsg, internalMsgFmt, msgArgs...)
+}
+
+// PreconditionFailed returns an endpointResult containing an HTTP-412 along
+// with a more detailed message (if desired; if none is provided it defaults to
+// a generic one) that is not displayed to the user.
+func (d *defaultResponses) PreconditionFailed(userMsg string, internalMsg ...interface{}) jelly.Result {
+	internalMsgFmt := "precondition failed"
+	var msgArgs []interface{}
+	if len(internalMsg) >= 1 {
+		internalMsgFmt = internalMsg[0].(string)
+		msgArgs = internalMsg[1:]
+	}
+
+	return d.generator().Err(http.StatusPreconditionFailed, userMsg, internalMsgFmt, msgArgs...)
 }
 
 // BadRequest returns an endpointResult containing an HTTP-400 along
 // with a more detailed message (if desired; if none is provided it defaults to
 // a generic one) that is not displayed to the user.
-func (em endpointCreator) BadRequest(userMsg string, internalMsg ...interface{}) jelly.Result {
+func (d *defaultResponses) BadRequest(userMsg string, internalMsg ...interface{}) jelly.Result {
 	internalMsgFmt := "bad request"
 	var msgArgs []interface{}
 	if len(internalMsg) >= 1 {
@@ -135,13 +175,13 @@ func (em endpointCreator) BadRequest(userMsg string, internalMsg ...interface{})
 		msgArgs = internalMsg[1:]
 	}
 
-	return em.Err(http.StatusBadRequest, userMsg, internalMsgFmt, msgArgs...)
+	return d.generator().Err(http.StatusBadRequest, userMsg, internalMsgFmt, msgArgs...)
 }
 
 // MethodNotAllowed returns an endpointResult containing an HTTP-405 along
 // with a more detailed message (if desired; if none is provided it defaults to
 // a generic one) that is not displayed to the user.
-func (em endpointCreator) MethodNotAllowed(req *http.Request, internalMsg ...interface{}) jelly.Result {
+func (d *defaultResponses) MethodNotAllowed(req *http.Request, internalMsg ...interface{}) jelly.Result {
 	internalMsgFmt := "method not allowed"
 	var msgArgs []interface{}
 	if len(internalMsg) >= 1 {
@@ -151,13 +191,13 @@ func (em endpointCreator) MethodNotAllowed(req *http.Request, internalMsg ...int
 
 	userMsg := fmt.Sprintf("Method %s is not allowed for %s", req.Method, req.URL.Path)
 
-	return em.Err(http.StatusMethodNotAllowed, userMsg, internalMsgFmt, msgArgs...)
+	return d.generator().Err(http.StatusMethodNotAllowed, userMsg, internalMsgFmt, msgArgs...)
 }
 
 // NotFound returns an endpointResult containing an HTTP-404 response along
 // with a more detailed message (if desired; if none is provided it defaults to
 // a generic one) that is not displayed to the user.
-func (em endpointCreator) NotFound(internalMsg ...interface{}) jelly.Result {
+func (d *defaultResponses) NotFound(internalMsg ...interface{}) jelly.Result {
 	internalMsgFmt := "not found"
 	var msgArgs []interface{}
 	if len(internalMsg) >= 1 {
@@ -165,14 +205,14 @@ func (em endpointCreator) NotFound(internalMsg ...interface{}) jelly.Result {
 		msgArgs = internalMsg[1:]
 	}
 
-	return em.Err(http.StatusNotFound, "The requested resource was not found", internalMsgFmt, msgArgs...)
+	return d.generator().Err(http.StatusNotFound, "The requested resource was not found", internalMsgFmt, msgArgs...)
 }
 
 // Forbidden returns an endpointResult containing an HTTP-403 response.
 // internalMsg is a detailed error message  (if desired; if none is provided it
 // defaults to
 // a generic one) that is not displayed to the user.
-func (em endpointCreator) Forbidden(internalMsg ...interface{}) jelly.Result {
+func (d *defaultResponses) Forbidden(internalMsg ...interface{}) jelly.Result {
 	internalMsgFmt := "forbidden"
 	var msgArgs []interface{}
 	if len(internalMsg) >= 1 {
@@ -180,14 +220,14 @@ func (em endpointCreator) Forbidden(internalMsg ...interface{}) jelly.Result {
 		msgArgs = internalMsg[1:]
 	}
 
-	return em.Err(http.StatusForbidden, "You don't have permission to do that", internalMsgFmt, msgArgs...)
+	return d.generator().Err(http.StatusForbidden, "You don't have permission to do that", internalMsgFmt, msgArgs...)
 }
 
 // Unauthorized returns an endpointResult containing an HTTP-401 response
 // along with the proper WWW-Authenticate header. internalMsg is a detailed
 // error message  (if desired; if none is provided it defaults to
 // a generic one) that is not displayed to the user.
-func (em endpointCreator) Unauthorized(userMsg string, internalMsg ...interface{}) jelly.Result {
+func (d *defaultResponses) Unauthorized(userMsg string, internalMsg ...interface{}) jelly.Result {
 	internalMsgFmt := "unauthorized"
 	var msgArgs []interface{}
 	if len(internalMsg) >= 1 {
@@ -199,7 +239,7 @@ func (em endpointCreator) Unauthorized(userMsg string, internalMsg ...interface{
 		userMsg = "You are not authorized to do that"
 	}
 
-	return em.Err(http.StatusUnauthorized, userMsg, internalMsgFmt, msgArgs...).
+	return d.generator().Err(http.StatusUnauthorized, userMsg, internalMsgFmt, msgArgs...).
 		WithHeader("WWW-Authenticate", `Basic realm="TunaQuest server", charset="utf-8"`)
 }
 
@@ -208,7 +248,7 @@ func (em endpointCreator) Unauthorized(userMsg string, internalMsg ...interface{
 // user. If internalMsg is provided the first argument must be a string that is
 // the format string and any subsequent args are passed to Sprintf with the
 // first as the format string.
-func (em endpointCreator) InternalServerError(internalMsg ...interface{}) jelly.Result {
+func (d *defaultResponses) InternalServerError(internalMsg ...interface{}) jelly.Result {
 	internalMsgFmt := "internal server error"
 	var msgArgs []interface{}
 	if len(internalMsg) >= 1 {
@@ -216,22 +256,396 @@ func (em endpointCreator) InternalServerError(internalMsg ...interface{}) jelly.
 		msgArgs = internalMsg[1:]
 	}
 
-	return em.Err(http.StatusInternalServerError, "An internal server error occurred", internalMsgFmt, msgArgs...)
+	return d.generator().Err(http.StatusInternalServerError, "An internal server error occurred", internalMsgFmt, msgArgs...)
+}
+
+// Accepted returns an endpointResult containing an HTTP-202 along with a more
+// detailed message (if desired; if none is provided it defaults to a generic
+// one) that is not displayed to the user.
+func (d *defaultResponses) Accepted(respObj interface{}, internalMsg ...interface{}) jelly.Result {
+	internalMsgFmt := "accepted"
+	var msgArgs []interface{}
+	if len(internalMsg) >= 1 {
+		internalMsgFmt = internalMsg[0].(string)
+		msgArgs = internalMsg[1:]
+	}
+
+	return d.generator().Response(http.StatusAccepted, respObj, internalMsgFmt, msgArgs...)
+}
+
+// NotModified returns an endpointResult containing an HTTP-304 with no body
+// along with a more detailed message (if desired; if none is provided it
+// defaults to a generic one) that is not displayed to the user.
+func (d *defaultResponses) NotModified(internalMsg ...interface{}) jelly.Result {
+	internalMsgFmt := "not modified"
+	var msgArgs []interface{}
+	if len(internalMsg) >= 1 {
+		internalMsgFmt = internalMsg[0].(string)
+		msgArgs = internalMsg[1:]
+	}
+
+	return d.generator().Response(http.StatusNotModified, nil, internalMsgFmt, msgArgs...)
+}
+
+// PartialContent returns an endpointResult containing an HTTP-206 with the
+// Content-Range header set to contentRange, along with a more detailed message
+// (if desired; if none is provided it defaults to a generic one) that is not
+// displayed to the user.
+func (d *defaultResponses) PartialContent(respObj interface{}, contentRange string, internalMsg ...interface{}) jelly.Result {
+	internalMsgFmt := "partial content"
+	var msgArgs []interface{}
+	if len(internalMsg) >= 1 {
+		internalMsgFmt = internalMsg[0].(string)
+		msgArgs = internalMsg[1:]
+	}
+
+	r := d.generator().Response(http.StatusPartialContent, respObj, internalMsgFmt, msgArgs...)
+	if contentRange != "" {
+		r = r.WithHeader("Content-Range", contentRange)
+	}
+	return r
+}
+
+// MovedPermanently returns an endpointResult containing an HTTP-301 that
+// redirects to uri.
+func (d *defaultResponses) MovedPermanently(uri string) jelly.Result {
+	r := d.generator().Redirection(uri)
+	r.Status = http.StatusMovedPermanently
+	r.InternalMsg = fmt.Sprintf("moved permanently -> %s", uri)
+	return r
+}
+
+// PermanentRedirect returns an endpointResult containing an HTTP-308 that
+// redirects to uri.
+func (d *defaultResponses) PermanentRedirect(uri string) jelly.Result {
+	return d.generator().Redirection(uri)
+}
+
+// ConflictWithBody returns an endpointResult containing an HTTP-409 that
+// gives respObj, along with a more detailed message (if desired; if none is
+// provided it defaults to a generic one) that is not displayed to the user.
+func (d *defaultResponses) ConflictWithBody(respObj interface{}, internalMsg ...interface{}) jelly.Result {
+	internalMsgFmt := "conflict"
+	var msgArgs []interface{}
+	if len(internalMsg) >= 1 {
+		internalMsgFmt = internalMsg[0].(string)
+		msgArgs = internalMsg[1:]
+	}
+
+	r := d.generator().Response(http.StatusConflict, respObj, internalMsgFmt, msgArgs...)
+	r.IsErr = true
+	return r
+}
+
+// Gone returns an endpointResult containing an HTTP-410 response along with a
+// more detailed message (if desired; if none is provided it defaults to a
+// generic one) that is not displayed to the user.
+func (d *defaultResponses) Gone(internalMsg ...interface{}) jelly.Result {
+	internalMsgFmt := "gone"
+	var msgArgs []interface{}
+	if len(internalMsg) >= 1 {
+		internalMsgFmt = internalMsg[0].(string)
+		msgArgs = internalMsg[1:]
+	}
+
+	return d.generator().Err(http.StatusGone, "The requested resource is no longer available", internalMsgFmt, msgArgs...)
+}
+
+// UnprocessableEntity returns an endpointResult containing an HTTP-422 along
+// with a more detailed message (if desired; if none is provided it defaults to
+// a generic one) that is not displayed to the user.
+func (d *defaultResponses) UnprocessableEntity(userMsg string, internalMsg ...interface{}) jelly.Result {
+	internalMsgFmt := "unprocessable entity"
+	var msgArgs []interface{}
+	if len(internalMsg) >= 1 {
+		internalMsgFmt = internalMsg[0].(string)
+		msgArgs = internalMsg[1:]
+	}
+
+	return d.generator().Err(http.StatusUnprocessableEntity, userMsg, internalMsgFmt, msgArgs...)
+}
+
+// UnsupportedMediaType returns an endpointResult containing an HTTP-415 along
+// with a more detailed message (if desired; if none is provided it defaults to
+// a generic one) that is not displayed to the user.
+func (d *defaultResponses) UnsupportedMediaType(userMsg string, internalMsg ...interface{}) jelly.Result {
+	internalMsgFmt := "unsupported media type"
+	var msgArgs []interface{}
+	if len(internalMsg) >= 1 {
+		internalMsgFmt = internalMsg[0].(string)
+		msgArgs = internalMsg[1:]
+	}
+
+	if userMsg == "" {
+		userMsg = "The request body is not of a supported media type"
+	}
+
+	return d.generator().Err(http.StatusUnsupportedMediaType, userMsg, internalMsgFmt, msgArgs...)
+}
+
+// TooManyRequests returns an endpointResult containing an HTTP-429 with the
+// Retry-After header set to retryAfter if it is greater than 0, along with a
+// more detailed message (if desired; if none is provided it defaults to a
+// generic one) that is not displayed to the user.
+func (d *defaultResponses) TooManyRequests(userMsg string, retryAfter time.Duration, internalMsg ...interface{}) jelly.Result {
+	internalMsgFmt := "too many requests"
+	var msgArgs []interface{}
+	if len(internalMsg) >= 1 {
+		internalMsgFmt = internalMsg[0].(string)
+		msgArgs = internalMsg[1:]
+	}
+
+	if userMsg == "" {
+		userMsg = "Too many requests; try again later"
+	}
+
+	return withRetryAfter(d.generator().Err(http.StatusTooManyRequests, userMsg, internalMsgFmt, msgArgs...), retryAfter)
+}
+
+// ServiceUnavailable returns an endpointResult containing an HTTP-503 with the
+// Retry-After header set to retryAfter if it is greater than 0, along with a
+// more detailed message (if desired; if none is provided it defaults to a
+// generic one) that is not displayed to the user.
+func (d *defaultResponses) ServiceUnavailable(userMsg string, retryAfter time.Duration, internalMsg ...interface{}) jelly.Result {
+	internalMsgFmt := "service unavailable"
+	var msgArgs []interface{}
+	if len(internalMsg) >= 1 {
+		internalMsgFmt = internalMsg[0].(string)
+		msgArgs = internalMsg[1:]
+	}
+
+	if userMsg == "" {
+		userMsg = "The service is unavailable; try again later"
+	}
+
+	return withRetryAfter(d.generator().Err(http.StatusServiceUnavailable, userMsg, internalMsgFmt, msgArgs...), retryAfter)
+}
+
+// FromError returns an endpointResult for a request that failed with err,
+// whose status is given by jelly.ErrorStatus, along with a more detailed
+// message (if desired; if none is provided it defaults to the message of err
+// followed by its jelly.ErrorFields) that is not displayed to the user. Where
+// the user is shown a message, it is jelly.UserMessage of err.
+func (d *defaultResponses) FromError(err error, internalMsg ...interface{}) jelly.Result {
+	if len(internalMsg) < 1 {
+		internalMsg = []interface{}{"%s%s", err.Error(), formatErrorFields(jelly.ErrorFields(err))}
+	}
+	userMsg := jelly.UserMessage(err)
+
+	gen := d.generator()
+	switch status := jelly.ErrorStatus(err); status {
+	case http.StatusBadRequest:
+		return gen.BadRequest(userMsg, internalMsg...)
+	case http.StatusUnauthorized:
+		return gen.Unauthorized(userMsg, internalMsg...)
+	case http.StatusForbidden:
+		return gen.Forbidden(internalMsg...)
+	case http.StatusNotFound:
+		return gen.NotFound(internalMsg...)
+	case http.StatusConflict:
+		return gen.Conflict(userMsg, internalMsg...)
+	case http.StatusUnprocessableEntity:
+		r := gen.UnprocessableEntity(userMsg, internalMsg...)
+
+		var verr jelly.ValidationError
+		if errResp, ok := r.Resp.(jelly.ErrorResponse); ok && errors.As(err, &verr) {
+			errResp.Fields = verr.Fields
+			r.Resp = errResp
+		}
+		return r
+	case http.StatusTooManyRequests:
+		return gen.TooManyRequests("", 0, internalMsg...)
+	case http.StatusServiceUnavailable:
+		return gen.ServiceUnavailable("", 0, internalMsg...)
+	case http.StatusGatewayTimeout:
+		return gen.Err(status, "The request timed out", internalMsg[0].(string), internalMsg[1:]...)
+	default:
+		return gen.InternalServerError(internalMsg...)
+	}
+}
+
+// formatErrorFields returns fields formatted for appending to a log message,
+// such as " [id=8, op=update]", with the keys in sorted order. If there are no
+// fields, "" is returned.
+func formatErrorFields(fields map[string]interface{}) string {
+	if len(fields) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%v", k, fields[k])
+	}
+	return " [" + strings.Join(pairs, ", ") + "]"
+}
+
+// withRetryAfter returns r with the Retry-After header set to retryAfter,
+// rounded up to the second. If retryAfter is not greater than 0, r is returned
+// as-is.
+func withRetryAfter(r jelly.Result, retryAfter time.Duration) jelly.Result {
+	if retryAfter <= 0 {
+		return r
+	}
+	secs := int64((retryAfter + time.Second - 1) / time.Second)
+	return r.WithHeader("Retry-After", strconv.FormatInt(secs, 10))
+}
+
+// withResponses returns a copy of em whose ResponseGenerator methods are
+// given to the ResponseGenerator that gen creates, with em's default as its
+// base. If gen is nil, the default is used. It must be called after every
+// other field of em is set, as the base keeps a copy of them.
+func (em endpointCreator) withResponses(gen jelly.ResponseGeneratorFunc) endpointCreator {
+	em.resp = nil
+	if gen != nil {
+		base := &defaultResponses{em: em}
+		base.gen = gen(base)
+		em.resp = base.gen
+	}
+	return em
+}
+
+// responses returns the ResponseGenerator that the ResponseGenerator methods
+// of em are given to.
+func (em endpointCreator) responses() jelly.ResponseGenerator {
+	if em.resp != nil {
+		return em.resp
+	}
+	return &defaultResponses{em: em}
+}
+
+// NewResponseGenerator returns the ResponseGenerator that endpoints use by
+// default, for creating Results outside of a server, such as in unit tests of
+// endpoints. It has no envelope, hooks, or message catalog, and it logs
+// responses to log. If log is nil, responses are not logged.
+func NewResponseGenerator(log jelly.Logger) jelly.ResponseGenerator {
+	if log == nil {
+		log = logging.NoOpLogger{}
+	}
+	return &defaultResponses{em: endpointCreator{log: log}}
+}
+
+func (em endpointCreator) Logger() jelly.Logger {
+	return em.responses().Logger()
+}
+
+func (em endpointCreator) LogResponse(req *http.Request, r jelly.Result) {
+	em.responses().LogResponse(req, r)
+}
+
+func (em endpointCreator) Response(status int, respObj interface{}, internalMsg string, v ...interface{}) jelly.Result {
+	return em.responses().Response(status, respObj, internalMsg, v...)
+}
+
+func (em endpointCreator) Resource(status int, model interface{}, internalMsg string, v ...interface{}) jelly.Result {
+	return em.responses().Resource(status, model, internalMsg, v...)
+}
+
+func (em endpointCreator) Err(status int, userMsg, internalMsg string, v ...interface{}) jelly.Result {
+	return em.responses().Err(status, userMsg, internalMsg, v...)
+}
+
+func (em endpointCreator) Redirection(uri string) jelly.Result {
+	return em.responses().Redirection(uri)
+}
+
+func (em endpointCreator) TextErr(status int, userMsg, internalMsg string, v ...interface{}) jelly.Result {
+	return em.responses().TextErr(status, userMsg, internalMsg, v...)
+}
+
+func (em endpointCreator) OK(respObj interface{}, internalMsg ...interface{}) jelly.Result {
+	return em.responses().OK(respObj, internalMsg...)
+}
+
+func (em endpointCreator) NoContent(internalMsg ...interface{}) jelly.Result {
+	return em.responses().NoContent(internalMsg...)
+}
+
+func (em endpointCreator) Created(respObj interface{}, internalMsg ...interface{}) jelly.Result {
+	return em.responses().Created(respObj, internalMsg...)
+}
+
+func (em endpointCreator) Conflict(userMsg string, internalMsg ...interface{}) jelly.Result {
+	return em.responses().Conflict(userMsg, internalMsg...)
+}
+
+func (em endpointCreator) PreconditionFailed(userMsg string, internalMsg ...interface{}) jelly.Result {
+	return em.responses().PreconditionFailed(userMsg, internalMsg...)
+}
+
+func (em endpointCreator) BadRequest(userMsg string, internalMsg ...interface{}) jelly.Result {
+	return em.responses().BadRequest(userMsg, internalMsg...)
+}
+
+func (em endpointCreator) MethodNotAllowed(req *http.Request, internalMsg ...interface{}) jelly.Result {
+	return em.responses().MethodNotAllowed(req, internalMsg...)
+}
+
+func (em endpointCreator) NotFound(internalMsg ...interface{}) jelly.Result {
+	return em.responses().NotFound(internalMsg...)
+}
+
+func (em endpointCreator) Forbidden(internalMsg ...interface{}) jelly.Result {
+	return em.responses().Forbidden(internalMsg...)
+}
+
+func (em endpointCreator) Unauthorized(userMsg string, internalMsg ...interface{}) jelly.Result {
+	return em.responses().Unauthorized(userMsg, internalMsg...)
+}
+
+func (em endpointCreator) InternalServerError(internalMsg ...interface{}) jelly.Result {
+	return em.responses().InternalServerError(internalMsg...)
+}
+
+func (em endpointCreator) Accepted(respObj interface{}, internalMsg ...interface{}) jelly.Result {
+	return em.responses().Accepted(respObj, internalMsg...)
+}
+
+func (em endpointCreator) NotModified(internalMsg ...interface{}) jelly.Result {
+	return em.responses().NotModified(internalMsg...)
+}
+
+func (em endpointCreator) PartialContent(respObj interface{}, contentRange string, internalMsg ...interface{}) jelly.Result {
+	return em.responses().PartialContent(respObj, contentRange, internalMsg...)
+}
+
+func (em endpointCreator) MovedPermanently(uri string) jelly.Result {
+	return em.responses().MovedPermanently(uri)
+}
+
+func (em endpointCreator) PermanentRedirect(uri string) jelly.Result {
+	return em.responses().PermanentRedirect(uri)
+}
+
+func (em endpointCreator) ConflictWithBody(respObj interface{}, internalMsg ...interface{}) jelly.Result {
+	return em.responses().ConflictWithBody(respObj, internalMsg...)
+}
+
+func (em endpointCreator) Gone(internalMsg ...interface{}) jelly.Result {
+	return em.responses().Gone(internalMsg...)
+}
+
+func (em endpointCreator) UnprocessableEntity(userMsg string, internalMsg ...interface{}) jelly.Result {
+	return em.responses().UnprocessableEntity(userMsg, internalMsg...)
 }
 
-/*
-OK(respObj interface{}, internalMsg ...interface{}) jelly.Result
-NoContent(internalMsg ...interface{}) jelly.Result
-Created(respObj interface{}, internalMsg ...interface{}) jelly.Result
-Conflict(userMsg string, internalMsg ...interface{}) jelly.Result
-BadRequest(userMsg string, internalMsg ...interface{}) jelly.Result
-MethodNotAllowed(req *http.Request, internalMsg ...interface{}) jelly.Result
-NotFound(internalMsg ...interface{}) jelly.Result
-Forbidden(internalMsg ...interface{}) jelly.Result
-Unauthorized(userMsg string, internalMsg ...interface{}) jelly.Result
-InternalServerError(internalMsg ...interface{}) jelly.Result
-Redirection(uri string) jelly.Result
-Response(status int, respObj interface{}, internalMsg string, v ...interface{}) jelly.Result
-Err(status int, userMsg, internalMsg string, v ...interface{}) jelly.Result
-TextErr(status int, userMsg, internalMsg string, v ...interface{}) jelly.Result
-*/
+func (em endpointCreator) UnsupportedMediaType(userMsg string, internalMsg ...interface{}) jelly.Result {
+	return em.responses().UnsupportedMediaType(userMsg, internalMsg...)
+}
+
+func (em endpointCreator) TooManyRequests(userMsg string, retryAfter time.Duration, internalMsg ...interface{}) jelly.Result {
+	return em.responses().TooManyRequests(userMsg, retryAfter, internalMsg...)
+}
+
+func (em endpointCreator) ServiceUnavailable(userMsg string, retryAfter time.Duration, internalMsg ...interface{}) jelly.Result {
+	return em.responses().ServiceUnavailable(userMsg, retryAfter, internalMsg...)
+}
+
+func (em endpointCreator) FromError(err error, internalMsg ...interface{}) jelly.Result {
+	return em.responses().FromError(err, internalMsg...)
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/dekarrin/jelly/internal/middle"
+	"github.com/stretchr/testify/assert"
+)
+
+// codedResponses gives errors a code and message instead of the default
+// ErrorResponse.
+type codedResponses struct {
+	jelly.ResponseGenerator
+}
+
+func (cr codedResponses) Err(status int, userMsg, internalMsg string, v ...interface{}) jelly.Result {
+	r := cr.ResponseGenerator.Err(status, userMsg, internalMsg, v...)
+	r.Resp = map[string]interface{}{
+		"code":    fmt.Sprintf("E%d", status),
+		"message": userMsg,
+	}
+	return r
+}
+
+func Test_endpointCreator_withResponses(t *testing.T) {
+	testCases := []struct {
+		name         string
+		gen          jelly.ResponseGeneratorFunc
+		ep           func(em endpointCreator) jelly.Result
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			name: "default",
+			ep: func(em endpointCreator) jelly.Result {
+				return em.BadRequest("nope")
+			},
+			expectStatus: http.StatusBadRequest,
+			expectBody:   `{"error":"nope","status":400}`,
+		},
+		{
+			name: "replaced Err is used by helpers",
+			gen: func(base jelly.ResponseGenerator) jelly.ResponseGenerator {
+				return codedResponses{base}
+			},
+			ep: func(em endpointCreator) jelly.Result {
+				return em.NotFound()
+			},
+			expectStatus: http.StatusNotFound,
+			expectBody:   `{"code":"E404","message":"The requested resource was not found"}`,
+		},
+		{
+			name: "replaced Err is used directly",
+			gen: func(base jelly.ResponseGenerator) jelly.ResponseGenerator {
+				return codedResponses{base}
+			},
+			ep: func(em endpointCreator) jelly.Result {
+				return em.Err(http.StatusTeapot, "short and stout", "teapot")
+			},
+			expectStatus: http.StatusTeapot,
+			expectBody:   `{"code":"E418","message":"short and stout"}`,
+		},
+		{
+			name: "success responses are unchanged",
+			gen: func(base jelly.ResponseGenerator) jelly.ResponseGenerator {
+				return codedResponses{base}
+			},
+			ep: func(em endpointCreator) jelly.Result {
+				return em.OK(map[string]string{"name": "Terezi"})
+			},
+			expectStatus: http.StatusOK,
+			expectBody:   `{"name":"Terezi"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			em := endpointCreator{mid: &middle.Provider{}, log: logging.NoOpLogger{}}
+			em = em.withResponses(tc.gen)
+
+			handler := em.Endpoint(func(req *http.Request) jelly.Result {
+				return tc.ep(em)
+			})
+
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(tc.expectStatus, w.Code)
+			assert.JSONEq(tc.expectBody, w.Body.String())
+		})
+	}
+}
+
+func Test_defaultResponses_helpers(t *testing.T) {
+	em := endpointCreator{log: logging.NoOpLogger{}}
+
+	testCases := []struct {
+		name          string
+		result        jelly.Result
+		expectStatus  int
+		expectHeaders map[string]string
+		expectBody    string
+	}{
+		{
+			name:         "accepted",
+			result:       em.Accepted(map[string]string{"job": "1"}),
+			expectStatus: http.StatusAccepted,
+			expectBody:   `{"job":"1"}`,
+		},
+		{
+			name:          "partial content",
+			result:        em.PartialContent([]int{1, 2}, "items 0-1/5"),
+			expectStatus:  http.StatusPartialContent,
+			expectHeaders: map[string]string{"Content-Range": "items 0-1/5"},
+			expectBody:    `[1,2]`,
+		},
+		{
+			name:          "moved permanently",
+			result:        em.MovedPermanently("/new"),
+			expectStatus:  http.StatusMovedPermanently,
+			expectHeaders: map[string]string{"Location": "/new"},
+		},
+		{
+			name:          "permanent redirect",
+			result:        em.PermanentRedirect("/new"),
+			expectStatus:  http.StatusPermanentRedirect,
+			expectHeaders: map[string]string{"Location": "/new"},
+		},
+		{
+			name:         "conflict with body",
+			result:       em.ConflictWithBody(map[string]int{"version": 3}),
+			expectStatus: http.StatusConflict,
+			expectBody:   `{"version":3}`,
+		},
+		{
+			name:         "gone",
+			result:       em.Gone(),
+			expectStatus: http.StatusGone,
+			expectBody:   `{"error":"The requested resource is no longer available","status":410}`,
+		},
+		{
+			name:         "unprocessable entity",
+			result:       em.UnprocessableEntity("name: must not be empty"),
+			expectStatus: http.StatusUnprocessableEntity,
+			expectBody:   `{"error":"name: must not be empty","status":422}`,
+		},
+		{
+			name:          "too many requests rounds retry up",
+			result:        em.TooManyRequests("", 1500*time.Millisecond),
+			expectStatus:  http.StatusTooManyRequests,
+			expectHeaders: map[string]string{"Retry-After": "2"},
+			expectBody:    `{"error":"Too many requests; try again later","status":429}`,
+		},
+		{
+			name:          "service unavailable without retry",
+			result:        em.ServiceUnavailable("down for maintenance", 0),
+			expectStatus:  http.StatusServiceUnavailable,
+			expectHeaders: map[string]string{"Retry-After": ""},
+			expectBody:    `{"error":"down for maintenance","status":503}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			w := httptest.NewRecorder()
+			tc.result.WriteResponse(w)
+
+			assert.Equal(tc.expectStatus, w.Code)
+			for k, v := range tc.expectHeaders {
+				assert.Equal(v, w.Header().Get(k), "header %s", k)
+			}
+			if tc.expectBody != "" {
+				assert.JSONEq(tc.expectBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_defaultResponses_FromError(t *testing.T) {
+	em := endpointCreator{log: logging.NoOpLogger{}}
+
+	var verr jelly.ValidationError
+	verr.Add("name", "must not be empty")
+	verr.Add("age", "must be at least %d", 0)
+
+	testCases := []struct {
+		name         string
+		err          error
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			name:         "bad argument",
+			err:          jelly.NewError("name is required", jelly.ErrBadArgument),
+			expectStatus: http.StatusBadRequest,
+			expectBody:   `{"error":"name is required: one or more of the arguments is invalid","status":400}`,
+		},
+		{
+			name:         "not found is not shown",
+			err:          fmt.Errorf("get user 8: %w", jelly.ErrNotFound),
+			expectStatus: http.StatusNotFound,
+			expectBody:   `{"error":"The requested resource was not found","status":404}`,
+		},
+		{
+			name:         "validation gives fields",
+			err:          fmt.Errorf("create user: %w", verr),
+			expectStatus: http.StatusUnprocessableEntity,
+			expectBody: `{"error":"create user: name: must not be empty; age: must be at least 0","status":422,"fields":[
+				{"field":"name","message":"must not be empty"},
+				{"field":"age","message":"must be at least 0"}
+			]}`,
+		},
+		{
+			name:         "user message is shown instead of internal one",
+			err:          jelly.NewUserError("That name is taken", "insert user: unique constraint on users.name", jelly.ErrAlreadyExists),
+			expectStatus: http.StatusConflict,
+			expectBody:   `{"error":"That name is taken","status":409}`,
+		},
+		{
+			name:         "timeout",
+			err:          jelly.ErrTimeout,
+			expectStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:         "unknown error is not shown",
+			err:          fmt.Errorf("connect to db: refused"),
+			expectStatus: http.StatusInternalServerError,
+			expectBody:   `{"error":"An internal server error occurred","status":500}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			w := httptest.NewRecorder()
+			em.FromError(tc.err).WriteResponse(w)
+
+			assert.Equal(tc.expectStatus, w.Code)
+			if tc.expectBody != "" {
+				assert.JSONEq(tc.expectBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_formatErrorFields(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", formatErrorFields(nil))
+	assert.Equal(" [id=8, op=update]", formatErrorFields(map[string]interface{}{"op": "update", "id": 8}))
+}
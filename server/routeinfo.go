@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/middle"
+)
+
+// endpointProbeKey is the context key that marks a request as a probe for the
+// Override of an endpoint. An endpoint created by endpointCreator.Endpoint
+// that is given a probe records its Override in it instead of responding.
+type endpointProbeKey struct{}
+
+type endpointProbe struct {
+	override jelly.Override
+	found    bool
+}
+
+// endpointFuncName is the name of the function that endpointCreator.Endpoint
+// returns. Only handlers with this name are probed, so that no other handler
+// is ever called outside of a real request.
+var endpointFuncName = funcName(endpointCreator{}.Endpoint(nil))
+
+// closureSuffixRegex matches the suffix that the Go runtime gives the name of
+// a function literal, such as ".func1" or ".func2.1".
+var closureSuffixRegex = regexp.MustCompile(`(\.func\d+)?(\.\d+)*$`)
+
+// funcName returns the name of fn, which must be a func. It is the empty
+// string if the name cannot be determined.
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return ""
+	}
+	return f.Name()
+}
+
+// describeEndpoint returns the Override that h was created with by
+// endpointCreator.Endpoint. ok is false if h was not created by it.
+func describeEndpoint(h http.Handler) (over jelly.Override, ok bool) {
+	if funcName(h) != endpointFuncName {
+		return jelly.Override{}, false
+	}
+
+	probe := &endpointProbe{}
+	ctx := context.WithValue(context.Background(), endpointProbeKey{}, probe)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	if err != nil {
+		return jelly.Override{}, false
+	}
+	h.ServeHTTP(nil, req)
+
+	return probe.override, probe.found
+}
+
+// describeMiddleware sets the auth requirement and middleware names of ri
+// from mws, the middleware applied to its route. Each middleware is applied to
+// a handler that is never called in order to find out whether it is auth
+// middleware.
+func describeMiddleware(ri *jelly.RouteInfo, mws []func(http.Handler) http.Handler) {
+	optional := false
+	for _, mw := range mws {
+		if required, isAuth := middle.AuthRequirement(mw(http.NotFoundHandler())); isAuth {
+			if required {
+				ri.Middleware = append(ri.Middleware, "RequiredAuth")
+				ri.AuthRequired = true
+			} else {
+				ri.Middleware = append(ri.Middleware, "OptionalAuth")
+				optional = true
+			}
+			continue
+		}
+
+		name := closureSuffixRegex.ReplaceAllString(funcName(mw), "")
+		if slash := strings.LastIndex(name, "/"); slash >= 0 {
+			name = name[slash+1:]
+		}
+		ri.Middleware = append(ri.Middleware, name)
+	}
+
+	ri.AuthOptional = optional && !ri.AuthRequired
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+)
+
+// routeStatsSamples is the number of the most recent latencies of each route
+// that its percentiles are calculated from.
+const routeStatsSamples = 1024
+
+// routeStatsRegistry holds the stats of every route that has been requested,
+// keyed by method and then by route pattern.
+type routeStatsRegistry struct {
+	mtx    sync.Mutex
+	routes map[string]map[string]*routeStats
+}
+
+// routeStats is the stats of a single route. Latencies are kept in a ring
+// buffer of the most recent samples.
+type routeStats struct {
+	requests  int64
+	errors    int64
+	bytes     int64
+	metrics   jelly.ResponseMetrics // totals over all requests
+	latencies []time.Duration
+	next      int
+}
+
+func newRouteStatsRegistry() *routeStatsRegistry {
+	return &routeStatsRegistry{routes: map[string]map[string]*routeStats{}}
+}
+
+func (reg *routeStatsRegistry) record(method, pattern string, status int, latency time.Duration, bytes int64, m jelly.ResponseMetrics) {
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+
+	byPattern, ok := reg.routes[method]
+	if !ok {
+		byPattern = map[string]*routeStats{}
+		reg.routes[method] = byPattern
+	}
+	st, ok := byPattern[pattern]
+	if !ok {
+		st = &routeStats{}
+		byPattern[pattern] = st
+	}
+
+	st.requests++
+	if status >= 500 {
+		st.errors++
+	}
+	st.bytes += bytes
+	st.metrics.Handler += m.Handler
+	st.metrics.Marshal += m.Marshal
+	st.metrics.Bytes += m.Bytes
+	if len(st.latencies) < routeStatsSamples {
+		st.latencies = append(st.latencies, latency)
+	} else {
+		st.latencies[st.next] = latency
+		st.next = (st.next + 1) % routeStatsSamples
+	}
+}
+
+// get returns the stats of the route with the given method and pattern. Routes
+// that have not been requested have zero stats.
+func (reg *routeStatsRegistry) get(method, pattern string) jelly.RouteStats {
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+
+	st, ok := reg.routes[method][routeStatsPattern(pattern)]
+	if !ok {
+		return jelly.RouteStats{}
+	}
+
+	sorted := make([]time.Duration, len(st.latencies))
+	copy(sorted, st.latencies)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	return jelly.RouteStats{
+		Requests: st.requests,
+		Errors:   st.errors,
+		P50:      percentile(sorted, 50),
+		P95:      percentile(sorted, 95),
+
+		Bytes:             st.bytes,
+		UncompressedBytes: st.metrics.Bytes,
+		HandlerTime:       st.metrics.Handler,
+		MarshalTime:       st.metrics.Marshal,
+	}
+}
+
+// percentile returns the pth percentile of sorted using the nearest-rank
+// method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// formatRouteStats gives st in the format used by RoutesIndex.
+func formatRouteStats(st jelly.RouteStats) string {
+	var avgBytes int64
+	if st.Requests > 0 {
+		avgBytes = st.Bytes / st.Requests
+	}
+	return fmt.Sprintf("%d req, %.1f%% err, p50 %s, p95 %s, avg %d B", st.Requests, st.ErrorRate()*100, st.P50, st.P95, avgBytes)
+}
+
+// useRouteStats adds middleware to r that records the stats of every request
+// to a route if route stats are enabled. It must be added to the root router
+// so that the complete route pattern is known once the request is served.
+// rs.mtx must be held by the caller.
+func (rs *restServer) useRouteStats(r chi.Router) {
+	if rs.stats == nil {
+		return
+	}
+
+	stats := rs.stats
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			ww := newMeasuredWriter(w, req.ProtoMajor)
+
+			next.ServeHTTP(ww, req)
+
+			rctx := chi.RouteContext(req.Context())
+			if rctx == nil {
+				return
+			}
+			pattern := rctx.RoutePattern()
+			if pattern == "" {
+				// did not match any route
+				return
+			}
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			stats.record(req.Method, routeStatsPattern(pattern), status, time.Since(start), int64(ww.BytesWritten()), ww.metrics)
+		})
+	})
+}
+
+// routeStatsPattern normalizes a route pattern so that the patterns given by
+// chi.Walk match those from a request's routing context, which never have a
+// trailing slash.
+func routeStatsPattern(pattern string) string {
+	if pattern != "/" {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	return pattern
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/dekarrin/jelly"
+)
+
+// Run serves until ctx is done or a signal is received, then shuts down. See
+// jelly.RESTServer.Run.
+func (rs *restServer) Run(ctx context.Context) int {
+	rs.checkCreatedViaNew()
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	restartSigs := make(chan os.Signal, 1)
+	if rs.cfg.Globals.HotRestart {
+		if restartSignal == nil {
+			rs.log.Warnf("hot_restart is enabled but is not supported on this platform")
+		} else {
+			signal.Notify(restartSigs, restartSignal)
+			defer signal.Stop(restartSigs)
+		}
+	}
+
+	var configChanged <-chan struct{}
+	if rs.cfg.Globals.ReloadConfig && restartSignal != nil {
+		if rs.cfg.Path == "" {
+			rs.log.Warnf("reload_config is enabled but config was not loaded from a file")
+		} else {
+			watchCtx, stopWatching := context.WithCancel(ctx)
+			defer stopWatching()
+			configChanged = watchConfig(watchCtx, rs.cfg.Path, configCheckInterval, rs.log)
+		}
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- rs.ServeForever()
+	}()
+
+	rs.log.Infof("Starting server; send SIGINT or SIGTERM to stop")
+
+waitLoop:
+	for {
+		select {
+		case err := <-serveErr:
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				rs.log.Errorf("Server encountered a problem: %v", err)
+				var se *jelly.StartupError
+				if errors.As(err, &se) {
+					rs.log.Errorf("Startup report:\n%s", se.Report)
+				}
+				return jelly.ExitError
+			}
+			return jelly.ExitSuccess
+		case sig := <-sigs:
+			rs.log.Infof("%v received; shutting down server (signal again to exit immediately)...", sig)
+			break waitLoop
+		case <-ctx.Done():
+			rs.log.Info("Shutting down server...")
+			break waitLoop
+		case sig := <-restartSigs:
+			rs.log.Infof("%v received; starting new process for hot restart...", sig)
+			if err := rs.handOff(); err != nil {
+				rs.log.Errorf("Hot restart failed; continuing to serve: %v", err)
+				continue
+			}
+			rs.log.Info("New process is ready; shutting down server...")
+			break waitLoop
+		case <-configChanged:
+			rs.log.Infof("Config at %s changed; starting new process to reload it...", rs.cfg.Path)
+			if err := rs.handOff(); err != nil {
+				rs.log.Errorf("Config reload failed; continuing to serve with current config: %v", err)
+				continue
+			}
+			rs.log.Info("New process is ready; shutting down server...")
+			break waitLoop
+		}
+	}
+
+	// a second signal means the user does not want to wait
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case sig := <-sigs:
+			rs.log.Warnf("%v received again; exiting immediately", sig)
+			os.Exit(jelly.ExitInterrupt)
+		case <-done:
+		}
+	}()
+
+	timeout := time.Duration(rs.cfg.Globals.FillDefaults().ShutdownTimeoutMillis) * time.Millisecond
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := rs.Shutdown(shutdownCtx); err != nil {
+		rs.log.Errorf("Server shutdown failed: %v", err)
+		return jelly.ExitError
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		rs.log.Errorf("Server encountered a problem: %v", err)
+		return jelly.ExitError
+	}
+
+	rs.log.Info("Server shutdown complete")
+	return jelly.ExitSuccess
+}
+
+// Run creates a server from conf, adds apis to it in order of their names, and
+// then runs it with RESTServer.Run. It returns the exit code that the program
+// should exit with; if the server cannot be created, the error is logged to
+// stderr along with the report of each phase of startup up to the one that
+// failed, and ExitError is returned. If an API cannot be added, the server is
+// shut down first so that the APIs added before it release their DBs.
+//
+// Run is a convenience for programs whose main function only needs to start
+// the server; programs that need to do more with the server should create it
+// with NewServer and call its Run method.
+func (env *Environment) Run(ctx context.Context, conf *jelly.Config, apis map[string]jelly.API) int {
+	srv, err := env.NewServer(conf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: create server: %v\n", err)
+		printStartupReport(os.Stderr, err)
+		return jelly.ExitError
+	}
+
+	names := make([]string, 0, len(apis))
+	for name := range apis {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := srv.Add(name, apis[name]); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: add %s API: %v\n", name, err)
+			printStartupReport(os.Stderr, err)
+
+			// the APIs that were added must still release their DBs. a server
+			// can only be shut down once it is in use, which getting its
+			// Handler counts as.
+			srv.Handler()
+			timeout := time.Duration(srv.Config().Globals.FillDefaults().ShutdownTimeoutMillis) * time.Millisecond
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: shut down server: %v\n", err)
+			}
+			return jelly.ExitError
+		}
+	}
+
+	return srv.Run(ctx)
+}
+
+// printStartupReport writes the startup report of err to w if it is a
+// *jelly.StartupError.
+func printStartupReport(w io.Writer, err error) {
+	var se *jelly.StartupError
+	if errors.As(err, &se) && len(se.Report.Phases) > 0 {
+		fmt.Fprintf(w, "Startup report:\n%s\n", se.Report)
+	}
+}
+
+// handOff passes the server's listener to a new instance of the program. See
+// Globals.HotRestart.
+func (rs *restServer) handOff() error {
+	rs.mtx.Lock()
+	ln := rs.listener
+	rs.mtx.Unlock()
+
+	if ln == nil {
+		return fmt.Errorf("server is not listening")
+	}
+	return handOff(ln)
+}
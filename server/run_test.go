@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingAPI is an API whose Init always fails.
+type failingAPI struct{ helloAPI }
+
+func (failingAPI) Init(jelly.Bundle) error {
+	return errors.New("not ready")
+}
+
+func Test_Environment_Run_addFails(t *testing.T) {
+	assert := assert.New(t)
+	var inits, shutdowns int
+
+	env := &Environment{}
+	cfg := jelly.Config{
+		APIs: map[string]jelly.APIConfig{
+			"added":  (&jelly.CommonConfig{Name: "added", Enabled: true, Base: "/added"}).FillDefaults(),
+			"broken": (&jelly.CommonConfig{Name: "broken", Enabled: true, Base: "/broken"}).FillDefaults(),
+		},
+	}
+	apis := map[string]jelly.API{
+		"added":  toggledAPI{inits: &inits, shutdowns: &shutdowns},
+		"broken": failingAPI{},
+	}
+
+	code := env.Run(context.Background(), &cfg, apis)
+
+	assert.Equal(jelly.ExitError, code)
+	assert.Equal(1, inits)
+	assert.Equal(1, shutdowns, "API added before the failure was not shut down")
+}
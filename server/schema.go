@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+)
+
+// RegisterSchema registers the schema of models of the same Go type as model,
+// which may be a value or a pointer to one, under the given name, so that it
+// can be used by every API on servers created from the Environment.
+// jsonSchema is the JSON Schema of the model decoded into a map; if nil, one
+// is generated from the Go type with jelly.GenerateJSONSchema. It is an error
+// to register the same name or the same type twice.
+//
+// Registered schemas are used to validate the request bodies of endpoints
+// that give one in jelly.Override.Schema, and to reject the selection of
+// fields that a model does not have in endpoints that support
+// jelly.Override.Fields.
+func (env *Environment) RegisterSchema(name string, model interface{}, jsonSchema map[string]interface{}) error {
+	env.initDefaults()
+	return env.schemas.Register(name, model, jsonSchema)
+}
+
+// Schemas returns the schemas that have been registered with RegisterSchema,
+// such as for generating documentation of the models that APIs use.
+func (env *Environment) Schemas() *jelly.SchemaRegistry {
+	env.initDefaults()
+	return env.schemas
+}
+
+// checkSchema returns an error Result if the body of req does not conform to
+// the named schema. If it does, the zero-value Result is returned and the
+// body of req can still be read.
+func (em endpointCreator) checkSchema(req *http.Request, name string) jelly.Result {
+	schema, ok := em.schemas.Get(name)
+	if !ok {
+		return em.InternalServerError("endpoint uses schema %q, which is not registered", name)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return em.BadRequest("could not read request body", "read request body: %v", err)
+	}
+
+	if err := schema.ValidateJSON(body); err != nil {
+		if errors.Is(err, jelly.ErrBodyUnmarshal) {
+			return em.BadRequest("malformed JSON in request", err.Error())
+		}
+		return em.BadRequest(jelly.UserMessage(err), err.Error())
+	}
+	return jelly.Result{}
+}
+
+// checkFields returns an error Result if any of the fields selected for every
+// type in fields is not a property of the schema registered for the model
+// that is given in r. If the model has no registered schema, or every field
+// is a property, the zero-value Result is returned.
+func (em endpointCreator) checkFields(r jelly.Result, fields map[string][]string) jelly.Result {
+	model := r.Resp
+	if v := reflect.ValueOf(model); v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		model = reflect.Zero(v.Type().Elem()).Interface()
+	}
+
+	schema, ok := em.schemas.ForType(model)
+	if !ok {
+		return jelly.Result{}
+	}
+
+	props := map[string]bool{}
+	for _, p := range schema.Properties() {
+		props[p] = true
+	}
+
+	var unknown []string
+	for _, f := range fields[""] {
+		if !props[f] {
+			unknown = append(unknown, f)
+		}
+	}
+	if len(unknown) > 0 {
+		return em.BadRequest(schema.Name+" does not have field(s) "+strings.Join(unknown, ", "), "unknown fields %q selected for schema %q", unknown, schema.Name)
+	}
+	return jelly.Result{}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/dekarrin/jelly/internal/middle"
+	"github.com/stretchr/testify/assert"
+)
+
+type schemaThing struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+func Test_endpointCreator_Endpoint_schema(t *testing.T) {
+	env := &Environment{}
+	err := env.RegisterSchema("Thing", schemaThing{}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	testCases := []struct {
+		name         string
+		override     jelly.Override
+		body         string
+		query        string
+		expectStatus int
+		expectCalled bool
+	}{
+		{
+			name:         "valid body",
+			override:     jelly.Override{Schema: "Thing"},
+			body:         `{"name": "Pyralspite", "color": "red"}`,
+			expectStatus: http.StatusOK,
+			expectCalled: true,
+		},
+		{
+			name:         "invalid body",
+			override:     jelly.Override{Schema: "Thing"},
+			body:         `{"name": 8}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "unregistered schema",
+			override:     jelly.Override{Schema: "Nope"},
+			body:         `{}`,
+			expectStatus: http.StatusInternalServerError,
+		},
+		{
+			name:         "known fields",
+			override:     jelly.Override{Fields: true},
+			query:        "?fields=name",
+			expectStatus: http.StatusOK,
+			expectCalled: true,
+		},
+		{
+			name:         "unknown fields",
+			override:     jelly.Override{Fields: true},
+			query:        "?fields=name,size",
+			expectStatus: http.StatusBadRequest,
+			expectCalled: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			em := endpointCreator{mid: &middle.Provider{}, log: logging.NoOpLogger{}, schemas: env.Schemas()}
+
+			called := false
+			handler := em.Endpoint(func(req *http.Request) jelly.Result {
+				called = true
+
+				// the body can still be read by the endpoint
+				var thing schemaThing
+				if tc.body != "" {
+					if err := jelly.ParseJSONRequest(req, &thing); err != nil {
+						return em.BadRequest(err.Error())
+					}
+				}
+				return em.OK(schemaThing{Name: "Pyralspite", Color: "red"})
+			}, tc.override)
+
+			req := httptest.NewRequest(http.MethodPost, "/things"+tc.query, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			assert.Equal(tc.expectStatus, w.Code)
+			assert.Equal(tc.expectCalled, called)
+		})
+	}
+}
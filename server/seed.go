@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/dekarrin/jelly"
+)
+
+// registeredSeed is a seed function registered with an Environment.
+type registeredSeed struct {
+	profile string
+	fn      jelly.SeedFunc
+}
+
+// RegisterSeed registers a seed function for the API with the given name,
+// which is run when a server that has the API enabled is seeded with
+// RESTServer.Seed or Seed. If profile is not empty, the seed function is only
+// run by servers whose configured profile matches it; otherwise, it is run in
+// every profile. Seed functions must be idempotent; see jelly.SeedFunc.
+func (env *Environment) RegisterSeed(api, profile string, fn jelly.SeedFunc) error {
+	env.initDefaults()
+
+	if fn == nil {
+		return fmt.Errorf("seed function cannot be nil")
+	}
+
+	name := strings.ToLower(api)
+	env.seeds[name] = append(env.seeds[name], registeredSeed{profile: profile, fn: fn})
+	return nil
+}
+
+// Seed seeds every server that has been created with NewServer in env, in the
+// order they were created. See RESTServer.Seed.
+func (env *Environment) Seed(ctx context.Context) error {
+	env.initDefaults()
+
+	for _, rs := range env.servers {
+		if err := rs.Seed(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Seed runs the registered seed functions of the server's APIs. See
+// jelly.RESTServer.Seed.
+func (rs *restServer) Seed(ctx context.Context) error {
+	rs.checkCreatedViaNew()
+
+	if rs.dryRun {
+		return errDryRun
+	}
+
+	if rs.env == nil {
+		return nil
+	}
+
+	rs.mtx.Lock()
+	apiNames := make([]string, len(rs.initOrder))
+	copy(apiNames, rs.initOrder)
+	bundles := make(map[string]jelly.Bundle, len(rs.apiBundles))
+	for name, b := range rs.apiBundles {
+		bundles[name] = b
+	}
+	rs.mtx.Unlock()
+
+	profile := rs.cfg.Globals.Profile
+	for _, name := range apiNames {
+		b, ok := bundles[name]
+		if !ok {
+			// not enabled
+			continue
+		}
+
+		var count int
+		for _, s := range rs.env.seeds[name] {
+			if s.profile != "" && s.profile != profile {
+				continue
+			}
+			if err := s.fn(ctx, b); err != nil {
+				return fmt.Errorf("seed API %q: %w", name, err)
+			}
+			count++
+		}
+		if count > 0 {
+			rs.log.Debugf("Ran %d seed function(s) for API %q", count, name)
+		}
+	}
+
+	for _, path := range rs.cfg.Globals.Fixtures {
+		if err := rs.loadFixtures(ctx, path, bundles); err != nil {
+			return fmt.Errorf("load fixtures file %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
@@ -2,31 +2,94 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dekarrin/jelly"
 	"github.com/dekarrin/jelly/internal/logging"
 	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+)
+
+const (
+	// dbConnectAttempts is the number of times that connecting to each DB is
+	// attempted before NewServer fails.
+	dbConnectAttempts = 4
+
+	// dbConnectDelay is the delay before the first retry of a failed DB
+	// connection. It doubles with each retry.
+	dbConnectDelay = 500 * time.Millisecond
+
+	// dbPingTimeout is how long a dry run that connects DBs waits for each
+	// one to respond to a ping.
+	dbPingTimeout = 5 * time.Second
 )
 
 // restServer is an HTTP REST server that provides resources. The zero-value of
 // a restServer should not be used directly; call New() to get one ready for
 // use.
 type restServer struct {
-	mtx         *sync.Mutex
-	rtr         chi.Router
-	closing     bool
-	serving     bool
-	http        *http.Server
-	apis        map[string]jelly.API
-	apiBases    map[string]string
-	basesToAPIs map[string]string // used for tracking that APIs do not eat each other
-	dbs         map[string]jelly.Store
-	cfg         jelly.Config // config that it was started with.
+	mtx             *sync.Mutex
+	rtr             chi.Router
+	apiRouters      map[string]chi.Router // set at same time as rtr
+	apiSwitches     map[string]*apiSwitch // set at same time as rtr; what each API is mounted with
+	sp              endpointCreator       // set at same time as rtr
+	disabled        map[string]bool       // apis disabled with DisableAPI
+	enabling        map[string]bool       // disabled apis whose Init is being called by EnableAPI
+	closing         bool
+	shutdowns       int // number of times Shutdown has begun; checked by EnableAPI
+	serving         bool
+	handling        bool // set when Handler is called, as it may be served elsewhere
+	http            *http.Server
+	listener        net.Listener  // set at same time as http
+	grpc            *grpc.Server  // set when serving begins if gRPC is enabled
+	grpcMux         *grpcMux      // set with grpc if gRPC shares the HTTP listener
+	acmeHTTP        *http.Server  // set when serving begins if HTTP-01 challenges are answered
+	certs           *certRegistry // nil if autocert is not enabled
+	started         *starter      // set when serving begins; calls OnStart of APIs
+	apis            map[string]jelly.API
+	apiOrder        []string                // names of apis in the order they were added
+	initOrder       []string                // names of enabled apis in the order they were initialized
+	pending         map[string][]string     // enabled apis waiting on their dependencies to be initialized
+	services        *serviceRegistry        // initialized apis, for Bundle.Service
+	apiBundles      map[string]jelly.Bundle // bundles that enabled apis were initialized with
+	apiBases        map[string]string
+	basesToAPIs     map[string]string           // used for tracking that APIs do not eat each other
+	dbs             map[string]*jelly.LazyStore // nil values in a dry run that does not connect DBs
+	quotas          *jelly.QuotaManager
+	quotaCache      *quotaCache // nil if quota usage is written directly to a DB
+	flags           *jelly.Flags
+	events          *jelly.EventBus
+	webhooks        *webhookManager
+	ids             jelly.IDGenerator
+	cipher          *jelly.FieldCipher // nil if no encryption keys are configured
+	messages        *jelly.MessageCatalog
+	cfg             jelly.Config // config that it was started with.
+	mwChain         []chainEntry // global middleware; created from cfg on first use
+	resultHooks     []jelly.ResultHook
+	respGen         jelly.ResponseGeneratorFunc   // set with SetResponseGenerator
+	apiHooks        map[string][]jelly.ResultHook // result hooks registered by each API in Init
+	captures        map[string]*captureBuffer     // recent requests of APIs with capture enabled
+	inFlight        map[string]*inFlightLimiter   // in-flight limits of APIs; "" is the whole server
+	rateLimiter     *rateLimiter                  // nil until the ratelimit middleware is first used
+	apiRateLimiters map[string]*rateLimiter       // rate limits of APIs that have one
+	usage           map[string]*usageTracker      // resources used by each API
+	stats           *routeStatsRegistry           // nil if route stats are not enabled
+	unauth          *unauthTrail
+	deprecations    *deprecationUsage // set on first routing; kept when the router is recreated
+
+	grpcServices []grpcService // registered with RegisterGRPCService
+
+	observers []jelly.LifecycleObserver // from the Environment when the server was created
+	startup   *startupTracker           // report of startup; nil if not created with New
+
+	dryRun bool // created with NewDryRunServer; never serves
 
 	log jelly.Logger // used for logging. if logging disabled, this will be set to a no-op logger
 
@@ -34,14 +97,55 @@ type restServer struct {
 }
 
 // NewServer creates a new RESTServer ready to have new APIs added to it. All
-// configured DBs are connected to before this function returns, and the config
+// configured DBs whose connect policy is jelly.ConnectEager are connected to
+// before this function returns, those whose policy is jelly.ConnectLazy begin
+// connecting in the background, and the rest are connected to when they are
+// first used. The config
 // is retained for future operations. Any registered auto-APIs are automatically
 // added via Add as per the configuration; this includes both built-in and
-// user-supplied APIs.
+// user-supplied APIs. If the server cannot be created, the returned error is a
+// *jelly.StartupError that reports how each phase of startup went.
 func (env *Environment) NewServer(cfg *jelly.Config) (jelly.RESTServer, error) {
+	return env.newServer(cfg, nil)
+}
+
+// NewDryRunServer creates a new RESTServer that is set up the same way as one
+// created by NewServer, but that never serves; ServeForever, Run, and Seed
+// return an error without doing anything. Its APIs are initialized with a
+// Bundle in dry-run mode, which tells them not to change anything outside of
+// themselves. Unless opts.ConnectDBs is set, the configured DBs are only checked
+// for having a registered connector and are not connected to. Call Plan on the
+// returned server, after adding any APIs that are not pre-rolled components,
+// to get what it would serve.
+func (env *Environment) NewDryRunServer(cfg *jelly.Config, opts jelly.DryRunOptions) (jelly.RESTServer, error) {
+	return env.newServer(cfg, &opts)
+}
+
+// newServer creates a new RESTServer. If dryRun is not nil, the server is a
+// dry run with the given options. If it fails, the returned error is a
+// *jelly.StartupError with the report of each phase up to the one that failed.
+func (env *Environment) newServer(cfg *jelly.Config, dryRun *jelly.DryRunOptions) (jelly.RESTServer, error) {
+	startup := &startupTracker{}
+	rs, err := env.setUpServer(cfg, dryRun, startup)
+	if err != nil {
+		var se *jelly.StartupError
+		if errors.As(err, &se) {
+			// already has its report, from a failed API init
+			return nil, err
+		}
+		return nil, startup.end(err)
+	}
+	startup.end(nil)
+	return rs, nil
+}
+
+// setUpServer does the work of newServer, beginning each phase of startup with
+// startup as it goes.
+func (env *Environment) setUpServer(cfg *jelly.Config, dryRun *jelly.DryRunOptions, startup *startupTracker) (*restServer, error) {
 	env.initDefaults()
 
 	// check config
+	startup.begin(jelly.StartupConfig, "")
 	if cfg == nil {
 		cfg = &jelly.Config{}
 	} else {
@@ -65,14 +169,57 @@ func (env *Environment) NewServer(cfg *jelly.Config) (jelly.RESTServer, error) {
 		}
 	}
 
-	// connect DBs
-	dbs := map[string]jelly.Store{}
-	for name, db := range cfg.DBs {
-		db, err := env.connectors.Connect(db)
+	ids, err := jelly.NewIDGenerator(cfg.Globals.IDs)
+	if err != nil {
+		return nil, fmt.Errorf("ids: %w", err)
+	}
+
+	cipher, err := cfg.Globals.Encryption.Cipher()
+	if err != nil {
+		return nil, fmt.Errorf("encryption: %w", err)
+	}
+
+	var dbs map[string]*jelly.LazyStore
+	quotaConf := cfg.Globals.Quota
+	if dryRun != nil && !dryRun.ConnectDBs {
+		dbs, err = env.checkDBs(cfg.DBs, startup)
+		if err != nil {
+			return nil, err
+		}
+
+		// there is no store to write usage to, so only check that its DB
+		// exists
+		if quotaConf.DB != "" {
+			if _, ok := dbs[strings.ToLower(quotaConf.DB)]; !ok {
+				return nil, fmt.Errorf("quota: db: no DB named %q is configured", quotaConf.DB)
+			}
+			quotaConf.DB = ""
+		}
+	} else {
+		// a dry run connects every DB now so that they are all checked
+		dbs, err = env.connectDBs(cfg.DBs, ids, cipher, logger, dryRun != nil, startup)
 		if err != nil {
-			return nil, fmt.Errorf("connect DB %q: %w", name, err)
+			return nil, err
 		}
-		dbs[strings.ToLower(name)] = db
+	}
+
+	startup.begin(jelly.StartupQuota, "")
+	quotas, quotaCache, err := newQuotaManager(quotaConf, dbs, logger)
+	if err != nil {
+		closeDBs(dbs)
+		return nil, fmt.Errorf("quota: %w", err)
+	}
+
+	startup.begin(jelly.StartupI18n, "")
+	messages, err := env.newMessageCatalog(cfg.Globals.I18n)
+	if err != nil {
+		closeDBs(dbs)
+		return nil, fmt.Errorf("i18n: %w", err)
+	}
+
+	flagProv := env.flagProvider
+	if flagProv == nil {
+		flagProv = jelly.NewConfigFlagProvider(cfg.Globals.Flags)
 	}
 
 	rs := &restServer{
@@ -80,22 +227,49 @@ func (env *Environment) NewServer(cfg *jelly.Config) (jelly.RESTServer, error) {
 		apiBases:    map[string]string{},
 		mtx:         &sync.Mutex{},
 		basesToAPIs: map[string]string{},
+		pending:     map[string][]string{},
+		services:    &serviceRegistry{},
 		dbs:         dbs,
+		quotas:      quotas,
+		quotaCache:  quotaCache,
+		flags:       jelly.NewFlags(flagProv, logger),
+		ids:         ids,
+		cipher:      cipher,
+		messages:    messages,
 		cfg:         *cfg,
 		log:         logger,
+		dryRun:      dryRun != nil,
+		observers:   env.observers,
+		startup:     startup,
 
 		env: env,
 	}
-
-	// check on pre-rolled components, they need to be inited first.
-	for _, name := range env.componentProvidersOrder {
-		prov := env.componentProviders[name]
-		if _, ok := cfg.APIs[name]; ok {
+	if cfg.Globals.RouteStats {
+		rs.stats = newRouteStatsRegistry()
+	}
+	rs.unauth = newUnauthTrail(cfg.Globals.UnauthLog, logger)
+	if cfg.Globals.TLS.Enabled && cfg.Globals.TLS.Autocert.Enabled {
+		rs.certs = newCertRegistry(cfg.Globals.TLS.Autocert.Domains)
+	}
+	rs.events = jelly.NewEventBus()
+	rs.webhooks = newWebhookManager(cfg.Globals.Webhooks, logger)
+	rs.events.Subscribe("*", rs.webhooks.handle)
+
+	// check on pre-rolled components, they need to be inited first. each
+	// config section that is an instance of one gets its own API.
+	for _, comp := range env.componentProvidersOrder {
+		prov := env.componentProviders[comp]
+		for _, name := range componentInstances(cfg.APIs, comp) {
 			preRolled := prov()
 			if err := rs.Add(name, preRolled); err != nil {
+				closeDBs(dbs)
 				return nil, fmt.Errorf("component API %s: create API: %w", name, err)
 			}
-			logger.Debugf("Added pre-rolled component %q", name)
+			if name == comp {
+				logger.Debugf("Added pre-rolled component %q", name)
+			} else {
+				logger.Debugf("Added pre-rolled component %q as %q", comp, name)
+			}
 		}
 	}
 
@@ -105,9 +279,229 @@ func (env *Environment) NewServer(cfg *jelly.Config) (jelly.RESTServer, error) {
 		env.SetMainAuthenticator(cfg.Globals.MainAuthProvider)
 	}
 
+	env.servers = append(env.servers, rs)
 	return rs, nil
 }
 
+// connectDBs creates the LazyStore of each of the given DBs and returns them
+// by their lowercased names. DBs whose connect policy is jelly.ConnectEager are
+// connected to before it returns, as is every DB if eager is set, in which
+// case each is also pinged if its Store is a jelly.PingingStore; DBs whose
+// policy is jelly.ConnectLazy begin connecting in the background. A phase of
+// startup is begun for each DB that is connected to before it returns.
+func (env *Environment) connectDBs(dbConfs map[string]jelly.DatabaseConfig, ids jelly.IDGenerator, cipher *jelly.FieldCipher, logger jelly.Logger, eager bool, startup *startupTracker) (map[string]*jelly.LazyStore, error) {
+	dbs := map[string]*jelly.LazyStore{}
+	for _, name := range sortedDBNames(dbConfs) {
+		dbCfg := dbConfs[name]
+		policy := dbCfg.Connect
+		if eager || policy == "" {
+			policy = jelly.ConnectEager
+		}
+		var timeout time.Duration
+		if policy != jelly.ConnectEager {
+			timeout = time.Duration(dbCfg.ConnectTimeoutMillis) * time.Millisecond
+		}
+
+		ls := jelly.NewLazyStore(name, policy, timeout, env.dbConnector(name, dbCfg, ids, cipher, logger))
+		switch policy {
+		case jelly.ConnectEager:
+			startup.begin(jelly.StartupDB, name)
+			if _, err := ls.Get(context.Background()); err != nil {
+				closeDBs(dbs)
+				return nil, err
+			}
+			if eager {
+				if err := pingDB(strings.ToLower(name), ls); err != nil {
+					ls.Close()
+					closeDBs(dbs)
+					return nil, err
+				}
+			}
+		case jelly.ConnectLazy:
+			ls.Connect()
+		}
+		dbs[strings.ToLower(name)] = ls
+	}
+	return dbs, nil
+}
+
+// dbConnector returns a function that connects to the named DB and any
+// replicas it has, retrying in case they are not yet up. It returns the
+// decorated Store of the DB, or a jelly.ReplicatedStore of the decorated
+// Stores of the DB and its replicas if it has any.
+func (env *Environment) dbConnector(name string, dbCfg jelly.DatabaseConfig, ids jelly.IDGenerator, cipher *jelly.FieldCipher, logger jelly.Logger) func() (jelly.Store, error) {
+	return func() (jelly.Store, error) {
+		primary, err := env.connectDB(name, -1, dbCfg, ids, cipher, logger)
+		if err != nil {
+			return nil, err
+		}
+		if len(dbCfg.Replicas) == 0 {
+			logger.Debugf("Connected to DB %q", name)
+			for _, o := range env.observers {
+				o.OnDBConnected(name)
+			}
+			return primary, nil
+		}
+
+		replicas := make([]jelly.Store, 0, len(dbCfg.Replicas))
+		for i := range dbCfg.Replicas {
+			replica, err := env.connectDB(name, i, dbCfg.Replica(i), ids, cipher, logger)
+			if err != nil {
+				primary.Close()
+				for _, r := range replicas {
+					r.Close()
+				}
+				return nil, fmt.Errorf("replicas[%d]: %w", i, err)
+			}
+			replicas = append(replicas, replica)
+		}
+
+		rs := jelly.NewReplicatedStore(name, primary, replicas, dbCfg.Failover)
+		if dbCfg.HealthCheckMillis > 0 {
+			rs.StartHealthChecks(time.Duration(dbCfg.HealthCheckMillis)*time.Millisecond, func(replica int, healthy bool) {
+				which := "primary"
+				if replica >= 0 {
+					which = fmt.Sprintf("replicas[%d]", replica)
+				}
+				if healthy {
+					logger.Infof("DB %q %s is healthy again", name, which)
+				} else {
+					logger.Warnf("DB %q %s is unhealthy", name, which)
+				}
+				if replica < 0 && dbCfg.Failover {
+					if rs.Health().FailedOver {
+						logger.Warnf("DB %q failed over to a replica for writes", name)
+					} else if healthy {
+						logger.Infof("DB %q writes went back to the primary", name)
+					}
+				}
+			})
+		}
+		logger.Debugf("Connected to DB %q and %d replica(s)", name, len(replicas))
+		for _, o := range env.observers {
+			o.OnDBConnected(name)
+		}
+		return rs, nil
+	}
+}
+
+// connectDB connects to the named DB, or to its replica with the given index if
+// replica is not -1, retrying in case it is not yet up, and returns its
+// decorated Store. Replicas are decorated as the DB they are a replica of.
+func (env *Environment) connectDB(name string, replica int, dbCfg jelly.DatabaseConfig, ids jelly.IDGenerator, cipher *jelly.FieldCipher, logger jelly.Logger) (jelly.Store, error) {
+	label := fmt.Sprintf("DB %q", name)
+	if replica >= 0 {
+		label = fmt.Sprintf("DB %q replicas[%d]", name, replica)
+	}
+	retry := jelly.RetryPolicy{
+		Attempts:     dbConnectAttempts,
+		InitialDelay: dbConnectDelay,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			logger.Warnf("connect %s failed (attempt %d/%d), retrying in %s: %v", label, attempt, dbConnectAttempts, delay.Round(time.Millisecond), err)
+		},
+	}
+
+	var db jelly.Store
+	err := jelly.Retry(context.Background(), retry, func(ctx context.Context) error {
+		var err error
+		db, err = env.connectors.Connect(dbCfg)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if idStore, ok := db.(jelly.IDGeneratorStore); ok {
+		idStore.UseIDGenerator(ids)
+	}
+	if cipher != nil {
+		if cipherStore, ok := db.(jelly.FieldCipherStore); ok {
+			cipherStore.UseFieldCipher(cipher)
+		}
+	}
+	decorated, err := env.decorateStore(name, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return decorated, nil
+}
+
+// closeDBs closes each of the given DBs that is connected to, or that is in
+// the middle of being connected to. Errors are ignored, as it is only used to
+// clean up after a failure.
+func closeDBs(dbs map[string]*jelly.LazyStore) {
+	for _, db := range dbs {
+		if db != nil {
+			db.Close()
+		}
+	}
+}
+
+// checkDBs checks that each of the given DBs has a registered connector
+// without connecting to it. The returned map has a nil LazyStore for each DB
+// by its lowercased name. A phase of startup is begun for each DB.
+func (env *Environment) checkDBs(dbConfs map[string]jelly.DatabaseConfig, startup *startupTracker) (map[string]*jelly.LazyStore, error) {
+	dbs := map[string]*jelly.LazyStore{}
+	for _, name := range sortedDBNames(dbConfs) {
+		startup.begin(jelly.StartupDB, name)
+		if err := env.connectors.Check(dbConfs[name]); err != nil {
+			return nil, fmt.Errorf("DB %q: %w", name, err)
+		}
+		dbs[strings.ToLower(name)] = nil
+	}
+	return dbs, nil
+}
+
+// pingDB pings the connected DB with the given name if its Store is a
+// jelly.PingingStore.
+func pingDB(name string, ls *jelly.LazyStore) error {
+	db, err := ls.Get(context.Background())
+	if err != nil {
+		return err
+	}
+	pinger, ok := db.(jelly.PingingStore)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+	defer cancel()
+	if err := pinger.Ping(ctx); err != nil {
+		return fmt.Errorf("ping DB %q: %w", name, err)
+	}
+	return nil
+}
+
+// sortedDBNames returns the names of the given DBs in alphabetical order, so
+// that they are connected to in the same order each time.
+func sortedDBNames(dbConfs map[string]jelly.DatabaseConfig) []string {
+	names := make([]string, 0, len(dbConfs))
+	for name := range dbConfs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// componentInstances returns the names of the APIs in apis that are instances
+// of the named component, in alphabetical order. An API is an instance of the
+// component that its config gives, or of the component with the same name as
+// it if its config does not give one.
+func componentInstances(apis map[string]jelly.APIConfig, comp string) []string {
+	var names []string
+	for name, conf := range apis {
+		instanceOf := conf.Common().Component
+		if instanceOf == "" {
+			instanceOf = name
+		}
+		if strings.EqualFold(instanceOf, comp) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Config returns the conifguration that the server used during creation.
 // Modifying the returned config will have no effect on the server.
 func (rs restServer) Config() jelly.Config {
@@ -115,12 +509,19 @@ func (rs restServer) Config() jelly.Config {
 }
 
 // RoutesIndex returns a human-readable formatted string that lists all routes
-// and methods currently available in the server.
+// and methods currently available in the server. Methods of deprecated
+// endpoints are marked with "(deprecated)". If route stats are enabled, the
+// stats of each method of a route are given on the lines below it.
 func (rs *restServer) RoutesIndex() string {
 	routeMethods := map[string][]string{}
+	deprecated := map[string]bool{}
 
 	r := rs.routeAllAPIs()
-	chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+	chi.Walk(r, func(method, route string, handler http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if over, ok := describeEndpoint(handler); ok && over.Deprecated != nil {
+			deprecated[method+" "+route] = true
+		}
+
 		meths, ok := routeMethods[route]
 		if !ok {
 			meths = []string{}
@@ -150,16 +551,96 @@ func (rs *restServer) RoutesIndex() string {
 		sort.Strings(meths)
 		for i, m := range meths {
 			sb.WriteString(m)
+			if deprecated[m+" "+r] {
+				sb.WriteString(" (deprecated)")
+			}
 			if i+1 < len(meths) {
 				sb.WriteString(", ")
 			}
 		}
 		sb.WriteRune('\n')
+
+		if rs.stats != nil {
+			for _, m := range meths {
+				sb.WriteString("    ")
+				sb.WriteString(m)
+				sb.WriteString(": ")
+				sb.WriteString(formatRouteStats(rs.stats.get(m, r)))
+				sb.WriteRune('\n')
+			}
+		}
 	}
 
 	return jelly.UnPathParam(strings.TrimSpace(sb.String()))
 }
 
+// Routes returns a listing of every route and method currently available in
+// the server, along with the name of the API that provides it and how it is
+// handled. The returned routes are sorted by path and then by method.
+func (rs *restServer) Routes() []jelly.RouteInfo {
+	rs.routeAllAPIs()
+
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	var routes []jelly.RouteInfo
+
+	for name, apiRouter := range rs.apiRouters {
+		prefix := strings.TrimRight(rs.cfg.Globals.URIBase, "/")
+		if base := rs.apiBases[name]; base != "/" {
+			prefix += base
+		}
+
+		var mountMws []func(http.Handler) http.Handler
+		if sw := rs.apiSwitches[name]; sw != nil {
+			mountMws = sw.middleware()
+		}
+		chi.Walk(apiRouter, func(method, route string, handler http.Handler, mws ...func(http.Handler) http.Handler) error {
+			ri := jelly.RouteInfo{
+				API:    name,
+				Method: method,
+				Path:   jelly.UnPathParam(prefix + route),
+			}
+			describeMiddleware(&ri, append(append([]func(http.Handler) http.Handler{}, mountMws...), mws...))
+			if over, ok := describeEndpoint(handler); ok {
+				ri.Override = &over
+			}
+			if rs.stats != nil {
+				st := rs.stats.get(method, prefix+route)
+				ri.Stats = &st
+			}
+			routes = append(routes, ri)
+			return nil
+		})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	return routes
+}
+
+// Handler returns the fully-mounted route tree of the server. See
+// jelly.RESTServer.Handler.
+func (rs *restServer) Handler() http.Handler {
+	rs.checkCreatedViaNew()
+	rtr := rs.routeAllAPIs()
+
+	rs.mtx.Lock()
+	rs.handling = true
+	rs.runQuotaCache()
+	if err := rs.checkPending(); err != nil {
+		rs.log.Errorf("%v; it will not be served", err)
+	}
+	rs.mtx.Unlock()
+
+	return rtr
+}
+
 // routeAllAPIs is called just before serving. it gets all enabled routes and
 // mounts them in the base router.
 func (rs *restServer) routeAllAPIs() chi.Router {
@@ -176,11 +657,31 @@ func (rs *restServer) routeAllAPIs() chi.Router {
 		env.initDefaults()
 	}
 
-	sp := endpointCreator{mid: env.middleProv, log: rs.log}
+	if rs.deprecations == nil {
+		rs.deprecations = newDeprecationUsage()
+	}
+	sp := endpointCreator{
+		mid:                env.middleProv,
+		log:                rs.log,
+		models:             env.models,
+		schemas:            env.schemas,
+		messages:           rs.messages,
+		deprecations:       rs.deprecations,
+		requireContentType: rs.cfg.Globals.RequireContentType,
+	}
+	sp = sp.withResponses(rs.respGen)
 
 	// Create root router
 	root := chi.NewRouter()
-	root.Use(env.middleProv.DontPanic(sp))
+	rs.useStartTime(root)
+	rs.useRouteStats(root)
+	rs.useInFlightLimit(root, sp)
+	rs.useMiddlewareChain(root, env, sp)
+	rs.useUnauthTrail(root)
+	rs.useVersionHeader(root)
+	rs.routeInfo(root, sp)
+	rs.routeWebhooks(root, sp)
+	rs.routeAdmin(root, sp)
 
 	// make server base router
 	r := root
@@ -189,15 +690,26 @@ func (rs *restServer) routeAllAPIs() chi.Router {
 		root.Mount(rs.cfg.Globals.URIBase, r)
 	}
 
+	apiRouters := map[string]chi.Router{}
+	apiSwitches := map[string]*apiSwitch{}
 	for name, api := range rs.apis {
 		apiConf := rs.getAPIConfigBundle(name)
-		if apiConf.Enabled() {
+		if apiConf.Enabled() && rs.initialized(name) {
 			base := rs.apiBases[name]
-			// TODO: remove subpaths once we realize inferred works
-			apiRouter, _ := api.Routes(sp)
+			sw := &apiSwitch{unavailable: apiUnavailableHandler(sp, name), notFound: apiNotFoundHandler(sp), usage: rs.usageTracker(name)}
+			apiSwitches[name] = sw
+			if rs.disabled[name] {
+				// its routes are created again when it is re-enabled
+				sw.disable()
+				r.Mount(base, sw)
+				continue
+			}
 
+			apiRouter, mws := rs.routeAPI(name, api, sp)
 			if apiRouter != nil {
-				r.Mount(base, apiRouter)
+				apiRouters[name] = apiRouter
+				sw.enable(apiRouter, mws)
+				r.Mount(base, sw)
 				if base != "/" {
 
 					// check if there are subpaths
@@ -220,15 +732,114 @@ func (rs *restServer) routeAllAPIs() chi.Router {
 	}
 
 	rs.rtr = root
+	rs.sp = sp
+	rs.apiRouters = apiRouters
+	rs.apiSwitches = apiSwitches
 
 	return root
 }
 
+// routeAPI creates the router of the named API along with the middleware that
+// is applied to it where it is mounted. The router is nil if the API has no
+// routes. rs.mtx must be held by the caller.
+func (rs *restServer) routeAPI(name string, api jelly.API, sp endpointCreator) (chi.Router, []func(http.Handler) http.Handler) {
+	apiConf := rs.getAPIConfigBundle(name)
+
+	// each API gets its own result hooks, followed by the global ones
+	apiSP := sp
+	apiSP.hooks = append(append([]jelly.ResultHook{}, rs.apiHooks[name]...), rs.resultHooks...)
+	apiSP.envelope, _ = apiConf.GetValue(jelly.ConfigKeyAPIEnvelope).(jelly.Envelope)
+	apiSP = apiSP.withResponses(rs.respGen)
+
+	// TODO: remove subpaths once we realize inferred works
+	apiRouter, _ := api.Routes(apiSP)
+	if apiRouter == nil {
+		return nil, nil
+	}
+
+	// the API's router may already have routes on it, so its own middleware
+	// is applied where it is mounted instead. capture comes first so that it
+	// records the final response.
+	var mws []func(http.Handler) http.Handler
+	if capture := rs.captureMiddleware(name, apiConf); capture != nil {
+		mws = append(mws, capture)
+	}
+	if headers, _ := apiConf.GetValue(jelly.ConfigKeyAPISecurityHeaders).(*jelly.SecurityHeadersConfig); headers != nil {
+		if mw := securityHeadersMiddleware(*headers); mw != nil {
+			mws = append(mws, mw)
+		}
+	}
+	if cors, _ := apiConf.GetValue(jelly.ConfigKeyAPICORS).(*jelly.CORSConfig); cors != nil {
+		if mw := corsMiddleware(*cors); mw != nil {
+			mws = append(mws, mw)
+		}
+	}
+	rateLimit, _ := apiConf.GetValue(jelly.ConfigKeyAPIRateLimit).(*jelly.RateLimitConfig)
+	if limit := rs.apiRateLimitMiddleware(name, rateLimit, apiSP); limit != nil {
+		mws = append(mws, limit)
+	}
+	if timeout := timeoutMiddleware(apiConf.GetInt(jelly.ConfigKeyAPITimeout)); timeout != nil {
+		mws = append(mws, timeout)
+	}
+	if limit := rs.inFlightMiddleware(name, apiConf.GetInt(jelly.ConfigKeyAPIMaxInFlight), apiSP); limit != nil {
+		mws = append(mws, limit)
+	}
+	if mwAPI, ok := api.(jelly.MiddlewareAPI); ok {
+		mws = append(mws, apiMiddleware(mwAPI)...)
+	}
+
+	return apiRouter, mws
+}
+
+// OnResult registers hook to be called on the Result of every endpoint in the
+// server. See jelly.RESTServer.OnResult.
+func (rs *restServer) OnResult(hook jelly.ResultHook) {
+	if hook == nil {
+		return
+	}
+
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	rs.resultHooks = append(rs.resultHooks, hook)
+
+	// make shore to reset the router so the new hook is used
+	rs.rtr = nil
+}
+
+// SetResponseGenerator replaces the ResponseGenerator of every endpoint in the
+// server. See jelly.RESTServer.SetResponseGenerator.
+func (rs *restServer) SetResponseGenerator(gen jelly.ResponseGeneratorFunc) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	rs.respGen = gen
+
+	// make shore to reset the router so the new generator is used
+	rs.rtr = nil
+}
+
+// apiMiddleware returns the middleware that api provides for its routes,
+// converted for use with chi. Nil entries are skipped.
+func apiMiddleware(api jelly.MiddlewareAPI) []func(http.Handler) http.Handler {
+	var mws []func(http.Handler) http.Handler
+	for _, mw := range api.Middleware() {
+		if mw != nil {
+			mws = append(mws, mw)
+		}
+	}
+	return mws
+}
+
 // Add adds the given API to the server. If it is enabled in its config, it will
 // be initialized with the configuration section that matches its name. The name
 // is case-insensitive and will be normalized to lowercase. It is an error to
 // use the same normalized name in two calls to Add on the same RESTServer.
 //
+// If the API is a jelly.DependentAPI, its initialization is delayed until every
+// API it depends on has been added and initialized. Initializing an API also
+// initializes any APIs that were waiting on it.
+//
 // Returns an error if there is any issue initializing the API.
 func (rs *restServer) Add(name string, api jelly.API) error {
 	name = strings.ToLower(name)
@@ -252,22 +863,55 @@ func (rs *restServer) Add(name string, api jelly.API) error {
 		env = &Environment{}
 	}
 
+	if !apiConf.Enabled() {
+		rs.apis[name] = api
+		rs.apiOrder = append(rs.apiOrder, name)
+		rs.log.Debugf("Added API %q; skipping initialization due to enabled=false", name)
+		return nil
+	}
+
+	deps, err := rs.dependencies(name, api)
+	if err != nil {
+		return err
+	}
 	rs.apis[name] = api
-	if apiConf.Enabled() {
-		rs.log.Debugf("Added API %q; initializing...", name)
-		base, err := rs.initAPI(name, api)
-		if err != nil {
-			return err
-		}
-		rs.apiBases[name] = base
+	rs.apiOrder = append(rs.apiOrder, name)
 
-		auths := api.Authenticators()
-		for aName, a := range auths {
-			fullName := name + "." + aName
-			env.RegisterAuthenticator(fullName, a)
+	if !rs.ready(deps) {
+		if rs.pending == nil {
+			rs.pending = map[string][]string{}
 		}
-	} else {
-		rs.log.Debugf("Added API %q; skipping initialization due to enabled=false", name)
+		rs.pending[name] = deps
+		rs.log.Debugf("Added API %q; waiting to initialize until %s are initialized", name, strings.Join(deps, ", "))
+		return nil
+	}
+
+	rs.log.Debugf("Added API %q; initializing...", name)
+	if err := rs.initAndRegister(env, name, api); err != nil {
+		return err
+	}
+
+	// APIs that were waiting on this one may now be ready
+	return rs.initPending(env)
+}
+
+// initAndRegister initializes api and registers its authenticators. rs.mtx
+// must be held by the caller. If api cannot be initialized, the returned error
+// is a *jelly.StartupError.
+func (rs *restServer) initAndRegister(env *Environment, name string, api jelly.API) error {
+	rs.startup.begin(jelly.StartupAPI, name)
+	base, err := rs.initAPI(name, api)
+	if err := rs.startup.end(err); err != nil {
+		return err
+	}
+	rs.apiBases[name] = base
+	rs.initOrder = append(rs.initOrder, name)
+	rs.services.add(name, api)
+
+	auths := api.Authenticators()
+	for aName, a := range auths {
+		fullName := name + "." + aName
+		env.RegisterAuthenticator(fullName, a)
 	}
 
 	return nil
@@ -290,17 +934,9 @@ func (rs *restServer) initAPI(name string, api jelly.API) (string, error) {
 		rs.log.Warnf("config section %q is not present", name)
 	}
 	apiConf := rs.getAPIConfigBundle(name)
-
-	// find the actual dbs it uses
-	usedDBs := map[string]jelly.Store{}
-	usedDBNames := apiConf.UsesDBs()
-
-	for _, dbName := range usedDBNames {
-		connectedDB, ok := rs.dbs[strings.ToLower(dbName)]
-		if !ok {
-			return "", fmt.Errorf("API refers to missing DB %q", strings.ToLower(dbName))
-		}
-		usedDBs[strings.ToLower(dbName)] = connectedDB
+	initBundle, err := rs.newInitBundle(name, apiConf)
+	if err != nil {
+		return "", err
 	}
 
 	base := apiConf.APIBase()
@@ -315,77 +951,319 @@ func (rs *restServer) initAPI(name string, api jelly.API) (string, error) {
 
 	// TODO: after jellog is patched, add in use of api's name to logger via use of sublogger
 
-	initBundle := apiConf.WithDBs(usedDBs)
-
-	if err := api.Init(initBundle); err != nil {
+	err = api.Init(initBundle)
+	for _, o := range rs.observers {
+		o.OnAPIInit(name, err)
+	}
+	if err != nil {
 		return "", fmt.Errorf("init API %q: Init(): %w", name, err)
 	}
+	if rs.apiBundles == nil {
+		rs.apiBundles = map[string]jelly.Bundle{}
+	}
+	rs.apiBundles[name] = initBundle
+	if hooks := initBundle.ResultHooks(); len(hooks) > 0 {
+		if rs.apiHooks == nil {
+			rs.apiHooks = map[string][]jelly.ResultHook{}
+		}
+		rs.apiHooks[name] = hooks
+	}
 	rs.log.Debugf("Successfully initialized API %q", name)
 
 	return base, nil
 }
 
+// newInitBundle returns the Bundle that the named API with the config in
+// apiConf is initialized with, which has the DBs it uses and the server's
+// shared services.
+func (rs *restServer) newInitBundle(name string, apiConf jelly.Bundle) (jelly.Bundle, error) {
+	// find the actual dbs it uses
+	usedDBs := map[string]jelly.Store{}
+	usedDBNames, err := jelly.ResolveUsesDBs(apiConf.UsesDBs(), rs.cfg.DBs)
+	if err != nil {
+		return jelly.Bundle{}, err
+	}
+
+	for _, dbName := range usedDBNames {
+		connectedDB, ok := rs.dbs[strings.ToLower(dbName)]
+		if !ok {
+			return jelly.Bundle{}, fmt.Errorf("API refers to missing DB %q", strings.ToLower(dbName))
+		}
+		if connectedDB == nil {
+			// not connected for a dry run; give the API a nil Store and not a
+			// nil *LazyStore
+			usedDBs[strings.ToLower(dbName)] = nil
+			continue
+		}
+		usedDBs[strings.ToLower(dbName)] = connectedDB
+	}
+
+	if rs.services == nil {
+		rs.services = &serviceRegistry{}
+	}
+	return apiConf.WithDBs(usedDBs).WithUsesDBs(usedDBNames).WithQuotas(rs.quotas).WithFlags(rs.flags).WithEvents(rs.events).WithIDs(rs.ids).WithFieldCipher(rs.cipher).WithServices(rs.services.service).WithGo(rs.usageTracker(name).goFunc).WithDryRun(rs.dryRun), nil
+}
+
 func (rs *restServer) checkCreatedViaNew() {
 	if rs.mtx == nil {
 		panic("server mutex is in invalid state; was this RESTServer created with New()?")
 	}
 }
 
+// Addr returns the address that the server is listening on, with the port that
+// was actually bound. It returns the empty string if the server is not
+// listening.
+func (rs *restServer) Addr() string {
+	rs.checkCreatedViaNew()
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	if rs.listener == nil {
+		return ""
+	}
+	return rs.listener.Addr().String()
+}
+
 // ServeForever begins listening on the server's configured address and port for
 // HTTP REST client requests.
 //
 // This function will block until the server is stopped. If it returns as a
 // result of rs.Close() being called elsewhere, it will return
-// http.ErrServerClosed.
+// http.ErrServerClosed. If it cannot begin listening, the returned error is a
+// *jelly.StartupError with the report of each phase of startup.
 func (rs *restServer) ServeForever() error {
 	rs.checkCreatedViaNew()
 	rs.mtx.Lock()
+	if rs.dryRun {
+		rs.mtx.Unlock()
+		return errDryRun
+	}
 	if rs.serving {
 		rs.mtx.Unlock()
 		return fmt.Errorf("server is already running")
 	}
+	rs.startup.begin(jelly.StartupRoutes, "")
+	if err := rs.checkPending(); err != nil {
+		rs.mtx.Unlock()
+		return rs.startup.end(err)
+	}
 	rs.serving = true
+	rs.runQuotaCache()
 	rs.mtx.Unlock()
 
 	defer func() {
 		rs.mtx.Lock()
+		rs.started.stop()
+		rs.started = nil
 		rs.closing = false
 		rs.serving = false
 		rs.mtx.Unlock()
 	}()
 
-	addr := fmt.Sprintf("%s:%d", rs.cfg.Globals.Address, rs.cfg.Globals.Port)
-	rtr := rs.routeAllAPIs()
-	rs.http = &http.Server{Addr: addr, Handler: rtr}
+	addr := rs.cfg.Globals.ListenAddress()
+	rtr, err := rs.mountRoutes()
+	if err := rs.startup.end(err); err != nil {
+		return err
+	}
+	rs.log.Infof("Server info: %s", rs.Info())
+	srv := &http.Server{Addr: addr, Handler: rtr}
+
+	rs.mtx.Lock()
+	if rs.closing {
+		// Shutdown was called before the HTTP server was set
+		rs.mtx.Unlock()
+		return http.ErrServerClosed
+	}
+	rs.mtx.Unlock()
+
+	rs.startup.begin(jelly.StartupListen, "")
+	if rs.cfg.Globals.GRPC.Enabled {
+		gs, err := rs.newGRPCServer()
+		if err != nil {
+			return rs.startup.end(fmt.Errorf("gRPC: %w", err))
+		}
+		srv.Handler, err = rs.serveGRPC(gs, rtr)
+		if err != nil {
+			return rs.startup.end(err)
+		}
+	}
+
+	tlsConf, err := rs.tlsConfig()
+	if err != nil {
+		rs.mtx.Lock()
+		if rs.grpc != nil {
+			rs.stopGRPC(context.Background())
+		}
+		rs.mtx.Unlock()
+		return rs.startup.end(fmt.Errorf("tls: %w", err))
+	}
+	srv.TLSConfig = tlsConf
+
+	ln, ready, err := listen(addr)
+	var extraLns []net.Listener
+	if err == nil {
+		extraLns, err = listenExtra(rs.cfg.Globals.ExtraListen)
+		if err != nil {
+			ln.Close()
+			if ready != nil {
+				ready.Close()
+			}
+		}
+	}
+	if err != nil {
+		rs.mtx.Lock()
+		if rs.grpc != nil {
+			rs.stopGRPC(context.Background())
+		}
+		rs.stopACMEHTTP(context.Background())
+		rs.mtx.Unlock()
+		return rs.startup.end(err)
+	}
 
-	return rs.http.ListenAndServe()
+	rs.mtx.Lock()
+	if rs.closing {
+		if rs.grpc != nil {
+			rs.stopGRPC(context.Background())
+		}
+		rs.stopACMEHTTP(context.Background())
+		rs.mtx.Unlock()
+		ln.Close()
+		closeListeners(extraLns)
+		if ready != nil {
+			ready.Close()
+		}
+		return http.ErrServerClosed
+	}
+	rs.http = srv
+	rs.listener = ln
+
+	// the listener is bound, so connections are accepted from here on even
+	// before Serve is called
+	startNames := make([]string, len(rs.initOrder))
+	copy(startNames, rs.initOrder)
+	startAPIList := make([]jelly.API, len(startNames))
+	for i, name := range startNames {
+		startAPIList[i] = rs.apis[name]
+	}
+	rs.started = startAPIs(startAPIList, startNames, rs.log)
+	rs.mtx.Unlock()
+
+	if ready != nil {
+		rs.log.Infof("Using listener on %s inherited from previous process", ln.Addr())
+		ready.Write([]byte{1})
+		ready.Close()
+	} else {
+		rs.log.Infof("Listening on %s", ln.Addr())
+	}
+	rs.startup.end(nil)
+	for _, o := range rs.observers {
+		o.OnListen(ln.Addr().String())
+	}
+
+	for _, extra := range extraLns {
+		rs.log.Infof("Also listening on %s", extra.Addr())
+		go func(extra net.Listener) {
+			if err := serveListener(srv, extra); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				rs.log.Errorf("Server on %s encountered a problem: %v", extra.Addr(), err)
+			}
+		}(extra)
+	}
+
+	return serveListener(srv, ln)
+}
+
+// mountRoutes mounts the routes of every API on a new router, as with
+// routeAllAPIs. Routes that cannot be mounted, such as those with a pattern
+// that is not valid, make the router panic; mountRoutes returns that as an
+// error instead.
+func (rs *restServer) mountRoutes() (rtr chi.Router, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("mount routes: %v", r)
+		}
+	}()
+	return rs.routeAllAPIs(), nil
+}
+
+// serveListener serves srv on ln, with TLS if srv has a TLS config.
+func serveListener(srv *http.Server, ln net.Listener) error {
+	if srv.TLSConfig != nil {
+		// the certificate is in the TLS config, so no files are given
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.Serve(ln)
+}
+
+// listenExtra binds to each of the addresses in addrs, which are the listen
+// addresses beyond the first. If binding to any of them fails, the ones
+// already bound are closed.
+func listenExtra(addrs []string) ([]net.Listener, error) {
+	var lns []net.Listener
+	for _, addr := range addrs {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			closeListeners(lns)
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
+
+func closeListeners(lns []net.Listener) {
+	for _, ln := range lns {
+		ln.Close()
+	}
 }
 
 // Shutdown shuts down the server gracefully, first closing the HTTP server to
-// new connections and then shutting down each individual API the server was
-// created with. This will cause ServeForever to return in any Go thread that is
-// blocking on it. If the passed-in context is canceled while shutting down, it
-// will halt graceful shutdown of the HTTP server and the APIs.
+// new connections, then stopping the gRPC server if gRPC is enabled, then
+// shutting down each individual API the server was created with, and finally
+// closing each DB. This will cause ServeForever to return in any Go thread that
+// is blocking on it. If the passed-in context is canceled while shutting down,
+// it will halt graceful shutdown of the HTTP server, the gRPC server, the APIs,
+// and the DBs; a DB whose Store is a jelly.ContextClosingStore is given the
+// context to stop a slow close, such as one that flushes data to disk.
 //
 // Returns a non-nil error if the server is not currently running due to a call
-// to ServeForever or Serve.
+// to ServeForever or Serve, and its Handler has not been retrieved.
 //
 // Once Shutdown returns, the RESTServer should not be used again.
-func (rs *restServer) Shutdown(ctx context.Context) error {
+func (rs *restServer) Shutdown(ctx context.Context) (fullError error) {
 	rs.checkCreatedViaNew()
 	rs.mtx.Lock()
 	if rs.closing {
 		rs.mtx.Unlock()
 		return fmt.Errorf("close already in-progress in another goroutine")
 	}
-	if !rs.serving {
+	if !rs.serving && !rs.handling {
 		rs.mtx.Unlock()
 		return fmt.Errorf("server is not running")
 	}
 	defer rs.mtx.Unlock()
 	rs.closing = true
+	rs.shutdowns++
+	if !rs.serving {
+		// only the Handler was in use, so there is no ServeForever to reset
+		// the state when it returns.
+		rs.handling = false
+		defer func() {
+			rs.closing = false
+		}()
+	}
+
+	for _, o := range rs.observers {
+		o.OnShutdownBegin()
+	}
+	defer func() {
+		for _, o := range rs.observers {
+			o.OnShutdownEnd(fullError)
+		}
+	}()
 
-	var fullError error
+	// stop any OnStart still in progress before the APIs are shut down
+	rs.started.stop()
+	rs.started = nil
 
 	if rs.http != nil {
 		err := rs.http.Shutdown(ctx)
@@ -393,6 +1271,7 @@ func (rs *restServer) Shutdown(ctx context.Context) error {
 			fullError = fmt.Errorf("stop HTTP server: %w", err)
 		}
 		rs.http = nil
+		rs.listener = nil
 		if err != nil && err == ctx.Err() {
 			// if its due to the context expiring or timing out, we should
 			// immediately exit without waiting for clean shutdown of the APIs.
@@ -400,12 +1279,41 @@ func (rs *restServer) Shutdown(ctx context.Context) error {
 		}
 	}
 
-	// call life-cycle shutdown on each API
-	for name, api := range rs.apis {
-		apiConf := rs.getAPIConfigBundle(name)
-		if !apiConf.Enabled() {
+	if rs.grpc != nil {
+		err := rs.stopGRPC(ctx)
+		if err != nil {
+			grpcErr := fmt.Errorf("stop gRPC server: %w", err)
+			if fullError != nil {
+				fullError = fmt.Errorf("%s\nadditionally: %w", fullError, grpcErr)
+			} else {
+				fullError = grpcErr
+			}
+			return fullError
+		}
+	}
+
+	if err := rs.stopACMEHTTP(ctx); err != nil {
+		acmeErr := fmt.Errorf("stop ACME HTTP-01 listener: %w", err)
+		if fullError != nil {
+			fullError = fmt.Errorf("%s\nadditionally: %w", fullError, acmeErr)
+		} else {
+			fullError = acmeErr
+		}
+	}
+
+	// call life-cycle shutdown on each API, in the reverse of the order they
+	// were initialized in so that each is shut down before the APIs it
+	// depends on
+	for i := len(rs.initOrder) - 1; i >= 0; i-- {
+		name := rs.initOrder[i]
+		api := rs.apis[name]
+		if rs.disabled[name] {
+			// already shut down when it was disabled
 			continue
 		}
+		if ut := rs.usage[name]; ut != nil {
+			ut.stop()
+		}
 
 		select {
 		case <-ctx.Done():
@@ -430,5 +1338,89 @@ func (rs *restServer) Shutdown(ctx context.Context) error {
 		}
 	}
 
+	// write quota usage counted in memory, including any used during shutdown
+	if rs.quotaCache != nil {
+		if err := rs.quotaCache.stop(ctx); err != nil {
+			quotaErr := fmt.Errorf("write quota usage: %w", err)
+			if fullError != nil {
+				fullError = fmt.Errorf("%s\nadditionally: %w", fullError, quotaErr)
+			} else {
+				fullError = quotaErr
+			}
+		}
+	}
+
+	// let webhooks of events published during shutdown be delivered
+	if rs.webhooks != nil {
+		if err := rs.webhooks.wait(ctx); err != nil {
+			whErr := fmt.Errorf("deliver webhooks: %w", err)
+			if fullError != nil {
+				fullError = fmt.Errorf("%s\nadditionally: %w", fullError, whErr)
+			} else {
+				fullError = whErr
+			}
+		}
+	}
+
+	if err := rs.unauth.close(); err != nil {
+		logErr := fmt.Errorf("close unauth log: %w", err)
+		if fullError != nil {
+			fullError = fmt.Errorf("%s\nadditionally: %w", fullError, logErr)
+		} else {
+			fullError = logErr
+		}
+	}
+
+	// close the DBs last, as the APIs and the above may still write to them
+	// while they shut down. Closing a DB can flush data to it, so each is
+	// given ctx to stop a slow close from hanging the shutdown.
+	dbNames := make([]string, 0, len(rs.dbs))
+	for name := range rs.dbs {
+		dbNames = append(dbNames, name)
+	}
+	sort.Strings(dbNames)
+	for _, name := range dbNames {
+		ls := rs.dbs[name]
+		if ls == nil {
+			continue
+		}
+		if err := ls.CloseContext(ctx); err != nil {
+			dbErr := fmt.Errorf("close DB %q: %w", name, err)
+			if fullError != nil {
+				fullError = fmt.Errorf("%s\nadditionally: %w", fullError, dbErr)
+			} else {
+				fullError = dbErr
+			}
+		}
+	}
+
 	return fullError
 }
+
+// Events returns the EventBus that the server's APIs publish events to. See
+// jelly.RESTServer.Events.
+func (rs *restServer) Events() *jelly.EventBus {
+	return rs.events
+}
+
+// AuthenticatorStats returns the counts of requests that the named
+// authenticator has been asked to authenticate. See
+// jelly.RESTServer.AuthenticatorStats.
+func (rs *restServer) AuthenticatorStats(name string) jelly.AuthenticatorStats {
+	rs.checkCreatedViaNew()
+	return rs.env.middleProv.AuthenticatorStats(name)
+}
+
+// DBStats returns the statistics on the connection to the named DB. See
+// jelly.RESTServer.DBStats.
+func (rs *restServer) DBStats(db string) jelly.DBStats {
+	rs.checkCreatedViaNew()
+	rs.mtx.Lock()
+	ls := rs.dbs[strings.ToLower(db)]
+	rs.mtx.Unlock()
+
+	if ls == nil {
+		return jelly.DBStats{}
+	}
+	return ls.Stats()
+}
@@ -2,16 +2,167 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/dekarrin/jelly"
 	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/dekarrin/jelly/internal/middle"
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	mock_jelly "github.com/dekarrin/jelly/tools/mocks/jelly"
 )
 
+type helloAPI struct{}
+
+func (helloAPI) Init(jelly.Bundle) error                        { return nil }
+func (helloAPI) Authenticators() map[string]jelly.Authenticator { return nil }
+func (helloAPI) Shutdown(context.Context) error                 { return nil }
+
+func (helloAPI) Routes(jelly.ServiceProvider) (chi.Router, bool) {
+	r := chi.NewRouter()
+	r.Get("/", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	return r, false
+}
+
+func Test_Handler(t *testing.T) {
+	assert := assert.New(t)
+	server := &restServer{
+		mtx:         &sync.Mutex{},
+		apis:        map[string]jelly.API{},
+		apiBases:    map[string]string{},
+		basesToAPIs: map[string]string{},
+		log:         logging.NoOpLogger{},
+		dbs:         map[string]*jelly.LazyStore{},
+		cfg: jelly.Config{
+			APIs: map[string]jelly.APIConfig{
+				"hello": (&jelly.CommonConfig{Name: "hello", Enabled: true, Base: "/hello"}).FillDefaults(),
+			},
+		}.FillDefaults(),
+	}
+	if !assert.NoError(server.Add("hello", helloAPI{})) {
+		return
+	}
+
+	// mount it in a mux of our own to make sure it works when embedded
+	mux := http.NewServeMux()
+	mux.Handle("/", server.Handler())
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/hello", nil))
+
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("hello", w.Body.String())
+}
+
+func Test_WrapHandler(t *testing.T) {
+	testCases := []struct {
+		name         string
+		stripBase    bool
+		path         string
+		expectStatus int
+		expectBody   string
+	}{
+		{name: "full path", path: "/metrics/stats", expectStatus: http.StatusOK, expectBody: "path=/metrics/stats"},
+		{name: "full path base", path: "/metrics/", expectStatus: http.StatusOK, expectBody: "path=/metrics/"},
+		{name: "stripped", stripBase: true, path: "/metrics/stats?q=1", expectStatus: http.StatusOK, expectBody: "path=/stats"},
+		{name: "stripped base", stripBase: true, path: "/metrics/", expectStatus: http.StatusOK, expectBody: "path=/"},
+		{name: "outside base", path: "/other", expectStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			server := &restServer{
+				mtx:         &sync.Mutex{},
+				apis:        map[string]jelly.API{},
+				apiBases:    map[string]string{},
+				basesToAPIs: map[string]string{},
+				log:         logging.NoOpLogger{},
+				dbs:         map[string]*jelly.LazyStore{},
+				cfg: jelly.Config{
+					APIs: map[string]jelly.APIConfig{
+						"metrics": (&jelly.CommonConfig{Name: "metrics", Enabled: true, Base: "/metrics"}).FillDefaults(),
+					},
+				}.FillDefaults(),
+			}
+			h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				fmt.Fprintf(w, "path=%s", req.URL.Path)
+			})
+			if !assert.NoError(server.Add("metrics", jelly.WrapHandler(h, jelly.HandlerOptions{StripBase: tc.stripBase}))) {
+				return
+			}
+
+			w := httptest.NewRecorder()
+			server.Handler().ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+
+			assert.Equal(tc.expectStatus, w.Code)
+			if tc.expectBody != "" {
+				assert.Equal(tc.expectBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_WrapHandler_auth(t *testing.T) {
+	testCases := []struct {
+		name         string
+		auth         jelly.RouteAuth
+		loggedIn     bool
+		expectStatus int
+		expectBody   string
+	}{
+		{name: "no auth", auth: jelly.RouteAuthNone, expectStatus: http.StatusOK, expectBody: "user="},
+		{name: "optional, not logged in", auth: jelly.RouteAuthOptional, expectStatus: http.StatusOK, expectBody: "user="},
+		{name: "optional, logged in", auth: jelly.RouteAuthOptional, loggedIn: true, expectStatus: http.StatusOK, expectBody: "user=terezi"},
+		{name: "required, not logged in", auth: jelly.RouteAuthRequired, expectStatus: http.StatusUnauthorized},
+		{name: "required, logged in", auth: jelly.RouteAuthRequired, loggedIn: true, expectStatus: http.StatusOK, expectBody: "user=terezi"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			mockCtrl := gomock.NewController(t)
+
+			authent := mock_jelly.NewMockAuthenticator(mockCtrl)
+			authent.EXPECT().Authenticate(gomock.Any()).Return(jelly.AuthUser{Username: "terezi"}, tc.loggedIn, nil).AnyTimes()
+			authent.EXPECT().UnauthDelay().Return(time.Duration(0)).AnyTimes()
+
+			p := &middle.Provider{}
+			assert.NoError(p.RegisterAuthenticator("test", authent))
+			sp := endpointCreator{mid: p, log: logging.NoOpLogger{}}
+
+			h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				user, _ := sp.GetLoggedInUser(req)
+				fmt.Fprintf(w, "user=%s", user.Username)
+			})
+			api := jelly.WrapHandler(h, jelly.HandlerOptions{Auth: tc.auth, Authenticators: []string{"test"}})
+			apiRouter, _ := api.Routes(sp)
+
+			r := chi.NewRouter()
+			r.Mount("/wrapped", apiRouter)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/wrapped/anything", nil))
+
+			assert.Equal(tc.expectStatus, w.Code)
+			if tc.expectBody != "" {
+				assert.Equal(tc.expectBody, w.Body.String())
+			}
+		})
+	}
+}
+
 func Test_ServeForever(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping long-running tests that require server up")
@@ -23,7 +174,7 @@ func Test_ServeForever(t *testing.T) {
 			apiBases:    map[string]string{},
 			basesToAPIs: map[string]string{},
 			log:         logging.NoOpLogger{},
-			dbs:         map[string]jelly.Store{},
+			dbs:         map[string]*jelly.LazyStore{},
 			cfg:         jelly.Config{}.FillDefaults(),
 		}
 	}
@@ -78,3 +229,893 @@ func Test_ServeForever(t *testing.T) {
 		assert.ErrorIs(serveForeverError, http.ErrServerClosed)
 	})
 }
+
+func Test_Addr_ephemeralPort(t *testing.T) {
+	assert := assert.New(t)
+	server := &restServer{
+		mtx:         &sync.Mutex{},
+		apis:        map[string]jelly.API{},
+		apiBases:    map[string]string{},
+		basesToAPIs: map[string]string{},
+		log:         logging.NoOpLogger{},
+		dbs:         map[string]*jelly.LazyStore{},
+		cfg: jelly.Config{
+			Globals: jelly.Globals{Address: "127.0.0.1", Port: 0},
+			APIs: map[string]jelly.APIConfig{
+				"hello": (&jelly.CommonConfig{Name: "hello", Enabled: true, Base: "/hello"}).FillDefaults(),
+			},
+		}.FillDefaults(),
+	}
+	if !assert.NoError(server.Add("hello", helloAPI{})) {
+		return
+	}
+	assert.Equal("", server.Addr(), "address before serving")
+
+	retErrChan := make(chan error, 1)
+	go func() {
+		retErrChan <- server.ServeForever()
+	}()
+
+	var addr string
+	for deadline := time.Now().Add(5 * time.Second); addr == "" && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		addr = server.Addr()
+	}
+	if !assert.NotEmpty(addr) {
+		return
+	}
+	assert.NotEqual("127.0.0.1:0", addr)
+
+	resp, err := http.Get("http://" + addr + "/hello")
+	if assert.NoError(err) {
+		resp.Body.Close()
+		assert.Equal(http.StatusOK, resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.NoError(server.Shutdown(ctx))
+	assert.ErrorIs(<-retErrChan, http.ErrServerClosed)
+	assert.Equal("", server.Addr(), "address after shutdown")
+}
+
+type routeInfoAPI struct{ helloAPI }
+
+func (routeInfoAPI) Routes(sp jelly.ServiceProvider) (chi.Router, bool) {
+	ok := func(req *http.Request) jelly.Result { return sp.NoContent() }
+
+	r := chi.NewRouter()
+	r.Get("/plain", func(w http.ResponseWriter, req *http.Request) {})
+	r.Get("/public", sp.Endpoint(ok))
+	r.With(sp.OptionalAuth()).Get("/optional", sp.Endpoint(ok, jelly.Override{Fields: true}))
+	r.Group(func(r chi.Router) {
+		r.Use(sp.DontPanic())
+		r.Use(sp.RequiredAuth())
+		r.Get("/private", sp.Endpoint(ok, jelly.Override{Scopes: []string{"read"}}, jelly.Override{Scopes: []string{"write"}}))
+	})
+	return r, false
+}
+
+func Test_Routes(t *testing.T) {
+	assert := assert.New(t)
+	server := &restServer{
+		mtx:         &sync.Mutex{},
+		apis:        map[string]jelly.API{},
+		apiBases:    map[string]string{},
+		basesToAPIs: map[string]string{},
+		log:         logging.NoOpLogger{},
+		dbs:         map[string]*jelly.LazyStore{},
+		cfg: jelly.Config{
+			APIs: map[string]jelly.APIConfig{
+				"things": (&jelly.CommonConfig{Name: "things", Enabled: true, Base: "/things"}).FillDefaults(),
+			},
+		}.FillDefaults(),
+	}
+	if !assert.NoError(server.Add("things", routeInfoAPI{})) {
+		return
+	}
+
+	routes := map[string]jelly.RouteInfo{}
+	for _, ri := range server.Routes() {
+		assert.Equal("things", ri.API)
+		assert.Equal(http.MethodGet, ri.Method)
+		routes[ri.Path] = ri
+	}
+	if !assert.Len(routes, 4) {
+		return
+	}
+
+	plain := routes["/things/plain"]
+	assert.Nil(plain.Override)
+	assert.False(plain.AuthRequired)
+	assert.False(plain.AuthOptional)
+	assert.Empty(plain.Middleware)
+
+	public := routes["/things/public"]
+	assert.Equal(&jelly.Override{}, public.Override)
+	assert.False(public.AuthRequired)
+	assert.False(public.AuthOptional)
+
+	optional := routes["/things/optional"]
+	assert.Equal(&jelly.Override{Fields: true}, optional.Override)
+	assert.False(optional.AuthRequired)
+	assert.True(optional.AuthOptional)
+	assert.Equal([]string{"OptionalAuth"}, optional.Middleware)
+
+	private := routes["/things/private"]
+	assert.Equal(&jelly.Override{Scopes: []string{"read", "write"}}, private.Override)
+	assert.True(private.AuthRequired)
+	assert.False(private.AuthOptional)
+	assert.Equal([]string{"middle.Provider.DontPanic", "RequiredAuth"}, private.Middleware)
+}
+
+type tableAPI struct{ helloAPI }
+
+func (tableAPI) Routes(sp jelly.ServiceProvider) (chi.Router, bool) {
+	ok := func(req *http.Request) jelly.Result { return sp.NoContent() }
+
+	return jelly.RouteTable{
+		{Method: "get", Path: "/", Handler: ok},
+		{Method: "POST", Path: "/", Handler: ok, Auth: jelly.RouteAuthRequired, Override: jelly.Override{Request: "thing"}},
+		{Method: "GET", Path: "/{id:uuid}", Handler: ok, Auth: jelly.RouteAuthOptional, Middleware: []jelly.Middleware{sp.DontPanic()},
+			Override: jelly.Override{Summary: "Get a thing.", Response: "thing"}},
+	}.Router(sp), false
+}
+
+func Test_Routes_table(t *testing.T) {
+	assert := assert.New(t)
+	server := &restServer{
+		mtx:         &sync.Mutex{},
+		apis:        map[string]jelly.API{},
+		apiBases:    map[string]string{},
+		basesToAPIs: map[string]string{},
+		log:         logging.NoOpLogger{},
+		dbs:         map[string]*jelly.LazyStore{},
+		cfg: jelly.Config{
+			APIs: map[string]jelly.APIConfig{
+				"things": (&jelly.CommonConfig{Name: "things", Enabled: true, Base: "/things"}).FillDefaults(),
+			},
+		}.FillDefaults(),
+	}
+	if !assert.NoError(server.Add("things", tableAPI{})) {
+		return
+	}
+
+	routes := map[string]jelly.RouteInfo{}
+	for _, ri := range server.Routes() {
+		routes[ri.Method+" "+ri.Path] = ri
+	}
+	if !assert.Len(routes, 3) {
+		return
+	}
+
+	getAll := routes["GET /things/"]
+	assert.Equal(&jelly.Override{}, getAll.Override)
+	assert.False(getAll.AuthRequired)
+	assert.Empty(getAll.Middleware)
+
+	create := routes["POST /things/"]
+	assert.Equal(&jelly.Override{Request: "thing"}, create.Override)
+	assert.True(create.AuthRequired)
+	assert.Equal([]string{"RequiredAuth"}, create.Middleware)
+
+	get := routes["GET /things/{id:uuid}"]
+	assert.Equal(&jelly.Override{Summary: "Get a thing.", Response: "thing"}, get.Override)
+	assert.True(get.AuthOptional)
+	assert.Equal([]string{"OptionalAuth", "middle.Provider.DontPanic"}, get.Middleware)
+}
+
+func Test_RouteTable_Router_invalid(t *testing.T) {
+	sp := endpointCreator{mid: &middle.Provider{}, log: logging.NoOpLogger{}}
+	ok := func(req *http.Request) jelly.Result { return sp.NoContent() }
+
+	testCases := []struct {
+		name  string
+		table jelly.RouteTable
+	}{
+		{name: "no method", table: jelly.RouteTable{{Path: "/", Handler: ok}}},
+		{name: "no path", table: jelly.RouteTable{{Method: "GET", Handler: ok}}},
+		{name: "no handler", table: jelly.RouteTable{{Method: "GET", Path: "/"}}},
+		{name: "duplicate", table: jelly.RouteTable{{Method: "GET", Path: "/{id:uuid}", Handler: ok}, {Method: "get", Path: "/{id:uuid}", Handler: ok}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Panics(t, func() { tc.table.Router(sp) })
+		})
+	}
+}
+
+type deprecatedAPI struct{ helloAPI }
+
+func (deprecatedAPI) Routes(sp jelly.ServiceProvider) (chi.Router, bool) {
+	ok := func(req *http.Request) jelly.Result { return sp.NoContent() }
+
+	r := chi.NewRouter()
+	r.Get("/old", sp.Endpoint(ok, jelly.Override{Deprecated: &jelly.Deprecation{
+		Since:       time.Unix(1700000000, 0),
+		Sunset:      time.Date(2030, time.January, 2, 0, 0, 0, 0, time.UTC),
+		Replacement: "/things/new",
+	}}))
+	r.Post("/old", sp.Endpoint(ok, jelly.Override{Deprecated: &jelly.Deprecation{}}))
+	r.Get("/new", sp.Endpoint(ok))
+	return r, false
+}
+
+func Test_deprecatedEndpoint(t *testing.T) {
+	server := &restServer{
+		mtx:         &sync.Mutex{},
+		apis:        map[string]jelly.API{},
+		apiBases:    map[string]string{},
+		basesToAPIs: map[string]string{},
+		log:         logging.NoOpLogger{},
+		dbs:         map[string]*jelly.LazyStore{},
+		cfg: jelly.Config{
+			APIs: map[string]jelly.APIConfig{
+				"things": (&jelly.CommonConfig{Name: "things", Enabled: true, Base: "/things"}).FillDefaults(),
+			},
+		}.FillDefaults(),
+	}
+	if !assert.NoError(t, server.Add("things", deprecatedAPI{})) {
+		return
+	}
+	h := server.Handler()
+
+	t.Run("headers", func(t *testing.T) {
+		assert := assert.New(t)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/things/old", nil))
+
+		assert.Equal(http.StatusNoContent, w.Code)
+		assert.Equal("@1700000000", w.Header().Get("Deprecation"))
+		assert.Equal("Wed, 02 Jan 2030 00:00:00 GMT", w.Header().Get("Sunset"))
+		assert.Equal(`</things/new>; rel="successor-version"`, w.Header().Get("Link"))
+	})
+
+	t.Run("headers without details", func(t *testing.T) {
+		assert := assert.New(t)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/things/old", nil))
+
+		assert.Equal("true", w.Header().Get("Deprecation"))
+		assert.Empty(w.Header().Get("Sunset"))
+		assert.Empty(w.Header().Get("Link"))
+	})
+
+	t.Run("not deprecated", func(t *testing.T) {
+		assert := assert.New(t)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/things/new", nil))
+
+		assert.Empty(w.Header().Get("Deprecation"))
+	})
+
+	t.Run("usage is counted", func(t *testing.T) {
+		assert := assert.New(t)
+
+		before := server.deprecations.record("GET", "/things/old")
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/things/old", nil))
+		assert.Equal(before+2, server.deprecations.record("GET", "/things/old"))
+	})
+
+	t.Run("flagged in index", func(t *testing.T) {
+		assert := assert.New(t)
+
+		index := server.RoutesIndex()
+		assert.Contains(index, "* /things/old - GET (deprecated), POST (deprecated)")
+		assert.Contains(index, "* /things/new - GET\n")
+	})
+}
+
+type toggledAPI struct {
+	helloAPI
+	inits     *int
+	shutdowns *int
+}
+
+func (api toggledAPI) Init(jelly.Bundle) error {
+	*api.inits++
+	return nil
+}
+
+func (api toggledAPI) Shutdown(context.Context) error {
+	*api.shutdowns++
+	return nil
+}
+
+func Test_DisableAPI(t *testing.T) {
+	assert := assert.New(t)
+	var inits, shutdowns int
+	server := &restServer{
+		mtx:         &sync.Mutex{},
+		apis:        map[string]jelly.API{},
+		apiBases:    map[string]string{},
+		basesToAPIs: map[string]string{},
+		log:         logging.NoOpLogger{},
+		dbs:         map[string]*jelly.LazyStore{},
+		cfg: jelly.Config{
+			APIs: map[string]jelly.APIConfig{
+				"hello": (&jelly.CommonConfig{Name: "hello", Enabled: true, Base: "/hello"}).FillDefaults(),
+			},
+		}.FillDefaults(),
+	}
+	if !assert.NoError(server.Add("hello", toggledAPI{inits: &inits, shutdowns: &shutdowns})) {
+		return
+	}
+	h := server.Handler()
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/hello", nil))
+		return w
+	}
+
+	assert.Equal(http.StatusOK, get().Code)
+
+	// disable
+	assert.NoError(server.DisableAPI(context.Background(), "Hello"))
+	assert.Equal(1, shutdowns)
+	assert.Equal([]string{"hello"}, server.DisabledAPIs())
+	assert.Equal(http.StatusServiceUnavailable, get().Code)
+	assert.Error(server.DisableAPI(context.Background(), "hello"), "already disabled")
+
+	// routes are still listed while disabled
+	assert.Len(server.Routes(), 1)
+
+	// re-enable
+	assert.NoError(server.EnableAPI("hello"))
+	assert.Equal(2, inits)
+	assert.Empty(server.DisabledAPIs())
+	w := get()
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("hello", w.Body.String())
+	assert.Error(server.EnableAPI("hello"), "not disabled")
+
+	assert.Error(server.DisableAPI(context.Background(), "nope"))
+
+	// a disabled API is not shut down again with the server
+	assert.NoError(server.DisableAPI(context.Background(), "hello"))
+	assert.NoError(server.Shutdown(context.Background()))
+	assert.Equal(2, shutdowns)
+}
+
+// slowInitAPI is an API whose Init blocks until release is closed once block
+// is set, and whose routes are removed once noRoutes is set.
+type slowInitAPI struct {
+	helloAPI
+	block     *bool
+	noRoutes  *bool
+	initing   chan struct{}
+	release   chan struct{}
+	shutdowns *int
+}
+
+func (api slowInitAPI) Init(jelly.Bundle) error {
+	if *api.block {
+		close(api.initing)
+		<-api.release
+	}
+	return nil
+}
+
+func (api slowInitAPI) Routes(sp jelly.ServiceProvider) (chi.Router, bool) {
+	if *api.noRoutes {
+		return nil, false
+	}
+	return api.helloAPI.Routes(sp)
+}
+
+func (api slowInitAPI) Shutdown(context.Context) error {
+	*api.shutdowns++
+	return nil
+}
+
+func Test_EnableAPI(t *testing.T) {
+	setup := func(t *testing.T) (*restServer, slowInitAPI, http.Handler) {
+		server := &restServer{
+			mtx:         &sync.Mutex{},
+			apis:        map[string]jelly.API{},
+			apiBases:    map[string]string{},
+			basesToAPIs: map[string]string{},
+			log:         logging.NoOpLogger{},
+			dbs:         map[string]*jelly.LazyStore{},
+			cfg: jelly.Config{
+				APIs: map[string]jelly.APIConfig{
+					"hello": (&jelly.CommonConfig{Name: "hello", Enabled: true, Base: "/hello"}).FillDefaults(),
+				},
+			}.FillDefaults(),
+		}
+		api := slowInitAPI{
+			block:     new(bool),
+			noRoutes:  new(bool),
+			initing:   make(chan struct{}),
+			release:   make(chan struct{}),
+			shutdowns: new(int),
+		}
+		if err := server.Add("hello", api); err != nil {
+			t.Fatal(err)
+		}
+		h := server.Handler()
+		if err := server.DisableAPI(context.Background(), "hello"); err != nil {
+			t.Fatal(err)
+		}
+		return server, api, h
+	}
+
+	get := func(h http.Handler) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/hello", nil))
+		return w.Code
+	}
+
+	t.Run("disabled until Init returns", func(t *testing.T) {
+		assert := assert.New(t)
+		server, api, h := setup(t)
+		*api.block = true
+
+		enableErr := make(chan error)
+		go func() {
+			enableErr <- server.EnableAPI("hello")
+		}()
+		<-api.initing
+
+		// the server is not locked during Init
+		assert.Equal([]string{"hello"}, server.DisabledAPIs())
+		assert.Equal(http.StatusServiceUnavailable, get(h))
+		assert.Error(server.EnableAPI("hello"), "already being enabled")
+		assert.Error(server.DisableAPI(context.Background(), "hello"), "already disabled")
+
+		close(api.release)
+		assert.NoError(<-enableErr)
+		assert.Empty(server.DisabledAPIs())
+		assert.Equal(http.StatusOK, get(h))
+	})
+
+	t.Run("server shut down during Init", func(t *testing.T) {
+		assert := assert.New(t)
+		server, api, h := setup(t)
+		*api.block = true
+
+		enableErr := make(chan error)
+		go func() {
+			enableErr <- server.EnableAPI("hello")
+		}()
+		<-api.initing
+
+		assert.NoError(server.Shutdown(context.Background()))
+		assert.Equal(1, *api.shutdowns)
+
+		close(api.release)
+		assert.Error(<-enableErr)
+		assert.Equal(2, *api.shutdowns)
+		assert.Equal([]string{"hello"}, server.DisabledAPIs())
+		assert.Equal(http.StatusServiceUnavailable, get(h))
+	})
+
+	t.Run("no routes once enabled", func(t *testing.T) {
+		assert := assert.New(t)
+		server, api, h := setup(t)
+		*api.noRoutes = true
+
+		assert.NoError(server.EnableAPI("hello"))
+		assert.Empty(server.DisabledAPIs())
+		assert.Equal(http.StatusNotFound, get(h))
+	})
+}
+
+type goAPI struct {
+	helloAPI
+	started chan struct{}
+	stopped chan struct{}
+}
+
+func (api goAPI) Init(bndl jelly.Bundle) error {
+	bndl.Go(func(ctx context.Context) {
+		close(api.started)
+		<-ctx.Done()
+		close(api.stopped)
+	})
+	return nil
+}
+
+func Test_Usage(t *testing.T) {
+	assert := assert.New(t)
+	server := &restServer{
+		mtx:         &sync.Mutex{},
+		apis:        map[string]jelly.API{},
+		apiBases:    map[string]string{},
+		basesToAPIs: map[string]string{},
+		log:         logging.NoOpLogger{},
+		dbs:         map[string]*jelly.LazyStore{},
+		cfg: jelly.Config{
+			APIs: map[string]jelly.APIConfig{
+				"hello": (&jelly.CommonConfig{Name: "hello", Enabled: true, Base: "/hello"}).FillDefaults(),
+			},
+		}.FillDefaults(),
+	}
+	api := goAPI{started: make(chan struct{}), stopped: make(chan struct{})}
+	if !assert.NoError(server.Add("hello", api)) {
+		return
+	}
+	<-api.started
+	h := server.Handler()
+
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hello", nil))
+	}
+
+	usage := server.Usage("Hello")
+	assert.Equal(int64(3), usage.Requests)
+	assert.Equal(int64(0), usage.InFlight)
+	assert.Equal(int64(1), usage.Goroutines)
+	assert.Equal(int64(1), usage.GoroutinesStarted)
+	assert.Equal(jelly.APIUsage{}, server.Usage("nope"))
+
+	// requests made while disabled are not counted, and the goroutines of the
+	// API are told to stop
+	assert.NoError(server.DisableAPI(context.Background(), "hello"))
+	<-api.stopped
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/hello", nil))
+	assert.Equal(int64(3), server.Usage("hello").Requests)
+}
+
+func Test_NewServer_connectPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	connected := map[string]int{}
+	var mtx sync.Mutex
+	env := &Environment{}
+	env.RegisterConnector(jelly.DatabaseInMemory, "counted", func(cfg jelly.DatabaseConfig) (jelly.Store, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		connected[string(cfg.Connect)]++
+		return pingStore{pinged: new(bool)}, nil
+	})
+
+	cfg := jelly.Config{
+		DBs: map[string]jelly.DatabaseConfig{
+			"main":    {Type: jelly.DatabaseInMemory, Connector: "counted"},
+			"cache":   {Type: jelly.DatabaseInMemory, Connector: "counted", Connect: jelly.ConnectLazy},
+			"reports": {Type: jelly.DatabaseInMemory, Connector: "counted", Connect: jelly.ConnectOnFirstUse, ConnectTimeoutMillis: 1000},
+		},
+		APIs: map[string]jelly.APIConfig{
+			"hello": (&jelly.CommonConfig{Name: "hello", Enabled: true, Base: "/hello", UsesDBs: []string{"main", "reports"}}).FillDefaults(),
+		},
+	}
+	srv, err := env.NewServer(&cfg)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.True(srv.DBStats("main").Connected)
+	assert.Eventually(func() bool { return srv.DBStats("cache").Connected }, time.Second, time.Millisecond)
+	assert.Equal(jelly.DBStats{Policy: jelly.ConnectOnFirstUse}, srv.DBStats("reports"))
+
+	var bndl jelly.Bundle
+	if !assert.NoError(srv.Add("hello", bundleAPI{bndl: &bndl})) {
+		return
+	}
+	assert.False(srv.DBStats("reports").Connected, "adding an API connected to its first-use DB")
+
+	store, err := bndl.LazyDBNamed("reports").Get(context.Background())
+	assert.NoError(err)
+	assert.NotNil(store)
+
+	stats := srv.DBStats("reports")
+	assert.True(stats.Connected)
+	assert.Equal(int64(1), stats.Opens)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	assert.Equal(map[string]int{"eager": 1, "lazy": 1, "first-use": 1}, connected)
+}
+
+func Test_NewServer_replicas(t *testing.T) {
+	assert := assert.New(t)
+
+	var decorated []string
+	env := &Environment{}
+	env.RegisterConnector(jelly.DatabaseInMemory, "dirs", func(cfg jelly.DatabaseConfig) (jelly.Store, error) {
+		return dirStore(cfg.DataDir), nil
+	})
+	env.DecorateStores(func(db string, store jelly.Store) (jelly.Store, error) {
+		decorated = append(decorated, db+":"+string(store.(dirStore)))
+		return store, nil
+	})
+
+	cfg := jelly.Config{
+		DBs: map[string]jelly.DatabaseConfig{
+			"main": {
+				Type:      jelly.DatabaseInMemory,
+				Connector: "dirs",
+				DataDir:   "primary",
+				Replicas:  []jelly.ReplicaConfig{{DataDir: "replica-a"}, {DataDir: "replica-b"}},
+			},
+		},
+		APIs: map[string]jelly.APIConfig{
+			"hello": (&jelly.CommonConfig{Name: "hello", Enabled: true, Base: "/hello", UsesDBs: []string{"main"}}).FillDefaults(),
+		},
+	}
+	srv, err := env.NewServer(&cfg)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal([]string{"main:primary", "main:replica-a", "main:replica-b"}, decorated)
+
+	var bndl jelly.Bundle
+	if !assert.NoError(srv.Add("hello", bundleAPI{bndl: &bndl})) {
+		return
+	}
+	assert.Equal(dirStore("primary"), bndl.DB(0))
+
+	rs := bndl.ReplicatedDB(0)
+	if !assert.NotNil(rs) {
+		return
+	}
+	assert.Equal(dirStore("primary"), rs.WriteStore())
+	assert.Equal(dirStore("replica-a"), rs.ReadStore())
+	assert.Equal(dirStore("replica-b"), rs.ReadStore())
+
+	plan, _ := srv.Plan()
+	if assert.Len(plan.DBs, 1) {
+		assert.Equal(2, plan.DBs[0].Replicas)
+	}
+}
+
+// dirStore is a Store that is just the DataDir it was connected with.
+type dirStore string
+
+func (dirStore) Close() error { return nil }
+
+func Test_NewServer_usesByTag(t *testing.T) {
+	assert := assert.New(t)
+
+	env := &Environment{}
+	env.RegisterConnector(jelly.DatabaseInMemory, "dirs", func(cfg jelly.DatabaseConfig) (jelly.Store, error) {
+		return dirStore(cfg.DataDir), nil
+	})
+
+	cfg := jelly.Config{
+		DBs: map[string]jelly.DatabaseConfig{
+			"main":         {Type: jelly.DatabaseInMemory, Connector: "dirs", DataDir: "main"},
+			"events_2024":  {Type: jelly.DatabaseInMemory, Connector: "dirs", DataDir: "events_2024", Tags: []string{"analytics"}},
+			"clicks":       {Type: jelly.DatabaseInMemory, Connector: "dirs", DataDir: "clicks", Tags: []string{"Analytics"}},
+			"events_2023":  {Type: jelly.DatabaseInMemory, Connector: "dirs", DataDir: "events_2023"},
+			"unrelated_db": {Type: jelly.DatabaseInMemory, Connector: "dirs", DataDir: "unrelated_db"},
+		},
+		APIs: map[string]jelly.APIConfig{
+			"hello": (&jelly.CommonConfig{Name: "hello", Enabled: true, Base: "/hello", UsesDBs: []string{"main", "tag:analytics", "events_*"}}).FillDefaults(),
+		},
+	}
+	srv, err := env.NewServer(&cfg)
+	if !assert.NoError(err) {
+		return
+	}
+
+	var bndl jelly.Bundle
+	if !assert.NoError(srv.Add("hello", bundleAPI{bndl: &bndl})) {
+		return
+	}
+	assert.Equal([]string{"main", "clicks", "events_2024", "events_2023"}, bndl.UsesDBs())
+	assert.Equal(dirStore("clicks"), bndl.DB(1))
+	assert.Equal(dirStore("events_2023"), bndl.DB(3))
+	assert.Nil(bndl.DBNamed("unrelated_db"))
+
+	plan, _ := srv.Plan()
+	if assert.Len(plan.APIs, 1) {
+		assert.Equal([]string{"main", "clicks", "events_2024", "events_2023"}, plan.APIs[0].UsesDBs)
+	}
+}
+
+func Test_ObserveLifecycle(t *testing.T) {
+	assert := assert.New(t)
+
+	var mtx sync.Mutex
+	var steps []string
+	record := func(step string) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		steps = append(steps, step)
+	}
+	listening := make(chan string, 1)
+
+	env := &Environment{}
+	env.RegisterConnector(jelly.DatabaseInMemory, "dirs", func(cfg jelly.DatabaseConfig) (jelly.Store, error) {
+		return dirStore(cfg.DataDir), nil
+	})
+	env.ObserveLifecycle(jelly.LifecycleObserverFuncs{
+		DBConnected: func(name string) { record("db " + name) },
+		APIInit: func(name string, err error) {
+			record(fmt.Sprintf("init %s: %v", name, err))
+		},
+		Listen: func(addr string) {
+			record("listen")
+			listening <- addr
+		},
+		ShutdownBegin: func() { record("shutdown begin") },
+		ShutdownEnd: func(err error) {
+			record(fmt.Sprintf("shutdown end: %v", err))
+		},
+	}, nil)
+
+	cfg := jelly.Config{
+		Globals: jelly.Globals{Address: "127.0.0.1", Port: 0},
+		DBs: map[string]jelly.DatabaseConfig{
+			"main": {Type: jelly.DatabaseInMemory, Connector: "dirs", DataDir: "main"},
+		},
+		APIs: map[string]jelly.APIConfig{
+			"hello": (&jelly.CommonConfig{Name: "hello", Enabled: true, Base: "/hello"}).FillDefaults(),
+		},
+	}
+	srv, err := env.NewServer(&cfg)
+	if !assert.NoError(err) {
+		return
+	}
+	if !assert.NoError(srv.Add("hello", helloAPI{})) {
+		return
+	}
+
+	retErrChan := make(chan error, 1)
+	go func() {
+		retErrChan <- srv.ServeForever()
+	}()
+
+	select {
+	case addr := <-listening:
+		assert.Equal(srv.Addr(), addr)
+	case err := <-retErrChan:
+		t.Fatalf("server stopped before listening: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not listen")
+	}
+
+	assert.NoError(srv.Shutdown(context.Background()))
+	assert.ErrorIs(<-retErrChan, http.ErrServerClosed)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	assert.Equal([]string{
+		"db main",
+		"init hello: <nil>",
+		"listen",
+		"shutdown begin",
+		"shutdown end: <nil>",
+	}, steps)
+}
+
+// failingInitAPI is a helloAPI whose Init fails.
+type failingInitAPI struct {
+	helloAPI
+}
+
+func (failingInitAPI) Init(jelly.Bundle) error {
+	return errors.New("missing template")
+}
+
+func Test_NewServer_startupReport(t *testing.T) {
+	env := &Environment{}
+	env.RegisterConnector(jelly.DatabaseInMemory, "dirs", func(cfg jelly.DatabaseConfig) (jelly.Store, error) {
+		return dirStore(cfg.DataDir), nil
+	})
+
+	t.Run("bad config", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cfg := jelly.Config{Globals: jelly.Globals{Port: -1}}
+		_, err := env.NewServer(&cfg)
+
+		var se *jelly.StartupError
+		if !assert.True(errors.As(err, &se), "error is not a StartupError: %v", err) {
+			return
+		}
+		if assert.Len(se.Report.Phases, 1) {
+			assert.Equal(jelly.StartupConfig, se.Report.Phases[0].Kind)
+			assert.EqualError(se.Report.Phases[0].Err, "config: port: must not be negative")
+		}
+	})
+
+	t.Run("API init fails", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cfg := jelly.Config{
+			DBs: map[string]jelly.DatabaseConfig{
+				"main":    {Type: jelly.DatabaseInMemory, Connector: "dirs", DataDir: "main"},
+				"reports": {Type: jelly.DatabaseInMemory, Connector: "dirs", DataDir: "reports", Connect: jelly.ConnectOnFirstUse},
+			},
+			APIs: map[string]jelly.APIConfig{
+				"hello": (&jelly.CommonConfig{Name: "hello", Enabled: true, Base: "/hello"}).FillDefaults(),
+			},
+		}
+		srv, err := env.NewServer(&cfg)
+		if !assert.NoError(err) {
+			return
+		}
+		err = srv.Add("hello", failingInitAPI{})
+
+		var se *jelly.StartupError
+		if !assert.True(errors.As(err, &se), "error is not a StartupError: %v", err) {
+			return
+		}
+		assert.EqualError(err, `init API "hello": Init(): missing template`)
+
+		var phases []string
+		for _, p := range se.Report.Phases {
+			phases = append(phases, fmt.Sprintf("%s: %v", p, p.Err))
+		}
+		assert.Equal([]string{
+			"config: <nil>",
+			"db main: <nil>",
+			"quota: <nil>",
+			"i18n: <nil>",
+			`api hello: init API "hello": Init(): missing template`,
+		}, phases)
+	})
+}
+
+// closeCountStore is a jelly.Store that counts the times it is closed.
+type closeCountStore struct {
+	closes *int
+}
+
+func (s closeCountStore) Close() error {
+	*s.closes++
+	return nil
+}
+
+// brokenComponent is a component whose API cannot be initialized.
+type brokenComponent struct{}
+
+func (brokenComponent) Name() string            { return "broken" }
+func (brokenComponent) API() jelly.API          { return failingAPI{} }
+func (brokenComponent) Config() jelly.APIConfig { return &jelly.CommonConfig{} }
+
+func Test_NewServer_closesDBsOnError(t *testing.T) {
+	testCases := []struct {
+		name      string
+		i18n      jelly.I18nConfig
+		component jelly.Component
+		expectErr string
+	}{
+		{
+			name:      "i18n catalog cannot be loaded",
+			i18n:      jelly.I18nConfig{Catalogs: []string{filepath.Join(t.TempDir(), "missing.yml")}},
+			expectErr: "i18n",
+		},
+		{
+			name:      "component API cannot be added",
+			component: brokenComponent{},
+			expectErr: "component API broken",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			var closes int
+
+			env := &Environment{}
+			env.RegisterConnector(jelly.DatabaseInMemory, "counted", func(cfg jelly.DatabaseConfig) (jelly.Store, error) {
+				return closeCountStore{closes: &closes}, nil
+			})
+			cfg := jelly.Config{
+				DBs: map[string]jelly.DatabaseConfig{
+					"main": {Type: jelly.DatabaseInMemory, Connector: "counted"},
+				},
+				APIs: map[string]jelly.APIConfig{},
+			}
+			cfg.Globals.I18n = tc.i18n
+			if tc.component != nil {
+				env.UseComponent(tc.component)
+				cfg.APIs[tc.component.Name()] = (&jelly.CommonConfig{Name: tc.component.Name(), Enabled: true, Base: "/" + tc.component.Name()}).FillDefaults()
+			}
+
+			_, err := env.NewServer(&cfg)
+
+			assert.ErrorContains(err, tc.expectErr)
+			assert.Equal(1, closes, "DB was not closed")
+		})
+	}
+}
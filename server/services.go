@@ -0,0 +1,147 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dekarrin/jelly"
+)
+
+// serviceRegistry holds the APIs that have been initialized, for looking up
+// their services with jelly.Bundle.Service. It has its own lock because
+// services are looked up by APIs during Init, while the server's lock is held.
+type serviceRegistry struct {
+	mtx  sync.RWMutex
+	apis map[string]jelly.API
+}
+
+func (reg *serviceRegistry) add(name string, api jelly.API) {
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+
+	if reg.apis == nil {
+		reg.apis = map[string]jelly.API{}
+	}
+	reg.apis[name] = api
+}
+
+// service returns the service of the named API. It is the
+// jelly.ServiceLocator of every Bundle given to an API.
+func (reg *serviceRegistry) service(name string) (interface{}, error) {
+	name = strings.ToLower(name)
+
+	reg.mtx.RLock()
+	api, ok := reg.apis[name]
+	reg.mtx.RUnlock()
+
+	if !ok {
+		return nil, jelly.NewError(fmt.Sprintf("API %q does not exist or has not been initialized", name), jelly.ErrNotFound)
+	}
+	svcAPI, ok := api.(jelly.ServiceAPI)
+	if !ok {
+		return nil, jelly.NewError(fmt.Sprintf("API %q does not provide a service", name), jelly.ErrNotFound)
+	}
+	return svcAPI.ProvidedService(), nil
+}
+
+// initialized returns whether the named API has been initialized. rs.mtx must
+// be held by the caller.
+func (rs *restServer) initialized(name string) bool {
+	_, ok := rs.apiBases[name]
+	return ok
+}
+
+// dependencies returns the normalized names of the APIs that api depends on,
+// if it is a jelly.DependentAPI. An error is returned if it depends on itself,
+// on an API that was added but is not enabled, or on an API that is waiting on
+// it. rs.mtx must be held by the caller.
+func (rs *restServer) dependencies(name string, api jelly.API) ([]string, error) {
+	depAPI, ok := api.(jelly.DependentAPI)
+	if !ok {
+		return nil, nil
+	}
+
+	var deps []string
+	for _, dep := range depAPI.DependsOn() {
+		dep = strings.ToLower(dep)
+		if dep == name {
+			return nil, fmt.Errorf("API %q depends on itself", name)
+		}
+		if _, added := rs.apis[dep]; added && !rs.getAPIConfigBundle(dep).Enabled() {
+			return nil, fmt.Errorf("API %q depends on API %q, which is not enabled", name, dep)
+		}
+		if rs.waitsOn(dep, name, map[string]bool{}) {
+			return nil, fmt.Errorf("API %q and API %q depend on each other", name, dep)
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// waitsOn returns whether the pending API called name is waiting on target,
+// directly or through the APIs that it waits on. rs.mtx must be held by the
+// caller.
+func (rs *restServer) waitsOn(name, target string, seen map[string]bool) bool {
+	if seen[name] {
+		return false
+	}
+	seen[name] = true
+
+	for _, dep := range rs.pending[name] {
+		if dep == target || rs.waitsOn(dep, target, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// ready returns whether every API in deps has been initialized. rs.mtx must
+// be held by the caller.
+func (rs *restServer) ready(deps []string) bool {
+	for _, dep := range deps {
+		if !rs.initialized(dep) {
+			return false
+		}
+	}
+	return true
+}
+
+// initPending initializes every pending API whose dependencies have all been
+// initialized, in the order that they were added, until no more can be.
+// rs.mtx must be held by the caller.
+func (rs *restServer) initPending(env *Environment) error {
+	for progressed := true; progressed; {
+		progressed = false
+		for _, name := range rs.apiOrder {
+			deps, ok := rs.pending[name]
+			if !ok || !rs.ready(deps) {
+				continue
+			}
+
+			delete(rs.pending, name)
+			rs.log.Debugf("Dependencies of API %q are initialized; initializing...", name)
+			if err := rs.initAndRegister(env, name, rs.apis[name]); err != nil {
+				return err
+			}
+			progressed = true
+		}
+	}
+	return nil
+}
+
+// checkPending returns an error if any enabled API is still waiting on an API
+// that will never be initialized. rs.mtx must be held by the caller.
+func (rs *restServer) checkPending() error {
+	for _, name := range rs.apiOrder {
+		for _, dep := range rs.pending[name] {
+			if _, added := rs.apis[dep]; !added {
+				return fmt.Errorf("API %q depends on API %q, which was never added", name, dep)
+			}
+			if _, waiting := rs.pending[dep]; !waiting && !rs.initialized(dep) {
+				return fmt.Errorf("API %q depends on API %q, which is not enabled or failed to initialize", name, dep)
+			}
+		}
+	}
+	return nil
+}
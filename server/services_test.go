@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// greeterAPI provides a greeting service and can depend on other APIs.
+type greeterAPI struct {
+	greeting string
+	deps     []string
+
+	// got is the service of each dependency, as gotten during Init.
+	got map[string]interface{}
+
+	// name is appended to log when the API is initialized and shut down.
+	name string
+	log  *[]string
+}
+
+func (g *greeterAPI) Init(b jelly.Bundle) error {
+	g.got = map[string]interface{}{}
+	for _, dep := range g.deps {
+		svc, err := b.Service(dep)
+		if err != nil {
+			return err
+		}
+		g.got[dep] = svc
+	}
+	*g.log = append(*g.log, "init "+g.name)
+	return nil
+}
+
+func (g *greeterAPI) Authenticators() map[string]jelly.Authenticator  { return nil }
+func (g *greeterAPI) Routes(jelly.ServiceProvider) (chi.Router, bool) { return nil, false }
+func (g *greeterAPI) ProvidedService() interface{}                    { return g.greeting }
+func (g *greeterAPI) DependsOn() []string                             { return g.deps }
+
+func (g *greeterAPI) Shutdown(context.Context) error {
+	*g.log = append(*g.log, "shutdown "+g.name)
+	return nil
+}
+
+func newServicesTestServer(names ...string) *restServer {
+	apis := map[string]jelly.APIConfig{}
+	for _, n := range names {
+		apis[n] = (&jelly.CommonConfig{Name: n, Enabled: true, Base: "/" + n}).FillDefaults()
+	}
+	return &restServer{
+		mtx:         &sync.Mutex{},
+		apis:        map[string]jelly.API{},
+		apiBases:    map[string]string{},
+		basesToAPIs: map[string]string{},
+		log:         logging.NoOpLogger{},
+		dbs:         map[string]*jelly.LazyStore{},
+		cfg:         jelly.Config{APIs: apis}.FillDefaults(),
+	}
+}
+
+func Test_restServer_Add_dependencies(t *testing.T) {
+	assert := assert.New(t)
+	server := newServicesTestServer("users", "greeter", "mailer")
+
+	var log []string
+	mailer := &greeterAPI{name: "mailer", greeting: "mail", deps: []string{"greeter", "users"}, log: &log}
+	greeter := &greeterAPI{name: "greeter", greeting: "hello", deps: []string{"Users"}, log: &log}
+	users := &greeterAPI{name: "users", greeting: "users", log: &log}
+
+	// added in the reverse of the order they must be initialized in
+	assert.NoError(server.Add("mailer", mailer))
+	assert.NoError(server.Add("greeter", greeter))
+	assert.Empty(log)
+	assert.NoError(server.Add("users", users))
+
+	assert.Equal([]string{"init users", "init greeter", "init mailer"}, log)
+	assert.Equal(map[string]interface{}{"Users": "users"}, greeter.got)
+	assert.Equal(map[string]interface{}{"greeter": "hello", "users": "users"}, mailer.got)
+	assert.NoError(server.checkPending())
+
+	// every service is available after Init
+	svc, err := jelly.ServiceAs[string](server.apiBundles["users"], "mailer")
+	assert.NoError(err)
+	assert.Equal("mail", svc)
+
+	_, err = jelly.ServiceAs[int](server.apiBundles["users"], "mailer")
+	assert.Error(err)
+
+	_, err = server.apiBundles["users"].Service("nope")
+	assert.True(errors.Is(err, jelly.ErrNotFound))
+
+	// dependents are shut down first
+	log = nil
+	server.handling = true
+	assert.NoError(server.Shutdown(context.Background()))
+	assert.Equal([]string{"shutdown mailer", "shutdown greeter", "shutdown users"}, log)
+}
+
+func Test_restServer_Add_dependencyErrors(t *testing.T) {
+	t.Run("cycle", func(t *testing.T) {
+		assert := assert.New(t)
+		server := newServicesTestServer("a", "b")
+
+		var log []string
+		assert.NoError(server.Add("a", &greeterAPI{name: "a", deps: []string{"b"}, log: &log}))
+		assert.Error(server.Add("b", &greeterAPI{name: "b", deps: []string{"a"}, log: &log}))
+	})
+
+	t.Run("self", func(t *testing.T) {
+		assert := assert.New(t)
+		server := newServicesTestServer("a")
+
+		var log []string
+		assert.Error(server.Add("a", &greeterAPI{name: "a", deps: []string{"a"}, log: &log}))
+	})
+
+	t.Run("never added", func(t *testing.T) {
+		assert := assert.New(t)
+		server := newServicesTestServer("a")
+
+		var log []string
+		assert.NoError(server.Add("a", &greeterAPI{name: "a", deps: []string{"b"}, log: &log}))
+		assert.Empty(log)
+		assert.EqualError(server.checkPending(), `API "a" depends on API "b", which was never added`)
+	})
+}
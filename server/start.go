@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dekarrin/jelly"
+)
+
+// starter calls the OnStart of each API that implements jelly.StartingAPI once
+// the server is live, and lets Shutdown stop and wait for it.
+type starter struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// startAPIs calls OnStart on each of apis in order in a new goroutine. The
+// returned starter must be stopped once the server begins shutting down.
+func startAPIs(apis []jelly.API, names []string, log jelly.Logger) *starter {
+	ctx, cancel := context.WithCancel(context.Background())
+	st := &starter{ctx: ctx, cancel: cancel}
+	st.start(apis, names, log)
+	return st
+}
+
+// start calls OnStart on each of apis in order in a new goroutine, with the
+// same context as the ones the starter was created with. It is used for APIs
+// that are re-enabled after the server is live.
+func (st *starter) start(apis []jelly.API, names []string, log jelly.Logger) {
+	st.wg.Add(1)
+	go func() {
+		defer st.wg.Done()
+		for i := range apis {
+			sAPI, ok := apis[i].(jelly.StartingAPI)
+			if !ok {
+				continue
+			}
+			if st.ctx.Err() != nil {
+				return
+			}
+			if err := sAPI.OnStart(st.ctx); err != nil {
+				log.Errorf("start API %q: OnStart(): %v", names[i], err)
+				continue
+			}
+			log.Debugf("Started API %q", names[i])
+		}
+	}()
+}
+
+// stop cancels the context given to OnStart and waits for every call to it to
+// return. It can be called on a nil starter.
+func (st *starter) stop() {
+	if st == nil {
+		return
+	}
+	st.cancel()
+	st.wg.Wait()
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// startingAPI records the calls to its OnStart. If block is set, OnStart
+// closes it and does not return until its context is canceled.
+type startingAPI struct {
+	helloAPI
+	name  string
+	log   *[]string
+	block chan struct{}
+	err   error
+
+	ctx context.Context
+}
+
+func (s *startingAPI) OnStart(ctx context.Context) error {
+	s.ctx = ctx
+	*s.log = append(*s.log, s.name)
+	if s.block != nil {
+		close(s.block)
+		<-ctx.Done()
+	}
+	return s.err
+}
+
+func Test_startAPIs(t *testing.T) {
+	assert := assert.New(t)
+
+	var log []string
+	first := &startingAPI{name: "first", log: &log, err: errors.New("announce failed")}
+	last := &startingAPI{name: "last", log: &log, block: make(chan struct{})}
+	apis := []jelly.API{first, helloAPI{}, last}
+
+	st := startAPIs(apis, []string{"first", "hello", "last"}, logging.NoOpLogger{})
+
+	<-last.block
+
+	// stop only returns once the blocking OnStart has seen its context end
+	st.stop()
+
+	assert.Equal([]string{"first", "last"}, log)
+	assert.Error(last.ctx.Err())
+	assert.Error(first.ctx.Err())
+
+	// stopping a server that never started is a no-op
+	var none *starter
+	none.stop()
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dekarrin/jelly"
+)
+
+// startupTracker builds the jelly.StartupReport of a server as it starts. Each
+// phase is begun with begin and lasts until the next one is begun or until it
+// is ended with end. A nil *startupTracker records nothing.
+type startupTracker struct {
+	mtx    sync.Mutex
+	report jelly.StartupReport
+
+	kind    string // of the phase in progress; "" if there is none
+	name    string
+	started time.Time
+}
+
+// begin ends the phase in progress, if any, as passed and begins the phase of
+// the given kind and name.
+func (st *startupTracker) begin(kind, name string) {
+	if st == nil {
+		return
+	}
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+
+	st.endUnsafe(nil)
+	st.kind = kind
+	st.name = name
+	st.started = time.Now()
+}
+
+// end ends the phase in progress, if any, failing it with err if it is not
+// nil. If err is not nil, it is returned as a *jelly.StartupError with the
+// report so far.
+func (st *startupTracker) end(err error) error {
+	if st == nil {
+		return err
+	}
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+
+	st.endUnsafe(err)
+	if err == nil {
+		return nil
+	}
+	return &jelly.StartupError{Report: st.reportUnsafe(), Err: err}
+}
+
+func (st *startupTracker) endUnsafe(err error) {
+	if st.kind == "" {
+		return
+	}
+	st.report.Add(st.kind, st.name, st.started, err)
+	st.kind = ""
+	st.name = ""
+}
+
+// snapshot returns a copy of the report of the phases that have ended.
+func (st *startupTracker) snapshot() jelly.StartupReport {
+	if st == nil {
+		return jelly.StartupReport{}
+	}
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	return st.reportUnsafe()
+}
+
+func (st *startupTracker) reportUnsafe() jelly.StartupReport {
+	phases := make([]jelly.StartupPhase, len(st.report.Phases))
+	copy(phases, st.report.Phases)
+	return jelly.StartupReport{Phases: phases}
+}
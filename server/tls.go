@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Certificates returns information on the certificates obtained with ACME. See
+// jelly.RESTServer.Certificates.
+func (rs *restServer) Certificates() []jelly.CertificateInfo {
+	if rs.certs == nil {
+		return nil
+	}
+	return rs.certs.list()
+}
+
+// tlsConfig returns the TLS config that the server's listener is served with,
+// or nil if TLS is not enabled. If autocert is enabled with HTTP-01
+// challenges, the listener that answers them is started.
+func (rs *restServer) tlsConfig() (*tls.Config, error) {
+	tc := rs.cfg.Globals.TLS
+	if !tc.Enabled {
+		return nil, nil
+	}
+
+	if !tc.Autocert.Enabled {
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load certificate: %w", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	}
+
+	ac := tc.Autocert
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      &certCache{Cache: autocert.DirCache(ac.CacheDir), certs: rs.certs, log: rs.log},
+		HostPolicy: autocert.HostWhitelist(ac.Domains...),
+		Email:      ac.Email,
+		Client:     &acme.Client{DirectoryURL: ac.DirectoryURL},
+	}
+
+	if ac.Challenge == jelly.ACMEHTTP01 {
+		srv := &http.Server{Addr: ac.HTTPAddress, Handler: m.HTTPHandler(nil)}
+		rs.mtx.Lock()
+		rs.acmeHTTP = srv
+		rs.mtx.Unlock()
+
+		rs.log.Infof("Answering ACME HTTP-01 challenges on %s", ac.HTTPAddress)
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				rs.log.Errorf("ACME HTTP-01 listener stopped: %v", err)
+			}
+		}()
+	}
+
+	conf := m.TLSConfig()
+	getCert := conf.GetCertificate
+	conf.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, err := getCert(hello)
+		if err != nil && rs.certs.tracks(hello.ServerName) {
+			rs.certs.fail(hello.ServerName, err)
+			rs.log.Warnf("Get certificate for %s: %v", hello.ServerName, err)
+		}
+		return cert, err
+	}
+
+	rs.log.Infof("Obtaining certificates automatically for %s", strings.Join(ac.Domains, ", "))
+	return conf, nil
+}
+
+// stopACMEHTTP shuts down the listener that answers HTTP-01 challenges, if it
+// was started. rs.mtx must be held by the caller.
+func (rs *restServer) stopACMEHTTP(ctx context.Context) error {
+	srv := rs.acmeHTTP
+	rs.acmeHTTP = nil
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+// certRegistry keeps information on the certificates obtained with ACME for
+// each configured domain.
+type certRegistry struct {
+	mtx   sync.Mutex
+	certs map[string]*jelly.CertificateInfo
+}
+
+func newCertRegistry(domains []string) *certRegistry {
+	reg := &certRegistry{certs: map[string]*jelly.CertificateInfo{}}
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		reg.certs[d] = &jelly.CertificateInfo{Domain: d}
+	}
+	return reg
+}
+
+func (reg *certRegistry) tracks(domain string) bool {
+	if reg == nil {
+		return false
+	}
+	_, ok := reg.certs[strings.ToLower(domain)]
+	return ok
+}
+
+func (reg *certRegistry) loaded(domain string, notAfter time.Time) {
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+
+	if info, ok := reg.certs[strings.ToLower(domain)]; ok {
+		info.NotAfter = notAfter
+	}
+}
+
+func (reg *certRegistry) obtained(domain string, notAfter time.Time) {
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+
+	if info, ok := reg.certs[strings.ToLower(domain)]; ok {
+		info.NotAfter = notAfter
+		info.Obtained = time.Now()
+		info.Renewals++
+		info.LastError = ""
+	}
+}
+
+func (reg *certRegistry) fail(domain string, err error) {
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+
+	if info, ok := reg.certs[strings.ToLower(domain)]; ok {
+		info.Failures++
+		info.LastError = err.Error()
+	}
+}
+
+func (reg *certRegistry) list() []jelly.CertificateInfo {
+	reg.mtx.Lock()
+	defer reg.mtx.Unlock()
+
+	infos := make([]jelly.CertificateInfo, 0, len(reg.certs))
+	for _, info := range reg.certs {
+		infos = append(infos, *info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Domain < infos[j].Domain
+	})
+	return infos
+}
+
+// certCache is an autocert.Cache that records and logs the certificates that
+// pass through it. autocert stores every certificate it obtains or renews in
+// its cache, so this is where renewals are seen.
+type certCache struct {
+	autocert.Cache
+	certs *certRegistry
+	log   jelly.Logger
+}
+
+func (c *certCache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := c.Cache.Get(ctx, key)
+	if err == nil {
+		if domain, notAfter, ok := c.parseCert(key, data); ok {
+			c.certs.loaded(domain, notAfter)
+		}
+	}
+	return data, err
+}
+
+func (c *certCache) Put(ctx context.Context, key string, data []byte) error {
+	if err := c.Cache.Put(ctx, key, data); err != nil {
+		return err
+	}
+
+	if domain, notAfter, ok := c.parseCert(key, data); ok {
+		c.certs.obtained(domain, notAfter)
+		c.log.Infof("Obtained certificate for %s; it expires %s", domain, notAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// parseCert returns the domain and expiry of the certificate stored under key,
+// if key is that of a certificate for a configured domain. Other keys, such as
+// those of challenge tokens and the account key, are ignored.
+func (c *certCache) parseCert(key string, data []byte) (domain string, notAfter time.Time, ok bool) {
+	domain = strings.TrimSuffix(key, "+rsa")
+	if !c.certs.tracks(domain) {
+		return "", time.Time{}, false
+	}
+
+	// the data is the private key followed by the certificate chain, leaf
+	// first.
+	for rest := data; len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return "", time.Time{}, false
+		}
+		return domain, leaf.NotAfter, true
+	}
+	return "", time.Time{}, false
+}
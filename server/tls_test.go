@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func Test_certCache(t *testing.T) {
+	assert := assert.New(t)
+
+	notAfter := time.Date(2030, time.March, 1, 0, 0, 0, 0, time.UTC)
+	certData := selfSignedPEM(t, "example.com", notAfter)
+
+	reg := newCertRegistry([]string{"example.com", "www.example.com"})
+	cache := &certCache{Cache: autocert.DirCache(t.TempDir()), certs: reg, log: logging.NoOpLogger{}}
+	ctx := context.Background()
+
+	// non-certificate keys are ignored
+	assert.NoError(cache.Put(ctx, "acme_account+key", []byte("not a cert")))
+	assert.NoError(cache.Put(ctx, "example.com+token", certData))
+
+	assert.NoError(cache.Put(ctx, "example.com", certData))
+	assert.NoError(cache.Put(ctx, "example.com+rsa", certData))
+	reg.fail("www.example.com", errors.New("rate limited"))
+
+	actual := reg.list()
+	if !assert.Len(actual, 2) {
+		return
+	}
+
+	assert.Equal("example.com", actual[0].Domain)
+	assert.Equal(notAfter, actual[0].NotAfter)
+	assert.Equal(2, actual[0].Renewals)
+	assert.False(actual[0].Obtained.IsZero())
+	assert.Equal(0, actual[0].Failures)
+
+	assert.Equal("www.example.com", actual[1].Domain)
+	assert.Equal(0, actual[1].Renewals)
+	assert.Equal(1, actual[1].Failures)
+	assert.Equal("rate limited", actual[1].LastError)
+
+	// loading from the cache sets the expiry without counting a renewal
+	fresh := newCertRegistry([]string{"example.com"})
+	cache.certs = fresh
+	_, err := cache.Get(ctx, "example.com")
+	assert.NoError(err)
+	loaded := fresh.list()
+	assert.Equal(notAfter, loaded[0].NotAfter)
+	assert.Equal(0, loaded[0].Renewals)
+	assert.True(loaded[0].Obtained.IsZero())
+}
+
+// selfSignedPEM returns a private key and self-signed certificate for domain
+// in the format that autocert caches them in.
+func selfSignedPEM(t *testing.T, domain string, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+}
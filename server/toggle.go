@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+)
+
+// apiSwitch is the handler that the router of an API is mounted with, so that
+// the API can be disabled and re-enabled while the server is running. While
+// it is disabled, every request to the API is given to unavailable instead,
+// and while it is enabled but the API has no routes, every request is given to
+// notFound.
+//
+// It implements chi.Routes by passing through to the API's router so that the
+// API's routes are still found by chi.Walk.
+type apiSwitch struct {
+	mtx         sync.RWMutex
+	router      chi.Router
+	mws         []func(http.Handler) http.Handler
+	handler     http.Handler // router with mws applied
+	disabled    bool
+	unavailable http.Handler
+	notFound    http.Handler
+	usage       *usageTracker // accounts for requests while enabled
+}
+
+// enable makes the switch serve router with mws applied to it. If router is
+// nil, the API has no routes and the switch responds as though nothing is
+// mounted.
+func (sw *apiSwitch) enable(router chi.Router, mws []func(http.Handler) http.Handler) {
+	var h http.Handler
+	if router != nil {
+		h = router
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+	}
+
+	sw.mtx.Lock()
+	defer sw.mtx.Unlock()
+	sw.router = router
+	sw.mws = mws
+	sw.handler = h
+	sw.disabled = false
+}
+
+// disable makes the switch give every request to its unavailable handler.
+func (sw *apiSwitch) disable() {
+	sw.mtx.Lock()
+	defer sw.mtx.Unlock()
+	sw.disabled = true
+}
+
+func (sw *apiSwitch) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	sw.mtx.RLock()
+	h := sw.handler
+	disabled := sw.disabled
+	sw.mtx.RUnlock()
+
+	if disabled {
+		sw.unavailable.ServeHTTP(w, req)
+		return
+	}
+	if h == nil {
+		sw.notFound.ServeHTTP(w, req)
+		return
+	}
+	sw.usage.serve(h, w, req)
+}
+
+// middleware returns the middleware applied to the API's router.
+func (sw *apiSwitch) middleware() []func(http.Handler) http.Handler {
+	sw.mtx.RLock()
+	defer sw.mtx.RUnlock()
+	return sw.mws
+}
+
+func (sw *apiSwitch) Routes() []chi.Route {
+	sw.mtx.RLock()
+	defer sw.mtx.RUnlock()
+	if sw.router == nil {
+		return nil
+	}
+	return sw.router.Routes()
+}
+
+func (sw *apiSwitch) Middlewares() chi.Middlewares {
+	sw.mtx.RLock()
+	defer sw.mtx.RUnlock()
+	if sw.router == nil {
+		return nil
+	}
+	return append(append(chi.Middlewares{}, sw.mws...), sw.router.Middlewares()...)
+}
+
+func (sw *apiSwitch) Match(rctx *chi.Context, method, path string) bool {
+	sw.mtx.RLock()
+	defer sw.mtx.RUnlock()
+	if sw.router == nil {
+		return false
+	}
+	return sw.router.Match(rctx, method, path)
+}
+
+// apiUnavailableHandler returns the handler that responds to requests made to
+// the named API while it is disabled.
+func apiUnavailableHandler(sp jelly.ServiceProvider, name string) http.Handler {
+	return sp.Endpoint(func(req *http.Request) jelly.Result {
+		return sp.ServiceUnavailable("", 0, "API %q is disabled", name)
+	})
+}
+
+// apiNotFoundHandler returns the handler that responds to requests made to an
+// enabled API that has no routes.
+func apiNotFoundHandler(sp jelly.ServiceProvider) http.Handler {
+	return sp.Endpoint(func(req *http.Request) jelly.Result {
+		return sp.NotFound()
+	})
+}
+
+// DisableAPI disables the named API while the server is running. See
+// jelly.RESTServer.DisableAPI.
+func (rs *restServer) DisableAPI(ctx context.Context, name string) error {
+	rs.checkCreatedViaNew()
+	name = strings.ToLower(name)
+
+	rs.mtx.Lock()
+	api, ok := rs.apis[name]
+	if !ok || !rs.initialized(name) {
+		rs.mtx.Unlock()
+		return fmt.Errorf("no enabled API called %q", name)
+	}
+	if rs.disabled[name] {
+		rs.mtx.Unlock()
+		return fmt.Errorf("API %q is already disabled", name)
+	}
+	if rs.disabled == nil {
+		rs.disabled = map[string]bool{}
+	}
+	rs.disabled[name] = true
+	if sw := rs.apiSwitches[name]; sw != nil {
+		sw.disable()
+	}
+	ut := rs.usageTracker(name)
+	rs.mtx.Unlock()
+
+	ut.stop()
+
+	rs.log.Warnf("Disabled API %q; its routes will respond with HTTP-503 until it is enabled", name)
+
+	if err := api.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutdown API %q: %w", name, err)
+	}
+	return nil
+}
+
+// EnableAPI re-enables an API that was disabled with DisableAPI. See
+// jelly.RESTServer.EnableAPI.
+//
+// The API's Init is called without holding the server's lock, as it may take
+// a while. The API stays disabled until Init returns, and if the server is
+// shut down in the meantime, the API is shut down again and is not enabled.
+func (rs *restServer) EnableAPI(name string) error {
+	rs.checkCreatedViaNew()
+	name = strings.ToLower(name)
+
+	rs.mtx.Lock()
+	if !rs.disabled[name] {
+		rs.mtx.Unlock()
+		return fmt.Errorf("API %q is not disabled", name)
+	}
+	if rs.enabling[name] {
+		rs.mtx.Unlock()
+		return fmt.Errorf("API %q is already being enabled", name)
+	}
+	api := rs.apis[name]
+
+	bndl, err := rs.newInitBundle(name, rs.getAPIConfigBundle(name))
+	if err != nil {
+		rs.mtx.Unlock()
+		return fmt.Errorf("init API %q: %w", name, err)
+	}
+	if rs.enabling == nil {
+		rs.enabling = map[string]bool{}
+	}
+	rs.enabling[name] = true
+	shutdowns := rs.shutdowns
+	rs.mtx.Unlock()
+
+	initErr := api.Init(bndl)
+	for _, o := range rs.observers {
+		o.OnAPIInit(name, initErr)
+	}
+
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	delete(rs.enabling, name)
+
+	if initErr != nil {
+		return fmt.Errorf("init API %q: Init(): %w", name, initErr)
+	}
+	if rs.closing || rs.shutdowns != shutdowns {
+		// Shutdown skipped the API because it was still disabled
+		err := fmt.Errorf("init API %q: server was shut down during Init()", name)
+		if shutdownErr := api.Shutdown(context.Background()); shutdownErr != nil {
+			err = fmt.Errorf("%s\nadditionally: shutdown API %q: %w", err, name, shutdownErr)
+		}
+		return err
+	}
+
+	// the API's authenticators may hold state that Init replaced, such as its
+	// keys and caches, so the new ones take the place of the old
+	env := rs.env
+	if env == nil {
+		env = &Environment{}
+	}
+	for aName, a := range api.Authenticators() {
+		fullName := name + "." + aName
+		if err := env.replaceAuthenticator(fullName, a); err != nil {
+			rs.log.Warnf("enable API %q: register authenticator %q: %v", name, fullName, err)
+		}
+	}
+
+	rs.apiBundles[name] = bndl
+	if rs.apiHooks == nil {
+		rs.apiHooks = map[string][]jelly.ResultHook{}
+	}
+	rs.apiHooks[name] = bndl.ResultHooks()
+
+	// if the server has not yet been routed, the routes are created when it
+	// is
+	if sw := rs.apiSwitches[name]; sw != nil {
+		router, mws := rs.routeAPI(name, api, rs.sp)
+		if router != nil {
+			rs.apiRouters[name] = router
+		} else {
+			delete(rs.apiRouters, name)
+		}
+		sw.enable(router, mws)
+	}
+	delete(rs.disabled, name)
+
+	if rs.started != nil {
+		rs.started.start([]jelly.API{api}, []string{name}, rs.log)
+	}
+
+	rs.log.Infof("Enabled API %q", name)
+	return nil
+}
+
+// DisabledAPIs returns the names of the APIs that are currently disabled. See
+// jelly.RESTServer.DisabledAPIs.
+func (rs *restServer) DisabledAPIs() []string {
+	rs.checkCreatedViaNew()
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	var names []string
+	for name := range rs.disabled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/dekarrin/jelly/internal/middle"
+	"github.com/stretchr/testify/assert"
+)
+
+type typedThingReq struct {
+	Name  string `json:"name"`
+	Limit int    `json:"-" query:"limit"`
+}
+
+func (r typedThingReq) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name: must not be empty")
+	}
+	return nil
+}
+
+type typedThingResp struct {
+	Name  string `json:"name"`
+	Limit int    `json:"limit"`
+}
+
+func Test_TypedEndpoint(t *testing.T) {
+	testCases := []struct {
+		name         string
+		method       string
+		target       string
+		body         string
+		err          error
+		expectStatus int
+		expectBody   string
+	}{
+		{
+			name:         "create",
+			method:       http.MethodPost,
+			target:       "/things?limit=8",
+			body:         `{"name": "Aradia"}`,
+			expectStatus: http.StatusCreated,
+			expectBody:   `{"name": "Aradia", "limit": 8}`,
+		},
+		{
+			name:         "put",
+			method:       http.MethodPut,
+			target:       "/things",
+			body:         `{"name": "Aradia"}`,
+			expectStatus: http.StatusOK,
+			expectBody:   `{"name": "Aradia", "limit": 0}`,
+		},
+		{
+			name:         "invalid",
+			method:       http.MethodPost,
+			target:       "/things",
+			body:         `{"name": ""}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "bad query",
+			method:       http.MethodPost,
+			target:       "/things?limit=eight",
+			body:         `{"name": "Aradia"}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "malformed body",
+			method:       http.MethodPost,
+			target:       "/things",
+			body:         `{"name":`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			name:         "not found",
+			method:       http.MethodPost,
+			target:       "/things",
+			body:         `{"name": "Aradia"}`,
+			err:          jelly.NewError("no such thing", jelly.ErrNotFound),
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			name:         "already exists",
+			method:       http.MethodPost,
+			target:       "/things",
+			body:         `{"name": "Aradia"}`,
+			err:          jelly.WrapDBError(jelly.ErrDBConstraintViolation),
+			expectStatus: http.StatusConflict,
+		},
+		{
+			name:         "unexpected error",
+			method:       http.MethodPost,
+			target:       "/things",
+			body:         `{"name": "Aradia"}`,
+			err:          errors.New("oh no"),
+			expectStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+			em := endpointCreator{mid: &middle.Provider{}, log: logging.NoOpLogger{}}
+
+			handler := jelly.TypedEndpoint(em, func(ctx context.Context, req typedThingReq) (typedThingResp, error) {
+				return typedThingResp{Name: req.Name, Limit: req.Limit}, tc.err
+			})
+
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			assert.Equal(tc.expectStatus, w.Code)
+			if tc.expectBody != "" {
+				assert.JSONEq(tc.expectBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_TypedEndpoint_noContent(t *testing.T) {
+	assert := assert.New(t)
+	em := endpointCreator{mid: &middle.Provider{}, log: logging.NoOpLogger{}}
+
+	var got string
+	handler := jelly.TypedEndpoint(em, func(ctx context.Context, id string) (struct{}, error) {
+		got = id
+		return struct{}{}, nil
+	})
+
+	req := httptest.NewRequest(http.MethodDelete, "/things", strings.NewReader(`"413"`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	assert.Equal(http.StatusNoContent, w.Code)
+	assert.Equal("413", got)
+	assert.Empty(w.Body.String())
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// unauthTrail counts the requests that the server rejects with an HTTP-401,
+// and logs each one to the file in Globals.UnauthLog if it is set. The file is
+// opened when the first rejection is logged and closed when the server shuts
+// down. It is safe for concurrent use. A nil *unauthTrail records nothing.
+type unauthTrail struct {
+	path string // "" if rejections are not logged
+	log  jelly.Logger
+
+	mtx    sync.Mutex
+	file   *os.File
+	failed bool // whether opening the file failed; it is not tried again
+	stats  jelly.UnauthStats
+}
+
+func newUnauthTrail(path string, log jelly.Logger) *unauthTrail {
+	return &unauthTrail{
+		path:  path,
+		log:   log,
+		stats: jelly.UnauthStats{ByCredential: map[string]int64{}},
+	}
+}
+
+// record counts req as rejected and logs it.
+func (ut *unauthTrail) record(req *http.Request, now time.Time) {
+	if ut == nil {
+		return
+	}
+	cred := credentialType(req)
+
+	ut.mtx.Lock()
+	defer ut.mtx.Unlock()
+
+	ut.stats.Rejections++
+	ut.stats.ByCredential[cred]++
+
+	if ut.path == "" || ut.failed {
+		return
+	}
+	if ut.file == nil {
+		f, err := os.OpenFile(ut.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			ut.failed = true
+			ut.log.Errorf("unauth log: %v; rejections will not be logged", err)
+			return
+		}
+		ut.file = f
+	}
+
+	// "real_ip" sets the address without a port
+	client := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+
+	line := fmt.Sprintf("%s unauthorized client=%s method=%s path=%q cred=%s\n", now.UTC().Format(time.RFC3339), client, req.Method, req.URL.Path, cred)
+	if _, err := ut.file.WriteString(line); err != nil {
+		ut.log.Warnf("unauth log: %v", err)
+	}
+}
+
+// snapshot returns a copy of the counts of rejected requests.
+func (ut *unauthTrail) snapshot() jelly.UnauthStats {
+	if ut == nil {
+		return jelly.UnauthStats{}
+	}
+	ut.mtx.Lock()
+	defer ut.mtx.Unlock()
+
+	byCred := make(map[string]int64, len(ut.stats.ByCredential))
+	for k, v := range ut.stats.ByCredential {
+		byCred[k] = v
+	}
+	return jelly.UnauthStats{Rejections: ut.stats.Rejections, ByCredential: byCred}
+}
+
+// close closes the file that rejections are logged to, if it is open. If
+// another is logged after, the file is opened again.
+func (ut *unauthTrail) close() error {
+	if ut == nil {
+		return nil
+	}
+	ut.mtx.Lock()
+	defer ut.mtx.Unlock()
+
+	if ut.file == nil {
+		return nil
+	}
+	err := ut.file.Close()
+	ut.file = nil
+	return err
+}
+
+// credentialType returns the type of credentials that req was made with, which
+// is the scheme of its Authorization header in lowercase, or "none" if it has
+// none.
+func credentialType(req *http.Request) string {
+	auth := strings.TrimSpace(req.Header.Get("Authorization"))
+	if auth == "" {
+		return "none"
+	}
+	scheme, _, _ := strings.Cut(auth, " ")
+	return strings.ToLower(scheme)
+}
+
+// useUnauthTrail adds middleware to r that records every request that is
+// responded to with an HTTP-401 in rs.unauth. It must be added after the
+// global middleware chain so that the client address has been set by the
+// "real_ip" middleware, if it is used. rs.mtx must be held by the caller.
+func (rs *restServer) useUnauthTrail(r chi.Router) {
+	trail := rs.unauth
+	if trail == nil {
+		return
+	}
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ww := chimw.NewWrapResponseWriter(w, req.ProtoMajor)
+			next.ServeHTTP(ww, req)
+
+			if ww.Status() == http.StatusUnauthorized {
+				trail.record(req, time.Now())
+			}
+		})
+	})
+}
+
+// UnauthStats returns the counts of requests that the server has rejected with
+// an HTTP-401. See jelly.RESTServer.UnauthStats.
+func (rs *restServer) UnauthStats() jelly.UnauthStats {
+	rs.checkCreatedViaNew()
+	return rs.unauth.snapshot()
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_useUnauthTrail(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "unauth.log")
+
+	rs := &restServer{unauth: newUnauthTrail(path, logging.NoOpLogger{})}
+	r := chi.NewRouter()
+	rs.useUnauthTrail(r)
+	r.Get("/open", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	r.Get("/protected", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	requests := []struct {
+		path string
+		auth string
+		addr string
+	}{
+		{path: "/open", auth: "Bearer good", addr: "192.0.2.1:4000"},
+		{path: "/protected", addr: "192.0.2.1:4000"},
+		{path: "/protected", auth: "Bearer bad", addr: "[2001:db8::1]:4000"},
+		{path: "/protected", auth: "Basic Zm9vOmJhcg==", addr: "198.51.100.9"},
+	}
+	for _, rr := range requests {
+		req := httptest.NewRequest("GET", rr.path, nil)
+		req.RemoteAddr = rr.addr
+		if rr.auth != "" {
+			req.Header.Set("Authorization", rr.auth)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(jelly.UnauthStats{
+		Rejections:   3,
+		ByCredential: map[string]int64{"none": 1, "bearer": 1, "basic": 1},
+	}, rs.unauth.snapshot())
+
+	require.NoError(t, rs.unauth.close())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	ts := `\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ`
+	expect := regexp.MustCompile(`^` +
+		ts + ` unauthorized client=192\.0\.2\.1 method=GET path="/protected" cred=none\n` +
+		ts + ` unauthorized client=2001:db8::1 method=GET path="/protected" cred=bearer\n` +
+		ts + ` unauthorized client=198\.51\.100\.9 method=GET path="/protected" cred=basic\n$`)
+	assert.Regexp(expect, string(data))
+}
+
+func Test_unauthTrail_noFile(t *testing.T) {
+	assert := assert.New(t)
+
+	trail := newUnauthTrail("", logging.NoOpLogger{})
+	trail.record(httptest.NewRequest("GET", "/", nil), time.Now())
+
+	assert.Equal(int64(1), trail.snapshot().Rejections)
+	assert.NoError(trail.close())
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dekarrin/jelly"
+)
+
+// heapAllocsMetric is the runtime metric of the total bytes allocated on the
+// heap by the program, used to estimate the allocations made by each API.
+const heapAllocsMetric = "/gc/heap/allocs:bytes"
+
+// usageTracker accounts for the resources used by a single API.
+type usageTracker struct {
+	goroutines int64
+	started    int64
+	inFlight   int64
+	requests   int64
+	allocBytes uint64
+
+	mtx    sync.Mutex
+	ctx    context.Context // given to goroutines started with Go
+	cancel context.CancelFunc
+}
+
+func newUsageTracker() *usageTracker {
+	ut := &usageTracker{}
+	ut.ctx, ut.cancel = context.WithCancel(context.Background())
+	return ut
+}
+
+// goFunc is the jelly.GoFunc given to the Bundle of the API.
+func (ut *usageTracker) goFunc(fn func(ctx context.Context)) {
+	ut.mtx.Lock()
+	ctx := ut.ctx
+	ut.mtx.Unlock()
+
+	atomic.AddInt64(&ut.started, 1)
+	atomic.AddInt64(&ut.goroutines, 1)
+	go func() {
+		defer atomic.AddInt64(&ut.goroutines, -1)
+		fn(ctx)
+	}()
+}
+
+// stop cancels the context of every goroutine started with goFunc. Goroutines
+// started after it is called are given a new context, for when the API is
+// re-enabled.
+func (ut *usageTracker) stop() {
+	ut.mtx.Lock()
+	defer ut.mtx.Unlock()
+
+	ut.cancel()
+	ut.ctx, ut.cancel = context.WithCancel(context.Background())
+}
+
+// serve calls h to handle req, accounting for the request in the usage.
+func (ut *usageTracker) serve(h http.Handler, w http.ResponseWriter, req *http.Request) {
+	atomic.AddInt64(&ut.requests, 1)
+	atomic.AddInt64(&ut.inFlight, 1)
+	defer atomic.AddInt64(&ut.inFlight, -1)
+
+	before := heapAllocs()
+	defer func() {
+		if after := heapAllocs(); after > before {
+			atomic.AddUint64(&ut.allocBytes, after-before)
+		}
+	}()
+
+	h.ServeHTTP(w, req)
+}
+
+func (ut *usageTracker) usage() jelly.APIUsage {
+	return jelly.APIUsage{
+		Goroutines:        atomic.LoadInt64(&ut.goroutines),
+		GoroutinesStarted: atomic.LoadInt64(&ut.started),
+		InFlight:          atomic.LoadInt64(&ut.inFlight),
+		Requests:          atomic.LoadInt64(&ut.requests),
+		AllocBytes:        atomic.LoadUint64(&ut.allocBytes),
+	}
+}
+
+// heapAllocs returns the total bytes allocated on the heap by the program so
+// far.
+func heapAllocs() uint64 {
+	sample := []metrics.Sample{{Name: heapAllocsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// usageTracker returns the usageTracker of the named API, creating it if it
+// does not yet exist. rs.mtx must be held by the caller.
+func (rs *restServer) usageTracker(name string) *usageTracker {
+	if rs.usage == nil {
+		rs.usage = map[string]*usageTracker{}
+	}
+	ut, ok := rs.usage[name]
+	if !ok {
+		ut = newUsageTracker()
+		rs.usage[name] = ut
+	}
+	return ut
+}
+
+// Usage returns the resources used by the named API. See
+// jelly.RESTServer.Usage.
+func (rs *restServer) Usage(api string) jelly.APIUsage {
+	rs.mtx.Lock()
+	ut := rs.usage[strings.ToLower(api)]
+	rs.mtx.Unlock()
+
+	if ut == nil {
+		return jelly.APIUsage{}
+	}
+	return ut.usage()
+}
@@ -0,0 +1,371 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// webhookMaxConcurrent is the maximum number of webhook deliveries that are
+// attempted at once. Deliveries beyond it wait for a free slot.
+const webhookMaxConcurrent = 16
+
+// webhookManager delivers the events published on a server's EventBus to the
+// webhooks that are subscribed to them. Each delivery is made in its own
+// goroutine and is retried with backoff until it succeeds or its attempts are
+// used up, at which point it is added to the dead letters.
+type webhookManager struct {
+	cfg    jelly.WebhookConfig
+	client *http.Client
+	log    jelly.Logger
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	mtx    sync.Mutex
+	subs   []jelly.WebhookSubscription
+	dead   []jelly.WebhookDeadLetter
+	ctx    context.Context // ends deliveries in progress when canceled
+	cancel context.CancelFunc
+}
+
+func newWebhookManager(cfg jelly.WebhookConfig, log jelly.Logger) *webhookManager {
+	cfg = cfg.FillDefaults()
+
+	wm := &webhookManager{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(cfg.TimeoutMillis) * time.Millisecond},
+		log:    log,
+		sem:    make(chan struct{}, webhookMaxConcurrent),
+	}
+	wm.ctx, wm.cancel = context.WithCancel(context.Background())
+
+	for _, sub := range cfg.Subscriptions {
+		wm.add(sub)
+	}
+
+	return wm
+}
+
+// subscriptions returns all current subscriptions, in the order they were
+// made.
+func (wm *webhookManager) subscriptions() []jelly.WebhookSubscription {
+	wm.mtx.Lock()
+	defer wm.mtx.Unlock()
+
+	return append([]jelly.WebhookSubscription{}, wm.subs...)
+}
+
+// add adds sub to the subscriptions with a new ID and returns it.
+func (wm *webhookManager) add(sub jelly.WebhookSubscription) jelly.WebhookSubscription {
+	wm.mtx.Lock()
+	defer wm.mtx.Unlock()
+
+	sub.ID = uuid.New()
+	sub.Events = append([]string{}, sub.Events...)
+	wm.subs = append(wm.subs, sub)
+	return sub
+}
+
+// remove removes the subscription with the given ID and returns it. If there
+// is no such subscription, ok will be false.
+func (wm *webhookManager) remove(id uuid.UUID) (sub jelly.WebhookSubscription, ok bool) {
+	wm.mtx.Lock()
+	defer wm.mtx.Unlock()
+
+	for i := range wm.subs {
+		if wm.subs[i].ID == id {
+			sub = wm.subs[i]
+			wm.subs = append(wm.subs[:i:i], wm.subs[i+1:]...)
+			return sub, true
+		}
+	}
+	return sub, false
+}
+
+// deadLetters returns the most recent deliveries that were given up on,
+// oldest first.
+func (wm *webhookManager) deadLetters() []jelly.WebhookDeadLetter {
+	wm.mtx.Lock()
+	defer wm.mtx.Unlock()
+
+	return append([]jelly.WebhookDeadLetter{}, wm.dead...)
+}
+
+// handle starts delivery of ev to every subscription that matches it. It is
+// subscribed to every event on the server's EventBus.
+func (wm *webhookManager) handle(_ context.Context, ev jelly.Event) {
+	var matched []jelly.WebhookSubscription
+	for _, sub := range wm.subscriptions() {
+		if sub.Matches(ev.Type) {
+			matched = append(matched, sub)
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		wm.log.Errorf("webhooks: event %s (%s) cannot be delivered: %v", ev.ID, ev.Type, err)
+		return
+	}
+
+	wm.mtx.Lock()
+	ctx := wm.ctx
+	wm.mtx.Unlock()
+
+	for _, sub := range matched {
+		wm.wg.Add(1)
+		go func(sub jelly.WebhookSubscription) {
+			defer wm.wg.Done()
+			wm.deliver(ctx, sub, ev, body)
+		}(sub)
+	}
+}
+
+// deliver sends ev to the webhook of sub, retrying until it succeeds or the
+// attempts are used up. If it never succeeds, it is added to the dead letters.
+func (wm *webhookManager) deliver(ctx context.Context, sub jelly.WebhookSubscription, ev jelly.Event, body []byte) {
+	select {
+	case wm.sem <- struct{}{}:
+		defer func() { <-wm.sem }()
+	case <-ctx.Done():
+		wm.deadLetter(sub, ev, 0, ctx.Err())
+		return
+	}
+
+	policy := jelly.RetryPolicy{
+		Attempts:     wm.cfg.Attempts,
+		InitialDelay: time.Duration(wm.cfg.RetryDelayMillis) * time.Millisecond,
+		MaxDelay:     time.Hour,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			wm.log.Warnf("webhooks: deliver event %s to %s failed (attempt %d/%d), retrying in %s: %v", ev.ID, sub.URL, attempt, wm.cfg.Attempts, delay.Round(time.Millisecond), err)
+		},
+	}
+
+	var attempts int
+	err := jelly.Retry(ctx, policy, func(ctx context.Context) error {
+		attempts++
+		return wm.post(ctx, sub, ev, body)
+	})
+	if err != nil {
+		wm.deadLetter(sub, ev, attempts, err)
+	}
+}
+
+// post makes a single attempt at delivering ev to the webhook of sub.
+func (wm *webhookManager) post(ctx context.Context, sub jelly.WebhookSubscription, ev jelly.Event, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return jelly.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Jelly-Event", ev.Type)
+	req.Header.Set("X-Jelly-Delivery", ev.ID.String())
+	if sub.Secret != "" {
+		req.Header.Set(jelly.WebhookSignatureHeader, jelly.SignWebhook(sub.Secret, body))
+	}
+
+	resp, err := wm.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("webhook responded with HTTP-%d", resp.StatusCode)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		// the webhook will not accept it no matter how many times it is sent
+		return jelly.Permanent(err)
+	}
+	return err
+}
+
+func (wm *webhookManager) deadLetter(sub jelly.WebhookSubscription, ev jelly.Event, attempts int, err error) {
+	wm.log.Errorf("webhooks: giving up on delivering event %s (%s) to %s after %d attempt(s): %v", ev.ID, ev.Type, sub.URL, attempts, err)
+
+	wm.mtx.Lock()
+	defer wm.mtx.Unlock()
+
+	wm.dead = append(wm.dead, jelly.WebhookDeadLetter{
+		Subscription: sub.ID,
+		URL:          sub.URL,
+		Event:        ev,
+		Attempts:     attempts,
+		Error:        err.Error(),
+		Time:         time.Now(),
+	})
+	if over := len(wm.dead) - wm.cfg.DeadLetters; over > 0 {
+		wm.dead = append([]jelly.WebhookDeadLetter{}, wm.dead[over:]...)
+	}
+}
+
+// wait waits for all deliveries in progress to finish. If ctx is done first,
+// the deliveries are ended early and added to the dead letters, and ctx.Err()
+// is returned.
+func (wm *webhookManager) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		wm.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+
+		wm.mtx.Lock()
+		wm.cancel()
+		wm.ctx, wm.cancel = context.WithCancel(context.Background())
+		wm.mtx.Unlock()
+
+		<-done
+	}
+	return err
+}
+
+type webhookSubscriptionModel struct {
+	ID     string   `json:"id,omitempty"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events"`
+}
+
+type webhookDeadLetterModel struct {
+	Subscription string      `json:"subscription"`
+	URL          string      `json:"url"`
+	Event        jelly.Event `json:"event"`
+	Attempts     int         `json:"attempts"`
+	Error        string      `json:"error"`
+	Time         string      `json:"time"`
+}
+
+// routeWebhooks adds the webhook admin endpoints to r if they are enabled.
+func (rs *restServer) routeWebhooks(r chi.Router, sp jelly.ServiceProvider) {
+	wc := rs.cfg.Globals.Webhooks.FillDefaults()
+	if !wc.Admin || rs.webhooks == nil {
+		return
+	}
+
+	wm := rs.webhooks
+	r.Route(wc.Path, func(r chi.Router) {
+		r.Use(sp.RequiredAuth())
+
+		r.Get("/subscriptions", httpGetWebhookSubscriptions(sp, wm))
+		r.Post("/subscriptions", httpCreateWebhookSubscription(sp, wm))
+		r.Delete("/subscriptions/"+jelly.PathParam("id:uuid"), httpDeleteWebhookSubscription(sp, wm))
+		r.Get("/dead-letters", httpGetWebhookDeadLetters(sp, wm))
+	})
+}
+
+func httpGetWebhookSubscriptions(sp jelly.ServiceProvider, wm *webhookManager) http.HandlerFunc {
+	return sp.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := sp.GetLoggedInUser(req)
+		if user.Role != jelly.Admin {
+			return sp.Forbidden("user '%s' (role %s) get webhook subscriptions: forbidden", user.Username, user.Role)
+		}
+
+		subs := wm.subscriptions()
+		resp := make([]webhookSubscriptionModel, len(subs))
+		for i := range subs {
+			// secrets are never given back once set
+			resp[i] = webhookSubscriptionModel{
+				ID:     subs[i].ID.String(),
+				URL:    subs[i].URL,
+				Events: append([]string{}, subs[i].Events...),
+			}
+		}
+
+		return sp.OK(resp, "user '%s' got all webhook subscriptions", user.Username)
+	})
+}
+
+func httpCreateWebhookSubscription(sp jelly.ServiceProvider, wm *webhookManager) http.HandlerFunc {
+	return sp.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := sp.GetLoggedInUser(req)
+		if user.Role != jelly.Admin {
+			return sp.Forbidden("user '%s' (role %s) create webhook subscription: forbidden", user.Username, user.Role)
+		}
+
+		var model webhookSubscriptionModel
+		if err := jelly.ParseJSONRequest(req, &model); err != nil {
+			return sp.BadRequest(jelly.UserMessage(err), err.Error())
+		}
+
+		sub := jelly.WebhookSubscription{
+			URL:    model.URL,
+			Secret: model.Secret,
+			Events: model.Events,
+		}
+		if err := sub.Validate(); err != nil {
+			return sp.BadRequest(jelly.UserMessage(err), "invalid webhook subscription: %s", err.Error())
+		}
+		sub = wm.add(sub)
+
+		resp := webhookSubscriptionModel{
+			ID:     sub.ID.String(),
+			URL:    sub.URL,
+			Events: sub.Events,
+		}
+		if resp.Events == nil {
+			resp.Events = []string{}
+		}
+
+		return sp.Created(resp, "user '%s' subscribed webhook %s (%s)", user.Username, sub.ID, sub.URL)
+	})
+}
+
+func httpDeleteWebhookSubscription(sp jelly.ServiceProvider, wm *webhookManager) http.HandlerFunc {
+	return sp.Endpoint(func(req *http.Request) jelly.Result {
+		id := jelly.RequireIDParam(req)
+		user, _ := sp.GetLoggedInUser(req)
+		if user.Role != jelly.Admin {
+			return sp.Forbidden("user '%s' (role %s) delete webhook subscription %s: forbidden", user.Username, user.Role, id)
+		}
+
+		deletedStr := "webhook subscription " + id.String() + " (no-op)"
+		if sub, ok := wm.remove(id); ok {
+			deletedStr = "webhook subscription " + id.String() + " (" + sub.URL + ")"
+		}
+
+		return sp.NoContent("user '%s' successfully deleted %s", user.Username, deletedStr)
+	})
+}
+
+func httpGetWebhookDeadLetters(sp jelly.ServiceProvider, wm *webhookManager) http.HandlerFunc {
+	return sp.Endpoint(func(req *http.Request) jelly.Result {
+		user, _ := sp.GetLoggedInUser(req)
+		if user.Role != jelly.Admin {
+			return sp.Forbidden("user '%s' (role %s) get webhook dead letters: forbidden", user.Username, user.Role)
+		}
+
+		dead := wm.deadLetters()
+		resp := make([]webhookDeadLetterModel, len(dead))
+		for i := range dead {
+			resp[i] = webhookDeadLetterModel{
+				Subscription: dead[i].Subscription.String(),
+				URL:          dead[i].URL,
+				Event:        dead[i].Event,
+				Attempts:     dead[i].Attempts,
+				Error:        dead[i].Error,
+				Time:         dead[i].Time.Format(time.RFC3339),
+			}
+		}
+
+		return sp.OK(resp, "user '%s' got webhook dead letters", user.Username)
+	})
+}
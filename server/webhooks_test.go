@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dekarrin/jelly"
+	"github.com/dekarrin/jelly/internal/logging"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// webhookDelivery is a request received by a test webhook.
+type webhookDelivery struct {
+	header http.Header
+	body   []byte
+}
+
+func Test_webhookManager_deliver(t *testing.T) {
+	testCases := []struct {
+		name           string
+		secret         string
+		statuses       []int // returned by each attempt; 200 after the last
+		expectAttempts int
+		expectDead     bool
+	}{
+		{name: "unsigned", expectAttempts: 1},
+		{name: "signed", secret: "s3cr3t", expectAttempts: 1},
+		{name: "retried after server error", secret: "s3cr3t", statuses: []int{500, 503}, expectAttempts: 3},
+		{name: "retried after 429", statuses: []int{429}, expectAttempts: 2},
+		{name: "client error is not retried", secret: "s3cr3t", statuses: []int{400}, expectAttempts: 1, expectDead: true},
+		{name: "gives up after all attempts", statuses: []int{500, 500, 500}, expectAttempts: 3, expectDead: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var mtx sync.Mutex
+			var deliveries []webhookDelivery
+			hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				body, _ := io.ReadAll(req.Body)
+
+				mtx.Lock()
+				deliveries = append(deliveries, webhookDelivery{header: req.Header.Clone(), body: body})
+				n := len(deliveries)
+				mtx.Unlock()
+
+				if n <= len(tc.statuses) {
+					w.WriteHeader(tc.statuses[n-1])
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer hook.Close()
+
+			wm := newWebhookManager(jelly.WebhookConfig{
+				Subscriptions:    []jelly.WebhookSubscription{{URL: hook.URL, Secret: tc.secret, Events: []string{"test.*"}}},
+				Attempts:         3,
+				RetryDelayMillis: 1,
+			}, logging.NoOpLogger{})
+
+			ev := jelly.Event{ID: uuid.New(), Type: "test.happened", Time: time.Now(), Data: map[string]string{"k": "v"}}
+			wm.handle(context.Background(), ev)
+			// does not match the subscription
+			wm.handle(context.Background(), jelly.Event{ID: uuid.New(), Type: "other.happened"})
+			assert.NoError(wm.wait(context.Background()))
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			if !assert.Len(deliveries, tc.expectAttempts) {
+				return
+			}
+
+			for i, d := range deliveries {
+				assert.Equal("test.happened", d.header.Get("X-Jelly-Event"), "attempt #%d", i+1)
+				assert.Equal(ev.ID.String(), d.header.Get("X-Jelly-Delivery"), "attempt #%d", i+1)
+
+				var received jelly.Event
+				assert.NoError(json.Unmarshal(d.body, &received), "attempt #%d", i+1)
+				assert.Equal(ev.ID, received.ID, "attempt #%d", i+1)
+
+				sig := d.header.Get(jelly.WebhookSignatureHeader)
+				if tc.secret == "" {
+					assert.Empty(sig, "attempt #%d", i+1)
+				} else {
+					// the signature is of the exact body that was received
+					assert.Equal(jelly.SignWebhook(tc.secret, d.body), sig, "attempt #%d", i+1)
+					assert.NotEqual(jelly.SignWebhook("wrong", d.body), sig, "attempt #%d", i+1)
+				}
+			}
+
+			dead := wm.deadLetters()
+			if !tc.expectDead {
+				assert.Empty(dead)
+				return
+			}
+			if assert.Len(dead, 1) {
+				assert.Equal(ev.ID, dead[0].Event.ID)
+				assert.Equal(hook.URL, dead[0].URL)
+				assert.Equal(tc.expectAttempts, dead[0].Attempts)
+			}
+		})
+	}
+}
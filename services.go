@@ -0,0 +1,85 @@
+package jelly
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ServiceAPI is an interface that can optionally be implemented by an API to
+// provide a service that other APIs on the same server can use, such as the
+// UserLoginService of jellyauth. Other APIs get it with Bundle.Service, which
+// lets them work with the API without importing its package or sharing a
+// global.
+type ServiceAPI interface {
+	API
+
+	// ProvidedService returns the service that the API provides. It is only
+	// called after the API's Init has returned successfully, so the service
+	// can be created during Init.
+	ProvidedService() interface{}
+}
+
+// DependentAPI is an interface that can optionally be implemented by an API
+// that uses the service of another API during its own Init. The server waits
+// to initialize it until every API that it depends on has been initialized, so
+// that Bundle.Service gives their services during Init. APIs that only use
+// other services after Init, such as in Routes, do not need to implement it.
+type DependentAPI interface {
+	API
+
+	// DependsOn returns the names of the APIs that must be initialized before
+	// this one. Each must be added to the server and enabled; if one is not
+	// added by the time the server starts, starting it fails. A dependency
+	// cycle is an error when the last API in it is added.
+	DependsOn() []string
+}
+
+// ServiceLocator gives the service of the API with the given name, for
+// Bundle.Service. It is created by the server, and generally does not need to
+// be implemented directly.
+type ServiceLocator func(name string) (interface{}, error)
+
+// WithServices returns a copy of the Bundle whose Service method gets
+// services with loc.
+func (bndl Bundle) WithServices(loc ServiceLocator) Bundle {
+	newBndl := bndl
+	newBndl.services = loc
+	return newBndl
+}
+
+// Service returns the service of the API with the given name, which must
+// implement ServiceAPI. The name is case-insensitive.
+//
+// During Init, only the services of APIs that were already initialized are
+// available; an API that needs a service during Init must implement
+// DependentAPI to make sure the server initializes the other API first. Once
+// every API has been initialized, such as in Routes, every service is
+// available.
+//
+// If the API does not exist, is not enabled, does not provide a service, or
+// has not yet been initialized, the returned error matches ErrNotFound.
+func (bndl Bundle) Service(name string) (interface{}, error) {
+	if bndl.services == nil {
+		return nil, NewError(fmt.Sprintf("no services are available to look up %q", name), ErrNotFound)
+	}
+	return bndl.services(name)
+}
+
+// ServiceAs returns the service of the API with the given name as type T, as
+// with Bundle.Service. If the service is not a T, an error is returned.
+//
+//	users, err := jelly.ServiceAs[jelly.UserLoginService](bndl, "jellyauth")
+func ServiceAs[T any](bndl Bundle, name string) (T, error) {
+	var zero T
+
+	svc, err := bndl.Service(name)
+	if err != nil {
+		return zero, err
+	}
+
+	typed, ok := svc.(T)
+	if !ok {
+		return zero, fmt.Errorf("service of API %q is a %T, not a %s", name, svc, reflect.TypeOf((*T)(nil)).Elem())
+	}
+	return typed, nil
+}
@@ -0,0 +1,131 @@
+package jelly
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Kinds of StartupPhase.
+const (
+	// StartupConfig is the phase in which the config is checked and the
+	// logger, ID generator, and encryption keys are created from it.
+	StartupConfig = "config"
+
+	// StartupDB is the phase in which a DB is connected to, or in a dry run
+	// that does not connect DBs, checked. There is one for each DB that is
+	// connected to during startup.
+	StartupDB = "db"
+
+	// StartupQuota is the phase in which the quota manager is created.
+	StartupQuota = "quota"
+
+	// StartupI18n is the phase in which the message catalog is loaded.
+	StartupI18n = "i18n"
+
+	// StartupAPI is the phase in which an API is initialized. There is one for
+	// each enabled API.
+	StartupAPI = "api"
+
+	// StartupRoutes is the phase in which the routes of every API are mounted
+	// on the router of the server.
+	StartupRoutes = "routes"
+
+	// StartupListen is the phase in which the gRPC server and TLS are set up,
+	// if enabled, and the server binds to the addresses it listens on.
+	StartupListen = "listen"
+)
+
+// StartupPhase is a single step in starting a server and how it went.
+type StartupPhase struct {
+	// Kind is what the phase does, such as StartupDB.
+	Kind string
+
+	// Name is the name of the DB or API that the phase is for. It is empty
+	// for phases that are not for a particular one.
+	Name string
+
+	// Duration is how long the phase took.
+	Duration time.Duration
+
+	// Err is why the phase failed. It is nil if the phase passed.
+	Err error
+}
+
+// String returns the kind of sp followed by its name, if it has one.
+func (sp StartupPhase) String() string {
+	if sp.Name == "" {
+		return sp.Kind
+	}
+	return sp.Kind + " " + sp.Name
+}
+
+// StartupReport lists each phase of starting a server in the order that they
+// were done. As startup stops at the first phase that fails, only the last
+// phase can have failed.
+type StartupReport struct {
+	Phases []StartupPhase
+}
+
+// Add adds the phase of the given kind and name that began at start and ended
+// now, failing with err if it is not nil.
+func (sr *StartupReport) Add(kind, name string, start time.Time, err error) {
+	sr.Phases = append(sr.Phases, StartupPhase{
+		Kind:     kind,
+		Name:     name,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+// Err returns the error of the first phase that failed, or nil if every phase
+// passed.
+func (sr StartupReport) Err() error {
+	for _, p := range sr.Phases {
+		if p.Err != nil {
+			return p.Err
+		}
+	}
+	return nil
+}
+
+// String returns the report as a table with a line for each phase giving
+// whether it passed, its name, how long it took, and its error if it failed.
+func (sr StartupReport) String() string {
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	for _, p := range sr.Phases {
+		status, errText := "PASS", ""
+		if p.Err != nil {
+			status, errText = "FAIL", p.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", status, p, p.Duration.Round(time.Millisecond), errText)
+	}
+	tw.Flush()
+
+	// passed phases have no error, so their lines end in padding
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// StartupError is an error that stopped a server from starting. It has the
+// report of the phases of startup up to and including the one that failed.
+type StartupError struct {
+	Report StartupReport
+	Err    error
+}
+
+// Error returns the message of the error that stopped startup.
+func (se *StartupError) Error() string {
+	return se.Err.Error()
+}
+
+// Unwrap returns the error that stopped startup.
+func (se *StartupError) Unwrap() error {
+	return se.Err
+}
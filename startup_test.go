@@ -0,0 +1,35 @@
+package jelly
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StartupReport(t *testing.T) {
+	assert := assert.New(t)
+
+	connErr := errors.New("connection refused")
+	report := StartupReport{Phases: []StartupPhase{
+		{Kind: StartupConfig, Duration: 2 * time.Millisecond},
+		{Kind: StartupDB, Name: "main", Duration: 1500 * time.Millisecond},
+		{Kind: StartupDB, Name: "reports", Duration: 3 * time.Second, Err: connErr},
+	}}
+
+	assert.Equal(connErr, report.Err())
+	assert.Equal(""+
+		"PASS  config      2ms\n"+
+		"PASS  db main     1.5s\n"+
+		"FAIL  db reports  3s    connection refused",
+		report.String(),
+	)
+
+	se := &StartupError{Report: report, Err: fmt.Errorf("DB %q: %w", "reports", connErr)}
+	assert.EqualError(se, `DB "reports": connection refused`)
+	assert.ErrorIs(se, connErr)
+
+	assert.NoError(StartupReport{Phases: report.Phases[:2]}.Err())
+}
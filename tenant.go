@@ -0,0 +1,107 @@
+package jelly
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// tenantCtxKey is the key in a context that holds the current tenant.
+type tenantCtxKey struct{}
+
+// WithTenant returns a copy of ctx that has the given tenant ID set as the
+// current tenant. The built-in auth stores limit all of their operations to
+// the current tenant of the context they are given.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenantID)
+}
+
+// TenantFromContext returns the current tenant ID that was set on ctx with
+// WithTenant. If no tenant has been set, or if the set tenant is the empty
+// string, it returns "" and false.
+func TenantFromContext(ctx context.Context) (tenantID string, ok bool) {
+	tenantID, _ = ctx.Value(tenantCtxKey{}).(string)
+	return tenantID, tenantID != ""
+}
+
+// TenancyConfig contains options for resolving the tenant that a request is
+// made on behalf of. When tenancy is enabled, the server resolves the tenant of
+// every request before passing it to any API and makes it available with
+// TenantFromContext. Sources are checked in the following order, and the first
+// one that gives a tenant is used:
+//
+//  1. The request header named by Header.
+//  2. The subdomain of Domain that the request was made to, if Domain is set.
+//  3. The tenant of the logged-in user, which for jellyauth is given by the
+//     "tid" claim of their token. This source is only checked by endpoints
+//     that use auth middleware.
+//
+// If no source gives a tenant, the request has no tenant and is not limited to
+// one.
+type TenancyConfig struct {
+	// Enabled is whether to resolve tenants for requests.
+	Enabled bool
+
+	// Header is the name of the request header that gives the tenant ID. It
+	// will default to "X-Tenant-ID" if not set.
+	Header string
+
+	// Domain is the parent domain of all tenant subdomains, such as
+	// "example.com". If set, a request to "acme.example.com" has a tenant of
+	// "acme". If not set, tenants are not resolved from subdomains.
+	Domain string
+}
+
+func (tc TenancyConfig) FillDefaults() TenancyConfig {
+	newTC := tc
+
+	if newTC.Header == "" {
+		newTC.Header = "X-Tenant-ID"
+	}
+
+	return newTC
+}
+
+func (tc TenancyConfig) Validate() error {
+	if tc.Enabled && tc.Header == "" {
+		return fmt.Errorf("header: must not be empty")
+	}
+	if strings.HasPrefix(tc.Domain, ".") {
+		return fmt.Errorf("domain: must not start with \".\"")
+	}
+
+	return nil
+}
+
+// ResolveTenant returns the tenant ID given by req's header or subdomain. It
+// does not check the logged-in user. If neither gives a tenant, "" is
+// returned.
+func (tc TenancyConfig) ResolveTenant(req *http.Request) string {
+	if tc.Header != "" {
+		if tenantID := strings.TrimSpace(req.Header.Get(tc.Header)); tenantID != "" {
+			return tenantID
+		}
+	}
+
+	if tc.Domain != "" {
+		host := req.Host
+		if idx := strings.LastIndex(host, ":"); idx > strings.LastIndex(host, "]") {
+			host = host[:idx]
+		}
+		host = strings.ToLower(host)
+		suffix := "." + strings.ToLower(tc.Domain)
+
+		if strings.HasSuffix(host, suffix) {
+			sub := strings.TrimSuffix(host, suffix)
+
+			// only the label immediately below Domain is the tenant
+			if idx := strings.LastIndex(sub, "."); idx >= 0 {
+				sub = sub[idx+1:]
+			}
+			return sub
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,204 @@
+package jelly
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ACMEChallenge is a type of challenge that an ACME certificate authority uses
+// to verify that a server controls the domains it requests certificates for.
+type ACMEChallenge string
+
+const (
+	// ACMETLSALPN01 verifies domains with TLS-ALPN-01 challenges, which are
+	// answered on the server's own TLS listener. It is the default. The server
+	// must be reachable on port 443 for the challenges to succeed.
+	ACMETLSALPN01 ACMEChallenge = "tls-alpn-01"
+
+	// ACMEHTTP01 verifies domains with HTTP-01 challenges, which are answered
+	// on a separate plain HTTP listener, in addition to TLS-ALPN-01
+	// challenges. The listener must be reachable on port 80 for the challenges
+	// to succeed. Requests to it that are not for a challenge are redirected
+	// to HTTPS.
+	ACMEHTTP01 ACMEChallenge = "http-01"
+)
+
+func (c ACMEChallenge) String() string {
+	return string(c)
+}
+
+// ParseACMEChallenge parses the name of an ACMEChallenge. It is not
+// case-sensitive.
+func ParseACMEChallenge(s string) (ACMEChallenge, error) {
+	c := ACMEChallenge(strings.ToLower(s))
+	switch c {
+	case ACMETLSALPN01, ACMEHTTP01:
+		return c, nil
+	default:
+		return "", fmt.Errorf("must be one of %q or %q", ACMETLSALPN01, ACMEHTTP01)
+	}
+}
+
+// LetsEncryptURL is the directory URL of the Let's Encrypt production ACME
+// certificate authority.
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// TLSConfig contains options for serving HTTPS. If enabled, the server's
+// certificate is either loaded from files or obtained and renewed
+// automatically from an ACME certificate authority such as Let's Encrypt.
+type TLSConfig struct {
+	// Enabled is whether the server serves HTTPS instead of HTTP.
+	Enabled bool
+
+	// CertFile is the path to a PEM-encoded certificate chain for the server.
+	// It must be set along with KeyFile, unless Autocert is enabled.
+	CertFile string
+
+	// KeyFile is the path to the PEM-encoded private key of the certificate
+	// in CertFile.
+	KeyFile string
+
+	// Autocert is the configuration for obtaining certificates automatically.
+	// If enabled, CertFile and KeyFile must not be set.
+	Autocert AutocertConfig
+}
+
+func (tc TLSConfig) FillDefaults() TLSConfig {
+	newTC := tc
+
+	newTC.Autocert = newTC.Autocert.FillDefaults()
+
+	return newTC
+}
+
+func (tc TLSConfig) Validate() error {
+	if err := tc.Autocert.Validate(); err != nil {
+		return fmt.Errorf("autocert: %w", err)
+	}
+	if !tc.Enabled {
+		return nil
+	}
+
+	if tc.Autocert.Enabled {
+		if tc.CertFile != "" || tc.KeyFile != "" {
+			return fmt.Errorf("cert and key must not be set when autocert is enabled")
+		}
+		return nil
+	}
+	if tc.CertFile == "" {
+		return fmt.Errorf("cert: must be set unless autocert is enabled")
+	}
+	if tc.KeyFile == "" {
+		return fmt.Errorf("key: must be set unless autocert is enabled")
+	}
+
+	return nil
+}
+
+// AutocertConfig contains options for obtaining and renewing TLS certificates
+// automatically with ACME. Certificates are obtained when a client first
+// connects for one of the domains, and are renewed before they expire.
+type AutocertConfig struct {
+	// Enabled is whether certificates are obtained automatically.
+	Enabled bool
+
+	// Domains is the domains that certificates are obtained for. Connections
+	// for any other domain are refused. It must not be empty if Enabled is
+	// set.
+	Domains []string
+
+	// CacheDir is the directory that obtained certificates and the ACME
+	// account key are kept in, so that they survive restarts. It will default
+	// to "autocert" if not set.
+	CacheDir string
+
+	// Email is the contact address given to the certificate authority, which
+	// it may use to warn of problems with the certificates. It is optional.
+	Email string
+
+	// Challenge is the type of challenge used to verify the domains. It will
+	// default to ACMETLSALPN01 if not set.
+	Challenge ACMEChallenge
+
+	// HTTPAddress is the bind address of the plain HTTP listener that answers
+	// HTTP-01 challenges, in "ADDRESS:PORT" format. It is only used with
+	// ACMEHTTP01. It will default to ":80" if not set.
+	HTTPAddress string
+
+	// DirectoryURL is the directory URL of the ACME certificate authority. It
+	// will default to LetsEncryptURL if not set.
+	DirectoryURL string
+}
+
+func (ac AutocertConfig) FillDefaults() AutocertConfig {
+	newAC := ac
+
+	if newAC.CacheDir == "" {
+		newAC.CacheDir = "autocert"
+	}
+	if newAC.Challenge == "" {
+		newAC.Challenge = ACMETLSALPN01
+	}
+	if newAC.HTTPAddress == "" {
+		newAC.HTTPAddress = ":80"
+	}
+	if newAC.DirectoryURL == "" {
+		newAC.DirectoryURL = LetsEncryptURL
+	}
+
+	return newAC
+}
+
+func (ac AutocertConfig) Validate() error {
+	if !ac.Enabled {
+		return nil
+	}
+
+	if len(ac.Domains) < 1 {
+		return fmt.Errorf("domains: must not be empty")
+	}
+	for i, d := range ac.Domains {
+		if strings.TrimSpace(d) == "" {
+			return fmt.Errorf("domains: item #%d: must not be empty", i+1)
+		}
+	}
+	if ac.CacheDir == "" {
+		return fmt.Errorf("cache: must not be empty")
+	}
+	if _, err := ParseACMEChallenge(ac.Challenge.String()); err != nil {
+		return fmt.Errorf("challenge: %w", err)
+	}
+	if ac.Challenge == ACMEHTTP01 && !strings.Contains(ac.HTTPAddress, ":") {
+		return fmt.Errorf("http_listen: not in \"ADDRESS:PORT\" or \":PORT\" format")
+	}
+
+	return nil
+}
+
+// CertificateInfo is information on a certificate that was obtained by a
+// server with ACME.
+type CertificateInfo struct {
+	// Domain is the domain that the certificate is for.
+	Domain string
+
+	// NotAfter is when the certificate expires.
+	NotAfter time.Time
+
+	// Obtained is when the certificate was most recently obtained or renewed.
+	// It is the zero time if the certificate was loaded from the cache and has
+	// not been renewed since the server started.
+	Obtained time.Time
+
+	// Renewals is the number of times the certificate was obtained or renewed
+	// since the server started.
+	Renewals int
+
+	// Failures is the number of times that getting the certificate for a
+	// client's connection failed since the server started.
+	Failures int
+
+	// LastError is the error of the most recent failure, if the certificate
+	// has not been obtained since.
+	LastError string
+}
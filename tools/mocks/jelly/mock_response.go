@@ -12,6 +12,7 @@ package mock_jelly
 import (
 	http "net/http"
 	reflect "reflect"
+	time "time"
 
 	jelly "github.com/dekarrin/jelly"
 	gomock "go.uber.org/mock/gomock"
@@ -40,6 +41,25 @@ func (m *MockResponseGenerator) EXPECT() *MockResponseGeneratorMockRecorder {
 	return m.recorder
 }
 
+// Accepted mocks base method.
+func (m *MockResponseGenerator) Accepted(arg0 any, arg1 ...any) jelly.Result {
+	m.ctrl.T.Helper()
+	varargs := []any{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Accepted", varargs...)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// Accepted indicates an expected call of Accepted.
+func (mr *MockResponseGeneratorMockRecorder) Accepted(arg0 any, arg1 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Accepted", reflect.TypeOf((*MockResponseGenerator)(nil).Accepted), varargs...)
+}
+
 // BadRequest mocks base method.
 func (m *MockResponseGenerator) BadRequest(arg0 string, arg1 ...any) jelly.Result {
 	m.ctrl.T.Helper()
@@ -78,6 +98,25 @@ func (mr *MockResponseGeneratorMockRecorder) Conflict(arg0 any, arg1 ...any) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Conflict", reflect.TypeOf((*MockResponseGenerator)(nil).Conflict), varargs...)
 }
 
+// ConflictWithBody mocks base method.
+func (m *MockResponseGenerator) ConflictWithBody(arg0 any, arg1 ...any) jelly.Result {
+	m.ctrl.T.Helper()
+	varargs := []any{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ConflictWithBody", varargs...)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// ConflictWithBody indicates an expected call of ConflictWithBody.
+func (mr *MockResponseGeneratorMockRecorder) ConflictWithBody(arg0 any, arg1 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConflictWithBody", reflect.TypeOf((*MockResponseGenerator)(nil).ConflictWithBody), varargs...)
+}
+
 // Created mocks base method.
 func (m *MockResponseGenerator) Created(arg0 any, arg1 ...any) jelly.Result {
 	m.ctrl.T.Helper()
@@ -134,6 +173,43 @@ func (mr *MockResponseGeneratorMockRecorder) Forbidden(arg0 ...any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Forbidden", reflect.TypeOf((*MockResponseGenerator)(nil).Forbidden), arg0...)
 }
 
+// FromError mocks base method.
+func (m *MockResponseGenerator) FromError(arg0 error, arg1 ...any) jelly.Result {
+	m.ctrl.T.Helper()
+	varargs := []any{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "FromError", varargs...)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// FromError indicates an expected call of FromError.
+func (mr *MockResponseGeneratorMockRecorder) FromError(arg0 any, arg1 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FromError", reflect.TypeOf((*MockResponseGenerator)(nil).FromError), varargs...)
+}
+
+// Gone mocks base method.
+func (m *MockResponseGenerator) Gone(arg0 ...any) jelly.Result {
+	m.ctrl.T.Helper()
+	varargs := []any{}
+	for _, a := range arg0 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Gone", varargs...)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// Gone indicates an expected call of Gone.
+func (mr *MockResponseGeneratorMockRecorder) Gone(arg0 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Gone", reflect.TypeOf((*MockResponseGenerator)(nil).Gone), arg0...)
+}
+
 // InternalServerError mocks base method.
 func (m *MockResponseGenerator) InternalServerError(arg0 ...any) jelly.Result {
 	m.ctrl.T.Helper()
@@ -197,6 +273,20 @@ func (mr *MockResponseGeneratorMockRecorder) MethodNotAllowed(arg0 any, arg1 ...
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MethodNotAllowed", reflect.TypeOf((*MockResponseGenerator)(nil).MethodNotAllowed), varargs...)
 }
 
+// MovedPermanently mocks base method.
+func (m *MockResponseGenerator) MovedPermanently(arg0 string) jelly.Result {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MovedPermanently", arg0)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// MovedPermanently indicates an expected call of MovedPermanently.
+func (mr *MockResponseGeneratorMockRecorder) MovedPermanently(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MovedPermanently", reflect.TypeOf((*MockResponseGenerator)(nil).MovedPermanently), arg0)
+}
+
 // NoContent mocks base method.
 func (m *MockResponseGenerator) NoContent(arg0 ...any) jelly.Result {
 	m.ctrl.T.Helper()
@@ -233,6 +323,24 @@ func (mr *MockResponseGeneratorMockRecorder) NotFound(arg0 ...any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NotFound", reflect.TypeOf((*MockResponseGenerator)(nil).NotFound), arg0...)
 }
 
+// NotModified mocks base method.
+func (m *MockResponseGenerator) NotModified(arg0 ...any) jelly.Result {
+	m.ctrl.T.Helper()
+	varargs := []any{}
+	for _, a := range arg0 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "NotModified", varargs...)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// NotModified indicates an expected call of NotModified.
+func (mr *MockResponseGeneratorMockRecorder) NotModified(arg0 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NotModified", reflect.TypeOf((*MockResponseGenerator)(nil).NotModified), arg0...)
+}
+
 // OK mocks base method.
 func (m *MockResponseGenerator) OK(arg0 any, arg1 ...any) jelly.Result {
 	m.ctrl.T.Helper()
@@ -252,6 +360,58 @@ func (mr *MockResponseGeneratorMockRecorder) OK(arg0 any, arg1 ...any) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OK", reflect.TypeOf((*MockResponseGenerator)(nil).OK), varargs...)
 }
 
+// PartialContent mocks base method.
+func (m *MockResponseGenerator) PartialContent(arg0 any, arg1 string, arg2 ...any) jelly.Result {
+	m.ctrl.T.Helper()
+	varargs := []any{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "PartialContent", varargs...)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// PartialContent indicates an expected call of PartialContent.
+func (mr *MockResponseGeneratorMockRecorder) PartialContent(arg0, arg1 any, arg2 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PartialContent", reflect.TypeOf((*MockResponseGenerator)(nil).PartialContent), varargs...)
+}
+
+// PermanentRedirect mocks base method.
+func (m *MockResponseGenerator) PermanentRedirect(arg0 string) jelly.Result {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PermanentRedirect", arg0)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// PermanentRedirect indicates an expected call of PermanentRedirect.
+func (mr *MockResponseGeneratorMockRecorder) PermanentRedirect(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PermanentRedirect", reflect.TypeOf((*MockResponseGenerator)(nil).PermanentRedirect), arg0)
+}
+
+// PreconditionFailed mocks base method.
+func (m *MockResponseGenerator) PreconditionFailed(arg0 string, arg1 ...any) jelly.Result {
+	m.ctrl.T.Helper()
+	varargs := []any{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "PreconditionFailed", varargs...)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// PreconditionFailed indicates an expected call of PreconditionFailed.
+func (mr *MockResponseGeneratorMockRecorder) PreconditionFailed(arg0 any, arg1 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreconditionFailed", reflect.TypeOf((*MockResponseGenerator)(nil).PreconditionFailed), varargs...)
+}
+
 // Redirection mocks base method.
 func (m *MockResponseGenerator) Redirection(arg0 string) jelly.Result {
 	m.ctrl.T.Helper()
@@ -266,6 +426,25 @@ func (mr *MockResponseGeneratorMockRecorder) Redirection(arg0 any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Redirection", reflect.TypeOf((*MockResponseGenerator)(nil).Redirection), arg0)
 }
 
+// Resource mocks base method.
+func (m *MockResponseGenerator) Resource(arg0 int, arg1 any, arg2 string, arg3 ...any) jelly.Result {
+	m.ctrl.T.Helper()
+	varargs := []any{arg0, arg1, arg2}
+	for _, a := range arg3 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Resource", varargs...)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// Resource indicates an expected call of Resource.
+func (mr *MockResponseGeneratorMockRecorder) Resource(arg0, arg1, arg2 any, arg3 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{arg0, arg1, arg2}, arg3...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resource", reflect.TypeOf((*MockResponseGenerator)(nil).Resource), varargs...)
+}
+
 // Response mocks base method.
 func (m *MockResponseGenerator) Response(arg0 int, arg1 any, arg2 string, arg3 ...any) jelly.Result {
 	m.ctrl.T.Helper()
@@ -285,6 +464,25 @@ func (mr *MockResponseGeneratorMockRecorder) Response(arg0, arg1, arg2 any, arg3
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Response", reflect.TypeOf((*MockResponseGenerator)(nil).Response), varargs...)
 }
 
+// ServiceUnavailable mocks base method.
+func (m *MockResponseGenerator) ServiceUnavailable(arg0 string, arg1 time.Duration, arg2 ...any) jelly.Result {
+	m.ctrl.T.Helper()
+	varargs := []any{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ServiceUnavailable", varargs...)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// ServiceUnavailable indicates an expected call of ServiceUnavailable.
+func (mr *MockResponseGeneratorMockRecorder) ServiceUnavailable(arg0, arg1 any, arg2 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ServiceUnavailable", reflect.TypeOf((*MockResponseGenerator)(nil).ServiceUnavailable), varargs...)
+}
+
 // TextErr mocks base method.
 func (m *MockResponseGenerator) TextErr(arg0 int, arg1, arg2 string, arg3 ...any) jelly.Result {
 	m.ctrl.T.Helper()
@@ -304,6 +502,25 @@ func (mr *MockResponseGeneratorMockRecorder) TextErr(arg0, arg1, arg2 any, arg3
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TextErr", reflect.TypeOf((*MockResponseGenerator)(nil).TextErr), varargs...)
 }
 
+// TooManyRequests mocks base method.
+func (m *MockResponseGenerator) TooManyRequests(arg0 string, arg1 time.Duration, arg2 ...any) jelly.Result {
+	m.ctrl.T.Helper()
+	varargs := []any{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "TooManyRequests", varargs...)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// TooManyRequests indicates an expected call of TooManyRequests.
+func (mr *MockResponseGeneratorMockRecorder) TooManyRequests(arg0, arg1 any, arg2 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TooManyRequests", reflect.TypeOf((*MockResponseGenerator)(nil).TooManyRequests), varargs...)
+}
+
 // Unauthorized mocks base method.
 func (m *MockResponseGenerator) Unauthorized(arg0 string, arg1 ...any) jelly.Result {
 	m.ctrl.T.Helper()
@@ -322,3 +539,41 @@ func (mr *MockResponseGeneratorMockRecorder) Unauthorized(arg0 any, arg1 ...any)
 	varargs := append([]any{arg0}, arg1...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unauthorized", reflect.TypeOf((*MockResponseGenerator)(nil).Unauthorized), varargs...)
 }
+
+// UnprocessableEntity mocks base method.
+func (m *MockResponseGenerator) UnprocessableEntity(arg0 string, arg1 ...any) jelly.Result {
+	m.ctrl.T.Helper()
+	varargs := []any{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "UnprocessableEntity", varargs...)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// UnprocessableEntity indicates an expected call of UnprocessableEntity.
+func (mr *MockResponseGeneratorMockRecorder) UnprocessableEntity(arg0 any, arg1 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnprocessableEntity", reflect.TypeOf((*MockResponseGenerator)(nil).UnprocessableEntity), varargs...)
+}
+
+// UnsupportedMediaType mocks base method.
+func (m *MockResponseGenerator) UnsupportedMediaType(arg0 string, arg1 ...any) jelly.Result {
+	m.ctrl.T.Helper()
+	varargs := []any{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "UnsupportedMediaType", varargs...)
+	ret0, _ := ret[0].(jelly.Result)
+	return ret0
+}
+
+// UnsupportedMediaType indicates an expected call of UnsupportedMediaType.
+func (mr *MockResponseGeneratorMockRecorder) UnsupportedMediaType(arg0 any, arg1 ...any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnsupportedMediaType", reflect.TypeOf((*MockResponseGenerator)(nil).UnsupportedMediaType), varargs...)
+}
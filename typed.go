@@ -0,0 +1,83 @@
+package jelly
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// TypedEndpoint returns an http.HandlerFunc that calls fn with the request
+// decoded into a Req and gives the Resp it returns as the response, as created
+// by sp.Endpoint with the given overrides. It removes the parsing, validation,
+// and error-handling boilerplate of an EndpointFunc:
+//
+//	r.Post("/", jelly.TypedEndpoint(sp, func(ctx context.Context, req CreateThing) (Thing, error) {
+//		return api.Things.Create(ctx, req.Name)
+//	}))
+//
+// If Req is a struct, its fields are set from the query parameters of the
+// request with BindQuery. Then, if the request has a body, it is decoded into
+// Req with ParseJSONRequest. If Req or *Req has a Validate() error method, it
+// is called last. If any of these steps fails, the client is given an HTTP-400
+// and fn is not called, unless Validate returns a ValidationError, which gives
+// an HTTP-422 that lists the invalid fields. Path parameters and the logged-in
+// user can be gotten from ctx with chi.URLParamFromCtx and ContextOf.
+//
+// If fn returns an error, it is responded to with sp.FromError, which gives
+// the status that ErrorStatus maps its cause to. Otherwise, the Resp is given
+// with an HTTP-201 if the request was a POST and an HTTP-200 if not. If Resp is a type
+// with no size, such as struct{}, an HTTP-204 with no body is given instead.
+func TypedEndpoint[Req, Resp any](sp ServiceProvider, fn func(ctx context.Context, req Req) (Resp, error), overrides ...Override) http.HandlerFunc {
+	noBody := reflect.TypeOf((*Resp)(nil)).Elem().Size() == 0
+
+	return sp.Endpoint(func(r *http.Request) Result {
+		var req Req
+		if err := decodeTypedRequest(r, &req); err != nil {
+			return sp.FromError(err, "decode request: %v", err)
+		}
+
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			return sp.FromError(err)
+		}
+
+		if noBody {
+			return sp.NoContent()
+		}
+		if r.Method == http.MethodPost {
+			return sp.Created(resp)
+		}
+		return sp.OK(resp)
+	}, overrides...)
+}
+
+// decodeTypedRequest sets v, a pointer to the request type of a TypedEndpoint,
+// from the query parameters and body of r and then validates it. The returned
+// error has a message suitable for giving to the client.
+func decodeTypedRequest(r *http.Request, v interface{}) error {
+	if reflect.TypeOf(v).Elem().Kind() == reflect.Struct {
+		if err := BindQuery(r, v); err != nil {
+			return err
+		}
+	}
+
+	if r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0 {
+		if err := ParseJSONRequest(r, v); err != nil {
+			return err
+		}
+	}
+
+	// both the value and pointer method sets are checked since v is a
+	// pointer.
+	if validator, ok := v.(interface{ Validate() error }); ok {
+		if err := validator.Validate(); err != nil {
+			if errors.Is(err, ErrValidation) {
+				return err
+			}
+			return NewError(err.Error(), ErrBadArgument)
+		}
+	}
+
+	return nil
+}
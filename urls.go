@@ -0,0 +1,85 @@
+package jelly
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// URLFor returns the path of a resource of the API, relative to the server
+// root. It is the Base of the API followed by each of segments, which are
+// formatted with fmt.Sprint, so IDs such as a uuid.UUID may be given as-is:
+//
+//	bndl.URLFor("users", user.ID) // "/api/auth/users/0f6e..."
+//
+// A segment that contains slashes is split into several; empty ones are
+// dropped, and each is escaped for use in a path. Use Absolute to get a
+// complete URL from the returned path.
+func (bndl Bundle) URLFor(segments ...interface{}) string {
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSuffix(bndl.Base(), "/"))
+
+	for _, seg := range segments {
+		for _, part := range strings.Split(fmt.Sprint(seg), "/") {
+			if part == "" {
+				continue
+			}
+			sb.WriteRune('/')
+			sb.WriteString(url.PathEscape(part))
+		}
+	}
+
+	if sb.Len() == 0 {
+		return "/"
+	}
+	return sb.String()
+}
+
+// Absolute returns the complete URL of path, which must be relative to the
+// server root, such as one returned by URLFor, for use in responses to req.
+// The scheme and host are those that req was made to. If the "real_ip"
+// middleware is enabled, the server is taken to be behind a trusted proxy and
+// the X-Forwarded-Proto and X-Forwarded-Host headers of req are used in
+// their place if present; otherwise they are ignored, as any client could set
+// them.
+func (bndl Bundle) Absolute(req *http.Request, path string) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	host := req.Host
+
+	if bndl.behindProxy() {
+		if proto := firstHeaderValue(req, "X-Forwarded-Proto"); proto != "" {
+			scheme = strings.ToLower(proto)
+		}
+		if fwdHost := firstHeaderValue(req, "X-Forwarded-Host"); fwdHost != "" {
+			host = fwdHost
+		}
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return scheme + "://" + host + path
+}
+
+// behindProxy returns whether the server is configured as being behind a
+// trusted proxy, which is when the "real_ip" middleware is enabled.
+func (bndl Bundle) behindProxy() bool {
+	for _, name := range bndl.g.Middleware {
+		if strings.EqualFold(name, MiddlewareRealIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstHeaderValue returns the first of the comma-separated values of the
+// named header of req, which is the one set by the proxy closest to the
+// client. It is "" if the header is not present.
+func firstHeaderValue(req *http.Request, name string) string {
+	v, _, _ := strings.Cut(req.Header.Get(name), ",")
+	return strings.TrimSpace(v)
+}
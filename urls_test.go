@@ -0,0 +1,92 @@
+package jelly
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bundle_URLFor(t *testing.T) {
+	id := uuid.MustParse("2bd2e4ff-a8b2-4d0a-8f2c-0c4f4b3e9f13")
+
+	testCases := []struct {
+		name     string
+		uriBase  string
+		apiBase  string
+		segments []interface{}
+		expect   string
+	}{
+		{name: "no bases", segments: []interface{}{"users", id}, expect: "/users/2bd2e4ff-a8b2-4d0a-8f2c-0c4f4b3e9f13"},
+		{name: "API base", apiBase: "/auth", segments: []interface{}{"users", id}, expect: "/auth/users/2bd2e4ff-a8b2-4d0a-8f2c-0c4f4b3e9f13"},
+		{name: "server and API base", uriBase: "/api/", apiBase: "auth/", segments: []interface{}{"users"}, expect: "/api/auth/users"},
+		{name: "no segments", uriBase: "/api", apiBase: "/auth", expect: "/api/auth"},
+		{name: "no segments or bases", expect: "/"},
+		{name: "segments with slashes", apiBase: "/auth", segments: []interface{}{"/users/", id, "sessions/"}, expect: "/auth/users/2bd2e4ff-a8b2-4d0a-8f2c-0c4f4b3e9f13/sessions"},
+		{name: "escaped", segments: []interface{}{"files", "sollux captor?"}, expect: "/files/sollux%20captor%3F"},
+		{name: "numbers", segments: []interface{}{"pages", 413}, expect: "/pages/413"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			api := (&CommonConfig{Name: "auth", Base: tc.apiBase}).FillDefaults()
+			bndl := NewBundle(api, Globals{URIBase: tc.uriBase}, nil, nil)
+
+			assert.Equal(t, tc.expect, bndl.URLFor(tc.segments...))
+		})
+	}
+}
+
+func Test_Bundle_Absolute(t *testing.T) {
+	testCases := []struct {
+		name       string
+		middleware []string
+		tls        bool
+		headers    map[string]string
+		path       string
+		expect     string
+	}{
+		{name: "http", path: "/auth/users", expect: "http://example.com/auth/users"},
+		{name: "https", tls: true, path: "/auth/users", expect: "https://example.com/auth/users"},
+		{name: "relative path", path: "auth", expect: "http://example.com/auth"},
+		{
+			name:    "forwarded headers ignored without proxy",
+			headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "public.example"},
+			path:    "/auth",
+			expect:  "http://example.com/auth",
+		},
+		{
+			name:       "forwarded headers used behind proxy",
+			middleware: []string{MiddlewareRecover, MiddlewareRealIP},
+			headers:    map[string]string{"X-Forwarded-Proto": "HTTPS, http", "X-Forwarded-Host": "public.example, internal"},
+			path:       "/auth",
+			expect:     "https://public.example/auth",
+		},
+		{
+			name:       "behind proxy without forwarded headers",
+			middleware: []string{MiddlewareRealIP},
+			tls:        true,
+			path:       "/auth",
+			expect:     "https://example.com/auth",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			api := (&CommonConfig{Name: "auth"}).FillDefaults()
+			bndl := NewBundle(api, Globals{Middleware: tc.middleware}, nil, nil)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			assert.Equal(t, tc.expect, bndl.Absolute(req, tc.path))
+		})
+	}
+}
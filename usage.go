@@ -0,0 +1,59 @@
+package jelly
+
+import "context"
+
+// APIUsage is the resources used by a single API of a server, as returned by
+// RESTServer.Usage. It allows operators to find which of the APIs hosted on
+// the same server is misbehaving.
+type APIUsage struct {
+	// Goroutines is the number of goroutines that the API started with
+	// Bundle.Go that are still running.
+	Goroutines int64 `json:"goroutines"`
+
+	// GoroutinesStarted is the total number of goroutines that the API has
+	// started with Bundle.Go.
+	GoroutinesStarted int64 `json:"goroutines_started"`
+
+	// InFlight is the number of requests to the API currently being handled.
+	InFlight int64 `json:"in_flight"`
+
+	// Requests is the total number of requests to the API that have been
+	// handled.
+	Requests int64 `json:"requests"`
+
+	// AllocBytes is an estimate of the number of bytes of heap memory that
+	// have been allocated while handling requests to the API. It is measured
+	// as the growth in the heap allocations of the whole program during each
+	// request, so allocations made at the same time by other requests and
+	// goroutines are included as well. It is only meaningful in comparison
+	// with that of other APIs on the same server.
+	AllocBytes uint64 `json:"alloc_bytes"`
+}
+
+// GoFunc runs fn in a new goroutine on behalf of an API, giving it a context
+// that is canceled when the API is shut down. See Bundle.Go.
+type GoFunc func(fn func(ctx context.Context))
+
+// WithGo returns a copy of the Bundle whose Go method starts goroutines with
+// gf.
+func (bndl Bundle) WithGo(gf GoFunc) Bundle {
+	newBndl := bndl
+	newBndl.goFunc = gf
+	return newBndl
+}
+
+// Go runs fn in a new goroutine that is counted in the usage of the API, as
+// given by RESTServer.Usage. APIs should start their background work with it
+// instead of a go statement so that operators can see which API a buildup of
+// goroutines belongs to. The context given to fn is canceled when the API is
+// shut down, and fn should return soon after.
+//
+// If the Bundle was not given a GoFunc with WithGo, fn is run in a goroutine
+// that is not counted, with a context that is never canceled.
+func (bndl Bundle) Go(fn func(ctx context.Context)) {
+	if bndl.goFunc == nil {
+		go fn(context.Background())
+		return
+	}
+	bndl.goFunc(fn)
+}
@@ -0,0 +1,31 @@
+package jelly
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bundle_Go(t *testing.T) {
+	t.Run("without GoFunc", func(t *testing.T) {
+		done := make(chan struct{})
+		Bundle{}.Go(func(ctx context.Context) {
+			assert.NoError(t, ctx.Err())
+			close(done)
+		})
+		<-done
+	})
+
+	t.Run("with GoFunc", func(t *testing.T) {
+		var calls int
+		gf := func(fn func(ctx context.Context)) {
+			calls++
+			fn(context.Background())
+		}
+		ran := false
+		Bundle{}.WithGo(gf).Go(func(ctx context.Context) { ran = true })
+		assert.Equal(t, 1, calls)
+		assert.True(t, ran)
+	})
+}
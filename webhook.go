@@ -0,0 +1,189 @@
+package jelly
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookSignatureHeader is the header of a webhook delivery that holds the
+// HMAC-SHA256 signature of its body, made with the secret of the subscription
+// it was delivered for. It is only set for subscriptions that have a secret.
+const WebhookSignatureHeader = "X-Jelly-Signature"
+
+// SignWebhook returns the value of the WebhookSignatureHeader of a webhook
+// delivery with the given body for a subscription with the given secret. It is
+// in the format "sha256=HEX_DIGEST". Receivers of webhooks can use it to check
+// the signature of deliveries.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookSubscription is a subscription of a URL to the events published on a
+// server. Each matching event is sent to the URL in the body of a POST
+// request.
+type WebhookSubscription struct {
+	// ID uniquely identifies the subscription. Subscriptions in config are
+	// given one when the server starts.
+	ID uuid.UUID
+
+	// URL is the URL that events are delivered to.
+	URL string
+
+	// Secret is used to sign the body of each delivery with HMAC-SHA256; see
+	// SignWebhook. If not set, deliveries are not signed.
+	Secret string
+
+	// Events are patterns of the types of events that are delivered, in the
+	// format used by EventMatches. If empty, every event is delivered.
+	Events []string
+}
+
+// Matches returns whether events of the given type are delivered to the
+// subscription.
+func (ws WebhookSubscription) Matches(eventType string) bool {
+	if len(ws.Events) == 0 {
+		return true
+	}
+	for _, pattern := range ws.Events {
+		if EventMatches(pattern, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ws WebhookSubscription) Validate() error {
+	if ws.URL == "" {
+		return fmt.Errorf("url: must be set")
+	}
+	u, err := url.Parse(ws.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url: scheme must be http or https")
+	}
+	for i := range ws.Events {
+		if strings.TrimSpace(ws.Events[i]) == "" {
+			return fmt.Errorf("events: item #%d: must not be empty", i+1)
+		}
+	}
+	return nil
+}
+
+// WebhookConfig contains options for delivering the events published on a
+// server to webhooks.
+type WebhookConfig struct {
+	// Subscriptions are the webhooks that events are delivered to when the
+	// server starts. More can be added at runtime with the admin endpoints.
+	Subscriptions []WebhookSubscription
+
+	// Admin is whether to serve the admin endpoints for managing
+	// subscriptions and viewing failed deliveries. Only logged-in users with
+	// the admin role may use them. Subscriptions made with them are not kept
+	// when the server stops.
+	Admin bool
+
+	// Path is the path that the admin endpoints are served under. Unlike the
+	// paths of APIs, it is relative to the server root, not to the server's
+	// base. It will default to "/webhooks" if not set.
+	Path string
+
+	// Attempts is the maximum number of times that delivery of an event to a
+	// webhook is attempted before it is given up on. It will default to 5 if
+	// not set.
+	Attempts int
+
+	// RetryDelayMillis is the amount of time (in milliseconds) before the
+	// first retry of a failed delivery. It doubles with each retry after. It
+	// will default to 1000 if not set.
+	RetryDelayMillis int
+
+	// TimeoutMillis is the maximum amount of time (in milliseconds) that a
+	// single attempt at delivery may take. It will default to 5000 if not set.
+	TimeoutMillis int
+
+	// DeadLetters is the number of the most recent deliveries that were given
+	// up on that are kept for viewing with the admin endpoints. Every one is
+	// also logged. It will default to 100 if not set.
+	DeadLetters int
+}
+
+func (wc WebhookConfig) FillDefaults() WebhookConfig {
+	newWC := wc
+
+	if newWC.Path == "" {
+		newWC.Path = "/webhooks"
+	}
+	if newWC.Attempts == 0 {
+		newWC.Attempts = 5
+	}
+	if newWC.RetryDelayMillis == 0 {
+		newWC.RetryDelayMillis = 1000
+	}
+	if newWC.TimeoutMillis == 0 {
+		newWC.TimeoutMillis = 5000
+	}
+	if newWC.DeadLetters == 0 {
+		newWC.DeadLetters = 100
+	}
+
+	return newWC
+}
+
+func (wc WebhookConfig) Validate() error {
+	for i := range wc.Subscriptions {
+		if err := wc.Subscriptions[i].Validate(); err != nil {
+			return fmt.Errorf("subscriptions: item #%d: %w", i+1, err)
+		}
+	}
+	if wc.Admin && !strings.HasPrefix(wc.Path, "/") {
+		return fmt.Errorf("path: must start with a '/'")
+	}
+	if wc.Attempts < 1 {
+		return fmt.Errorf("attempts: must be at least 1")
+	}
+	if wc.RetryDelayMillis < 1 {
+		return fmt.Errorf("retry_delay: must be at least 1")
+	}
+	if wc.TimeoutMillis < 1 {
+		return fmt.Errorf("timeout: must be at least 1")
+	}
+	if wc.DeadLetters < 1 {
+		return fmt.Errorf("dead_letters: must be at least 1")
+	}
+
+	return nil
+}
+
+// WebhookDeadLetter is a delivery of an event to a webhook that was given up
+// on after every attempt failed.
+type WebhookDeadLetter struct {
+	// Subscription is the ID of the subscription that the event was being
+	// delivered for.
+	Subscription uuid.UUID
+
+	// URL is the URL that the event was being delivered to.
+	URL string
+
+	// Event is the event that was not delivered.
+	Event Event
+
+	// Attempts is the number of attempts that were made.
+	Attempts int
+
+	// Error is the error of the last attempt.
+	Error string
+
+	// Time is the time that the delivery was given up on.
+	Time time.Time
+}
@@ -0,0 +1,41 @@
+package jelly
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SignWebhook(t *testing.T) {
+	testCases := []struct {
+		name   string
+		secret string
+		body   string
+		expect string
+	}{
+		{
+			name:   "RFC 4231 test case 2",
+			secret: "Jefe",
+			body:   "what do ya want for nothing?",
+			expect: "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843",
+		},
+		{
+			name:   "empty body",
+			secret: "secret",
+			body:   "",
+			expect: "sha256=f9e66e179b6747ae54108f82f8ade8b3c25d76fd30afde6c395822c530196169",
+		},
+		{
+			name:   "JSON body",
+			secret: "secret",
+			body:   `{"type":"user.created"}`,
+			expect: "sha256=206e496bd8df47eee3e81ebb7c5a82f976e18eecfdaadc5125e5935f799cf3c1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, SignWebhook(tc.secret, []byte(tc.body)))
+		})
+	}
+}